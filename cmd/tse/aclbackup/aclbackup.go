@@ -0,0 +1,147 @@
+// Package aclbackup keeps copies of the tailnet ACL policies that `tse setup`
+// replaced, so `tse setup --rollback` can put the last one back.
+//
+// Each backup is the policy's HuJSON text, comments and all, in its own file
+// in the user's state directory. Backups form a stack per tailnet: setup
+// pushes one before every change, and a rollback restores and removes the
+// newest, so repeated rollbacks walk back through earlier setup runs.
+package aclbackup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stampFormat is the time in backup file names
+const stampFormat = "20060102T150405.000Z"
+
+// Keep is how many backups are kept per tailnet; older ones are pruned on Save
+const Keep = 10
+
+// Backup is an ACL policy as it was before setup changed it
+type Backup struct {
+	Tailnet string    `json:"tailnet"`
+	Time    time.Time `json:"time"`
+	ETag    string    `json:"etag,omitempty"` // The policy's ETag when it was saved
+	Policy  string    `json:"policy"`         // HuJSON, as the admin console shows it
+}
+
+// Dir returns the backup directory: $XDG_STATE_HOME/tse/acl-backups, then
+// ~/.local/state/tse/acl-backups
+func Dir() (string, error) {
+	if state := os.Getenv("XDG_STATE_HOME"); state != "" {
+		return filepath.Join(state, "tse", "acl-backups"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "tse", "acl-backups"), nil
+}
+
+// Save writes b to dir and prunes the tailnet's backups down to Keep,
+// returning the new file's path
+func Save(dir string, b *Backup) (string, error) {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode ACL backup: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	// Timestamps in the name sort oldest first; milliseconds keep two
+	// setups in the same second apart
+	path := filepath.Join(dir, prefix(b.Tailnet)+b.Time.UTC().Format(stampFormat)+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write ACL backup: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("failed to write ACL backup: %w", err)
+	}
+
+	paths, err := list(dir, b.Tailnet)
+	if err != nil {
+		return path, err
+	}
+	for len(paths) > Keep {
+		if err := os.Remove(paths[0]); err != nil {
+			return path, fmt.Errorf("failed to prune ACL backups: %w", err)
+		}
+		paths = paths[1:]
+	}
+	return path, nil
+}
+
+// Latest returns the tailnet's newest backup and its path, or nil if there
+// are none
+func Latest(dir, tailnet string) (*Backup, string, error) {
+	paths, err := list(dir, tailnet)
+	if err != nil || len(paths) == 0 {
+		return nil, "", err
+	}
+
+	path := paths[len(paths)-1]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read ACL backup: %w", err)
+	}
+	var b Backup
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, "", fmt.Errorf("failed to parse ACL backup %s: %w", path, err)
+	}
+	if b.Tailnet != tailnet {
+		return nil, "", fmt.Errorf("ACL backup %s is for tailnet %s, not %s", path, b.Tailnet, tailnet)
+	}
+	return &b, path, nil
+}
+
+// Count returns how many backups the tailnet has
+func Count(dir, tailnet string) (int, error) {
+	paths, err := list(dir, tailnet)
+	return len(paths), err
+}
+
+// list returns the tailnet's backup files, oldest first
+func list(dir, tailnet string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ACL backups: %w", err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		stamp, ok := strings.CutPrefix(name, prefix(tailnet))
+		// The length check keeps tailnet a from claiming tailnet a--b's backups
+		if ok && strings.HasSuffix(stamp, ".json") && len(stamp) == len(stampFormat+".json") {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// prefix is the start of a tailnet's backup file names, with anything that
+// doesn't belong in a file name (the @ in yourname@github) replaced
+func prefix(tailnet string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, tailnet)
+	return safe + "--"
+}
@@ -0,0 +1,55 @@
+package aclbackup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveLatest(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "acl-backups")
+
+	if b, _, err := Latest(dir, "me@github"); b != nil || err != nil {
+		t.Fatalf("Latest() with no backups = %+v, %v", b, err)
+	}
+
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i := range Keep + 2 {
+		b := &Backup{Tailnet: "me@github", Time: start.Add(time.Duration(i) * time.Minute), Policy: "// policy " + string(rune('a'+i))}
+		if _, err := Save(dir, b); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	// Another tailnet's backups are neither returned nor pruned
+	other := &Backup{Tailnet: "me@github--work", Time: start.Add(time.Hour), Policy: "{}"}
+	if _, err := Save(dir, other); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _ := Count(dir, "me@github"); n != Keep {
+		t.Errorf("Count() = %d, want %d after pruning", n, Keep)
+	}
+	latest, path, err := Latest(dir, "me@github")
+	if err != nil || latest.Policy != "// policy l" || !latest.Time.Equal(start.Add(11*time.Minute)) {
+		t.Fatalf("Latest() = %+v, %v; want the last one saved", latest, err)
+	}
+
+	// Removing the newest makes the one before it the latest
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if latest, _, _ := Latest(dir, "me@github"); latest.Policy != "// policy k" {
+		t.Errorf("Latest() after removal = %q, want policy k", latest.Policy)
+	}
+	if latest, _, _ := Latest(dir, "me@github--work"); latest == nil || latest.Policy != "{}" {
+		t.Errorf("Latest() for the other tailnet = %+v", latest)
+	}
+}
+
+func TestDir(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/state")
+	if dir, _ := Dir(); dir != filepath.Join("/state", "tse", "acl-backups") {
+		t.Errorf("Dir() = %s", dir)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/anoldguy/tse/cmd/tse/config"
+	"github.com/anoldguy/tse/cmd/tse/infrastructure"
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/tailscale"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const adoptNodesUsage = `Usage: tse adopt-nodes <region> [flags]
+
+Bring manually-launched Tailscale exit nodes under TSE management
+
+Looks up tailnet devices whose hostname matches --pattern, finds the EC2
+instances they connect from in the given region, and tags those instances
+so 'tse <region> stop', 'tse shutdown', and 'tse <region> cleanup' include them.
+Instances already managed by TSE are left alone.
+
+Prerequisites:
+  - TAILSCALE_API_TOKEN environment variable (API access token)
+  - TSE_LAMBDA_URL and TSE_AUTH_TOKEN (from 'tse deploy')
+
+Optional Flags:
+  --pattern string      Hostname glob to match (default "exit-*")
+  --tailnet string      Your tailnet name (default: the active profile's tailnet,
+                        or the API token's tailnet)
+  --dry-run             Show which instances would be adopted without tagging
+
+Examples:
+  tse adopt-nodes ohio                       # Adopt exit-* nodes running in ohio
+  tse adopt-nodes tokyo --pattern "vpn-*"    # Match a different naming scheme
+  tse adopt-nodes ohio --dry-run             # Preview only
+`
+
+func runAdoptNodes(ctx context.Context, lambdaURL string, args []string) error {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, adoptNodesUsage)
+		return fmt.Errorf("region required")
+	}
+	region, err := regions.Resolve(args[0])
+	if err != nil {
+		fmt.Fprint(os.Stderr, adoptNodesUsage)
+		return fmt.Errorf("invalid region %s\n%v", ui.Highlight(args[0]), err)
+	}
+
+	fs := flag.NewFlagSet("adopt-nodes", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, adoptNodesUsage)
+	}
+
+	pattern := fs.String("pattern", "exit-*", "Hostname glob to match")
+	defaultTailnet := os.Getenv(config.EnvTailnet)
+	if defaultTailnet == "" {
+		defaultTailnet = "-"
+	}
+	tailnet := fs.String("tailnet", defaultTailnet, "Tailnet name")
+	dryRun := fs.Bool("dry-run", false, "Preview without tagging instances")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	apiToken := os.Getenv("TAILSCALE_API_TOKEN")
+	if apiToken == "" {
+		return fmt.Errorf("TAILSCALE_API_TOKEN environment variable not set\n\nCreate one at: https://login.tailscale.com/admin/settings/keys")
+	}
+
+	client, err := tailscale.NewClient(apiToken)
+	if err != nil {
+		return fmt.Errorf("failed to create Tailscale client: %w", err)
+	}
+	// "-" refers to the default tailnet of the API token
+	client.SetTailnet(*tailnet)
+
+	var candidates []types.AdoptCandidate
+	err = ui.WithSpinner(fmt.Sprintf("Finding tailnet devices matching %s", *pattern), func() error {
+		devices, err := client.ListDevices(ctx)
+		if err != nil {
+			return err
+		}
+		candidates = adoptCandidates(devices, *pattern)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(candidates) == 0 {
+		fmt.Println()
+		fmt.Println(ui.Subtle(fmt.Sprintf("No tailnet devices with a public endpoint match %q.", *pattern)))
+		return nil
+	}
+
+	var adoptResp types.AdoptResponse
+	err = ui.WithSpinner(fmt.Sprintf("Matching %d device(s) to instances in %s", len(candidates), region), func() error {
+		payload, err := json.Marshal(types.AdoptRequest{Candidates: candidates, DryRun: *dryRun})
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+
+		url := fmt.Sprintf("%s/%s/adopt", lambdaURL, region)
+		resp, err := makeAuthenticatedRequest(ctx, "POST", url, bytes.NewReader(payload))
+		if err != nil {
+			return err // Already enhanced with context
+		}
+		defer resp.Body.Close()
+
+		body, err := types.ReadPayload(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return enhanceHTTPStatusError(resp.StatusCode, string(body), fmt.Sprintf("adopt nodes in %s", region))
+		}
+
+		if err := json.Unmarshal(body, &adoptResp); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if len(adoptResp.Adopted) == 0 {
+		fmt.Println(ui.Subtle(fmt.Sprintf("No unmanaged exit node instances found in %s.", region)))
+		return nil
+	}
+
+	table := ui.NewTable("Instance", "Hostname", "Public IP", "State")
+	for _, instance := range adoptResp.Adopted {
+		table.AddRow(instance.InstanceID, instance.TailscaleHostname, instance.PublicIP, instance.State)
+	}
+	fmt.Println(table.Render())
+	fmt.Println()
+
+	if adoptResp.DryRun {
+		fmt.Printf("%s %s\n", ui.Info("Dry run:"), adoptResp.Message)
+		fmt.Println(ui.Subtle("Re-run without --dry-run to tag these instances."))
+		return nil
+	}
+
+	fmt.Printf("%s %s\n", ui.Checkmark(), adoptResp.Message)
+	fmt.Println(ui.Subtle(fmt.Sprintf("They'll now be stopped by 'tse %s stop' and 'tse shutdown'.", region)))
+
+	return nil
+}
+
+// adoptCandidates selects devices matching the hostname pattern that have at least one
+// public endpoint to look up in EC2
+func adoptCandidates(devices []tailscale.Device, pattern string) []types.AdoptCandidate {
+	var candidates []types.AdoptCandidate
+	for _, device := range devices {
+		if !device.MatchesHostname(pattern) {
+			continue
+		}
+		ips := device.PublicIPs()
+		if len(ips) == 0 {
+			continue
+		}
+		candidates = append(candidates, types.AdoptCandidate{
+			Hostname:  device.ShortName(),
+			PublicIPs: ips,
+		})
+	}
+	return candidates
+}
+
+const adoptUsage = `Usage: tse adopt [flags]
+
+Bring existing AWS infrastructure under TSE management
+
+Infrastructure from the old OpenTofu/Terraform setup (or created by hand) is
+detected but not managed: it lacks the ManagedBy=tse tag. Adopt keeps those
+resources and brings them in line with what 'tse deploy' creates:
+
+  - Tags the log group, state table, IAM role, instance profile and Lambda
+  - Attaches AWSLambdaBasicExecutionRole if it's missing
+  - Replaces the inline policy if it differs from the current one
+  - Points the Lambda at the state table and instance profile
+  - Sets the log group's retention
+
+Nothing is deleted. Missing resources are not created; run 'tse deploy'
+afterwards for those.
+
+Flags:
+  --dry-run   Show what would change without changing it
+  --yes       Don't ask for confirmation
+
+Examples:
+  tse adopt --dry-run
+  tse adopt
+`
+
+func runAdopt(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("adopt", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, adoptUsage)
+	}
+
+	dryRun := fs.Bool("dry-run", false, "Show what would change without changing it")
+	yes := fs.Bool("yes", false, "Don't ask for confirmation")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+
+	region, err := infrastructure.GetDefaultRegion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to determine AWS region: %w", err)
+	}
+
+	var state *infrastructure.InfrastructureState
+	err = ui.WithSpinner(fmt.Sprintf("Discovering infrastructure in %s", region), func() error {
+		var err error
+		state, err = infrastructure.AutodiscoverInfrastructure(ctx, region)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("discovery failed: %w", err)
+	}
+	fmt.Println()
+
+	if !state.Exists() {
+		fmt.Println(ui.Subtle("No TSE infrastructure found"))
+		fmt.Printf("\n%s Run 'tse deploy' to create infrastructure\n", ui.Info("→"))
+		return nil
+	}
+
+	steps := infrastructure.PlanAdoption(state)
+	if len(steps) == 0 {
+		fmt.Printf("%s Infrastructure in %s is already managed by TSE\n", ui.Checkmark(), region)
+		return nil
+	}
+
+	table := ui.NewTable("Resource", "Change")
+	for _, step := range steps {
+		table.AddRow(step.Resource, step.Description)
+	}
+	fmt.Println(table.Render())
+	fmt.Println()
+
+	if *dryRun {
+		fmt.Println(ui.Subtle("Dry run: nothing was changed. Re-run without --dry-run to adopt."))
+		return nil
+	}
+
+	if !*yes {
+		fmt.Printf("%s Adopt these resources in %s? [y/N]: ", ui.Info("→"), ui.Highlight(region))
+		response, err := readLine(ctx, os.Stdin)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(strings.TrimSpace(response)) {
+		case "y", "yes":
+		default:
+			fmt.Println()
+			fmt.Println(ui.Success("✓ Cancelled - nothing was changed"))
+			return nil
+		}
+		fmt.Println()
+	}
+
+	clients, err := infrastructure.NewAWSClients(ctx, region)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, step := range steps {
+		err := ui.WithSpinner(fmt.Sprintf("%s: %s", step.Resource, step.Description), func() error {
+			return infrastructure.ApplyAdoptStep(ctx, clients, state, step)
+		})
+		if err != nil {
+			failed++
+		}
+	}
+	fmt.Println()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d changes failed; fix the errors above and re-run 'tse adopt'", failed, len(steps))
+	}
+
+	fmt.Println(ui.Success("✓ Infrastructure adopted"))
+	if missing := state.Missing(); len(missing) > 0 {
+		fmt.Printf("\n%s Run 'tse deploy' to create the %d missing resource(s)\n", ui.Info("→"), len(missing))
+	}
+	return nil
+}
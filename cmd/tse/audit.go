@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const auditUsage = `Usage: tse audit [flags]
+
+Show recent control actions recorded by the Lambda
+
+Every start, stop, cleanup, adopt and token change is recorded with the time,
+region, caller token ID, source IP and result, along with rejected requests
+(bad tokens, missing scopes). Entries are kept for 90 days. Reading the audit
+log requires the admin scope.
+
+Flags:
+  --since <duration>   How far back to look (default: 24h)
+  --limit <n>          Maximum entries to show (default: 50)
+
+Examples:
+  tse audit
+  tse audit --since 168h
+  tse audit --since 1h --limit 200
+`
+
+func runAudit(ctx context.Context, lambdaURL string, args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, auditUsage)
+	}
+
+	since := fs.Duration("since", 24*time.Hour, "How far back to look")
+	limit := fs.Int("limit", 50, "Maximum entries to show")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+	if *since <= 0 {
+		return fmt.Errorf("--since must be positive")
+	}
+	if *limit <= 0 {
+		return fmt.Errorf("--limit must be positive")
+	}
+
+	query := url.Values{}
+	query.Set("since", since.String())
+	query.Set("limit", strconv.Itoa(*limit))
+
+	var auditResp types.AuditResponse
+	err := ui.WithSpinner("Fetching audit log", func() error {
+		return apiRequest(ctx, "GET", lambdaURL+"/audit?"+query.Encode(), nil, http.StatusOK, "read audit log", &auditResp)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if len(auditResp.Entries) == 0 {
+		fmt.Println(ui.Subtle(fmt.Sprintf("No control actions in the last %s", *since)))
+		return nil
+	}
+
+	table := ui.NewTable("Time", "Action", "Region", "Token", "Source IP", "Result")
+	for _, entry := range auditResp.Entries {
+		token := entry.TokenID
+		if token == "" {
+			token = ui.Subtle("-")
+		} else if entry.TokenName != "" && entry.TokenName != entry.TokenID {
+			token = fmt.Sprintf("%s (%s)", entry.TokenID, entry.TokenName)
+		}
+
+		result := ui.Success("ok")
+		if entry.Status >= 400 {
+			result = ui.Error(fmt.Sprintf("%d %s", entry.Status, entry.Result))
+		}
+
+		table.AddRow(entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Action, entry.Region, token, entry.SourceIP, result)
+	}
+	fmt.Println(table.Render())
+	fmt.Println(ui.Subtle(auditResp.Message))
+	if auditResp.NextToken != "" {
+		fmt.Println(ui.Warning("⚠️  More entries than fit in one response; narrow --since to see the rest"))
+	}
+
+	return nil
+}
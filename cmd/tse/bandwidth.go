@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/anoldguy/tse/shared/regions"
+)
+
+// egressCost estimates what sending n bytes to the internet from region costs in
+// USD, reporting false for regions with no listed price. It ignores AWS's free
+// monthly allowance, so it's an upper bound.
+func egressCost(n int64, region string) (float64, bool) {
+	info, ok := regions.Lookup(region)
+	if !ok || info.EgressUSDPerGB == 0 {
+		return 0, false
+	}
+	return float64(n) / (1 << 30) * info.EgressUSDPerGB, true
+}
+
+// formatUSD renders an estimated cost, without claiming precision below a cent
+func formatUSD(usd float64) string {
+	if usd < 0.01 {
+		return "less than $0.01"
+	}
+	return fmt.Sprintf("about $%.2f", usd)
+}
+
+// dataTransfer describes what a node sent, e.g. "3.2 GB, about $0.29"
+func dataTransfer(n int64, region string) string {
+	if cost, ok := egressCost(n, region); ok {
+		return fmt.Sprintf("%s, %s", formatBytes(n), formatUSD(cost))
+	}
+	return formatBytes(n)
+}
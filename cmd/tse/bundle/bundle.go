@@ -0,0 +1,142 @@
+// Package bundle assembles the sanitized support bundle written by
+// `tse support-bundle`.
+//
+// Everything is collected in memory and passed through a Redactor before the
+// user reviews it, so nothing unredacted is ever written to disk.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Root is the directory every file in the archive lives under
+const Root = "tse-support"
+
+// Redacted replaces anything the Redactor removes
+const Redacted = "[REDACTED]"
+
+// File is one file in the bundle
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Bundle is an in-memory support bundle
+type Bundle struct {
+	Files []File
+}
+
+// Add adds a file
+func (b *Bundle) Add(name string, data []byte) {
+	b.Files = append(b.Files, File{Name: name, Data: data})
+}
+
+// AddJSON adds v as an indented JSON file
+func (b *Bundle) AddJSON(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	b.Add(name, append(data, '\n'))
+	return nil
+}
+
+// Redact passes every file through r
+func (b *Bundle) Redact(r *Redactor) {
+	for i := range b.Files {
+		b.Files[i].Data = []byte(r.Redact(string(b.Files[i].Data)))
+	}
+}
+
+// WriteTarGz writes the bundle as a gzipped tarball under Root/
+func (b *Bundle) WriteTarGz(w io.Writer, modTime time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, file := range b.Files {
+		header := &tar.Header{
+			Name:    path.Join(Root, file.Name),
+			Mode:    0o600,
+			Size:    int64(len(file.Data)),
+			ModTime: modTime,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.Data); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// redactionPattern replaces matches of re with replacement (which may use $1 etc.)
+type redactionPattern struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// Patterns for secrets and identifiers that shouldn't end up in a public bug report
+var patterns = []redactionPattern{
+	// Tailscale auth keys and API tokens
+	{regexp.MustCompile(`tskey-[A-Za-z0-9-]+`), "tskey-" + Redacted},
+	// Authorization headers
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`), "${1}" + Redacted},
+	// AWS access key IDs
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`), Redacted},
+	// AWS account IDs inside ARNs
+	{regexp.MustCompile(`(arn:aws[a-z-]*:[a-z0-9-]*:[a-z0-9-]*:)\d{12}`), "${1}" + Redacted},
+	// AWS account IDs named as such ("account 123456789012", from the deployment check)
+	{regexp.MustCompile(`(?i)(account\s+)\d{12}\b`), "${1}" + Redacted},
+	// Function URL hostnames (the URL is the Lambda's public endpoint)
+	{regexp.MustCompile(`[a-z0-9]+(\.lambda-url\.[a-z0-9-]+\.on\.aws)`), Redacted + "${1}"},
+	// Webhook URLs carry their secret in the path
+	{regexp.MustCompile(`(https://(?:hooks\.slack\.com|(?:[a-z]+\.)?discord(?:app)?\.com|ntfy\.sh)/)[^\s"',]+`), "${1}" + Redacted},
+	// 64-character hex strings (TSE_AUTH_TOKEN and issued token secrets)
+	{regexp.MustCompile(`\b[0-9a-f]{64}\b`), Redacted},
+	// IPv4 addresses keep their first two octets, enough to tell tailnet/VPC/public apart
+	{regexp.MustCompile(`\b(\d{1,3}\.\d{1,3})\.\d{1,3}\.\d{1,3}\b`), "${1}.x.x"},
+}
+
+// Redactor removes known secret values and common secret patterns from text
+type Redactor struct {
+	secrets []string
+}
+
+// NewRedactor returns a Redactor that also removes each of the given exact
+// values (empty values are ignored)
+func NewRedactor(secrets ...string) *Redactor {
+	r := &Redactor{}
+	for _, secret := range secrets {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+	// Longest first, so a secret containing another is removed whole
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+	return r
+}
+
+// Redact returns text with secrets replaced by Redacted
+func (r *Redactor) Redact(text string) string {
+	for _, secret := range r.secrets {
+		text = strings.ReplaceAll(text, secret, Redacted)
+	}
+	for _, p := range patterns {
+		text = p.re.ReplaceAllString(text, p.replacement)
+	}
+	return text
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const cleanupUsage = `Usage: tse cleanup --all-regions [flags]
+
+Force-clean orphaned TSE resources (instances, security groups, VPCs) in
+every supported region at once. Regions are swept concurrently and each
+region's result is shown as soon as it finishes.
+
+VPC stacks and security groups created in the last 10 minutes are skipped,
+since a 'tse <region> start' may be about to launch into them. So are
+resources another deployment in the same AWS account created.
+
+To clean a single region, use: tse <region> cleanup [--force]
+
+Flags:
+  --all-regions         Sweep every supported region (required)
+  --dry-run             List what would be cleaned up without deleting anything
+  --force               Also delete VPC stacks and security groups created in
+                        the last 10 minutes
+  --all-deployments     Also clean up other deployments' resources
+
+Examples:
+  tse cleanup --all-regions --dry-run   # See what's lying around
+  tse cleanup --all-regions             # Reclaim it
+`
+
+func runCleanup(ctx context.Context, lambdaURL string, args []string) error {
+	fs := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, cleanupUsage)
+	}
+
+	allRegions := fs.Bool("all-regions", false, "Sweep every supported region")
+	dryRun := fs.Bool("dry-run", false, "List resources without deleting them")
+	force := fs.Bool("force", false, "Also delete recently created VPC stacks and security groups")
+	allDeployments := fs.Bool("all-deployments", false, "Also clean up other deployments' resources")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if !*allRegions {
+		fs.Usage()
+		return fmt.Errorf("--all-regions is required (use 'tse <region> cleanup' for a single region)")
+	}
+
+	title := "Cleaning up TSE resources in all regions..."
+	if *dryRun {
+		title = "Looking for TSE resources in all regions (dry run)..."
+	}
+
+	var mu sync.Mutex
+	var allResources, allSkipped []string
+
+	req := types.CleanupRequest{DryRun: *dryRun, Force: *force, AllDeployments: *allDeployments}
+	results := ui.FanOut(title, regions.GetAllFriendlyNames(), func(region string) (string, error) {
+		cleanupResp, err := cleanupRegion(ctx, lambdaURL, region, req)
+		if err != nil {
+			return "", err
+		}
+
+		mu.Lock()
+		allResources = append(allResources, cleanupResp.TerminatedIDs...)
+		allSkipped = append(allSkipped, cleanupResp.SkippedIDs...)
+		mu.Unlock()
+
+		if cleanupResp.TerminatedCount == 0 {
+			return "nothing to clean up", nil
+		}
+		return formatResourceSummary(types.SummarizeResources(cleanupResp.TerminatedIDs)), nil
+	})
+
+	fmt.Println()
+	printFanOutFailures(results)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	defer printSkippedResources(allSkipped, "tse cleanup --all-regions --force")
+
+	if len(allResources) == 0 {
+		fmt.Println(ui.Subtle("No orphaned TSE resources found in any region."))
+		return nil
+	}
+
+	summary := formatResourceSummary(types.SummarizeResources(allResources))
+	if *dryRun {
+		fmt.Printf("%s would reclaim %s\n", ui.Info("Dry run:"), ui.Bold(summary))
+		fmt.Println(ui.Subtle("Re-run without --dry-run to delete them."))
+		return nil
+	}
+
+	fmt.Printf("%s %s reclaimed %s\n", ui.Checkmark(), ui.Success("Cleanup complete:"), ui.Bold(summary))
+	return nil
+}
+
+// cleanupRegion force-cleans (or lists, for a dry run) the TSE resources in a
+// single region. The Lambda does it as an async job, polled until it's done,
+// so a slow VPC teardown can't outlast the request. Lambdas without the state
+// table (501) are asked again to clean up while the request waits; ones from
+// before jobs do that anyway.
+func cleanupRegion(ctx context.Context, lambdaURL, region string, req types.CleanupRequest) (*types.StopResponse, error) {
+	req.Async = true
+	status, body, err := postCleanup(ctx, lambdaURL, region, req)
+	if err == nil && status == http.StatusNotImplemented {
+		req.Async = false
+		status, body, err = postCleanup(ctx, lambdaURL, region, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch status {
+	case http.StatusOK:
+	case http.StatusAccepted:
+		if body, err = waitForCleanupJob(ctx, lambdaURL, region, body); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, enhanceHTTPStatusError(status, string(body), fmt.Sprintf("cleanup resources in %s", region))
+	}
+
+	var cleanupResp types.StopResponse
+	if err := json.Unmarshal(body, &cleanupResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &cleanupResp, nil
+}
+
+// postCleanup sends a cleanup request, returning the status and body
+func postCleanup(ctx context.Context, lambdaURL, region string, req types.CleanupRequest) (int, []byte, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/%s/cleanup", lambdaURL, region)
+	resp, err := makeAuthenticatedRequest(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, err // Already enhanced with context
+	}
+	defer resp.Body.Close()
+
+	body, err := types.ReadPayload(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp.StatusCode, body, nil
+}
+
+// waitForCleanupJob polls the job a 202 cleanup response started until it's
+// done, returning the cleanup response it produced
+func waitForCleanupJob(ctx context.Context, lambdaURL, region string, accepted []byte) ([]byte, error) {
+	var jobResp types.JobResponse
+	if err := json.Unmarshal(accepted, &jobResp); err != nil || jobResp.Job == nil {
+		return nil, fmt.Errorf("failed to parse response: the Lambda started a cleanup in %s but sent no job", region)
+	}
+
+	c, err := lambdaClient(lambdaURL)
+	if err != nil {
+		return nil, err
+	}
+	job, err := c.WaitForJob(ctx, jobResp.Job.ID)
+	if err != nil {
+		return nil, explainLambdaError(err)
+	}
+	if job.Status != types.JobSucceeded {
+		return nil, fmt.Errorf("cleanup in %s failed: %s", region, job.Error)
+	}
+	return job.Result, nil
+}
+
+// printSkippedResources explains resources cleanup left alone for being too new.
+// Lambdas that predate the grace period never report any.
+func printSkippedResources(skipped []string, forceCommand string) {
+	if len(skipped) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Printf("%s Skipped %s created in the last 10 minutes; a start may be about to use them.\n",
+		ui.Warning("Note:"), formatResourceSummary(types.SummarizeResources(skipped)))
+	fmt.Println(ui.Subtle(fmt.Sprintf("   Run '%s' to delete them anyway.", forceCommand)))
+}
+
+// formatResourceSummary renders resource counts as "2 Instance, 1 VPC" in a stable order
+func formatResourceSummary(summary map[string]int) string {
+	kinds := make([]string, 0, len(summary))
+	for kind := range summary {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	parts := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		parts = append(parts, fmt.Sprintf("%d %s", summary[kind], kind))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,81 @@
+// Package clipboard copies text to the system clipboard through the platform's
+// own tool (pbcopy, clip, wl-copy, xclip or xsel), so tse needs no cgo or
+// clipboard library.
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrUnavailable is returned by Copy when no clipboard tool is installed
+var ErrUnavailable = errors.New("no clipboard tool found (install wl-clipboard, xclip or xsel)")
+
+// command is a clipboard tool and the arguments that make it read stdin
+type command struct {
+	name string
+	args []string
+}
+
+// candidates returns the tools to try for goos, best first. On Linux,
+// wl-copy only helps under Wayland and the X11 tools only with a display.
+func candidates(goos string, getenv func(string) string) []command {
+	switch goos {
+	case "darwin":
+		return []command{{name: "pbcopy"}}
+	case "windows":
+		return []command{{name: "clip.exe"}}
+	}
+
+	var cmds []command
+	if getenv("WAYLAND_DISPLAY") != "" {
+		cmds = append(cmds, command{name: "wl-copy"})
+	}
+	if getenv("DISPLAY") != "" {
+		cmds = append(cmds,
+			command{name: "xclip", args: []string{"-selection", "clipboard"}},
+			command{name: "xsel", args: []string{"--clipboard", "--input"}})
+	}
+	// WSL has Windows' clip on PATH
+	return append(cmds, command{name: "clip.exe"})
+}
+
+// find returns the first installed clipboard tool
+func find() (command, bool) {
+	for _, cmd := range candidates(runtime.GOOS, os.Getenv) {
+		if path, err := exec.LookPath(cmd.name); err == nil {
+			cmd.name = path
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// Available reports whether Copy has a tool to work with
+func Available() bool {
+	_, ok := find()
+	return ok
+}
+
+// Copy replaces the clipboard's contents with text
+func Copy(ctx context.Context, text string) error {
+	cmd, ok := find()
+	if !ok {
+		return ErrUnavailable
+	}
+
+	c := exec.CommandContext(ctx, cmd.name, cmd.args...)
+	c.Stdin = strings.NewReader(text)
+	if output, err := c.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%s failed: %s", cmd.name, msg)
+		}
+		return fmt.Errorf("%s failed: %w", cmd.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestCandidates(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(key string) string { return vars[key] }
+	}
+
+	tests := []struct {
+		goos string
+		env  map[string]string
+		want []string
+	}{
+		{"darwin", nil, []string{"pbcopy"}},
+		{"windows", nil, []string{"clip.exe"}},
+		{"linux", map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"}, []string{"wl-copy", "xclip", "xsel", "clip.exe"}},
+		{"linux", map[string]string{"DISPLAY": ":0"}, []string{"xclip", "xsel", "clip.exe"}},
+		{"linux", nil, []string{"clip.exe"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, cmd := range candidates(tt.goos, env(tt.env)) {
+			got = append(got, cmd.name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("candidates(%s, %v) = %v, want %v", tt.goos, tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("fakes xclip")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "clipboard")
+	script := "#!/bin/sh\n[ \"$*\" = \"-selection clipboard\" ] || exit 2\ncat > " + out + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "xclip"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("WAYLAND_DISPLAY", "")
+	t.Setenv("DISPLAY", ":0")
+
+	if !Available() {
+		t.Fatal("Available() = false with xclip on PATH")
+	}
+	if err := Copy(context.Background(), "tskey-auth-abc"); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "tskey-auth-abc" {
+		t.Errorf("clipboard = %q", data)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if err := Copy(context.Background(), "x"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Copy() without a tool error = %v, want ErrUnavailable", err)
+	}
+}
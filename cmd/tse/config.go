@@ -0,0 +1,333 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/anoldguy/tse/cmd/tse/config"
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/dns"
+	"github.com/anoldguy/tse/shared/regions"
+)
+
+const configUsage = `Usage: tse config <command> [flags]
+
+Manage the TSE config file
+
+Commands:
+  encrypt [flags]       Encrypt auth tokens stored in profiles
+  alias [list]          Show region groups: built-in and your own aliases
+  alias set <name> <region>[,<region>...]
+                        Define an alias for one or more regions, in order of preference
+  alias delete <name>   Remove an alias
+  chooser <latency|preference>
+                        How 'tse <group> start' picks a region: the one that answers
+                        fastest (default), or the first listed
+  region [list]         Show custom regions and the region allowlist
+  region set <name> <aws-region>
+                        Add a region tse doesn't know yet, or remap a built-in name
+  region delete <name>  Remove a custom region
+  region only <region>[,<region>...] | all
+                        Limit tse to these regions (all lifts the limit)
+  dns <resolver>|none   DNS new exit nodes resolve through unless 'start --dns'
+                        says otherwise: mullvad, adguard, quad9, nextdns:<id>, or
+                        IP addresses such as your Pi-hole's tailnet IP
+  keep-warm on|off|none Whether 'tse deploy' schedules a ping that keeps the Lambda
+                        warm (off removes it; none leaves it to --keep-warm)
+
+Custom regions, the allowlist and keep-warm reach AWS on the next 'tse deploy'.
+
+Flags for encrypt:
+  --keyring             Store a random key in the OS keyring (default)
+  --passphrase          Derive the key from TSE_CONFIG_PASSPHRASE instead
+
+Once encrypted, secrets are decrypted only when a profile is used, and new
+tokens saved with 'tse profile set' are encrypted automatically. With a
+passphrase-encrypted config, TSE_CONFIG_PASSPHRASE must be set for every command
+that loads a profile.
+
+Examples:
+  tse config encrypt                                  # Key in macOS Keychain / Secret Service / Credential Manager
+  TSE_CONFIG_PASSPHRASE=... tse config encrypt --passphrase
+  tse config alias set home ohio                      # tse home start
+  tse config alias set eu paris,frankfurt             # Replaces the built-in eu group
+  tse config chooser preference
+  tse config region set riyadh me-west-1              # Then: tse riyadh start
+  tse config region only ohio,frankfurt,tokyo
+  tse config dns nextdns:abc123                       # Your NextDNS profile's filtering
+  tse config keep-warm on                             # Then: tse deploy
+`
+
+func runConfig(args []string) error {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, configUsage)
+		return fmt.Errorf("config command required")
+	}
+
+	switch args[0] {
+	case "encrypt":
+		return encryptConfig(args[1:])
+	case "alias":
+		return runAlias(args[1:])
+	case "chooser":
+		return setChooser(args[1:])
+	case "region":
+		return runCustomRegions(args[1:])
+	case "dns":
+		return setDNS(args[1:])
+	case "keep-warm":
+		return setKeepWarm(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, configUsage)
+		return fmt.Errorf("unknown config command %s", ui.Highlight(args[0]))
+	}
+}
+
+func encryptConfig(args []string) error {
+	fs := flag.NewFlagSet("config encrypt", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, configUsage)
+	}
+
+	useKeyring := fs.Bool("keyring", false, "Store the key in the OS keyring")
+	usePassphrase := fs.Bool("passphrase", false, "Derive the key from TSE_CONFIG_PASSPHRASE")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *useKeyring && *usePassphrase {
+		return fmt.Errorf("--keyring and --passphrase are mutually exclusive")
+	}
+	keySource := config.KeySourceKeyring
+	if *usePassphrase {
+		keySource = config.KeySourcePassphrase
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	path, err := config.Path()
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.Encrypt(keySource); err != nil {
+		return err
+	}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s Encrypted secrets in %s\n", ui.Checkmark(), ui.Highlight(path))
+	if keySource == config.KeySourceKeyring {
+		fmt.Println(ui.Subtle("The key is stored in your OS keyring under service \"tse\"."))
+	} else {
+		fmt.Println(ui.Subtle(fmt.Sprintf("Keep %s set (or exported from your password manager) to use these profiles.", config.EnvPassphrase)))
+	}
+
+	return nil
+}
+
+func runAlias(args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		return listAliases()
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "set" && len(args) == 3:
+		if err := cfg.SetRegionAlias(args[1], strings.Split(args[2], ",")); err != nil {
+			return err
+		}
+		if err := cfg.Save(); err != nil {
+			return err
+		}
+		members, _ := cfg.RegionGroup(args[1])
+		fmt.Printf("%s %s → %s\n", ui.Checkmark(), ui.Highlight(strings.ToLower(args[1])), strings.Join(members, ", "))
+	case args[0] == "delete" && len(args) == 2:
+		if err := cfg.DeleteRegionAlias(args[1]); err != nil {
+			return err
+		}
+		if err := cfg.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("%s Deleted alias %s\n", ui.Checkmark(), ui.Highlight(args[1]))
+	default:
+		fmt.Fprint(os.Stderr, configUsage)
+		return fmt.Errorf("usage: tse config alias [list | set <name> <regions> | delete <name>]")
+	}
+	return nil
+}
+
+func listAliases() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	table := ui.NewTable("Name", "Regions", "Source")
+	for _, name := range cfg.AliasNames() {
+		table.AddRow(name, strings.Join(cfg.RegionAliases[name], ", "), "config")
+	}
+	for _, name := range regions.GroupNames() {
+		if _, overridden := cfg.RegionAliases[name]; overridden {
+			continue
+		}
+		members, _ := regions.Group(name)
+		table.AddRow(name, strings.Join(members, ", "), ui.Subtle("built-in"))
+	}
+	fmt.Println(table.Render())
+	fmt.Printf("%s %s\n", ui.Label("Chooser:"), cfg.Chooser())
+	return nil
+}
+
+func setChooser(args []string) error {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, configUsage)
+		return fmt.Errorf("usage: tse config chooser <%s>", strings.Join(config.Choosers, "|"))
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if err := cfg.SetChooser(args[0]); err != nil {
+		return err
+	}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s Region groups now pick by %s\n", ui.Checkmark(), ui.Highlight(args[0]))
+	return nil
+}
+
+func setDNS(args []string) error {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, configUsage)
+		return fmt.Errorf("usage: tse config dns <resolver>|%s", dns.None)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if err := cfg.SetDNS(args[0]); err != nil {
+		return err
+	}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+
+	if cfg.DNS == "" {
+		fmt.Printf("%s New exit nodes use the VPC's DNS resolver\n", ui.Checkmark())
+	} else {
+		fmt.Printf("%s New exit nodes resolve DNS through %s\n", ui.Checkmark(), ui.Highlight(cfg.DNS))
+	}
+	return nil
+}
+
+func setKeepWarm(args []string) error {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, configUsage)
+		return fmt.Errorf("usage: tse config keep-warm on|off|none")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if err := cfg.SetKeepWarm(args[0]); err != nil {
+		return err
+	}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+
+	switch cfg.KeepWarm {
+	case "on":
+		fmt.Printf("%s Deploy keeps the Lambda warm with a ping every 5 minutes\n", ui.Checkmark())
+	case "off":
+		fmt.Printf("%s Deploy removes the warm-keeper ping\n", ui.Checkmark())
+	default:
+		fmt.Printf("%s Deploy leaves the warm-keeper ping as it is, unless --keep-warm is given\n", ui.Checkmark())
+		return nil
+	}
+	fmt.Println(ui.Subtle("Run 'tse deploy' to apply it."))
+	return nil
+}
+
+func runCustomRegions(args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(args) == 0 || args[0] == "list":
+		if len(cfg.CustomRegions) == 0 {
+			fmt.Println(ui.Subtle("No custom regions."))
+		} else {
+			table := ui.NewTable("Name", "AWS Region", "Note")
+			for _, name := range slices.Sorted(maps.Keys(cfg.CustomRegions)) {
+				note := "added"
+				if code, err := regions.GetAWSRegion(name); err == nil && code != cfg.CustomRegions[name] {
+					note = fmt.Sprintf("remaps %s", code)
+				}
+				table.AddRow(name, cfg.CustomRegions[name], note)
+			}
+			fmt.Println(table.Render())
+		}
+		if len(cfg.OnlyRegions) > 0 {
+			fmt.Printf("%s %s\n", ui.Label("Only:"), strings.Join(cfg.OnlyRegions, ", "))
+		}
+		return nil
+	case args[0] == "set" && len(args) == 3:
+		if err := cfg.SetCustomRegion(args[1], args[2]); err != nil {
+			return err
+		}
+		fmt.Printf("%s %s → %s\n", ui.Checkmark(), ui.Highlight(strings.ToLower(args[1])), args[2])
+	case args[0] == "delete" && len(args) == 2:
+		if err := cfg.DeleteCustomRegion(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("%s Deleted custom region %s\n", ui.Checkmark(), ui.Highlight(args[1]))
+	case args[0] == "only" && len(args) == 2:
+		var names []string
+		if args[1] != "all" {
+			for _, name := range strings.Split(args[1], ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+		if err := cfg.SetOnlyRegions(names); err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			fmt.Printf("%s tse uses every region\n", ui.Checkmark())
+		} else {
+			fmt.Printf("%s tse uses only %s\n", ui.Checkmark(), strings.Join(names, ", "))
+		}
+	default:
+		fmt.Fprint(os.Stderr, configUsage)
+		return fmt.Errorf("usage: tse config region [list | set <name> <aws-region> | delete <name> | only <regions>|all]")
+	}
+
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	fmt.Println(ui.Subtle("Run 'tse deploy' so the Lambda accepts the same regions."))
+	return nil
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/anoldguy/tse/shared/regions"
+)
+
+// Ways to pick one region from a group of several
+const (
+	ChooserLatency    = "latency"    // The region whose endpoint answers fastest
+	ChooserPreference = "preference" // The first region listed
+)
+
+// Choosers lists the valid RegionChooser values
+var Choosers = []string{ChooserLatency, ChooserPreference}
+
+// Chooser returns how to pick a region from a group, latency unless configured
+func (c *Config) Chooser() string {
+	if c.RegionChooser == "" {
+		return ChooserLatency
+	}
+	return c.RegionChooser
+}
+
+// SetChooser sets how regions are picked from groups
+func (c *Config) SetChooser(chooser string) error {
+	if !slices.Contains(Choosers, chooser) {
+		return fmt.Errorf("unknown chooser %q (valid: %s)", chooser, strings.Join(Choosers, ", "))
+	}
+	c.RegionChooser = chooser
+	return nil
+}
+
+// RegionGroup returns the regions a name stands for when it isn't a region
+// itself: a user-defined alias first, then a built-in group
+func (c *Config) RegionGroup(name string) ([]string, bool) {
+	if members, ok := c.RegionAliases[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return slices.Clone(members), true
+	}
+	return regions.Group(name)
+}
+
+// SetRegionAlias defines name as an alias for members, in order of preference.
+// Members may be given by any name regions.Resolve accepts; they're stored as
+// friendly names. A region's own name can't be an alias.
+func (c *Config) SetRegionAlias(name string, members []string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return fmt.Errorf("alias name required")
+	}
+	if _, err := regions.Resolve(name); err == nil {
+		return fmt.Errorf("%q is already a region name", name)
+	}
+	if len(members) == 0 {
+		return fmt.Errorf("alias %s needs at least one region", name)
+	}
+
+	resolved := make([]string, 0, len(members))
+	for _, member := range members {
+		region, err := regions.Resolve(member)
+		if err != nil {
+			return fmt.Errorf("alias %s: %w", name, err)
+		}
+		if !slices.Contains(resolved, region) {
+			resolved = append(resolved, region)
+		}
+	}
+
+	if c.RegionAliases == nil {
+		c.RegionAliases = make(map[string][]string)
+	}
+	c.RegionAliases[name] = resolved
+	return nil
+}
+
+// DeleteRegionAlias removes a user-defined alias
+func (c *Config) DeleteRegionAlias(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if _, ok := c.RegionAliases[name]; !ok {
+		return fmt.Errorf("no alias %q", name)
+	}
+	delete(c.RegionAliases, name)
+	return nil
+}
+
+// AliasNames returns the user-defined alias names in sorted order
+func (c *Config) AliasNames() []string {
+	names := make([]string, 0, len(c.RegionAliases))
+	for name := range c.RegionAliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyRegions exports custom regions and the region allowlist as the environment
+// variables regions.FromEnv reads, and deploy passes on to the Lambda. Variables
+// already set in the environment win.
+func (c *Config) ApplyRegions() {
+	if len(c.CustomRegions) > 0 && os.Getenv(regions.EnvCustomRegions) == "" {
+		os.Setenv(regions.EnvCustomRegions, regions.FormatCustomRegions(c.CustomRegions))
+	}
+	if len(c.OnlyRegions) > 0 && os.Getenv(regions.EnvOnlyRegions) == "" {
+		os.Setenv(regions.EnvOnlyRegions, strings.Join(c.OnlyRegions, ","))
+	}
+}
+
+// SetCustomRegion maps name to an AWS region code, adding a region or remapping a
+// built-in one
+func (c *Config) SetCustomRegion(name, awsRegion string) error {
+	custom := maps.Clone(c.CustomRegions)
+	if custom == nil {
+		custom = make(map[string]string)
+	}
+	custom[strings.ToLower(strings.TrimSpace(name))] = awsRegion
+
+	if err := regions.Validate(custom, c.OnlyRegions); err != nil {
+		return err
+	}
+	c.CustomRegions = custom
+	return nil
+}
+
+// DeleteCustomRegion removes a custom region
+func (c *Config) DeleteCustomRegion(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if _, ok := c.CustomRegions[name]; !ok {
+		return fmt.Errorf("no custom region %q", name)
+	}
+	if slices.Contains(c.OnlyRegions, name) {
+		return fmt.Errorf("%s is in only_regions; change that list first", name)
+	}
+	delete(c.CustomRegions, name)
+	return nil
+}
+
+// SetOnlyRegions limits tse to the given regions; an empty list allows all
+func (c *Config) SetOnlyRegions(names []string) error {
+	if err := regions.Validate(c.CustomRegions, names); err != nil {
+		return err
+	}
+	c.OnlyRegions = names
+	return nil
+}
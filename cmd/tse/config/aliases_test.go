@@ -0,0 +1,107 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRegionAliases(t *testing.T) {
+	cfg := &Config{}
+
+	if err := cfg.SetRegionAlias("Home", []string{"Ohio", "francfort", "ohio"}); err != nil {
+		t.Fatalf("SetRegionAlias(): %v", err)
+	}
+	if got, ok := cfg.RegionGroup("home"); !ok || !reflect.DeepEqual(got, []string{"ohio", "frankfurt"}) {
+		t.Errorf("RegionGroup(home) = %v, %v; want [ohio frankfurt]", got, ok)
+	}
+
+	// Built-in groups, unless overridden
+	if got, ok := cfg.RegionGroup("eu"); !ok || got[0] != "frankfurt" {
+		t.Errorf("RegionGroup(eu) = %v, %v; want the built-in group", got, ok)
+	}
+	if err := cfg.SetRegionAlias("eu", []string{"paris"}); err != nil {
+		t.Fatalf("SetRegionAlias(eu): %v", err)
+	}
+	if got, _ := cfg.RegionGroup("eu"); !reflect.DeepEqual(got, []string{"paris"}) {
+		t.Errorf("RegionGroup(eu) = %v, want the alias [paris]", got)
+	}
+
+	for name, members := range map[string][]string{
+		"ohio":  {"virginia"},         // Shadows a region
+		"empty": nil,                  // No regions
+		"bad":   {"ohio", "atlantis"}, // Unknown region
+		"":      {"ohio"},
+	} {
+		if err := cfg.SetRegionAlias(name, members); err == nil {
+			t.Errorf("SetRegionAlias(%q, %v) succeeded", name, members)
+		}
+	}
+
+	if err := cfg.DeleteRegionAlias("eu"); err != nil {
+		t.Fatalf("DeleteRegionAlias(): %v", err)
+	}
+	if err := cfg.DeleteRegionAlias("eu"); err == nil {
+		t.Error("DeleteRegionAlias of a missing alias succeeded")
+	}
+	if got := cfg.AliasNames(); !reflect.DeepEqual(got, []string{"home"}) {
+		t.Errorf("AliasNames() = %v, want [home]", got)
+	}
+}
+
+func TestChooser(t *testing.T) {
+	cfg := &Config{}
+	if got := cfg.Chooser(); got != ChooserLatency {
+		t.Errorf("default Chooser() = %q, want %q", got, ChooserLatency)
+	}
+	if err := cfg.SetChooser(ChooserPreference); err != nil || cfg.Chooser() != ChooserPreference {
+		t.Errorf("SetChooser(preference) = %v, Chooser() = %q", err, cfg.Chooser())
+	}
+	if err := cfg.SetChooser("random"); err == nil {
+		t.Error("SetChooser(random) succeeded")
+	}
+}
+
+func TestCustomRegions(t *testing.T) {
+	cfg := &Config{}
+
+	if err := cfg.SetCustomRegion("Riyadh", "me-west-1"); err != nil {
+		t.Fatalf("SetCustomRegion(): %v", err)
+	}
+	if err := cfg.SetCustomRegion("milan", "frankfurt"); err == nil {
+		t.Error("SetCustomRegion with a bad code succeeded")
+	}
+	if err := cfg.SetCustomRegion("jeddah", "me-west-1"); err == nil {
+		t.Error("SetCustomRegion with riyadh's code succeeded")
+	}
+	if !reflect.DeepEqual(cfg.CustomRegions, map[string]string{"riyadh": "me-west-1"}) {
+		t.Errorf("CustomRegions = %v, want only riyadh", cfg.CustomRegions)
+	}
+
+	if err := cfg.SetOnlyRegions([]string{"ohio", "riyadh"}); err != nil {
+		t.Fatalf("SetOnlyRegions(): %v", err)
+	}
+	if err := cfg.SetOnlyRegions([]string{"atlantis"}); err == nil {
+		t.Error("SetOnlyRegions(atlantis) succeeded")
+	}
+	if err := cfg.DeleteCustomRegion("riyadh"); err == nil {
+		t.Error("DeleteCustomRegion of a region in only_regions succeeded")
+	}
+
+	t.Setenv("TSE_CUSTOM_REGIONS", "")
+	t.Setenv("TSE_ONLY_REGIONS", "tokyo")
+	cfg.ApplyRegions()
+	if got := os.Getenv("TSE_CUSTOM_REGIONS"); got != "riyadh=me-west-1" {
+		t.Errorf("TSE_CUSTOM_REGIONS = %q, want riyadh=me-west-1", got)
+	}
+	if got := os.Getenv("TSE_ONLY_REGIONS"); got != "tokyo" {
+		t.Errorf("TSE_ONLY_REGIONS = %q, want the environment's tokyo to win", got)
+	}
+
+	if err := cfg.SetOnlyRegions(nil); err != nil {
+		t.Fatalf("SetOnlyRegions(nil): %v", err)
+	}
+	if err := cfg.DeleteCustomRegion("riyadh"); err != nil || len(cfg.CustomRegions) != 0 {
+		t.Errorf("DeleteCustomRegion() = %v, CustomRegions = %v", err, cfg.CustomRegions)
+	}
+}
@@ -0,0 +1,232 @@
+// Package config manages named TSE profiles stored on disk.
+//
+// A profile bundles the settings that differ between tailnets / AWS accounts
+// (Lambda URL, auth token, AWS profile, tailnet) so switching between them is
+// `tse --profile family ...` instead of re-exporting environment variables.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// EnvConfigPath overrides the config file location
+	EnvConfigPath = "TSE_CONFIG"
+
+	// EnvProfile selects a profile when --profile isn't given
+	EnvProfile = "TSE_PROFILE"
+
+	// EnvTailnet carries the active profile's tailnet to commands that take --tailnet
+	EnvTailnet = "TSE_TAILNET"
+
+	// EnvNamePrefix carries the active profile's resource name prefix to the
+	// infrastructure commands (matches infrastructure.EnvNamePrefix)
+	EnvNamePrefix = "TSE_NAME_PREFIX"
+)
+
+// Profile holds the per-tailnet / per-account settings for TSE
+type Profile struct {
+	LambdaURL  string `json:"lambda_url,omitempty"`
+	AuthToken  string `json:"auth_token,omitempty"`
+	AWSProfile string `json:"aws_profile,omitempty"`
+	Tailnet    string `json:"tailnet,omitempty"`
+	NamePrefix string `json:"name_prefix,omitempty"` // Custom resource name prefix the deployment uses
+}
+
+// Config is the on-disk configuration file
+type Config struct {
+	DefaultProfile string              `json:"default_profile,omitempty"`
+	Profiles       map[string]*Profile `json:"profiles"`
+	Encryption     *Encryption         `json:"encryption,omitempty"`
+
+	// RegionAliases are user-defined region groups, each a name for one or more
+	// regions in order of preference; they override built-in groups of the same name
+	RegionAliases map[string][]string `json:"region_aliases,omitempty"`
+	RegionChooser string              `json:"region_chooser,omitempty"` // How to pick from a group; see Chooser
+
+	// CustomRegions adds regions or remaps built-in ones (name → AWS region code);
+	// OnlyRegions, if set, limits tse to those regions. See ApplyRegions.
+	CustomRegions map[string]string `json:"custom_regions,omitempty"`
+	OnlyRegions   []string          `json:"only_regions,omitempty"`
+
+	// DNS is the resolver new exit nodes use unless 'start --dns' says otherwise;
+	// see shared/dns for the accepted values
+	DNS string `json:"dns,omitempty"`
+
+	// KeepWarm is "on" or "off": whether 'tse deploy' keeps the Lambda warm,
+	// unless --keep-warm says otherwise. Empty leaves the deployment as it is.
+	KeepWarm string `json:"keep_warm,omitempty"`
+
+	key *[32]byte // Cached encryption key, loaded on first use
+}
+
+// Path returns the config file location: $TSE_CONFIG, then
+// $XDG_CONFIG_HOME/tse/config.json, then ~/.config/tse/config.json
+func Path() (string, error) {
+	if path := os.Getenv(EnvConfigPath); path != "" {
+		return path, nil
+	}
+
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "tse", "config.json"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "tse", "config.json"), nil
+}
+
+// Load reads the config file. A missing file yields an empty config.
+func Load() (*Config, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{Profiles: make(map[string]*Profile)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]*Profile)
+	}
+
+	return cfg, nil
+}
+
+// Save writes the config file with owner-only permissions (it contains auth tokens)
+func (c *Config) Save() error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write config %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Names returns the profile names in sorted order
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve picks the profile to use. An explicit name (from --profile or TSE_PROFILE)
+// must exist; otherwise the default profile is used if one is set. Returns an empty
+// name and nil profile when there's nothing to apply. The returned profile is a copy
+// with any encrypted secrets decrypted.
+func (c *Config) Resolve(explicit string) (string, *Profile, error) {
+	if explicit != "" {
+		profile, ok := c.Profiles[explicit]
+		if !ok {
+			return "", nil, fmt.Errorf("profile %q not found (available: %s)", explicit, c.namesOrNone())
+		}
+		plain, err := c.decrypted(profile)
+		if err != nil {
+			return "", nil, err
+		}
+		return explicit, plain, nil
+	}
+
+	if c.DefaultProfile == "" {
+		return "", nil, nil
+	}
+
+	profile, ok := c.Profiles[c.DefaultProfile]
+	if !ok {
+		return "", nil, fmt.Errorf("default profile %q not found (available: %s)", c.DefaultProfile, c.namesOrNone())
+	}
+	plain, err := c.decrypted(profile)
+	if err != nil {
+		return "", nil, err
+	}
+	return c.DefaultProfile, plain, nil
+}
+
+func (c *Config) namesOrNone() string {
+	if len(c.Profiles) == 0 {
+		return "none"
+	}
+	return strings.Join(c.Names(), ", ")
+}
+
+// Apply exports the profile's settings as the environment variables the rest of
+// the CLI reads. With override false, variables already set in the environment win,
+// which is how the default profile behaves; an explicitly selected profile overrides.
+func (p *Profile) Apply(override bool) {
+	set := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if !override && os.Getenv(key) != "" {
+			return
+		}
+		os.Setenv(key, value)
+	}
+
+	set("TSE_LAMBDA_URL", p.LambdaURL)
+	set("TSE_AUTH_TOKEN", p.AuthToken)
+	set("AWS_PROFILE", p.AWSProfile)
+	set(EnvTailnet, p.Tailnet)
+	set(EnvNamePrefix, p.NamePrefix)
+}
+
+// ExtractProfileFlag removes a global --profile flag ("--profile name" or
+// "--profile=name") from args, returning the profile name and remaining args
+func ExtractProfileFlag(args []string) (string, []string, error) {
+	var profile string
+	rest := make([]string, 0, len(args))
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--profile" || arg == "-profile":
+			if i+1 >= len(args) {
+				return "", nil, fmt.Errorf("--profile requires a profile name")
+			}
+			profile = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--profile="):
+			profile = strings.TrimPrefix(arg, "--profile=")
+		case strings.HasPrefix(arg, "-profile="):
+			profile = strings.TrimPrefix(arg, "-profile=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	return profile, rest, nil
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExtractProfileFlag(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantProfile string
+		wantRest    []string
+		expectError bool
+	}{
+		{
+			name:        "no profile flag",
+			args:        []string{"ohio", "start"},
+			wantProfile: "",
+			wantRest:    []string{"ohio", "start"},
+		},
+		{
+			name:        "leading flag with separate value",
+			args:        []string{"--profile", "family", "ohio", "start"},
+			wantProfile: "family",
+			wantRest:    []string{"ohio", "start"},
+		},
+		{
+			name:        "trailing flag with equals",
+			args:        []string{"ohio", "start", "--profile=family"},
+			wantProfile: "family",
+			wantRest:    []string{"ohio", "start"},
+		},
+		{
+			name:        "other flags preserved",
+			args:        []string{"setup", "--tailnet", "example.com", "-profile", "work"},
+			wantProfile: "work",
+			wantRest:    []string{"setup", "--tailnet", "example.com"},
+		},
+		{
+			name:        "missing value",
+			args:        []string{"ohio", "start", "--profile"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, rest, err := ExtractProfileFlag(tt.args)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if profile != tt.wantProfile {
+				t.Errorf("profile = %q, want %q", profile, tt.wantProfile)
+			}
+			if !reflect.DeepEqual(rest, tt.wantRest) {
+				t.Errorf("rest = %v, want %v", rest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	cfg := &Config{
+		DefaultProfile: "personal",
+		Profiles: map[string]*Profile{
+			"personal": {LambdaURL: "https://personal.example"},
+			"family":   {LambdaURL: "https://family.example"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		cfg         *Config
+		explicit    string
+		wantName    string
+		expectError bool
+	}{
+		{name: "explicit profile", cfg: cfg, explicit: "family", wantName: "family"},
+		{name: "falls back to default", cfg: cfg, explicit: "", wantName: "personal"},
+		{name: "unknown explicit profile", cfg: cfg, explicit: "work", expectError: true},
+		{name: "no default set", cfg: &Config{Profiles: cfg.Profiles}, explicit: "", wantName: ""},
+		{name: "dangling default", cfg: &Config{DefaultProfile: "gone", Profiles: cfg.Profiles}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, profile, err := tt.cfg.Resolve(tt.explicit)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if name != tt.wantName {
+				t.Errorf("name = %q, want %q", name, tt.wantName)
+			}
+			if (profile == nil) != (tt.wantName == "") {
+				t.Errorf("profile = %v, want profile present: %v", profile, tt.wantName != "")
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Setenv("TSE_LAMBDA_URL", "https://from-env.example")
+	t.Setenv("TSE_AUTH_TOKEN", "")
+	t.Setenv(EnvTailnet, "")
+	t.Setenv(EnvNamePrefix, "")
+
+	profile := &Profile{LambdaURL: "https://from-profile.example", AuthToken: "profile-token", Tailnet: "family.example", NamePrefix: "acme-vpn"}
+
+	// Default profile: environment wins
+	profile.Apply(false)
+	if got := os.Getenv("TSE_LAMBDA_URL"); got != "https://from-env.example" {
+		t.Errorf("TSE_LAMBDA_URL = %q, want env value to win", got)
+	}
+	if got := os.Getenv("TSE_AUTH_TOKEN"); got != "profile-token" {
+		t.Errorf("TSE_AUTH_TOKEN = %q, want profile value to fill the gap", got)
+	}
+	if got := os.Getenv(EnvTailnet); got != "family.example" {
+		t.Errorf("%s = %q, want profile value", EnvTailnet, got)
+	}
+	if got := os.Getenv(EnvNamePrefix); got != "acme-vpn" {
+		t.Errorf("%s = %q, want profile value", EnvNamePrefix, got)
+	}
+
+	// Explicit profile: profile wins
+	profile.Apply(true)
+	if got := os.Getenv("TSE_LAMBDA_URL"); got != "https://from-profile.example" {
+		t.Errorf("TSE_LAMBDA_URL = %q, want profile value to override", got)
+	}
+}
+
+func TestLoadSaveRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "config.json")
+	t.Setenv(EnvConfigPath, path)
+
+	// Missing file loads as empty
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() on missing file: %v", err)
+	}
+	if len(cfg.Profiles) != 0 {
+		t.Fatalf("expected no profiles, got %v", cfg.Profiles)
+	}
+
+	cfg.Profiles["family"] = &Profile{LambdaURL: "https://family.example", AWSProfile: "family-aws"}
+	cfg.DefaultProfile = "family"
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save(): %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat config: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("config permissions = %o, want 600", perm)
+	}
+
+	loaded, err := Load()
+	if err != nil {
+		t.Fatalf("Load(): %v", err)
+	}
+	if loaded.DefaultProfile != "family" {
+		t.Errorf("DefaultProfile = %q, want family", loaded.DefaultProfile)
+	}
+	if !reflect.DeepEqual(loaded.Profiles["family"], cfg.Profiles["family"]) {
+		t.Errorf("profile = %+v, want %+v", loaded.Profiles["family"], cfg.Profiles["family"])
+	}
+}
@@ -0,0 +1,21 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/anoldguy/tse/shared/dns"
+)
+
+// SetDNS sets the resolver new exit nodes use by default; dns.None (or "")
+// goes back to the VPC's
+func (c *Config) SetDNS(spec string) error {
+	if _, err := dns.Parse(spec); err != nil {
+		return err
+	}
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == dns.None {
+		spec = ""
+	}
+	c.DNS = spec
+	return nil
+}
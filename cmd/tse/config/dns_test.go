@@ -0,0 +1,16 @@
+package config
+
+import "testing"
+
+func TestSetDNS(t *testing.T) {
+	cfg := &Config{}
+	if err := cfg.SetDNS(" NextDNS:abc123 "); err != nil || cfg.DNS != "nextdns:abc123" {
+		t.Errorf("SetDNS(nextdns) = %v, DNS = %q", err, cfg.DNS)
+	}
+	if err := cfg.SetDNS("pihole.local"); err == nil || cfg.DNS != "nextdns:abc123" {
+		t.Errorf("SetDNS(pihole.local) = %v, DNS = %q; want an error and no change", err, cfg.DNS)
+	}
+	if err := cfg.SetDNS("none"); err != nil || cfg.DNS != "" {
+		t.Errorf("SetDNS(none) = %v, DNS = %q; want it cleared", err, cfg.DNS)
+	}
+}
@@ -0,0 +1,21 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetKeepWarm sets whether deploy keeps the Lambda warm: on, off, or none to
+// leave it to each deploy's --keep-warm
+func (c *Config) SetKeepWarm(value string) error {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "on", "off":
+		c.KeepWarm = value
+	case "none":
+		c.KeepWarm = ""
+	default:
+		return fmt.Errorf("keep-warm must be on, off or none, got %q", value)
+	}
+	return nil
+}
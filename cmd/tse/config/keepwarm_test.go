@@ -0,0 +1,16 @@
+package config
+
+import "testing"
+
+func TestSetKeepWarm(t *testing.T) {
+	cfg := &Config{}
+	if err := cfg.SetKeepWarm(" ON "); err != nil || cfg.KeepWarm != "on" {
+		t.Errorf("SetKeepWarm(on) = %v, KeepWarm = %q", err, cfg.KeepWarm)
+	}
+	if err := cfg.SetKeepWarm("none"); err != nil || cfg.KeepWarm != "" {
+		t.Errorf("SetKeepWarm(none) = %v, KeepWarm = %q", err, cfg.KeepWarm)
+	}
+	if err := cfg.SetKeepWarm("sometimes"); err == nil {
+		t.Error("SetKeepWarm(sometimes) succeeded")
+	}
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// EnvPassphrase supplies the passphrase for passphrase-encrypted configs
+	EnvPassphrase = "TSE_CONFIG_PASSPHRASE"
+
+	// Key sources for Encryption.KeySource
+	KeySourcePassphrase = "passphrase" // Key derived from $TSE_CONFIG_PASSPHRASE with scrypt
+	KeySourceKeyring    = "keyring"    // Random key stored in the OS keyring
+
+	// encryptedPrefix marks an encrypted value: "enc:v1:" + base64(nonce || box)
+	encryptedPrefix = "enc:v1:"
+
+	keyringService = "tse"
+	keyringUser    = "config-key"
+)
+
+// Encryption describes how the sensitive values in the config file are protected
+type Encryption struct {
+	KeySource string `json:"key_source"`
+	Salt      string `json:"salt,omitempty"` // base64 scrypt salt (passphrase only)
+}
+
+// IsEncrypted reports whether a stored value is encrypted
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// secrets returns pointers to the profile fields that are encrypted at rest
+func (p *Profile) secrets() []*string {
+	return []*string{&p.AuthToken}
+}
+
+// Encrypt turns on encryption using the given key source and encrypts every
+// plaintext secret in the config. For the keyring source a new random key is
+// stored in the OS keyring; for the passphrase source $TSE_CONFIG_PASSPHRASE
+// must be set. The caller saves the config afterwards.
+func (c *Config) Encrypt(keySource string) error {
+	if c.Encryption != nil {
+		return fmt.Errorf("config is already encrypted (key source: %s)", c.Encryption.KeySource)
+	}
+
+	enc := &Encryption{KeySource: keySource}
+	var key *[32]byte
+
+	switch keySource {
+	case KeySourcePassphrase:
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return fmt.Errorf("failed to generate salt: %w", err)
+		}
+		enc.Salt = base64.StdEncoding.EncodeToString(salt)
+
+		var err error
+		key, err = passphraseKey(salt)
+		if err != nil {
+			return err
+		}
+
+	case KeySourceKeyring:
+		key = new([32]byte)
+		if _, err := rand.Read(key[:]); err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+		if err := keyring.Set(keyringService, keyringUser, base64.StdEncoding.EncodeToString(key[:])); err != nil {
+			return fmt.Errorf("failed to store key in OS keyring: %w\n\nUse --passphrase instead if no keyring is available", err)
+		}
+
+	default:
+		return fmt.Errorf("unknown key source %q (use %s or %s)", keySource, KeySourcePassphrase, KeySourceKeyring)
+	}
+
+	c.Encryption = enc
+	c.key = key
+
+	for _, profile := range c.Profiles {
+		for _, field := range profile.secrets() {
+			sealed, err := c.Seal(*field)
+			if err != nil {
+				return err
+			}
+			*field = sealed
+		}
+	}
+
+	return nil
+}
+
+// Seal encrypts value if the config uses encryption; otherwise it's returned unchanged.
+// Empty and already-encrypted values are left alone.
+func (c *Config) Seal(value string) (string, error) {
+	if c.Encryption == nil || value == "" || IsEncrypted(value) {
+		return value, nil
+	}
+
+	key, err := c.encryptionKey()
+	if err != nil {
+		return "", err
+	}
+
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	box := secretbox.Seal(nonce[:], []byte(value), &nonce, key)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(box), nil
+}
+
+// Open decrypts an encrypted value. Plaintext values are returned unchanged.
+func (c *Config) Open(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if c.Encryption == nil {
+		return "", fmt.Errorf("config contains encrypted values but no encryption settings")
+	}
+
+	box, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil || len(box) < 24+secretbox.Overhead {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+
+	key, err := c.encryptionKey()
+	if err != nil {
+		return "", err
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], box[:24])
+	plaintext, ok := secretbox.Open(nil, box[24:], &nonce, key)
+	if !ok {
+		if c.Encryption.KeySource == KeySourcePassphrase {
+			return "", fmt.Errorf("failed to decrypt config: wrong %s?", EnvPassphrase)
+		}
+		return "", fmt.Errorf("failed to decrypt config: keyring key doesn't match")
+	}
+
+	return string(plaintext), nil
+}
+
+// decrypted returns a copy of profile with its secrets decrypted
+func (c *Config) decrypted(profile *Profile) (*Profile, error) {
+	plain := *profile
+	for _, field := range plain.secrets() {
+		value, err := c.Open(*field)
+		if err != nil {
+			return nil, err
+		}
+		*field = value
+	}
+	return &plain, nil
+}
+
+// encryptionKey loads (and caches) the key for the configured key source
+func (c *Config) encryptionKey() (*[32]byte, error) {
+	if c.key != nil {
+		return c.key, nil
+	}
+
+	switch c.Encryption.KeySource {
+	case KeySourcePassphrase:
+		salt, err := base64.StdEncoding.DecodeString(c.Encryption.Salt)
+		if err != nil || len(salt) == 0 {
+			return nil, fmt.Errorf("config has an invalid encryption salt")
+		}
+		key, err := passphraseKey(salt)
+		if err != nil {
+			return nil, err
+		}
+		c.key = key
+
+	case KeySourceKeyring:
+		encoded, err := keyring.Get(keyringService, keyringUser)
+		if errors.Is(err, keyring.ErrNotFound) {
+			return nil, fmt.Errorf("config encryption key not found in OS keyring")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key from OS keyring: %w", err)
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("OS keyring holds an invalid config key")
+		}
+		c.key = new([32]byte)
+		copy(c.key[:], raw)
+
+	default:
+		return nil, fmt.Errorf("unknown key source %q in config", c.Encryption.KeySource)
+	}
+
+	return c.key, nil
+}
+
+// passphraseKey derives a 32-byte key from $TSE_CONFIG_PASSPHRASE
+func passphraseKey(salt []byte) (*[32]byte, error) {
+	passphrase := os.Getenv(EnvPassphrase)
+	if passphrase == "" {
+		return nil, fmt.Errorf("%s environment variable not set (the config is passphrase-encrypted)", EnvPassphrase)
+	}
+
+	derived, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	key := new([32]byte)
+	copy(key[:], derived)
+	return key, nil
+}
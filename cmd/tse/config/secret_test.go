@@ -0,0 +1,124 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestEncryptPassphrase(t *testing.T) {
+	t.Setenv(EnvConfigPath, filepath.Join(t.TempDir(), "config.json"))
+	t.Setenv(EnvPassphrase, "correct horse")
+
+	cfg := &Config{
+		DefaultProfile: "family",
+		Profiles: map[string]*Profile{
+			"family": {LambdaURL: "https://family.example", AuthToken: "family-token"},
+			"empty":  {LambdaURL: "https://empty.example"},
+		},
+	}
+
+	if err := cfg.Encrypt(KeySourcePassphrase); err != nil {
+		t.Fatalf("Encrypt(): %v", err)
+	}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save(): %v", err)
+	}
+
+	stored := cfg.Profiles["family"].AuthToken
+	if !IsEncrypted(stored) || strings.Contains(stored, "family-token") {
+		t.Errorf("auth token stored as %q, want encrypted", stored)
+	}
+	if cfg.Profiles["empty"].AuthToken != "" {
+		t.Errorf("empty auth token was encrypted")
+	}
+	if cfg.Profiles["family"].LambdaURL != "https://family.example" {
+		t.Errorf("non-secret field was modified")
+	}
+
+	// A fresh load decrypts on demand with the same passphrase
+	loaded, err := Load()
+	if err != nil {
+		t.Fatalf("Load(): %v", err)
+	}
+	_, profile, err := loaded.Resolve("")
+	if err != nil {
+		t.Fatalf("Resolve(): %v", err)
+	}
+	if profile.AuthToken != "family-token" {
+		t.Errorf("decrypted auth token = %q, want family-token", profile.AuthToken)
+	}
+	if !IsEncrypted(loaded.Profiles["family"].AuthToken) {
+		t.Errorf("Resolve() decrypted the stored profile in place")
+	}
+
+	// Wrong passphrase fails loudly
+	t.Setenv(EnvPassphrase, "wrong")
+	wrong, err := Load()
+	if err != nil {
+		t.Fatalf("Load(): %v", err)
+	}
+	if _, _, err := wrong.Resolve("family"); err == nil {
+		t.Errorf("expected error decrypting with the wrong passphrase")
+	}
+
+	// Encrypting twice is refused
+	if err := cfg.Encrypt(KeySourcePassphrase); err == nil {
+		t.Errorf("expected error encrypting an already-encrypted config")
+	}
+}
+
+func TestEncryptPassphraseRequired(t *testing.T) {
+	t.Setenv(EnvPassphrase, "")
+
+	cfg := &Config{Profiles: map[string]*Profile{"a": {AuthToken: "token"}}}
+	if err := cfg.Encrypt(KeySourcePassphrase); err == nil {
+		t.Fatalf("expected error without %s", EnvPassphrase)
+	}
+	if cfg.Encryption != nil || cfg.Profiles["a"].AuthToken != "token" {
+		t.Errorf("failed Encrypt() modified the config")
+	}
+}
+
+func TestEncryptKeyring(t *testing.T) {
+	keyring.MockInit()
+
+	cfg := &Config{Profiles: map[string]*Profile{"a": {AuthToken: "token"}}}
+	if err := cfg.Encrypt(KeySourceKeyring); err != nil {
+		t.Fatalf("Encrypt(): %v", err)
+	}
+
+	// Drop the cached key so Open has to fetch it from the keyring
+	cfg.key = nil
+	got, err := cfg.Open(cfg.Profiles["a"].AuthToken)
+	if err != nil {
+		t.Fatalf("Open(): %v", err)
+	}
+	if got != "token" {
+		t.Errorf("Open() = %q, want token", got)
+	}
+
+	// New values are sealed with the same key
+	sealed, err := cfg.Seal("new-token")
+	if err != nil {
+		t.Fatalf("Seal(): %v", err)
+	}
+	if !IsEncrypted(sealed) {
+		t.Errorf("Seal() = %q, want encrypted value", sealed)
+	}
+}
+
+func TestSealWithoutEncryption(t *testing.T) {
+	cfg := &Config{Profiles: map[string]*Profile{}}
+
+	got, err := cfg.Seal("plain-token")
+	if err != nil || got != "plain-token" {
+		t.Errorf("Seal() = %q, %v; want plaintext passthrough", got, err)
+	}
+	got, err = cfg.Open("plain-token")
+	if err != nil || got != "plain-token" {
+		t.Errorf("Open() = %q, %v; want plaintext passthrough", got, err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/anoldguy/tse/cmd/tse/clipboard"
+	"github.com/anoldguy/tse/cmd/tse/ui"
+)
+
+// copyItem is a value setup or deploy prints that --copy puts on the clipboard
+type copyItem struct {
+	Name   string // The variable it belongs in, e.g. TSE_AUTH_TOKEN
+	Value  string
+	Secret bool // Only show the end of it when confirming
+}
+
+// copyToClipboard copies items one at a time for --copy, waiting for Enter
+// before each so the previous one can be pasted first, and confirming which
+// value is on the clipboard. It does nothing when nobody is at the keyboard.
+func copyToClipboard(ctx context.Context, items []copyItem) error {
+	if ui.JSONLines() || !ui.IsTerminal(os.Stdin) {
+		fmt.Println(ui.Subtle("Skipping --copy: it needs an interactive terminal"))
+		return nil
+	}
+	if !clipboard.Available() {
+		fmt.Println(ui.Warning(fmt.Sprintf("⚠️  Can't copy: %v", clipboard.ErrUnavailable)))
+		return nil
+	}
+
+	for i, item := range items {
+		if item.Value == "" {
+			continue
+		}
+		fmt.Printf("%s Press Enter to copy %s (%d of %d), or s to skip: ", ui.Info("→"), ui.Highlight(item.Name), i+1, len(items))
+		response, err := readLine(ctx, os.Stdin)
+		if err != nil {
+			return err
+		}
+		if strings.ToLower(strings.TrimSpace(response)) == "s" {
+			continue
+		}
+
+		if err := clipboard.Copy(ctx, item.Value); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", item.Name, err)
+		}
+		shown := item.Value
+		if item.Secret {
+			shown = "ending " + item.Value[max(len(item.Value)-6, 0):]
+		}
+		fmt.Printf("%s Copied %s %s\n", ui.Checkmark(), item.Name, ui.Subtle("("+shown+")"))
+	}
+	return nil
+}
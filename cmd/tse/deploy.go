@@ -2,15 +2,223 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 
+	"github.com/anoldguy/tse/cmd/tse/config"
 	"github.com/anoldguy/tse/cmd/tse/infrastructure"
 	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/telegram"
+	"github.com/anoldguy/tse/shared/types"
 )
 
+const deployUsage = `Usage: tse deploy [flags]
+
+Deploy AWS infrastructure (Lambda, IAM, DynamoDB, etc.)
+
+Only missing resources are created, so deploy is safe to re-run. Use --plan
+to see how the deployed infrastructure differs from what deploy would create
+(missing resources, the IAM policy, Lambda memory/timeout/environment, log
+retention, function URL CORS) without changing anything; it exits non-zero
+if anything has drifted. Use --dry-run to list the AWS calls deploy would
+make, with their parameters, without making them.
+
+Before creating anything, deploy simulates those calls against your AWS
+credentials' IAM policies (iam:SimulatePrincipalPolicy) and stops with the
+list of permissions they lack, rather than failing partway through. If the
+check can't run (the credentials can't simulate policies, say), deploy notes
+it and goes ahead.
+
+After deploying, deploy checks the deployment works end to end: the function
+URL answers a health check with the auth token, and the Lambda's role can
+describe instances in the deployment's region. It waits up to 90 seconds for
+a new deployment's permissions to take effect, and fails with the reason if
+either check doesn't pass.
+
+Deploy then offers to save the function URL and auth token: to the active
+profile in the config file if one is in use, otherwise to ./.env. Use
+--no-write to only print them.
+
+With TSE_TELEGRAM_BOT_TOKEN and TSE_TELEGRAM_CHAT_IDS set, deploy gives them to
+the Lambda and points the bot's webhook at it, so the listed chats can send
+/status, /start <region> and /stop <region|all>.
+
+Flags:
+  --plan              Show drift from the desired configuration and change nothing
+  --dry-run           List the AWS calls deploy would make and change nothing
+  --skip-verify       Don't check the deployment works once it's deployed
+  --skip-preflight    Don't check your AWS permissions before creating anything
+  --no-write          Don't offer to save the URL and token to .env or the profile
+  --copy              Copy the function URL, then the auth token, to the clipboard
+  --baseline <name>   Security baseline for exit nodes (default: $TSE_SECURITY_BASELINE,
+                      or the deployment's current one)
+                        standard  SSH and the "tailscale" key pair for debugging
+                        strict    No SSH or key pair, IMDSv2 required, encrypted EBS,
+                                  outbound limited to web, DNS and Tailscale
+  --alarm-hours <n>   Alarm (via an SNS topic) when an exit node has been running
+                      longer than n hours (default: $TSE_ALARM_HOURS)
+  --alarm-email <a>   Subscribe this address to the alarm topic (default: $TSE_ALARM_EMAIL)
+  --node-cap <GB>     Terminate an exit node once it has sent this much data
+                      (default: $TSE_NODE_CAP_GB; 0 turns the cap off)
+  --monthly-cap <GB>  Terminate every exit node once they've sent this much in total
+                      this calendar month, UTC (default: $TSE_MONTHLY_CAP_GB; 0 turns it off)
+                      Caps are checked every 15 minutes from CloudWatch's NetworkOut
+                      and notify TSE_WEBHOOKS when they terminate a node
+  --max-nodes <n>     Refuse to start an exit node while n already exist across all
+                      regions, paused ones included (default: $TSE_MAX_NODES; 0
+                      turns the cap off)
+  --keep-warm on|off  Ping the Lambda every 5 minutes so commands after a quiet spell
+                      don't wait for a cold start; off removes the ping (default:
+                      $TSE_KEEP_WARM, or 'tse config keep-warm')
+  --orchestration lambda|stepfunctions
+                      How async jobs (tse cleanup, and API starts and stops sent with
+                      "async": true) run: lambda runs each in one Lambda invocation; stepfunctions
+                      creates a Step Functions state machine that runs them step by
+                      step (launch, wait for the node to report ready, notify;
+                      terminate, wait, remove the VPC, retrying), so none has to fit
+                      the Lambda's timeout. Switching back to lambda removes the state
+                      machine (default: $TSE_ORCHESTRATION, or the deployment's current one)
+  --lambda-memory <MB>
+                      The Lambda's memory, 128 to 10240 MB (default: $TSE_LAMBDA_MEMORY_MB,
+                      or 256)
+  --lambda-timeout <s>
+                      The Lambda's timeout, 60 to 300 seconds (default: $TSE_LAMBDA_TIMEOUT,
+                      or 120). Starts that run short of it fail and roll back cleanly;
+                      raise it if starts in new regions report running out of time
+  --build-from-source Compile the Lambda from a repo checkout instead of using the
+                      prebuilt one in release binaries (needs Go; $TSE_BUILD_FROM_SOURCE)
+  --lambda-src <dir>  Compile the Lambda from this directory (implies --build-from-source;
+                      default: $TSE_LAMBDA_SRC, or the lambda directory of the checkout
+                      containing the current directory or the tse binary)
+  --name-prefix <p>   Start every resource name with p instead of tailscale-exits, for
+                      accounts with naming policies (default: $TSE_NAME_PREFIX, or the
+                      profile's). Saved with the URL and token; every later command
+                      needs it to find the deployment
+
+Examples:
+  tse deploy
+  tse deploy --plan
+  tse deploy --dry-run --baseline strict
+  tse deploy --baseline strict
+  tse deploy --alarm-hours 8 --alarm-email you@example.com
+  tse deploy --node-cap 50 --monthly-cap 100
+  tse deploy --max-nodes 3
+  tse deploy --keep-warm on
+  tse deploy --orchestration stepfunctions
+  tse deploy --lambda-timeout 180
+  tse deploy --lambda-src ~/src/tailscale-exits/lambda
+  tse deploy --name-prefix acme-vpn
+  tse deploy --copy
+`
+
 // runDeploy deploys TSE infrastructure to AWS.
-func runDeploy(args []string) error {
+func runDeploy(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("deploy", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, deployUsage)
+	}
+
+	plan := fs.Bool("plan", false, "Show drift from the desired configuration and change nothing")
+	dryRun := fs.Bool("dry-run", false, "List the AWS calls deploy would make and change nothing")
+	skipVerify := fs.Bool("skip-verify", false, "Don't check the deployment works once it's deployed")
+	skipPreflight := fs.Bool("skip-preflight", os.Getenv(infrastructure.EnvSkipPreflight) != "", "Don't check AWS permissions before creating anything")
+	noWrite := fs.Bool("no-write", false, "Don't offer to save the URL and token to .env or the profile")
+	copyOutputs := fs.Bool("copy", false, "Copy the function URL and auth token to the clipboard")
+	baseline := fs.String("baseline", os.Getenv("TSE_SECURITY_BASELINE"), "Security baseline for exit nodes")
+	alarmHours := fs.String("alarm-hours", os.Getenv("TSE_ALARM_HOURS"), "Alarm when a node runs longer than this many hours")
+	alarmEmail := fs.String("alarm-email", os.Getenv("TSE_ALARM_EMAIL"), "Email address for alarm notifications")
+	nodeCap := fs.String("node-cap", os.Getenv(infrastructure.EnvNodeCapGB), "Terminate a node once it has sent this many GB")
+	monthlyCap := fs.String("monthly-cap", os.Getenv(infrastructure.EnvMonthlyCapGB), "Terminate every node once they've sent this many GB this month")
+	maxNodes := fs.String("max-nodes", os.Getenv(infrastructure.EnvMaxNodes), "Refuse to start a node while this many exist across all regions")
+	keepWarm := fs.String("keep-warm", os.Getenv(infrastructure.EnvKeepWarm), "Keep the Lambda warm (on or off)")
+	orchestration := fs.String("orchestration", os.Getenv(infrastructure.EnvOrchestration), "How async jobs run (lambda or stepfunctions)")
+	lambdaMemory := fs.String("lambda-memory", os.Getenv(infrastructure.EnvLambdaMemoryMB), "The Lambda's memory in MB")
+	lambdaTimeout := fs.String("lambda-timeout", os.Getenv(infrastructure.EnvLambdaTimeout), "The Lambda's timeout in seconds")
+	buildFromSource := fs.Bool("build-from-source", os.Getenv("TSE_BUILD_FROM_SOURCE") != "", "Compile the Lambda instead of using the prebuilt one")
+	lambdaSrc := fs.String("lambda-src", os.Getenv("TSE_LAMBDA_SRC"), "Directory to compile the Lambda from")
+	namePrefix := fs.String("name-prefix", os.Getenv(infrastructure.EnvNamePrefix), "Start every resource name with this prefix")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+	if *baseline != "" {
+		*baseline = strings.ToLower(*baseline)
+		if !slices.Contains(types.Baselines, *baseline) {
+			return fmt.Errorf("unknown security baseline %s (valid: %s)", ui.Highlight(*baseline), strings.Join(types.Baselines, ", "))
+		}
+		// The infrastructure package reads deployment options from the environment
+		os.Setenv("TSE_SECURITY_BASELINE", *baseline)
+	}
+	os.Setenv("TSE_ALARM_HOURS", *alarmHours)
+	os.Setenv("TSE_ALARM_EMAIL", *alarmEmail)
+	if *buildFromSource {
+		os.Setenv("TSE_BUILD_FROM_SOURCE", "1")
+	}
+	if *skipPreflight {
+		os.Setenv(infrastructure.EnvSkipPreflight, "1")
+	}
+	os.Setenv("TSE_LAMBDA_SRC", *lambdaSrc)
+	if err := infrastructure.SetNamePrefix(*namePrefix); err != nil {
+		return err
+	}
+	os.Setenv(infrastructure.EnvNamePrefix, *namePrefix)
+	hours, err := infrastructure.AlarmHours()
+	if err != nil {
+		return fmt.Errorf("--alarm-hours must be a whole number of hours, got %s", ui.Highlight(*alarmHours))
+	}
+	if *alarmEmail != "" && hours == 0 {
+		return fmt.Errorf("--alarm-email needs --alarm-hours")
+	}
+	nodeCapGB, err := infrastructure.TransferCapGB(*nodeCap)
+	if err != nil {
+		return fmt.Errorf("--node-cap must be a number of GB, got %s", ui.Highlight(*nodeCap))
+	}
+	monthlyCapGB, err := infrastructure.TransferCapGB(*monthlyCap)
+	if err != nil {
+		return fmt.Errorf("--monthly-cap must be a number of GB, got %s", ui.Highlight(*monthlyCap))
+	}
+	os.Setenv(infrastructure.EnvNodeCapGB, *nodeCap)
+	os.Setenv(infrastructure.EnvMonthlyCapGB, *monthlyCap)
+	nodeLimit, err := infrastructure.MaxNodes(*maxNodes)
+	if err != nil {
+		return fmt.Errorf("--max-nodes must be a whole number of nodes, got %s", ui.Highlight(*maxNodes))
+	}
+	os.Setenv(infrastructure.EnvMaxNodes, *maxNodes)
+	if *keepWarm == "" {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		*keepWarm = cfg.KeepWarm
+	}
+	os.Setenv(infrastructure.EnvKeepWarm, *keepWarm)
+	if _, _, err := infrastructure.KeepWarm(); err != nil {
+		return fmt.Errorf("--keep-warm must be on or off, got %s", ui.Highlight(*keepWarm))
+	}
+	os.Setenv(infrastructure.EnvOrchestration, *orchestration)
+	if _, _, err := infrastructure.Orchestration(); err != nil {
+		return fmt.Errorf("--orchestration must be lambda or stepfunctions, got %s", ui.Highlight(*orchestration))
+	}
+	os.Setenv(infrastructure.EnvLambdaMemoryMB, *lambdaMemory)
+	os.Setenv(infrastructure.EnvLambdaTimeout, *lambdaTimeout)
+	if _, _, err := infrastructure.LambdaSize(); err != nil {
+		return err
+	}
+
+	if *plan {
+		return runDeployPlan(ctx)
+	}
+	if *dryRun {
+		return runDeployDryRun(ctx)
+	}
+
 	// Validate prerequisites
 	if os.Getenv("TAILSCALE_AUTH_KEY") == "" {
 		return fmt.Errorf(`TAILSCALE_AUTH_KEY environment variable not set
@@ -33,8 +241,6 @@ Or create manually:
 Then run 'tse deploy' again.`)
 	}
 
-	ctx := context.Background()
-
 	// Get default AWS region from user's configuration
 	region, err := infrastructure.GetDefaultRegion(ctx)
 	if err != nil {
@@ -42,6 +248,27 @@ Then run 'tse deploy' again.`)
 	}
 
 	fmt.Printf("%s %s\n", ui.Label("Region:"), ui.Highlight(region))
+	if infrastructure.CustomNamePrefix() {
+		fmt.Printf("%s %s\n", ui.Label("Names:"), ui.Highlight(infrastructure.NamePrefix()+"-*"))
+	}
+	if *baseline != "" {
+		fmt.Printf("%s %s\n", ui.Label("Baseline:"), ui.Highlight(*baseline))
+	}
+	if hours > 0 {
+		fmt.Printf("%s %s\n", ui.Label("Alarm:"), ui.Highlight(fmt.Sprintf("exit nodes running over %dh", hours)))
+	}
+	if nodeCapGB > 0 {
+		fmt.Printf("%s %s\n", ui.Label("Node cap:"), ui.Highlight(fmt.Sprintf("%g GB per exit node", nodeCapGB)))
+	}
+	if monthlyCapGB > 0 {
+		fmt.Printf("%s %s\n", ui.Label("Monthly cap:"), ui.Highlight(fmt.Sprintf("%g GB across all exit nodes", monthlyCapGB)))
+	}
+	if nodeLimit > 0 {
+		fmt.Printf("%s %s\n", ui.Label("Max nodes:"), ui.Highlight(fmt.Sprintf("%d across all regions", nodeLimit)))
+	}
+	if os.Getenv(telegram.EnvBotToken) != "" {
+		fmt.Printf("%s %s\n", ui.Label("Telegram:"), ui.Highlight("chats "+os.Getenv(telegram.EnvChatIDs)))
+	}
 	fmt.Println()
 
 	result, err := infrastructure.Setup(ctx, region)
@@ -50,6 +277,9 @@ Then run 'tse deploy' again.`)
 	}
 
 	state := result.State
+	if err := registerTelegramWebhook(ctx, state.FunctionURL, result.AuthToken); err != nil {
+		return err
+	}
 
 	// Build success box content conditionally
 	successContent := []string{"✨ Your TSE infrastructure is ready!", ""}
@@ -84,7 +314,29 @@ Then run 'tse deploy' again.`)
 			fmt.Sprintf("export TSE_LAMBDA_URL=%s", state.FunctionURL),
 			fmt.Sprintf("export TSE_AUTH_TOKEN=%s", result.AuthToken),
 		}
+		profileSet := fmt.Sprintf("tse profile set <name> --lambda-url %s --auth-token %s", state.FunctionURL, result.AuthToken)
+		if infrastructure.CustomNamePrefix() {
+			exportContent = append(exportContent, fmt.Sprintf("export %s=%s", infrastructure.EnvNamePrefix, infrastructure.NamePrefix()))
+			profileSet += " --name-prefix " + infrastructure.NamePrefix()
+		}
+		exportContent = append(exportContent, "", "Or save them as a named profile:", "", profileSet)
 		fmt.Println(ui.HighlightBox(exportTitle, exportContent...))
+		if !*noWrite && result.AuthToken != "" {
+			fmt.Println()
+			if err := offerToSaveDeployOutputs(ctx, state.FunctionURL, result.AuthToken); err != nil {
+				return err
+			}
+		}
+		if *copyOutputs {
+			fmt.Println()
+			err := copyToClipboard(ctx, []copyItem{
+				{Name: "TSE_LAMBDA_URL", Value: state.FunctionURL},
+				{Name: "TSE_AUTH_TOKEN", Value: result.AuthToken, Secret: true},
+			})
+			if err != nil {
+				return err
+			}
+		}
 	} else {
 		// Deployment incomplete - just show auth token
 		fmt.Println(ui.Warning("⚠️  Deployment incomplete - some resources failed to create"))
@@ -95,6 +347,19 @@ Then run 'tse deploy' again.`)
 	}
 	fmt.Println()
 
+	if state.FunctionURL != "" && !*skipVerify {
+		if result.AuthToken == "" {
+			fmt.Println(ui.Subtle("Skipping verification: set TSE_AUTH_TOKEN to the deployment's token to check it end to end"))
+		} else {
+			if err := verifyDeployment(ctx, state.FunctionURL, result.AuthToken, region); err != nil {
+				return err
+			}
+			fmt.Println()
+			fmt.Println(ui.Success("✓ Verified end-to-end: the function URL answers and the Lambda can reach EC2"))
+		}
+		fmt.Println()
+	}
+
 	// Next steps
 	fmt.Println(ui.Subheader("Next steps:"))
 	fmt.Println(ui.Info("  1. Export the variables above"))
@@ -103,3 +368,117 @@ Then run 'tse deploy' again.`)
 
 	return nil
 }
+
+// runDeployDryRun prints the AWS calls deploy would make to complete the
+// deployment and apply its options
+func runDeployDryRun(ctx context.Context) error {
+	region, err := infrastructure.GetDefaultRegion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to determine AWS region: %w", err)
+	}
+
+	var state *infrastructure.InfrastructureState
+	var calls []string
+	err = ui.WithSpinner(fmt.Sprintf("Discovering infrastructure in %s", region), func() error {
+		var err error
+		state, calls, err = infrastructure.DryRun(ctx, region)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("discovery failed: %w", err)
+	}
+	fmt.Println()
+
+	if len(calls) == 0 {
+		fmt.Printf("%s Nothing to do: infrastructure in %s is already deployed\n", ui.Checkmark(), region)
+		return nil
+	}
+
+	fmt.Printf("%s deploy would call, in %s:\n", ui.Info("Dry run:"), region)
+	for _, call := range calls {
+		fmt.Printf("  %s\n", call)
+	}
+	fmt.Println()
+	if state.Lambda == nil && os.Getenv("TAILSCALE_AUTH_KEY") == "" {
+		fmt.Println(ui.Warning("⚠️  TAILSCALE_AUTH_KEY isn't set; deploy needs it to create the Lambda"))
+	}
+	fmt.Println(ui.Subtle("Re-run without --dry-run to make these calls."))
+	return nil
+}
+
+// runDeployPlan prints how the deployed infrastructure has drifted from the
+// desired configuration, returning an error if it has
+func runDeployPlan(ctx context.Context) error {
+	region, err := infrastructure.GetDefaultRegion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to determine AWS region: %w", err)
+	}
+
+	var state *infrastructure.InfrastructureState
+	var drifts []infrastructure.Drift
+	err = ui.WithSpinner(fmt.Sprintf("Comparing infrastructure in %s", region), func() error {
+		var err error
+		state, drifts, err = infrastructure.Plan(ctx, region)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("discovery failed: %w", err)
+	}
+	fmt.Println()
+
+	if !state.Exists() {
+		fmt.Println(ui.Subtle("No TSE infrastructure found"))
+		fmt.Printf("\n%s Run 'tse deploy' to create infrastructure\n", ui.Info("→"))
+		return fmt.Errorf("nothing deployed in %s", region)
+	}
+
+	if len(drifts) == 0 {
+		fmt.Printf("%s No drift: infrastructure in %s matches the desired configuration\n", ui.Checkmark(), region)
+		return nil
+	}
+
+	fmt.Println(ui.Subtle("- deployed   + desired"))
+	fmt.Println()
+	for _, drift := range drifts {
+		if drift.Missing {
+			fmt.Println(ui.Success("+ " + drift.Resource + " (missing)"))
+			continue
+		}
+		fmt.Println(ui.Bold(fmt.Sprintf("~ %s %s", drift.Resource, drift.Field)))
+		for _, line := range drift.Lines {
+			text := fmt.Sprintf("    %c %s", line.Op, line.Text)
+			switch line.Op {
+			case infrastructure.DiffAdd:
+				fmt.Println(ui.Success(text))
+			case infrastructure.DiffRemove:
+				fmt.Println(ui.Error(text))
+			default:
+				fmt.Println(ui.Subtle(text))
+			}
+		}
+	}
+	fmt.Println()
+
+	return fmt.Errorf("%d differences from the desired configuration", len(drifts))
+}
+
+// registerTelegramWebhook points the Telegram bot, if one is configured, at the
+// deployed Lambda
+func registerTelegramWebhook(ctx context.Context, functionURL, authToken string) error {
+	if os.Getenv(telegram.EnvBotToken) == "" || functionURL == "" {
+		return nil
+	}
+	if authToken == "" {
+		fmt.Println(ui.Subtle("Skipping the Telegram webhook: set TSE_AUTH_TOKEN to the deployment's token, which its secret comes from"))
+		fmt.Println()
+		return nil
+	}
+	err := ui.WithSpinner("Registering Telegram webhook", func() error {
+		return infrastructure.RegisterTelegramWebhook(ctx, functionURL, authToken)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register the Telegram webhook: %w", err)
+	}
+	fmt.Println()
+	return nil
+}
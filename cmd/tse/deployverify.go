@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/pkg/client"
+	"github.com/anoldguy/tse/shared/regions"
+)
+
+const (
+	// verifyTimeout bounds how long deploy waits for a new function URL to
+	// answer and the Lambda role's permissions to take effect
+	verifyTimeout = 90 * time.Second
+
+	// verifyRetryEvery is the pause between verification attempts
+	verifyRetryEvery = 3 * time.Second
+)
+
+// verifyDeployment checks a deployment works end to end: the function URL
+// answers a health check with authToken, from a Lambda in region, and the
+// Lambda's role can list instances (ec2:DescribeInstances) there. Fresh
+// deployments take a little while to get there, so both checks are retried
+// until verifyTimeout.
+func verifyDeployment(ctx context.Context, lambdaURL, authToken, region string) error {
+	c, err := client.New(lambdaURL, authToken)
+	if err != nil {
+		return err
+	}
+	c.SetRetryHook(func(r client.Retry) {
+		ui.Emit(ui.Event{Type: ui.EventRequestRetry, Step: r.Method + " " + requestPath(r.Path), Error: r.Reason, Attempt: r.Attempt, DurationMS: r.Delay.Milliseconds()})
+	})
+
+	friendly, err := regions.GetFriendlyName(region)
+	if err != nil {
+		return fmt.Errorf("no region name for %s to check EC2 permissions in: %w", region, err)
+	}
+
+	deadline := time.Now().Add(verifyTimeout)
+	steps := []ui.Step{
+		{Name: "Checking Lambda health", Run: func(status func(string)) error {
+			return untilVerified(ctx, deadline, status, func() error {
+				health, err := c.Health(ctx)
+				if err != nil {
+					return err
+				}
+				if health.Region != "" && health.Region != region {
+					return fmt.Errorf("function URL answers from a Lambda in %s, not %s", health.Region, region)
+				}
+				return nil
+			})
+		}},
+		{Name: fmt.Sprintf("Checking EC2 permissions (DescribeInstances in %s)", friendly), Run: func(status func(string)) error {
+			return untilVerified(ctx, deadline, status, func() error {
+				_, err := c.Instances(ctx, friendly)
+				return err
+			})
+		}},
+	}
+	if err := ui.RunSteps(steps); err != nil {
+		if errors.Is(err, ui.ErrInterrupted) {
+			return err
+		}
+		return fmt.Errorf("deployment verification failed: %w", explainLambdaError(err))
+	}
+	return nil
+}
+
+// untilVerified runs check until it succeeds, fails in a way waiting won't
+// fix, or deadline passes, reporting each wait through status
+func untilVerified(ctx context.Context, deadline time.Time, status func(string), check func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := check()
+		if err == nil || !verifyRetryable(err) || time.Now().Add(verifyRetryEvery).After(deadline) {
+			return err
+		}
+
+		status(fmt.Sprintf("not ready yet (%s), retrying (attempt %d)", verifyReason(err), attempt+1))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(verifyRetryEvery):
+		}
+	}
+}
+
+// verifyRetryable reports whether a failed check is worth repeating on a new
+// deployment: the function URL's public permission and the role's policies
+// take a while to propagate (403s and 5xx), and the URL can refuse connections
+// at first. A 401 means the token is wrong, which waiting won't fix.
+func verifyRetryable(err error) bool {
+	var statusErr *client.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusForbidden ||
+			statusErr.StatusCode == http.StatusTooManyRequests ||
+			statusErr.StatusCode >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// verifyReason is a short description of a failed check for the step's status
+func verifyReason(err error) string {
+	var statusErr *client.StatusError
+	if errors.As(err, &statusErr) {
+		return fmt.Sprintf("HTTP %d", statusErr.StatusCode)
+	}
+	return "no connection"
+}
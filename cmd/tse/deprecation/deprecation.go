@@ -0,0 +1,159 @@
+// Package deprecation keeps renamed environment variables and flags working
+// for a few releases.
+//
+// When a name changes, add an entry to Registry instead of reading both names
+// at every call site. main applies the registry before dispatch: deprecated
+// environment variables are copied to their new names (unless the new name is
+// already set) and deprecated flags are rewritten, each with a one-time
+// warning. `tse doctor` lists whichever deprecations the user is still relying on.
+package deprecation
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+)
+
+// Kinds of deprecated names
+const (
+	KindEnv  = "env"
+	KindFlag = "flag"
+)
+
+// Deprecation describes one renamed environment variable or flag
+type Deprecation struct {
+	Kind    string `json:"kind"`
+	Command string `json:"command,omitempty"` // Flags only: the command the flag belongs to
+	Old     string `json:"old"`               // Env var name, or flag name without dashes
+	New     string `json:"new"`
+	Since   string `json:"since"`  // Release the old name was deprecated in
+	Remove  string `json:"remove"` // Release the old name stops working in
+}
+
+// Registry lists every deprecated name. Remove entries once their Remove
+// release ships, along with any code that still mentions the old name.
+var Registry = []Deprecation{}
+
+// Tracker applies a set of deprecations and remembers which ones were used
+type Tracker struct {
+	deprecations []Deprecation
+	out          io.Writer
+
+	mu     sync.Mutex
+	active []Deprecation
+	warned map[string]bool
+}
+
+// NewTracker returns a Tracker for deprecations that warns to out
+func NewTracker(deprecations []Deprecation, out io.Writer) *Tracker {
+	return &Tracker{
+		deprecations: deprecations,
+		out:          out,
+		warned:       map[string]bool{},
+	}
+}
+
+var std = NewTracker(Registry, os.Stderr)
+
+// ApplyEnv copies deprecated environment variables to their new names
+func ApplyEnv() { std.ApplyEnv() }
+
+// RewriteFlags rewrites deprecated flags for command in args
+func RewriteFlags(command string, args []string) []string { return std.RewriteFlags(command, args) }
+
+// Active returns the deprecations used so far in this process
+func Active() []Deprecation { return std.Active() }
+
+// ApplyEnv copies each deprecated environment variable that is set to its new
+// name. An explicitly set new name wins, but the old one still gets a warning.
+func (t *Tracker) ApplyEnv() {
+	for _, d := range t.deprecations {
+		if d.Kind != KindEnv {
+			continue
+		}
+		value, ok := os.LookupEnv(d.Old)
+		if !ok {
+			continue
+		}
+		if _, ok := os.LookupEnv(d.New); !ok {
+			os.Setenv(d.New, value)
+		}
+		t.use(d)
+	}
+}
+
+// RewriteFlags returns args with deprecated flags for command renamed. Both
+// -name and --name forms are recognized, with or without =value.
+func (t *Tracker) RewriteFlags(command string, args []string) []string {
+	rewritten := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			// Everything after -- is positional
+			return append(rewritten, args[i:]...)
+		}
+		rewritten = append(rewritten, t.rewriteFlag(command, arg))
+	}
+	return rewritten
+}
+
+func (t *Tracker) rewriteFlag(command, arg string) string {
+	if !strings.HasPrefix(arg, "-") {
+		return arg
+	}
+	dashes := "-"
+	if strings.HasPrefix(arg, "--") {
+		dashes = "--"
+	}
+	name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, dashes), "=")
+
+	for _, d := range t.deprecations {
+		if d.Kind != KindFlag || d.Command != command || d.Old != name {
+			continue
+		}
+		t.use(d)
+		if hasValue {
+			return dashes + d.New + "=" + value
+		}
+		return dashes + d.New
+	}
+	return arg
+}
+
+// Active returns the deprecations used so far, in the order they were first seen
+func (t *Tracker) Active() []Deprecation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Deprecation(nil), t.active...)
+}
+
+// use records a deprecation and warns about it the first time
+func (t *Tracker) use(d Deprecation) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := d.Kind + ":" + d.Command + ":" + d.Old
+	if t.warned[key] {
+		return
+	}
+	t.warned[key] = true
+	t.active = append(t.active, d)
+	fmt.Fprintf(t.out, "%s %s\n", ui.Warning("Warning:"), d.Message())
+}
+
+// Names returns the old and new names as a user would type them
+func (d Deprecation) Names() (old, replacement string) {
+	if d.Kind == KindFlag {
+		return fmt.Sprintf("tse %s --%s", d.Command, d.Old), "--" + d.New
+	}
+	return d.Old, d.New
+}
+
+// Message explains the deprecation and what to use instead
+func (d Deprecation) Message() string {
+	old, replacement := d.Names()
+	return fmt.Sprintf("%s is deprecated since %s and will stop working in %s; use %s instead", old, d.Since, d.Remove, replacement)
+}
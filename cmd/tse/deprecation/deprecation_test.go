@@ -0,0 +1,70 @@
+package deprecation
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+var testDeprecations = []Deprecation{
+	{Kind: KindEnv, Old: "TSE_TEST_OLD_URL", New: "TSE_TEST_NEW_URL", Since: "1.1.0", Remove: "2.0.0"},
+	{Kind: KindFlag, Command: "audit", Old: "hours", New: "since", Since: "1.1.0", Remove: "2.0.0"},
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("TSE_TEST_OLD_URL", "https://old.example")
+	t.Setenv("TSE_TEST_NEW_URL", "")
+	os.Unsetenv("TSE_TEST_NEW_URL")
+
+	var out bytes.Buffer
+	tracker := NewTracker(testDeprecations, &out)
+	tracker.ApplyEnv()
+	tracker.ApplyEnv()
+
+	if got := os.Getenv("TSE_TEST_NEW_URL"); got != "https://old.example" {
+		t.Errorf("TSE_TEST_NEW_URL = %q, want the old variable's value", got)
+	}
+	if strings.Count(out.String(), "TSE_TEST_OLD_URL is deprecated") != 1 {
+		t.Errorf("want exactly one warning, got %q", out.String())
+	}
+	if active := tracker.Active(); len(active) != 1 || active[0].Old != "TSE_TEST_OLD_URL" {
+		t.Errorf("Active() = %+v", active)
+	}
+}
+
+func TestApplyEnvNewNameWins(t *testing.T) {
+	t.Setenv("TSE_TEST_OLD_URL", "https://old.example")
+	t.Setenv("TSE_TEST_NEW_URL", "https://new.example")
+
+	var out bytes.Buffer
+	tracker := NewTracker(testDeprecations, &out)
+	tracker.ApplyEnv()
+
+	if got := os.Getenv("TSE_TEST_NEW_URL"); got != "https://new.example" {
+		t.Errorf("TSE_TEST_NEW_URL = %q, an explicit new name should win", got)
+	}
+	if out.Len() == 0 {
+		t.Error("the old name should still be warned about")
+	}
+}
+
+func TestRewriteFlags(t *testing.T) {
+	var out bytes.Buffer
+	tracker := NewTracker(testDeprecations, &out)
+
+	got := tracker.RewriteFlags("audit", []string{"--hours=2h", "-hours", "2h", "--limit", "5", "--", "--hours"})
+	want := []string{"--since=2h", "-since", "2h", "--limit", "5", "--", "--hours"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("RewriteFlags = %q, want %q", got, want)
+	}
+	if strings.Count(out.String(), "tse audit --hours is deprecated") != 1 {
+		t.Errorf("want exactly one warning, got %q", out.String())
+	}
+
+	// Other commands' flags are left alone
+	if got := tracker.RewriteFlags("stats", []string{"--hours"}); got[0] != "--hours" {
+		t.Errorf("flag for another command was rewritten: %q", got)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/anoldguy/tse/cmd/tse/deprecation"
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const doctorUsage = `Usage: tse doctor [flags]
+
+Check that the CLI is configured and the Lambda is reachable, and list any
+deprecated environment variables or flags still in use
+
+With --compliance, also audit running exit nodes and their security groups
+against a security baseline (see 'tse deploy --baseline'):
+
+  strict    no SSH ingress, no key pair, IMDSv2 required, encrypted root
+            volume, outbound limited to web, DNS and Tailscale
+
+Every violation is listed and the command exits non-zero if any are found.
+
+Flags:
+  --compliance        Audit exit nodes and security groups against the baseline
+  --baseline <name>   Baseline to audit against (default: the deployment's own)
+  --region <name>     Only audit this region (default: all regions)
+
+Examples:
+  tse doctor
+  tse doctor --compliance
+  tse doctor --compliance --baseline strict --region ohio
+`
+
+func runDoctor(ctx context.Context, lambdaURL string, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, doctorUsage)
+	}
+
+	compliance := fs.Bool("compliance", false, "Audit exit nodes and security groups against the baseline")
+	baseline := fs.String("baseline", "", "Baseline to audit against")
+	region := fs.String("region", "", "Only audit this region")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+	*baseline = strings.ToLower(*baseline)
+	if *baseline != "" && !slices.Contains(types.Baselines, *baseline) {
+		return fmt.Errorf("unknown security baseline %s (valid: %s)", ui.Highlight(*baseline), strings.Join(types.Baselines, ", "))
+	}
+	if *region != "" {
+		resolved, err := regions.Resolve(*region)
+		if err != nil {
+			return fmt.Errorf("invalid region %s\n\n%v", ui.Highlight(*region), err)
+		}
+		*region = resolved
+	}
+	if !*compliance && (*baseline != "" || *region != "") {
+		return fmt.Errorf("--baseline and --region only apply with --compliance")
+	}
+
+	printDeprecations()
+	if err := checkSetup(ctx, lambdaURL); err != nil {
+		return err
+	}
+
+	if !*compliance {
+		return nil
+	}
+
+	fmt.Println()
+	return checkCompliance(ctx, lambdaURL, *baseline, *region)
+}
+
+// doctorCheck is the outcome of one setup check
+type doctorCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+	err    error  // Full error (with troubleshooting) for a failed check
+}
+
+// checkSetup verifies the CLI's configuration and that the Lambda answers health checks
+func checkSetup(ctx context.Context, lambdaURL string) error {
+	var checks []doctorCheck
+	err := ui.WithSpinner("Checking Lambda health", func() error {
+		checks = setupChecks(ctx, lambdaURL)
+		return ctx.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, check := range checks {
+		mark := ui.Checkmark()
+		if !check.OK {
+			mark = ui.Cross()
+		}
+		fmt.Printf("%s %s %s\n", mark, check.Name, ui.Subtle(check.Detail))
+	}
+	for _, check := range checks {
+		if check.err != nil {
+			return check.err
+		}
+	}
+
+	return nil
+}
+
+// setupChecks runs the setup checks without any UI, so they can also go in a support bundle
+func setupChecks(ctx context.Context, lambdaURL string) []doctorCheck {
+	var checks []doctorCheck
+	if lambdaURL == "" {
+		return append(checks, doctorCheck{Name: "TSE_LAMBDA_URL", Detail: "not set, run 'tse deploy'"})
+	}
+	checks = append(checks, doctorCheck{Name: "TSE_LAMBDA_URL", OK: true, Detail: lambdaURL})
+
+	if getAuthToken() == "" {
+		checks = append(checks, doctorCheck{Name: "TSE_AUTH_TOKEN", Detail: "not set, requests will be rejected"})
+	} else {
+		checks = append(checks, doctorCheck{Name: "TSE_AUTH_TOKEN", OK: true, Detail: "set"})
+	}
+
+	var health types.HealthResponse
+	if err := apiRequest(ctx, "GET", lambdaURL, nil, http.StatusOK, "health check", &health); err != nil {
+		checks = append(checks, doctorCheck{Name: "Lambda", Detail: firstLine(err.Error()), err: err})
+	} else {
+		checks = append(checks, doctorCheck{Name: "Lambda", OK: true, Detail: fmt.Sprintf("%s v%s", health.Status, health.Version)})
+		checks = append(checks, identityCheck(ctx, health))
+	}
+
+	return checks
+}
+
+// identityCheck compares the Lambda's account, region and name with the local AWS
+// configuration. It only fails on a real mismatch; a Lambda that doesn't report
+// its identity, or missing local credentials, just can't be checked.
+func identityCheck(ctx context.Context, health types.HealthResponse) doctorCheck {
+	check := doctorCheck{Name: "Deployment", OK: true}
+	if health.AccountID == "" && health.Region == "" {
+		check.Detail = "not reported by this Lambda (run 'tse deploy' to update it)"
+		return check
+	}
+
+	local, err := lookupLocalIdentity(ctx)
+	if err != nil {
+		check.Detail = fmt.Sprintf("account %s in %s (no local AWS credentials to compare)", health.AccountID, health.Region)
+		return check
+	}
+	if mismatches := identityMismatches(health, local); len(mismatches) > 0 {
+		check.OK = false
+		check.Detail = strings.Join(mismatches, "; ")
+		return check
+	}
+	check.Detail = fmt.Sprintf("account %s in %s, matches your AWS configuration", health.AccountID, health.Region)
+	return check
+}
+
+// firstLine returns the first line of s
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// printDeprecations lists deprecated environment variables and flags this run relied on
+func printDeprecations() {
+	active := deprecation.Active()
+	if len(active) == 0 {
+		return
+	}
+
+	table := ui.NewTable("Deprecated", "Use Instead", "Removed In")
+	for _, d := range active {
+		old, replacement := d.Names()
+		table.AddRow(old, replacement, d.Remove)
+	}
+	fmt.Println(ui.Warning("Deprecated settings in use:"))
+	fmt.Println(table.Render())
+	fmt.Println()
+}
+
+// checkCompliance audits each region against the baseline and lists every violation
+func checkCompliance(ctx context.Context, lambdaURL, baseline, region string) error {
+	names := regions.GetAllFriendlyNames()
+	if region != "" {
+		names = []string{region}
+	}
+
+	query := url.Values{}
+	if baseline != "" {
+		query.Set("baseline", baseline)
+	}
+
+	var mu sync.Mutex
+	reports := map[string]*types.ComplianceResponse{}
+
+	title := "Auditing exit nodes against the deployment's security baseline..."
+	if baseline != "" {
+		title = fmt.Sprintf("Auditing exit nodes against the %s security baseline...", baseline)
+	}
+	results := ui.FanOut(title, names, func(region string) (string, error) {
+		var report types.ComplianceResponse
+		endpoint := fmt.Sprintf("%s/%s/compliance", lambdaURL, region)
+		if len(query) > 0 {
+			endpoint += "?" + query.Encode()
+		}
+		if err := apiRequest(ctx, "GET", endpoint, nil, http.StatusOK, fmt.Sprintf("compliance check in %s", region), &report); err != nil {
+			return "", err
+		}
+
+		mu.Lock()
+		reports[region] = &report
+		mu.Unlock()
+
+		if len(report.Violations) == 0 {
+			return fmt.Sprintf("compliant (%d nodes, %d security groups)", report.NodesChecked, report.GroupsChecked), nil
+		}
+		return fmt.Sprintf("%d violations", len(report.Violations)), nil
+	})
+
+	fmt.Println()
+	printFanOutFailures(results)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	table := ui.NewTable("Region", "Resource", "Check", "Detail")
+	violations := 0
+	for _, name := range names {
+		report, ok := reports[name]
+		if !ok {
+			continue
+		}
+		baseline = report.Baseline
+		for _, v := range report.Violations {
+			table.AddRow(name, v.Resource, v.Check, v.Detail)
+			violations++
+		}
+	}
+
+	if violations > 0 {
+		fmt.Println(table.Render())
+	}
+	if len(reports) < len(names) {
+		return fmt.Errorf("compliance check failed in %d of %d regions", len(names)-len(reports), len(names))
+	}
+	if violations > 0 {
+		return fmt.Errorf("found %d violations of the %s baseline", violations, baseline)
+	}
+
+	fmt.Printf("%s %s\n", ui.Checkmark(), ui.Success(fmt.Sprintf("All exit nodes and security groups meet the %s baseline", baseline)))
+	return nil
+}
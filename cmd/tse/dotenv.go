@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/anoldguy/tse/cmd/tse/config"
+	"github.com/anoldguy/tse/cmd/tse/infrastructure"
+	"github.com/anoldguy/tse/cmd/tse/ui"
+)
+
+// dotEnvPath is the file deploy offers to save its outputs to when no profile
+// is in use, relative to the current directory
+const dotEnvPath = ".env"
+
+// offerToSaveDeployOutputs asks whether to save the function URL and auth token
+// deploy printed: to the active profile in the config file if there is one, as
+// that's where the CLI would read them from, otherwise to ./.env. It doesn't ask
+// when nobody is at the keyboard to answer.
+func offerToSaveDeployOutputs(ctx context.Context, lambdaURL, authToken string) error {
+	if ui.JSONLines() || !ui.IsTerminal(os.Stdin) {
+		return nil
+	}
+
+	target := fmt.Sprintf("TSE_LAMBDA_URL and TSE_AUTH_TOKEN to %s", dotEnvPath)
+	if activeProfile != "" {
+		path, err := config.Path()
+		if err != nil {
+			return err
+		}
+		target = fmt.Sprintf("the URL and token to profile %s in %s", ui.Highlight(activeProfile), path)
+	}
+
+	fmt.Printf("%s Save %s? [Y/n]: ", ui.Info("→"), target)
+	response, err := readLine(ctx, os.Stdin)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(strings.TrimSpace(response)) {
+	case "", "y", "yes":
+	default:
+		fmt.Println(ui.Subtle("Not saved; copy the exports above instead (--no-write skips this question)"))
+		return nil
+	}
+
+	if activeProfile != "" {
+		return saveToProfile(activeProfile, lambdaURL, authToken)
+	}
+	return saveToDotEnv(dotEnvPath, lambdaURL, authToken)
+}
+
+// saveToProfile updates a profile's Lambda URL and token, sealing the token if
+// the config is encrypted, and its name prefix
+func saveToProfile(name, lambdaURL, authToken string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		return fmt.Errorf("profile %q not found", name)
+	}
+	sealed, err := cfg.Seal(authToken)
+	if err != nil {
+		return err
+	}
+	profile.LambdaURL = lambdaURL
+	profile.AuthToken = sealed
+	profile.NamePrefix = ""
+	if infrastructure.CustomNamePrefix() {
+		profile.NamePrefix = infrastructure.NamePrefix()
+	}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("%s Updated profile %s\n", ui.Checkmark(), ui.Highlight(name))
+	return nil
+}
+
+// saveToDotEnv sets TSE_LAMBDA_URL and TSE_AUTH_TOKEN (and TSE_NAME_PREFIX, for
+// a custom one) in a .env file, creating it if needed and leaving its other lines alone
+func saveToDotEnv(path, lambdaURL, authToken string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	values := [][2]string{
+		{"TSE_LAMBDA_URL", lambdaURL},
+		{"TSE_AUTH_TOKEN", authToken},
+	}
+	if infrastructure.CustomNamePrefix() {
+		values = append(values, [2]string{infrastructure.EnvNamePrefix, infrastructure.NamePrefix()})
+	}
+	updated := setDotEnv(string(data), values)
+	if updated == string(data) {
+		fmt.Printf("%s %s already has these values\n", ui.Checkmark(), path)
+		return nil
+	}
+
+	// Owner-only, as it holds the auth token; an existing file keeps its mode
+	if err := os.WriteFile(path, []byte(updated), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	fmt.Printf("%s Saved to %s\n", ui.Checkmark(), path)
+	return nil
+}
+
+// setDotEnv sets each key in .env content, replacing the value on a KEY=... or
+// export KEY=... line and appending keys it doesn't have
+func setDotEnv(content string, values [][2]string) string {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+
+	for _, kv := range values {
+		key, value := kv[0], kv[1]
+		found := false
+		for i, line := range lines {
+			trimmed := strings.TrimSpace(line)
+			export := strings.HasPrefix(trimmed, "export ")
+			name, _, ok := strings.Cut(strings.TrimSpace(strings.TrimPrefix(trimmed, "export ")), "=")
+			if !ok || strings.TrimSpace(name) != key {
+				continue
+			}
+			lines[i] = key + "=" + value
+			if export {
+				lines[i] = "export " + lines[i]
+			}
+			found = true
+		}
+		if !found {
+			lines = append(lines, key+"="+value)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// errorHints says what to do about each error code the Lambda sends. Codes
+// without hints (AUTH_FAILED, INTERNAL, ...) fall back to the troubleshooting
+// for their HTTP status.
+var errorHints = map[types.ErrorCode][]string{
+	types.ErrorCodeRegionInvalid: {
+		"Run 'tse regions' to list the regions tse knows",
+		"Add your own with 'tse config region set <name> <aws-region>'",
+	},
+	types.ErrorCodeRegionDisabled: {
+		"Enable the region for your AWS account (link above); it takes a few minutes",
+		"Or pick a nearby region from 'tse regions'",
+	},
+	types.ErrorCodeAlreadyRunning: {
+		"Run 'tse <region> instances' to see it",
+		"Run 'tse <region> stop' first to replace it",
+	},
+	types.ErrorCodeStartInProgress: {
+		"Another start or resume is launching a node in this region right now",
+		"Wait a minute, then run 'tse <region> instances'",
+	},
+	types.ErrorCodeNodePaused: {
+		"Run 'tse <region> resume' to bring the paused node back",
+		"Or 'tse <region> stop' to delete it and start a fresh one",
+	},
+	types.ErrorCodeNothingPaused: {
+		"Run 'tse <region> start' to launch a new exit node",
+	},
+	types.ErrorCodeRegionNotAllowed: {
+		"Your token's limits only allow starts in the regions listed above",
+		"Ask whoever manages the deployment for a token that allows this region",
+	},
+	types.ErrorCodeNodeLimit: {
+		"Your token already has as many exit nodes as its limits allow",
+		"Stop one with 'tse <region> stop', then start again",
+	},
+	types.ErrorCodeNodeCap: {
+		"The deployment already has as many exit nodes as its cap allows",
+		"See them with 'tse status' and stop one, or raise the cap with 'tse deploy --max-nodes <n>'",
+	},
+	types.ErrorCodeReservationExists: {
+		"Run 'tse <region> reserve' to see it",
+		"Cancel it with 'tse <region> reserve cancel' before reserving again",
+	},
+	types.ErrorCodeNoCapacity: {
+		"AWS is out of t4g.nano and t3.nano capacity in every zone of this region",
+		"Try again in a few minutes, or start in a nearby region",
+		"Reserve capacity ahead of time with 'tse <region> reserve create'",
+	},
+	types.ErrorCodeAWSThrottled: {
+		"AWS is rate-limiting the Lambda's API calls, and tse already retried",
+		"Wait a minute and try again; avoid running many regions at once",
+	},
+	types.ErrorCodeStateTableMissing: {
+		"This deployment predates the state table; run 'tse deploy' to update it",
+	},
+	types.ErrorCodeVersionUnsupported: {
+		"This tse speaks a newer API than the deployed Lambda",
+		"Run 'tse deploy' to update the Lambda",
+	},
+	types.ErrorCodeMisconfigured: {
+		"The Lambda is missing part of its configuration",
+		"Run 'tse deploy' with TAILSCALE_AUTH_KEY set to fix it",
+	},
+	types.ErrorCodeOutOfTime: {
+		"The Lambda stopped before its timeout and rolled back what it had created",
+		"Try again; a region's first start builds its VPC, and later ones are quicker",
+		"If it keeps happening, give the Lambda longer: 'tse deploy --lambda-timeout 180'",
+	},
+}
+
+// explainErrorCode formats a Lambda error that has hints for its code,
+// reporting false when it has none
+func explainErrorCode(errorResp types.ErrorResponse, operation string) (error, bool) {
+	hints, ok := errorHints[errorResp.ErrorCode]
+	if !ok {
+		return nil, false
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s failed (%s): %s\n\nWhat to do:", operation, errorResp.ErrorCode, errorResp.Error)
+	for _, hint := range hints {
+		fmt.Fprintf(&b, "\n  - %s", hint)
+	}
+	return fmt.Errorf("%s", b.String()), true
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+)
+
+// Exit codes every command uses, listed under "Exit Codes" in the usage.
+// tse quick has its own (see quickUsage).
+const (
+	exitFailed      = 1   // The command failed; stderr says why
+	exitUsage       = 2   // Bad arguments, as the flag package exits too
+	exitInterrupted = 130 // Ctrl-C, as shells report SIGINT
+)
+
+// Status queries (instances --quiet) answer with the exit code alone, like
+// grep -q: 0 when an exit node is running, exitNotRunning when none is, and
+// exitQueryFailed when the query couldn't tell
+const (
+	exitNotRunning  = 1
+	exitQueryFailed = 2
+)
+
+// exitUsageError reports a bad argument and exits exitUsage
+func exitUsageError(err error) {
+	fmt.Fprintf(os.Stderr, "%s %v\n", ui.Error("Error:"), err)
+	os.Exit(exitUsage)
+}
+
+// exitQuery ends a status query: it returns only if a node is running, so the
+// command exits 0. A failure is the one thing it prints, on stderr.
+func exitQuery(running bool, err error) {
+	switch {
+	case isInterrupted(err):
+		os.Exit(exitInterrupted)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "%s %v\n", ui.Error("Error:"), err)
+		os.Exit(exitQueryFailed)
+	case !running:
+		os.Exit(exitNotRunning)
+	}
+}
+
+// nodeRunning reports whether any of the named regions has a running exit
+// node, asking them all at once and printing nothing. A region that fails only
+// matters if no other region has a node running.
+func nodeRunning(ctx context.Context, lambdaURL string, names []string, allDeployments bool) (bool, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	running := false
+	var firstErr error
+
+	for _, region := range names {
+		wg.Add(1)
+		go func(region string) {
+			defer wg.Done()
+			instancesResp, err := listDeploymentInstances(ctx, lambdaURL, region, allDeployments)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if len(names) > 1 {
+					err = fmt.Errorf("%s: %w", region, err)
+				}
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			for _, instance := range instancesResp.Instances {
+				if instance.State == "running" {
+					running = true
+				}
+			}
+		}(region)
+	}
+	wg.Wait()
+
+	if running {
+		return true, nil
+	}
+	return false, firstErr
+}
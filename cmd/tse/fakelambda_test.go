@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// fakeToken is the auth token the fake Lambda accepts
+const fakeToken = "test-token"
+
+func TestMain(m *testing.M) {
+	// No TUI without a terminal, and nothing written to the real config directory
+	ui.EnablePlain()
+	dir, err := os.MkdirTemp("", "tse-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", dir)
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	os.Setenv("TSE_AUTH_TOKEN", fakeToken)
+	os.Unsetenv("TAILSCALE_API_TOKEN") // Keeps listings from asking the Tailscale API for IPs
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// fakeLambda serves the Lambda's API in-process. Routes ("POST /ohio/stop",
+// without the API version) answer from the handlers a test sets; anything else
+// is a 404. Requests without the token get the Lambda's 401.
+type fakeLambda struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	routes   map[string]http.HandlerFunc
+	requests []fakeRequest
+}
+
+// fakeRequest is one request the fake Lambda received
+type fakeRequest struct {
+	Route string // e.g. "POST /ohio/stop"
+	Body  string
+}
+
+func newFakeLambda(t *testing.T) *fakeLambda {
+	t.Helper()
+	f := &fakeLambda{routes: map[string]http.HandlerFunc{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// on sets the handler for a route
+func (f *fakeLambda) on(route string, handler http.HandlerFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.routes[route] = handler
+}
+
+// received returns the requests made so far
+func (f *fakeLambda) received() []fakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeRequest(nil), f.requests...)
+}
+
+func (f *fakeLambda) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	route := r.Method + " " + strings.TrimPrefix(r.URL.Path, "/"+types.APIVersion)
+	f.mu.Lock()
+	f.requests = append(f.requests, fakeRequest{Route: route, Body: string(body)})
+	handler, ok := f.routes[route]
+	f.mu.Unlock()
+
+	w.Header().Set(types.APIVersionHeader, types.APIVersion)
+	switch {
+	case r.Header.Get("Authorization") != "Bearer "+fakeToken:
+		writeJSON(w, http.StatusUnauthorized, types.ErrorResponse{Error: "Unauthorized: invalid token", Code: http.StatusUnauthorized, ErrorCode: types.ErrorCodeAuthFailed})
+	case !ok:
+		writeJSON(w, http.StatusNotFound, types.ErrorResponse{Error: "Not found", Code: http.StatusNotFound, ErrorCode: types.ErrorCodeNotFound})
+	default:
+		handler(w, r)
+	}
+}
+
+// reply answers with a JSON body
+func reply(status int, v any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, status, v)
+	}
+}
+
+// replyRaw answers with a body as is
+func replyRaw(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}
+}
+
+// hang answers only once the client gives up
+func hang(w http.ResponseWriter, r *http.Request) {
+	<-r.Context().Done()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// captureOutput returns what fn prints to stdout and stderr, and its error
+func captureOutput(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe() error = %v", err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, w
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	fnErr := fn()
+	w.Close()
+	return <-out, fnErr
+}
+
+// captureStdout returns what fn prints to stdout alone, and its error; stderr
+// is discarded
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("opening %s: %v", os.DevNull, err)
+	}
+	defer devNull.Close()
+
+	stderr := os.Stderr
+	os.Stderr = devNull
+	defer func() { os.Stderr = stderr }()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe() error = %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	fnErr := fn()
+	w.Close()
+	return <-out, fnErr
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/mqtt"
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/cmd/tse/usage"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const haBridgeUsage = `Usage: tse ha-bridge [flags]
+
+Connect to an MQTT broker and show each region as a switch in Home Assistant
+(through MQTT discovery). Turning a switch on starts an exit node in that
+region and turning it off stops it, so nodes can go on dashboards and into
+automations. Runs until interrupted, reconnecting when the broker goes away.
+
+Flags:
+  --broker string           MQTT broker: tcp://host:1883 or mqtts://host:8883
+                            (default: $TSE_MQTT_BROKER)
+  --username string         MQTT username (default: $TSE_MQTT_USERNAME); the
+                            password is read from $TSE_MQTT_PASSWORD
+  --regions string          Comma-separated regions or groups to show (default: all)
+  --interval duration       How often to refresh node state (default 1m)
+  --discovery-prefix string Home Assistant's discovery prefix (default "homeassistant")
+  --topic-prefix string     Prefix for state and command topics (default "tse")
+
+Topics (with the default prefix):
+  tse/bridge/availability   online / offline
+  tse/<region>/state        ON / OFF
+  tse/<region>/attributes   JSON: instance, public IP, hostname, ready
+  tse/<region>/set          Publish ON or OFF to start or stop
+
+Examples:
+  tse ha-bridge --broker tcp://homeassistant.local:1883 --username tse
+  tse ha-bridge --broker mqtts://broker.example.com --regions eu,ohio
+`
+
+const (
+	// haBridgeMinBackoff doubles after each failed connection, up to haBridgeMaxBackoff
+	haBridgeMinBackoff = 5 * time.Second
+	haBridgeMaxBackoff = 2 * time.Minute
+
+	haPayloadOn  = "ON"
+	haPayloadOff = "OFF"
+)
+
+// haBridge publishes exit node state to MQTT and acts on switch commands
+type haBridge struct {
+	lambdaURL       string
+	regions         []string
+	topicPrefix     string
+	discoveryPrefix string
+
+	mu     sync.Mutex
+	client *mqtt.Client
+	busy   map[string]bool // Regions with a start or stop in flight
+}
+
+// haAttributes are a region's switch attributes in Home Assistant
+type haAttributes struct {
+	InstanceID string `json:"instance_id,omitempty"`
+	State      string `json:"state,omitempty"`
+	Ready      bool   `json:"ready"`
+	PublicIP   string `json:"public_ip,omitempty"`
+	Hostname   string `json:"hostname,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func runHABridge(ctx context.Context, lambdaURL string, args []string) error {
+	fs := flag.NewFlagSet("ha-bridge", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, haBridgeUsage)
+	}
+
+	broker := fs.String("broker", os.Getenv("TSE_MQTT_BROKER"), "MQTT broker URL")
+	username := fs.String("username", os.Getenv("TSE_MQTT_USERNAME"), "MQTT username")
+	regionList := fs.String("regions", "", "Comma-separated regions or groups to show")
+	interval := fs.Duration("interval", time.Minute, "How often to refresh node state")
+	discoveryPrefix := fs.String("discovery-prefix", "homeassistant", "Home Assistant's discovery prefix")
+	topicPrefix := fs.String("topic-prefix", "tse", "Prefix for state and command topics")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+	if *broker == "" {
+		fs.Usage()
+		return fmt.Errorf("--broker (or TSE_MQTT_BROKER) is required")
+	}
+	if *interval < 10*time.Second {
+		return fmt.Errorf("--interval must be at least 10s")
+	}
+
+	names := regions.GetAllFriendlyNames()
+	if *regionList != "" {
+		var err error
+		if names, err = parseRegionList(*regionList); err != nil {
+			return err
+		}
+	}
+
+	b := &haBridge{
+		lambdaURL:       lambdaURL,
+		regions:         names,
+		topicPrefix:     strings.TrimSuffix(*topicPrefix, "/"),
+		discoveryPrefix: strings.TrimSuffix(*discoveryPrefix, "/"),
+		busy:            make(map[string]bool),
+	}
+	opts := mqtt.Options{
+		Broker:   *broker,
+		ClientID: "tse-bridge-" + strings.ReplaceAll(b.topicPrefix, "/", "-"),
+		Username: *username,
+		Password: os.Getenv("TSE_MQTT_PASSWORD"),
+		Will:     &mqtt.Message{Topic: b.availabilityTopic(), Payload: []byte("offline"), Retain: true},
+	}
+
+	backoff := haBridgeMinBackoff
+	for {
+		started := time.Now()
+		err := b.session(ctx, opts, *interval)
+		if ctx.Err() != nil {
+			logEvent("Stopped")
+			return nil
+		}
+		// A session that ran a while was healthy; start over with a short wait
+		if time.Since(started) > haBridgeMaxBackoff {
+			backoff = haBridgeMinBackoff
+		}
+		logEvent("%s %v; reconnecting in %s", ui.Warning("Warning:"), err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, haBridgeMaxBackoff)
+	}
+}
+
+// session runs one broker connection until it fails or ctx is cancelled
+func (b *haBridge) session(ctx context.Context, opts mqtt.Options, interval time.Duration) error {
+	client, err := mqtt.Dial(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	b.mu.Lock()
+	b.client = client
+	b.mu.Unlock()
+
+	for _, region := range b.regions {
+		if err := b.publishDiscovery(region); err != nil {
+			return err
+		}
+	}
+	if err := b.publish(b.availabilityTopic(), "online"); err != nil {
+		return err
+	}
+	if err := client.Subscribe(b.topicPrefix + "/+/set"); err != nil {
+		return err
+	}
+	logEvent("%s Connected to %s; %d region(s) available in Home Assistant", ui.Checkmark(), opts.Broker, len(b.regions))
+
+	b.refreshAll(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Say so before disconnecting; a clean disconnect skips the will
+			b.publish(b.availabilityTopic(), "offline")
+			return ctx.Err()
+		case <-client.Done():
+			return client.Err()
+		case <-ticker.C:
+			b.refreshAll(ctx)
+		case msg, ok := <-client.Messages():
+			if ok {
+				b.handleCommand(ctx, msg)
+			}
+		}
+	}
+}
+
+// handleCommand starts or stops a region's node for a message on its set topic.
+// Start and stop can take a minute, so they run in the background, one at a
+// time per region.
+func (b *haBridge) handleCommand(ctx context.Context, msg mqtt.Message) {
+	region := strings.TrimSuffix(strings.TrimPrefix(msg.Topic, b.topicPrefix+"/"), "/set")
+	if !slices.Contains(b.regions, region) {
+		return
+	}
+	command := strings.ToUpper(strings.TrimSpace(string(msg.Payload)))
+	if command != haPayloadOn && command != haPayloadOff {
+		logEvent("%s ignoring %q for %s (want %s or %s)", ui.Warning("Warning:"), msg.Payload, region, haPayloadOn, haPayloadOff)
+		return
+	}
+
+	b.mu.Lock()
+	if b.busy[region] {
+		b.mu.Unlock()
+		logEvent("%s is busy; ignoring %s", region, command)
+		return
+	}
+	b.busy[region] = true
+	b.mu.Unlock()
+
+	go func() {
+		defer func() {
+			b.mu.Lock()
+			delete(b.busy, region)
+			b.mu.Unlock()
+			b.refresh(ctx, region)
+		}()
+
+		if command == haPayloadOn {
+			// Show the switch on at once; the refresh afterwards corrects it
+			b.publish(b.stateTopic(region), haPayloadOn)
+			resp, alreadyRunning, err := startRegion(ctx, b.lambdaURL, types.StartRequest{Region: region})
+			switch {
+			case err != nil:
+				logEvent("%s start in %s failed: %s", ui.Error("Error:"), region, firstLine(err.Error()))
+			case alreadyRunning:
+				logEvent("%s", resp.Message)
+			default:
+				usage.Record(usage.Event{Kind: usage.KindNodeStart, Region: region})
+				logEvent("%s %s", ui.Checkmark(), resp.Message)
+			}
+			return
+		}
+
+		b.publish(b.stateTopic(region), haPayloadOff)
+		resp, err := stopRegion(ctx, b.lambdaURL, region)
+		if err != nil {
+			logEvent("%s stop in %s failed: %s", ui.Error("Error:"), region, firstLine(err.Error()))
+			return
+		}
+		if resp.TerminatedCount > 0 {
+			usage.Record(usage.Event{Kind: usage.KindNodeStop, Region: region})
+		}
+		logEvent("%s %s", ui.Checkmark(), resp.Message)
+	}()
+}
+
+// refreshAll publishes every region's state
+func (b *haBridge) refreshAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, region := range b.regions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.refresh(ctx, region)
+		}()
+	}
+	wg.Wait()
+}
+
+// refresh publishes a region's state and attributes. A failed listing keeps the
+// last state and reports the error as an attribute.
+func (b *haBridge) refresh(ctx context.Context, region string) {
+	b.mu.Lock()
+	busy := b.busy[region]
+	b.mu.Unlock()
+	if busy {
+		return // The command's own refresh follows
+	}
+
+	instancesResp, err := listRegionInstances(ctx, b.lambdaURL, region)
+	if err != nil {
+		if ctx.Err() == nil {
+			b.publishAttributes(region, haAttributes{Error: firstLine(err.Error())})
+		}
+		return
+	}
+
+	state, attrs := haRegionState(instancesResp.Instances)
+	b.publish(b.stateTopic(region), state)
+	b.publishAttributes(region, attrs)
+}
+
+// haRegionState is a region's switch state: on while any node is starting or
+// running, described by the newest
+func haRegionState(instances []*types.InstanceInfo) (string, haAttributes) {
+	var newest *types.InstanceInfo
+	for _, instance := range instances {
+		if instance.State != "pending" && instance.State != "running" {
+			continue
+		}
+		if newest == nil || instance.LaunchTime.After(newest.LaunchTime) {
+			newest = instance
+		}
+	}
+	if newest == nil {
+		return haPayloadOff, haAttributes{}
+	}
+	return haPayloadOn, haAttributes{
+		InstanceID: newest.InstanceID,
+		State:      newest.State,
+		Ready:      newest.Ready,
+		PublicIP:   newest.PublicIP,
+		Hostname:   newest.TailscaleHostname,
+	}
+}
+
+// publishDiscovery announces a region's switch to Home Assistant
+func (b *haBridge) publishDiscovery(region string) error {
+	name := region
+	if info, ok := regions.Lookup(region); ok && info.City != "" {
+		name = info.City
+	}
+	id := "tse_" + strings.ReplaceAll(region, "-", "_")
+
+	config := map[string]any{
+		"name":                  name + " exit node",
+		"unique_id":             id,
+		"object_id":             id,
+		"icon":                  "mdi:earth",
+		"command_topic":         b.commandTopic(region),
+		"state_topic":           b.stateTopic(region),
+		"json_attributes_topic": b.attributesTopic(region),
+		"availability_topic":    b.availabilityTopic(),
+		"payload_on":            haPayloadOn,
+		"payload_off":           haPayloadOff,
+		"device": map[string]any{
+			"identifiers":  []string{"tse_" + strings.ReplaceAll(b.topicPrefix, "/", "_")},
+			"name":         "Tailscale exit nodes",
+			"manufacturer": "tse",
+			"sw_version":   Version,
+		},
+	}
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return b.publishRetained(fmt.Sprintf("%s/switch/%s/config", b.discoveryPrefix, id), payload)
+}
+
+func (b *haBridge) publishAttributes(region string, attrs haAttributes) {
+	payload, err := json.Marshal(attrs)
+	if err == nil {
+		b.publishRetained(b.attributesTopic(region), payload)
+	}
+}
+
+func (b *haBridge) publish(topic, payload string) error {
+	return b.publishRetained(topic, []byte(payload))
+}
+
+// publishRetained publishes on the current connection. Everything the bridge
+// publishes is retained, so Home Assistant sees the state after a restart.
+func (b *haBridge) publishRetained(topic string, payload []byte) error {
+	b.mu.Lock()
+	client := b.client
+	b.mu.Unlock()
+	if client == nil {
+		return errors.New("not connected to the MQTT broker")
+	}
+	return client.Publish(mqtt.Message{Topic: topic, Payload: payload, Retain: true})
+}
+
+func (b *haBridge) availabilityTopic() string {
+	return b.topicPrefix + "/bridge/availability"
+}
+
+func (b *haBridge) stateTopic(region string) string {
+	return b.topicPrefix + "/" + region + "/state"
+}
+
+func (b *haBridge) attributesTopic(region string) string {
+	return b.topicPrefix + "/" + region + "/attributes"
+}
+
+func (b *haBridge) commandTopic(region string) string {
+	return b.topicPrefix + "/" + region + "/set"
+}
+
+// logEvent prints a timestamped line for long-running commands (ha-bridge,
+// watch), which run for days, so each event says when it happened
+func logEvent(format string, args ...any) {
+	fmt.Printf("%s %s\n", ui.Subtle(time.Now().Format("2006-01-02 15:04:05")), fmt.Sprintf(format, args...))
+}
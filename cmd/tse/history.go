@@ -0,0 +1,197 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/cmd/tse/usage"
+	"github.com/anoldguy/tse/shared/regions"
+)
+
+const historyUsage = `Usage: tse history [flags]
+
+Show when you used which exit nodes, from the local usage log
+
+Each start and stop is recorded on this machine (see 'tse stats'), so this
+works without AWS and keeps going after the Lambda's audit log expires. Costs
+are estimates of instance time at the region's t4g.nano rate; data transfer
+and disk aren't included.
+
+Optional Flags:
+  --days int        Only include the last N days (default 30, 0 for all history)
+  --region string   Only include this region
+  --limit int       Sessions to list, newest first (default 20, 0 for all)
+
+Examples:
+  tse history
+  tse history --days 7
+  tse history --region frankfurt --days 0
+`
+
+// runHistory lists exit node sessions by day and one by one
+func runHistory(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, historyUsage)
+	}
+
+	days := fs.Int("days", 30, "Only include the last N days")
+	region := fs.String("region", "", "Only include this region")
+	limit := fs.Int("limit", 20, "Sessions to list")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+	if *region != "" {
+		resolved, err := regions.Resolve(*region)
+		if err != nil {
+			return fmt.Errorf("invalid region %s\n\n%v", ui.Highlight(*region), err)
+		}
+		*region = resolved
+	}
+
+	path, err := usage.Path()
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		fmt.Println(ui.Subtle(fmt.Sprintf("Usage logging is disabled (%s=off).", usage.EnvUsageLog)))
+		return nil
+	}
+
+	events, err := usage.Load()
+	if err != nil {
+		return err
+	}
+
+	var since time.Time
+	if *days > 0 {
+		since = time.Now().AddDate(0, 0, -*days)
+	}
+	var sessions []usage.Session
+	for _, session := range usage.Summarize(events, since).Sessions {
+		if *region == "" || session.Region == *region {
+			sessions = append(sessions, session)
+		}
+	}
+
+	if len(sessions) == 0 {
+		fmt.Println(ui.Subtle("No exit node sessions recorded yet."))
+		fmt.Println(ui.Subtle(path))
+		return nil
+	}
+
+	period := "all time"
+	if *days > 0 {
+		period = fmt.Sprintf("last %d days", *days)
+	}
+	fmt.Println(ui.Title(fmt.Sprintf("TSE history (%s)", period)))
+	fmt.Println()
+
+	now := time.Now()
+	for _, day := range usage.Daily(sessions, time.Local) {
+		var used []string
+		for _, r := range day.Regions {
+			used = append(used, fmt.Sprintf("%s for %s", ui.Highlight(r.Region), formatSessionDuration(r.TotalDuration)))
+		}
+		fmt.Printf("%s You used %s\n", ui.Label(fmt.Sprintf("%-11s", dayLabel(day.Date, now))), joinAnd(used))
+	}
+	fmt.Println()
+
+	slices.Reverse(sessions)
+	var total time.Duration
+	var totalCost float64
+	unpriced, open := false, false
+	table := ui.NewTable("Region", "Started", "Stopped", "Duration", "Est. Cost")
+	for i, session := range sessions {
+		cost, priced := instanceCost(session)
+		if !session.End.IsZero() {
+			total += session.Duration()
+			totalCost += cost
+			unpriced = unpriced || !priced
+		} else {
+			open = true
+		}
+		if *limit > 0 && i >= *limit {
+			continue
+		}
+
+		start := session.Start.Local()
+		stopped, duration, costCell := ui.Subtle("not recorded"), "-", "-"
+		if !session.End.IsZero() {
+			end := session.End.Local()
+			stopped = end.Format("15:04")
+			if !midnightOf(end).Equal(midnightOf(start)) {
+				stopped = end.Format("Jan 2 15:04")
+			}
+			duration = formatSessionDuration(session.Duration())
+			if priced {
+				costCell = fmt.Sprintf("$%.4f", cost)
+			}
+		}
+		table.AddRow(session.Region, start.Format("Jan 2 15:04"), stopped, duration, costCell)
+	}
+	fmt.Println(table.Render())
+	if *limit > 0 && len(sessions) > *limit {
+		fmt.Println(ui.Subtle(fmt.Sprintf("%d older session(s) not shown (--limit 0 lists them all)", len(sessions)-*limit)))
+	}
+
+	fmt.Println()
+	summary := fmt.Sprintf("%s connected over %d sessions", formatSessionDuration(total), len(sessions))
+	if totalCost > 0 {
+		summary += fmt.Sprintf(", %s in instance time", formatUSD(totalCost))
+		if unpriced {
+			summary += " (custom regions not priced)"
+		}
+	}
+	fmt.Printf("%s %s\n", ui.Label("Total:"), summary)
+	if open {
+		fmt.Println(ui.Subtle("A session with no stop recorded is still running, or ended outside tse (a cap, the console); see 'tse instances'."))
+	}
+	fmt.Println(ui.Subtle(path))
+	return nil
+}
+
+// instanceCost estimates what a completed session cost in instance time
+func instanceCost(session usage.Session) (float64, bool) {
+	info, ok := regions.Lookup(session.Region)
+	if !ok || info.NanoHourlyUSD == 0 {
+		return 0, false
+	}
+	return session.Duration().Hours() * info.NanoHourlyUSD, true
+}
+
+// dayLabel names a day relative to now: Today, Yesterday, or e.g. "Mon Oct 12"
+func dayLabel(day, now time.Time) string {
+	today := midnightOf(now)
+	switch {
+	case day.Equal(today):
+		return "Today"
+	case day.Equal(today.AddDate(0, 0, -1)):
+		return "Yesterday"
+	default:
+		return day.Format("Mon Jan 2")
+	}
+}
+
+// midnightOf returns the start of t's day in t's location
+func midnightOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// joinAnd joins items as "a", "a and b", or "a, b and c"
+func joinAnd(items []string) string {
+	if len(items) <= 1 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/pkg/client"
+)
+
+// lambdaClient returns a client for the Lambda at lambdaURL, with the auth
+// token from the environment, that reports its retries as --json-lines events
+func lambdaClient(lambdaURL string) (*client.Client, error) {
+	c, err := client.New(lambdaURL, getAuthToken())
+	if err != nil {
+		return nil, err
+	}
+	c.SetRetryHook(func(r client.Retry) {
+		ui.Emit(ui.Event{Type: ui.EventRequestRetry, Step: r.Method + " " + requestPath(r.Path), Error: r.Reason, Attempt: r.Attempt, DurationMS: r.Delay.Milliseconds()})
+	})
+	return c, nil
+}
+
+// explainLambdaError adds troubleshooting tips to an error from the client's
+// typed methods
+func explainLambdaError(err error) error {
+	var statusErr *client.StatusError
+	if errors.As(err, &statusErr) {
+		return enhanceHTTPStatusError(statusErr.StatusCode, statusErr.Body, statusErr.Operation)
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return enhanceHTTPError(urlErr, urlErr.URL, timeoutFor(urlErr.Op))
+	}
+	return err
+}
+
+// timeoutFor returns the client timeout for a request method
+func timeoutFor(method string) time.Duration {
+	if strings.EqualFold(method, http.MethodGet) {
+		return client.ReadTimeout
+	}
+	return client.ActionTimeout
+}
+
+// makeAuthenticatedRequest sends a request to a Lambda URL, retrying with
+// jittered backoff on connection errors and server errors. It gives up at once
+// when ctx is cancelled (Ctrl+C).
+func makeAuthenticatedRequest(ctx context.Context, method, rawURL string, body io.Reader) (*http.Response, error) {
+	return requestWithRetries(ctx, method, rawURL, body, client.DefaultMaxAttempts)
+}
+
+// sendAuthenticatedRequest makes a single attempt. tse loadtest uses it so
+// retries don't hide errors it's measuring.
+func sendAuthenticatedRequest(ctx context.Context, method, rawURL string, payload []byte) (*http.Response, error) {
+	return requestWithRetries(ctx, method, rawURL, bytes.NewReader(payload), 1)
+}
+
+func requestWithRetries(ctx context.Context, method, rawURL string, body io.Reader, attempts int) (*http.Response, error) {
+	// The client is rooted at the URL's origin, so any path works
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Lambda URL %q: %w", rawURL, err)
+	}
+	c, err := lambdaClient(u.Scheme + "://" + u.Host)
+	if err != nil {
+		return nil, err
+	}
+	c.SetMaxAttempts(attempts)
+
+	var payload []byte
+	if body != nil {
+		if payload, err = io.ReadAll(body); err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+
+	resp, err := c.Do(ctx, method, u.RequestURI(), payload, false)
+	if err != nil && ctx.Err() == nil {
+		return nil, enhanceHTTPError(err, rawURL, timeoutFor(method))
+	}
+	return resp, err
+}
+
+// requestPath returns the path of a Lambda URL for logs, without the host
+func requestPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
+
+// enhanceHTTPError adds helpful troubleshooting context to HTTP errors
+func enhanceHTTPError(err error, rawURL string, timeout time.Duration) error {
+	// Client timeouts read "Client.Timeout exceeded", so ask the error rather than its text
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() || strings.Contains(err.Error(), "timeout") {
+		return fmt.Errorf("request timed out after %s\n\nTroubleshooting:\n  - Check your internet connection\n  - Verify TSE_LAMBDA_URL is correct: %s\n  - Lambda might be cold-starting (rare, try again)\n\nOriginal error: %w", timeout, rawURL, err)
+	}
+
+	if strings.Contains(err.Error(), "no such host") || strings.Contains(err.Error(), "connection refused") {
+		return fmt.Errorf("cannot reach Lambda endpoint\n\nTroubleshooting:\n  - Is TSE_LAMBDA_URL set correctly? %s\n  - Did you run 'tse deploy' first?\n  - Check 'tse status' to verify infrastructure exists\n\nOriginal error: %w", rawURL, err)
+	}
+
+	return fmt.Errorf("network error: %w\n\nCheck your internet connection and verify TSE_LAMBDA_URL: %s", err, rawURL)
+}
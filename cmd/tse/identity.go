@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/anoldguy/tse/cmd/tse/infrastructure"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// localIdentity is the AWS account and region the local credentials point at,
+// i.e. where 'tse deploy' would put the Lambda
+type localIdentity struct {
+	AccountID string
+	Region    string
+}
+
+// lookupLocalIdentity asks STS who the local credentials belong to. Without
+// credentials (a client that only has the Lambda URL) it returns an error.
+func lookupLocalIdentity(ctx context.Context) (localIdentity, error) {
+	region, err := infrastructure.GetDefaultRegion(ctx)
+	if err != nil {
+		return localIdentity{}, err
+	}
+	accountID, err := infrastructure.GetAccountID(ctx)
+	if err != nil {
+		return localIdentity{}, err
+	}
+	return localIdentity{AccountID: accountID, Region: region}, nil
+}
+
+// identityMismatches compares the Lambda's reported identity against the local
+// AWS configuration. Fields the Lambda didn't report are skipped.
+func identityMismatches(health types.HealthResponse, local localIdentity) []string {
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	var mismatches []string
+	if health.AccountID != "" && local.AccountID != "" && health.AccountID != local.AccountID {
+		mismatches = append(mismatches, fmt.Sprintf("Lambda is in account %s, but AWS profile %q is account %s", health.AccountID, profile, local.AccountID))
+	}
+	if health.Region != "" && local.Region != "" && health.Region != local.Region {
+		mismatches = append(mismatches, fmt.Sprintf("Lambda runs in %s, but your AWS region is %s", health.Region, local.Region))
+	}
+	if health.Deployment != "" && health.Deployment != infrastructure.FunctionName {
+		mismatches = append(mismatches, fmt.Sprintf("Lambda is %s, not a deployment made by 'tse deploy' (%s)", health.Deployment, infrastructure.FunctionName))
+	}
+	return mismatches
+}
@@ -0,0 +1,178 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+)
+
+// Kinds of adoption steps
+const (
+	AdoptTag           = "tag"            // Add ManagedBy=tse to an existing resource
+	AdoptManagedPolicy = "managed-policy" // Attach AWSLambdaBasicExecutionRole
+	AdoptInlinePolicy  = "inline-policy"  // Replace the inline policy with the current document
+	AdoptLambdaEnv     = "lambda-env"     // Point the Lambda at the state table and instance profile
+	AdoptLogRetention  = "log-retention"  // Set the log group's retention
+)
+
+// AdoptStep is one change that brings existing infrastructure under TSE management
+type AdoptStep struct {
+	Kind        string
+	Resource    string // Display name, as in InfrastructureState.Missing
+	Description string
+}
+
+// isManaged reports whether r carries the ManagedBy=tse tag
+func isManaged(r *Resource) bool {
+	return r != nil && r.Tags["ManagedBy"] == TagManagedBy
+}
+
+// Unmanaged returns the display names of discovered resources missing the
+// ManagedBy=tse tag, e.g. ones created by the old OpenTofu configuration.
+func (s *InfrastructureState) Unmanaged() []string {
+	var names []string
+	for _, r := range []struct {
+		name     string
+		resource *Resource
+	}{
+		{"CloudWatch Log Group", s.LogGroup},
+		{"DynamoDB Table", s.Table},
+		{"IAM Role", s.IAMRole},
+		{"Node Instance Profile", s.NodeProfile},
+		{"Lambda Function", s.Lambda},
+	} {
+		if r.resource != nil && !isManaged(r.resource) {
+			names = append(names, r.name)
+		}
+	}
+	return names
+}
+
+// PlanAdoption lists the steps that bring existing resources under management:
+// tagging anything untagged and reconciling policies and configuration that
+// deploy would otherwise leave alone. Missing resources are not created; that's
+// still deploy's job. Nothing is ever deleted.
+func PlanAdoption(state *InfrastructureState) []AdoptStep {
+	var steps []AdoptStep
+	for _, name := range state.Unmanaged() {
+		steps = append(steps, AdoptStep{Kind: AdoptTag, Resource: name, Description: "tag ManagedBy=" + TagManagedBy})
+	}
+
+	if state.IAMRole == nil {
+		return steps
+	}
+	if !state.Policies.Managed {
+		steps = append(steps, AdoptStep{Kind: AdoptManagedPolicy, Resource: "Managed Policy Attachment", Description: "attach AWSLambdaBasicExecutionRole"})
+	}
+
+	for _, drift := range DetectDrift(state) {
+		switch {
+		case drift.Resource == "Inline Policy":
+			description := "replace with the current policy document"
+			if drift.Missing {
+				description = "create " + InlinePolicyName
+			}
+			steps = append(steps, AdoptStep{Kind: AdoptInlinePolicy, Resource: drift.Resource, Description: description})
+		case drift.Resource == "Lambda Function" && drift.Field == "environment variables" && addsResourceEnv(drift.Lines):
+			steps = append(steps, AdoptStep{Kind: AdoptLambdaEnv, Resource: drift.Resource, Description: "add missing environment variables (others are kept)"})
+		case drift.Resource == "CloudWatch Log Group" && drift.Field == "retention":
+			steps = append(steps, AdoptStep{Kind: AdoptLogRetention, Resource: drift.Resource, Description: fmt.Sprintf("set retention to %d days", LogRetentionDays)})
+		}
+	}
+
+	return steps
+}
+
+// addsResourceEnv reports whether an environment variable diff adds any of the
+// resource variables ensureLambdaEnv can set. Secrets like TSE_AUTH_TOKEN only
+// come from a redeploy.
+func addsResourceEnv(lines []DiffLine) bool {
+	resources := resourceEnvironment()
+	for _, line := range lines {
+		if _, ok := resources[line.Text]; ok && line.Op == DiffAdd {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyAdoptStep makes one adoption change
+func ApplyAdoptStep(ctx context.Context, clients *AWSClients, state *InfrastructureState, step AdoptStep) error {
+	switch step.Kind {
+	case AdoptTag:
+		return tagExisting(ctx, clients, state, step.Resource)
+	case AdoptManagedPolicy:
+		return attachManagedPolicy(ctx, clients, RoleName)
+	case AdoptInlinePolicy:
+		return createInlinePolicy(ctx, clients, RoleName)
+	case AdoptLambdaEnv:
+		return ensureLambdaEnv(ctx, clients, FunctionName)
+	case AdoptLogRetention:
+		_, err := clients.Logs.PutRetentionPolicy(ctx, &cloudwatchlogs.PutRetentionPolicyInput{
+			LogGroupName:    aws.String(LogGroupName),
+			RetentionInDays: aws.Int32(LogRetentionDays),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set log retention: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown adoption step %q", step.Kind)
+	}
+}
+
+// tagExisting adds the standard tags to an existing resource
+func tagExisting(ctx context.Context, clients *AWSClients, state *InfrastructureState, resource string) error {
+	var iamTags []iamtypes.Tag
+	for k, v := range standardTags() {
+		iamTags = append(iamTags, iamtypes.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+
+	var err error
+	switch resource {
+	case "CloudWatch Log Group":
+		// Describe returns the ARN with a trailing :* that TagResource rejects
+		_, err = clients.Logs.TagResource(ctx, &cloudwatchlogs.TagResourceInput{
+			ResourceArn: aws.String(strings.TrimSuffix(state.LogGroup.ARN, ":*")),
+			Tags:        standardTags(),
+		})
+	case "DynamoDB Table":
+		var ddbTags []ddbtypes.Tag
+		for k, v := range standardTags() {
+			ddbTags = append(ddbTags, ddbtypes.Tag{Key: aws.String(k), Value: aws.String(v)})
+		}
+		_, err = clients.DynamoDB.TagResource(ctx, &dynamodb.TagResourceInput{
+			ResourceArn: aws.String(state.Table.ARN),
+			Tags:        ddbTags,
+		})
+	case "IAM Role":
+		_, err = clients.IAM.TagRole(ctx, &iam.TagRoleInput{
+			RoleName: aws.String(state.IAMRole.Name),
+			Tags:     iamTags,
+		})
+	case "Node Instance Profile":
+		_, err = clients.IAM.TagInstanceProfile(ctx, &iam.TagInstanceProfileInput{
+			InstanceProfileName: aws.String(state.NodeProfile.Name),
+			Tags:                iamTags,
+		})
+	case "Lambda Function":
+		_, err = clients.Lambda.TagResource(ctx, &lambda.TagResourceInput{
+			Resource: aws.String(state.Lambda.ARN),
+			Tags:     standardTags(),
+		})
+	default:
+		return fmt.Errorf("don't know how to tag %s", resource)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to tag %s: %w", resource, err)
+	}
+	return nil
+}
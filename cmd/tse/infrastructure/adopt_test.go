@@ -0,0 +1,73 @@
+package infrastructure
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// managedState returns deployedState with every resource tagged
+func managedState() *InfrastructureState {
+	state := deployedState()
+	for _, r := range []*Resource{state.LogGroup, state.Table, state.IAMRole, state.NodeProfile, state.Lambda} {
+		r.Tags = standardTags()
+	}
+	return state
+}
+
+func TestPlanAdoptionNothingToDo(t *testing.T) {
+	clearDeployEnv(t)
+	if steps := PlanAdoption(managedState()); len(steps) != 0 {
+		t.Errorf("want no steps, got %+v", steps)
+	}
+}
+
+func TestPlanAdoption(t *testing.T) {
+	clearDeployEnv(t)
+	state := managedState()
+	state.LogGroup.Tags = map[string]string{"ManagedBy": "terraform"}
+	state.IAMRole.Tags = nil
+	state.Table = nil // Missing resources are left to deploy
+	state.Policies.Managed = false
+	state.Policies.InlineDocument = strings.Replace(inlinePolicyDocument(), `"ec2:RunInstances",`, "", 1)
+	state.Config.LambdaEnvKeys = []string{"TAILSCALE_AUTH_KEY", "TSE_AUTH_TOKEN", "TSE_TABLE_NAME"}
+	state.Config.LogRetentionDays = 0
+	state.Config.LambdaMemoryMB = 128 // Not something adopt changes
+
+	var got []string
+	for _, step := range PlanAdoption(state) {
+		got = append(got, step.Kind+" "+step.Resource)
+	}
+	want := []string{
+		"tag CloudWatch Log Group",
+		"tag IAM Role",
+		"managed-policy Managed Policy Attachment",
+		"inline-policy Inline Policy",
+		"lambda-env Lambda Function",
+		"log-retention CloudWatch Log Group",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("steps =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestPlanAdoptionSecretsNeedRedeploy(t *testing.T) {
+	clearDeployEnv(t)
+	state := managedState()
+	// Only deploy knows the auth key and token, so adopt can't fill them in
+	state.Config.LambdaEnvKeys = []string{"TSE_INSTANCE_PROFILE", "TSE_LAUNCH_TEMPLATE", "TSE_TABLE_NAME"}
+
+	if steps := PlanAdoption(state); len(steps) != 0 {
+		t.Errorf("want no steps, got %+v", steps)
+	}
+}
+
+func TestUnmanaged(t *testing.T) {
+	state := managedState()
+	state.NodeProfile.Tags = map[string]string{}
+	state.Lambda = nil
+
+	if got := fmt.Sprint(state.Unmanaged()); got != "[Node Instance Profile]" {
+		t.Errorf("Unmanaged() = %s", got)
+	}
+}
@@ -0,0 +1,301 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+)
+
+const (
+	// The schedule has the Lambda publish OldestNodeAge; the alarm period matches it
+	metricsSchedule      = "rate(15 minutes)"
+	metricsPeriodSeconds = 900
+	scheduleStatementID  = "tailscale-exits-metrics-schedule"
+	scheduleTargetID     = "tailscale-exits-lambda"
+	metricsNamespace     = "TSE"
+	nodeAgeMetric        = "OldestNodeAge"
+)
+
+// AlarmHours returns the node age threshold from TSE_ALARM_HOURS, 0 when unset
+func AlarmHours() (int, error) {
+	raw := os.Getenv("TSE_ALARM_HOURS")
+	if raw == "" {
+		return 0, nil
+	}
+	hours, err := strconv.Atoi(raw)
+	if err != nil || hours < 1 {
+		return 0, fmt.Errorf("TSE_ALARM_HOURS must be a whole number of hours, got %q", raw)
+	}
+	return hours, nil
+}
+
+// nodeAgeAlarmSteps are the steps that create (or update) the SNS topic, the
+// alarm on OldestNodeAge, and the schedule that makes the Lambda publish it.
+// Every step is idempotent. lambdaARN is read when the schedule step runs, so
+// an earlier step can fill it in; the topic's ARN is left in topicARN.
+func nodeAgeAlarmSteps(ctx context.Context, clients *AWSClients, lambdaARN *string, hours int, email string, topicARN *string) []ui.Step {
+	return []ui.Step{
+		step("Creating SNS alert topic", func() error {
+			var err error
+			*topicARN, err = createAlarmTopic(ctx, clients, email)
+			return err
+		}),
+		step(fmt.Sprintf("Creating alarm for exit nodes running over %dh", hours), func() error {
+			return putNodeAgeAlarm(ctx, clients, hours, *topicARN)
+		}),
+		step("Scheduling node metrics every 15 minutes", func() error {
+			return createMetricsSchedule(ctx, clients, *lambdaARN)
+		}),
+	}
+}
+
+// printAlarmSubscription tells the user how to start receiving alerts
+func printAlarmSubscription(email, topicARN string) {
+	if email != "" {
+		fmt.Printf("  %s Confirm the subscription email sent to %s to receive alerts\n", ui.Info("→"), ui.Highlight(email))
+	} else {
+		fmt.Printf("  %s Subscribe to %s to receive alerts\n", ui.Info("→"), ui.Highlight(topicARN))
+	}
+	fmt.Println()
+}
+
+// createAlarmTopic creates the SNS topic alarms notify, subscribing email if given.
+// Returns the topic ARN. CreateTopic returns the existing topic if it's already there.
+func createAlarmTopic(ctx context.Context, clients *AWSClients, email string) (string, error) {
+	var tags []snstypes.Tag
+	for _, key := range sortedTagKeys() {
+		tags = append(tags, snstypes.Tag{Key: aws.String(key), Value: aws.String(standardTags()[key])})
+	}
+	created, err := clients.SNS.CreateTopic(ctx, &sns.CreateTopicInput{
+		Name: aws.String(AlarmTopicName),
+		Tags: tags,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create SNS topic: %w", err)
+	}
+	topicARN := aws.ToString(created.TopicArn)
+
+	if email != "" {
+		_, err := clients.SNS.Subscribe(ctx, &sns.SubscribeInput{
+			TopicArn: aws.String(topicARN),
+			Protocol: aws.String("email"),
+			Endpoint: aws.String(email),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to subscribe %s to alerts: %w", email, err)
+		}
+	}
+
+	return topicARN, nil
+}
+
+// nodeAgeAlarmParams builds the PutMetricAlarm request: alarm when the oldest exit
+// node has been running for more than hours, and notify again when it recovers.
+// No data (schedule not running) leaves the alarm alone rather than firing.
+func nodeAgeAlarmParams(hours int, topicARN string) *cloudwatch.PutMetricAlarmInput {
+	var tags []cwtypes.Tag
+	for _, key := range sortedTagKeys() {
+		tags = append(tags, cwtypes.Tag{Key: aws.String(key), Value: aws.String(standardTags()[key])})
+	}
+	return &cloudwatch.PutMetricAlarmInput{
+		AlarmName:          aws.String(AlarmName),
+		AlarmDescription:   aws.String(fmt.Sprintf("An exit node has been running for more than %d hours. Stop it with 'tse shutdown' if it was forgotten.", hours)),
+		Namespace:          aws.String(metricsNamespace),
+		MetricName:         aws.String(nodeAgeMetric),
+		Statistic:          cwtypes.StatisticMaximum,
+		Period:             aws.Int32(metricsPeriodSeconds),
+		EvaluationPeriods:  aws.Int32(1),
+		Threshold:          aws.Float64(float64(hours * 3600)),
+		ComparisonOperator: cwtypes.ComparisonOperatorGreaterThanThreshold,
+		TreatMissingData:   aws.String("notBreaching"),
+		AlarmActions:       []string{topicARN},
+		OKActions:          []string{topicARN},
+		Tags:               tags,
+	}
+}
+
+// putNodeAgeAlarm creates or updates the node age alarm
+func putNodeAgeAlarm(ctx context.Context, clients *AWSClients, hours int, topicARN string) error {
+	if _, err := clients.CloudWatch.PutMetricAlarm(ctx, nodeAgeAlarmParams(hours, topicARN)); err != nil {
+		return fmt.Errorf("failed to create CloudWatch alarm: %w", err)
+	}
+	return nil
+}
+
+// scheduleRule is an EventBridge rule that invokes the Lambda on a schedule
+type scheduleRule struct {
+	Name        string
+	Description string
+	Expression  string
+	StatementID string // Lambda permission that lets the rule invoke it
+	Input       string // Constant payload for the Lambda; empty sends the scheduled event
+	label       string // What the rule is, for errors
+}
+
+// metricsRule has the Lambda run its sweep: node metrics and data transfer caps
+func metricsRule() scheduleRule {
+	return scheduleRule{
+		Name:        ScheduleRuleName,
+		Description: "Has the " + FunctionName + " Lambda publish exit node metrics",
+		Expression:  metricsSchedule,
+		StatementID: scheduleStatementID,
+		label:       "metrics schedule",
+	}
+}
+
+// createMetricsSchedule creates the EventBridge rule that invokes the Lambda's
+// metrics sweep and allows EventBridge to invoke it
+func createMetricsSchedule(ctx context.Context, clients *AWSClients, lambdaARN string) error {
+	return createSchedule(ctx, clients, metricsRule(), lambdaARN)
+}
+
+// createSchedule creates (or updates) rule, allows it to invoke the Lambda and
+// points it at lambdaARN
+func createSchedule(ctx context.Context, clients *AWSClients, rule scheduleRule, lambdaARN string) error {
+	var tags []ebtypes.Tag
+	for _, key := range sortedTagKeys() {
+		tags = append(tags, ebtypes.Tag{Key: aws.String(key), Value: aws.String(standardTags()[key])})
+	}
+
+	created, err := clients.EventBridge.PutRule(ctx, &eventbridge.PutRuleInput{
+		Name:               aws.String(rule.Name),
+		Description:        aws.String(rule.Description),
+		ScheduleExpression: aws.String(rule.Expression),
+		State:              ebtypes.RuleStateEnabled,
+		Tags:               tags,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", rule.label, err)
+	}
+
+	_, err = clients.Lambda.AddPermission(ctx, &lambda.AddPermissionInput{
+		FunctionName: aws.String(FunctionName),
+		StatementId:  aws.String(rule.StatementID),
+		Action:       aws.String("lambda:InvokeFunction"),
+		Principal:    aws.String("events.amazonaws.com"),
+		SourceArn:    created.RuleArn,
+	})
+	var conflict *lambdatypes.ResourceConflictException
+	if err != nil && !errors.As(err, &conflict) {
+		return fmt.Errorf("failed to allow the %s to invoke the Lambda: %w", rule.label, err)
+	}
+
+	target := ebtypes.Target{Id: aws.String(scheduleTargetID), Arn: aws.String(lambdaARN)}
+	if rule.Input != "" {
+		target.Input = aws.String(rule.Input)
+	}
+	targets, err := clients.EventBridge.PutTargets(ctx, &eventbridge.PutTargetsInput{
+		Rule:    aws.String(rule.Name),
+		Targets: []ebtypes.Target{target},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to point the %s at the Lambda: %w", rule.label, err)
+	}
+	if targets.FailedEntryCount > 0 && len(targets.FailedEntries) > 0 {
+		return fmt.Errorf("failed to point the %s at the Lambda: %s", rule.label, aws.ToString(targets.FailedEntries[0].ErrorMessage))
+	}
+
+	return nil
+}
+
+// sortedTagKeys returns the standard tags' keys in order, so requests that
+// carry them are the same on every deploy
+func sortedTagKeys() []string {
+	tags := standardTags()
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// discoverAlarmResources discovers the optional node age alarm, its topic and schedule.
+// They're optional and need permissions the rest of deploy doesn't, so lookup
+// failures are treated as "not deployed".
+func discoverAlarmResources(ctx context.Context, clients *AWSClients, state *InfrastructureState) {
+	described, err := clients.CloudWatch.DescribeAlarms(ctx, &cloudwatch.DescribeAlarmsInput{AlarmNames: []string{AlarmName}})
+	if err == nil && len(described.MetricAlarms) > 0 {
+		alarm := described.MetricAlarms[0]
+		state.Alarm = &Resource{
+			Name: aws.ToString(alarm.AlarmName),
+			ARN:  aws.ToString(alarm.AlarmArn),
+			Tags: map[string]string{"ThresholdHours": strconv.Itoa(int(aws.ToFloat64(alarm.Threshold)) / 3600)},
+		}
+	}
+
+	if rule, err := clients.EventBridge.DescribeRule(ctx, &eventbridge.DescribeRuleInput{Name: aws.String(ScheduleRuleName)}); err == nil {
+		state.Schedule = &Resource{Name: aws.ToString(rule.Name), ARN: aws.ToString(rule.Arn)}
+	}
+
+	paginator := sns.NewListTopicsPaginator(clients.SNS, &sns.ListTopicsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return
+		}
+		for _, topic := range page.Topics {
+			if arn := aws.ToString(topic.TopicArn); strings.HasSuffix(arn, ":"+AlarmTopicName) {
+				state.AlarmTopic = &Resource{Name: AlarmTopicName, ARN: arn}
+				return
+			}
+		}
+	}
+}
+
+// deleteMetricsSchedule removes the schedule's target, then the rule itself
+func deleteMetricsSchedule(ctx context.Context, clients *AWSClients) error {
+	return deleteSchedule(ctx, clients, metricsRule())
+}
+
+// deleteSchedule removes rule's target, then the rule itself. A rule that's
+// already gone isn't an error.
+func deleteSchedule(ctx context.Context, clients *AWSClients, rule scheduleRule) error {
+	var missing *ebtypes.ResourceNotFoundException
+	_, err := clients.EventBridge.RemoveTargets(ctx, &eventbridge.RemoveTargetsInput{
+		Rule: aws.String(rule.Name),
+		Ids:  []string{scheduleTargetID},
+	})
+	if err != nil && !errors.As(err, &missing) {
+		return fmt.Errorf("failed to remove %s target: %w", rule.label, err)
+	}
+
+	_, err = clients.EventBridge.DeleteRule(ctx, &eventbridge.DeleteRuleInput{Name: aws.String(rule.Name)})
+	if err != nil && !errors.As(err, &missing) {
+		return fmt.Errorf("failed to delete %s: %w", rule.label, err)
+	}
+
+	return nil
+}
+
+// deleteNodeAgeAlarm deletes the node age alarm.
+func deleteNodeAgeAlarm(ctx context.Context, clients *AWSClients) error {
+	if _, err := clients.CloudWatch.DeleteAlarms(ctx, &cloudwatch.DeleteAlarmsInput{AlarmNames: []string{AlarmName}}); err != nil {
+		return fmt.Errorf("failed to delete CloudWatch alarm: %w", err)
+	}
+	return nil
+}
+
+// deleteAlarmTopic deletes the SNS alert topic and its subscriptions.
+func deleteAlarmTopic(ctx context.Context, clients *AWSClients, topicARN string) error {
+	if _, err := clients.SNS.DeleteTopic(ctx, &sns.DeleteTopicInput{TopicArn: aws.String(topicARN)}); err != nil {
+		return fmt.Errorf("failed to delete SNS topic: %w", err)
+	}
+	return nil
+}
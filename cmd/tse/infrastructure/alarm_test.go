@@ -0,0 +1,70 @@
+package infrastructure
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestNodeAgeAlarmParams(t *testing.T) {
+	topic := "arn:aws:sns:us-east-2:123456789012:tailscale-exits-alerts"
+	params := nodeAgeAlarmParams(8, topic)
+
+	want := map[string]string{
+		"AlarmName":          AlarmName,
+		"Namespace":          "TSE",
+		"MetricName":         "OldestNodeAge",
+		"Statistic":          "Maximum",
+		"Threshold":          "28800",
+		"ComparisonOperator": "GreaterThanThreshold",
+		"TreatMissingData":   "notBreaching",
+		"AlarmActions":       topic,
+		"Tag ManagedBy":      TagManagedBy,
+	}
+	got := map[string]string{
+		"AlarmName":          aws.ToString(params.AlarmName),
+		"Namespace":          aws.ToString(params.Namespace),
+		"MetricName":         aws.ToString(params.MetricName),
+		"Statistic":          string(params.Statistic),
+		"Threshold":          strconv.FormatFloat(aws.ToFloat64(params.Threshold), 'f', -1, 64),
+		"ComparisonOperator": string(params.ComparisonOperator),
+		"TreatMissingData":   aws.ToString(params.TreatMissingData),
+		"AlarmActions":       strings.Join(params.AlarmActions, ","),
+	}
+	for _, tag := range params.Tags {
+		got["Tag "+aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %q, want %q", key, got[key], value)
+		}
+	}
+}
+
+func TestAlarmHours(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    int
+		wantErr bool
+	}{
+		{raw: "", want: 0},
+		{raw: "8", want: 8},
+		{raw: "0", wantErr: true},
+		{raw: "8h", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			t.Setenv("TSE_ALARM_HOURS", tt.raw)
+			got, err := AlarmHours()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AlarmHours() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("AlarmHours() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// lambdaBin holds the prebuilt Lambda bootstrap in release builds (see
+// lambdabin/README.md). Development builds only contain the README.
+//
+//go:embed lambdabin
+var lambdaBin embed.FS
+
+// embeddedBootstrap returns the prebuilt bootstrap, or nil if this build doesn't have one
+func embeddedBootstrap() []byte {
+	bootstrap, err := fs.ReadFile(lambdaBin, "lambdabin/bootstrap")
+	if err != nil {
+		return nil
+	}
+	return bootstrap
+}
+
+// UsesEmbeddedLambda reports whether deploy will use the prebuilt Lambda rather
+// than compiling it: true when one is embedded and neither TSE_BUILD_FROM_SOURCE
+// nor TSE_LAMBDA_SRC is set
+func UsesEmbeddedLambda() bool {
+	return os.Getenv("TSE_BUILD_FROM_SOURCE") == "" && os.Getenv("TSE_LAMBDA_SRC") == "" && embeddedBootstrap() != nil
+}
+
+// modulePath is the module the Lambda source lives in
+const modulePath = "github.com/anoldguy/tse"
+
+// lambdaSourceDir finds the Lambda's source directory to build from:
+// TSE_LAMBDA_SRC if set, otherwise the lambda directory of the tse module
+// enclosing the working directory or, failing that, the tse binary (so
+// ./bin/tse works from anywhere).
+func lambdaSourceDir() (string, error) {
+	if src := os.Getenv("TSE_LAMBDA_SRC"); src != "" {
+		if !isLambdaSource(src) {
+			return "", fmt.Errorf("--lambda-src %s doesn't contain the Lambda source (expected the lambda directory of a tailscale-exits checkout)", src)
+		}
+		return src, nil
+	}
+
+	var starts []string
+	if wd, err := os.Getwd(); err == nil {
+		starts = append(starts, wd)
+	}
+	if exe, err := os.Executable(); err == nil {
+		if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+			exe = resolved
+		}
+		starts = append(starts, filepath.Dir(exe))
+	}
+	for _, start := range starts {
+		if root := findModuleRoot(start); root != "" {
+			return filepath.Join(root, "lambda"), nil
+		}
+	}
+
+	return "", errors.New("can't find the Lambda source to build\n\n" +
+		"This tse binary doesn't include a prebuilt Lambda, and neither the current\n" +
+		"directory nor the binary's is inside a tailscale-exits checkout. Either:\n" +
+		"  - run 'tse deploy' from inside the checkout\n" +
+		"  - pass --lambda-src <checkout>/lambda\n" +
+		"  - use a release binary, which has the Lambda built in")
+}
+
+// findModuleRoot walks up from dir to the tse module root: the nearest directory
+// whose go.mod declares modulePath and that has the Lambda source. Returns "" if
+// there isn't one.
+func findModuleRoot(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		if data, err := os.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+			if moduleName(data) == modulePath && isLambdaSource(filepath.Join(dir, "lambda")) {
+				return dir
+			}
+			// Another module (or a nested one); keep looking above it
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// moduleName returns the module path declared in a go.mod file
+func moduleName(gomod []byte) string {
+	for _, line := range strings.Split(string(gomod), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// isLambdaSource reports whether dir looks like the Lambda's main package
+func isLambdaSource(dir string) bool {
+	data, err := os.ReadFile(filepath.Join(dir, "main.go"))
+	return err == nil && strings.Contains(string(data), "lambda.Start(")
+}
+
+// lambdaZip returns the deployment zip, from the embedded bootstrap when there
+// is one and compiled from source otherwise
+func lambdaZip(ctx context.Context) ([]byte, error) {
+	if !UsesEmbeddedLambda() {
+		return buildLambdaZip(ctx)
+	}
+	bootstrap := embeddedBootstrap()
+	if err := checkBootstrap(bootstrap); err != nil {
+		return nil, fmt.Errorf("embedded Lambda is unusable (%w); redeploy with --build-from-source", err)
+	}
+	return zipBootstrap(bootstrap)
+}
+
+// checkBootstrap makes sure a bootstrap binary will run on Lambda's linux/arm64
+func checkBootstrap(bootstrap []byte) error {
+	f, err := elf.NewFile(bytes.NewReader(bootstrap))
+	if err != nil {
+		return fmt.Errorf("not a Linux executable: %w", err)
+	}
+	defer f.Close()
+	if f.Class != elf.ELFCLASS64 || f.Machine != elf.EM_AARCH64 {
+		return errors.New("built for " + f.Machine.String() + ", not arm64")
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package infrastructure
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// elfHeader returns a minimal 64-bit little-endian ELF header for machine
+func elfHeader(t *testing.T, machine elf.Machine) []byte {
+	t.Helper()
+	header := elf.Header64{
+		Type:    uint16(elf.ET_EXEC),
+		Machine: uint16(machine),
+		Version: uint32(elf.EV_CURRENT),
+		Ehsize:  64,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCheckBootstrap(t *testing.T) {
+	if err := checkBootstrap(elfHeader(t, elf.EM_AARCH64)); err != nil {
+		t.Errorf("arm64 binary rejected: %v", err)
+	}
+	if err := checkBootstrap(elfHeader(t, elf.EM_X86_64)); err == nil {
+		t.Error("amd64 binary should be rejected")
+	}
+	if err := checkBootstrap([]byte("#!/bin/sh\n")); err == nil {
+		t.Error("non-ELF file should be rejected")
+	}
+}
+
+func TestZipBootstrap(t *testing.T) {
+	bootstrap := elfHeader(t, elf.EM_AARCH64)
+	zipBytes, err := zipBootstrap(bootstrap)
+	if err != nil {
+		t.Fatalf("zipBootstrap: %v", err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		t.Fatalf("reading zip: %v", err)
+	}
+	if len(r.File) != 1 || r.File[0].Name != "bootstrap" {
+		t.Fatalf("zip should contain only bootstrap, got %d files", len(r.File))
+	}
+	if mode := r.File[0].Mode(); mode.Perm()&0o111 == 0 {
+		t.Errorf("bootstrap mode = %v, want executable", mode)
+	}
+
+	rc, err := r.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, bootstrap) {
+		t.Error("bootstrap contents changed in the zip")
+	}
+}
+
+// writeCheckout creates a minimal checkout of module at dir
+func writeCheckout(t *testing.T, dir, module string) {
+	t.Helper()
+	files := map[string]string{
+		"go.mod":         "module " + module + "\n\ngo 1.24.0\n",
+		"lambda/main.go": "package main\n\nfunc main() { lambda.Start(invoke) }\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFindModuleRoot(t *testing.T) {
+	root := t.TempDir()
+	writeCheckout(t, root, modulePath)
+	// A different module nested inside the checkout shouldn't stop the search
+	nested := filepath.Join(root, "tools", "deep")
+	writeCheckout(t, filepath.Join(root, "tools"), "example.com/tools")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, start := range []string{root, filepath.Join(root, "lambda"), nested} {
+		if got := findModuleRoot(start); got != root {
+			t.Errorf("findModuleRoot(%s) = %q, want %q", start, got, root)
+		}
+	}
+
+	other := t.TempDir()
+	writeCheckout(t, other, "example.com/fork")
+	if got := findModuleRoot(other); got != "" {
+		t.Errorf("findModuleRoot in another module = %q, want none", got)
+	}
+}
+
+func TestLambdaSourceDirExplicit(t *testing.T) {
+	root := t.TempDir()
+	writeCheckout(t, root, modulePath)
+
+	t.Setenv("TSE_LAMBDA_SRC", filepath.Join(root, "lambda"))
+	if got, err := lambdaSourceDir(); err != nil || got != filepath.Join(root, "lambda") {
+		t.Errorf("lambdaSourceDir() = %q, %v", got, err)
+	}
+
+	t.Setenv("TSE_LAMBDA_SRC", root)
+	if _, err := lambdaSourceDir(); err == nil || !strings.Contains(err.Error(), "--lambda-src") {
+		t.Errorf("a directory without the Lambda should be rejected, got %v", err)
+	}
+}
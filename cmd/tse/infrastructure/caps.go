@@ -0,0 +1,81 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+)
+
+// Optional data transfer caps (tse deploy --node-cap/--monthly-cap), in GB. They're
+// passed to the Lambda under the same names and enforced by its scheduled sweep.
+const (
+	EnvNodeCapGB    = "TSE_NODE_CAP_GB"
+	EnvMonthlyCapGB = "TSE_MONTHLY_CAP_GB"
+)
+
+// TransferCapGB parses a cap in GB; "" and 0 mean no cap
+func TransferCapGB(raw string) (float64, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	gb, err := strconv.ParseFloat(raw, 64)
+	if err != nil || gb < 0 {
+		return 0, fmt.Errorf("%q is not a number of GB", raw)
+	}
+	return gb, nil
+}
+
+// EnvMaxNodes caps how many exit nodes the deployment may have at once across
+// every region (tse deploy --max-nodes). The Lambda refuses starts past it.
+const EnvMaxNodes = "TSE_MAX_NODES"
+
+// MaxNodes parses a node cap; "" and 0 mean no cap
+func MaxNodes(raw string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a whole number of nodes", raw)
+	}
+	return n, nil
+}
+
+// transferCapsSet reports whether either cap was given, including 0 to turn one off,
+// so the Lambda's environment has to carry it
+func transferCapsSet() bool {
+	return os.Getenv(EnvNodeCapGB) != "" || os.Getenv(EnvMonthlyCapGB) != ""
+}
+
+// transferCapsEnabled reports whether a cap is set above zero, which needs the
+// scheduled sweep to enforce it
+func transferCapsEnabled() bool {
+	for _, key := range []string{EnvNodeCapGB, EnvMonthlyCapGB} {
+		if gb, err := TransferCapGB(os.Getenv(key)); err == nil && gb > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sweepNeeded reports whether the Lambda needs its scheduled sweep even without
+// the node age alarm: to enforce a data transfer cap, to tell TSE_WEBHOOKS
+// about nodes that never became ready, or to turn off key expiry
+func sweepNeeded() bool {
+	return transferCapsEnabled() || os.Getenv("TSE_WEBHOOKS") != "" || keyExpiryTokenSet()
+}
+
+// metricsScheduleSteps creates the sweep schedule when something needs it and
+// the node age alarm, which would create it too, isn't configured. lambdaARN
+// is read when the step runs.
+func metricsScheduleSteps(ctx context.Context, clients *AWSClients, lambdaARN *string, alarmHours int) []ui.Step {
+	if alarmHours > 0 || !sweepNeeded() {
+		return nil
+	}
+	return []ui.Step{step("Scheduling the Lambda's checks every 15 minutes", func() error {
+		return createMetricsSchedule(ctx, clients, *lambdaARN)
+	})}
+}
@@ -0,0 +1,93 @@
+package infrastructure
+
+import "testing"
+
+func TestTransferCapGB(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    float64
+		wantErr bool
+	}{
+		{raw: "", want: 0},
+		{raw: "0", want: 0},
+		{raw: "50", want: 50},
+		{raw: "0.5", want: 0.5},
+		{raw: "-1", wantErr: true},
+		{raw: "50GB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := TransferCapGB(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TransferCapGB() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("TransferCapGB() = %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransferCapsEnabled(t *testing.T) {
+	t.Setenv(EnvNodeCapGB, "0")
+	t.Setenv(EnvMonthlyCapGB, "")
+	if !transferCapsSet() || transferCapsEnabled() {
+		t.Errorf("a cap of 0: set = %v, enabled = %v; want set but not enabled", transferCapsSet(), transferCapsEnabled())
+	}
+
+	t.Setenv(EnvMonthlyCapGB, "100")
+	if !transferCapsEnabled() {
+		t.Error("transferCapsEnabled() = false with a monthly cap")
+	}
+	if env := resourceEnvironment(); env[EnvNodeCapGB] != "0" || env[EnvMonthlyCapGB] != "100" {
+		t.Errorf("resourceEnvironment() caps = %q, %q; want 0 and 100", env[EnvNodeCapGB], env[EnvMonthlyCapGB])
+	}
+}
+
+func TestSweepNeeded(t *testing.T) {
+	t.Setenv(EnvNodeCapGB, "0")
+	t.Setenv(EnvMonthlyCapGB, "")
+	t.Setenv("TSE_WEBHOOKS", "")
+	t.Setenv(EnvTailscaleAPIToken, "")
+	if sweepNeeded() {
+		t.Error("sweepNeeded() = true with no caps, webhooks or Tailscale API token")
+	}
+
+	t.Setenv(EnvTailscaleAPIToken, "tskey-api-test")
+	if !sweepNeeded() {
+		t.Error("sweepNeeded() = false with a Tailscale API token, which the sweep disables key expiry with")
+	}
+	t.Setenv(EnvTailscaleAPIToken, "")
+
+	t.Setenv("TSE_WEBHOOKS", "https://ntfy.sh/my-exit-nodes")
+	if !sweepNeeded() {
+		t.Error("sweepNeeded() = false with webhooks, which stalled nodes are reported to")
+	}
+}
+
+func TestMaxNodes(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    int
+		wantErr bool
+	}{
+		{raw: "", want: 0},
+		{raw: "0", want: 0},
+		{raw: "3", want: 3},
+		{raw: "-1", wantErr: true},
+		{raw: "1.5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := MaxNodes(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MaxNodes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("MaxNodes() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
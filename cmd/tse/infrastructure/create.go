@@ -4,15 +4,20 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/telegram"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
@@ -34,20 +39,41 @@ var iamPropagationMessages = []string{
 	"IAM propagation: the buffering icon of cloud infrastructure",
 }
 
-// standardTags returns the standard tag for TSE resources.
+// LogRetentionDays is the log group's desired retention. Deploy creates it with
+// this and Plan reports a log group that has drifted from it, as it does for
+// the Lambda's size (LambdaSize).
+const LogRetentionDays = 14
+
+// functionURLCors returns the CORS configuration for the function URL
+func functionURLCors() *lambdatypes.Cors {
+	return &lambdatypes.Cors{
+		AllowCredentials: aws.Bool(false),
+		AllowOrigins:     []string{"*"},
+		AllowMethods:     []string{"GET", "POST", "DELETE"},
+		AllowHeaders:     []string{"date", "keep-alive", "content-type", "authorization"},
+		ExposeHeaders:    []string{"date", "keep-alive"},
+		MaxAge:           aws.Int32(86400),
+	}
+}
+
+// standardTags returns the standard tags for TSE resources: ManagedBy, the
+// deployment ID once deploy has resolved one, and a custom name prefix.
 func standardTags() map[string]string {
-	return map[string]string{
+	tags := map[string]string{
 		"ManagedBy": TagManagedBy,
 	}
+	if id := os.Getenv(EnvDeploymentID); id != "" {
+		tags[TagDeployment] = id
+	}
+	if CustomNamePrefix() {
+		tags[TagNamePrefix] = NamePrefix()
+	}
+	return tags
 }
 
 // buildLambdaZip compiles the Lambda function for linux/arm64 and creates a deployment zip.
 // Returns the zip file bytes.
-// Assumes current working directory is the project root.
-func buildLambdaZip() ([]byte, error) {
-	// Lambda directory relative to current working directory (project root)
-	lambdaDir := "lambda"
-
+func buildLambdaZip(ctx context.Context) ([]byte, error) {
 	// Create a temporary directory for the build
 	tmpDir, err := os.MkdirTemp("", "tse-lambda-build-*")
 	if err != nil {
@@ -58,35 +84,57 @@ func buildLambdaZip() ([]byte, error) {
 	bootstrapPath := filepath.Join(tmpDir, "bootstrap")
 
 	// Compile the Lambda function for linux/arm64
-	cmd := exec.Command("go", "build", "-o", bootstrapPath, ".")
+	if err := compileLambda(ctx, bootstrapPath, "linux", "arm64"); err != nil {
+		return nil, err
+	}
+
+	bootstrap, err := os.ReadFile(bootstrapPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bootstrap binary: %w", err)
+	}
+
+	return zipBootstrap(bootstrap)
+}
+
+// compileLambda builds the Lambda from source for goos/goarch into out
+func compileLambda(ctx context.Context, out, goos, goarch string) error {
+	lambdaDir, err := lambdaSourceDir()
+	if err != nil {
+		return err
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		return fmt.Errorf("building the Lambda from source needs Go (https://go.dev/dl), or use a release binary, which has it built in")
+	}
+
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", out, ".")
 	cmd.Dir = lambdaDir
 	cmd.Env = append(os.Environ(),
-		"GOOS=linux",
-		"GOARCH=arm64",
+		"GOOS="+goos,
+		"GOARCH="+goarch,
 		"CGO_ENABLED=0",
 	)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return nil, fmt.Errorf("failed to compile Lambda: %w\nOutput: %s", err, string(output))
+		return fmt.Errorf("failed to compile Lambda: %w\nOutput: %s", err, string(output))
 	}
+	return nil
+}
 
-	// Create zip file in memory
+// zipBootstrap wraps a bootstrap binary in a Lambda deployment zip
+func zipBootstrap(bootstrap []byte) ([]byte, error) {
 	var buf bytes.Buffer
 	zipWriter := zip.NewWriter(&buf)
 
-	// Add bootstrap binary to zip
-	bootstrapFile, err := os.ReadFile(bootstrapPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read bootstrap binary: %w", err)
-	}
-
-	zipFile, err := zipWriter.Create("bootstrap")
+	// Lambda runs bootstrap directly, so it must be executable
+	header := &zip.FileHeader{Name: "bootstrap", Method: zip.Deflate}
+	header.SetMode(0o755)
+	zipFile, err := zipWriter.CreateHeader(header)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create zip entry: %w", err)
 	}
 
-	_, err = zipFile.Write(bootstrapFile)
+	_, err = zipFile.Write(bootstrap)
 	if err != nil {
 		return nil, fmt.Errorf("failed to write to zip: %w", err)
 	}
@@ -123,6 +171,54 @@ func createLogGroup(ctx context.Context, clients *AWSClients, functionName strin
 	return nil
 }
 
+// createTable creates the DynamoDB state table (on-demand billing, pk/sk keys)
+// and waits for it to become active. Items with an expires_at epoch are removed
+// automatically by DynamoDB TTL.
+func createTable(ctx context.Context, clients *AWSClients, tableName string) error {
+	ddbTags := []ddbtypes.Tag{}
+	for k, v := range standardTags() {
+		ddbTags = append(ddbTags, ddbtypes.Tag{
+			Key:   aws.String(k),
+			Value: aws.String(v),
+		})
+	}
+
+	_, err := clients.DynamoDB.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:   aws.String(tableName),
+		BillingMode: ddbtypes.BillingModePayPerRequest,
+		AttributeDefinitions: []ddbtypes.AttributeDefinition{
+			{AttributeName: aws.String("pk"), AttributeType: ddbtypes.ScalarAttributeTypeS},
+			{AttributeName: aws.String("sk"), AttributeType: ddbtypes.ScalarAttributeTypeS},
+		},
+		KeySchema: []ddbtypes.KeySchemaElement{
+			{AttributeName: aws.String("pk"), KeyType: ddbtypes.KeyTypeHash},
+			{AttributeName: aws.String("sk"), KeyType: ddbtypes.KeyTypeRange},
+		},
+		Tags: ddbTags,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create DynamoDB table: %w", err)
+	}
+
+	waiter := dynamodb.NewTableExistsWaiter(clients.DynamoDB)
+	if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)}, 2*time.Minute); err != nil {
+		return fmt.Errorf("DynamoDB table did not become active: %w", err)
+	}
+
+	_, err = clients.DynamoDB.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(tableName),
+		TimeToLiveSpecification: &ddbtypes.TimeToLiveSpecification{
+			AttributeName: aws.String("expires_at"),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable table TTL: %w", err)
+	}
+
+	return nil
+}
+
 // createIAMRole creates the IAM role for Lambda execution.
 // Returns the role ARN.
 func createIAMRole(ctx context.Context, clients *AWSClients, roleName string) (string, error) {
@@ -161,6 +257,95 @@ func createIAMRole(ctx context.Context, clients *AWSClients, roleName string) (s
 	return *result.Role.Arn, nil
 }
 
+// nodeTagPolicyDocument lets an exit node tag only itself, and only with tse:* tags.
+func nodeTagPolicyDocument() string {
+	return `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{
+				"Effect": "Allow",
+				"Action": "ec2:CreateTags",
+				"Resource": "arn:aws:ec2:*:*:instance/*",
+				"Condition": {
+					"StringEquals": {
+						"aws:ARN": "${ec2:SourceInstanceARN}"
+					},
+					"ForAllValues:StringLike": {
+						"aws:TagKeys": ["tse:*"]
+					}
+				}
+			}
+		]
+	}`
+}
+
+// createNodeInstanceProfile creates the role and instance profile exit nodes launch with,
+// so the user data can mark the node ready once Tailscale is up.
+// Safe to re-run: pieces that already exist are left alone.
+func createNodeInstanceProfile(ctx context.Context, clients *AWSClients) error {
+	// EC2 assume role policy
+	assumeRolePolicy := `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{
+				"Effect": "Allow",
+				"Principal": {
+					"Service": "ec2.amazonaws.com"
+				},
+				"Action": "sts:AssumeRole"
+			}
+		]
+	}`
+
+	iamTags := []iamtypes.Tag{}
+	for k, v := range standardTags() {
+		iamTags = append(iamTags, iamtypes.Tag{
+			Key:   aws.String(k),
+			Value: aws.String(v),
+		})
+	}
+
+	var exists *iamtypes.EntityAlreadyExistsException
+
+	_, err := clients.IAM.CreateRole(ctx, &iam.CreateRoleInput{
+		RoleName:                 aws.String(NodeRoleName),
+		AssumeRolePolicyDocument: aws.String(assumeRolePolicy),
+		Tags:                     iamTags,
+	})
+	if err != nil && !errors.As(err, &exists) {
+		return fmt.Errorf("failed to create exit node role: %w", err)
+	}
+
+	_, err = clients.IAM.PutRolePolicy(ctx, &iam.PutRolePolicyInput{
+		RoleName:       aws.String(NodeRoleName),
+		PolicyName:     aws.String(NodePolicyName),
+		PolicyDocument: aws.String(nodeTagPolicyDocument()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create exit node policy: %w", err)
+	}
+
+	_, err = clients.IAM.CreateInstanceProfile(ctx, &iam.CreateInstanceProfileInput{
+		InstanceProfileName: aws.String(NodeInstanceProfileName),
+		Tags:                iamTags,
+	})
+	if err != nil && !errors.As(err, &exists) {
+		return fmt.Errorf("failed to create instance profile: %w", err)
+	}
+
+	// A profile holds at most one role; LimitExceeded means ours is already attached
+	var full *iamtypes.LimitExceededException
+	_, err = clients.IAM.AddRoleToInstanceProfile(ctx, &iam.AddRoleToInstanceProfileInput{
+		InstanceProfileName: aws.String(NodeInstanceProfileName),
+		RoleName:            aws.String(NodeRoleName),
+	})
+	if err != nil && !errors.As(err, &full) {
+		return fmt.Errorf("failed to add role to instance profile: %w", err)
+	}
+
+	return nil
+}
+
 // attachManagedPolicy attaches the AWSLambdaBasicExecutionRole managed policy to the role.
 func attachManagedPolicy(ctx context.Context, clients *AWSClients, roleName string) error {
 	_, err := clients.IAM.AttachRolePolicy(ctx, &iam.AttachRolePolicyInput{
@@ -174,8 +359,10 @@ func attachManagedPolicy(ctx context.Context, clients *AWSClients, roleName stri
 	return nil
 }
 
-// createInlinePolicy creates the inline policy for EC2/VPC permissions.
-func createInlinePolicy(ctx context.Context, clients *AWSClients, roleName string) error {
+// inlinePolicyDocument returns the inline policy granting the Lambda its EC2/VPC,
+// CloudWatch metric reads (data transfer per node) and state table permissions, plus passing the exit node role to instances
+// and invoking itself (to carry out async jobs).
+func inlinePolicyDocument() string {
 	// EC2/VPC policy document
 	policyDocument := `{
 		"Version": "2012-10-17",
@@ -185,9 +372,14 @@ func createInlinePolicy(ctx context.Context, clients *AWSClients, roleName strin
 				"Action": [
 					"ec2:RunInstances",
 					"ec2:TerminateInstances",
+					"ec2:StopInstances",
+					"ec2:StartInstances",
 					"ec2:DescribeInstances",
 					"ec2:DescribeInstanceStatus",
 					"ec2:DescribeImages",
+					"ec2:DescribeLaunchTemplates",
+					"ec2:DescribeLaunchTemplateVersions",
+					"ec2:DescribeVolumes",
 					"ec2:CreateSecurityGroup",
 					"ec2:DeleteSecurityGroup",
 					"ec2:DescribeSecurityGroups",
@@ -201,6 +393,8 @@ func createInlinePolicy(ctx context.Context, clients *AWSClients, roleName strin
 					"ec2:CreateSubnet",
 					"ec2:ModifySubnetAttribute",
 					"ec2:DescribeAvailabilityZones",
+					"ec2:DescribeRegions",
+					"ec2:DescribeInstanceTypeOfferings",
 					"ec2:DescribeRouteTables",
 					"ec2:CreateRoute",
 					"ec2:DescribeInternetGateways",
@@ -212,7 +406,12 @@ func createInlinePolicy(ctx context.Context, clients *AWSClients, roleName strin
 					"ec2:DeleteVpc",
 					"ec2:DeleteRoute",
 					"ec2:CreateTags",
-					"ec2:DescribeTags"
+					"ec2:DeleteTags",
+					"ec2:DescribeTags",
+					"ec2:DescribeCapacityReservations",
+					"ec2:CreateCapacityReservation",
+					"ec2:CancelCapacityReservation",
+					"cloudwatch:GetMetricStatistics"
 				],
 				"Resource": "*"
 			},
@@ -226,14 +425,60 @@ func createInlinePolicy(ctx context.Context, clients *AWSClients, roleName strin
 					"arn:aws:ssm:*:*:parameter/aws/service/ami-amazon-linux-latest/*",
 					"arn:aws:ssm:*:*:parameter/aws/service/canonical/ubuntu/server/*"
 				]
-			}
+			},
+			{
+				"Effect": "Allow",
+				"Action": [
+					"dynamodb:GetItem",
+					"dynamodb:PutItem",
+					"dynamodb:UpdateItem",
+					"dynamodb:DeleteItem",
+					"dynamodb:Query"
+				],
+				"Resource": "arn:aws:dynamodb:*:*:table/%s"
+			},
+			{
+				"Effect": "Allow",
+				"Action": "lambda:InvokeFunction",
+				"Resource": "arn:aws:lambda:*:*:function:%s"
+			},
+			{
+				"Effect": "Allow",
+				"Action": "states:StartExecution",
+				"Resource": "arn:aws:states:*:*:stateMachine:%s"
+			},
+			{
+				"Effect": "Allow",
+				"Action": "iam:PassRole",
+				"Resource": "arn:aws:iam::*:role/%s",
+				"Condition": {
+					"StringEquals": {
+						"iam:PassedToService": "ec2.amazonaws.com"
+					}
+				}
+			}%s
 		]
 	}`
 
+	// Cross-account mode: the Lambda assumes TSE_ROLE_ARN before touching EC2
+	assumeRoleStatement := ""
+	if targetRoleARN := os.Getenv("TSE_ROLE_ARN"); targetRoleARN != "" {
+		assumeRoleStatement = fmt.Sprintf(`,
+			{
+				"Effect": "Allow",
+				"Action": "sts:AssumeRole",
+				"Resource": %q
+			}`, targetRoleARN)
+	}
+	return fmt.Sprintf(policyDocument, TableName, FunctionName, WorkflowName, NodeRoleName, assumeRoleStatement)
+}
+
+// createInlinePolicy creates the inline policy for EC2/VPC permissions.
+func createInlinePolicy(ctx context.Context, clients *AWSClients, roleName string) error {
 	_, err := clients.IAM.PutRolePolicy(ctx, &iam.PutRolePolicyInput{
 		RoleName:       aws.String(roleName),
 		PolicyName:     aws.String(InlinePolicyName),
-		PolicyDocument: aws.String(policyDocument),
+		PolicyDocument: aws.String(inlinePolicyDocument()),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create inline policy: %w", err)
@@ -245,6 +490,11 @@ func createInlinePolicy(ctx context.Context, clients *AWSClients, roleName strin
 // createLambdaFunction creates the Lambda function with the provided configuration.
 // Returns the function ARN.
 func createLambdaFunction(ctx context.Context, clients *AWSClients, functionName string, roleARN string, zipBytes []byte, tailscaleAuthKey string, tseAuthToken string) (string, error) {
+	memoryMB, timeoutSeconds, err := LambdaSize()
+	if err != nil {
+		return "", err
+	}
+
 	// Convert tags to Lambda tag format
 	lambdaTags := standardTags()
 
@@ -257,13 +507,10 @@ func createLambdaFunction(ctx context.Context, clients *AWSClients, functionName
 			ZipFile: zipBytes,
 		},
 		Architectures: []lambdatypes.Architecture{lambdatypes.ArchitectureArm64},
-		MemorySize:    aws.Int32(256),
-		Timeout:       aws.Int32(60),
+		MemorySize:    aws.Int32(memoryMB),
+		Timeout:       aws.Int32(timeoutSeconds),
 		Environment: &lambdatypes.Environment{
-			Variables: map[string]string{
-				"TAILSCALE_AUTH_KEY": tailscaleAuthKey,
-				"TSE_AUTH_TOKEN":     tseAuthToken,
-			},
+			Variables: lambdaEnvironment(tailscaleAuthKey, tseAuthToken),
 		},
 		Tags: lambdaTags,
 	})
@@ -274,6 +521,119 @@ func createLambdaFunction(ctx context.Context, clients *AWSClients, functionName
 	return *result.FunctionArn, nil
 }
 
+// lambdaEnvironment builds the Lambda's environment variables.
+// TSE_ROLE_ARN / TSE_ROLE_EXTERNAL_ID (optional) become ROLE_ARN / ROLE_EXTERNAL_ID,
+// which make the Lambda assume a role in another account for all EC2 operations.
+// TSE_WEBHOOKS (optional) is passed through for lifecycle notifications.
+func lambdaEnvironment(tailscaleAuthKey, tseAuthToken string) map[string]string {
+	env := resourceEnvironment()
+	env["TAILSCALE_AUTH_KEY"] = tailscaleAuthKey
+	env["TSE_AUTH_TOKEN"] = tseAuthToken
+	if roleARN := os.Getenv("TSE_ROLE_ARN"); roleARN != "" {
+		env["ROLE_ARN"] = roleARN
+	}
+	if externalID := os.Getenv("TSE_ROLE_EXTERNAL_ID"); externalID != "" {
+		env["ROLE_EXTERNAL_ID"] = externalID
+	}
+	if webhooks := os.Getenv("TSE_WEBHOOKS"); webhooks != "" {
+		env["TSE_WEBHOOKS"] = webhooks
+	}
+	return env
+}
+
+// resourceEnvironment returns the environment variables that point the Lambda at
+// infrastructure created by deploy, plus the security baseline, custom regions,
+// data transfer caps and Tailscale API token if any were chosen.
+// Our instance profile and launch templates only exist in this account, so in
+// cross-account mode TSE_NODE_INSTANCE_PROFILE names a profile in the target
+// account and nodes launch without a template.
+func resourceEnvironment() map[string]string {
+	env := map[string]string{
+		"TSE_TABLE_NAME":       TableName,
+		"TSE_INSTANCE_PROFILE": NodeInstanceProfileName,
+		EnvLaunchTemplate:      LaunchTemplateName,
+	}
+	if os.Getenv("TSE_ROLE_ARN") != "" {
+		delete(env, EnvLaunchTemplate)
+		delete(env, "TSE_INSTANCE_PROFILE")
+		if profile := os.Getenv("TSE_NODE_INSTANCE_PROFILE"); profile != "" {
+			env["TSE_INSTANCE_PROFILE"] = profile
+		}
+	}
+	if baseline := os.Getenv("TSE_SECURITY_BASELINE"); baseline != "" {
+		env["TSE_SECURITY_BASELINE"] = baseline
+	}
+	for _, key := range []string{EnvDeploymentID, EnvReadToken, telegram.EnvBotToken, telegram.EnvChatIDs, regions.EnvCustomRegions, regions.EnvOnlyRegions, EnvNodeCapGB, EnvMonthlyCapGB, EnvMaxNodes, EnvTailscaleAPIToken, EnvOrchestration} {
+		if value := os.Getenv(key); value != "" {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+// ensureLambdaEnv points an existing Lambda (deployed before newer infrastructure
+// existed) at it, keeping its other environment variables as they are.
+func ensureLambdaEnv(ctx context.Context, clients *AWSClients, functionName string) error {
+	return updateLambdaConfig(ctx, clients, functionName, false)
+}
+
+// ensureLambdaConfig is ensureLambdaEnv that also resizes the Lambda to the
+// configured memory and timeout, in the same update: Lambda refuses a second
+// update while the first is still being applied.
+func ensureLambdaConfig(ctx context.Context, clients *AWSClients, functionName string) error {
+	return updateLambdaConfig(ctx, clients, functionName, true)
+}
+
+// updateLambdaConfig updates the Lambda's environment, and its size if resize
+// is set, skipping the update when nothing changed
+func updateLambdaConfig(ctx context.Context, clients *AWSClients, functionName string, resize bool) error {
+	current, err := clients.Lambda.GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(functionName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read Lambda configuration: %w", err)
+	}
+
+	env := map[string]string{}
+	if current.Environment != nil {
+		for k, v := range current.Environment.Variables {
+			env[k] = v
+		}
+	}
+	changed := false
+	for k, v := range resourceEnvironment() {
+		if env[k] != v {
+			env[k] = v
+			changed = true
+		}
+	}
+	input := &lambda.UpdateFunctionConfigurationInput{
+		FunctionName: aws.String(functionName),
+		Environment:  &lambdatypes.Environment{Variables: env},
+	}
+	if resize {
+		memoryMB, timeoutSeconds, err := LambdaSize()
+		if err != nil {
+			return err
+		}
+		if aws.ToInt32(current.MemorySize) != memoryMB || aws.ToInt32(current.Timeout) != timeoutSeconds {
+			input.MemorySize = aws.Int32(memoryMB)
+			input.Timeout = aws.Int32(timeoutSeconds)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	_, err = clients.Lambda.UpdateFunctionConfiguration(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to update Lambda configuration: %w", err)
+	}
+
+	return nil
+}
+
 // isIAMPropagationError checks if an error is due to IAM eventual consistency.
 // Returns true if the error indicates the role cannot be assumed yet.
 func isIAMPropagationError(err error) bool {
@@ -286,61 +646,42 @@ func isIAMPropagationError(err error) bool {
 		strings.Contains(errMsg, "cannot be assumed")
 }
 
-// createLambdaFunctionWithRetry creates the Lambda function, retrying on IAM propagation errors.
-// Shows rotating snarky messages if we hit propagation delays.
-// Handles its own UI - starts with regular spinner, switches to rotating messages if needed.
-// Returns the function ARN.
-func createLambdaFunctionWithRetry(ctx context.Context, clients *AWSClients, functionName string, roleARN string, zipBytes []byte, tailscaleAuthKey string, tseAuthToken string) (string, error) {
-	// Try immediately with a regular spinner
-	var arn string
-	err := ui.WithSpinner("Creating Lambda function", func() error {
-		var err error
-		arn, err = createLambdaFunction(ctx, clients, functionName, roleARN, zipBytes, tailscaleAuthKey, tseAuthToken)
-		return err
-	})
-
-	if err == nil {
-		// Success on first try!
-		return arn, nil
-	}
+// iamPropagationTimeout is how long createLambdaFunctionWithRetry waits for a
+// new role to become assumable, and iamMessageEvery how many one-second retries
+// pass between status messages
+const (
+	iamPropagationTimeout = 2 * time.Minute
+	iamMessageEvery       = 4
+)
 
-	// Check if it's an IAM propagation error
-	if !isIAMPropagationError(err) {
-		// Real error, fail immediately (spinner already showed X)
-		return "", err
+// createLambdaFunctionWithRetry creates the Lambda function, retrying every second
+// on IAM propagation errors. While it waits, it passes rotating snarky messages
+// to status. Returns the function ARN.
+func createLambdaFunctionWithRetry(ctx context.Context, clients *AWSClients, functionName string, roleARN string, zipBytes []byte, tailscaleAuthKey string, tseAuthToken string, status func(string)) (string, error) {
+	arn, err := createLambdaFunction(ctx, clients, functionName, roleARN, zipBytes, tailscaleAuthKey, tseAuthToken)
+	if err == nil || !isIAMPropagationError(err) {
+		return arn, err
 	}
 
-	// IAM propagation error - show rotating messages and retry
-	var finalARN string
-	var finalErr error
-
-	retryErr := ui.WithRotatingMessages(iamPropagationMessages, func() error {
-		arn, err := createLambdaFunction(ctx, clients, functionName, roleARN, zipBytes, tailscaleAuthKey, tseAuthToken)
-		if err == nil {
-			finalARN = arn
-			return nil
+	timeout := time.After(iamPropagationTimeout)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for attempt := 0; ; attempt++ {
+		status(iamPropagationMessages[(attempt/iamMessageEvery)%len(iamPropagationMessages)])
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-timeout:
+			return "", fmt.Errorf("timeout waiting for IAM role %s to propagate", RoleName)
+		case <-ticker.C:
 		}
 
-		// Still failing - check if it's still propagation or a different error
-		if isIAMPropagationError(err) {
-			// Keep retrying
-			return fmt.Errorf("still waiting")
+		arn, err := createLambdaFunction(ctx, clients, functionName, roleARN, zipBytes, tailscaleAuthKey, tseAuthToken)
+		if err == nil || !isIAMPropagationError(err) {
+			return arn, err
 		}
-
-		// Different error, stop retrying
-		finalErr = err
-		return nil
-	})
-
-	if retryErr != nil {
-		return "", retryErr // Timeout
-	}
-
-	if finalErr != nil {
-		return "", finalErr // Real error encountered during retry
 	}
-
-	return finalARN, nil
 }
 
 // createFunctionURL creates a Lambda function URL with CORS configuration.
@@ -349,14 +690,7 @@ func createFunctionURL(ctx context.Context, clients *AWSClients, functionName st
 	result, err := clients.Lambda.CreateFunctionUrlConfig(ctx, &lambda.CreateFunctionUrlConfigInput{
 		FunctionName: aws.String(functionName),
 		AuthType:     lambdatypes.FunctionUrlAuthTypeNone,
-		Cors: &lambdatypes.Cors{
-			AllowCredentials: aws.Bool(false),
-			AllowOrigins:     []string{"*"},
-			AllowMethods:     []string{"GET", "POST", "DELETE"},
-			AllowHeaders:     []string{"date", "keep-alive", "content-type", "authorization"},
-			ExposeHeaders:    []string{"date", "keep-alive"},
-			MaxAge:           aws.Int32(86400),
-		},
+		Cors:         functionURLCors(),
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to create function URL: %w", err)
@@ -0,0 +1,138 @@
+package infrastructure
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestInlinePolicyDocument(t *testing.T) {
+	tests := []struct {
+		name           string
+		roleARN        string
+		wantStatements int
+		wantAssumeRole bool
+	}{
+		{
+			name:           "same account",
+			roleARN:        "",
+			wantStatements: 6,
+			wantAssumeRole: false,
+		},
+		{
+			name:           "cross account role",
+			roleARN:        "arn:aws:iam::123456789012:role/tse-sandbox",
+			wantStatements: 7,
+			wantAssumeRole: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TSE_ROLE_ARN", tt.roleARN)
+
+			doc := inlinePolicyDocument()
+
+			var policy struct {
+				Statement []map[string]interface{}
+			}
+			if err := json.Unmarshal([]byte(doc), &policy); err != nil {
+				t.Fatalf("policy is not valid JSON: %v\n%s", err, doc)
+			}
+
+			if len(policy.Statement) != tt.wantStatements {
+				t.Errorf("got %d statements, want %d", len(policy.Statement), tt.wantStatements)
+			}
+
+			hasAssumeRole := strings.Contains(doc, "sts:AssumeRole")
+			if hasAssumeRole != tt.wantAssumeRole {
+				t.Errorf("sts:AssumeRole present = %v, want %v", hasAssumeRole, tt.wantAssumeRole)
+			}
+			if tt.wantAssumeRole && !strings.Contains(doc, tt.roleARN) {
+				t.Errorf("policy does not reference role %s", tt.roleARN)
+			}
+			if !strings.Contains(doc, "table/"+TableName) {
+				t.Errorf("policy does not grant access to the %s table", TableName)
+			}
+			if !strings.Contains(doc, "function:"+FunctionName) {
+				t.Errorf("policy does not let the Lambda invoke %s for async jobs", FunctionName)
+			}
+			if !strings.Contains(doc, "stateMachine:"+WorkflowName) {
+				t.Errorf("policy does not let the Lambda start %s workflows", WorkflowName)
+			}
+			if !strings.Contains(doc, "role/"+NodeRoleName) {
+				t.Errorf("policy does not allow passing the %s role", NodeRoleName)
+			}
+		})
+	}
+}
+
+func TestLambdaEnvironment(t *testing.T) {
+	t.Setenv("TSE_ROLE_ARN", "")
+	t.Setenv("TSE_ROLE_EXTERNAL_ID", "")
+	t.Setenv("TSE_WEBHOOKS", "")
+	t.Setenv("TSE_SECURITY_BASELINE", "")
+
+	env := lambdaEnvironment("tskey-auth-test", "token")
+	if _, ok := env["ROLE_ARN"]; ok {
+		t.Errorf("ROLE_ARN should not be set without TSE_ROLE_ARN")
+	}
+	if _, ok := env["TSE_WEBHOOKS"]; ok {
+		t.Errorf("TSE_WEBHOOKS should not be set unless configured")
+	}
+	if _, ok := env["TSE_SECURITY_BASELINE"]; ok {
+		t.Errorf("TSE_SECURITY_BASELINE should not be set unless chosen")
+	}
+	if env["TAILSCALE_AUTH_KEY"] != "tskey-auth-test" || env["TSE_AUTH_TOKEN"] != "token" {
+		t.Errorf("unexpected base environment: %v", env)
+	}
+	if env["TSE_TABLE_NAME"] != TableName {
+		t.Errorf("TSE_TABLE_NAME = %q, want %s", env["TSE_TABLE_NAME"], TableName)
+	}
+	if env["TSE_INSTANCE_PROFILE"] != NodeInstanceProfileName {
+		t.Errorf("TSE_INSTANCE_PROFILE = %q, want %s", env["TSE_INSTANCE_PROFILE"], NodeInstanceProfileName)
+	}
+
+	t.Setenv("TSE_ROLE_ARN", "arn:aws:iam::123456789012:role/tse-sandbox")
+	t.Setenv("TSE_ROLE_EXTERNAL_ID", "family")
+	t.Setenv("TSE_WEBHOOKS", "https://ntfy.sh/my-exit-nodes")
+	t.Setenv("TSE_SECURITY_BASELINE", "strict")
+
+	env = lambdaEnvironment("tskey-auth-test", "token")
+	if env["TSE_SECURITY_BASELINE"] != "strict" {
+		t.Errorf("TSE_SECURITY_BASELINE = %q, want strict", env["TSE_SECURITY_BASELINE"])
+	}
+	if env["TSE_WEBHOOKS"] != "https://ntfy.sh/my-exit-nodes" {
+		t.Errorf("TSE_WEBHOOKS = %q, want the configured webhook", env["TSE_WEBHOOKS"])
+	}
+	if env["ROLE_ARN"] != "arn:aws:iam::123456789012:role/tse-sandbox" {
+		t.Errorf("ROLE_ARN = %q, want the configured role", env["ROLE_ARN"])
+	}
+	if env["ROLE_EXTERNAL_ID"] != "family" {
+		t.Errorf("ROLE_EXTERNAL_ID = %q, want family", env["ROLE_EXTERNAL_ID"])
+	}
+	if _, ok := env["TSE_INSTANCE_PROFILE"]; ok {
+		t.Errorf("TSE_INSTANCE_PROFILE should not point at this account's profile in cross-account mode")
+	}
+
+	t.Setenv("TSE_NODE_INSTANCE_PROFILE", "sandbox-exit-node")
+	env = lambdaEnvironment("tskey-auth-test", "token")
+	if env["TSE_INSTANCE_PROFILE"] != "sandbox-exit-node" {
+		t.Errorf("TSE_INSTANCE_PROFILE = %q, want sandbox-exit-node", env["TSE_INSTANCE_PROFILE"])
+	}
+}
+
+func TestNodeTagPolicyDocument(t *testing.T) {
+	var policy struct {
+		Statement []map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(nodeTagPolicyDocument()), &policy); err != nil {
+		t.Fatalf("policy is not valid JSON: %v", err)
+	}
+	if len(policy.Statement) != 1 || policy.Statement[0]["Action"] != "ec2:CreateTags" {
+		t.Errorf("exit nodes should only be allowed ec2:CreateTags, got %v", policy.Statement)
+	}
+	if _, ok := policy.Statement[0]["Condition"]; !ok {
+		t.Errorf("ec2:CreateTags must be restricted to the node itself")
+	}
+}
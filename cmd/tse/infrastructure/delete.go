@@ -6,6 +6,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 )
@@ -86,3 +87,40 @@ func deleteLogGroup(ctx context.Context, clients *AWSClients, logGroupName strin
 
 	return nil
 }
+
+// deleteTable deletes the DynamoDB state table (and every token stored in it).
+func deleteTable(ctx context.Context, clients *AWSClients, tableName string) error {
+	_, err := clients.DynamoDB.DeleteTable(ctx, &dynamodb.DeleteTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete DynamoDB table: %w", err)
+	}
+
+	return nil
+}
+
+// deleteNodeInstanceProfile removes the exit node instance profile and its role.
+// The role must be removed from the profile and its inline policy deleted first.
+func deleteNodeInstanceProfile(ctx context.Context, clients *AWSClients) error {
+	_, err := clients.IAM.RemoveRoleFromInstanceProfile(ctx, &iam.RemoveRoleFromInstanceProfileInput{
+		InstanceProfileName: aws.String(NodeInstanceProfileName),
+		RoleName:            aws.String(NodeRoleName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove role from instance profile: %w", err)
+	}
+
+	_, err = clients.IAM.DeleteInstanceProfile(ctx, &iam.DeleteInstanceProfileInput{
+		InstanceProfileName: aws.String(NodeInstanceProfileName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete instance profile: %w", err)
+	}
+
+	if err := deleteInlinePolicy(ctx, clients, NodeRoleName, NodePolicyName); err != nil {
+		return err
+	}
+
+	return deleteIAMRole(ctx, clients, NodeRoleName)
+}
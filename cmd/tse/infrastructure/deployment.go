@@ -0,0 +1,79 @@
+package infrastructure
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+)
+
+const (
+	// TagDeployment marks the resources one deployment created, so two people
+	// deploying tse into the same account (in different regions) don't list or
+	// clean up each other's exit nodes, or tear down each other's IAM roles
+	TagDeployment = "tse:deployment"
+
+	// EnvDeploymentID pins the deployment ID; deploy generates one otherwise
+	EnvDeploymentID = "TSE_DEPLOYMENT_ID"
+)
+
+// resolveDeploymentID settles on the deployment's ID and exports it, so
+// standardTags and resourceEnvironment carry it: TSE_DEPLOYMENT_ID if set,
+// else the deployed Lambda's, else a new one. A deployed Lambda's ID can't be
+// changed, since the exit nodes and VPCs it created are tagged with it.
+func resolveDeploymentID(state *InfrastructureState) error {
+	id := os.Getenv(EnvDeploymentID)
+	switch {
+	case id != "" && state.DeploymentID != "" && id != state.DeploymentID:
+		return fmt.Errorf("%s is %s, but this deployment's ID is %s\n\nHint: Unset it, or tear down first to redeploy under a new ID",
+			EnvDeploymentID, ui.Highlight(id), ui.Highlight(state.DeploymentID))
+	case id == "" && state.DeploymentID != "":
+		id = state.DeploymentID
+	case id == "":
+		id = generateDeploymentID()
+	}
+	return os.Setenv(EnvDeploymentID, id)
+}
+
+// generateDeploymentID creates a short random deployment ID
+func generateDeploymentID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// deploymentIDMissing reports whether a deployed Lambda predates deployment IDs,
+// so it needs tagging and its environment updating
+func deploymentIDMissing(state *InfrastructureState) bool {
+	return state.Lambda != nil && state.DeploymentID == ""
+}
+
+// tagLambdaDeployment tags a Lambda from before deployment IDs with the
+// resolved one, which later deploys and teardown read back
+func tagLambdaDeployment(ctx context.Context, clients *AWSClients, lambdaARN string) error {
+	_, err := clients.Lambda.TagResource(ctx, &lambda.TagResourceInput{
+		Resource: aws.String(lambdaARN),
+		Tags:     map[string]string{TagDeployment: os.Getenv(EnvDeploymentID)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to tag Lambda with deployment ID: %w", err)
+	}
+	return nil
+}
+
+// tagLambdaCall is tagLambdaDeployment's call
+func tagLambdaCall(lambdaARN string) string {
+	return fmt.Sprintf("lambda:TagResource Resource=%s Tags=%s=%s", lambdaARN, TagDeployment, os.Getenv(EnvDeploymentID))
+}
+
+// ownedBy reports whether a resource belongs to the deployment id. Resources
+// without a deployment tag predate deployment IDs and belong to every deployment.
+func ownedBy(r *Resource, id string) bool {
+	owner := r.Tags[TagDeployment]
+	return owner == "" || id == "" || owner == id
+}
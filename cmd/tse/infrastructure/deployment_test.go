@@ -0,0 +1,113 @@
+package infrastructure
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestResolveDeploymentID(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		deployed string
+		want     string // Empty means a newly generated ID
+		wantErr  bool
+	}{
+		{name: "new deployment"},
+		{name: "redeploy", deployed: "a1b2c3d4", want: "a1b2c3d4"},
+		{name: "pinned", env: "team-a", want: "team-a"},
+		{name: "pinned matches", env: "a1b2c3d4", deployed: "a1b2c3d4", want: "a1b2c3d4"},
+		{name: "pinned differs", env: "team-a", deployed: "a1b2c3d4", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvDeploymentID, tt.env)
+			err := resolveDeploymentID(&InfrastructureState{DeploymentID: tt.deployed})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveDeploymentID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := os.Getenv(EnvDeploymentID)
+			if tt.want != "" && got != tt.want || tt.want == "" && len(got) != 8 {
+				t.Errorf("%s = %q, want %q", EnvDeploymentID, got, tt.want)
+			}
+			if standardTags()[TagDeployment] != got {
+				t.Errorf("standardTags() = %v, want %s=%s", standardTags(), TagDeployment, got)
+			}
+		})
+	}
+}
+
+func TestDeploymentIDUpgrade(t *testing.T) {
+	clearOptionEnv(t)
+	t.Setenv(EnvDeploymentID, "a1b2c3d4")
+	state := deployedState()
+	state.DeploymentID = ""
+	state.Lambda.ARN = "arn:aws:lambda:us-east-2:123456789012:function:tailscale-exits"
+
+	want := []string{"lambda:TagResource", "lambda:UpdateFunctionConfiguration"}
+	if got := actions(SetupCalls(state, 0)); !slices.Equal(got, want) {
+		t.Errorf("SetupCalls() = %v, want %v", got, want)
+	}
+
+	// Plan doesn't resolve the ID, so the deployed one isn't drift
+	state = deployedState()
+	t.Setenv(EnvDeploymentID, "")
+	if drift := DetectDrift(state); drift != nil {
+		t.Errorf("DetectDrift() = %v, want the deployment ID left alone", drift)
+	}
+}
+
+func TestKeepOtherDeployments(t *testing.T) {
+	state := deployedState()
+	state.IAMRole.Tags = map[string]string{TagDeployment: "e5f6a7b8"}
+	state.NodeProfile.Tags = map[string]string{} // From before deployment IDs
+
+	kept := keepOtherDeployments(state, TeardownOptions{})
+	if !slices.Equal(kept, []string{RoleName}) {
+		t.Errorf("kept = %v, want the other deployment's role", kept)
+	}
+	if state.IAMRole != nil || state.Policies.InlineName != "" || state.NodeProfile == nil {
+		t.Errorf("IAM role %v (policy %q), node profile %v: want only the role and its policies kept", state.IAMRole, state.Policies.InlineName, state.NodeProfile)
+	}
+
+	state = deployedState()
+	state.IAMRole.Tags = map[string]string{TagDeployment: "e5f6a7b8"}
+	if kept := keepOtherDeployments(state, TeardownOptions{AllDeployments: true}); kept != nil || state.IAMRole == nil {
+		t.Errorf("kept = %v with --all-deployments, want nothing", kept)
+	}
+}
+
+func TestDeleteLaunchTemplateOwnership(t *testing.T) {
+	tests := []struct {
+		name       string
+		owner      string
+		deployment string
+		want       []string
+	}{
+		{name: "own", owner: "a1b2c3d4", deployment: "a1b2c3d4", want: []string{"DescribeLaunchTemplates", "DeleteLaunchTemplate"}},
+		{name: "other deployment's", owner: "e5f6a7b8", deployment: "a1b2c3d4", want: []string{"DescribeLaunchTemplates"}},
+		{name: "all deployments", owner: "e5f6a7b8", want: []string{"DescribeLaunchTemplates", "DeleteLaunchTemplate"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeEC2{version: launchTemplateVersion(), owner: tt.owner}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			if err := deleteLaunchTemplate(context.Background(), testEC2(server), tt.deployment); err != nil {
+				t.Fatalf("deleteLaunchTemplate() error = %v", err)
+			}
+			if !slices.Equal(fake.actions, tt.want) {
+				t.Errorf("actions = %v, want %v", fake.actions, tt.want)
+			}
+		})
+	}
+}
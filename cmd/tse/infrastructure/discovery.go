@@ -2,22 +2,28 @@ package infrastructure
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
+	"sort"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
 )
 
 const (
-	// Resource names
-	FunctionName     = "tailscale-exits"
-	RoleName         = "tailscale-exits-lambda-role"
-	InlinePolicyName = "tailscale-exits-lambda-ec2-policy"
-	LogGroupName     = "/aws/lambda/tailscale-exits"
-
 	// Standard tag for all TSE resources
 	TagManagedBy = "tse"
 
@@ -28,9 +34,23 @@ const (
 // AWSClients holds AWS service clients for infrastructure operations.
 // Creating clients once and reusing them is more efficient than repeatedly loading config.
 type AWSClients struct {
-	IAM    *iam.Client
-	Lambda *lambda.Client
-	Logs   *cloudwatchlogs.Client
+	IAM      *iam.Client
+	Lambda   *lambda.Client
+	Logs     *cloudwatchlogs.Client
+	DynamoDB *dynamodb.Client
+	SFN      *sfn.Client
+	EC2      *ec2.Client // Launch templates, in every region (see inEveryRegion)
+
+	// The optional node age alarm, its topic, and the Lambda's schedules
+	CloudWatch  *cloudwatch.Client
+	SNS         *sns.Client
+	EventBridge *eventbridge.Client
+}
+
+// isAPIError reports whether err is an AWS error response with the given code
+func isAPIError(err error, code string) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == code
 }
 
 // GetDefaultRegion returns the default AWS region from the user's configuration.
@@ -49,6 +69,20 @@ func GetDefaultRegion(ctx context.Context) (string, error) {
 	return cfg.Region, nil
 }
 
+// GetAccountID returns the account ID of the locally configured AWS credentials
+func GetAccountID(ctx context.Context) (string, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	return aws.ToString(identity.Account), nil
+}
+
 // NewAWSClients creates AWS service clients for the given region.
 // IAM client uses the region but IAM is a global service.
 func NewAWSClients(ctx context.Context, region string) (*AWSClients, error) {
@@ -58,9 +92,16 @@ func NewAWSClients(ctx context.Context, region string) (*AWSClients, error) {
 	}
 
 	return &AWSClients{
-		IAM:    iam.NewFromConfig(cfg),
-		Lambda: lambda.NewFromConfig(cfg),
-		Logs:   cloudwatchlogs.NewFromConfig(cfg),
+		IAM:      iam.NewFromConfig(cfg),
+		Lambda:   lambda.NewFromConfig(cfg),
+		Logs:     cloudwatchlogs.NewFromConfig(cfg),
+		DynamoDB: dynamodb.NewFromConfig(cfg),
+		SFN:      sfn.NewFromConfig(cfg),
+		EC2:      ec2.NewFromConfig(cfg),
+
+		CloudWatch:  cloudwatch.NewFromConfig(cfg),
+		SNS:         sns.NewFromConfig(cfg),
+		EventBridge: eventbridge.NewFromConfig(cfg),
 	}, nil
 }
 
@@ -79,6 +120,11 @@ func AutodiscoverInfrastructure(ctx context.Context, region string) (*Infrastruc
 		return nil, fmt.Errorf("IAM discovery failed: %w", err)
 	}
 
+	// Discover the exit node instance profile (also IAM)
+	if err := discoverNodeProfile(ctx, clients, state); err != nil {
+		return nil, fmt.Errorf("instance profile discovery failed: %w", err)
+	}
+
 	// Discover Lambda resources
 	if err := discoverLambdaResources(ctx, clients, state); err != nil {
 		return nil, fmt.Errorf("Lambda discovery failed: %w", err)
@@ -89,6 +135,23 @@ func AutodiscoverInfrastructure(ctx context.Context, region string) (*Infrastruc
 		return nil, fmt.Errorf("CloudWatch Logs discovery failed: %w", err)
 	}
 
+	// Discover DynamoDB state table
+	if err := discoverTableResources(ctx, clients, state); err != nil {
+		return nil, fmt.Errorf("DynamoDB discovery failed: %w", err)
+	}
+
+	// Discover the optional node age alarm
+	discoverAlarmResources(ctx, clients, state)
+
+	// Discover the optional warm-keeper schedule
+	discoverWarmSchedule(ctx, clients, state)
+
+	// Discover the optional Step Functions workflow
+	discoverWorkflow(ctx, clients, state)
+
+	// Discover the exit node launch template
+	discoverLaunchTemplate(ctx, clients, state)
+
 	return state, nil
 }
 
@@ -148,13 +211,48 @@ func discoverIAMResources(ctx context.Context, clients *AWSClients, state *Infra
 	})
 	if err == nil {
 		state.Policies.InlineName = *inlinePolicy.PolicyName
-		state.Policies.InlineDocument = *inlinePolicy.PolicyDocument
+		// IAM returns policy documents URL-encoded
+		document := *inlinePolicy.PolicyDocument
+		if decoded, err := url.QueryUnescape(document); err == nil {
+			document = decoded
+		}
+		state.Policies.InlineDocument = document
 	}
 	// Ignore error if policy doesn't exist
 
 	return nil
 }
 
+// discoverNodeProfile discovers the exit node instance profile.
+// A profile without its role is treated as missing so deploy repairs it.
+func discoverNodeProfile(ctx context.Context, clients *AWSClients, state *InfrastructureState) error {
+	output, err := clients.IAM.GetInstanceProfile(ctx, &iam.GetInstanceProfileInput{
+		InstanceProfileName: aws.String(NodeInstanceProfileName),
+	})
+	if err != nil {
+		// Profile doesn't exist - this is fine for discovery
+		return nil
+	}
+
+	profile := output.InstanceProfile
+	if len(profile.Roles) == 0 {
+		return nil
+	}
+
+	tags := make(map[string]string)
+	for _, tag := range profile.Tags {
+		tags[*tag.Key] = *tag.Value
+	}
+
+	state.NodeProfile = &Resource{
+		Name: *profile.InstanceProfileName,
+		ARN:  *profile.Arn,
+		Tags: tags,
+	}
+
+	return nil
+}
+
 // discoverLambdaResources discovers Lambda function and function URL.
 // Populates the Lambda and FunctionURL fields of the state.
 func discoverLambdaResources(ctx context.Context, clients *AWSClients, state *InfrastructureState) error {
@@ -183,6 +281,17 @@ func discoverLambdaResources(ctx context.Context, clients *AWSClients, state *In
 		ARN:  *functionOutput.Configuration.FunctionArn,
 		Tags: tagsOutput.Tags,
 	}
+	state.DeploymentID = tagsOutput.Tags[TagDeployment]
+
+	configuration := functionOutput.Configuration
+	state.Config.LambdaMemoryMB = aws.ToInt32(configuration.MemorySize)
+	state.Config.LambdaTimeout = aws.ToInt32(configuration.Timeout)
+	if configuration.Environment != nil {
+		for key := range configuration.Environment.Variables {
+			state.Config.LambdaEnvKeys = append(state.Config.LambdaEnvKeys, key)
+		}
+		sort.Strings(state.Config.LambdaEnvKeys)
+	}
 
 	// Try to get function URL config
 	urlConfig, err := clients.Lambda.GetFunctionUrlConfig(ctx, &lambda.GetFunctionUrlConfigInput{
@@ -190,6 +299,7 @@ func discoverLambdaResources(ctx context.Context, clients *AWSClients, state *In
 	})
 	if err == nil {
 		state.FunctionURL = *urlConfig.FunctionUrl
+		state.Config.URLCors = corsFromLambda(urlConfig.Cors)
 	}
 	// Ignore error if URL doesn't exist
 
@@ -238,7 +348,54 @@ func discoverLogsResources(ctx context.Context, clients *AWSClients, state *Infr
 			ARN:  arn,
 			Tags: tags,
 		}
+		state.Config.LogRetentionDays = aws.ToInt32(logGroup.RetentionInDays)
 	}
 
 	return nil
 }
+
+// discoverTableResources discovers the DynamoDB state table.
+// Populates the Table field of the state.
+func discoverTableResources(ctx context.Context, clients *AWSClients, state *InfrastructureState) error {
+	tableOutput, err := clients.DynamoDB.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(TableName),
+	})
+	if err != nil {
+		// Table doesn't exist - fine for discovery
+		return nil
+	}
+
+	tags := make(map[string]string)
+	tagsOutput, err := clients.DynamoDB.ListTagsOfResource(ctx, &dynamodb.ListTagsOfResourceInput{
+		ResourceArn: tableOutput.Table.TableArn,
+	})
+	if err == nil {
+		for _, tag := range tagsOutput.Tags {
+			tags[*tag.Key] = *tag.Value
+		}
+	}
+	// Ignore tag fetch errors - we'll just have empty tags
+
+	state.Table = &Resource{
+		Name: *tableOutput.Table.TableName,
+		ARN:  *tableOutput.Table.TableArn,
+		Tags: tags,
+	}
+
+	return nil
+}
+
+// corsFromLambda converts a function URL's CORS settings; nil means CORS is off
+func corsFromLambda(cors *lambdatypes.Cors) *CORS {
+	if cors == nil {
+		return nil
+	}
+	return &CORS{
+		AllowCredentials: aws.ToBool(cors.AllowCredentials),
+		AllowOrigins:     cors.AllowOrigins,
+		AllowMethods:     cors.AllowMethods,
+		AllowHeaders:     cors.AllowHeaders,
+		ExposeHeaders:    cors.ExposeHeaders,
+		MaxAge:           aws.ToInt32(cors.MaxAge),
+	}
+}
@@ -0,0 +1,258 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DryRun discovers the deployed infrastructure and returns the AWS calls Setup
+// would make to complete it, one per line with its parameters. It changes nothing.
+func DryRun(ctx context.Context, region string) (*InfrastructureState, []string, error) {
+	alarmHours, err := AlarmHours()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ValidateReadToken(); err != nil {
+		return nil, nil, err
+	}
+	if err := ValidateTelegram(); err != nil {
+		return nil, nil, err
+	}
+	if _, _, err := LambdaSize(); err != nil {
+		return nil, nil, err
+	}
+	if _, _, err := Orchestration(); err != nil {
+		return nil, nil, err
+	}
+	state, err := AutodiscoverInfrastructure(ctx, region)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := resolveDeploymentID(state); err != nil {
+		return nil, nil, err
+	}
+	// deploy registers the Telegram webhook once Setup is done
+	return state, append(SetupCalls(state, alarmHours), telegramCalls(state.FunctionURL)...), nil
+}
+
+// SetupCalls lists the calls Setup makes given the discovered state, following
+// the same conditions. Secrets never appear: the Lambda's environment is listed
+// by variable name only.
+func SetupCalls(state *InfrastructureState, alarmHours int) []string {
+	var calls []string
+	add := func(call string, params ...string) {
+		calls = append(calls, strings.TrimSpace(call+" "+strings.Join(params, " ")))
+	}
+	email := os.Getenv("TSE_ALARM_EMAIL")
+
+	if state.IsComplete() {
+		return deployOptionCalls(state, alarmHours, email)
+	}
+
+	if state.LogGroup == nil {
+		add("logs:CreateLogGroup", "LogGroupName="+LogGroupName)
+		add("logs:PutRetentionPolicy", "LogGroupName="+LogGroupName, fmt.Sprintf("RetentionInDays=%d", LogRetentionDays))
+	}
+
+	if state.Table == nil {
+		add("dynamodb:CreateTable", "TableName="+TableName, "KeySchema=pk(HASH),sk(RANGE)", "BillingMode=PAY_PER_REQUEST")
+		add("dynamodb:UpdateTimeToLive", "TableName="+TableName, "AttributeName=expires_at")
+	}
+
+	roleARN := "(new role)"
+	if state.IAMRole == nil {
+		add("iam:CreateRole", "RoleName="+RoleName, "Principal=lambda.amazonaws.com")
+	} else {
+		roleARN = state.IAMRole.ARN
+	}
+
+	if state.NodeProfile == nil {
+		add("iam:CreateRole", "RoleName="+NodeRoleName, "Principal=ec2.amazonaws.com")
+		add("iam:PutRolePolicy", "RoleName="+NodeRoleName, "PolicyName="+NodePolicyName)
+		add("iam:CreateInstanceProfile", "InstanceProfileName="+NodeInstanceProfileName)
+		add("iam:AddRoleToInstanceProfile", "InstanceProfileName="+NodeInstanceProfileName, "RoleName="+NodeRoleName)
+	}
+
+	calls = append(calls, launchTemplateCalls(state)...)
+
+	if !state.Policies.Managed {
+		add("iam:AttachRolePolicy", "RoleName="+RoleName, "PolicyArn="+ManagedPolicyARN)
+	}
+
+	if state.Policies.InlineName == "" || state.Table == nil || state.NodeProfile == nil || launchTemplateEnvMissing(state) || orchestrationSet() {
+		add("iam:PutRolePolicy", "RoleName="+RoleName, "PolicyName="+InlinePolicyName)
+	}
+
+	lambdaARN := "(new function)"
+	memoryMB, timeoutSeconds, _ := LambdaSize()
+	if state.Lambda == nil {
+		code := "Code=(prebuilt, linux/arm64)"
+		if !UsesEmbeddedLambda() {
+			code = "Code=(built from source, linux/arm64)"
+		}
+		add("lambda:CreateFunction", "FunctionName="+FunctionName, "Runtime=provided.al2023", "Architectures=arm64",
+			fmt.Sprintf("MemorySize=%d", memoryMB), fmt.Sprintf("Timeout=%d", timeoutSeconds),
+			"Role="+roleARN, code, "Environment="+envKeys(lambdaEnvironment("", "")))
+	} else {
+		lambdaARN = state.Lambda.ARN
+		if state.Table == nil || state.NodeProfile == nil || launchTemplateEnvMissing(state) || deploymentIDMissing(state) || os.Getenv("TSE_SECURITY_BASELINE") != "" || customRegionsSet() || transferCapsSet() || readTokenSet() || telegramSet() || keyExpiryTokenSet() || orchestrationSet() || lambdaSizeStale(state) {
+			if deploymentIDMissing(state) {
+				add(tagLambdaCall(lambdaARN))
+			}
+			add(updateEnvCall())
+		}
+	}
+
+	calls = append(calls, workflowCalls(state, lambdaARN)...)
+
+	if state.FunctionURL == "" {
+		add("lambda:CreateFunctionUrlConfig", "FunctionName="+FunctionName, "AuthType=NONE", "Cors=(browser access)")
+		add("lambda:AddPermission", "FunctionName="+FunctionName, "StatementId=FunctionURLAllowPublicAccess", "Action=lambda:InvokeFunctionUrl", "Principal=*")
+	}
+
+	if alarmHours > 0 {
+		calls = append(calls, alarmCalls(lambdaARN, alarmHours, email)...)
+	} else if sweepNeeded() {
+		calls = append(calls, scheduleCalls(lambdaARN)...)
+	}
+	calls = append(calls, warmScheduleCalls(state, lambdaARN)...)
+
+	return calls
+}
+
+// deployOptionCalls lists the calls applyDeployOptions makes to a complete deployment
+func deployOptionCalls(state *InfrastructureState, hours int, email string) []string {
+	calls := launchTemplateCalls(state)
+	if deploymentIDMissing(state) {
+		calls = append(calls, tagLambdaCall(state.Lambda.ARN))
+	}
+	baseline := os.Getenv("TSE_SECURITY_BASELINE")
+	inline := "iam:PutRolePolicy RoleName=" + RoleName + " PolicyName=" + InlinePolicyName
+
+	// The workflow is created before the Lambda is pointed at it, and removed after
+	if stepFunctionsOn() {
+		calls = append(calls, workflowCalls(state, state.Lambda.ARN)...)
+	}
+
+	switch {
+	case baseline != "":
+		calls = append(calls, inline, updateEnvCall())
+	case transferCapsSet():
+		calls = append(calls, inline, updateEnvCall())
+	case launchTemplateEnvMissing(state):
+		calls = append(calls, inline, updateEnvCall())
+	case deploymentIDMissing(state):
+		calls = append(calls, updateEnvCall())
+	case orchestrationSet():
+		calls = append(calls, inline, updateEnvCall())
+	case customRegionsSet(), readTokenSet(), telegramSet(), keyExpiryTokenSet(), lambdaSizeStale(state):
+		calls = append(calls, updateEnvCall())
+	}
+
+	if !stepFunctionsOn() {
+		calls = append(calls, workflowCalls(state, state.Lambda.ARN)...)
+	}
+
+	if hours > 0 {
+		calls = append(calls, alarmCalls(state.Lambda.ARN, hours, email)...)
+	} else if sweepNeeded() {
+		calls = append(calls, scheduleCalls(state.Lambda.ARN)...)
+	}
+	return append(calls, warmScheduleCalls(state, state.Lambda.ARN)...)
+}
+
+// updateEnvCall is ensureLambdaEnv's update, which it skips when nothing changed
+func updateEnvCall() string {
+	memoryMB, timeoutSeconds, _ := LambdaSize()
+	return fmt.Sprintf("lambda:UpdateFunctionConfiguration FunctionName=%s Environment=%s MemorySize=%d Timeout=%d (only if a value changed)", FunctionName, envKeys(resourceEnvironment()), memoryMB, timeoutSeconds)
+}
+
+// alarmCalls lists the calls applyNodeAgeAlarm makes
+func alarmCalls(lambdaARN string, hours int, email string) []string {
+	calls := []string{"sns:CreateTopic Name=" + AlarmTopicName}
+	if email != "" {
+		calls = append(calls, "sns:Subscribe Protocol=email Endpoint="+email)
+	}
+	calls = append(calls, fmt.Sprintf("monitoring:PutMetricAlarm AlarmName=%s MetricName=%s Threshold=%d", AlarmName, nodeAgeMetric, hours*3600))
+	return append(calls, scheduleCalls(lambdaARN)...)
+}
+
+// scheduleCalls lists the calls createMetricsSchedule makes
+func scheduleCalls(lambdaARN string) []string {
+	return []string{
+		fmt.Sprintf("events:PutRule Name=%s ScheduleExpression=%s", ScheduleRuleName, metricsSchedule),
+		fmt.Sprintf("lambda:AddPermission FunctionName=%s StatementId=%s Principal=events.amazonaws.com", FunctionName, scheduleStatementID),
+		fmt.Sprintf("events:PutTargets Rule=%s Arn=%s", ScheduleRuleName, lambdaARN),
+	}
+}
+
+// TeardownCalls lists the calls Teardown makes to delete what's in state, in
+// the order it makes them
+func TeardownCalls(state *InfrastructureState) []string {
+	var calls []string
+	if state.WarmSchedule != nil {
+		calls = append(calls, deleteWarmScheduleCalls()...)
+	}
+	if state.Workflow != nil {
+		calls = append(calls, deleteWorkflowCalls(state.Workflow, nil)...)
+	}
+	if state.Schedule != nil {
+		calls = append(calls,
+			fmt.Sprintf("events:RemoveTargets Rule=%s Ids=%s", ScheduleRuleName, scheduleTargetID),
+			"events:DeleteRule Name="+ScheduleRuleName)
+	}
+	if state.Alarm != nil {
+		calls = append(calls, "monitoring:DeleteAlarms AlarmNames="+AlarmName)
+	}
+	if state.AlarmTopic != nil {
+		calls = append(calls, "sns:DeleteTopic TopicArn="+state.AlarmTopic.ARN)
+	}
+	if state.FunctionURL != "" && state.Lambda != nil {
+		calls = append(calls, "lambda:DeleteFunctionUrlConfig FunctionName="+state.Lambda.Name)
+	}
+	if state.Lambda != nil {
+		calls = append(calls, "lambda:DeleteFunction FunctionName="+state.Lambda.Name)
+	}
+	if state.LaunchTemplate != nil {
+		calls = append(calls, "ec2:DeleteLaunchTemplate LaunchTemplateName="+state.LaunchTemplate.Name+" (in each enabled region)")
+	}
+	if state.Policies.InlineName != "" && state.IAMRole != nil {
+		calls = append(calls, fmt.Sprintf("iam:DeleteRolePolicy RoleName=%s PolicyName=%s", state.IAMRole.Name, state.Policies.InlineName))
+	}
+	if state.Policies.Managed && state.IAMRole != nil {
+		calls = append(calls, fmt.Sprintf("iam:DetachRolePolicy RoleName=%s PolicyArn=%s", state.IAMRole.Name, ManagedPolicyARN))
+	}
+	if state.IAMRole != nil {
+		calls = append(calls, "iam:DeleteRole RoleName="+state.IAMRole.Name)
+	}
+	if state.WorkflowRole != nil {
+		calls = append(calls, deleteWorkflowCalls(nil, state.WorkflowRole)...)
+	}
+	if state.NodeProfile != nil {
+		calls = append(calls,
+			fmt.Sprintf("iam:RemoveRoleFromInstanceProfile InstanceProfileName=%s RoleName=%s", NodeInstanceProfileName, NodeRoleName),
+			"iam:DeleteInstanceProfile InstanceProfileName="+NodeInstanceProfileName,
+			fmt.Sprintf("iam:DeleteRolePolicy RoleName=%s PolicyName=%s", NodeRoleName, NodePolicyName),
+			"iam:DeleteRole RoleName="+NodeRoleName)
+	}
+	if state.LogGroup != nil {
+		calls = append(calls, "logs:DeleteLogGroup LogGroupName="+state.LogGroup.Name)
+	}
+	if state.Table != nil {
+		calls = append(calls, "dynamodb:DeleteTable TableName="+state.Table.Name)
+	}
+	return calls
+}
+
+// envKeys renders an environment's variable names, sorted, leaving out the values
+func envKeys(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
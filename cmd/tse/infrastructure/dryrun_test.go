@@ -0,0 +1,96 @@
+package infrastructure
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/telegram"
+)
+
+func clearOptionEnv(t *testing.T) {
+	clearDeployEnv(t)
+	for _, key := range []string{"TSE_ALARM_EMAIL", regions.EnvCustomRegions, regions.EnvOnlyRegions, EnvNodeCapGB, EnvMonthlyCapGB, EnvMaxNodes, EnvKeepWarm, EnvReadToken, telegram.EnvBotToken, telegram.EnvChatIDs, EnvTailscaleAPIToken, EnvLambdaMemoryMB, EnvLambdaTimeout, EnvOrchestration} {
+		t.Setenv(key, "")
+	}
+}
+
+// actions returns each call's service:Action
+func actions(calls []string) []string {
+	var names []string
+	for _, call := range calls {
+		name, _, _ := strings.Cut(call, " ")
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestSetupCallsFresh(t *testing.T) {
+	clearOptionEnv(t)
+	t.Setenv("TAILSCALE_AUTH_KEY", "tskey-auth-secret")
+
+	calls := SetupCalls(&InfrastructureState{}, 0)
+	want := []string{
+		"logs:CreateLogGroup", "logs:PutRetentionPolicy",
+		"dynamodb:CreateTable", "dynamodb:UpdateTimeToLive",
+		"iam:CreateRole",
+		"iam:CreateRole", "iam:PutRolePolicy", "iam:CreateInstanceProfile", "iam:AddRoleToInstanceProfile",
+		"ec2:CreateLaunchTemplate",
+		"iam:AttachRolePolicy", "iam:PutRolePolicy",
+		"lambda:CreateFunction",
+		"lambda:CreateFunctionUrlConfig", "lambda:AddPermission",
+	}
+	if got := actions(calls); !slices.Equal(got, want) {
+		t.Errorf("SetupCalls() = %v, want %v", got, want)
+	}
+	for _, call := range calls {
+		if strings.Contains(call, "tskey-auth-secret") {
+			t.Errorf("call %q leaks the auth key", call)
+		}
+	}
+	if create := calls[12]; !strings.Contains(create, "Role=(new role)") || !strings.Contains(create, "TAILSCALE_AUTH_KEY") {
+		t.Errorf("CreateFunction call = %q", create)
+	}
+}
+
+func TestSetupCallsComplete(t *testing.T) {
+	clearOptionEnv(t)
+	state := deployedState()
+	state.Lambda.ARN = "arn:aws:lambda:us-east-2:123456789012:function:tailscale-exits"
+
+	if calls := SetupCalls(state, 0); len(calls) != 0 {
+		t.Errorf("SetupCalls() = %v, want nothing for a complete deployment", calls)
+	}
+
+	t.Setenv("TSE_SECURITY_BASELINE", "strict")
+	t.Setenv("TSE_ALARM_EMAIL", "you@example.com")
+	calls := SetupCalls(state, 8)
+	want := []string{
+		"iam:PutRolePolicy", "lambda:UpdateFunctionConfiguration",
+		"sns:CreateTopic", "sns:Subscribe", "monitoring:PutMetricAlarm",
+		"events:PutRule", "lambda:AddPermission", "events:PutTargets",
+	}
+	if got := actions(calls); !slices.Equal(got, want) {
+		t.Errorf("SetupCalls() = %v, want %v", got, want)
+	}
+	if !strings.Contains(calls[4], "Threshold=28800") || !strings.HasSuffix(calls[7], state.Lambda.ARN) {
+		t.Errorf("SetupCalls() = %v", calls)
+	}
+}
+
+func TestTeardownCalls(t *testing.T) {
+	state := selectResources(deployedState(), TeardownOptions{KeepIAM: true})
+	want := []string{
+		"lambda:DeleteFunctionUrlConfig", "lambda:DeleteFunction", "ec2:DeleteLaunchTemplate",
+		"logs:DeleteLogGroup", "dynamodb:DeleteTable",
+	}
+	if got := actions(TeardownCalls(state)); !slices.Equal(got, want) {
+		t.Errorf("TeardownCalls() = %v, want %v", got, want)
+	}
+
+	all := TeardownCalls(deployedState())
+	if len(all) != 12 || !strings.HasPrefix(all[len(all)-1], "dynamodb:DeleteTable") {
+		t.Errorf("TeardownCalls() = %v", all)
+	}
+}
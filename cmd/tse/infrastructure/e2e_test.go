@@ -0,0 +1,163 @@
+//go:build integration
+
+package infrastructure
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/pkg/client"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/telegram"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// envE2EAccount names the only real AWS account TestEndToEnd may deploy to
+const envE2EAccount = "TSE_E2E_ACCOUNT"
+
+// e2eEnvCleared are the deploy options a shell set up for a real deployment
+// might carry; the throwaway deployment gets the defaults instead
+var e2eEnvCleared = []string{
+	"TSE_AUTH_TOKEN", EnvDeploymentID, EnvNamePrefix, EnvReadToken, EnvKeepWarm, EnvOrchestration,
+	"TSE_ALARM_HOURS", "TSE_ALARM_EMAIL", "TSE_WEBHOOKS", "TSE_SECURITY_BASELINE",
+	"TSE_ROLE_ARN", "TSE_ROLE_EXTERNAL_ID", "TSE_NODE_INSTANCE_PROFILE",
+	EnvNodeCapGB, EnvMonthlyCapGB, EnvMaxNodes, telegram.EnvBotToken, telegram.EnvChatIDs, EnvTailscaleAPIToken,
+	EnvLambdaMemoryMB, EnvLambdaTimeout,
+}
+
+// TestEndToEnd deploys a throwaway copy of tse under its own name prefix,
+// starts and stops an exit node through the function URL, and tears it all
+// down again, including after a failure. It only builds with the integration
+// tag, and only runs against LocalStack (AWS_ENDPOINT_URL set) or the account
+// in TSE_E2E_ACCOUNT, so it can't land in whatever account the shell happens
+// to have credentials for. See "Integration Tests" in README.md.
+func TestEndToEnd(t *testing.T) {
+	if testing.Short() {
+		t.Skip("deploys real infrastructure")
+	}
+	for _, name := range e2eEnvCleared {
+		t.Setenv(name, "")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Minute)
+	defer cancel()
+
+	switch {
+	case os.Getenv("AWS_ENDPOINT_URL") != "":
+		// LocalStack takes any credentials, and nodes never reach the tailnet
+		setDefaultEnv(t, "AWS_ACCESS_KEY_ID", "test")
+		setDefaultEnv(t, "AWS_SECRET_ACCESS_KEY", "test")
+		setDefaultEnv(t, "TAILSCALE_AUTH_KEY", "tskey-auth-e2e")
+	case os.Getenv(envE2EAccount) != "":
+		account, err := GetAccountID(ctx)
+		if err != nil {
+			t.Fatalf("GetAccountID() error = %v", err)
+		}
+		if account != os.Getenv(envE2EAccount) {
+			t.Fatalf("credentials are for account %s, not %s=%s; refusing to deploy", account, envE2EAccount, os.Getenv(envE2EAccount))
+		}
+		if os.Getenv("TAILSCALE_AUTH_KEY") == "" {
+			t.Fatal("TAILSCALE_AUTH_KEY must be set; use an ephemeral key so the test node leaves the tailnet on its own")
+		}
+	default:
+		t.Skipf("set AWS_ENDPOINT_URL for LocalStack, or %s to the account ID to deploy to", envE2EAccount)
+	}
+
+	friendlyRegion := os.Getenv("TSE_E2E_REGION")
+	if friendlyRegion == "" {
+		friendlyRegion = "ohio"
+	}
+	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+	if err != nil {
+		t.Fatalf("TSE_E2E_REGION: %v", err)
+	}
+	setDefaultEnv(t, "AWS_REGION", awsRegion)
+
+	// A prefix of its own keeps the deployment apart from any other in the account
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	if err := SetNamePrefix("tse-e2e-" + hex.EncodeToString(suffix)); err != nil {
+		t.Fatalf("SetNamePrefix() error = %v", err)
+	}
+	t.Cleanup(func() { SetNamePrefix("") })
+	ui.EnablePlain()
+
+	// Registered before deploying, so a deploy that fails halfway is removed too
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		if err := Teardown(ctx, awsRegion, TeardownOptions{}); err != nil {
+			t.Errorf("Teardown() error = %v; delete the %s-* resources by hand", err, NamePrefix())
+		}
+	})
+
+	result, err := Setup(ctx, awsRegion)
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	if result.State.FunctionURL == "" {
+		t.Fatal("Setup() deployed no function URL")
+	}
+
+	c, err := client.New(result.State.FunctionURL, result.AuthToken)
+	if err != nil {
+		t.Fatalf("client.New() error = %v", err)
+	}
+	if _, err := c.Health(ctx); err != nil {
+		t.Fatalf("Health() error = %v", err)
+	}
+
+	started, err := c.Start(ctx, types.StartRequest{Region: friendlyRegion})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if started.Instance == nil || started.Instance.InstanceID == "" {
+		t.Fatalf("Start() = %+v, want an instance", started)
+	}
+	id := started.Instance.InstanceID
+
+	listed, err := c.Instances(ctx, friendlyRegion)
+	if err != nil {
+		t.Fatalf("Instances() error = %v", err)
+	}
+	if !listsInstance(listed, id) {
+		t.Errorf("Instances() = %+v, want %s listed", listed.Instances, id)
+	}
+
+	stopped, err := c.Stop(ctx, friendlyRegion)
+	if err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if !slices.Contains(stopped.TerminatedIDs, id) {
+		t.Errorf("Stop() terminated %v, want %s", stopped.TerminatedIDs, id)
+	}
+
+	listed, err = c.Instances(ctx, friendlyRegion)
+	if err != nil {
+		t.Fatalf("Instances() after stop error = %v", err)
+	}
+	if listsInstance(listed, id) {
+		t.Errorf("Instances() after stop still lists %s", id)
+	}
+}
+
+// setDefaultEnv sets an environment variable for the test unless it's set already
+func setDefaultEnv(t *testing.T, name, value string) {
+	t.Helper()
+	if os.Getenv(name) == "" {
+		t.Setenv(name, value)
+	}
+}
+
+// listsInstance reports whether a listing has the instance in a live state
+func listsInstance(listed *types.InstancesResponse, id string) bool {
+	return slices.ContainsFunc(listed.Instances, func(instance *types.InstanceInfo) bool {
+		return instance.InstanceID == id && instance.State != "shutting-down" && instance.State != "terminated"
+	})
+}
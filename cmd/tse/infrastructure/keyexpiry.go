@@ -0,0 +1,15 @@
+package infrastructure
+
+import "os"
+
+// EnvTailscaleAPIToken is an optional Tailscale API token for the Lambda, which
+// uses it to turn off key expiry on each exit node once it's on the tailnet.
+// It's separate from TAILSCALE_API_TOKEN so the Lambda can get a token scoped
+// to devices alone rather than the one tse setup edits the policy with.
+const EnvTailscaleAPIToken = "TSE_TAILSCALE_API_TOKEN"
+
+// keyExpiryTokenSet reports whether a Tailscale API token was given for the
+// Lambda, so its environment has to carry it
+func keyExpiryTokenSet() bool {
+	return os.Getenv(EnvTailscaleAPIToken) != ""
+}
@@ -0,0 +1,71 @@
+package infrastructure
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Optional Lambda sizing (tse deploy --lambda-memory/--lambda-timeout). Deploy
+// creates the function with these and resizes a deployed one to match.
+const (
+	EnvLambdaMemoryMB = "TSE_LAMBDA_MEMORY_MB"
+	EnvLambdaTimeout  = "TSE_LAMBDA_TIMEOUT"
+
+	defaultLambdaMemoryMB = 256
+	// A start in a region without its VPC stack yet creates one and waits on
+	// EC2, which can run past a minute
+	defaultLambdaTimeoutSeconds = 120
+
+	// Lambda's own memory limits
+	minLambdaMemoryMB = 128
+	maxLambdaMemoryMB = 10240
+
+	// Less than a minute can't fit a start once the handler keeps its reserve
+	// for rolling back; more than 5 minutes outlasts client.ActionTimeout, so
+	// the CLI would give up on a start the Lambda is still working on
+	minLambdaTimeoutSeconds = 60
+	maxLambdaTimeoutSeconds = 300
+)
+
+// LambdaSize reads TSE_LAMBDA_MEMORY_MB and TSE_LAMBDA_TIMEOUT (seconds), using
+// the defaults for either that's unset
+func LambdaSize() (memoryMB, timeoutSeconds int32, err error) {
+	memory, err := lambdaSizeValue(EnvLambdaMemoryMB, defaultLambdaMemoryMB, minLambdaMemoryMB, maxLambdaMemoryMB, "MB")
+	if err != nil {
+		return 0, 0, err
+	}
+	timeout, err := lambdaSizeValue(EnvLambdaTimeout, defaultLambdaTimeoutSeconds, minLambdaTimeoutSeconds, maxLambdaTimeoutSeconds, "seconds")
+	if err != nil {
+		return 0, 0, err
+	}
+	return memory, timeout, nil
+}
+
+// lambdaSizeValue parses a whole number within [low, high] from an environment
+// variable, or returns fallback when it's unset
+func lambdaSizeValue(name string, fallback, low, high int32, unit string) (int32, error) {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.ParseInt(raw, 10, 32)
+	if err != nil || value < int64(low) || value > int64(high) {
+		return 0, fmt.Errorf("%s must be a whole number of %s from %d to %d, got %q", name, unit, low, high, raw)
+	}
+	return int32(value), nil
+}
+
+// lambdaSizeStale reports whether the deployed Lambda's memory or timeout
+// differs from the configured size, so deploy has to resize it
+func lambdaSizeStale(state *InfrastructureState) bool {
+	if state.Lambda == nil {
+		return false
+	}
+	memoryMB, timeoutSeconds, err := LambdaSize()
+	if err != nil {
+		return false
+	}
+	return state.Config.LambdaMemoryMB != memoryMB || state.Config.LambdaTimeout != timeoutSeconds
+}
@@ -0,0 +1,62 @@
+package infrastructure
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLambdaSize(t *testing.T) {
+	tests := []struct {
+		memory, timeout string
+		wantMemory      int32
+		wantTimeout     int32
+		wantErr         bool
+	}{
+		{wantMemory: defaultLambdaMemoryMB, wantTimeout: defaultLambdaTimeoutSeconds},
+		{memory: "512", timeout: "180", wantMemory: 512, wantTimeout: 180},
+		{memory: "64", wantErr: true},
+		{timeout: "30", wantErr: true},
+		{timeout: "900", wantErr: true},
+		{timeout: "2m", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.memory+"/"+tt.timeout, func(t *testing.T) {
+			t.Setenv(EnvLambdaMemoryMB, tt.memory)
+			t.Setenv(EnvLambdaTimeout, tt.timeout)
+			memory, timeout, err := LambdaSize()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LambdaSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if memory != tt.wantMemory || timeout != tt.wantTimeout {
+				t.Errorf("LambdaSize() = %d, %d, want %d, %d", memory, timeout, tt.wantMemory, tt.wantTimeout)
+			}
+		})
+	}
+}
+
+func TestLambdaResizeCalls(t *testing.T) {
+	clearOptionEnv(t)
+	state := deployedState()
+	if calls := SetupCalls(state, 0); len(calls) != 0 {
+		t.Fatalf("SetupCalls() = %v, want nothing for a Lambda of the default size", calls)
+	}
+
+	// A Lambda deployed with the old 60s timeout is brought up to the default
+	state.Config.LambdaTimeout = 60
+	calls := SetupCalls(state, 0)
+	if !slices.Equal(actions(calls), []string{"lambda:UpdateFunctionConfiguration"}) || !strings.Contains(calls[0], "Timeout=120") {
+		t.Errorf("SetupCalls() = %v, want the Lambda resized", calls)
+	}
+	if drifts := DetectDrift(state); len(drifts) != 1 || drifts[0].Field != "timeout" {
+		t.Errorf("DetectDrift() = %+v, want the timeout", drifts)
+	}
+
+	t.Setenv(EnvLambdaMemoryMB, "512")
+	t.Setenv(EnvLambdaTimeout, "60")
+	calls = SetupCalls(state, 0)
+	if len(calls) != 1 || !strings.Contains(calls[0], "MemorySize=512 Timeout=60") {
+		t.Errorf("SetupCalls() = %v, want the configured size", calls)
+	}
+}
@@ -0,0 +1,306 @@
+package infrastructure
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
+)
+
+const (
+	// EnvLaunchTemplate tells the Lambda which launch template to start exit nodes from
+	EnvLaunchTemplate = "TSE_LAUNCH_TEMPLATE"
+
+	// What the template launches, matching the Lambda's primary architecture.
+	// The image resolves to the latest Amazon Linux 2023 AMI at launch time.
+	templateImage        = "resolve:ssm:/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-arm64"
+	templateInstanceType = "t4g.nano"
+
+	// templateVersionPrefix starts each version's description, followed by a
+	// hash of its data, so deploy can tell a stale default version
+	templateVersionPrefix = "tse "
+)
+
+// templateUserData is the template's placeholder user data. Every start replaces
+// it with a script carrying the Tailscale auth key, which has no place in a
+// template; an instance launched from the template by hand just shuts down,
+// which terminates it.
+const templateUserData = `#!/bin/bash
+# tse replaces this user data on every start with the exit node setup script.
+# Launched without it, there's nothing to set up, so stop billing right away.
+shutdown -h now
+`
+
+// launchTemplateData returns the CreateLaunchTemplate(Version) data for the
+// template's content. The security group, subnet, user data and instance
+// profile are per-start, so the Lambda passes them as overrides.
+func launchTemplateData() *ec2types.RequestLaunchTemplateData {
+	data := &ec2types.RequestLaunchTemplateData{
+		ImageId:                           aws.String(templateImage),
+		InstanceType:                      ec2types.InstanceType(templateInstanceType),
+		InstanceInitiatedShutdownBehavior: ec2types.ShutdownBehaviorTerminate,
+		UserData:                          aws.String(base64.StdEncoding.EncodeToString([]byte(templateUserData))),
+	}
+	for _, resourceType := range []ec2types.ResourceType{ec2types.ResourceTypeInstance, ec2types.ResourceTypeVolume} {
+		data.TagSpecifications = append(data.TagSpecifications, ec2types.LaunchTemplateTagSpecificationRequest{
+			ResourceType: resourceType,
+			Tags: []ec2types.Tag{
+				{Key: aws.String("Project"), Value: aws.String("tse")},
+				{Key: aws.String("Type"), Value: aws.String("ephemeral")},
+			},
+		})
+	}
+	return data
+}
+
+// launchTemplateVersion is the description deploy gives a version with the
+// current launchTemplateData
+func launchTemplateVersion() string {
+	encoded, _ := json.Marshal(launchTemplateData())
+	hash := sha256.Sum256(encoded)
+	return templateVersionPrefix + hex.EncodeToString(hash[:])[:12]
+}
+
+// launchTemplatesEnabled reports whether deploy manages launch templates. In
+// cross-account mode nodes launch in the target account, where ours don't exist.
+func launchTemplatesEnabled() bool {
+	return os.Getenv("TSE_ROLE_ARN") == ""
+}
+
+// launchTemplateStale reports whether the deploy region's template is missing
+// or its default version is out of date
+func launchTemplateStale(state *InfrastructureState) bool {
+	return launchTemplatesEnabled() &&
+		(state.LaunchTemplate == nil || state.LaunchTemplate.Tags["Version"] != launchTemplateVersion())
+}
+
+// launchTemplateEnvMissing reports whether a deployed Lambda predates launch
+// templates, so its environment (and policy) need updating to use them
+func launchTemplateEnvMissing(state *InfrastructureState) bool {
+	return launchTemplatesEnabled() && state.Lambda != nil && !slices.Contains(state.Config.LambdaEnvKeys, EnvLaunchTemplate)
+}
+
+// launchTemplateRegions lists the AWS regions exit nodes can start in
+func launchTemplateRegions() []string {
+	var awsRegions []string
+	for _, friendly := range regions.GetAllFriendlyNames() {
+		awsRegion, err := regions.GetAWSRegion(friendly)
+		if err == nil && !slices.Contains(awsRegions, awsRegion) {
+			awsRegions = append(awsRegions, awsRegion)
+		}
+	}
+	slices.Sort(awsRegions)
+	return awsRegions
+}
+
+// isRegionDisabledError reports whether an EC2 call failed because the account
+// hasn't enabled the region
+func isRegionDisabledError(err error) bool {
+	return isAPIError(err, "AuthFailure") || isAPIError(err, "OptInRequired") || isAPIError(err, "UnauthorizedOperation")
+}
+
+// isTemplateNotFound reports whether an EC2 call failed because the template doesn't exist
+func isTemplateNotFound(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && strings.Contains(apiErr.ErrorCode(), "NotFound")
+}
+
+// defaultTemplateVersion returns the description of the template's default
+// version in the client's region, or found=false if there's no template
+func defaultTemplateVersion(ctx context.Context, client *ec2.Client) (description string, found bool, err error) {
+	described, err := client.DescribeLaunchTemplateVersions(ctx, &ec2.DescribeLaunchTemplateVersionsInput{
+		LaunchTemplateName: aws.String(LaunchTemplateName),
+		Versions:           []string{"$Default"},
+	})
+	if err != nil {
+		if isTemplateNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	if len(described.LaunchTemplateVersions) == 0 {
+		return "", false, nil
+	}
+	return aws.ToString(described.LaunchTemplateVersions[0].VersionDescription), true, nil
+}
+
+// ensureLaunchTemplate creates the template in the client's region, or adds a
+// version with the current data and makes it the default if it's stale
+func ensureLaunchTemplate(ctx context.Context, client *ec2.Client) error {
+	version := launchTemplateVersion()
+	current, found, err := defaultTemplateVersion(ctx, client)
+	if err != nil {
+		return err
+	}
+	if found && current == version {
+		return nil
+	}
+
+	if !found {
+		tags := standardTags()
+		var templateTags []ec2types.Tag
+		for _, key := range slices.Sorted(maps.Keys(tags)) {
+			templateTags = append(templateTags, ec2types.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+		}
+		_, err := client.CreateLaunchTemplate(ctx, &ec2.CreateLaunchTemplateInput{
+			LaunchTemplateName: aws.String(LaunchTemplateName),
+			VersionDescription: aws.String(version),
+			LaunchTemplateData: launchTemplateData(),
+			TagSpecifications: []ec2types.TagSpecification{{
+				ResourceType: ec2types.ResourceTypeLaunchTemplate,
+				Tags:         templateTags,
+			}},
+		})
+		return err
+	}
+
+	created, err := client.CreateLaunchTemplateVersion(ctx, &ec2.CreateLaunchTemplateVersionInput{
+		LaunchTemplateName: aws.String(LaunchTemplateName),
+		VersionDescription: aws.String(version),
+		LaunchTemplateData: launchTemplateData(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = client.ModifyLaunchTemplate(ctx, &ec2.ModifyLaunchTemplateInput{
+		LaunchTemplateName: aws.String(LaunchTemplateName),
+		DefaultVersion:     aws.String(fmt.Sprint(aws.ToInt64(created.LaunchTemplateVersion.VersionNumber))),
+	})
+	return err
+}
+
+// launchTemplateTags returns the tags of the template in the client's region,
+// or found=false if there's no template
+func launchTemplateTags(ctx context.Context, client *ec2.Client) (tags map[string]string, found bool, err error) {
+	described, err := client.DescribeLaunchTemplates(ctx, &ec2.DescribeLaunchTemplatesInput{
+		LaunchTemplateNames: []string{LaunchTemplateName},
+	})
+	if err != nil {
+		if isTemplateNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	if len(described.LaunchTemplates) == 0 {
+		return nil, false, nil
+	}
+	tags = map[string]string{}
+	for _, tag := range described.LaunchTemplates[0].Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return tags, true, nil
+}
+
+// deleteLaunchTemplate deletes the template in the client's region, if it's
+// there and belongs to the deployment (see ownedBy; an empty one owns every template)
+func deleteLaunchTemplate(ctx context.Context, client *ec2.Client, deployment string) error {
+	tags, found, err := launchTemplateTags(ctx, client)
+	if err != nil || !found || !ownedBy(&Resource{Tags: tags}, deployment) {
+		return err
+	}
+	_, err = client.DeleteLaunchTemplate(ctx, &ec2.DeleteLaunchTemplateInput{
+		LaunchTemplateName: aws.String(LaunchTemplateName),
+	})
+	if isTemplateNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// inEveryRegion runs fn against each of awsRegions concurrently, with a copy
+// of client for the region, reporting progress through status. Regions the
+// account hasn't enabled are skipped.
+func inEveryRegion(ctx context.Context, client *ec2.Client, awsRegions []string, status func(string), fn func(context.Context, *ec2.Client) error) error {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		done int
+		errs []error
+	)
+	for _, awsRegion := range awsRegions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			regional := ec2.New(client.Options(), func(o *ec2.Options) { o.Region = awsRegion })
+			err := fn(ctx, regional)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && !isRegionDisabledError(err) {
+				errs = append(errs, fmt.Errorf("%s: %w", awsRegion, err))
+			}
+			done++
+			status(fmt.Sprintf("%d/%d regions", done, len(awsRegions)))
+		}()
+	}
+	wg.Wait()
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
+
+// launchTemplateSteps creates or updates the launch template in every region
+// when the deploy region's is missing or stale. Nothing in cross-account mode.
+func launchTemplateSteps(ctx context.Context, clients *AWSClients, state *InfrastructureState) []ui.Step {
+	if !launchTemplateStale(state) {
+		return nil
+	}
+	return []ui.Step{{Name: "Creating exit node launch templates", Run: func(status func(string)) error {
+		err := inEveryRegion(ctx, clients.EC2, launchTemplateRegions(), status, ensureLaunchTemplate)
+		if err != nil {
+			return fmt.Errorf("failed to create launch templates: %w", err)
+		}
+		return nil
+	}}}
+}
+
+// launchTemplateCalls lists the calls launchTemplateSteps makes
+func launchTemplateCalls(state *InfrastructureState) []string {
+	if !launchTemplateStale(state) {
+		return nil
+	}
+	params := fmt.Sprintf("LaunchTemplateName=%s ImageId=%s InstanceType=%s InstanceInitiatedShutdownBehavior=terminate (in each enabled region)",
+		LaunchTemplateName, templateImage, templateInstanceType)
+	if state.LaunchTemplate == nil {
+		return []string{"ec2:CreateLaunchTemplate " + params}
+	}
+	return []string{
+		"ec2:CreateLaunchTemplateVersion " + params,
+		fmt.Sprintf("ec2:ModifyLaunchTemplate LaunchTemplateName=%s SetDefaultVersion=(new version)", LaunchTemplateName),
+	}
+}
+
+// deleteLaunchTemplates deletes the deployment's launch template in every region,
+// leaving other deployments' alone
+func deleteLaunchTemplates(ctx context.Context, clients *AWSClients, deployment string, status func(string)) error {
+	deleteOwned := func(ctx context.Context, client *ec2.Client) error {
+		return deleteLaunchTemplate(ctx, client, deployment)
+	}
+	if err := inEveryRegion(ctx, clients.EC2, launchTemplateRegions(), status, deleteOwned); err != nil {
+		return fmt.Errorf("failed to delete launch templates: %w", err)
+	}
+	return nil
+}
+
+// discoverLaunchTemplate finds the deploy region's launch template, keeping its
+// default version's description in Tags["Version"]. Like the alarm, a failed
+// lookup counts as "not deployed".
+func discoverLaunchTemplate(ctx context.Context, clients *AWSClients, state *InfrastructureState) {
+	if description, found, err := defaultTemplateVersion(ctx, clients.EC2); err == nil && found {
+		state.LaunchTemplate = &Resource{Name: LaunchTemplateName, Tags: map[string]string{"Version": description}}
+	}
+}
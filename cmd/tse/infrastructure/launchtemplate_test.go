@@ -0,0 +1,133 @@
+package infrastructure
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// testEC2 returns an EC2 client pointed at server with static credentials,
+// failing without retries
+func testEC2(server *httptest.Server) *ec2.Client {
+	return ec2.New(ec2.Options{
+		Region:           "us-east-2",
+		Credentials:      credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", ""),
+		BaseEndpoint:     aws.String(server.URL),
+		RetryMaxAttempts: 1,
+	})
+}
+
+// fakeEC2 answers launch template calls, recording each action
+type fakeEC2 struct {
+	mu      sync.Mutex
+	actions []string
+	version string // Default version's description; empty means no template
+	owner   string // Template's tse:deployment tag, if any
+	errCode string // Error every call fails with, if set
+}
+
+func (f *fakeEC2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	form, _ := url.ParseQuery(string(body))
+	action := form.Get("Action")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.actions = append(f.actions, action)
+
+	fail := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `<Response><Errors><Error><Code>`+code+`</Code><Message>nope</Message></Error></Errors><RequestID>1</RequestID></Response>`)
+	}
+	switch {
+	case f.errCode != "":
+		fail(f.errCode)
+	case strings.HasPrefix(action, "DescribeLaunchTemplate") && f.version == "":
+		fail("InvalidLaunchTemplateName.NotFoundException")
+	case action == "DescribeLaunchTemplates":
+		io.WriteString(w, `<DescribeLaunchTemplatesResponse><launchTemplates><item><tagSet><item><key>`+TagDeployment+`</key><value>`+f.owner+`</value></item></tagSet></item></launchTemplates></DescribeLaunchTemplatesResponse>`)
+	case action == "DescribeLaunchTemplateVersions":
+		io.WriteString(w, `<DescribeLaunchTemplateVersionsResponse><launchTemplateVersionSet><item><versionDescription>`+f.version+`</versionDescription></item></launchTemplateVersionSet></DescribeLaunchTemplateVersionsResponse>`)
+	case action == "CreateLaunchTemplateVersion":
+		io.WriteString(w, `<CreateLaunchTemplateVersionResponse><launchTemplateVersion><versionNumber>3</versionNumber></launchTemplateVersion></CreateLaunchTemplateVersionResponse>`)
+	case action == "ModifyLaunchTemplate" && form.Get("SetDefaultVersion") != "3":
+		fail("InvalidParameterValue")
+	default:
+		io.WriteString(w, `<Response/>`)
+	}
+}
+
+func TestEnsureLaunchTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    []string
+	}{
+		{name: "missing", want: []string{"DescribeLaunchTemplateVersions", "CreateLaunchTemplate"}},
+		{name: "stale", version: "tse 000000000000", want: []string{"DescribeLaunchTemplateVersions", "CreateLaunchTemplateVersion", "ModifyLaunchTemplate"}},
+		{name: "current", version: launchTemplateVersion(), want: []string{"DescribeLaunchTemplateVersions"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeEC2{version: tt.version}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			if err := ensureLaunchTemplate(context.Background(), testEC2(server)); err != nil {
+				t.Fatalf("ensureLaunchTemplate() error = %v", err)
+			}
+			if !slices.Equal(fake.actions, tt.want) {
+				t.Errorf("actions = %v, want %v", fake.actions, tt.want)
+			}
+		})
+	}
+}
+
+func TestInEveryRegionSkipsDisabledRegions(t *testing.T) {
+	fake := &fakeEC2{errCode: "AuthFailure"}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	var last string
+	err := inEveryRegion(context.Background(), testEC2(server), []string{"us-east-2", "me-south-1"}, func(s string) { last = s }, ensureLaunchTemplate)
+	if err != nil {
+		t.Errorf("inEveryRegion() error = %v, want disabled regions skipped", err)
+	}
+	if last != "2/2 regions" {
+		t.Errorf("last status = %q", last)
+	}
+
+	fake.errCode = "InternalError"
+	err = inEveryRegion(context.Background(), testEC2(server), []string{"us-east-2", "me-south-1"}, func(string) {}, ensureLaunchTemplate)
+	if err == nil || !strings.Contains(err.Error(), "me-south-1: ") || !strings.Contains(err.Error(), "us-east-2: ") {
+		t.Errorf("inEveryRegion() error = %v, want both regions' errors", err)
+	}
+}
+
+func TestLaunchTemplatesCrossAccount(t *testing.T) {
+	clearOptionEnv(t)
+	state := deployedState()
+	state.LaunchTemplate = nil
+	if calls := launchTemplateCalls(state); len(calls) != 1 || !strings.HasPrefix(calls[0], "ec2:CreateLaunchTemplate ") {
+		t.Errorf("launchTemplateCalls() = %v, want CreateLaunchTemplate", calls)
+	}
+
+	// Nodes launch in the target account, which doesn't have our templates
+	t.Setenv("TSE_ROLE_ARN", "arn:aws:iam::210987654321:role/tse")
+	if calls := launchTemplateCalls(state); calls != nil {
+		t.Errorf("launchTemplateCalls() = %v, want nothing in cross-account mode", calls)
+	}
+	if _, ok := resourceEnvironment()[EnvLaunchTemplate]; ok {
+		t.Errorf("%s set in cross-account mode", EnvLaunchTemplate)
+	}
+}
@@ -0,0 +1,357 @@
+package infrastructure
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cwltypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// CloudWatch Logs allows a handful of FilterLogEvents calls per second per
+	// account; stay under it so a long export doesn't starve the Lambda's own tooling
+	exportRequestInterval = 250 * time.Millisecond
+
+	// Retries per page before giving up (the checkpoint makes giving up cheap)
+	exportMaxAttempts = 10
+
+	// Extra pause after a page still fails with throttling once retries are spent
+	exportThrottleBackoff = 5 * time.Second
+	exportThrottleRetries = 3
+)
+
+// Kinds of exported log lines
+const (
+	LogKindPlatform = "platform" // Lambda runtime START/END/REPORT/INIT lines
+	LogKindAudit    = "audit"    // AUDIT: lines from recordAudit
+	LogKindMetric   = "metric"   // Embedded Metric Format lines
+	LogKindJSON     = "json"     // Any other JSON line
+	LogKindText     = "text"     // Everything else
+)
+
+// LogRecord is one line of a log export. Exports are gzipped JSON Lines, so
+// `zcat tse-logs.json.gz | jq` works without any TSE tooling.
+type LogRecord struct {
+	Time     time.Time       `json:"time"`
+	Ingested time.Time       `json:"ingested"`
+	Stream   string          `json:"stream"`
+	EventID  string          `json:"event_id"`
+	Kind     string          `json:"kind"`
+	Message  string          `json:"message"`
+	Data     json.RawMessage `json:"data,omitempty"` // Parsed payload for audit, metric and json lines
+}
+
+// LogExportOptions describes what to export and where
+type LogExportOptions struct {
+	LogGroup string
+	Since    time.Time
+	Until    time.Time
+	Out      string
+}
+
+// LogExportResult summarizes a finished export
+type LogExportResult struct {
+	Events  int  // Total events in the file
+	Pages   int  // Pages fetched by this run
+	Resumed bool // Whether this run continued an earlier interrupted export
+	Bytes   int64
+}
+
+// exportCheckpoint is saved next to the output after every page so an
+// interrupted export can pick up where it stopped
+type exportCheckpoint struct {
+	LogGroup  string `json:"log_group"`
+	StartTime int64  `json:"start_time"`
+	EndTime   int64  `json:"end_time"`
+	NextToken string `json:"next_token"`
+	Offset    int64  `json:"offset"` // Bytes of complete gzip members in the output
+	Events    int    `json:"events"`
+}
+
+// CheckpointPath returns where the resume checkpoint for an export to out lives
+func CheckpointPath(out string) string {
+	return out + ".checkpoint"
+}
+
+// filterLogEventsAPI is the slice of the CloudWatch Logs client the export uses
+type filterLogEventsAPI interface {
+	FilterLogEvents(ctx context.Context, params *cloudwatchlogs.FilterLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.FilterLogEventsOutput, error)
+}
+
+// ExportLogs pages through the Lambda's log group and writes every event to
+// opts.Out. If a checkpoint from an earlier run with the same log group is
+// found, the export resumes from it instead of starting over.
+func ExportLogs(ctx context.Context, clients *AWSClients, opts LogExportOptions) (*LogExportResult, error) {
+	return exportLogs(ctx, clients.Logs, opts, exportRequestInterval)
+}
+
+func exportLogs(ctx context.Context, api filterLogEventsAPI, opts LogExportOptions, interval time.Duration) (*LogExportResult, error) {
+	checkpointPath := CheckpointPath(opts.Out)
+	checkpoint, err := loadCheckpoint(checkpointPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &LogExportResult{}
+	var file *os.File
+	if checkpoint != nil && checkpoint.LogGroup == opts.LogGroup {
+		// Resume: drop anything written after the last complete page
+		file, err = os.OpenFile(opts.Out, os.O_RDWR, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("found %s but can't reopen %s to resume (delete the checkpoint to start over): %w", checkpointPath, opts.Out, err)
+		}
+		if err := file.Truncate(checkpoint.Offset); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to truncate %s: %w", opts.Out, err)
+		}
+		result.Resumed = true
+	} else {
+		file, err = os.OpenFile(opts.Out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", opts.Out, err)
+		}
+		checkpoint = &exportCheckpoint{
+			LogGroup:  opts.LogGroup,
+			StartTime: opts.Since.UnixMilli(),
+			EndTime:   opts.Until.UnixMilli(),
+		}
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(checkpoint.Offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek %s: %w", opts.Out, err)
+	}
+
+	// One adaptive retryer for the whole export so its client-side rate
+	// limit carries over from page to page
+	retryer := retry.AddWithMaxAttempts(retry.NewAdaptiveMode(), exportMaxAttempts)
+	withRetryer := func(o *cloudwatchlogs.Options) { o.Retryer = retryer }
+
+	var last time.Time
+	for {
+		if wait := interval - time.Since(last); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return result, ctx.Err()
+			}
+		}
+		last = time.Now()
+
+		input := &cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName: aws.String(checkpoint.LogGroup),
+			StartTime:    aws.Int64(checkpoint.StartTime),
+			EndTime:      aws.Int64(checkpoint.EndTime),
+		}
+		if checkpoint.NextToken != "" {
+			input.NextToken = aws.String(checkpoint.NextToken)
+		}
+
+		page, err := filterLogEventsPage(ctx, api, input, withRetryer)
+		if err != nil {
+			result.Events = checkpoint.Events
+			result.Bytes = checkpoint.Offset
+			return result, fmt.Errorf("failed to fetch log events: %w", err)
+		}
+		result.Pages++
+
+		if len(page.Events) > 0 {
+			n, err := writeLogPage(file, page.Events)
+			if err != nil {
+				return result, fmt.Errorf("failed to write %s: %w", opts.Out, err)
+			}
+			checkpoint.Offset += n
+			checkpoint.Events += len(page.Events)
+		}
+
+		if page.NextToken == nil || *page.NextToken == "" {
+			break
+		}
+		checkpoint.NextToken = *page.NextToken
+		if err := saveCheckpoint(checkpointPath, checkpoint); err != nil {
+			return result, err
+		}
+	}
+
+	if err := file.Truncate(checkpoint.Offset); err != nil {
+		return result, fmt.Errorf("failed to finish %s: %w", opts.Out, err)
+	}
+	if err := os.Remove(checkpointPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return result, fmt.Errorf("failed to remove %s: %w", checkpointPath, err)
+	}
+
+	result.Events = checkpoint.Events
+	result.Bytes = checkpoint.Offset
+	return result, nil
+}
+
+// filterLogEventsPage fetches one page, backing off a little longer if the
+// SDK's retries still end in throttling
+func filterLogEventsPage(ctx context.Context, api filterLogEventsAPI, input *cloudwatchlogs.FilterLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	for attempt := 0; ; attempt++ {
+		page, err := api.FilterLogEvents(ctx, input, optFns...)
+		if err == nil || !isThrottling(err) || attempt >= exportThrottleRetries {
+			return page, err
+		}
+		select {
+		case <-time.After(exportThrottleBackoff * time.Duration(attempt+1)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// isThrottling reports whether err is CloudWatch Logs asking us to slow down
+func isThrottling(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "ThrottlingException", "LimitExceededException", "RequestLimitExceeded":
+		return true
+	}
+	return false
+}
+
+// writeLogPage appends one page of events as a complete gzip member and
+// returns the bytes written. Concatenated gzip members are a valid gzip file,
+// so a resumed export reads back as one stream.
+func writeLogPage(w io.Writer, events []cwltypes.FilteredLogEvent) (int64, error) {
+	counter := &countingWriter{w: w}
+	gz := gzip.NewWriter(counter)
+	enc := json.NewEncoder(gz)
+	for _, event := range events {
+		if err := enc.Encode(newLogRecord(event)); err != nil {
+			return 0, err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+// newLogRecord classifies a CloudWatch event and parses any structured payload
+func newLogRecord(event cwltypes.FilteredLogEvent) LogRecord {
+	message := strings.TrimRight(aws.ToString(event.Message), "\n")
+	record := LogRecord{
+		Time:     time.UnixMilli(aws.ToInt64(event.Timestamp)).UTC(),
+		Ingested: time.UnixMilli(aws.ToInt64(event.IngestionTime)).UTC(),
+		Stream:   aws.ToString(event.LogStreamName),
+		EventID:  aws.ToString(event.EventId),
+		Kind:     LogKindText,
+		Message:  message,
+	}
+
+	// The Go runtime's log package prefixes a timestamp; AUDIT: may follow it
+	if i := strings.Index(message, "AUDIT: "); i >= 0 && json.Valid([]byte(message[i+len("AUDIT: "):])) {
+		record.Kind = LogKindAudit
+		record.Data = json.RawMessage(message[i+len("AUDIT: "):])
+		return record
+	}
+
+	for _, prefix := range []string{"START ", "END ", "REPORT ", "INIT_START ", "INIT_REPORT "} {
+		if strings.HasPrefix(message, prefix) {
+			record.Kind = LogKindPlatform
+			return record
+		}
+	}
+
+	if strings.HasPrefix(message, "{") && json.Valid([]byte(message)) {
+		record.Kind = LogKindJSON
+		if strings.Contains(message, `"_aws"`) {
+			record.Kind = LogKindMetric
+		}
+		record.Data = json.RawMessage(message)
+	}
+	return record
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// loadCheckpoint reads a checkpoint, returning nil if there isn't one
+func loadCheckpoint(path string) (*exportCheckpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var checkpoint exportCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("corrupt checkpoint %s (delete it to start over): %w", path, err)
+	}
+	return &checkpoint, nil
+}
+
+// saveCheckpoint writes a checkpoint atomically so a crash can't leave half of one
+func saveCheckpoint(path string, checkpoint *exportCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// RecentLogs returns up to limit of the most recent log events since the given time
+func RecentLogs(ctx context.Context, clients *AWSClients, since time.Time, limit int) ([]LogRecord, error) {
+	return recentLogs(ctx, clients.Logs, since, limit)
+}
+
+func recentLogs(ctx context.Context, api filterLogEventsAPI, since time.Time, limit int) ([]LogRecord, error) {
+	input := &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName: aws.String(LogGroupName),
+		StartTime:    aws.Int64(since.UnixMilli()),
+	}
+
+	// Events come back oldest first, so keep a sliding window of the newest
+	var records []LogRecord
+	for {
+		page, err := filterLogEventsPage(ctx, api, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch log events: %w", err)
+		}
+		for _, event := range page.Events {
+			records = append(records, newLogRecord(event))
+		}
+		if len(records) > limit {
+			records = records[len(records)-limit:]
+		}
+
+		if page.NextToken == nil || *page.NextToken == "" {
+			return records, nil
+		}
+		input.NextToken = page.NextToken
+	}
+}
@@ -0,0 +1,190 @@
+package infrastructure
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cwltypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/smithy-go"
+)
+
+// fakeLogs serves pages keyed by NextToken and fails once on failToken
+type fakeLogs struct {
+	pages     map[string]*cloudwatchlogs.FilterLogEventsOutput
+	failToken string
+	calls     []string
+}
+
+func (f *fakeLogs) FilterLogEvents(ctx context.Context, params *cloudwatchlogs.FilterLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	token := aws.ToString(params.NextToken)
+	f.calls = append(f.calls, token)
+	if token != "" && token == f.failToken {
+		f.failToken = ""
+		return nil, errors.New("connection reset")
+	}
+	return f.pages[token], nil
+}
+
+func logEvent(id, message string) cwltypes.FilteredLogEvent {
+	return cwltypes.FilteredLogEvent{
+		EventId:       aws.String(id),
+		Message:       aws.String(message),
+		LogStreamName: aws.String("2025/01/02/[$LATEST]abc"),
+		Timestamp:     aws.Int64(1735787045000),
+		IngestionTime: aws.Int64(1735787046000),
+	}
+}
+
+func readExport(t *testing.T, path string) []LogRecord {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []LogRecord
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var record LogRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("bad line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("reading export: %v", err)
+	}
+	return records
+}
+
+func TestExportLogsResumes(t *testing.T) {
+	api := &fakeLogs{
+		failToken: "p3",
+		pages: map[string]*cloudwatchlogs.FilterLogEventsOutput{
+			"":   {Events: []cwltypes.FilteredLogEvent{logEvent("1", "one"), logEvent("2", "two")}, NextToken: aws.String("p2")},
+			"p2": {NextToken: aws.String("p3")}, // Empty pages still carry a token
+			"p3": {Events: []cwltypes.FilteredLogEvent{logEvent("3", "three")}, NextToken: aws.String("p4")},
+			"p4": {Events: []cwltypes.FilteredLogEvent{logEvent("4", "four")}},
+		},
+	}
+	opts := LogExportOptions{
+		LogGroup: LogGroupName,
+		Since:    time.Now().Add(-time.Hour),
+		Until:    time.Now(),
+		Out:      filepath.Join(t.TempDir(), "tse-logs.json.gz"),
+	}
+
+	result, err := exportLogs(context.Background(), api, opts, 0)
+	if err == nil {
+		t.Fatal("first run should fail on p3")
+	}
+	if result.Events != 2 {
+		t.Errorf("events before failure = %d, want 2", result.Events)
+	}
+	if _, err := os.Stat(CheckpointPath(opts.Out)); err != nil {
+		t.Fatalf("checkpoint should survive a failure: %v", err)
+	}
+
+	result, err = exportLogs(context.Background(), api, opts, 0)
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if !result.Resumed || result.Events != 4 {
+		t.Errorf("result = %+v, want resumed with 4 events", result)
+	}
+	if _, err := os.Stat(CheckpointPath(opts.Out)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("checkpoint should be removed after a complete export: %v", err)
+	}
+
+	wantCalls := []string{"", "p2", "p3", "p3", "p4"}
+	if fmt.Sprint(api.calls) != fmt.Sprint(wantCalls) {
+		t.Errorf("calls = %q, want %q", api.calls, wantCalls)
+	}
+
+	records := readExport(t, opts.Out)
+	var messages []string
+	for _, record := range records {
+		messages = append(messages, record.Message)
+	}
+	if fmt.Sprint(messages) != "[one two three four]" {
+		t.Errorf("messages = %v, want each event exactly once", messages)
+	}
+}
+
+func TestNewLogRecord(t *testing.T) {
+	tests := []struct {
+		message  string
+		wantKind string
+		wantData bool
+	}{
+		{message: "START RequestId: 1 Version: $LATEST\n", wantKind: LogKindPlatform},
+		{message: `2025/01/02 03:04:05 AUDIT: {"action":"start","region":"ohio"}`, wantKind: LogKindAudit, wantData: true},
+		{message: `{"_aws":{"Timestamp":1},"RunningNodes":1}`, wantKind: LogKindMetric, wantData: true},
+		{message: `{"level":"info"}`, wantKind: LogKindJSON, wantData: true},
+		{message: "2025/01/02 03:04:05 Starting instance in us-east-2", wantKind: LogKindText},
+		{message: "AUDIT: not json", wantKind: LogKindText},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantKind, func(t *testing.T) {
+			record := newLogRecord(logEvent("1", tt.message))
+			if record.Kind != tt.wantKind {
+				t.Errorf("Kind = %q, want %q", record.Kind, tt.wantKind)
+			}
+			if (record.Data != nil) != tt.wantData {
+				t.Errorf("Data = %s, want data: %v", record.Data, tt.wantData)
+			}
+			if !record.Time.Equal(time.UnixMilli(1735787045000)) {
+				t.Errorf("Time = %v", record.Time)
+			}
+		})
+	}
+}
+
+func TestIsThrottling(t *testing.T) {
+	if !isThrottling(fmt.Errorf("wrapped: %w", &smithy.GenericAPIError{Code: "ThrottlingException"})) {
+		t.Error("ThrottlingException should count as throttling")
+	}
+	if isThrottling(&smithy.GenericAPIError{Code: "ResourceNotFoundException"}) {
+		t.Error("ResourceNotFoundException is not throttling")
+	}
+	if isThrottling(errors.New("connection reset")) {
+		t.Error("plain errors are not throttling")
+	}
+}
+
+func TestRecentLogsKeepsNewest(t *testing.T) {
+	api := &fakeLogs{
+		pages: map[string]*cloudwatchlogs.FilterLogEventsOutput{
+			"":   {Events: []cwltypes.FilteredLogEvent{logEvent("1", "one"), logEvent("2", "two")}, NextToken: aws.String("p2")},
+			"p2": {Events: []cwltypes.FilteredLogEvent{logEvent("3", "three")}},
+		},
+	}
+
+	records, err := recentLogs(context.Background(), api, time.Now().Add(-time.Hour), 2)
+	if err != nil {
+		t.Fatalf("recentLogs: %v", err)
+	}
+	var messages []string
+	for _, record := range records {
+		messages = append(messages, record.Message)
+	}
+	if fmt.Sprint(messages) != "[two three]" {
+		t.Errorf("messages = %v, want the newest two", messages)
+	}
+}
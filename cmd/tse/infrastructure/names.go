@@ -0,0 +1,121 @@
+package infrastructure
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+)
+
+const (
+	// DefaultNamePrefix starts every resource name unless a deployment chose
+	// its own (tse deploy --name-prefix, for accounts with naming policies)
+	DefaultNamePrefix = "tailscale-exits"
+	EnvNamePrefix     = "TSE_NAME_PREFIX"
+
+	// TagNamePrefix records a custom prefix on the resources deployed with it
+	TagNamePrefix = "tse:name-prefix"
+)
+
+// Resource names, all derived from the name prefix by SetNamePrefix
+var (
+	FunctionName     string
+	RoleName         string
+	InlinePolicyName string
+	LogGroupName     string
+	TableName        string
+
+	// Exit nodes run with this instance profile so they can tag themselves ready
+	NodeRoleName            string
+	NodePolicyName          string
+	NodeInstanceProfileName string
+
+	// Optional node age alarm (tse deploy --alarm-hours)
+	AlarmName        string
+	AlarmTopicName   string
+	ScheduleRuleName string
+
+	// Optional warm-keeper (tse deploy --keep-warm)
+	WarmRuleName string
+
+	// Optional Step Functions orchestration (tse deploy --orchestration stepfunctions):
+	// the state machine, and the role it invokes the Lambda with
+	WorkflowName       string
+	WorkflowRoleName   string
+	WorkflowPolicyName string
+
+	// Exit nodes launch from this template, kept in every region by deploy, so
+	// their configuration can be audited in the EC2 console
+	LaunchTemplateName string
+)
+
+// namePrefix is the prefix the names above were derived from
+var namePrefix string
+
+// validNamePrefix keeps every derived name within what Lambda, IAM, DynamoDB,
+// SNS, EventBridge, Step Functions and EC2 accept; the longest suffix is "-lambda-ec2-policy"
+var validNamePrefix = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{2,39}$`)
+
+func init() {
+	setNames(DefaultNamePrefix)
+}
+
+// SetNamePrefix derives every resource name from prefix; empty means the default
+func SetNamePrefix(prefix string) error {
+	if prefix == "" {
+		prefix = DefaultNamePrefix
+	}
+	if err := ValidateNamePrefix(prefix); err != nil {
+		return err
+	}
+	setNames(prefix)
+	return nil
+}
+
+// ValidateNamePrefix checks that every name derived from prefix is valid
+func ValidateNamePrefix(prefix string) error {
+	if !validNamePrefix.MatchString(prefix) {
+		return fmt.Errorf("invalid name prefix %s: use 3 to 40 letters, digits, hyphens or underscores, starting with a letter or digit", ui.Highlight(prefix))
+	}
+	return nil
+}
+
+// NamePrefixFromEnv applies TSE_NAME_PREFIX, which the active profile or .env
+// sets for deployments with a custom prefix
+func NamePrefixFromEnv() error {
+	if err := SetNamePrefix(os.Getenv(EnvNamePrefix)); err != nil {
+		return fmt.Errorf("%s: %w", EnvNamePrefix, err)
+	}
+	return nil
+}
+
+// NamePrefix returns the prefix resource names are derived from
+func NamePrefix() string {
+	return namePrefix
+}
+
+// CustomNamePrefix reports whether the names use a prefix other than the default
+func CustomNamePrefix() bool {
+	return namePrefix != DefaultNamePrefix
+}
+
+func setNames(prefix string) {
+	namePrefix = prefix
+	FunctionName = prefix
+	RoleName = prefix + "-lambda-role"
+	InlinePolicyName = prefix + "-lambda-ec2-policy"
+	LogGroupName = "/aws/lambda/" + prefix
+	TableName = prefix
+	NodeRoleName = prefix + "-node-role"
+	NodePolicyName = prefix + "-node-tags-policy"
+	NodeInstanceProfileName = prefix + "-node"
+	AlarmName = prefix + "-node-age"
+	AlarmTopicName = prefix + "-alerts"
+	ScheduleRuleName = prefix + "-metrics"
+	WarmRuleName = prefix + "-warm"
+	WorkflowName = prefix + "-workflows" // The Lambda derives it from its own name
+	WorkflowRoleName = prefix + "-states-role"
+	WorkflowPolicyName = prefix + "-states-invoke"
+	LaunchTemplateName = prefix + "-node"
+}
@@ -0,0 +1,59 @@
+package infrastructure
+
+import "testing"
+
+func TestSetNamePrefix(t *testing.T) {
+	t.Cleanup(func() { setNames(DefaultNamePrefix) })
+
+	if err := SetNamePrefix("acme-vpn"); err != nil {
+		t.Fatalf("SetNamePrefix() error = %v", err)
+	}
+	names := []struct{ got, want string }{
+		{FunctionName, "acme-vpn"},
+		{RoleName, "acme-vpn-lambda-role"},
+		{LogGroupName, "/aws/lambda/acme-vpn"},
+		{NodeInstanceProfileName, "acme-vpn-node"},
+		{warmRule().Name, "acme-vpn-warm"},
+		{metricsRule().Name, "acme-vpn-metrics"},
+		{WorkflowName, "acme-vpn-workflows"},
+		{WorkflowRoleName, "acme-vpn-states-role"},
+	}
+	for _, name := range names {
+		if name.got != name.want {
+			t.Errorf("name = %q, want %q", name.got, name.want)
+		}
+	}
+	if standardTags()[TagNamePrefix] != "acme-vpn" {
+		t.Errorf("standardTags() = %v, want the custom prefix recorded", standardTags())
+	}
+
+	// Empty goes back to the default, which isn't tagged
+	if err := SetNamePrefix(""); err != nil || FunctionName != DefaultNamePrefix {
+		t.Errorf("SetNamePrefix(\"\") = %v, FunctionName = %q", err, FunctionName)
+	}
+	if _, ok := standardTags()[TagNamePrefix]; ok {
+		t.Errorf("standardTags() = %v, want no prefix tag for the default", standardTags())
+	}
+}
+
+func TestValidateNamePrefix(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		wantErr bool
+	}{
+		{prefix: "acme-vpn"},
+		{prefix: "team_7"},
+		{prefix: "ab", wantErr: true},
+		{prefix: "-leading", wantErr: true},
+		{prefix: "has space", wantErr: true},
+		{prefix: "a-prefix-far-too-long-for-the-iam-role-names", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			if err := ValidateNamePrefix(tt.prefix); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateNamePrefix() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
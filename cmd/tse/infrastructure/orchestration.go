@@ -0,0 +1,400 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	sfntypes "github.com/aws/aws-sdk-go-v2/service/sfn/types"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+)
+
+const (
+	// Optional Step Functions orchestration (tse deploy --orchestration): async
+	// starts, stops and cleanups run as a state machine that invokes the Lambda
+	// step by step, instead of in one invocation that has to fit its timeout
+	EnvOrchestration = "TSE_ORCHESTRATION"
+
+	OrchestrationLambda        = "lambda"
+	OrchestrationStepFunctions = "stepfunctions"
+
+	// How long the workflow waits between readiness checks, and for terminated
+	// instances to let go of their VPC; the Lambda waits as long when it runs
+	// the same steps itself
+	workflowReadyWait    = 15
+	workflowVPCWait      = 30
+	workflowVPCRetries   = 3
+	workflowTimeoutHours = 1
+)
+
+// Orchestration reads TSE_ORCHESTRATION: stepfunctions to run async jobs as a
+// state machine, lambda to run them in the Lambda (removing a deployed state
+// machine). set is false when it's unset, which leaves the deployment as it is.
+func Orchestration() (mode string, set bool, err error) {
+	mode = strings.ToLower(strings.TrimSpace(os.Getenv(EnvOrchestration)))
+	switch mode {
+	case "":
+		return OrchestrationLambda, false, nil
+	case OrchestrationLambda, OrchestrationStepFunctions:
+		return mode, true, nil
+	}
+	return "", false, fmt.Errorf("%s must be %s or %s, got %q", EnvOrchestration, OrchestrationLambda, OrchestrationStepFunctions, mode)
+}
+
+// orchestrationSet reports whether an orchestration was chosen, so the Lambda's
+// environment and policy have to be brought up to date
+func orchestrationSet() bool {
+	_, set, _ := Orchestration()
+	return set
+}
+
+// stepFunctionsOn reports whether TSE_ORCHESTRATION asks for the state machine
+func stepFunctionsOn() bool {
+	mode, _, _ := Orchestration()
+	return mode == OrchestrationStepFunctions
+}
+
+// workflowSteps creates or updates the state machine when TSE_ORCHESTRATION is
+// stepfunctions. They go before the Lambda is pointed at it. lambdaARN is read
+// when the step runs.
+func workflowSteps(ctx context.Context, clients *AWSClients, state *InfrastructureState, lambdaARN *string) []ui.Step {
+	if !stepFunctionsOn() {
+		return nil
+	}
+	return []ui.Step{{Name: "Creating the Step Functions workflow", Run: func(status func(string)) error {
+		return ensureWorkflow(ctx, clients, state, *lambdaARN, status)
+	}}}
+}
+
+// removeWorkflowSteps removes a deployed state machine when TSE_ORCHESTRATION
+// is lambda. They go after the Lambda stops using it.
+func removeWorkflowSteps(ctx context.Context, clients *AWSClients, state *InfrastructureState) []ui.Step {
+	mode, set, _ := Orchestration()
+	if !set || mode != OrchestrationLambda || state.Workflow == nil && state.WorkflowRole == nil {
+		return nil
+	}
+	return []ui.Step{step("Removing the Step Functions workflow", func() error {
+		return deleteWorkflow(ctx, clients, state.Workflow, state.WorkflowRole)
+	})}
+}
+
+// workflowCalls lists the calls workflowSteps and removeWorkflowSteps make
+func workflowCalls(state *InfrastructureState, lambdaARN string) []string {
+	mode, set, _ := Orchestration()
+	switch {
+	case mode == OrchestrationStepFunctions:
+		calls := []string{
+			"iam:CreateRole RoleName=" + WorkflowRoleName + " Principal=states.amazonaws.com (unless it exists)",
+			fmt.Sprintf("iam:PutRolePolicy RoleName=%s PolicyName=%s", WorkflowRoleName, WorkflowPolicyName),
+		}
+		if state.Workflow != nil {
+			return append(calls, fmt.Sprintf("states:UpdateStateMachine StateMachineArn=%s Definition=(invokes %s)", state.Workflow.ARN, lambdaARN))
+		}
+		return append(calls, fmt.Sprintf("states:CreateStateMachine Name=%s Type=STANDARD Definition=(invokes %s)", WorkflowName, lambdaARN))
+	case set && (state.Workflow != nil || state.WorkflowRole != nil):
+		return deleteWorkflowCalls(state.Workflow, state.WorkflowRole)
+	}
+	return nil
+}
+
+// deleteWorkflowCalls lists the calls deleteWorkflow makes
+func deleteWorkflowCalls(workflow, role *Resource) []string {
+	var calls []string
+	if workflow != nil {
+		calls = append(calls, "states:DeleteStateMachine StateMachineArn="+workflow.ARN)
+	}
+	if role != nil {
+		calls = append(calls,
+			fmt.Sprintf("iam:DeleteRolePolicy RoleName=%s PolicyName=%s", role.Name, WorkflowPolicyName),
+			"iam:DeleteRole RoleName="+role.Name)
+	}
+	return calls
+}
+
+// workflowDefinition is the state machine, in Amazon States Language. Each
+// task invokes the Lambda with {"tse_step": step, "run": state} and takes the
+// jobRun it returns as the new state. A start launches the node, then checks
+// every workflowReadyWait seconds until it's ready; a stop terminates the nodes,
+// waits, then removes their VPC, retrying while they hold on to it. Any step
+// that fails ends in the fail step, which records the job as failed.
+func workflowDefinition(lambdaARN string) string {
+	lambdaRetry := map[string]any{
+		"ErrorEquals":     []string{"Lambda.ServiceException", "Lambda.AWSLambdaException", "Lambda.SdkClientException", "Lambda.TooManyRequestsException"},
+		"IntervalSeconds": 2,
+		"MaxAttempts":     3,
+		"BackoffRate":     2,
+	}
+	task := func(step, next string, retry ...map[string]any) map[string]any {
+		state := map[string]any{
+			"Type":     "Task",
+			"Resource": "arn:aws:states:::lambda:invoke",
+			"Parameters": map[string]any{
+				"FunctionName": lambdaARN,
+				"Payload":      map[string]any{"tse_step": step, "run.$": "$"},
+			},
+			"OutputPath": "$.Payload",
+			"Retry":      append([]map[string]any{lambdaRetry}, retry...),
+			"Next":       next,
+		}
+		if step != "finish" && step != "fail" {
+			state["Catch"] = []map[string]any{{"ErrorEquals": []string{"States.ALL"}, "ResultPath": "$.error", "Next": "RecordFailure"}}
+		}
+		return state
+	}
+
+	states := map[string]any{
+		"Route": map[string]any{
+			"Type": "Choice",
+			"Choices": []map[string]any{
+				{"Variable": "$.tse_job.kind", "StringEquals": "start", "Next": "Launch"},
+				{"Variable": "$.tse_job.kind", "StringEquals": "stop", "Next": "Terminate"},
+			},
+			"Default": "Cleanup",
+		},
+
+		"Launch": task("launch", "NodeReady"),
+		"NodeReady": map[string]any{
+			"Type": "Choice",
+			"Choices": []map[string]any{{
+				"And": []map[string]any{
+					{"Variable": "$.phase", "IsPresent": true},
+					{"Variable": "$.phase", "StringEquals": "ready"},
+				},
+				"Next": "RecordSuccess",
+			}},
+			"Default": "WaitForNode",
+		},
+		"WaitForNode": map[string]any{"Type": "Wait", "Seconds": workflowReadyWait, "Next": "CheckNode"},
+		"CheckNode":   task("check", "NodeReady"),
+
+		"Terminate": task("terminate", "AnyTerminated"),
+		"AnyTerminated": map[string]any{
+			"Type":    "Choice",
+			"Choices": []map[string]any{{"Variable": "$.stopped.terminated_count", "NumericEquals": 0, "Next": "RecordSuccess"}},
+			"Default": "WaitForTermination",
+		},
+		"WaitForTermination": map[string]any{"Type": "Wait", "Seconds": workflowVPCWait, "Next": "RemoveVPC"},
+		"RemoveVPC": task("remove_vpc", "RecordSuccess", map[string]any{
+			"ErrorEquals":     []string{"States.TaskFailed"},
+			"IntervalSeconds": workflowVPCWait,
+			"MaxAttempts":     workflowVPCRetries,
+			"BackoffRate":     1,
+		}),
+
+		"Cleanup": task("cleanup", "RecordSuccess", map[string]any{
+			"ErrorEquals":     []string{"States.TaskFailed"},
+			"IntervalSeconds": workflowVPCWait,
+			"MaxAttempts":     2,
+			"BackoffRate":     1,
+		}),
+
+		"RecordSuccess": task("finish", "Succeeded"),
+		"Succeeded":     map[string]any{"Type": "Succeed"},
+		"RecordFailure": task("fail", "Failed"),
+		"Failed":        map[string]any{"Type": "Fail", "Error": "JobFailed", "Cause": "A step failed; the job records why"},
+	}
+
+	definition, _ := json.Marshal(map[string]any{
+		"Comment":        "Runs " + FunctionName + "'s async jobs (tse deploy --orchestration stepfunctions)",
+		"StartAt":        "Route",
+		"TimeoutSeconds": workflowTimeoutHours * 3600,
+		"States":         states,
+	})
+	return string(definition)
+}
+
+// workflowRolePolicyDocument lets the state machine invoke the Lambda. Like
+// the Lambda's own policy it names the function in any region, since the role
+// is account-wide.
+func workflowRolePolicyDocument() string {
+	return fmt.Sprintf(`{
+		"Version": "2012-10-17",
+		"Statement": [
+			{
+				"Effect": "Allow",
+				"Action": "lambda:InvokeFunction",
+				"Resource": [
+					"arn:aws:lambda:*:*:function:%[1]s",
+					"arn:aws:lambda:*:*:function:%[1]s:*"
+				]
+			}
+		]
+	}`, FunctionName)
+}
+
+// ensureWorkflow creates the state machine's role and the state machine, or
+// updates them. A new role takes a while to become assumable, and Step
+// Functions checks that it is, so creation retries until it propagates.
+func ensureWorkflow(ctx context.Context, clients *AWSClients, state *InfrastructureState, lambdaARN string, status func(string)) error {
+	roleARN, err := createWorkflowRole(ctx, clients)
+	if err != nil {
+		return err
+	}
+	definition := workflowDefinition(lambdaARN)
+
+	if state.Workflow != nil {
+		_, err := clients.SFN.UpdateStateMachine(ctx, &sfn.UpdateStateMachineInput{
+			StateMachineArn: aws.String(state.Workflow.ARN),
+			Definition:      aws.String(definition),
+			RoleArn:         aws.String(roleARN),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update state machine: %w", err)
+		}
+		return nil
+	}
+
+	var tags []sfntypes.Tag
+	for k, v := range standardTags() {
+		tags = append(tags, sfntypes.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	create := func() error {
+		_, err := clients.SFN.CreateStateMachine(ctx, &sfn.CreateStateMachineInput{
+			Name:       aws.String(WorkflowName),
+			Definition: aws.String(definition),
+			RoleArn:    aws.String(roleARN),
+			Type:       sfntypes.StateMachineTypeStandard,
+			Tags:       tags,
+		})
+		return err
+	}
+
+	timeout := time.After(iamPropagationTimeout)
+	for {
+		err := create()
+		if !isAPIError(err, "AccessDeniedException") {
+			if err != nil {
+				return fmt.Errorf("failed to create state machine: %w", err)
+			}
+			return nil
+		}
+		status("Waiting for the workflow's IAM role to propagate")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout:
+			return fmt.Errorf("timeout waiting for IAM role %s to propagate: %w", WorkflowRoleName, err)
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// createWorkflowRole creates the role the state machine runs as, or brings the
+// existing one's policy up to date, returning its ARN
+func createWorkflowRole(ctx context.Context, clients *AWSClients) (string, error) {
+	assumeRolePolicy := `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{
+				"Effect": "Allow",
+				"Principal": {
+					"Service": "states.amazonaws.com"
+				},
+				"Action": "sts:AssumeRole"
+			}
+		]
+	}`
+
+	iamTags := []iamtypes.Tag{}
+	for k, v := range standardTags() {
+		iamTags = append(iamTags, iamtypes.Tag{
+			Key:   aws.String(k),
+			Value: aws.String(v),
+		})
+	}
+
+	var roleARN string
+	var exists *iamtypes.EntityAlreadyExistsException
+	created, err := clients.IAM.CreateRole(ctx, &iam.CreateRoleInput{
+		RoleName:                 aws.String(WorkflowRoleName),
+		AssumeRolePolicyDocument: aws.String(assumeRolePolicy),
+		Tags:                     iamTags,
+	})
+	switch {
+	case err == nil:
+		roleARN = *created.Role.Arn
+	case errors.As(err, &exists):
+		existing, err := clients.IAM.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(WorkflowRoleName)})
+		if err != nil {
+			return "", fmt.Errorf("failed to look up workflow role: %w", err)
+		}
+		roleARN = *existing.Role.Arn
+	default:
+		return "", fmt.Errorf("failed to create workflow role: %w", err)
+	}
+
+	_, err = clients.IAM.PutRolePolicy(ctx, &iam.PutRolePolicyInput{
+		RoleName:       aws.String(WorkflowRoleName),
+		PolicyName:     aws.String(WorkflowPolicyName),
+		PolicyDocument: aws.String(workflowRolePolicyDocument()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create workflow role policy: %w", err)
+	}
+	return roleARN, nil
+}
+
+// deleteWorkflow deletes the state machine, then its role; either may be nil.
+// Executions still running are stopped with it.
+func deleteWorkflow(ctx context.Context, clients *AWSClients, workflow, role *Resource) error {
+	if workflow != nil {
+		_, err := clients.SFN.DeleteStateMachine(ctx, &sfn.DeleteStateMachineInput{StateMachineArn: aws.String(workflow.ARN)})
+		if err != nil {
+			return fmt.Errorf("failed to delete state machine: %w", err)
+		}
+	}
+	if role == nil {
+		return nil
+	}
+
+	var missing *iamtypes.NoSuchEntityException
+	_, err := clients.IAM.DeleteRolePolicy(ctx, &iam.DeleteRolePolicyInput{
+		RoleName:   aws.String(role.Name),
+		PolicyName: aws.String(WorkflowPolicyName),
+	})
+	if err != nil && !errors.As(err, &missing) {
+		return fmt.Errorf("failed to delete workflow role policy: %w", err)
+	}
+	_, err = clients.IAM.DeleteRole(ctx, &iam.DeleteRoleInput{RoleName: aws.String(role.Name)})
+	if err != nil && !errors.As(err, &missing) {
+		return fmt.Errorf("failed to delete workflow role: %w", err)
+	}
+	return nil
+}
+
+// discoverWorkflow finds the state machine and its role. Like the alarm, a
+// failed lookup counts as "not deployed".
+func discoverWorkflow(ctx context.Context, clients *AWSClients, state *InfrastructureState) {
+	paginator := sfn.NewListStateMachinesPaginator(clients.SFN, &sfn.ListStateMachinesInput{MaxResults: 1000})
+	for state.Workflow == nil && paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			break
+		}
+		for _, machine := range page.StateMachines {
+			if aws.ToString(machine.Name) == WorkflowName {
+				state.Workflow = &Resource{Name: WorkflowName, ARN: aws.ToString(machine.StateMachineArn)}
+			}
+		}
+	}
+
+	role, err := clients.IAM.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(WorkflowRoleName)})
+	if err != nil {
+		return
+	}
+	tags := make(map[string]string)
+	for _, tag := range role.Role.Tags {
+		tags[*tag.Key] = *tag.Value
+	}
+	state.WorkflowRole = &Resource{Name: *role.Role.RoleName, ARN: *role.Role.Arn, Tags: tags}
+}
@@ -0,0 +1,142 @@
+package infrastructure
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOrchestration(t *testing.T) {
+	tests := []struct {
+		raw     string
+		mode    string
+		set     bool
+		wantErr bool
+	}{
+		{raw: "", mode: OrchestrationLambda},
+		{raw: "lambda", mode: OrchestrationLambda, set: true},
+		{raw: "StepFunctions", mode: OrchestrationStepFunctions, set: true},
+		{raw: "airflow", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			t.Setenv(EnvOrchestration, tt.raw)
+			mode, set, err := Orchestration()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Orchestration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if mode != tt.mode || set != tt.set {
+				t.Errorf("Orchestration() = %q, %v, want %q, %v", mode, set, tt.mode, tt.set)
+			}
+		})
+	}
+}
+
+func TestWorkflowDefinition(t *testing.T) {
+	lambdaARN := "arn:aws:lambda:us-east-2:123456789012:function:tailscale-exits"
+
+	var definition struct {
+		StartAt string
+		States  map[string]struct {
+			Type       string
+			Next       string
+			Default    string
+			Parameters struct {
+				FunctionName string
+				Payload      map[string]string
+			}
+			Choices []struct{ Next string }
+			Catch   []struct{ Next string }
+		}
+	}
+	if err := json.Unmarshal([]byte(workflowDefinition(lambdaARN)), &definition); err != nil {
+		t.Fatalf("definition is not valid JSON: %v", err)
+	}
+
+	// Every transition lands on a state, and every step is one the Lambda runs
+	lambdaSteps := []string{"cleanup", "launch", "check", "terminate", "remove_vpc", "finish", "fail"}
+	var steps []string
+	targets := []string{definition.StartAt}
+	for name, state := range definition.States {
+		targets = append(targets, state.Next, state.Default)
+		for _, choice := range state.Choices {
+			targets = append(targets, choice.Next)
+		}
+		for _, catch := range state.Catch {
+			targets = append(targets, catch.Next)
+		}
+
+		if state.Type != "Task" {
+			continue
+		}
+		if state.Parameters.FunctionName != lambdaARN || state.Parameters.Payload["run.$"] != "$" {
+			t.Errorf("task %s invokes %+v, want the Lambda with the state as the run", name, state.Parameters)
+		}
+		step := state.Parameters.Payload["tse_step"]
+		if !slices.Contains(lambdaSteps, step) {
+			t.Errorf("task %s runs step %q, which the Lambda doesn't have", name, step)
+		}
+		steps = append(steps, step)
+		if step != "finish" && step != "fail" && (len(state.Catch) == 0 || state.Catch[0].Next != "RecordFailure") {
+			t.Errorf("task %s doesn't pass failures to RecordFailure", name)
+		}
+	}
+	for _, target := range targets {
+		if _, ok := definition.States[target]; target != "" && !ok {
+			t.Errorf("transition to missing state %q", target)
+		}
+	}
+	slices.Sort(steps)
+	slices.Sort(lambdaSteps)
+	if !slices.Equal(steps, lambdaSteps) {
+		t.Errorf("definition runs steps %v, want each of %v once", steps, lambdaSteps)
+	}
+}
+
+func TestWorkflowCalls(t *testing.T) {
+	clearOptionEnv(t)
+	state := deployedState()
+	state.Lambda.ARN = "arn:aws:lambda:us-east-2:123456789012:function:tailscale-exits"
+
+	// The workflow goes in before the Lambda is pointed at it, with the policy to start it
+	t.Setenv(EnvOrchestration, "stepfunctions")
+	want := []string{"iam:CreateRole", "iam:PutRolePolicy", "states:CreateStateMachine", "iam:PutRolePolicy", "lambda:UpdateFunctionConfiguration"}
+	calls := SetupCalls(state, 0)
+	if got := actions(calls); !slices.Equal(got, want) {
+		t.Fatalf("SetupCalls() = %v, want %v", got, want)
+	}
+	if !strings.Contains(calls[2], "Name="+WorkflowName) || !strings.Contains(calls[4], EnvOrchestration) {
+		t.Errorf("SetupCalls() = %v", calls)
+	}
+
+	state.Workflow = &Resource{Name: WorkflowName, ARN: "arn:aws:states:us-east-2:123456789012:stateMachine:" + WorkflowName}
+	state.WorkflowRole = &Resource{Name: WorkflowRoleName}
+	if got := actions(SetupCalls(state, 0)); got[2] != "states:UpdateStateMachine" {
+		t.Errorf("SetupCalls() = %v, want the existing state machine updated", got)
+	}
+
+	// Back to lambda: the Lambda is pointed away, then the workflow removed
+	t.Setenv(EnvOrchestration, "lambda")
+	want = []string{"iam:PutRolePolicy", "lambda:UpdateFunctionConfiguration", "states:DeleteStateMachine", "iam:DeleteRolePolicy", "iam:DeleteRole"}
+	if got := actions(SetupCalls(state, 0)); !slices.Equal(got, want) {
+		t.Errorf("SetupCalls() = %v, want %v", got, want)
+	}
+
+	// Unset leaves it alone
+	t.Setenv(EnvOrchestration, "")
+	if calls := SetupCalls(state, 0); len(calls) != 0 {
+		t.Errorf("SetupCalls() = %v, want nothing", calls)
+	}
+
+	// Teardown takes the state machine with the Lambda and its role with the IAM roles
+	selected := selectResources(state, TeardownOptions{Only: []string{TargetLambda}})
+	if selected.Workflow == nil || selected.WorkflowRole != nil {
+		t.Errorf("--only lambda selected workflow %v and role %v, want just the workflow", selected.Workflow, selected.WorkflowRole)
+	}
+	calls = TeardownCalls(&InfrastructureState{Workflow: state.Workflow, WorkflowRole: state.WorkflowRole})
+	if got, want := actions(calls), []string{"states:DeleteStateMachine", "iam:DeleteRolePolicy", "iam:DeleteRole"}; !slices.Equal(got, want) {
+		t.Errorf("TeardownCalls() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,263 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/anoldguy/tse/shared/telegram"
+)
+
+// DiffOp marks a line of a drift diff
+type DiffOp byte
+
+const (
+	DiffSame   DiffOp = ' '
+	DiffRemove DiffOp = '-' // What's deployed
+	DiffAdd    DiffOp = '+' // What deploy wants
+)
+
+// MarshalText renders the op as its diff character, so drifts read well as JSON
+func (op DiffOp) MarshalText() ([]byte, error) {
+	return []byte{byte(op)}, nil
+}
+
+// DiffLine is one line of a drift diff
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+// Drift is one difference between the deployed infrastructure and the
+// configuration deploy would create today
+type Drift struct {
+	Resource string
+	Field    string // Empty when the whole resource is missing
+	Missing  bool
+	Lines    []DiffLine
+}
+
+// diffContext is how many unchanged lines to show around each change
+const diffContext = 2
+
+// optionalEnvKeys are Lambda environment variables deploy only sets when asked
+// to (cross-account mode, webhooks, a baseline, custom regions, data transfer caps,
+// a node cap, a read token, a Telegram bot, a Tailscale API token, an orchestration)
+// or generates (the deployment ID), so finding them isn't drift even if this run didn't ask for them
+var optionalEnvKeys = []string{"ROLE_ARN", "ROLE_EXTERNAL_ID", "TSE_WEBHOOKS", "TSE_SECURITY_BASELINE", "TSE_CUSTOM_REGIONS", "TSE_ONLY_REGIONS", EnvNodeCapGB, EnvMonthlyCapGB, EnvMaxNodes, EnvDeploymentID, EnvReadToken, telegram.EnvBotToken, telegram.EnvChatIDs, EnvTailscaleAPIToken, EnvOrchestration}
+
+// Plan discovers the deployed infrastructure and compares it with the desired
+// configuration. It changes nothing.
+func Plan(ctx context.Context, region string) (*InfrastructureState, []Drift, error) {
+	state, err := AutodiscoverInfrastructure(ctx, region)
+	if err != nil {
+		return nil, nil, err
+	}
+	return state, DetectDrift(state), nil
+}
+
+// DetectDrift compares discovered state against what deploy would create:
+// missing resources, the inline policy document, Lambda memory, timeout and
+// environment variable names, log retention, the function URL's CORS settings,
+// and the launch template's version.
+func DetectDrift(state *InfrastructureState) []Drift {
+	var drifts []Drift
+	for _, name := range state.Missing() {
+		drifts = append(drifts, Drift{Resource: name, Missing: true})
+	}
+
+	if state.Policies.InlineName != "" {
+		current := policyLines(state.Policies.InlineDocument)
+		desired := policyLines(inlinePolicyDocument())
+		if !slices.Equal(current, desired) {
+			drifts = append(drifts, Drift{Resource: "Inline Policy", Field: "document", Lines: diffLines(current, desired, diffContext)})
+		}
+	}
+
+	if state.Lambda != nil {
+		// deploy rejects an invalid size before planning; the defaults are a fallback
+		memoryMB, timeoutSeconds, err := LambdaSize()
+		if err != nil {
+			memoryMB, timeoutSeconds = defaultLambdaMemoryMB, defaultLambdaTimeoutSeconds
+		}
+		if state.Config.LambdaMemoryMB != memoryMB {
+			drifts = append(drifts, valueDrift("Lambda Function", "memory",
+				fmt.Sprintf("%d MB", state.Config.LambdaMemoryMB), fmt.Sprintf("%d MB", memoryMB)))
+		}
+		if state.Config.LambdaTimeout != timeoutSeconds {
+			drifts = append(drifts, valueDrift("Lambda Function", "timeout",
+				fmt.Sprintf("%ds", state.Config.LambdaTimeout), fmt.Sprintf("%ds", timeoutSeconds)))
+		}
+		if lines := envKeyDiff(state.Config.LambdaEnvKeys, desiredEnvKeys()); lines != nil {
+			drifts = append(drifts, Drift{Resource: "Lambda Function", Field: "environment variables", Lines: lines})
+		}
+	}
+
+	if state.LogGroup != nil && state.Config.LogRetentionDays != LogRetentionDays {
+		drifts = append(drifts, valueDrift("CloudWatch Log Group", "retention",
+			retentionString(state.Config.LogRetentionDays), retentionString(LogRetentionDays)))
+	}
+
+	if state.FunctionURL != "" {
+		current := corsLines(state.Config.URLCors)
+		desired := corsLines(corsFromLambda(functionURLCors()))
+		if !slices.Equal(current, desired) {
+			drifts = append(drifts, Drift{Resource: "Function URL", Field: "CORS", Lines: diffLines(current, desired, len(desired))})
+		}
+	}
+
+	if launchTemplatesEnabled() {
+		if state.LaunchTemplate == nil {
+			drifts = append(drifts, Drift{Resource: "Launch Template", Missing: true})
+		} else if current := state.LaunchTemplate.Tags["Version"]; current != launchTemplateVersion() {
+			drifts = append(drifts, valueDrift("Launch Template", "default version", current, launchTemplateVersion()))
+		}
+	}
+
+	return drifts
+}
+
+// valueDrift is a drift in a single value
+func valueDrift(resource, field, current, desired string) Drift {
+	return Drift{
+		Resource: resource,
+		Field:    field,
+		Lines:    []DiffLine{{DiffRemove, current}, {DiffAdd, desired}},
+	}
+}
+
+// desiredEnvKeys returns the sorted names of the variables deploy gives the Lambda
+func desiredEnvKeys() []string {
+	var keys []string
+	for key := range lambdaEnvironment("", "") {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// envKeyDiff lists missing and unexpected environment variable names, or nil if they match
+func envKeyDiff(current, desired []string) []DiffLine {
+	var lines []DiffLine
+	for _, key := range current {
+		if !slices.Contains(desired, key) && !slices.Contains(optionalEnvKeys, key) {
+			lines = append(lines, DiffLine{DiffRemove, key})
+		}
+	}
+	for _, key := range desired {
+		if !slices.Contains(current, key) {
+			lines = append(lines, DiffLine{DiffAdd, key})
+		}
+	}
+	return lines
+}
+
+func retentionString(days int32) string {
+	if days == 0 {
+		return "never expire"
+	}
+	return fmt.Sprintf("%d days", days)
+}
+
+// policyLines pretty-prints a policy document so formatting differences
+// (IAM compacts whitespace) don't show up as drift
+func policyLines(document string) []string {
+	var parsed any
+	if err := json.Unmarshal([]byte(document), &parsed); err != nil {
+		return strings.Split(document, "\n")
+	}
+	pretty, err := json.MarshalIndent(parsed, "", "  ")
+	if err != nil {
+		return strings.Split(document, "\n")
+	}
+	return strings.Split(string(pretty), "\n")
+}
+
+// corsLines renders CORS settings one per line, with lists sorted since their order doesn't matter
+func corsLines(cors *CORS) []string {
+	if cors == nil {
+		return []string{"(no CORS configuration)"}
+	}
+	list := func(values []string) string {
+		sorted := slices.Clone(values)
+		sort.Strings(sorted)
+		return strings.Join(sorted, ", ")
+	}
+	return []string{
+		fmt.Sprintf("AllowCredentials: %t", cors.AllowCredentials),
+		"AllowOrigins: " + list(cors.AllowOrigins),
+		"AllowMethods: " + list(cors.AllowMethods),
+		"AllowHeaders: " + list(cors.AllowHeaders),
+		"ExposeHeaders: " + list(cors.ExposeHeaders),
+		fmt.Sprintf("MaxAge: %d", cors.MaxAge),
+	}
+}
+
+// diffLines returns a line diff of a and b (longest common subsequence),
+// keeping only context unchanged lines around each change
+func diffLines(a, b []string, context int) []DiffLine {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var full []DiffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			full = append(full, DiffLine{DiffSame, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			full = append(full, DiffLine{DiffRemove, a[i]})
+			i++
+		default:
+			full = append(full, DiffLine{DiffAdd, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		full = append(full, DiffLine{DiffRemove, a[i]})
+	}
+	for ; j < len(b); j++ {
+		full = append(full, DiffLine{DiffAdd, b[j]})
+	}
+
+	// Keep changes and the unchanged lines near them; collapse the rest to "..."
+	keep := make([]bool, len(full))
+	for n, line := range full {
+		if line.Op == DiffSame {
+			continue
+		}
+		for k := max(0, n-context); k <= min(len(full)-1, n+context); k++ {
+			keep[k] = true
+		}
+	}
+
+	var lines []DiffLine
+	skipped := false
+	for n, line := range full {
+		if keep[n] {
+			lines = append(lines, line)
+			skipped = false
+		} else if !skipped {
+			lines = append(lines, DiffLine{DiffSame, "..."})
+			skipped = true
+		}
+	}
+	return lines
+}
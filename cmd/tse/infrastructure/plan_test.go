@@ -0,0 +1,115 @@
+package infrastructure
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// deployedState returns a complete state that matches the desired configuration
+func deployedState() *InfrastructureState {
+	state := &InfrastructureState{
+		LogGroup:     &Resource{Name: LogGroupName},
+		Table:        &Resource{Name: TableName},
+		IAMRole:      &Resource{Name: RoleName},
+		NodeProfile:  &Resource{Name: NodeInstanceProfileName},
+		Lambda:       &Resource{Name: FunctionName, Tags: map[string]string{TagDeployment: "a1b2c3d4"}},
+		FunctionURL:  "https://abc.lambda-url.us-east-2.on.aws/",
+		DeploymentID: "a1b2c3d4",
+		LaunchTemplate: &Resource{
+			Name: LaunchTemplateName,
+			Tags: map[string]string{"Version": launchTemplateVersion()},
+		},
+	}
+	state.Policies.Managed = true
+	state.Policies.InlineName = InlinePolicyName
+	state.Policies.InlineDocument = strings.Join(strings.Fields(inlinePolicyDocument()), "") // IAM compacts whitespace
+	state.Config.LambdaMemoryMB = defaultLambdaMemoryMB
+	state.Config.LambdaTimeout = defaultLambdaTimeoutSeconds
+	state.Config.LambdaEnvKeys = desiredEnvKeys()
+	state.Config.LogRetentionDays = LogRetentionDays
+	state.Config.URLCors = corsFromLambda(functionURLCors())
+	// AWS may hand lists back in a different order
+	state.Config.URLCors.AllowMethods = []string{"DELETE", "POST", "GET"}
+	return state
+}
+
+func clearDeployEnv(t *testing.T) {
+	for _, key := range []string{"TSE_ROLE_ARN", "TSE_ROLE_EXTERNAL_ID", "TSE_WEBHOOKS", "TSE_SECURITY_BASELINE", "TSE_NODE_INSTANCE_PROFILE", EnvDeploymentID} {
+		t.Setenv(key, "")
+	}
+}
+
+func TestDetectDriftNone(t *testing.T) {
+	clearDeployEnv(t)
+	state := deployedState()
+	// Optional variables from an earlier deploy aren't drift
+	state.Config.LambdaEnvKeys = append(state.Config.LambdaEnvKeys, "TSE_WEBHOOKS")
+
+	if drifts := DetectDrift(state); len(drifts) != 0 {
+		t.Errorf("want no drift, got %+v", drifts)
+	}
+}
+
+func TestDetectDrift(t *testing.T) {
+	clearDeployEnv(t)
+	state := deployedState()
+	state.FunctionURL = ""
+	state.Config.URLCors = nil
+	state.Config.LambdaMemoryMB = 128
+	state.Config.LambdaEnvKeys = []string{"DEBUG", "TAILSCALE_AUTH_KEY", "TSE_AUTH_TOKEN", "TSE_TABLE_NAME"}
+	state.Config.LogRetentionDays = 0
+	state.Policies.InlineDocument = strings.Replace(inlinePolicyDocument(), `"ec2:RunInstances",`, "", 1)
+
+	got := map[string]Drift{}
+	for _, drift := range DetectDrift(state) {
+		got[drift.Resource+"/"+drift.Field] = drift
+	}
+
+	if drift, ok := got["Function URL/"]; !ok || !drift.Missing {
+		t.Errorf("missing function URL not reported: %+v", got)
+	}
+	if _, ok := got["Function URL/CORS"]; ok {
+		t.Error("CORS should not be compared for a missing function URL")
+	}
+	if drift := got["Lambda Function/memory"]; fmt.Sprint(drift.Lines) != "[{45 128 MB} {43 256 MB}]" {
+		t.Errorf("memory drift = %v", drift.Lines)
+	}
+	if drift := got["Lambda Function/environment variables"]; fmt.Sprint(drift.Lines) != "[{45 DEBUG} {43 TSE_INSTANCE_PROFILE} {43 TSE_LAUNCH_TEMPLATE}]" {
+		t.Errorf("env drift = %v", drift.Lines)
+	}
+	if drift := got["CloudWatch Log Group/retention"]; fmt.Sprint(drift.Lines) != "[{45 never expire} {43 14 days}]" {
+		t.Errorf("retention drift = %v", drift.Lines)
+	}
+
+	policy := got["Inline Policy/document"]
+	var added []string
+	for _, line := range policy.Lines {
+		if line.Op == DiffRemove {
+			t.Errorf("unexpected removed policy line %q", line.Text)
+		}
+		if line.Op == DiffAdd {
+			added = append(added, strings.TrimSpace(line.Text))
+		}
+	}
+	if fmt.Sprint(added) != `["ec2:RunInstances",]` {
+		t.Errorf("policy additions = %v", added)
+	}
+	if len(got) != 5 {
+		t.Errorf("want 5 drifts, got %d: %+v", len(got), got)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	a := []string{"a", "b", "c", "d", "e", "f", "g"}
+	b := []string{"a", "b", "c", "X", "e", "f", "g", "h"}
+
+	var got []string
+	for _, line := range diffLines(a, b, 1) {
+		got = append(got, string(line.Op)+line.Text)
+	}
+	want := []string{" ...", " c", "-d", "+X", " e", " ...", " g", "+h"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("diffLines = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,266 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+)
+
+// EnvSkipPreflight skips the permission check deploy makes before creating anything
+const EnvSkipPreflight = "TSE_SKIP_PREFLIGHT"
+
+// SkipPreflight reports whether deploy should skip its permission check
+func SkipPreflight() bool {
+	return os.Getenv(EnvSkipPreflight) != ""
+}
+
+// MissingPermission is an action deploy needs that the caller's policies don't allow
+type MissingPermission struct {
+	Action   string
+	Resource string
+	Decision string // implicitDeny (nothing allows it) or explicitDeny
+}
+
+func (p MissingPermission) String() string {
+	return fmt.Sprintf("%s on %s (%s)", p.Action, p.Resource, p.Decision)
+}
+
+// errRootCaller means the credentials are the account's root user, which IAM
+// can't simulate and which is allowed everything anyway
+var errRootCaller = errors.New("the root user can't be simulated")
+
+// Preflight simulates the calls deploy is about to make against the caller's
+// IAM policies and returns the permissions they don't allow, so a deploy can
+// stop before creating anything instead of failing halfway. An error means the
+// check itself couldn't run (the caller can't call iam:SimulatePrincipalPolicy,
+// say); root credentials need no check and pass.
+func Preflight(ctx context.Context, region string, calls []string) ([]MissingPermission, error) {
+	if len(calls) == 0 {
+		return nil, nil
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller identity: %w", err)
+	}
+
+	iamClient := iam.NewFromConfig(cfg)
+	principal, err := principalARN(ctx, iamClient, aws.ToString(identity.Arn))
+	if errors.Is(err, errRootCaller) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	required, err := requiredPermissions(calls, aws.ToString(identity.Arn), region)
+	if err != nil {
+		return nil, err
+	}
+	return missingPermissions(ctx, iamClient, principal, required)
+}
+
+// checkPermissions runs Preflight for Setup. Missing permissions fail the
+// deploy with the list; a check that can't run is noted and the deploy goes on.
+func checkPermissions(ctx context.Context, region string, calls []string) error {
+	if SkipPreflight() || len(calls) == 0 {
+		return nil
+	}
+
+	var missing []MissingPermission
+	err := ui.WithSpinner("Checking AWS permissions", func() error {
+		var err error
+		missing, err = Preflight(ctx, region, calls)
+		return err
+	})
+	if err != nil {
+		fmt.Println(ui.Subtle(fmt.Sprintf("Couldn't check permissions before deploying (%v); continuing", err)))
+		fmt.Println()
+		return nil
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	lines := make([]string, len(missing))
+	for i, permission := range missing {
+		lines[i] = "  " + permission.String()
+	}
+	return fmt.Errorf(`your AWS credentials lack %d permissions deploy needs, so nothing was created:
+
+%s
+
+Grant them and run 'tse deploy' again, or use --skip-preflight if the check is
+wrong (a policy condition the simulation can't evaluate, say)`, len(missing), strings.Join(lines, "\n"))
+}
+
+// principalARN returns the IAM user or role to simulate for the caller. STS
+// reports an assumed role without its path, so the role is looked up for its ARN.
+func principalARN(ctx context.Context, client iam.GetRoleAPIClient, callerARN string) (string, error) {
+	parsed, err := arn.Parse(callerARN)
+	if err != nil {
+		return "", fmt.Errorf("unexpected caller ARN %s: %w", callerARN, err)
+	}
+	switch {
+	case parsed.Resource == "root":
+		return "", errRootCaller
+	case strings.HasPrefix(parsed.Resource, "user/"):
+		return callerARN, nil
+	case strings.HasPrefix(parsed.Resource, "assumed-role/"):
+		roleName := strings.Split(parsed.Resource, "/")[1]
+		role, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)})
+		if err != nil {
+			return "", fmt.Errorf("failed to look up role %s: %w", roleName, err)
+		}
+		return aws.ToString(role.Role.Arn), nil
+	}
+	return "", fmt.Errorf("can't simulate the permissions of %s", callerARN)
+}
+
+// impliedActions are actions AWS also checks for a call: tagging a resource as
+// it's created, and passing a role to the service that will use it
+var impliedActions = map[string][]string{
+	"iam:CreateRole":            {"iam:TagRole"},
+	"iam:CreateInstanceProfile": {"iam:TagInstanceProfile"},
+	"dynamodb:CreateTable":      {"dynamodb:TagResource"},
+	"lambda:CreateFunction":     {"lambda:TagResource", "iam:PassRole"},
+	"states:CreateStateMachine": {"iam:PassRole"},
+	"states:UpdateStateMachine": {"iam:PassRole"},
+}
+
+// requiredPermissions turns dry-run calls into the IAM actions they need, keyed
+// by the resource each acts on ("*" where deploy doesn't know it beforehand).
+// The account and partition come from the caller's ARN.
+func requiredPermissions(calls []string, callerARN, region string) (map[string][]string, error) {
+	caller, err := arn.Parse(callerARN)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected caller ARN %s: %w", callerARN, err)
+	}
+	resourceARN := func(service, resource string) string {
+		resourceRegion := region
+		if service == "iam" {
+			resourceRegion = "" // IAM is global
+		}
+		return arn.ARN{Partition: caller.Partition, Service: service, Region: resourceRegion, AccountID: caller.AccountID, Resource: resource}.String()
+	}
+
+	required := map[string][]string{}
+	need := func(action, resource string) {
+		if !slices.Contains(required[resource], action) {
+			required[resource] = append(required[resource], action)
+		}
+	}
+	for _, call := range calls {
+		fields := strings.Fields(call)
+		if len(fields) == 0 {
+			continue
+		}
+		service, _, ok := strings.Cut(fields[0], ":")
+		if !ok {
+			continue
+		}
+		// CloudWatch's API endpoint is monitoring, its IAM prefix cloudwatch
+		action := strings.Replace(fields[0], "monitoring:", "cloudwatch:", 1)
+
+		params := map[string]string{}
+		for _, field := range fields[1:] {
+			if key, value, ok := strings.Cut(field, "="); ok {
+				params[key] = value
+			}
+		}
+
+		resource := "*"
+		switch {
+		case params["InstanceProfileName"] != "":
+			resource = resourceARN("iam", "instance-profile/"+params["InstanceProfileName"])
+		case params["RoleName"] != "":
+			resource = resourceARN("iam", "role/"+params["RoleName"])
+		case params["FunctionName"] != "":
+			resource = resourceARN("lambda", "function:"+params["FunctionName"])
+		case params["LogGroupName"] != "":
+			resource = resourceARN("logs", "log-group:"+params["LogGroupName"]+":*")
+		case params["TableName"] != "":
+			resource = resourceARN("dynamodb", "table/"+params["TableName"])
+		case params["AlarmName"] != "":
+			resource = resourceARN("cloudwatch", "alarm:"+params["AlarmName"])
+		case strings.HasPrefix(params["Resource"], "arn:"):
+			resource = params["Resource"]
+		case strings.HasPrefix(params["StateMachineArn"], "arn:"):
+			resource = params["StateMachineArn"]
+		case service == "states" && params["Name"] != "":
+			resource = resourceARN("states", "stateMachine:"+params["Name"])
+		case service == "sns" && params["Name"] != "":
+			resource = resourceARN("sns", params["Name"])
+		case service == "events" && params["Name"] != "":
+			resource = resourceARN("events", "rule/"+params["Name"])
+		case service == "events" && params["Rule"] != "":
+			resource = resourceARN("events", "rule/"+params["Rule"])
+		}
+		need(action, resource)
+
+		for _, implied := range impliedActions[action] {
+			switch {
+			case implied != "iam:PassRole":
+				need(implied, resource)
+			case service == "states":
+				need(implied, resourceARN("iam", "role/"+WorkflowRoleName))
+			default:
+				need(implied, resourceARN("iam", "role/"+RoleName))
+			}
+		}
+	}
+	return required, nil
+}
+
+// missingPermissions simulates the principal's policies for each resource's
+// actions and returns those not allowed, sorted by action
+func missingPermissions(ctx context.Context, client iam.SimulatePrincipalPolicyAPIClient, principal string, required map[string][]string) ([]MissingPermission, error) {
+	var missing []MissingPermission
+	for resource, actions := range required {
+		paginator := iam.NewSimulatePrincipalPolicyPaginator(client, &iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(principal),
+			ActionNames:     actions,
+			ResourceArns:    []string{resource},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to simulate IAM policies: %w", err)
+			}
+			for _, result := range page.EvaluationResults {
+				if result.EvalDecision == iamtypes.PolicyEvaluationDecisionTypeAllowed {
+					continue
+				}
+				missing = append(missing, MissingPermission{
+					Action:   aws.ToString(result.EvalActionName),
+					Resource: resource,
+					Decision: string(result.EvalDecision),
+				})
+			}
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		if missing[i].Action != missing[j].Action {
+			return missing[i].Action < missing[j].Action
+		}
+		return missing[i].Resource < missing[j].Resource
+	})
+	return missing, nil
+}
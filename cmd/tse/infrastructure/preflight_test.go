@@ -0,0 +1,141 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+const testCallerARN = "arn:aws:iam::123456789012:user/deployer"
+
+// fakeIAM knows one role and denies the actions in denied, recording each
+// simulation's resources
+type fakeIAM struct {
+	denied    []string
+	simulated [][]string
+}
+
+func (f *fakeIAM) GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	if aws.ToString(params.RoleName) != "admin" {
+		return nil, errors.New("NoSuchEntity")
+	}
+	return &iam.GetRoleOutput{Role: &iamtypes.Role{Arn: aws.String("arn:aws:iam::123456789012:role/ops/admin")}}, nil
+}
+
+func (f *fakeIAM) SimulatePrincipalPolicy(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error) {
+	f.simulated = append(f.simulated, params.ResourceArns)
+	out := &iam.SimulatePrincipalPolicyOutput{}
+	for _, action := range params.ActionNames {
+		decision := iamtypes.PolicyEvaluationDecisionTypeAllowed
+		if slices.Contains(f.denied, action) {
+			decision = iamtypes.PolicyEvaluationDecisionTypeImplicitDeny
+		}
+		out.EvaluationResults = append(out.EvaluationResults, iamtypes.EvaluationResult{
+			EvalActionName: aws.String(action),
+			EvalDecision:   decision,
+		})
+	}
+	return out, nil
+}
+
+func TestRequiredPermissions(t *testing.T) {
+	clearOptionEnv(t)
+	t.Setenv("TSE_ALARM_EMAIL", "you@example.com")
+
+	calls := append(SetupCalls(&InfrastructureState{}, 0), "monitoring:PutMetricAlarm AlarmName="+AlarmName+" Threshold=28800")
+	required, err := requiredPermissions(calls, testCallerARN, "us-east-2")
+	if err != nil {
+		t.Fatalf("requiredPermissions() error = %v", err)
+	}
+
+	lambdaRole := "arn:aws:iam::123456789012:role/" + RoleName
+	tests := []struct {
+		resource string
+		action   string
+	}{
+		{"arn:aws:logs:us-east-2:123456789012:log-group:" + LogGroupName + ":*", "logs:CreateLogGroup"},
+		{"arn:aws:dynamodb:us-east-2:123456789012:table/" + TableName, "dynamodb:TagResource"},
+		{lambdaRole, "iam:CreateRole"},
+		{lambdaRole, "iam:TagRole"},
+		{lambdaRole, "iam:PassRole"}, // CreateFunction hands the Lambda its role
+		{"arn:aws:iam::123456789012:instance-profile/" + NodeInstanceProfileName, "iam:AddRoleToInstanceProfile"},
+		{"arn:aws:lambda:us-east-2:123456789012:function:" + FunctionName, "lambda:CreateFunction"},
+		{"arn:aws:cloudwatch:us-east-2:123456789012:alarm:" + AlarmName, "cloudwatch:PutMetricAlarm"},
+		{"*", "ec2:CreateLaunchTemplate"},
+	}
+	for _, tt := range tests {
+		if !slices.Contains(required[tt.resource], tt.action) {
+			t.Errorf("required[%s] = %v, want %s", tt.resource, required[tt.resource], tt.action)
+		}
+	}
+	for resource, actions := range required {
+		if slices.Contains(actions, "monitoring:PutMetricAlarm") {
+			t.Errorf("required[%s] uses the monitoring endpoint name rather than cloudwatch", resource)
+		}
+	}
+
+	if _, err := requiredPermissions(calls, "not-an-arn", "us-east-2"); err == nil {
+		t.Error("requiredPermissions() accepted a malformed caller ARN")
+	}
+}
+
+func TestPrincipalARN(t *testing.T) {
+	tests := []struct {
+		caller  string
+		want    string
+		wantErr bool
+	}{
+		{testCallerARN, testCallerARN, false},
+		{"arn:aws:sts::123456789012:assumed-role/admin/session", "arn:aws:iam::123456789012:role/ops/admin", false},
+		{"arn:aws:sts::123456789012:assumed-role/unknown/session", "", true},
+		{"arn:aws:sts::123456789012:federated-user/bob", "", true},
+	}
+	for _, tt := range tests {
+		got, err := principalARN(context.Background(), &fakeIAM{}, tt.caller)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("principalARN(%s) = %q, %v, want %q (error %v)", tt.caller, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	if _, err := principalARN(context.Background(), &fakeIAM{}, "arn:aws:iam::123456789012:root"); !errors.Is(err, errRootCaller) {
+		t.Errorf("principalARN(root) error = %v, want errRootCaller", err)
+	}
+}
+
+func TestMissingPermissions(t *testing.T) {
+	fake := &fakeIAM{denied: []string{"iam:PassRole", "iam:CreateRole"}}
+	required := map[string][]string{
+		"arn:aws:iam::123456789012:role/b": {"iam:CreateRole", "iam:PassRole"},
+		"arn:aws:iam::123456789012:role/a": {"iam:PassRole"},
+		"*":                                {"ec2:CreateLaunchTemplate"},
+	}
+
+	missing, err := missingPermissions(context.Background(), fake, testCallerARN, required)
+	if err != nil {
+		t.Fatalf("missingPermissions() error = %v", err)
+	}
+	want := []MissingPermission{
+		{Action: "iam:CreateRole", Resource: "arn:aws:iam::123456789012:role/b", Decision: "implicitDeny"},
+		{Action: "iam:PassRole", Resource: "arn:aws:iam::123456789012:role/a", Decision: "implicitDeny"},
+		{Action: "iam:PassRole", Resource: "arn:aws:iam::123456789012:role/b", Decision: "implicitDeny"},
+	}
+	if !slices.Equal(missing, want) {
+		t.Errorf("missingPermissions() = %v, want %v", missing, want)
+	}
+	if len(fake.simulated) != len(required) {
+		t.Errorf("simulated %d times, want once per resource", len(fake.simulated))
+	}
+}
+
+func TestCheckPermissionsSkipped(t *testing.T) {
+	t.Setenv(EnvSkipPreflight, "1")
+	// With the check skipped nothing loads AWS config, so this can't fail
+	if err := checkPermissions(context.Background(), "us-east-2", []string{"iam:CreateRole RoleName=x"}); err != nil {
+		t.Errorf("checkPermissions() = %v, want nil when skipped", err)
+	}
+}
@@ -0,0 +1,34 @@
+package infrastructure
+
+import (
+	"fmt"
+	"os"
+)
+
+// EnvReadToken is a second Lambda token that can only read (health, instances
+// and the other GET routes), for dashboards that shouldn't be able to start nodes
+const EnvReadToken = "TSE_READ_TOKEN"
+
+// minReadTokenLength keeps the read token about as hard to guess as a UUID
+const minReadTokenLength = 32
+
+// readTokenSet reports whether a read token was given, so the Lambda's
+// environment has to carry it
+func readTokenSet() bool {
+	return os.Getenv(EnvReadToken) != ""
+}
+
+// ValidateReadToken checks TSE_READ_TOKEN, if set: long enough not to be
+// guessed, and not the full-access TSE_AUTH_TOKEN
+func ValidateReadToken() error {
+	token := os.Getenv(EnvReadToken)
+	switch {
+	case token == "":
+		return nil
+	case len(token) < minReadTokenLength:
+		return fmt.Errorf("%s must be at least %d characters\n\nHint: Generate one with: openssl rand -hex 32", EnvReadToken, minReadTokenLength)
+	case token == os.Getenv("TSE_AUTH_TOKEN"):
+		return fmt.Errorf("%s must differ from TSE_AUTH_TOKEN, or it grants full access", EnvReadToken)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package infrastructure
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateReadToken(t *testing.T) {
+	t.Setenv("TSE_AUTH_TOKEN", strings.Repeat("a", 64))
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "hex", token: strings.Repeat("b", 64)},
+		{name: "short", token: "dashboard", wantErr: true},
+		{name: "auth token", token: strings.Repeat("a", 64), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvReadToken, tt.token)
+			if err := ValidateReadToken(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateReadToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadTokenCalls(t *testing.T) {
+	clearOptionEnv(t)
+	t.Setenv(EnvReadToken, strings.Repeat("b", 64))
+
+	calls := SetupCalls(deployedState(), 0)
+	if !slices.Contains(actions(calls), "lambda:UpdateFunctionConfiguration") {
+		t.Errorf("SetupCalls() = %v, want the Lambda's environment updated", calls)
+	}
+	if _, ok := resourceEnvironment()[EnvReadToken]; !ok {
+		t.Errorf("resourceEnvironment() missing %s", EnvReadToken)
+	}
+}
@@ -0,0 +1,64 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+)
+
+// Environment variables the Lambda binary reads to serve the API over HTTP
+// (see lambda/serve.go)
+const (
+	EnvServeAddr      = "TSE_SERVE_ADDR"
+	EnvServeMutations = "TSE_SERVE_REGION_MUTATIONS"
+)
+
+// BuildServer compiles the Lambda from source for this machine into dir, to
+// run the API locally, and returns the binary's path. Unlike deploy it can't
+// fall back to the embedded Lambda, which only runs on linux/arm64.
+func BuildServer(ctx context.Context, dir string) (string, error) {
+	if _, err := exec.LookPath("go"); err != nil {
+		return "", fmt.Errorf("tse serve builds the API from source, which needs Go (https://go.dev/dl)")
+	}
+	path := filepath.Join(dir, "tse-serve")
+	if err := compileLambda(ctx, path, runtime.GOOS, runtime.GOARCH); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// ServeEnvironment returns the environment for a local API server: ours, plus
+// what deploy gives the Lambda, so it shares the deployment's state table,
+// launch templates and settings. standalone leaves the deployed resources out;
+// the server then keeps its locks in memory and accepts only TSE_AUTH_TOKEN
+// and TSE_READ_TOKEN.
+func ServeEnvironment(ctx context.Context, addr string, mutations int, standalone bool) ([]string, error) {
+	env := lambdaEnvironment(os.Getenv("TAILSCALE_AUTH_KEY"), os.Getenv("TSE_AUTH_TOKEN"))
+	if standalone {
+		delete(env, "TSE_TABLE_NAME")
+		delete(env, "TSE_INSTANCE_PROFILE")
+		delete(env, EnvLaunchTemplate)
+	}
+	env[EnvServeAddr] = addr
+	env[EnvServeMutations] = strconv.Itoa(mutations)
+
+	// The Lambda runtime sets AWS_REGION; the server needs it as the Lambda's
+	// home region, for opt-in checks and the deployment's identity
+	if os.Getenv("AWS_REGION") == "" {
+		region, err := GetDefaultRegion(ctx)
+		if err != nil {
+			return nil, err
+		}
+		env["AWS_REGION"] = region
+	}
+
+	environ := os.Environ()
+	for key, value := range env {
+		environ = append(environ, key+"="+value)
+	}
+	return environ, nil
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
 )
 
 // SetupResult contains the deployment result including secrets.
@@ -21,12 +22,32 @@ type SetupResult struct {
 // Setup orchestrates the idempotent deployment of TSE infrastructure.
 // Creates only missing resources and returns the final state.
 func Setup(ctx context.Context, region string) (*SetupResult, error) {
+	alarmHours, err := AlarmHours()
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := KeepWarm(); err != nil {
+		return nil, err
+	}
+	if err := ValidateReadToken(); err != nil {
+		return nil, err
+	}
+	if err := ValidateTelegram(); err != nil {
+		return nil, err
+	}
+	if _, _, err := LambdaSize(); err != nil {
+		return nil, err
+	}
+	if _, _, err := Orchestration(); err != nil {
+		return nil, err
+	}
+
 	fmt.Println(ui.Title("Deploying TSE infrastructure"))
 	fmt.Println()
 
 	// 1. Discover existing state
 	var state *InfrastructureState
-	err := ui.WithSpinner("Discovering existing infrastructure", func() error {
+	err = ui.WithSpinner("Discovering existing infrastructure", func() error {
 		var err error
 		state, err = AutodiscoverInfrastructure(ctx, region)
 		return err
@@ -34,10 +55,26 @@ func Setup(ctx context.Context, region string) (*SetupResult, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to discover infrastructure: %w", err)
 	}
+	if err := resolveDeploymentID(state); err != nil {
+		return nil, err
+	}
+	if state.DeploymentID == "" {
+		fmt.Printf("Deployment ID: %s (tags everything this deployment creates)\n", ui.Highlight(os.Getenv(EnvDeploymentID)))
+		fmt.Println()
+	}
+
+	// Make sure every call below is allowed before making the first one
+	if err := checkPermissions(ctx, region, SetupCalls(state, alarmHours)); err != nil {
+		return nil, err
+	}
 
 	if state.IsComplete() {
 		fmt.Println("✓ Infrastructure already deployed")
 		fmt.Println()
+		// Deploy options can be changed after the first deploy
+		if err := applyDeployOptions(ctx, region, state, alarmHours); err != nil {
+			return nil, err
+		}
 		// Still need to return auth token even if already deployed
 		tseAuthToken := os.Getenv("TSE_AUTH_TOKEN")
 		return &SetupResult{
@@ -47,6 +84,13 @@ func Setup(ctx context.Context, region string) (*SetupResult, error) {
 		}, nil
 	}
 
+	// Find the Lambda source before creating anything, rather than failing halfway
+	if state.Lambda == nil && !UsesEmbeddedLambda() {
+		if _, err := lambdaSourceDir(); err != nil {
+			return nil, err
+		}
+	}
+
 	missing := state.Missing()
 	fmt.Printf("Found %d missing resources, creating...\n", len(missing))
 	fmt.Println()
@@ -74,86 +118,137 @@ func Setup(ctx context.Context, region string) (*SetupResult, error) {
 		return nil, err
 	}
 
-	// 4. Create CloudWatch Log Group (if missing)
+	// 4. Build the steps for what's missing, then run them as one display.
+	// Later steps read the ARNs earlier ones fill in when they run.
+	var steps []ui.Step
+	var roleARN, lambdaARN, topicARN string
+	if state.IAMRole != nil {
+		roleARN = state.IAMRole.ARN
+	}
+	if state.Lambda != nil {
+		lambdaARN = state.Lambda.ARN
+	}
+
+	// Nothing depends on the log group, table, roles or Lambda package, so they're
+	// created together; the new role also propagates while the Lambda builds
+	var independent []ui.Step
 	if state.LogGroup == nil {
-		if err := ui.WithSpinner("Creating CloudWatch log group", func() error {
-			return createLogGroup(ctx, clients, FunctionName, 14)
-		}); err != nil {
-			return nil, err
-		}
+		independent = append(independent, step("Creating CloudWatch log group", func() error {
+			return createLogGroup(ctx, clients, FunctionName, LogRetentionDays)
+		}))
+	}
+
+	if state.Table == nil {
+		independent = append(independent, step("Creating DynamoDB state table", func() error {
+			return createTable(ctx, clients, TableName)
+		}))
 	}
 
-	// 5. Create IAM Role (if missing)
-	var roleARN string
 	if state.IAMRole == nil {
-		if err := ui.WithSpinner("Creating IAM execution role", func() error {
+		independent = append(independent, step("Creating IAM execution role", func() error {
 			var err error
 			roleARN, err = createIAMRole(ctx, clients, RoleName)
 			return err
-		}); err != nil {
-			return nil, err
+		}))
+	}
+
+	if state.NodeProfile == nil {
+		independent = append(independent, step("Creating exit node instance profile", func() error {
+			return createNodeInstanceProfile(ctx, clients)
+		}))
+	}
+
+	independent = append(independent, launchTemplateSteps(ctx, clients, state)...)
+
+	var zipBytes []byte
+	if state.Lambda == nil {
+		// Package the prebuilt Lambda, or build it from source
+		message := "Building Lambda function (linux/arm64)"
+		if UsesEmbeddedLambda() {
+			message = "Packaging prebuilt Lambda function (linux/arm64)"
 		}
-	} else {
-		roleARN = state.IAMRole.ARN
+		independent = append(independent, step(message, func() error {
+			var err error
+			zipBytes, err = lambdaZip(ctx)
+			return err
+		}))
 	}
+	steps = append(steps, ui.Concurrently(independent...)...)
 
-	// 6. Attach policies (if missing)
+	// The policies only need the role
+	var policies []ui.Step
 	if !state.Policies.Managed {
-		if err := ui.WithSpinner("Attaching managed execution policy", func() error {
+		policies = append(policies, step("Attaching managed execution policy", func() error {
 			return attachManagedPolicy(ctx, clients, RoleName)
-		}); err != nil {
-			return nil, err
-		}
+		}))
 	}
 
-	if state.Policies.InlineName == "" {
-		if err := ui.WithSpinner("Creating inline EC2/VPC policy", func() error {
+	// Deployments from before the state table, instance profile, launch templates or workflows need the updated policy too
+	if state.Policies.InlineName == "" || state.Table == nil || state.NodeProfile == nil || launchTemplateEnvMissing(state) || orchestrationSet() {
+		policies = append(policies, step("Creating inline EC2/VPC policy", func() error {
 			return createInlinePolicy(ctx, clients, RoleName)
-		}); err != nil {
-			return nil, err
-		}
+		}))
 	}
+	steps = append(steps, ui.Concurrently(policies...)...)
 
-	// 7. Create Lambda Function (if missing)
-	// Note: This will automatically retry with snarky messages if we hit IAM propagation delays
 	if state.Lambda == nil {
-		// Build Lambda
-		var zipBytes []byte
-		if err := ui.WithSpinner("Building Lambda function (linux/arm64)", func() error {
+		// Retries while the new role propagates, saying so in the step's status
+		steps = append(steps, ui.Step{Name: "Creating Lambda function", Run: func(status func(string)) error {
 			var err error
-			zipBytes, err = buildLambdaZip()
+			lambdaARN, err = createLambdaFunctionWithRetry(ctx, clients, FunctionName, roleARN, zipBytes, tailscaleAuthKey, tseAuthToken, status)
 			return err
-		}); err != nil {
-			return nil, err
-		}
-
-		// Create function (handles its own UI - spinner for normal case, rotating messages for IAM delays)
-		if _, err := createLambdaFunctionWithRetry(ctx, clients, FunctionName, roleARN, zipBytes, tailscaleAuthKey, tseAuthToken); err != nil {
-			return nil, err
+		}})
+	} else if state.Table == nil || state.NodeProfile == nil || launchTemplateEnvMissing(state) || deploymentIDMissing(state) || os.Getenv("TSE_SECURITY_BASELINE") != "" || customRegionsSet() || transferCapsSet() || readTokenSet() || telegramSet() || keyExpiryTokenSet() || orchestrationSet() || lambdaSizeStale(state) {
+		// Existing Lambda from before the state table, instance profile, launch templates or deployment IDs: point it at them
+		if deploymentIDMissing(state) {
+			steps = append(steps, step("Tagging Lambda with deployment ID", func() error {
+				return tagLambdaDeployment(ctx, clients, lambdaARN)
+			}))
 		}
+		steps = append(steps, step("Updating Lambda configuration", func() error {
+			return ensureLambdaConfig(ctx, clients, FunctionName)
+		}))
 	}
 
-	// 8. Create Function URL (if missing)
+	// The Lambda is created pointing at the workflow, which needs its ARN; it
+	// only starts workflows once someone asks for an async job
+	steps = append(steps, workflowSteps(ctx, clients, state, &lambdaARN)...)
+	steps = append(steps, removeWorkflowSteps(ctx, clients, state)...)
+
 	if state.FunctionURL == "" {
-		if err := ui.WithSpinner("Creating public function URL", func() error {
+		steps = append(steps, step("Creating public function URL", func() error {
 			_, err := createFunctionURL(ctx, clients, FunctionName)
 			return err
-		}); err != nil {
-			return nil, err
-		}
+		}))
 	}
 
-	// 9. Re-discover to get final state
+	// Optional node age alarm, and the sweep data transfer caps need
+	email := os.Getenv("TSE_ALARM_EMAIL")
+	if alarmHours > 0 {
+		steps = append(steps, nodeAgeAlarmSteps(ctx, clients, &lambdaARN, alarmHours, email, &topicARN)...)
+	}
+	steps = append(steps, metricsScheduleSteps(ctx, clients, &lambdaARN, alarmHours)...)
+	steps = append(steps, warmScheduleSteps(ctx, clients, state, &lambdaARN)...)
+
+	// 5. Re-discover to get final state
 	var finalState *InfrastructureState
-	if err := ui.WithSpinner("Verifying deployment", func() error {
+	steps = append(steps, step("Verifying deployment", func() error {
 		var err error
 		finalState, err = AutodiscoverInfrastructure(ctx, region)
-		return err
-	}); err != nil {
-		return nil, fmt.Errorf("failed to verify deployment: %w", err)
-	}
+		if err != nil {
+			return fmt.Errorf("failed to verify deployment: %w", err)
+		}
+		return nil
+	}))
 
+	if err := ui.RunSteps(steps); err != nil {
+		return nil, err
+	}
 	fmt.Println()
+	if alarmHours > 0 {
+		printAlarmSubscription(email, topicARN)
+	}
+
 	fmt.Println(ui.Success("✓ Infrastructure deployment complete!"))
 	fmt.Println()
 
@@ -164,6 +259,101 @@ func Setup(ctx context.Context, region string) (*SetupResult, error) {
 	}, nil
 }
 
+// applyDeployOptions applies the security baseline, custom regions, data transfer
+// caps, node age alarm, warm-keeper and orchestration, if chosen, to an already-complete
+// deployment, and brings its launch templates, deployment ID and Lambda size up
+// to date.
+func applyDeployOptions(ctx context.Context, region string, state *InfrastructureState, hours int) error {
+	baseline := os.Getenv("TSE_SECURITY_BASELINE")
+	_, keepWarmSet, _ := KeepWarm()
+	if baseline == "" && hours == 0 && !customRegionsSet() && !transferCapsSet() && !readTokenSet() && !telegramSet() && !keyExpiryTokenSet() && !orchestrationSet() && !lambdaSizeStale(state) && !keepWarmSet &&
+		!launchTemplateStale(state) && !launchTemplateEnvMissing(state) && !deploymentIDMissing(state) {
+		return nil
+	}
+
+	clients, err := NewAWSClients(ctx, region)
+	if err != nil {
+		return err
+	}
+
+	steps := launchTemplateSteps(ctx, clients, state)
+	if deploymentIDMissing(state) {
+		steps = append(steps, step("Tagging Lambda with deployment ID", func() error {
+			return tagLambdaDeployment(ctx, clients, state.Lambda.ARN)
+		}))
+	}
+	updatePolicy := step("Updating inline EC2/VPC policy", func() error {
+		return createInlinePolicy(ctx, clients, RoleName)
+	})
+	updateEnv := func(message string) ui.Step {
+		return step(message, func() error {
+			return ensureLambdaConfig(ctx, clients, FunctionName)
+		})
+	}
+
+	// The workflow exists before the Lambda is pointed at it
+	lambdaARN := state.Lambda.ARN
+	steps = append(steps, workflowSteps(ctx, clients, state, &lambdaARN)...)
+
+	switch {
+	case baseline != "":
+		// Switching baselines only needs the Lambda's environment (and the policy it checks with) updated
+		steps = append(steps, updatePolicy, updateEnv(fmt.Sprintf("Applying %s security baseline", baseline)))
+	case transferCapsSet():
+		// Caps need the environment too, and the policy for reading CloudWatch metrics.
+		// Custom regions ride along in the same environment update.
+		steps = append(steps, updatePolicy, updateEnv("Applying data transfer caps"))
+	case launchTemplateEnvMissing(state):
+		// Custom regions ride along here too
+		steps = append(steps, updatePolicy, updateEnv("Pointing the Lambda at the launch templates"))
+	case deploymentIDMissing(state):
+		// Custom regions ride along here too
+		steps = append(steps, updateEnv("Giving the Lambda its deployment ID"))
+	case orchestrationSet():
+		// The policy lets the Lambda start workflows
+		mode, _, _ := Orchestration()
+		steps = append(steps, updatePolicy, updateEnv(fmt.Sprintf("Switching to %s orchestration", mode)))
+	case customRegionsSet():
+		// ensureLambdaConfig skips the update when nothing changed
+		steps = append(steps, updateEnv("Updating Lambda regions"))
+	case readTokenSet():
+		steps = append(steps, updateEnv("Setting the read-only token"))
+	case telegramSet():
+		steps = append(steps, updateEnv("Configuring the Telegram bot"))
+	case keyExpiryTokenSet():
+		steps = append(steps, updateEnv("Setting the Tailscale API token"))
+	case lambdaSizeStale(state):
+		memoryMB, timeoutSeconds, _ := LambdaSize()
+		steps = append(steps, updateEnv(fmt.Sprintf("Resizing the Lambda to %d MB with a %ds timeout", memoryMB, timeoutSeconds)))
+	}
+
+	// ...and removed once it has been pointed away
+	steps = append(steps, removeWorkflowSteps(ctx, clients, state)...)
+
+	var topicARN string
+	email := os.Getenv("TSE_ALARM_EMAIL")
+	steps = append(steps, metricsScheduleSteps(ctx, clients, &lambdaARN, hours)...)
+	if hours > 0 {
+		steps = append(steps, nodeAgeAlarmSteps(ctx, clients, &lambdaARN, hours, email, &topicARN)...)
+	}
+	steps = append(steps, warmScheduleSteps(ctx, clients, state, &lambdaARN)...)
+
+	if err := ui.RunSteps(steps); err != nil {
+		return err
+	}
+	fmt.Println()
+	if hours > 0 {
+		printAlarmSubscription(email, topicARN)
+	}
+
+	return nil
+}
+
+// step is a ui.Step that has no status to report
+func step(name string, run func() error) ui.Step {
+	return ui.Step{Name: name, Run: func(func(string)) error { return run() }}
+}
+
 // generateAuthToken creates a cryptographically secure random token.
 func generateAuthToken() string {
 	b := make([]byte, 32) // 256 bits
@@ -173,3 +363,9 @@ func generateAuthToken() string {
 	}
 	return hex.EncodeToString(b)
 }
+
+// customRegionsSet reports whether custom regions or a region allowlist are
+// configured, so the Lambda's environment has to carry them
+func customRegionsSet() bool {
+	return os.Getenv(regions.EnvCustomRegions) != "" || os.Getenv(regions.EnvOnlyRegions) != ""
+}
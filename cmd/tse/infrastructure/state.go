@@ -1,36 +1,85 @@
 package infrastructure
 
 // Resource represents an AWS resource with basic identifying information.
-// Used for resources that share the same structure (IAM Role, Lambda Function, Log Group).
+// Used for resources that share the same structure (IAM Role, Lambda Function, Log Group, Table).
 type Resource struct {
 	Name string
 	ARN  string
 	Tags map[string]string
 }
 
+// CORS is a function URL's CORS configuration
+type CORS struct {
+	AllowCredentials bool
+	AllowOrigins     []string
+	AllowMethods     []string
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	MaxAge           int32
+}
+
 // InfrastructureState represents the discovered state of TSE AWS infrastructure.
 // All resources are discovered via tags (ManagedBy=tse) with no local state file.
 type InfrastructureState struct {
 	LogGroup    *Resource
+	Table       *Resource // DynamoDB state table (scoped tokens, etc.)
 	IAMRole     *Resource
+	NodeProfile *Resource // Instance profile exit nodes use to tag themselves ready
 	Lambda      *Resource
 	FunctionURL string // Just the URL string, no need for separate type
-	Policies    struct {
+
+	// DeploymentID is the Lambda's tse:deployment tag, empty for a Lambda from
+	// before deployment IDs
+	DeploymentID string
+
+	Policies struct {
 		Managed        bool   // Whether AWSLambdaBasicExecutionRole is attached
 		InlineName     string // Name of inline policy
 		InlineDocument string // Inline policy document
 	}
+
+	// Configuration of the discovered resources, compared against the
+	// desired configuration by Plan. Zero values mean "not discovered".
+	Config struct {
+		LambdaMemoryMB   int32
+		LambdaTimeout    int32    // Seconds
+		LambdaEnvKeys    []string // Sorted; values are secrets and never kept
+		LogRetentionDays int32    // 0 means logs never expire
+		URLCors          *CORS
+	}
+
+	// Optional node age alarm (tse deploy --alarm-hours); not part of IsComplete
+	Alarm      *Resource // CloudWatch alarm; Tags["ThresholdHours"] holds its threshold
+	AlarmTopic *Resource // SNS topic the alarm notifies
+	Schedule   *Resource // EventBridge rule that has the Lambda publish node metrics
+
+	// Optional warm-keeper (tse deploy --keep-warm); not part of IsComplete
+	WarmSchedule *Resource // EventBridge rule that pings the Lambda
+
+	// Optional Step Functions orchestration (tse deploy --orchestration
+	// stepfunctions); not part of IsComplete
+	Workflow     *Resource // State machine that runs async jobs
+	WorkflowRole *Resource // Role it invokes the Lambda with
+
+	// Exit node launch template, as found in the deploy region; Tags["Version"]
+	// holds its default version's description. Not part of IsComplete: starts
+	// work without it, and deploy adds it to older deployments.
+	LaunchTemplate *Resource
 }
 
 // Exists returns true if at least one infrastructure resource was found.
 func (s *InfrastructureState) Exists() bool {
-	return s.LogGroup != nil || s.IAMRole != nil || s.Lambda != nil
+	return s.LogGroup != nil || s.Table != nil || s.IAMRole != nil || s.NodeProfile != nil || s.Lambda != nil ||
+		s.Alarm != nil || s.AlarmTopic != nil || s.Schedule != nil || s.WarmSchedule != nil || s.LaunchTemplate != nil ||
+		s.Workflow != nil || s.WorkflowRole != nil
 }
 
 // IsComplete returns true if all required infrastructure is deployed.
 func (s *InfrastructureState) IsComplete() bool {
 	return s.LogGroup != nil &&
+		s.Table != nil &&
 		s.IAMRole != nil &&
+		s.NodeProfile != nil &&
 		s.Lambda != nil &&
 		s.FunctionURL != "" &&
 		s.Policies.Managed &&
@@ -43,9 +92,15 @@ func (s *InfrastructureState) Missing() []string {
 	if s.LogGroup == nil {
 		missing = append(missing, "CloudWatch Log Group")
 	}
+	if s.Table == nil {
+		missing = append(missing, "DynamoDB Table")
+	}
 	if s.IAMRole == nil {
 		missing = append(missing, "IAM Role")
 	}
+	if s.NodeProfile == nil {
+		missing = append(missing, "Node Instance Profile")
+	}
 	if !s.Policies.Managed {
 		missing = append(missing, "Managed Policy Attachment")
 	}
@@ -61,11 +116,11 @@ func (s *InfrastructureState) Missing() []string {
 	return missing
 }
 
-// HasOnlyIAMResources returns true if only IAM resources exist (role/policies)
-// but no regional resources (Lambda, logs).
+// HasOnlyIAMResources returns true if only IAM resources exist (roles/policies/profile)
+// but no regional resources (Lambda, logs, table).
 // This indicates the user might be checking the wrong region.
 func (s *InfrastructureState) HasOnlyIAMResources() bool {
-	hasIAM := s.IAMRole != nil || s.Policies.Managed || s.Policies.InlineName != ""
-	hasRegional := s.LogGroup != nil || s.Lambda != nil || s.FunctionURL != ""
+	hasIAM := s.IAMRole != nil || s.NodeProfile != nil || s.Policies.Managed || s.Policies.InlineName != ""
+	hasRegional := s.LogGroup != nil || s.Table != nil || s.Lambda != nil || s.FunctionURL != ""
 	return hasIAM && !hasRegional
 }
@@ -7,7 +7,9 @@ import (
 func TestState_AllResourcesPresent(t *testing.T) {
 	state := &InfrastructureState{
 		LogGroup:    &Resource{Name: "test-log"},
+		Table:       &Resource{Name: "test-table"},
 		IAMRole:     &Resource{Name: "test-role"},
+		NodeProfile: &Resource{Name: "test-profile"},
 		Lambda:      &Resource{Name: "test-lambda"},
 		FunctionURL: "https://test.lambda-url.us-east-2.on.aws/",
 	}
@@ -37,14 +39,16 @@ func TestState_NoResources(t *testing.T) {
 	}
 
 	missing := state.Missing()
-	if len(missing) != 6 {
-		t.Errorf("Expected 6 missing resources, got %d: %v", len(missing), missing)
+	if len(missing) != 8 {
+		t.Errorf("Expected 8 missing resources, got %d: %v", len(missing), missing)
 	}
 
 	// Check all expected resources are listed as missing
 	expectedMissing := map[string]bool{
 		"CloudWatch Log Group":      true,
+		"DynamoDB Table":            true,
 		"IAM Role":                  true,
+		"Node Instance Profile":     true,
 		"Managed Policy Attachment": true,
 		"Inline Policy":             true,
 		"Lambda Function":           true,
@@ -74,7 +78,9 @@ func TestState_PartialDeployment(t *testing.T) {
 			expectExists:   true,
 			expectComplete: false,
 			expectMissing: []string{
+				"DynamoDB Table",
 				"IAM Role",
+				"Node Instance Profile",
 				"Managed Policy Attachment",
 				"Inline Policy",
 				"Lambda Function",
@@ -90,6 +96,8 @@ func TestState_PartialDeployment(t *testing.T) {
 			expectComplete: false,
 			expectMissing: []string{
 				"CloudWatch Log Group",
+				"DynamoDB Table",
+				"Node Instance Profile",
 				"Managed Policy Attachment",
 				"Inline Policy",
 				"Lambda Function",
@@ -100,9 +108,11 @@ func TestState_PartialDeployment(t *testing.T) {
 			name: "Lambda without URL",
 			state: func() *InfrastructureState {
 				s := &InfrastructureState{
-					LogGroup: &Resource{Name: "test-log"},
-					IAMRole:  &Resource{Name: "test-role"},
-					Lambda:   &Resource{Name: "test-lambda"},
+					LogGroup:    &Resource{Name: "test-log"},
+					Table:       &Resource{Name: "test-table"},
+					IAMRole:     &Resource{Name: "test-role"},
+					NodeProfile: &Resource{Name: "test-profile"},
+					Lambda:      &Resource{Name: "test-lambda"},
 				}
 				s.Policies.Managed = true
 				s.Policies.InlineName = "test-policy"
@@ -117,7 +127,9 @@ func TestState_PartialDeployment(t *testing.T) {
 			state: func() *InfrastructureState {
 				s := &InfrastructureState{
 					LogGroup:    &Resource{Name: "test-log"},
+					Table:       &Resource{Name: "test-table"},
 					IAMRole:     &Resource{Name: "test-role"},
+					NodeProfile: &Resource{Name: "test-profile"},
 					Lambda:      &Resource{Name: "test-lambda"},
 					FunctionURL: "https://test.lambda-url.us-east-2.on.aws/",
 				}
@@ -128,6 +140,42 @@ func TestState_PartialDeployment(t *testing.T) {
 			expectComplete: false,
 			expectMissing:  []string{"Inline Policy"},
 		},
+		{
+			name: "Existing deployment from before the state table",
+			state: func() *InfrastructureState {
+				s := &InfrastructureState{
+					LogGroup:    &Resource{Name: "test-log"},
+					IAMRole:     &Resource{Name: "test-role"},
+					NodeProfile: &Resource{Name: "test-profile"},
+					Lambda:      &Resource{Name: "test-lambda"},
+					FunctionURL: "https://test.lambda-url.us-east-2.on.aws/",
+				}
+				s.Policies.Managed = true
+				s.Policies.InlineName = "test-policy"
+				return s
+			}(),
+			expectExists:   true,
+			expectComplete: false,
+			expectMissing:  []string{"DynamoDB Table"},
+		},
+		{
+			name: "Existing deployment from before the node instance profile",
+			state: func() *InfrastructureState {
+				s := &InfrastructureState{
+					LogGroup:    &Resource{Name: "test-log"},
+					Table:       &Resource{Name: "test-table"},
+					IAMRole:     &Resource{Name: "test-role"},
+					Lambda:      &Resource{Name: "test-lambda"},
+					FunctionURL: "https://test.lambda-url.us-east-2.on.aws/",
+				}
+				s.Policies.Managed = true
+				s.Policies.InlineName = "test-policy"
+				return s
+			}(),
+			expectExists:   true,
+			expectComplete: false,
+			expectMissing:  []string{"Node Instance Profile"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -3,13 +3,129 @@ package infrastructure
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/anoldguy/tse/cmd/tse/ui"
 )
 
-// Teardown removes all TSE infrastructure in reverse dependency order.
+// Teardown targets name groups of resources that can be deleted on their own
+const (
+	TargetLambda = "lambda" // Lambda function, function URL, schedules, workflow, and launch templates
+	TargetLogs   = "logs"   // CloudWatch log group
+	TargetIAM    = "iam"    // Lambda and workflow roles and policies, exit node instance profile
+	TargetAlerts = "alerts" // CloudWatch alarm and SNS topic
+	TargetTable  = "table"  // DynamoDB state table (tokens, audit log)
+)
+
+// TeardownTargets lists every valid teardown target
+var TeardownTargets = []string{TargetLambda, TargetLogs, TargetIAM, TargetAlerts, TargetTable}
+
+// TeardownOptions selects what Teardown deletes. The zero value deletes everything.
+type TeardownOptions struct {
+	Only           []string // Targets to delete; empty means all of them
+	KeepIAM        bool     // Leave the IAM roles alone even if Only would include them
+	DryRun         bool     // List the delete calls instead of making them
+	AllDeployments bool     // Also delete shared resources another deployment created
+}
+
+// ParseTeardownTargets parses a comma-separated --only list
+func ParseTeardownTargets(list string) ([]string, error) {
+	var targets []string
+	for _, target := range strings.Split(list, ",") {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		if !slices.Contains(TeardownTargets, target) {
+			return nil, fmt.Errorf("unknown teardown target %s (valid: %s)", ui.Highlight(target), strings.Join(TeardownTargets, ", "))
+		}
+		if !slices.Contains(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+// Includes reports whether target is deleted
+func (o TeardownOptions) Includes(target string) bool {
+	if o.KeepIAM && target == TargetIAM {
+		return false
+	}
+	return len(o.Only) == 0 || slices.Contains(o.Only, target)
+}
+
+// Full reports whether every target is deleted
+func (o TeardownOptions) Full() bool {
+	for _, target := range TeardownTargets {
+		if !o.Includes(target) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectResources clears the resources in state that opts doesn't include, so
+// the listing and deletion below only see what's being torn down
+func selectResources(state *InfrastructureState, opts TeardownOptions) *InfrastructureState {
+	selected := *state
+	if !opts.Includes(TargetLambda) {
+		selected.Lambda = nil
+		selected.FunctionURL = ""
+		selected.Schedule = nil
+		selected.WarmSchedule = nil
+		selected.Workflow = nil
+		selected.LaunchTemplate = nil
+	}
+	if !opts.Includes(TargetLogs) {
+		selected.LogGroup = nil
+	}
+	if !opts.Includes(TargetIAM) {
+		selected.IAMRole = nil
+		selected.Policies.Managed = false
+		selected.Policies.InlineName = ""
+		selected.NodeProfile = nil
+		selected.WorkflowRole = nil
+	}
+	if !opts.Includes(TargetAlerts) {
+		selected.Alarm = nil
+		selected.AlarmTopic = nil
+	}
+	if !opts.Includes(TargetTable) {
+		selected.Table = nil
+	}
+	return &selected
+}
+
+// keepOtherDeployments clears the IAM roles from state if a different deployment
+// created them, unless opts covers all deployments, returning the names of those
+// kept. Their names are account-wide, so every deployment in the account uses
+// them. Launch templates get the same check region by region as they're deleted.
+func keepOtherDeployments(state *InfrastructureState, opts TeardownOptions) []string {
+	if opts.AllDeployments {
+		return nil
+	}
+	var kept []string
+	if state.IAMRole != nil && !ownedBy(state.IAMRole, state.DeploymentID) {
+		kept = append(kept, state.IAMRole.Name)
+		state.IAMRole = nil
+		state.Policies.Managed = false
+		state.Policies.InlineName = ""
+	}
+	if state.NodeProfile != nil && !ownedBy(state.NodeProfile, state.DeploymentID) {
+		kept = append(kept, state.NodeProfile.Name)
+		state.NodeProfile = nil
+	}
+	if state.WorkflowRole != nil && !ownedBy(state.WorkflowRole, state.DeploymentID) {
+		kept = append(kept, state.WorkflowRole.Name)
+		state.WorkflowRole = nil
+	}
+	return kept
+}
+
+// Teardown removes the TSE infrastructure selected by opts in reverse dependency order.
 // Returns error only on critical failures; logs warnings for individual resource failures.
-func Teardown(ctx context.Context, region string) error {
+func Teardown(ctx context.Context, region string, opts TeardownOptions) error {
 	// 1. Discover what exists
 	var state *InfrastructureState
 	err := ui.WithSpinner("Discovering infrastructure to teardown", func() error {
@@ -29,6 +145,12 @@ func Teardown(ctx context.Context, region string) error {
 
 	// 2. Check for legacy resources (missing ManagedBy tag)
 	isLegacy := detectLegacyResources(state)
+	state = selectResources(state, opts)
+	kept := keepOtherDeployments(state, opts)
+	if !state.Exists() {
+		fmt.Println("None of the selected TSE infrastructure exists")
+		return nil
+	}
 	if isLegacy {
 		fmt.Println("⚠️  Legacy infrastructure detected!")
 		fmt.Println("    Resources found without 'ManagedBy=tse' tag.")
@@ -38,12 +160,30 @@ func Teardown(ctx context.Context, region string) error {
 
 	// 3. Show what will be deleted
 	fmt.Println("The following resources will be deleted:")
+	if state.WarmSchedule != nil {
+		fmt.Printf("  - Warm-keeper Schedule: %s\n", state.WarmSchedule.Name)
+	}
+	if state.Workflow != nil {
+		fmt.Printf("  - Step Functions Workflow: %s\n", state.Workflow.Name)
+	}
+	if state.Schedule != nil {
+		fmt.Printf("  - Metrics Schedule: %s\n", state.Schedule.Name)
+	}
+	if state.Alarm != nil {
+		fmt.Printf("  - CloudWatch Alarm: %s\n", state.Alarm.Name)
+	}
+	if state.AlarmTopic != nil {
+		fmt.Printf("  - SNS Topic: %s (and its subscriptions)\n", state.AlarmTopic.Name)
+	}
 	if state.FunctionURL != "" {
 		fmt.Printf("  - Function URL: %s\n", state.FunctionURL)
 	}
 	if state.Lambda != nil {
 		fmt.Printf("  - Lambda Function: %s\n", state.Lambda.Name)
 	}
+	if state.LaunchTemplate != nil {
+		fmt.Printf("  - Launch Template: %s (in every region)\n", state.LaunchTemplate.Name)
+	}
 	if state.Policies.InlineName != "" {
 		fmt.Printf("  - Inline Policy: %s\n", state.Policies.InlineName)
 	}
@@ -53,10 +193,31 @@ func Teardown(ctx context.Context, region string) error {
 	if state.IAMRole != nil {
 		fmt.Printf("  - IAM Role: %s\n", state.IAMRole.Name)
 	}
+	if state.WorkflowRole != nil {
+		fmt.Printf("  - Workflow Role: %s\n", state.WorkflowRole.Name)
+	}
+	if state.NodeProfile != nil {
+		fmt.Printf("  - Instance Profile: %s (and role %s)\n", state.NodeProfile.Name, NodeRoleName)
+	}
 	if state.LogGroup != nil {
 		fmt.Printf("  - CloudWatch Log Group: %s\n", state.LogGroup.Name)
 	}
+	if state.Table != nil {
+		fmt.Printf("  - DynamoDB Table: %s (tokens, audit log)\n", state.Table.Name)
+	}
 	fmt.Println()
+	if len(kept) > 0 {
+		fmt.Printf("Keeping %s: another deployment created them (delete anyway with --all-deployments)\n", strings.Join(kept, ", "))
+		fmt.Println()
+	}
+
+	if opts.DryRun {
+		fmt.Println("Teardown would call:")
+		for _, call := range TeardownCalls(state) {
+			fmt.Printf("  %s\n", call)
+		}
+		return nil
+	}
 
 	// 4. Create AWS clients once
 	clients, err := NewAWSClients(ctx, region)
@@ -65,7 +226,47 @@ func Teardown(ctx context.Context, region string) error {
 	}
 
 	// 5. Delete in reverse dependency order
-	// Order: Function URL → Lambda → Inline Policy → Managed Policy → IAM Role → Log Group
+	// Order: Warm-keeper → Workflow → Metrics Schedule → Alarm → Topic → Function URL → Lambda → Launch Templates → Inline Policy → Managed Policy → IAM Role → Workflow Role → Instance Profile → Log Group → Table
+
+	if state.WarmSchedule != nil {
+		if err := ui.WithSpinner("Deleting warm-keeper schedule", func() error {
+			return deleteSchedule(ctx, clients, warmRule())
+		}); err != nil {
+			fmt.Printf("⚠️  Warning: %v\n", err)
+		}
+	}
+
+	if state.Workflow != nil {
+		if err := ui.WithSpinner("Deleting Step Functions workflow", func() error {
+			return deleteWorkflow(ctx, clients, state.Workflow, nil)
+		}); err != nil {
+			fmt.Printf("⚠️  Warning: %v\n", err)
+		}
+	}
+
+	if state.Schedule != nil {
+		if err := ui.WithSpinner("Deleting metrics schedule", func() error {
+			return deleteMetricsSchedule(ctx, clients)
+		}); err != nil {
+			fmt.Printf("⚠️  Warning: %v\n", err)
+		}
+	}
+
+	if state.Alarm != nil {
+		if err := ui.WithSpinner("Deleting CloudWatch alarm", func() error {
+			return deleteNodeAgeAlarm(ctx, clients)
+		}); err != nil {
+			fmt.Printf("⚠️  Warning: %v\n", err)
+		}
+	}
+
+	if state.AlarmTopic != nil {
+		if err := ui.WithSpinner("Deleting SNS alert topic", func() error {
+			return deleteAlarmTopic(ctx, clients, state.AlarmTopic.ARN)
+		}); err != nil {
+			fmt.Printf("⚠️  Warning: %v\n", err)
+		}
+	}
 
 	if state.FunctionURL != "" && state.Lambda != nil {
 		if err := ui.WithSpinner("Deleting function URL", func() error {
@@ -83,6 +284,18 @@ func Teardown(ctx context.Context, region string) error {
 		}
 	}
 
+	if state.LaunchTemplate != nil {
+		if err := ui.RunSteps([]ui.Step{{Name: "Deleting launch templates", Run: func(status func(string)) error {
+			deployment := state.DeploymentID
+			if opts.AllDeployments {
+				deployment = ""
+			}
+			return deleteLaunchTemplates(ctx, clients, deployment, status)
+		}}}); err != nil {
+			fmt.Printf("⚠️  Warning: %v\n", err)
+		}
+	}
+
 	// CRITICAL: Must delete/detach policies before deleting role
 	if state.Policies.InlineName != "" && state.IAMRole != nil {
 		if err := ui.WithSpinner("Deleting inline policy", func() error {
@@ -108,6 +321,22 @@ func Teardown(ctx context.Context, region string) error {
 		}
 	}
 
+	if state.WorkflowRole != nil {
+		if err := ui.WithSpinner("Deleting workflow role", func() error {
+			return deleteWorkflow(ctx, clients, nil, state.WorkflowRole)
+		}); err != nil {
+			fmt.Printf("⚠️  Warning: %v\n", err)
+		}
+	}
+
+	if state.NodeProfile != nil {
+		if err := ui.WithSpinner("Deleting exit node instance profile", func() error {
+			return deleteNodeInstanceProfile(ctx, clients)
+		}); err != nil {
+			fmt.Printf("⚠️  Warning: %v\n", err)
+		}
+	}
+
 	if state.LogGroup != nil {
 		if err := ui.WithSpinner("Deleting CloudWatch log group", func() error {
 			return deleteLogGroup(ctx, clients, state.LogGroup.Name)
@@ -116,9 +345,21 @@ func Teardown(ctx context.Context, region string) error {
 		}
 	}
 
+	if state.Table != nil {
+		if err := ui.WithSpinner("Deleting DynamoDB state table", func() error {
+			return deleteTable(ctx, clients, state.Table.Name)
+		}); err != nil {
+			fmt.Printf("⚠️  Warning: %v\n", err)
+		}
+	}
+
 	fmt.Println()
 	fmt.Println(ui.Success("✓ Teardown complete!"))
-	if isLegacy {
+	if !opts.Full() {
+		fmt.Println()
+		fmt.Println("  Resources outside the selected targets were kept.")
+		fmt.Println("  Recreate what was removed with: tse deploy")
+	} else if isLegacy {
 		fmt.Println()
 		fmt.Println("  Legacy infrastructure has been removed.")
 		fmt.Println("  You can now deploy with: tse deploy")
@@ -150,6 +391,14 @@ func detectLegacyResources(state *InfrastructureState) bool {
 		}
 	}
 
+	// Check state table
+	if state.Table != nil {
+		hasResources = true
+		if state.Table.Tags["ManagedBy"] == TagManagedBy {
+			hasTaggedResource = true
+		}
+	}
+
 	// Check Lambda
 	if state.Lambda != nil {
 		hasResources = true
@@ -1,6 +1,7 @@
 package infrastructure
 
 import (
+	"slices"
 	"testing"
 )
 
@@ -152,3 +153,77 @@ func TestDetectLegacyResources(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTeardownTargets(t *testing.T) {
+	targets, err := ParseTeardownTargets("lambda, logs,lambda")
+	if err != nil {
+		t.Fatalf("ParseTeardownTargets: %v", err)
+	}
+	if !slices.Equal(targets, []string{TargetLambda, TargetLogs}) {
+		t.Errorf("targets = %v, want [lambda logs]", targets)
+	}
+
+	if targets, err := ParseTeardownTargets(""); err != nil || len(targets) != 0 {
+		t.Errorf("empty list = %v, %v; want no targets", targets, err)
+	}
+	if _, err := ParseTeardownTargets("lambda,vpc"); err == nil {
+		t.Error("unknown target accepted")
+	}
+}
+
+func TestTeardownOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts TeardownOptions
+		want []string
+		full bool
+	}{
+		{"everything", TeardownOptions{}, TeardownTargets, true},
+		{"only lambda", TeardownOptions{Only: []string{TargetLambda}}, []string{TargetLambda}, false},
+		{"keep iam", TeardownOptions{KeepIAM: true}, []string{TargetLambda, TargetLogs, TargetAlerts, TargetTable}, false},
+		{"only iam kept", TeardownOptions{Only: []string{TargetIAM, TargetLogs}, KeepIAM: true}, []string{TargetLogs}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, target := range TeardownTargets {
+				if tt.opts.Includes(target) {
+					got = append(got, target)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("included = %v, want %v", got, tt.want)
+			}
+			if tt.opts.Full() != tt.full {
+				t.Errorf("Full() = %v, want %v", tt.opts.Full(), tt.full)
+			}
+		})
+	}
+}
+
+func TestSelectResourcesKeepsIAM(t *testing.T) {
+	state := &InfrastructureState{
+		Lambda:      &Resource{Name: "tailscale-exits"},
+		FunctionURL: "https://example.lambda-url.us-east-2.on.aws/",
+		IAMRole:     &Resource{Name: "tailscale-exits-role"},
+		NodeProfile: &Resource{Name: "tailscale-exits-node"},
+		LogGroup:    &Resource{Name: "/aws/lambda/tailscale-exits"},
+	}
+	state.Policies.Managed = true
+	state.Policies.InlineName = "tailscale-exits-policy"
+
+	selected := selectResources(state, TeardownOptions{Only: []string{TargetLambda}})
+	if selected.Lambda == nil || selected.FunctionURL == "" {
+		t.Error("Lambda was dropped from an --only lambda teardown")
+	}
+	if selected.IAMRole != nil || selected.NodeProfile != nil || selected.Policies.Managed || selected.Policies.InlineName != "" {
+		t.Errorf("IAM resources selected for an --only lambda teardown: %+v", selected)
+	}
+	if selected.LogGroup != nil {
+		t.Error("log group selected for an --only lambda teardown")
+	}
+	if state.IAMRole == nil || state.LogGroup == nil {
+		t.Error("selectResources modified the discovered state")
+	}
+}
@@ -0,0 +1,93 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anoldguy/tse/shared/telegram"
+)
+
+// telegramAPI is the Bot API's base URL; tests point it at a fake
+var telegramAPI = "https://api.telegram.org"
+
+// telegramSet reports whether a Telegram bot was configured, so the Lambda's
+// environment has to carry it
+func telegramSet() bool {
+	return os.Getenv(telegram.EnvBotToken) != ""
+}
+
+// ValidateTelegram checks the Telegram settings, if any: a bot token from
+// @BotFather and at least one chat allowed to use it
+func ValidateTelegram() error {
+	token, chats := os.Getenv(telegram.EnvBotToken), os.Getenv(telegram.EnvChatIDs)
+	switch {
+	case token == "" && chats == "":
+		return nil
+	case token == "":
+		return fmt.Errorf("%s needs %s", telegram.EnvChatIDs, telegram.EnvBotToken)
+	case !telegram.ValidBotToken(token):
+		return fmt.Errorf("%s doesn't look like a bot token from @BotFather (123456789:AA...)", telegram.EnvBotToken)
+	}
+	if _, err := telegram.ParseChatIDs(chats); err != nil {
+		return fmt.Errorf("%w\n\nHint: Don't know the chat's ID yet? Deploy with %s=1, message the bot, and it replies with the ID", err, telegram.EnvChatIDs)
+	}
+	return nil
+}
+
+// telegramWebhookURL is where Telegram posts the bot's updates
+func telegramWebhookURL(functionURL string) string {
+	return strings.TrimSuffix(functionURL, "/") + "/v1/telegram"
+}
+
+// RegisterTelegramWebhook points the bot at the Lambda, with the secret the
+// Lambda checks on every update. Registering again replaces the old webhook,
+// so deploy does it every time the bot is configured.
+func RegisterTelegramWebhook(ctx context.Context, functionURL, authToken string) error {
+	params := url.Values{}
+	params.Set("url", telegramWebhookURL(functionURL))
+	params.Set("secret_token", telegram.WebhookSecret(authToken))
+	params.Set("allowed_updates", `["message"]`)
+
+	endpoint := telegramAPI + "/bot" + os.Getenv(telegram.EnvBotToken) + "/setWebhook"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		// The URL holds the bot token; don't repeat it in the error
+		return fmt.Errorf("failed to reach Telegram")
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("unexpected response from Telegram (HTTP %d)", resp.StatusCode)
+	}
+	if !result.OK {
+		return fmt.Errorf("Telegram refused the webhook: %s", result.Description)
+	}
+	return nil
+}
+
+// telegramCalls lists the call RegisterTelegramWebhook makes
+func telegramCalls(functionURL string) []string {
+	if !telegramSet() {
+		return nil
+	}
+	if functionURL == "" {
+		functionURL = "(function URL)"
+	}
+	return []string{fmt.Sprintf("telegram:setWebhook url=%s allowed_updates=[\"message\"]", telegramWebhookURL(functionURL))}
+}
@@ -0,0 +1,92 @@
+package infrastructure
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/anoldguy/tse/shared/telegram"
+)
+
+const testBotToken = "123456789:AAEhBP0av28vAbCdEfGhIjKlMnOpQrStUvW"
+
+func TestValidateTelegram(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		chats   string
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "configured", token: testBotToken, chats: "1111,-2222"},
+		{name: "no chats", token: testBotToken, wantErr: true},
+		{name: "chats without bot", chats: "1111", wantErr: true},
+		{name: "bad token", token: "not-a-token", chats: "1111", wantErr: true},
+		{name: "bad chat", token: testBotToken, chats: "@me", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(telegram.EnvBotToken, tt.token)
+			t.Setenv(telegram.EnvChatIDs, tt.chats)
+			if err := ValidateTelegram(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTelegram() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegisterTelegramWebhook(t *testing.T) {
+	t.Setenv(telegram.EnvBotToken, testBotToken)
+
+	var path string
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		path = r.URL.Path
+		form, _ = url.ParseQuery(string(body))
+		if form.Get("url") == "" {
+			io.WriteString(w, `{"ok":false,"description":"Bad Request: bad webhook"}`)
+			return
+		}
+		io.WriteString(w, `{"ok":true,"result":true}`)
+	}))
+	defer server.Close()
+	old := telegramAPI
+	telegramAPI = server.URL
+	defer func() { telegramAPI = old }()
+
+	if err := RegisterTelegramWebhook(context.Background(), "https://abc.lambda-url.us-east-2.on.aws/", "root-token"); err != nil {
+		t.Fatalf("RegisterTelegramWebhook() error = %v", err)
+	}
+	if path != "/bot"+testBotToken+"/setWebhook" {
+		t.Errorf("path = %s", path)
+	}
+	if form.Get("url") != "https://abc.lambda-url.us-east-2.on.aws/v1/telegram" || form.Get("secret_token") != telegram.WebhookSecret("root-token") {
+		t.Errorf("setWebhook params = %v", form)
+	}
+}
+
+func TestTelegramCalls(t *testing.T) {
+	clearOptionEnv(t)
+	t.Setenv(telegram.EnvBotToken, testBotToken)
+	t.Setenv(telegram.EnvChatIDs, "1111")
+
+	calls := SetupCalls(deployedState(), 0)
+	if !slices.Contains(actions(calls), "lambda:UpdateFunctionConfiguration") {
+		t.Errorf("SetupCalls() = %v, want the Lambda's environment updated", calls)
+	}
+	for _, call := range append(calls, telegramCalls("https://abc.lambda-url.us-east-2.on.aws/")...) {
+		if strings.Contains(call, testBotToken) {
+			t.Errorf("call %q shows the bot token", call)
+		}
+	}
+	if got := telegramCalls(""); len(got) != 1 || !strings.HasPrefix(got[0], "telegram:setWebhook ") {
+		t.Errorf("telegramCalls() = %v", got)
+	}
+}
@@ -0,0 +1,113 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const (
+	// Optional warm-keeper (tse deploy --keep-warm): pings the Lambda so CLI
+	// requests after a quiet spell don't wait for a cold start
+	EnvKeepWarm = "TSE_KEEP_WARM"
+
+	// Lambda keeps an idle container for somewhat longer than this
+	warmSchedule    = "rate(5 minutes)"
+	warmStatementID = "tailscale-exits-warm-schedule"
+)
+
+// warmRule pings the Lambda with types.WarmPing, which it answers without doing anything
+func warmRule() scheduleRule {
+	return scheduleRule{
+		Name:        WarmRuleName,
+		Description: "Keeps the " + FunctionName + " Lambda warm",
+		Expression:  warmSchedule,
+		StatementID: warmStatementID,
+		Input:       warmPingInput(),
+		label:       "warm-keeper schedule",
+	}
+}
+
+// warmPingInput is the payload the warm-keeper schedule sends
+func warmPingInput() string {
+	input, _ := json.Marshal(types.WarmPing{Warm: true})
+	return string(input)
+}
+
+// KeepWarm reads TSE_KEEP_WARM: on (or true, 1) to create the warm-keeper
+// schedule, off (or false, 0) to remove it. set is false when it's unset, which
+// leaves the deployment as it is.
+func KeepWarm() (on, set bool, err error) {
+	raw := strings.ToLower(strings.TrimSpace(os.Getenv(EnvKeepWarm)))
+	switch raw {
+	case "":
+		return false, false, nil
+	case "on":
+		return true, true, nil
+	case "off":
+		return false, true, nil
+	}
+	on, err = strconv.ParseBool(raw)
+	if err != nil {
+		return false, false, fmt.Errorf("%s must be on or off, got %q", EnvKeepWarm, raw)
+	}
+	return on, true, nil
+}
+
+// warmScheduleSteps creates the warm-keeper schedule when TSE_KEEP_WARM is on,
+// or removes a deployed one when it's off. lambdaARN is read when the step runs.
+func warmScheduleSteps(ctx context.Context, clients *AWSClients, state *InfrastructureState, lambdaARN *string) []ui.Step {
+	on, set, _ := KeepWarm()
+	switch {
+	case on:
+		return []ui.Step{step("Scheduling a warm-keeper ping every 5 minutes", func() error {
+			return createSchedule(ctx, clients, warmRule(), *lambdaARN)
+		})}
+	case set && state.WarmSchedule != nil:
+		return []ui.Step{step("Removing the warm-keeper schedule", func() error {
+			return deleteSchedule(ctx, clients, warmRule())
+		})}
+	}
+	return nil
+}
+
+// warmScheduleCalls lists the calls warmScheduleSteps makes
+func warmScheduleCalls(state *InfrastructureState, lambdaARN string) []string {
+	on, set, _ := KeepWarm()
+	switch {
+	case on:
+		return []string{
+			fmt.Sprintf("events:PutRule Name=%s ScheduleExpression=%s", WarmRuleName, warmSchedule),
+			fmt.Sprintf("lambda:AddPermission FunctionName=%s StatementId=%s Principal=events.amazonaws.com", FunctionName, warmStatementID),
+			fmt.Sprintf("events:PutTargets Rule=%s Arn=%s Input=%s", WarmRuleName, lambdaARN, warmRule().Input),
+		}
+	case set && state.WarmSchedule != nil:
+		return deleteWarmScheduleCalls()
+	}
+	return nil
+}
+
+// deleteWarmScheduleCalls lists the calls deleteSchedule makes for the warm-keeper
+func deleteWarmScheduleCalls() []string {
+	return []string{
+		fmt.Sprintf("events:RemoveTargets Rule=%s Ids=%s", WarmRuleName, scheduleTargetID),
+		"events:DeleteRule Name=" + WarmRuleName,
+	}
+}
+
+// discoverWarmSchedule finds the warm-keeper schedule. Like the alarm, a failed
+// lookup counts as "not deployed".
+func discoverWarmSchedule(ctx context.Context, clients *AWSClients, state *InfrastructureState) {
+	if rule, err := clients.EventBridge.DescribeRule(ctx, &eventbridge.DescribeRuleInput{Name: aws.String(WarmRuleName)}); err == nil {
+		state.WarmSchedule = &Resource{Name: aws.ToString(rule.Name), ARN: aws.ToString(rule.Arn)}
+	}
+}
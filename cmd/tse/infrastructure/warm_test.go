@@ -0,0 +1,69 @@
+package infrastructure
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestKeepWarm(t *testing.T) {
+	tests := []struct {
+		raw     string
+		on, set bool
+		wantErr bool
+	}{
+		{raw: ""},
+		{raw: "on", on: true, set: true},
+		{raw: "TRUE", on: true, set: true},
+		{raw: "off", set: true},
+		{raw: "0", set: true},
+		{raw: "sometimes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			t.Setenv(EnvKeepWarm, tt.raw)
+			on, set, err := KeepWarm()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("KeepWarm() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if on != tt.on || set != tt.set {
+				t.Errorf("KeepWarm() = %v, %v, want %v, %v", on, set, tt.on, tt.set)
+			}
+		})
+	}
+}
+
+func TestWarmScheduleCalls(t *testing.T) {
+	clearOptionEnv(t)
+	state := deployedState()
+	state.Lambda.ARN = "arn:aws:lambda:us-east-2:123456789012:function:tailscale-exits"
+
+	t.Setenv(EnvKeepWarm, "on")
+	calls := SetupCalls(state, 0)
+	if got, want := actions(calls), []string{"events:PutRule", "lambda:AddPermission", "events:PutTargets"}; !slices.Equal(got, want) {
+		t.Fatalf("SetupCalls() = %v, want %v", got, want)
+	}
+	if !strings.Contains(calls[0], WarmRuleName) || !strings.Contains(calls[2], `Input={"tse_warm":true}`) {
+		t.Errorf("SetupCalls() = %v", calls)
+	}
+
+	// Off only removes a schedule that's there
+	t.Setenv(EnvKeepWarm, "off")
+	if calls := SetupCalls(state, 0); len(calls) != 0 {
+		t.Errorf("SetupCalls() = %v, want nothing without a warm-keeper", calls)
+	}
+	state.WarmSchedule = &Resource{Name: WarmRuleName}
+	if got, want := actions(SetupCalls(state, 0)), []string{"events:RemoveTargets", "events:DeleteRule"}; !slices.Equal(got, want) {
+		t.Errorf("SetupCalls() = %v, want %v", got, want)
+	}
+
+	// Unset leaves it alone
+	t.Setenv(EnvKeepWarm, "")
+	if calls := SetupCalls(state, 0); len(calls) != 0 {
+		t.Errorf("SetupCalls() = %v, want nothing", calls)
+	}
+	if calls := TeardownCalls(&InfrastructureState{WarmSchedule: state.WarmSchedule}); len(calls) != 2 || !strings.HasSuffix(calls[1], WarmRuleName) {
+		t.Errorf("TeardownCalls() = %v", calls)
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/anoldguy/tse/cmd/tse/config"
+	"github.com/anoldguy/tse/cmd/tse/infrastructure"
+	"github.com/anoldguy/tse/cmd/tse/initstate"
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/tailscale"
+)
+
+const initUsage = `Usage: tse init [flags]
+
+Set up TSE from scratch in one guided run:
+
+  1. Check prerequisites (AWS credentials, Tailscale API token, tailnet)
+  2. Configure Tailscale (ACL policy and an exit node auth key, as 'tse setup')
+  3. Deploy the Lambda to your default AWS region (as 'tse deploy') and verify it
+  4. Save the function URL and auth token to a profile in the config file
+  5. Start a test exit node
+
+Each step is a checkpoint. If one fails, fix the problem and run 'tse init'
+again: it picks up at the step that failed. Progress (with secrets sealed
+like the config file's) is kept in ~/.local/state/tse/init.json until init
+completes.
+
+Prerequisites:
+  - AWS credentials for the account to deploy to (AWS_PROFILE, etc.)
+  - TAILSCALE_API_TOKEN: an API access token from an Owner or Admin,
+    created at https://login.tailscale.com/admin/settings/keys
+
+Flags:
+  --tailnet <name>       Your tailnet (e.g. yourname@github or example.com;
+                         default: $TSE_TAILNET, or asked for)
+  --profile-name <name>  Profile to save the deployment to (default: default)
+  --region <name>        Region for the test exit node (default: the one
+                         the Lambda deploys to)
+  --skip-test-node       Don't offer to start a test exit node
+  --restart              Forget an earlier run's progress and start over
+
+Examples:
+  tse init
+  tse init --tailnet yourname@github --region frankfurt
+  tse init --restart
+`
+
+// initStep is one checkpoint of tse init
+type initStep struct {
+	stage initstate.Stage
+	title string
+	run   func() error
+}
+
+// initWizard carries what the steps of tse init share
+type initWizard struct {
+	ctx      context.Context
+	cfg      *config.Config
+	progress *initstate.Progress
+	path     string // Progress file
+
+	tailnet      string // --tailnet
+	profileName  string
+	nodeRegion   string // --region, resolved
+	skipTestNode bool
+}
+
+func runInit(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, initUsage)
+	}
+
+	tailnet := fs.String("tailnet", os.Getenv(config.EnvTailnet), "Tailnet name")
+	profileName := fs.String("profile-name", "default", "Profile to save the deployment to")
+	region := fs.String("region", "", "Region for the test exit node")
+	skipTestNode := fs.Bool("skip-test-node", false, "Don't offer to start a test exit node")
+	restart := fs.Bool("restart", false, "Forget an earlier run's progress and start over")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+	if *profileName == "" {
+		return fmt.Errorf("--profile-name can't be empty")
+	}
+	if *region != "" {
+		resolved, err := regions.Resolve(*region)
+		if err != nil {
+			return fmt.Errorf("invalid region %s\n\n%v", ui.Highlight(*region), err)
+		}
+		*region = resolved
+	}
+
+	path, err := initstate.Path()
+	if err != nil {
+		return err
+	}
+	if *restart {
+		if err := initstate.Remove(path); err != nil {
+			return err
+		}
+	}
+	progress, err := initstate.Load(path)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	w := &initWizard{
+		ctx:          ctx,
+		cfg:          cfg,
+		progress:     progress,
+		path:         path,
+		tailnet:      *tailnet,
+		profileName:  *profileName,
+		nodeRegion:   *region,
+		skipTestNode: *skipTestNode,
+	}
+	return w.run()
+}
+
+// run goes through the steps, skipping the ones an earlier run finished
+func (w *initWizard) run() error {
+	steps := []initStep{
+		{initstate.StagePrerequisites, "Check prerequisites", w.checkPrerequisites},
+		{initstate.StageTailscale, "Configure Tailscale", w.configureTailscale},
+		{initstate.StageDeploy, "Deploy to AWS", w.deploy},
+		{initstate.StageConfig, "Save configuration", w.saveConfig},
+		{initstate.StageTestNode, "Start a test exit node", w.startTestNode},
+	}
+
+	fmt.Println(ui.Title("TSE init - from nothing to a working exit node"))
+	fmt.Println()
+	if w.progress.Started() {
+		fmt.Printf("%s Resuming the run from %s: %d of %d steps already done (--restart starts over)\n",
+			ui.Info("→"), w.progress.Updated.Local().Format("2006-01-02 15:04"), len(w.progress.Done), len(steps))
+		fmt.Println()
+	}
+
+	for i, step := range steps {
+		header := fmt.Sprintf("Step %d of %d: %s", i+1, len(steps), step.title)
+		if w.progress.IsDone(step.stage) {
+			fmt.Printf("%s %s %s\n", ui.Checkmark(), header, ui.Subtle("(done in an earlier run)"))
+			continue
+		}
+
+		fmt.Println(ui.Bold(header))
+		fmt.Println(ui.Subtle(strings.Repeat("─", len(header))))
+		if err := w.loadSecrets(); err != nil {
+			return err
+		}
+		if err := step.run(); err != nil {
+			if isInterrupted(err) {
+				return err
+			}
+			return fmt.Errorf("step %d (%s) failed: %w\n\nFix the problem and run 'tse init' again to resume from step %d", i+1, step.title, err, i+1)
+		}
+
+		w.progress.Complete(step.stage)
+		if err := w.progress.Save(w.path); err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n\n", ui.Checkmark(), ui.Success(header+" complete"))
+	}
+
+	if err := initstate.Remove(w.path); err != nil {
+		return err
+	}
+
+	fmt.Println(ui.SuccessBox("TSE is ready",
+		"✨ Tailscale, AWS and your config are all set up.",
+		"",
+		fmt.Sprintf("Profile:       %s", w.progress.Profile),
+		fmt.Sprintf("Function URL:  %s", w.progress.LambdaURL),
+		"",
+		"Start a node anywhere: tse <region> start",
+		"Stop them all:         tse shutdown",
+	))
+	return nil
+}
+
+// loadSecrets puts what earlier steps produced back in the environment, where
+// deploy and the Lambda client read it
+func (w *initWizard) loadSecrets() error {
+	for key, sealed := range map[string]string{
+		"TAILSCALE_AUTH_KEY": w.progress.AuthKey,
+		"TSE_AUTH_TOKEN":     w.progress.AuthToken,
+		"TSE_LAMBDA_URL":     w.progress.LambdaURL,
+	} {
+		if sealed == "" {
+			continue
+		}
+		value, err := w.cfg.Open(sealed)
+		if err != nil {
+			return err
+		}
+		os.Setenv(key, value)
+	}
+	return nil
+}
+
+// checkPrerequisites checks the AWS credentials and Tailscale token, and finds
+// out the tailnet
+func (w *initWizard) checkPrerequisites() error {
+	var local localIdentity
+	err := ui.WithSpinner("Checking AWS credentials", func() error {
+		var err error
+		local, err = lookupLocalIdentity(w.ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%w\n\nConfigure AWS credentials (e.g. 'aws configure' or export AWS_PROFILE) for the account to deploy to", err)
+	}
+	fmt.Printf("%s AWS account %s, deploying to %s\n", ui.Checkmark(), ui.Highlight(local.AccountID), ui.Highlight(local.Region))
+	if _, err := regions.GetFriendlyName(local.Region); err != nil {
+		return fmt.Errorf("TSE can't deploy to %s: %w", local.Region, err)
+	}
+	w.progress.Region = local.Region
+
+	if os.Getenv("TAILSCALE_API_TOKEN") == "" {
+		return fmt.Errorf(`TAILSCALE_API_TOKEN environment variable not set
+
+Create an API access token at https://login.tailscale.com/admin/settings/keys
+(you must be an Owner or Admin), then:
+  export TAILSCALE_API_TOKEN=tskey-api-...`)
+	}
+	fmt.Printf("%s TAILSCALE_API_TOKEN is set\n", ui.Checkmark())
+
+	if w.tailnet == "" {
+		if !ui.IsTerminal(os.Stdin) {
+			return fmt.Errorf("no tailnet given; pass --tailnet (e.g. yourname@github or example.com)")
+		}
+		fmt.Printf("%s Your tailnet (e.g. yourname@github or example.com; see 'tailscale status'): ", ui.Info("→"))
+		response, err := readLine(w.ctx, os.Stdin)
+		if err != nil {
+			return err
+		}
+		w.tailnet = strings.TrimSpace(response)
+		if w.tailnet == "" {
+			return fmt.Errorf("no tailnet given")
+		}
+	}
+	w.progress.Tailnet = w.tailnet
+	fmt.Printf("%s Tailnet %s\n", ui.Checkmark(), ui.Highlight(w.tailnet))
+
+	if infrastructure.UsesEmbeddedLambda() {
+		fmt.Printf("%s Prebuilt Lambda included\n", ui.Checkmark())
+	} else {
+		fmt.Printf("%s %s\n", ui.Info("→"), "No prebuilt Lambda in this binary; deploy will compile it, which needs Go")
+	}
+	return nil
+}
+
+// configureTailscale updates the ACL policy and creates the auth key exit
+// nodes join with, like tse setup. A TAILSCALE_AUTH_KEY already in the
+// environment is used instead of creating another.
+func (w *initWizard) configureTailscale() error {
+	apiToken := os.Getenv("TAILSCALE_API_TOKEN")
+	if apiToken == "" {
+		return fmt.Errorf("TAILSCALE_API_TOKEN environment variable not set")
+	}
+	client, err := tailscale.NewClient(apiToken)
+	if err != nil {
+		return fmt.Errorf("failed to create Tailscale client: %w", err)
+	}
+	client.SetTailnet(w.progress.Tailnet)
+
+	owner, err := client.GetCurrentUser(w.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	if err := configureACL(w.ctx, client, owner, nil, nil, false); err != nil {
+		return err
+	}
+	fmt.Println()
+
+	authKey := os.Getenv("TAILSCALE_AUTH_KEY")
+	if authKey != "" {
+		fmt.Printf("%s Using TAILSCALE_AUTH_KEY from the environment\n", ui.Checkmark())
+	} else if authKey, err = createAuthKey(w.ctx, client); err != nil {
+		return err
+	}
+
+	sealed, err := w.cfg.Seal(authKey)
+	if err != nil {
+		return err
+	}
+	w.progress.AuthKey = sealed
+	os.Setenv("TAILSCALE_AUTH_KEY", authKey)
+	return nil
+}
+
+// deploy creates the AWS infrastructure and checks it works end to end
+func (w *initWizard) deploy() error {
+	result, err := infrastructure.Setup(w.ctx, w.progress.Region)
+	if err != nil {
+		return err
+	}
+	if result.State.FunctionURL == "" {
+		return fmt.Errorf("deployment has no function URL; run 'tse status' to see what's missing")
+	}
+	if result.AuthToken == "" {
+		return fmt.Errorf(`TSE is already deployed in %s, but TSE_AUTH_TOKEN isn't set
+
+Set TSE_AUTH_TOKEN to the deployment's token and run 'tse init' again, or
+remove the deployment with 'tse teardown' so init can create a new one`, w.progress.Region)
+	}
+
+	if err := verifyDeployment(w.ctx, result.State.FunctionURL, result.AuthToken, w.progress.Region); err != nil {
+		return err
+	}
+
+	sealed, err := w.cfg.Seal(result.AuthToken)
+	if err != nil {
+		return err
+	}
+	w.progress.LambdaURL = result.State.FunctionURL
+	w.progress.AuthToken = sealed
+	os.Setenv("TSE_LAMBDA_URL", result.State.FunctionURL)
+	os.Setenv("TSE_AUTH_TOKEN", result.AuthToken)
+
+	if result.WasGenerated {
+		fmt.Println(ui.Subtle("A new TSE_AUTH_TOKEN was generated; the next step saves it to your profile."))
+	}
+	return nil
+}
+
+// saveConfig saves the deployment to a profile, so every later tse command
+// finds it without environment variables
+func (w *initWizard) saveConfig() error {
+	profile, exists := w.cfg.Profiles[w.profileName]
+	if !exists {
+		profile = &config.Profile{}
+		w.cfg.Profiles[w.profileName] = profile
+	}
+	profile.LambdaURL = w.progress.LambdaURL
+	profile.AuthToken = w.progress.AuthToken // Already sealed
+	profile.Tailnet = w.progress.Tailnet
+	if awsProfile := os.Getenv("AWS_PROFILE"); awsProfile != "" {
+		profile.AWSProfile = awsProfile
+	}
+	if infrastructure.CustomNamePrefix() {
+		profile.NamePrefix = infrastructure.NamePrefix()
+	}
+	if w.cfg.DefaultProfile == "" {
+		w.cfg.DefaultProfile = w.profileName
+	}
+	if err := w.cfg.Save(); err != nil {
+		return err
+	}
+
+	path, err := config.Path()
+	if err != nil {
+		return err
+	}
+	verb := "Updated"
+	if !exists {
+		verb = "Created"
+	}
+	fmt.Printf("%s %s profile %s in %s\n", ui.Checkmark(), verb, ui.Highlight(w.profileName), path)
+	if w.cfg.DefaultProfile != w.profileName {
+		fmt.Println(ui.Subtle(fmt.Sprintf("Use it with 'tse --profile %s ...', or make it the default with 'tse profile use %s'", w.profileName, w.profileName)))
+	}
+	w.progress.Profile = w.profileName
+	return nil
+}
+
+// startTestNode offers to start an exit node, the first real use of the
+// deployment
+func (w *initWizard) startTestNode() error {
+	if w.skipTestNode {
+		fmt.Println(ui.Subtle("Skipped (--skip-test-node)"))
+		return nil
+	}
+
+	region := w.nodeRegion
+	if region == "" {
+		friendly, err := regions.GetFriendlyName(w.progress.Region)
+		if err != nil {
+			return err
+		}
+		region = friendly
+	}
+
+	if ui.IsTerminal(os.Stdin) {
+		fmt.Printf("%s Start a test exit node in %s now? It's billed by the second until you stop it. [Y/n]: ", ui.Info("→"), ui.Highlight(region))
+		response, err := readLine(w.ctx, os.Stdin)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(strings.TrimSpace(response)) {
+		case "", "y", "yes":
+		default:
+			fmt.Printf("Skipped; start one any time with 'tse %s start'\n", region)
+			return nil
+		}
+	}
+
+	lambdaURL := strings.TrimSuffix(os.Getenv("TSE_LAMBDA_URL"), "/")
+	if err := handleStart(w.ctx, lambdaURL, region, startOptions{}); err != nil {
+		return err
+	}
+	fmt.Println()
+	fmt.Printf("%s Select %s as your exit node in Tailscale once it's ready, and stop it with 'tse %s stop'\n", ui.Info("→"), ui.Highlight("exit-"+region), region)
+	return nil
+}
@@ -0,0 +1,117 @@
+// Package initstate records how far `tse init` got, so a run that fails (or is
+// interrupted) resumes at the step that didn't finish instead of starting over.
+//
+// Progress is one JSON file in the user's state directory, removed once init
+// completes. Secrets in it are sealed with the config file's encryption, if it
+// has any, by the caller.
+package initstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Stage is a checkpoint in the init wizard
+type Stage string
+
+const (
+	StagePrerequisites Stage = "prerequisites"
+	StageTailscale     Stage = "tailscale"
+	StageDeploy        Stage = "deploy"
+	StageConfig        Stage = "config"
+	StageTestNode      Stage = "test-node"
+)
+
+// Stages are the wizard's checkpoints, in the order it runs them
+var Stages = []Stage{StagePrerequisites, StageTailscale, StageDeploy, StageConfig, StageTestNode}
+
+// Progress is what init has done so far, and what later steps need from the
+// earlier ones
+type Progress struct {
+	Done    []Stage   `json:"done"`
+	Updated time.Time `json:"updated"`
+
+	Tailnet   string `json:"tailnet,omitempty"`
+	Region    string `json:"region,omitempty"`     // AWS region the Lambda deploys to
+	AuthKey   string `json:"auth_key,omitempty"`   // TAILSCALE_AUTH_KEY, sealed
+	LambdaURL string `json:"lambda_url,omitempty"` // Function URL
+	AuthToken string `json:"auth_token,omitempty"` // TSE_AUTH_TOKEN, sealed
+	Profile   string `json:"profile,omitempty"`    // Profile the URL and token were saved to
+}
+
+// Path returns the progress file: $XDG_STATE_HOME/tse/init.json, then
+// ~/.local/state/tse/init.json
+func Path() (string, error) {
+	if state := os.Getenv("XDG_STATE_HOME"); state != "" {
+		return filepath.Join(state, "tse", "init.json"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "tse", "init.json"), nil
+}
+
+// Load reads the progress file. A missing file is a fresh start.
+func Load(path string) (*Progress, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Progress{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read init progress: %w", err)
+	}
+
+	var p Progress
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse init progress %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Save writes the progress file, owner-only as it can hold secrets
+func (p *Progress) Save(path string) error {
+	p.Updated = time.Now()
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode init progress: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write init progress: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the progress file, if there is one
+func Remove(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove init progress: %w", err)
+	}
+	return nil
+}
+
+// IsDone reports whether a stage finished in this or an earlier run
+func (p *Progress) IsDone(stage Stage) bool {
+	return slices.Contains(p.Done, stage)
+}
+
+// Complete marks a stage finished
+func (p *Progress) Complete(stage Stage) {
+	if !p.IsDone(stage) {
+		p.Done = append(p.Done, stage)
+	}
+}
+
+// Started reports whether an earlier run finished any stage
+func (p *Progress) Started() bool {
+	return len(p.Done) > 0
+}
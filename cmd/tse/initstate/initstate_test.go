@@ -0,0 +1,63 @@
+package initstate
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/tmp/state")
+	if path, err := Path(); err != nil || path != "/tmp/state/tse/init.json" {
+		t.Errorf("Path() = %q, %v", path, err)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tse", "init.json")
+
+	p, err := Load(path)
+	if err != nil || p.Started() {
+		t.Fatalf("Load() of a missing file = %+v, %v; want a fresh start", p, err)
+	}
+
+	p.Tailnet = "example.com"
+	p.Complete(StagePrerequisites)
+	p.Complete(StageTailscale)
+	p.Complete(StageTailscale)
+	if err := p.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("progress file mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !slices.Equal(loaded.Done, []Stage{StagePrerequisites, StageTailscale}) || loaded.Tailnet != "example.com" || loaded.Updated.IsZero() {
+		t.Errorf("Load() = %+v", loaded)
+	}
+	if !loaded.IsDone(StageTailscale) || loaded.IsDone(StageDeploy) {
+		t.Errorf("IsDone() wrong for %v", loaded.Done)
+	}
+
+	if err := Remove(path); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := Remove(path); err != nil {
+		t.Errorf("Remove() of a missing file error = %v", err)
+	}
+}
+
+func TestLoadCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "init.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load() of a corrupt file succeeded")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+)
+
+// interruptedError marks a command stopped by Ctrl+C or SIGTERM, so
+// exitWithError can say what it may have left behind
+type interruptedError struct {
+	command string
+	region  string
+	err     error
+}
+
+func (e *interruptedError) Error() string { return e.err.Error() }
+func (e *interruptedError) Unwrap() error { return e.err }
+
+// isInterrupted reports whether err comes from the user cancelling the command
+func isInterrupted(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, ui.ErrInterrupted)
+}
+
+// interruptNote tells the user what state an interrupted command may have left
+// and how to recover. Read-only commands have nothing to say.
+func interruptNote(command, region string) string {
+	switch command {
+	case "deploy":
+		return "Deploy may have created some resources. It's safe to re-run: 'tse deploy' is idempotent and picks up where it stopped."
+	case "teardown":
+		return "Some resources may remain. Run 'tse teardown' again to finish; it only deletes what's still there."
+	case "nuke":
+		return "Some of it may remain. Run 'tse nuke' again to finish; every step skips what's already gone."
+	case "init":
+		return "Run 'tse init' again to pick up at the step that was interrupted."
+	case "setup":
+		return "Tailscale may be partly configured. It's safe to re-run 'tse setup'."
+	case "adopt":
+		return "Some resources may already be tagged. It's safe to re-run 'tse adopt'."
+	case "start":
+		return fmt.Sprintf("The Lambda may still be launching the exit node. Check with 'tse %s instances' before starting again.", region)
+	case "stop":
+		return fmt.Sprintf("The Lambda may still be stopping nodes. Check with 'tse %s instances'; re-running stop is safe.", region)
+	case "restart":
+		return fmt.Sprintf("The Lambda may still be replacing the node. Check with 'tse %s instances' before restarting again.", region)
+	case "pause", "resume":
+		return fmt.Sprintf("The Lambda may still be changing the node's state. Check with 'tse %s instances'.", region)
+	case "shutdown":
+		return "Some regions may not have been stopped. Check with 'tse instances'; re-running shutdown is safe."
+	case "cleanup":
+		return "Cleanup may be partly done. It's safe to re-run."
+	case "reserve":
+		return fmt.Sprintf("The reservation change may still have gone through. Check with 'tse %s reserve'.", region)
+	case "network":
+		return fmt.Sprintf("The networking change may still have gone through. Check with 'tse %s network'.", region)
+	}
+	return ""
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/anoldguy/tse/shared/regions"
+)
+
+const (
+	// probeTimeout bounds one connection to a region's endpoint
+	probeTimeout = 2 * time.Second
+
+	// probeAttempts is how many connections are timed per region; the fastest
+	// counts, so one slow handshake doesn't skew the result
+	probeAttempts = 3
+)
+
+// regionLatency is the measured round trip to one region
+type regionLatency struct {
+	Region string
+	RTT    time.Duration
+	Err    error
+}
+
+// regionEndpoint is the host:port probed for a region: its EC2 API endpoint,
+// which is in the same place as the exit node would be
+func regionEndpoint(awsRegion string) string {
+	return fmt.Sprintf("ec2.%s.amazonaws.com:443", awsRegion)
+}
+
+// probeLatency times TCP connects to a region's endpoint and returns the fastest.
+// The address is looked up first so DNS isn't part of the measurement.
+func probeLatency(ctx context.Context, region string) (time.Duration, error) {
+	awsRegion, err := regions.GetAWSRegion(region)
+	if err != nil {
+		return 0, err
+	}
+	host, port, _ := net.SplitHostPort(regionEndpoint(awsRegion))
+
+	lookupCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	addrs, err := net.DefaultResolver.LookupHost(lookupCtx, host)
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+
+	dialer := net.Dialer{Timeout: probeTimeout}
+	var best time.Duration
+	var lastErr error
+	for range probeAttempts {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(addrs[0], port))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		rtt := time.Since(start)
+		conn.Close()
+		if best == 0 || rtt < best {
+			best = rtt
+		}
+	}
+	if best == 0 {
+		return 0, lastErr
+	}
+	return best, nil
+}
+
+// probeLatencies probes regions concurrently and returns them fastest first,
+// with failed probes last
+func probeLatencies(ctx context.Context, names []string) []regionLatency {
+	results := make([]regionLatency, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rtt, err := probeLatency(ctx, name)
+			results[i] = regionLatency{Region: name, RTT: rtt, Err: err}
+		}()
+	}
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if (results[i].Err == nil) != (results[j].Err == nil) {
+			return results[i].Err == nil
+		}
+		return results[i].RTT < results[j].RTT
+	})
+	return results
+}
+
+// describeProbeError shortens a failed probe for a table cell
+func describeProbeError(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return "DNS lookup failed"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timed out"
+	}
+	return firstLine(err.Error())
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const linkUsage = `Usage: tse link <start|stop> <region|all> [--ttl <duration>]
+
+Create a signed link that starts or stops exit nodes without a bearer token
+
+Anyone with the link can run its one action until it expires, so it's safe to
+keep in a phone shortcut in a way TSE_AUTH_TOKEN isn't. Opening it in a browser
+asks for confirmation; a POST (e.g. an iOS Shortcut's "Get Contents of URL" with
+Method set to POST) runs it straight away. Creating a link needs the scope of
+its action. Rotating TSE_AUTH_TOKEN, or revoking the token that created it,
+disables the link.
+
+Flags:
+  --ttl <duration>   How long the link works (default 24h, at most 2160h)
+
+Examples:
+  tse link stop all --ttl 720h    # "Stop everything" for a month
+  tse link start ohio
+`
+
+func runLink(ctx context.Context, lambdaURL string, args []string) error {
+	if len(args) < 2 || args[0] == "" || args[0][0] == '-' || args[1][0] == '-' {
+		fmt.Fprint(os.Stderr, linkUsage)
+		return fmt.Errorf("usage: tse link <start|stop> <region|all>")
+	}
+	action, region := args[0], args[1]
+
+	fs := flag.NewFlagSet("link", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, linkUsage)
+	}
+	ttl := fs.Duration("ttl", 24*time.Hour, "How long the link works")
+	if err := fs.Parse(args[2:]); err != nil {
+		return err
+	}
+	if action != types.LinkActionStart && action != types.LinkActionStop {
+		return fmt.Errorf("unknown link action %s (valid: start, stop)", ui.Highlight(action))
+	}
+
+	var linkResp types.CreateLinkResponse
+	err := ui.WithSpinner(fmt.Sprintf("Creating %s link for %s", action, region), func() error {
+		req := types.CreateLinkRequest{Action: action, Region: region, TTL: ttl.String()}
+		return apiRequest(ctx, "POST", lambdaURL+"/links", req, http.StatusCreated, "create link", &linkResp)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(ui.HighlightBox("🔗 Anyone With This Link Can Use It",
+		linkResp.URL,
+		"",
+		fmt.Sprintf("Expires: %s", linkResp.ExpiresAt.Local().Format("2006-01-02 15:04")),
+	))
+	fmt.Println(ui.Subtle("Rotating TSE_AUTH_TOKEN disables every link"))
+
+	return nil
+}
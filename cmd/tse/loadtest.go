@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
+)
+
+const loadtestUsage = `Usage: tse loadtest [flags]
+
+Fire concurrent requests at the Lambda and report latency percentiles and error
+rates (developer tool)
+
+Point it at a dev deployment, not the one you rely on: the Lambda rate-limits
+per source IP (bursts of one request per region plus 10, then 2 requests/second
+per warm instance), so a big run gets 429s, and every start dry run is written
+to the audit log.
+
+Flags:
+  --url string          Endpoint to test (default: TSE_LAMBDA_URL)
+  --requests int        Total requests to send (default 100)
+  --concurrency int     Requests in flight at once (default 10)
+  --mix string          Comma-separated endpoints, sent round-robin (default "health"):
+                          health         GET /
+                          instances      GET /<region>/instances
+                          start-dry-run  POST /<region>/start, checks only, launches nothing
+  --region string       Region for instances and start-dry-run (default "ohio")
+
+Examples:
+  tse loadtest
+  tse loadtest --requests 500 --concurrency 50
+  tse loadtest --mix health,instances,start-dry-run --region tokyo
+  tse loadtest --url http://localhost:8080
+`
+
+// Load test endpoints
+const (
+	loadtestHealth      = "health"
+	loadtestInstances   = "instances"
+	loadtestStartDryRun = "start-dry-run"
+)
+
+var loadtestEndpoints = []string{loadtestHealth, loadtestInstances, loadtestStartDryRun}
+
+// loadtestSample is the outcome of one request
+type loadtestSample struct {
+	Endpoint string
+	Latency  time.Duration
+	Status   int   // 0 if no response came back
+	Err      error // Transport error, if any
+}
+
+// Failed reports whether the request errored or got an error status
+func (s loadtestSample) Failed() bool {
+	return s.Err != nil || s.Status >= 400
+}
+
+func runLoadTest(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, loadtestUsage)
+	}
+
+	target := fs.String("url", os.Getenv("TSE_LAMBDA_URL"), "Endpoint to test")
+	requests := fs.Int("requests", 100, "Total requests to send")
+	concurrency := fs.Int("concurrency", 10, "Requests in flight at once")
+	mixList := fs.String("mix", loadtestHealth, "Comma-separated endpoints")
+	regionName := fs.String("region", "ohio", "Region for instances and start-dry-run")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+
+	if *requests <= 0 || *concurrency <= 0 {
+		return fmt.Errorf("--requests and --concurrency must be positive")
+	}
+	mix, err := parseLoadtestMix(*mixList)
+	if err != nil {
+		return err
+	}
+	region, err := regions.Resolve(*regionName)
+	if err != nil {
+		return fmt.Errorf("invalid region %s\n%v", ui.Highlight(*regionName), err)
+	}
+	baseURL := strings.TrimSuffix(*target, "/")
+	if baseURL == "" {
+		return fmt.Errorf("no endpoint to test: set TSE_LAMBDA_URL or pass --url")
+	}
+
+	var samples []loadtestSample
+	var elapsed time.Duration
+	message := fmt.Sprintf("Sending %d requests (%d concurrent) to %s", *requests, *concurrency, baseURL)
+	err = ui.WithSpinner(message, func() error {
+		start := time.Now()
+		samples = runLoadtestRequests(ctx, baseURL, region, mix, *requests, *concurrency)
+		elapsed = time.Since(start)
+		return ctx.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	printLoadtestReport(samples, mix, elapsed)
+	return nil
+}
+
+// parseLoadtestMix parses the comma-separated --mix list
+func parseLoadtestMix(list string) ([]string, error) {
+	var mix []string
+	for _, endpoint := range strings.Split(list, ",") {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint == "" {
+			continue
+		}
+		if !slices.Contains(loadtestEndpoints, endpoint) {
+			return nil, fmt.Errorf("unknown endpoint %s (valid: %s)", ui.Highlight(endpoint), strings.Join(loadtestEndpoints, ", "))
+		}
+		mix = append(mix, endpoint)
+	}
+	if len(mix) == 0 {
+		return nil, fmt.Errorf("--mix needs at least one endpoint (valid: %s)", strings.Join(loadtestEndpoints, ", "))
+	}
+	return mix, nil
+}
+
+// runLoadtestRequests sends total requests, cycling through mix, with at most
+// concurrency in flight. Requests not yet sent when ctx is cancelled are dropped.
+func runLoadtestRequests(ctx context.Context, baseURL, region string, mix []string, total, concurrency int) []loadtestSample {
+	jobs := make(chan string)
+	results := make(chan loadtestSample)
+
+	var wg sync.WaitGroup
+	for range min(concurrency, total) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for endpoint := range jobs {
+				results <- sendLoadtestRequest(ctx, baseURL, region, endpoint)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := range total {
+			select {
+			case jobs <- mix[i%len(mix)]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	samples := make([]loadtestSample, 0, total)
+	for sample := range results {
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// sendLoadtestRequest times one request, reading the whole body so the latency
+// covers what a real client waits for
+func sendLoadtestRequest(ctx context.Context, baseURL, region, endpoint string) loadtestSample {
+	method, url := "GET", baseURL+"/"
+	var payload []byte
+	switch endpoint {
+	case loadtestInstances:
+		url = fmt.Sprintf("%s/%s/instances", baseURL, region)
+	case loadtestStartDryRun:
+		method, url, payload = "POST", fmt.Sprintf("%s/%s/start", baseURL, region), []byte(`{"dry_run":true}`)
+	}
+
+	// One attempt each: retries would hide the errors being measured
+	start := time.Now()
+	resp, err := sendAuthenticatedRequest(ctx, method, url, payload)
+	if err != nil {
+		return loadtestSample{Endpoint: endpoint, Latency: time.Since(start), Err: err}
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(io.Discard, resp.Body)
+	return loadtestSample{Endpoint: endpoint, Latency: time.Since(start), Status: resp.StatusCode, Err: err}
+}
+
+// percentile returns the nearest-rank pth percentile (0-100) of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(float64(len(sorted))*p/100)) - 1
+	return sorted[max(0, min(rank, len(sorted)-1))]
+}
+
+func printLoadtestReport(samples []loadtestSample, mix []string, elapsed time.Duration) {
+	if len(samples) == 0 {
+		fmt.Println(ui.Subtle("No requests completed."))
+		return
+	}
+
+	table := ui.NewTable("Endpoint", "Requests", "Errors", "p50", "p90", "p99", "Max")
+	addRow := func(name string, subset []loadtestSample) {
+		var latencies []time.Duration
+		failed := 0
+		for _, sample := range subset {
+			latencies = append(latencies, sample.Latency)
+			if sample.Failed() {
+				failed++
+			}
+		}
+		slices.Sort(latencies)
+
+		errorCell := fmt.Sprintf("%d (%.1f%%)", failed, 100*float64(failed)/float64(len(subset)))
+		if failed > 0 {
+			errorCell = ui.Error(errorCell)
+		}
+		table.AddRow(name, fmt.Sprint(len(subset)), errorCell,
+			formatLatency(percentile(latencies, 50)),
+			formatLatency(percentile(latencies, 90)),
+			formatLatency(percentile(latencies, 99)),
+			formatLatency(latencies[len(latencies)-1]))
+	}
+
+	var seen []string
+	for _, endpoint := range mix {
+		if slices.Contains(seen, endpoint) {
+			continue
+		}
+		seen = append(seen, endpoint)
+
+		var subset []loadtestSample
+		for _, sample := range samples {
+			if sample.Endpoint == endpoint {
+				subset = append(subset, sample)
+			}
+		}
+		if len(subset) > 0 {
+			addRow(endpoint, subset)
+		}
+	}
+	if len(seen) > 1 {
+		addRow(ui.Bold("all"), samples)
+	}
+	fmt.Println(table.Render())
+
+	statuses := map[string]int{}
+	var firstErr error
+	for _, sample := range samples {
+		switch {
+		case sample.Status != 0:
+			statuses[fmt.Sprint(sample.Status)]++
+		default:
+			statuses["network error"]++
+			if firstErr == nil {
+				firstErr = sample.Err
+			}
+		}
+	}
+	var counts []string
+	for status, count := range statuses {
+		counts = append(counts, fmt.Sprintf("%s×%d", status, count))
+	}
+	slices.Sort(counts)
+
+	fmt.Printf("%s %s\n", ui.Label("Status codes:"), strings.Join(counts, ", "))
+	fmt.Printf("%s   %.1f req/s over %s\n", ui.Label("Throughput:"), float64(len(samples))/elapsed.Seconds(), elapsed.Round(time.Millisecond))
+
+	if statuses["429"] > 0 {
+		fmt.Println()
+		fmt.Println(ui.Warning("⚠️  Rate limited: the Lambda allows bursts of one request per region plus 10, then 2 requests/second per source IP"))
+		fmt.Println(ui.Subtle("   Lower --concurrency or --requests to measure latency without hitting the limiter."))
+	}
+	if firstErr != nil {
+		fmt.Println()
+		fmt.Println(ui.Warning(fmt.Sprintf("⚠️  First network error: %s", firstLine(firstErr.Error()))))
+	}
+}
+
+// formatLatency rounds a latency for display
+func formatLatency(d time.Duration) string {
+	if d < 10*time.Millisecond {
+		return d.Round(100 * time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
@@ -0,0 +1,143 @@
+// Package localstatus reads this device's Tailscale state through the
+// tailscale CLI (`tailscale status --json`) and changes its exit node. It only
+// decodes the handful of fields tse needs.
+package localstatus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// macOSApp is the CLI inside the Mac App Store and standalone apps, used when
+// tailscale isn't on PATH
+const macOSApp = "/Applications/Tailscale.app/Contents/MacOS/Tailscale"
+
+// BackendRunning is Status.BackendState when the device is connected
+const BackendRunning = "Running"
+
+// Status is the part of `tailscale status --json` tse reads
+type Status struct {
+	BackendState   string
+	Self           *Peer
+	Peer           map[string]*Peer // Keyed by node public key
+	ExitNodeStatus *ExitNodeStatus  // Set when an exit node is selected and in the netmap
+}
+
+// Peer is a device in the tailnet
+type Peer struct {
+	ID             string // Stable node ID
+	HostName       string // The name the device reported, e.g. exit-ohio
+	DNSName        string // MagicDNS name, which may carry a -1 suffix when HostName is taken
+	TailscaleIPs   []string
+	Online         bool
+	ExitNode       bool // This device uses the peer as its exit node
+	ExitNodeOption bool // The peer offers to be an exit node
+}
+
+// ExitNodeStatus describes the selected exit node
+type ExitNodeStatus struct {
+	ID           string
+	Online       bool
+	TailscaleIPs []string // Prefixes, e.g. 100.64.0.1/32
+}
+
+// Parse decodes `tailscale status --json` output
+func Parse(data []byte) (*Status, error) {
+	var status Status
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("failed to parse tailscale status: %w", err)
+	}
+	return &status, nil
+}
+
+// ExitNode returns the selected exit node, or nil when there is none or it
+// isn't in the netmap
+func (s *Status) ExitNode() *Peer {
+	if s.ExitNodeStatus == nil {
+		return nil
+	}
+	for _, peer := range s.Peer {
+		if peer.ID == s.ExitNodeStatus.ID {
+			return peer
+		}
+	}
+	return nil
+}
+
+// PeersNamed returns the peers that reported hostname, in no particular order
+func (s *Status) PeersNamed(hostname string) []*Peer {
+	var peers []*Peer
+	for _, peer := range s.Peer {
+		if strings.EqualFold(peer.HostName, hostname) {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// IPv4 returns the peer's IPv4 tailnet address, or "" if it has none
+func (p *Peer) IPv4() string {
+	for _, ip := range p.TailscaleIPs {
+		if !strings.Contains(ip, ":") {
+			return ip
+		}
+	}
+	return ""
+}
+
+// CLI runs the tailscale command line client
+type CLI struct {
+	Path string
+}
+
+// FindCLI locates the tailscale CLI: path if given, then PATH, then the macOS app
+func FindCLI(path string) (*CLI, error) {
+	if path != "" {
+		return &CLI{Path: path}, nil
+	}
+	if found, err := exec.LookPath("tailscale"); err == nil {
+		return &CLI{Path: found}, nil
+	}
+	if runtime.GOOS == "darwin" {
+		if _, err := exec.LookPath(macOSApp); err == nil {
+			return &CLI{Path: macOSApp}, nil
+		}
+	}
+	return nil, errors.New("tailscale CLI not found; install Tailscale or pass its path with --tailscale")
+}
+
+// Status reads the device's current status
+func (c *CLI) Status(ctx context.Context) (*Status, error) {
+	output, err := c.run(ctx, "status", "--json")
+	if err != nil {
+		return nil, err
+	}
+	return Parse(output)
+}
+
+// SetExitNode routes this device through the exit node at ip
+func (c *CLI) SetExitNode(ctx context.Context, ip string) error {
+	_, err := c.run(ctx, "set", "--exit-node="+ip)
+	return err
+}
+
+// run runs a tailscale subcommand, returning stdout. Failures include the
+// CLI's own message, which says e.g. when an operator is needed.
+func (c *CLI) run(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, c.Path, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			return nil, fmt.Errorf("tailscale %s failed: %s", args[0], detail)
+		}
+		return nil, fmt.Errorf("tailscale %s failed: %w", args[0], err)
+	}
+	return output, nil
+}
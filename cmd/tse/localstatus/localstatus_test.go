@@ -0,0 +1,118 @@
+package localstatus
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// statusJSON is trimmed `tailscale status --json` output with the old
+// exit-frankfurt selected but offline, and a new one up
+const statusJSON = `{
+  "Version": "1.76.1",
+  "BackendState": "Running",
+  "Self": {"ID": "nSelf", "HostName": "laptop", "TailscaleIPs": ["100.64.0.1", "fd7a:115c:a1e0::1"], "Online": true},
+  "Peer": {
+    "nodekey:aaa": {"ID": "nOld", "HostName": "exit-frankfurt", "DNSName": "exit-frankfurt.tail1234.ts.net.",
+      "TailscaleIPs": ["100.64.0.2", "fd7a:115c:a1e0::2"], "Online": false, "ExitNode": true, "ExitNodeOption": true},
+    "nodekey:bbb": {"ID": "nNew", "HostName": "exit-frankfurt", "DNSName": "exit-frankfurt-1.tail1234.ts.net.",
+      "TailscaleIPs": ["fd7a:115c:a1e0::3", "100.64.0.3"], "Online": true, "ExitNodeOption": true},
+    "nodekey:ccc": {"ID": "nPhone", "HostName": "phone", "TailscaleIPs": ["100.64.0.4"], "Online": true}
+  },
+  "ExitNodeStatus": {"ID": "nOld", "Online": false, "TailscaleIPs": ["100.64.0.2/32"]}
+}`
+
+func TestParse(t *testing.T) {
+	status, err := Parse([]byte(statusJSON))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if status.BackendState != BackendRunning || status.Self.HostName != "laptop" || len(status.Peer) != 3 {
+		t.Errorf("Parse() = %+v", status)
+	}
+
+	exitNode := status.ExitNode()
+	if exitNode == nil || exitNode.ID != "nOld" || exitNode.Online {
+		t.Fatalf("ExitNode() = %+v, want the offline nOld", exitNode)
+	}
+
+	peers := status.PeersNamed("EXIT-frankfurt")
+	if len(peers) != 2 {
+		t.Errorf("PeersNamed() found %d peers, want 2", len(peers))
+	}
+	for _, peer := range peers {
+		if peer.ID == "nNew" && peer.IPv4() != "100.64.0.3" {
+			t.Errorf("IPv4() = %q, want 100.64.0.3", peer.IPv4())
+		}
+	}
+
+	if _, err := Parse([]byte("not json")); err == nil {
+		t.Error("Parse() accepted bad input")
+	}
+}
+
+func TestExitNodeUnselected(t *testing.T) {
+	status, _ := Parse([]byte(`{"BackendState": "Running", "Peer": {"k": {"ID": "n1", "HostName": "exit-ohio"}}}`))
+	if exitNode := status.ExitNode(); exitNode != nil {
+		t.Errorf("ExitNode() = %+v, want nil with nothing selected", exitNode)
+	}
+
+	// Selected, but the node has already left the netmap
+	status.ExitNodeStatus = &ExitNodeStatus{ID: "gone"}
+	if exitNode := status.ExitNode(); exitNode != nil {
+		t.Errorf("ExitNode() = %+v, want nil for a node not in the netmap", exitNode)
+	}
+}
+
+// fakeCLI writes a shell script standing in for the tailscale CLI
+func fakeCLI(t *testing.T, script string) *CLI {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	path := filepath.Join(t.TempDir(), "tailscale")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cli, err := FindCLI(path)
+	if err != nil {
+		t.Fatalf("FindCLI() error = %v", err)
+	}
+	return cli
+}
+
+func TestCLI(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	cli := fakeCLI(t, `echo "$@" > `+argsFile+`
+if [ "$1" = status ]; then cat <<'EOF'
+`+statusJSON+`
+EOF
+fi
+`)
+
+	status, err := cli.Status(context.Background())
+	if err != nil || status.ExitNodeStatus == nil {
+		t.Fatalf("Status() = %+v, %v", status, err)
+	}
+
+	if err := cli.SetExitNode(context.Background(), "100.64.0.3"); err != nil {
+		t.Fatalf("SetExitNode() error = %v", err)
+	}
+	args, _ := os.ReadFile(argsFile)
+	if got := strings.TrimSpace(string(args)); got != "set --exit-node=100.64.0.3" {
+		t.Errorf("SetExitNode() ran tailscale %s", got)
+	}
+}
+
+func TestCLIFailure(t *testing.T) {
+	cli := fakeCLI(t, `echo "Access denied: prefs write access denied" >&2; exit 1`)
+
+	err := cli.SetExitNode(context.Background(), "100.64.0.3")
+	if err == nil || !strings.Contains(err.Error(), "tailscale set failed: Access denied") {
+		t.Errorf("SetExitNode() error = %v, want the CLI's message", err)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/infrastructure"
+	"github.com/anoldguy/tse/cmd/tse/ui"
+)
+
+const logsUsage = `Usage: tse logs <command> [flags]
+
+Work with the Lambda's CloudWatch logs
+
+Commands:
+  export    Download logs to a compressed file for offline review
+
+Run 'tse logs export --help' for export flags.
+`
+
+const logsExportUsage = `Usage: tse logs export [flags]
+
+Export the Lambda's CloudWatch logs to a gzipped JSON Lines file
+
+Each line is one log event with its time, log stream and message. Audit
+entries, metrics and other JSON lines are also parsed into a "data" field,
+so the export can be searched with zcat and jq or attached to a bug report.
+
+Requests are paced to stay under CloudWatch Logs' rate limits, and progress
+is checkpointed after every page. If an export is interrupted, run the same
+command again to resume where it stopped.
+
+Flags:
+  --since <duration>   How far back to export, e.g. 7d, 36h (default: 7d)
+  --out <file>         Output file (default: tse-logs.json.gz)
+
+Examples:
+  tse logs export
+  tse logs export --since 30d --out incident.json.gz
+  zcat tse-logs.json.gz | jq 'select(.kind == "audit") | .data'
+`
+
+func runLogs(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, logsUsage)
+		return fmt.Errorf("logs command required")
+	}
+
+	switch args[0] {
+	case "export":
+		return runLogsExport(ctx, args[1:])
+	default:
+		fmt.Fprint(os.Stderr, logsUsage)
+		return fmt.Errorf("unknown logs command %s", ui.Highlight(args[0]))
+	}
+}
+
+func runLogsExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("logs export", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, logsExportUsage)
+	}
+
+	sinceFlag := fs.String("since", "7d", "How far back to export")
+	out := fs.String("out", "tse-logs.json.gz", "Output file")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+
+	since, err := parseSince(*sinceFlag)
+	if err != nil {
+		return err
+	}
+
+	region, err := infrastructure.GetDefaultRegion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to determine AWS region: %w", err)
+	}
+
+	clients, err := infrastructure.NewAWSClients(ctx, region)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	opts := infrastructure.LogExportOptions{
+		LogGroup: infrastructure.LogGroupName,
+		Since:    now.Add(-since),
+		Until:    now,
+		Out:      *out,
+	}
+
+	if _, err := os.Stat(infrastructure.CheckpointPath(*out)); err == nil {
+		fmt.Printf("%s Resuming the interrupted export to %s\n", ui.Info("→"), ui.Highlight(*out))
+	}
+
+	var result *infrastructure.LogExportResult
+	err = ui.WithSpinner(fmt.Sprintf("Exporting %s from %s", infrastructure.LogGroupName, region), func() error {
+		var err error
+		result, err = infrastructure.ExportLogs(ctx, clients, opts)
+		return err
+	})
+	if err != nil {
+		if isInterrupted(err) {
+			fmt.Printf("%s Progress saved; run the same command again to resume\n", ui.Info("→"))
+			return err
+		}
+		if result != nil && result.Events > 0 {
+			return fmt.Errorf("%w\n\n%d events were saved to %s; run the same command again to resume", err, result.Events, *out)
+		}
+		return err
+	}
+
+	fmt.Println()
+	if result.Events == 0 {
+		fmt.Println(ui.Subtle(fmt.Sprintf("No log events in the last %s", *sinceFlag)))
+		return nil
+	}
+	fmt.Printf("%s Exported %d events (%s) to %s\n", ui.Checkmark(), result.Events, formatBytes(result.Bytes), ui.Highlight(*out))
+	return nil
+}
+
+// parseSince parses a lookback like 7d or 36h. Days aren't a Go duration unit
+// but are the natural way to ask for a week of logs.
+func parseSince(s string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid --since %s (use e.g. 7d or 36h)", ui.Highlight(s))
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		d, err = time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid --since %s (use e.g. 7d or 36h)", ui.Highlight(s))
+		}
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("--since must be positive")
+	}
+	return d, nil
+}
+
+// formatBytes renders a size as B, KB, MB or GB
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -1,17 +1,29 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/anoldguy/tse/cmd/tse/config"
+	"github.com/anoldguy/tse/cmd/tse/deprecation"
+	"github.com/anoldguy/tse/cmd/tse/infrastructure"
 	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/cmd/tse/usage"
+	"github.com/anoldguy/tse/pkg/client"
+	"github.com/anoldguy/tse/shared/dns"
 	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/routes"
 	"github.com/anoldguy/tse/shared/types"
 )
 
@@ -20,99 +32,363 @@ const Version = "1.0.0"
 const Usage = `Tailscale Ephemeral Exit Node Service CLI
 
 Usage:
+  tse [--profile <name>] [--json-lines] [--no-ui] <command>
+
   tse version                   - Show version information
+  tse profile list|use|set      - Manage named profiles (tailnets / AWS accounts)
+  tse config encrypt            - Encrypt auth tokens in the config file
+  tse stats                     - Summarize your local usage history
+  tse history [--days 7]        - When you used which exit nodes, by day, with cost
+  tse init [flags]              - Guided first-time setup: Tailscale, deploy, config,
+                                  a test node (resumes where a failed run stopped)
   tse setup [flags]             - Configure Tailscale for exit nodes (one-time)
-  tse deploy                    - Deploy AWS infrastructure (Lambda, IAM, etc.)
-  tse status                    - Show AWS infrastructure deployment status
-  tse teardown                  - Delete all TSE infrastructure (requires confirmation)
+  tse deploy [flags]            - Deploy AWS infrastructure (Lambda, IAM, etc.)
+  tse status [--diff] [--output <format>]
+                                - Show AWS infrastructure deployment status
+  tse teardown [flags]          - Delete all TSE infrastructure (requires confirmation)
+  tse nuke [flags]              - Remove everything: nodes, VPCs, infrastructure, ACL
+                                  changes, auth keys, local config (requires confirmation)
+  tse adopt [--dry-run]         - Bring existing untagged infrastructure under management
+  tse logs export [--since 7d]  - Download Lambda logs to a gzipped file (resumable)
+  tse support-bundle            - Collect a sanitized tar.gz for bug reports
   tse health                    - Check Lambda health
-  tse shutdown                  - Stop exit nodes in ALL regions
-  tse <region> instances        - List instances in region
-  tse <region> start            - Start exit node in region
+  tse doctor [--compliance]     - Check configuration; audit nodes against the security baseline
+  tse loadtest [flags]          - Measure Lambda latency and errors under load (developer)
+  tse serve [--addr host:port]  - Run the API on this machine instead of the Lambda
+  tse regions [--json]          - List regions with their country, continent and price
+  tse ping [--regions eu]       - Measure latency to each region, fastest first
+  tse shutdown [--every-region] - Stop exit nodes in ALL regions
+  tse install-reaper [--at 02:00] - Run 'tse shutdown' every night on this machine
+  tse instances [--all-deployments] [--output <format>]
+                                - List exit nodes in ALL regions; --all-deployments
+                                  includes other deployments in the AWS account,
+                                  --output is table, compact (one line per node,
+                                  for tmux), wide (adds AMI, IPs, cost) or json
+  tse cleanup --all-regions     - Clean up orphaned TSE resources in ALL regions
+  tse tokens create|list|revoke - Manage scoped API tokens
+  tse link <start|stop> <region|all> [--ttl 24h]
+                                - Signed, expiring URL for one action (phone shortcuts)
+  tse audit [--since 24h]       - Show recent control actions (who, what, from where)
+  tse adopt-nodes <region>      - Adopt manually-launched exit nodes in region
+  tse multihop <entry> <exit>   - Chain a node in one region through another (experimental)
+  tse ha-bridge --broker <url>  - Control exit nodes from Home Assistant over MQTT
+  tse quick list|toggle <region> - Script-friendly status and start/stop for launchers
+  tse watch                     - Start an exit node when this device selects it while offline
+  tse tray                      - Exit node status and start/stop in the macOS menu bar
+                                  (builds with -tags tray)
+  tse <region> instances [--output <format>] [--quiet]
+                                - List instances in region; --quiet prints nothing
+                                  and exits 0 if a node is running, 1 if not
+  tse <region> start [--dns <resolver>]
+                                - Start exit node in region; --dns filters its DNS
+                                  (mullvad, adguard, quad9, nextdns:<id>, or an IP),
+                                  --advertise-routes <cidr|vpc,...> makes it a
+                                  subnet router too
   tse <region> stop             - Stop exit nodes in region
+  tse <region> restart          - Replace a wedged exit node with a new one in one
+                                  step, reusing its VPC (takes start's --dns and
+                                  --advertise-routes)
+  tse <region> pause            - Stop the exit node without terminating it (disk kept)
+  tse <region> resume           - Start a paused exit node again, skipping the install
   tse <region> cleanup          - Clean up orphaned TSE resources in region
+  tse <region> reserve          - Show, create, or cancel a capacity reservation in region
+  tse <region> network          - Show, keep, or release the region's VPC between sessions
+  tse <region> verify           - Check the exit node geolocates to the region's country
+  tse <group> start|stop|instances - Start in the closest region of a group (us, eu,
+                                  apac, or an alias from 'tse config alias'); stop
+                                  and instances cover the whole group
 
 Available regions: %s
 
+Global Flags:
+  --profile <name>      - Use a named profile
+  --json-lines          - Stream NDJSON events (steps, per-region results, instance
+                          state) on stdout for deploy, shutdown, start and other long
+                          operations; human-readable output moves to stderr
+  --no-ui               - Print plain progress lines instead of spinners (automatic
+                          when stdin or stdout isn't a terminal, e.g. under cron)
+
+Exit Codes:
+  0    Success
+  1    The command failed; stderr says why
+  2    Bad arguments (unknown command, region, action or flag)
+  130  Interrupted with Ctrl-C
+  instances --quiet exits 0 if an exit node is running, 1 if none is, and 2 if
+  tse couldn't tell. 'tse quick' has its own codes (see 'tse quick').
+
 Environment Variables:
   TAILSCALE_AUTH_KEY    - Tailscale auth key (required for setup and deploy)
   TSE_AUTH_TOKEN        - Auth token for Lambda API (generated by deploy)
   TSE_LAMBDA_URL        - Lambda Function URL (required for exit node operations)
+  TSE_READ_TOKEN        - Read-only token deploy gives the Lambda, for dashboards
+  TSE_TELEGRAM_BOT_TOKEN, TSE_TELEGRAM_CHAT_IDS
+                        - Telegram bot deploy connects to the Lambda, and the chats
+                          allowed to use it
+  TSE_PROFILE           - Profile to use when --profile isn't given
+  TAILSCALE_API_TOKEN   - Tailscale API token (required for setup and adopt-nodes)
+  TSE_CONFIG_PASSPHRASE - Passphrase for a passphrase-encrypted config
+  TSE_USAGE_LOG         - Local usage log path ("off" disables it)
+  TSE_CUSTOM_REGIONS    - Extra or remapped regions, e.g. riyadh=me-west-1 (see 'tse config region')
+  TSE_ONLY_REGIONS      - Limit tse to these regions, e.g. ohio,frankfurt
+  TSE_MQTT_BROKER       - MQTT broker for ha-bridge, e.g. tcp://homeassistant.local:1883
+  TSE_MQTT_USERNAME     - MQTT username for ha-bridge
+  TSE_MQTT_PASSWORD     - MQTT password for ha-bridge
 
 Examples:
+  tse init                       # Set everything up, step by step (first time)
   tse setup                      # Configure Tailscale (first time)
   tse deploy                     # Deploy AWS infrastructure
   tse status                     # Check infrastructure deployment
   tse teardown                   # Delete all infrastructure
+  tse nuke --tailnet example.com # Uninstall, Tailscale side included
   tse health
   tse shutdown                   # Stop exit nodes everywhere
+  tse install-reaper --at 23:30  # ...and do it every night (systemd or launchd)
+  tse instances                  # What's running, everywhere
+  tse cleanup --all-regions --dry-run  # Find orphans everywhere
   tse ohio instances
+  tse ohio instances --quiet && echo "Ohio is up"
   tse ohio start
+  tse eu start                   # Closest of frankfurt, paris, ireland, london, stockholm
+  tse ohio start --dns mullvad   # Ad-blocking DNS for everything using the node
+  tse ohio start --dns 100.101.102.103  # Your Pi-hole, over Tailscale
+  tse ohio start --advertise-routes vpc  # Reach the node's VPC from your tailnet
+  tse --profile family ohio start  # Use the "family" profile
+  tse ohio verify                # Do websites see you in the United States?
+  tse multihop frankfurt ohio    # Connect in Frankfurt, appear in Ohio
   tse ohio stop
+  tse ohio restart               # Node stuck? Replace it without a full stop and start
+  tse ohio pause                 # Keep the node for tomorrow; 'tse ohio resume' brings it back
+  tse ohio cleanup --force       # Include stacks created in the last 10 minutes
+  tse ohio network keep          # Daily region? Stops leave the VPC for quicker starts
+  tse --json-lines shutdown | jq -c 'select(.type == "region.result")'
 `
 
 func main() {
+	// Pull out the global --profile flag before dispatching
+	profileName, args, err := config.ExtractProfileFlag(os.Args[1:])
+	if err != nil {
+		exitWithError(err)
+	}
+	os.Args = append(os.Args[:1], args...)
+
+	// Pull out the global --json-lines flag: events go to stdout, everything a
+	// person would read goes to stderr so it can't corrupt the stream
+	jsonLines, args := extractGlobalFlag(os.Args[1:], "json-lines")
+	os.Args = append(os.Args[:1], args...)
+	if jsonLines {
+		ui.EnableJSONLines(os.Stdout)
+		os.Stdout = os.Stderr
+	}
+
+	// Spinners need a terminal; under cron or CI (or with --no-ui) log plain lines instead
+	noUI, args := extractGlobalFlag(os.Args[1:], "no-ui")
+	os.Args = append(os.Args[:1], args...)
+	if noUI || !ui.IsTerminal(os.Stdin) || !ui.IsTerminal(os.Stdout) {
+		ui.EnablePlain()
+	}
+
 	if len(os.Args) < 2 {
 		showUsage()
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
 	command := os.Args[1]
 
+	// Keep renamed environment variables and flags working, with a warning
+	deprecation.ApplyEnv()
+	os.Args = append(os.Args[:2], deprecation.RewriteFlags(command, os.Args[2:])...)
+
 	// Handle version command
 	if command == "version" || command == "--version" || command == "-v" {
 		fmt.Printf("tse version %s\n", Version)
 		return
 	}
 
+	// Custom regions (config file or environment) apply to every command.
+	// 'tse config' still runs with a bad list, so it can be fixed.
+	if err := applyRegionConfig(); err != nil && command != "config" {
+		exitWithError(err)
+	}
+
+	// Handle profile command (manages the config file directly)
+	if command == "profile" {
+		err := runProfile(os.Args[2:])
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle config command (manages the config file directly)
+	if command == "config" {
+		err := runConfig(os.Args[2:])
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle regions command (static metadata, needs no configuration)
+	if command == "regions" {
+		err := runRegions(os.Args[2:])
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle stats command (reads the local usage log only)
+	if command == "stats" {
+		err := runStats(os.Args[2:])
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Like stats, history only reads the local usage log
+	if command == "history" {
+		err := runHistory(os.Args[2:])
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Apply the selected (or default) profile to the environment, including the
+	// name prefix deployments with custom resource names were made with
+	if err := applyProfile(profileName); err != nil {
+		exitWithError(err)
+	}
+	if err := infrastructure.NamePrefixFromEnv(); err != nil {
+		exitWithError(err)
+	}
+
+	// Root context: cancelled on SIGINT/SIGTERM, or on Ctrl+C inside a spinner
+	// (bubbletea reads Ctrl+C as a key press, so the signal never arrives)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	ui.OnInterrupt(cancel)
+	go func() {
+		// Restore default signal handling so a second Ctrl+C kills the process outright
+		<-ctx.Done()
+		cancel()
+	}()
+
 	// Handle setup command (doesn't require TSE_LAMBDA_URL)
 	if command == "setup" {
-		err := runSetup(os.Args[2:])
+		err := trackCommand("setup", "", func() error { return runSetup(ctx, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle init command (creates the deployment TSE_LAMBDA_URL points at)
+	if command == "init" {
+		err := trackCommand("init", "", func() error { return runInit(ctx, os.Args[2:]) })
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s %v\n", ui.Error("Error:"), err)
-			os.Exit(1)
+			exitWithError(err)
 		}
 		return
 	}
 
 	// Handle status command (doesn't require TSE_LAMBDA_URL)
 	if command == "status" {
-		if len(os.Args) != 2 {
-			showUsage()
-			os.Exit(1)
-		}
-		err := runStatus(os.Args[2:])
+		err := trackCommand("status", "", func() error { return runStatus(ctx, os.Args[2:]) })
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s %v\n", ui.Error("Error:"), err)
-			os.Exit(1)
+			exitWithError(err)
 		}
 		return
 	}
 
 	// Handle deploy command (doesn't require TSE_LAMBDA_URL)
 	if command == "deploy" {
-		if len(os.Args) != 2 {
-			showUsage()
-			os.Exit(1)
-		}
-		err := runDeploy(os.Args[2:])
+		err := trackCommand("deploy", "", func() error { return runDeploy(ctx, os.Args[2:]) })
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s %v\n", ui.Error("Error:"), err)
-			os.Exit(1)
+			exitWithError(err)
 		}
 		return
 	}
 
 	// Handle teardown command (doesn't require TSE_LAMBDA_URL)
 	if command == "teardown" {
-		if len(os.Args) != 2 {
-			showUsage()
-			os.Exit(1)
+		err := trackCommand("teardown", "", func() error { return runTeardown(ctx, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle nuke command (TSE_LAMBDA_URL is optional; without it nodes can't be reached)
+	if command == "nuke" {
+		err := trackCommand("nuke", "", func() error { return runNuke(ctx, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle install-reaper command (doesn't require TSE_LAMBDA_URL; the job reads the profile)
+	if command == "install-reaper" {
+		err := trackCommand("install-reaper", "", func() error { return runInstallReaper(ctx, profileName, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle adopt command (doesn't require TSE_LAMBDA_URL)
+	if command == "adopt" {
+		err := trackCommand("adopt", "", func() error { return runAdopt(ctx, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle logs command (reads CloudWatch directly, doesn't require TSE_LAMBDA_URL)
+	if command == "logs" {
+		err := trackCommand("logs", "", func() error { return runLogs(ctx, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle serve command (runs the API locally; it's what TSE_LAMBDA_URL points at)
+	if command == "serve" {
+		err := trackCommand("serve", "", func() error { return runServe(ctx, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
 		}
-		err := runTeardown(os.Args[2:])
+		return
+	}
+
+	// Handle support-bundle command (collects what it can, with or without TSE_LAMBDA_URL)
+	if command == "support-bundle" {
+		err := trackCommand("support-bundle", "", func() error { return runSupportBundle(ctx, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle loadtest (takes --url, so TSE_LAMBDA_URL is only the default)
+	if command == "loadtest" {
+		err := trackCommand("loadtest", "", func() error { return runLoadTest(ctx, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle ping (measures latency to AWS directly, doesn't require TSE_LAMBDA_URL)
+	if command == "ping" {
+		err := trackCommand("ping", "", func() error { return runPing(ctx, os.Args[2:]) })
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s %v\n", ui.Error("Error:"), err)
-			os.Exit(1)
+			exitWithError(err)
 		}
 		return
 	}
@@ -122,7 +398,7 @@ func main() {
 	if lambdaURL == "" {
 		fmt.Fprintf(os.Stderr, "%s TSE_LAMBDA_URL environment variable not set\n", ui.Error("Error:"))
 		fmt.Fprintf(os.Stderr, "\n%s First run 'tse setup' to configure Tailscale, then deploy the Lambda.\n", ui.Info("Hint:"))
-		os.Exit(1)
+		os.Exit(exitFailed)
 	}
 
 	// Remove trailing slash if present
@@ -132,163 +408,411 @@ func main() {
 	if command == "health" {
 		if len(os.Args) != 2 {
 			showUsage()
-			os.Exit(1)
+			os.Exit(exitUsage)
+		}
+		err := trackCommand("health", "", func() error { return handleHealth(ctx, lambdaURL) })
+		if err != nil {
+			exitWithError(err)
 		}
-		err := handleHealth(lambdaURL)
+		return
+	}
+
+	// Handle doctor (configuration and compliance checks)
+	if command == "doctor" {
+		err := trackCommand("doctor", "", func() error { return runDoctor(ctx, lambdaURL, os.Args[2:]) })
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s %v\n", ui.Error("Error:"), err)
-			os.Exit(1)
+			exitWithError(err)
 		}
 		return
 	}
 
 	// Handle shutdown (stop all regions)
 	if command == "shutdown" {
-		if len(os.Args) != 2 {
-			showUsage()
-			os.Exit(1)
+		err := trackCommand("shutdown", "", func() error { return handleShutdown(ctx, lambdaURL, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle all-regions cleanup
+	if command == "cleanup" {
+		err := trackCommand("cleanup", "", func() error { return runCleanup(ctx, lambdaURL, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle token management
+	if command == "tokens" {
+		err := trackCommand("tokens", "", func() error { return runTokens(ctx, lambdaURL, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle signed action links
+	if command == "link" {
+		err := trackCommand("link", "", func() error { return runLink(ctx, lambdaURL, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle audit log queries
+	if command == "audit" {
+		err := trackCommand("audit", "", func() error { return runAudit(ctx, lambdaURL, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
 		}
-		err := handleShutdown(lambdaURL)
+		return
+	}
+
+	// Handle global instance listing (all regions)
+	if command == "instances" {
+		opts, err := parseInstancesFlags("tse instances", os.Args[2:], true)
+		if err != nil {
+			exitUsageError(err)
+		}
+		if opts.quiet {
+			exitQuery(nodeRunning(ctx, lambdaURL, regions.GetAllFriendlyNames(), opts.allDeployments))
+			return
+		}
+		err = trackCommand("instances", "", func() error { return handleAllInstances(ctx, lambdaURL, opts) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle multihop (two regions chained through a tunnel)
+	if command == "multihop" {
+		err := trackCommand("multihop", "", func() error { return runMultihop(ctx, lambdaURL, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle launcher quick actions, which have their own output and exit codes
+	if command == "quick" {
+		err := trackCommand("quick", "", func() error { return runQuick(ctx, lambdaURL, os.Args[2:]) })
+		if err != nil {
+			exitQuick(err)
+		}
+		return
+	}
+
+	// Handle the on-demand watcher
+	if command == "watch" {
+		err := trackCommand("watch", "", func() error { return runWatch(ctx, lambdaURL, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle the menu bar companion (only in builds with the tray tag)
+	if command == "tray" {
+		err := trackCommand("tray", "", func() error { return runTray(ctx, lambdaURL, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle the Home Assistant bridge (runs until interrupted)
+	if command == "ha-bridge" {
+		err := trackCommand("ha-bridge", "", func() error { return runHABridge(ctx, lambdaURL, os.Args[2:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Handle adopt-nodes (region + flags)
+	if command == "adopt-nodes" {
+		err := trackCommand("adopt-nodes", "", func() error { return runAdoptNodes(ctx, lambdaURL, os.Args[2:]) })
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s %v\n", ui.Error("Error:"), err)
-			os.Exit(1)
+			exitWithError(err)
 		}
 		return
 	}
 
-	// All other commands require region + action
-	if len(os.Args) != 3 {
+	// All other commands require region + action; only instances, start, restart, reserve, network and cleanup take more
+	if len(os.Args) < 3 || (len(os.Args) > 3 && os.Args[2] != "instances" && os.Args[2] != "start" && os.Args[2] != "restart" && os.Args[2] != "reserve" && os.Args[2] != "network" && os.Args[2] != "cleanup") {
 		showUsage()
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
-	region := command
 	action := os.Args[2]
 
-	// Validate region
-	if !regions.IsValidFriendlyName(region) {
-		fmt.Fprintf(os.Stderr, "%s Invalid region %s\n", ui.Error("Error:"), ui.Highlight(region))
-		fmt.Fprintf(os.Stderr, "Available regions: %s\n", regions.GetAvailableRegions())
-		os.Exit(1)
+	// Validate region, accepting localized names ("francfort", "東京") and
+	// region groups ("eu", or an alias from the config file)
+	target, err := resolveRegionTarget(command)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s Invalid region %s\n", ui.Error("Error:"), ui.Highlight(command))
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	// A group starts in one of its regions; listing and stopping cover all of them
+	region := target.Regions[0]
+	if target.IsGroup() {
+		switch action {
+		case "start":
+			err := trackCommand(action, target.Name, func() error {
+				opts, err := parseStartFlags(target.Name, os.Args[3:])
+				if err != nil {
+					return err
+				}
+				if region, err = chooseRegion(ctx, target); err != nil {
+					return err
+				}
+				return handleStart(ctx, lambdaURL, region, opts)
+			})
+			if err != nil {
+				exitWithError(err)
+			}
+		case "instances":
+			opts, err := parseInstancesFlags(fmt.Sprintf("tse %s instances", target.Name), os.Args[3:], false)
+			if err != nil {
+				exitUsageError(err)
+			}
+			if opts.quiet {
+				exitQuery(nodeRunning(ctx, lambdaURL, target.Regions, false))
+				return
+			}
+			err = trackCommand(action, target.Name, func() error {
+				return listInstancesIn(ctx, lambdaURL, fmt.Sprintf("Exit nodes in %s", target.Name), target.Regions, opts)
+			})
+			if err != nil {
+				exitWithError(err)
+			}
+		case "stop":
+			err := trackCommand(action, target.Name, func() error {
+				return stopIn(ctx, lambdaURL, fmt.Sprintf("Stopping exit nodes in %s...", target.Name), target.Regions)
+			})
+			if err != nil {
+				exitWithError(err)
+			}
+		default:
+			exitWithError(fmt.Errorf("%s is a region group (%s); %s needs a single region", ui.Highlight(target.Name), strings.Join(target.Regions, ", "), action))
+		}
+		return
 	}
 
 	// Handle actions
 	switch action {
 	case "instances":
-		err := handleInstances(lambdaURL, region)
+		opts, err := parseInstancesFlags(fmt.Sprintf("tse %s instances", region), os.Args[3:], false)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s %v\n", ui.Error("Error:"), err)
-			os.Exit(1)
+			exitUsageError(err)
+		}
+		if opts.quiet {
+			exitQuery(nodeRunning(ctx, lambdaURL, []string{region}, false))
+			return
+		}
+		err = trackCommand(action, region, func() error { return handleInstances(ctx, lambdaURL, region, opts.output) })
+		if err != nil {
+			exitWithError(err)
 		}
 	case "start":
-		err := handleStart(lambdaURL, region)
+		err := trackCommand(action, region, func() error {
+			opts, err := parseStartFlags(region, os.Args[3:])
+			if err != nil {
+				return err
+			}
+			return handleStart(ctx, lambdaURL, region, opts)
+		})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s %v\n", ui.Error("Error:"), err)
-			os.Exit(1)
+			exitWithError(err)
 		}
 	case "stop":
-		err := handleStop(lambdaURL, region)
+		err := trackCommand(action, region, func() error { return handleStop(ctx, lambdaURL, region) })
+		if err != nil {
+			exitWithError(err)
+		}
+	case "restart":
+		err := trackCommand(action, region, func() error {
+			opts, err := parseRestartFlags(region, os.Args[3:])
+			if err != nil {
+				return err
+			}
+			return handleRestart(ctx, lambdaURL, region, opts)
+		})
+		if err != nil {
+			exitWithError(err)
+		}
+	case "pause":
+		err := trackCommand(action, region, func() error { return handlePause(ctx, lambdaURL, region) })
+		if err != nil {
+			exitWithError(err)
+		}
+	case "resume":
+		err := trackCommand(action, region, func() error { return handleResume(ctx, lambdaURL, region) })
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s %v\n", ui.Error("Error:"), err)
-			os.Exit(1)
+			exitWithError(err)
 		}
 	case "cleanup":
-		err := handleCleanup(lambdaURL, region)
+		err := trackCommand(action, region, func() error { return handleCleanup(ctx, lambdaURL, region, os.Args[3:]) })
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s %v\n", ui.Error("Error:"), err)
-			os.Exit(1)
+			exitWithError(err)
+		}
+	case "reserve":
+		err := trackCommand(action, region, func() error { return runReserve(ctx, lambdaURL, region, os.Args[3:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+	case "network":
+		err := trackCommand(action, region, func() error { return runNetwork(ctx, lambdaURL, region, os.Args[3:]) })
+		if err != nil {
+			exitWithError(err)
+		}
+	case "verify":
+		err := trackCommand(action, region, func() error { return handleVerify(ctx, lambdaURL, region) })
+		if err != nil {
+			exitWithError(err)
 		}
 	default:
 		fmt.Fprintf(os.Stderr, "%s Invalid action %s\n", ui.Error("Error:"), ui.Highlight(action))
-		fmt.Fprintf(os.Stderr, "Valid actions: instances, start, stop, cleanup\n")
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Valid actions: instances, start, stop, restart, pause, resume, cleanup, reserve, network, verify\n")
+		os.Exit(exitUsage)
 	}
 }
 
-func showUsage() {
-	fmt.Printf(Usage, regions.GetAvailableRegions())
-}
+// activeProfile is the profile applyProfile applied, if any
+var activeProfile string
 
-func getAuthToken() string {
-	return os.Getenv("TSE_AUTH_TOKEN")
-}
+// applyProfile loads the config file and exports the chosen profile's settings.
+// An explicit profile (--profile or TSE_PROFILE) overrides the environment;
+// the default profile only fills in what isn't already set.
+func applyProfile(explicit string) error {
+	if explicit == "" {
+		explicit = os.Getenv(config.EnvProfile)
+	}
 
-func makeAuthenticatedRequest(method, url string, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, body)
+	cfg, err := config.Load()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Add Authorization header if token is set
-	if token := getAuthToken(); token != "" {
-		req.Header.Set("Authorization", "Bearer "+token)
+	name, profile, err := cfg.Resolve(explicit)
+	if err != nil {
+		return err
 	}
-
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	activeProfile = name
+	if profile != nil {
+		profile.Apply(explicit != "")
 	}
-	resp, err := client.Do(req)
 
-	// Add helpful context to network errors
+	return nil
+}
+
+// applyRegionConfig applies custom regions and the region allowlist from the
+// config file, unless TSE_CUSTOM_REGIONS or TSE_ONLY_REGIONS already set them
+func applyRegionConfig() error {
+	cfg, err := config.Load()
 	if err != nil {
-		return nil, enhanceHTTPError(err, url)
+		return err
 	}
-
-	return resp, nil
+	cfg.ApplyRegions()
+	return regions.FromEnv()
 }
 
-// enhanceHTTPError adds helpful troubleshooting context to HTTP errors
-func enhanceHTTPError(err error, url string) error {
-	if strings.Contains(err.Error(), "timeout") {
-		return fmt.Errorf("request timed out after 30s\n\nTroubleshooting:\n  - Check your internet connection\n  - Verify TSE_LAMBDA_URL is correct: %s\n  - Lambda might be cold-starting (rare, try again)\n\nOriginal error: %w", url, err)
+// extractGlobalFlag removes a global boolean flag (e.g. --json-lines) from args,
+// reporting whether it was there
+func extractGlobalFlag(args []string, name string) (bool, []string) {
+	found := false
+	rest := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "--"+name || arg == "-"+name {
+			found = true
+			continue
+		}
+		rest = append(rest, arg)
 	}
+	return found, rest
+}
 
-	if strings.Contains(err.Error(), "no such host") || strings.Contains(err.Error(), "connection refused") {
-		return fmt.Errorf("cannot reach Lambda endpoint\n\nTroubleshooting:\n  - Is TSE_LAMBDA_URL set correctly? %s\n  - Did you run 'tse deploy' first?\n  - Check 'tse status' to verify infrastructure exists\n\nOriginal error: %w", url, err)
+// exitWithError prints err and exits. Interruptions (Ctrl+C) exit quietly with
+// the conventional status 130 instead of being reported as failures.
+func exitWithError(err error) {
+	if isInterrupted(err) {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.Warning("Interrupted"))
+		var interrupted *interruptedError
+		if errors.As(err, &interrupted) {
+			if note := interruptNote(interrupted.command, interrupted.region); note != "" {
+				fmt.Fprintf(os.Stderr, "%s\n", ui.Subtle(note))
+			}
+		}
+		os.Exit(exitInterrupted)
 	}
+	fmt.Fprintf(os.Stderr, "%s %v\n", ui.Error("Error:"), err)
+	os.Exit(exitFailed)
+}
 
-	return fmt.Errorf("network error: %w\n\nCheck your internet connection and verify TSE_LAMBDA_URL: %s", err, url)
+func showUsage() {
+	fmt.Printf(Usage, regions.GetAvailableRegions())
 }
 
-// enhanceHTTPStatusError adds context based on HTTP status codes
+func getAuthToken() string {
+	return os.Getenv("TSE_AUTH_TOKEN")
+}
+
+// enhanceHTTPStatusError adds context based on the Lambda's error code, or on
+// the HTTP status when the code has no hints of its own
 func enhanceHTTPStatusError(statusCode int, body, operation string) error {
+	var errorResp types.ErrorResponse
+	parsed := json.Unmarshal([]byte(body), &errorResp) == nil && errorResp.Error != ""
+	if parsed {
+		if err, ok := explainErrorCode(errorResp, operation); ok {
+			return err
+		}
+	}
+
 	switch statusCode {
+	case 400:
+		// The Lambda's explanation of a bad request is the whole story
+		if parsed {
+			return fmt.Errorf("%s failed: %s", operation, errorResp.Error)
+		}
+		return fmt.Errorf("%s failed (HTTP 400)\n\nResponse: %s", operation, body)
 	case 401:
-		return fmt.Errorf("%s failed (HTTP 401 Unauthorized)\n\nTroubleshooting:\n  - Check TSE_AUTH_TOKEN is set correctly\n  - Token might have expired or been rotated\n  - Run 'tse deploy' to regenerate token\n\nResponse: %s", operation, body)
+		return fmt.Errorf("%s failed (HTTP 401 Unauthorized)\n\nTroubleshooting:\n  - Check TSE_AUTH_TOKEN is set correctly\n  - Token might have expired, been rotated, or been revoked ('tse tokens list')\n  - Run 'tse deploy' to regenerate token\n\nResponse: %s", operation, body)
 	case 403:
-		return fmt.Errorf("%s failed (HTTP 403 Forbidden)\n\nTroubleshooting:\n  - Lambda might not have IAM permissions\n  - Check CloudWatch logs for Lambda errors\n  - Run 'tse status' to verify deployment\n\nResponse: %s", operation, body)
+		return fmt.Errorf("%s failed (HTTP 403 Forbidden)\n\nTroubleshooting:\n  - Your token might lack the scope for this operation ('tse tokens list')\n  - Lambda might not have IAM permissions\n  - Check CloudWatch logs for Lambda errors\n  - Run 'tse status' to verify deployment\n\nResponse: %s", operation, body)
+	case 429:
+		return fmt.Errorf("%s failed (HTTP 429 Too Many Requests)\n\nTroubleshooting:\n  - The Lambda throttles clients that send too many requests or bad tokens\n  - Wait a minute and try again\n  - If it keeps happening, check TSE_AUTH_TOKEN is correct\n\nResponse: %s", operation, body)
 	case 404:
 		return fmt.Errorf("%s failed (HTTP 404 Not Found)\n\nTroubleshooting:\n  - Check TSE_LAMBDA_URL is correct\n  - Endpoint might not exist (check Lambda handler)\n  - Verify region name is valid\n\nResponse: %s", operation, body)
 	case 500, 502, 503:
-		return fmt.Errorf("%s failed (HTTP %d Server Error)\n\nTroubleshooting:\n  - Lambda encountered an internal error\n  - Check CloudWatch logs: /aws/lambda/tailscale-exits\n  - Common causes: AWS quota limits, IAM permissions, Tailscale auth key issues\n\nResponse: %s", operation, statusCode, body)
+		return fmt.Errorf("%s failed (HTTP %d Server Error)\n\nTroubleshooting:\n  - Lambda encountered an internal error\n  - Check CloudWatch logs: %s\n  - Common causes: AWS quota limits, IAM permissions, Tailscale auth key issues\n\nResponse: %s", operation, statusCode, infrastructure.LogGroupName, body)
 	default:
 		return fmt.Errorf("%s failed (HTTP %d)\n\nResponse: %s", operation, statusCode, body)
 	}
 }
 
-func handleHealth(lambdaURL string) error {
+func handleHealth(ctx context.Context, lambdaURL string) error {
 	var health types.HealthResponse
+	var local localIdentity
+	var localErr error
 
 	err := ui.WithSpinner("Checking Lambda health", func() error {
-		resp, err := makeAuthenticatedRequest("GET", lambdaURL, nil)
-		if err != nil {
-			return err // Already enhanced with context
-		}
-		defer resp.Body.Close()
+		local, localErr = lookupLocalIdentity(ctx)
 
-		body, err := io.ReadAll(resp.Body)
+		c, err := lambdaClient(lambdaURL)
 		if err != nil {
-			return fmt.Errorf("failed to read response: %w", err)
-		}
-
-		if resp.StatusCode != http.StatusOK {
-			return enhanceHTTPStatusError(resp.StatusCode, string(body), "health check")
+			return err
 		}
-
-		if err := json.Unmarshal(body, &health); err != nil {
-			return fmt.Errorf("failed to parse health response: %w", err)
+		resp, err := c.Health(ctx)
+		if err != nil {
+			return explainLambdaError(err)
 		}
-
+		health = *resp
 		return nil
 	})
 
@@ -304,42 +828,102 @@ func handleHealth(lambdaURL string) error {
 		fmt.Sprintf("Version     %s", health.Version),
 		fmt.Sprintf("Timestamp   %s", health.Timestamp),
 	}
+	if health.APIVersion != "" {
+		content = append(content, fmt.Sprintf("API         %s", health.APIVersion))
+	}
+	if health.AccountID != "" {
+		content = append(content, fmt.Sprintf("Account     %s", health.AccountID))
+	}
+	if health.Deployment != "" {
+		content = append(content, fmt.Sprintf("Deployment  %s", health.Deployment))
+	}
+	if health.DeploymentID != "" {
+		content = append(content, fmt.Sprintf("ID          %s", health.DeploymentID))
+	}
+	if health.Region != "" {
+		content = append(content, fmt.Sprintf("Region      %s", health.Region))
+	}
+	if health.Container != nil {
+		content = append(content, fmt.Sprintf("Container   %s", describeContainer(health.Container)))
+	}
 	fmt.Println(ui.SuccessBox("Lambda Health", content...))
 
+	// Catch a TSE_LAMBDA_URL pointing at someone else's deployment
+	if localErr != nil {
+		fmt.Println(ui.Subtle(fmt.Sprintf("Couldn't compare with your AWS configuration: %s", firstLine(localErr.Error()))))
+		return nil
+	}
+	mismatches := identityMismatches(health, local)
+	if len(mismatches) > 0 {
+		fmt.Println()
+		fmt.Println(ui.Warning("This may not be your deployment:"))
+		for _, mismatch := range mismatches {
+			fmt.Printf("  %s %s\n", ui.Cross(), mismatch)
+		}
+		fmt.Println(ui.Subtle("Check TSE_LAMBDA_URL (or --profile) and AWS_PROFILE point at the same deployment."))
+	}
+
 	return nil
 }
 
-func handleInstances(lambdaURL, region string) error {
-	var instancesResp types.InstancesResponse
-
-	err := ui.WithSpinner(fmt.Sprintf("Listing instances in %s", region), func() error {
-		url := fmt.Sprintf("%s/%s/instances", lambdaURL, region)
-		resp, err := makeAuthenticatedRequest("GET", url, nil)
-		if err != nil {
-			return err // Already enhanced with context
-		}
-		defer resp.Body.Close()
+// describeContainer summarizes the Lambda container that answered a health
+// check: whether the check paid for a cold start, and how warm-keeping is going
+func describeContainer(stats *types.ContainerStats) string {
+	if stats.ColdStart {
+		return "cold start (this check started it)"
+	}
+	summary := "warm"
+	if started, err := time.Parse(time.RFC3339, stats.Started); err == nil {
+		summary += ", up " + formatSessionDuration(time.Since(started))
+	}
+	summary += fmt.Sprintf(", %d invocations", stats.Invocations)
+	if stats.WarmPings > 0 {
+		summary += fmt.Sprintf(" (%d warm pings)", stats.WarmPings)
+	}
+	return summary
+}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to read response: %w", err)
-		}
+// handleInstances lists a region's exit nodes: a card per node, or in the
+// given --output format
+func handleInstances(ctx context.Context, lambdaURL, region string, output outputFormat) error {
+	// Scripts read only the nodes from stdout; progress and warnings go to stderr
+	out := os.Stdout
+	if output.scripted() {
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = out }()
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			return enhanceHTTPStatusError(resp.StatusCode, string(body), fmt.Sprintf("list instances in %s", region))
-		}
+	var instancesResp *types.InstancesResponse
 
-		if err := json.Unmarshal(body, &instancesResp); err != nil {
-			return fmt.Errorf("failed to parse response: %w", err)
+	err := ui.WithSpinner(fmt.Sprintf("Listing instances in %s", region), func() error {
+		var err error
+		instancesResp, err = listRegionInstances(ctx, lambdaURL, region)
+		if err == nil {
+			fillTailnetIPs(ctx, instancesResp.Instances)
 		}
-
-		return nil
+		return err
 	})
 
 	if err != nil {
 		return err
 	}
 
+	if output != "" {
+		for _, instance := range instancesResp.Instances {
+			if instance.FriendlyRegion == "" {
+				instance.FriendlyRegion = region
+			}
+		}
+		if !output.scripted() {
+			fmt.Println()
+		}
+		if err := printNodes(out, output, instancesResp.Instances); err != nil {
+			return err
+		}
+		printAnomalies(region, instancesResp.Anomalies)
+		return nil
+	}
+
 	fmt.Println()
 	fmt.Printf("Instances in %s region: %s\n", ui.Highlight(region), ui.Bold(fmt.Sprintf("%d", instancesResp.Count)))
 	if instancesResp.Count == 0 {
@@ -352,8 +936,9 @@ func handleInstances(lambdaURL, region string) error {
 		// Build instance details content
 		content := []string{
 			fmt.Sprintf("Instance    %s", instance.InstanceID),
-			fmt.Sprintf("Type        %s", instance.InstanceType),
+			fmt.Sprintf("Type        %s", instanceType(instance)),
 			fmt.Sprintf("State       %s", instance.State),
+			fmt.Sprintf("Ready       %s", readiness(instance)),
 			fmt.Sprintf("Launch Time %s", instance.LaunchTime.Format("2006-01-02 15:04 MST")),
 		}
 
@@ -361,54 +946,336 @@ func handleInstances(lambdaURL, region string) error {
 			content = append(content, fmt.Sprintf("Public IP   %s", instance.PublicIP))
 		}
 
+		if instance.CapacityReservationID != "" {
+			content = append(content, fmt.Sprintf("Reservation %s", instance.CapacityReservationID))
+		}
+
+		if instance.Hop != "" {
+			content = append(content, fmt.Sprintf("Multihop    %s", hopDescription(instance.Hop)))
+		}
+
+		if instance.StartedBy != "" {
+			content = append(content, fmt.Sprintf("Started By  %s", instance.StartedBy))
+		}
+
+		if instance.NetworkOutBytes > 0 {
+			content = append(content, fmt.Sprintf("Data Out    %s", dataTransfer(instance.NetworkOutBytes, region)))
+		}
+
 		if instance.TailscaleHostname != "" {
 			content = append(content, fmt.Sprintf("Hostname    %s", instance.TailscaleHostname))
 		}
 
+		if instance.TailscaleIP != "" {
+			content = append(content, fmt.Sprintf("Tailnet IP  %s", instance.TailscaleIP))
+			if instance.TailscaleIPv6 != "" {
+				content = append(content, fmt.Sprintf("            %s", instance.TailscaleIPv6))
+			}
+		} else if instance.TailscaleIPv6 != "" {
+			content = append(content, fmt.Sprintf("Tailnet IP  %s", instance.TailscaleIPv6))
+		}
+
 		// Use info box for each instance
 		fmt.Println(ui.InfoBox("Exit Node Details", content...))
 		fmt.Println()
 	}
 
+	printAnomalies(region, instancesResp.Anomalies)
 	return nil
 }
 
-func handleStart(lambdaURL, region string) error {
-	var startResp types.StartResponse
-	var alreadyRunning bool
+// printAnomalies warns about nodes in region that tse would never have launched
+func printAnomalies(region string, anomalies []types.Anomaly) {
+	if len(anomalies) == 0 {
+		return
+	}
+	var lines []string
+	for _, anomaly := range anomalies {
+		lines = append(lines, fmt.Sprintf("%s: %s (%s)", anomaly.InstanceID, anomaly.Detail, anomaly.Resource))
+	}
+	lines = append(lines, "", "tse never launches nodes like these. Check the account for tampering,", "then stop them with 'tse "+region+" stop'.")
+	fmt.Println(ui.WarningBox("🚨 Unexpected Exit Nodes", lines...))
+	fmt.Println()
+}
 
-	err := ui.WithSpinner(fmt.Sprintf("Starting exit node in %s", region), func() error {
-		url := fmt.Sprintf("%s/%s/start", lambdaURL, region)
-		resp, err := makeAuthenticatedRequest("POST", url, nil)
+// listRegionInstances fetches the deployment's exit node instances in a single region
+func listRegionInstances(ctx context.Context, lambdaURL, region string) (*types.InstancesResponse, error) {
+	return listDeploymentInstances(ctx, lambdaURL, region, false)
+}
+
+// listDeploymentInstances fetches the exit node instances in a single region,
+// every deployment's in the account if allDeployments is set
+func listDeploymentInstances(ctx context.Context, lambdaURL, region string, allDeployments bool) (*types.InstancesResponse, error) {
+	c, err := lambdaClient(lambdaURL)
+	if err != nil {
+		return nil, err
+	}
+	list := c.Instances
+	if allDeployments {
+		list = c.AllDeploymentInstances
+	}
+	instancesResp, err := list(ctx, region)
+	if err != nil {
+		return nil, explainLambdaError(err)
+	}
+	return instancesResp, nil
+}
+
+// handleAllInstances lists exit node instances across every region, showing each
+// region's count as soon as it responds. opts.allDeployments includes other
+// deployments' nodes in the same AWS account.
+func handleAllInstances(ctx context.Context, lambdaURL string, opts instancesOptions) error {
+	return printInstances(opts, func() ([]*types.InstanceInfo, error) {
+		return fetchAllNodes(ctx, lambdaURL, opts.allDeployments)
+	})
+}
+
+// listInstancesIn lists exit node instances across the named regions, as a
+// table unless opts.output says otherwise
+func listInstancesIn(ctx context.Context, lambdaURL, title string, names []string, opts instancesOptions) error {
+	return printInstances(opts, func() ([]*types.InstanceInfo, error) {
+		return fetchNodes(ctx, lambdaURL, title, names, opts.allDeployments)
+	})
+}
+
+// printInstances prints the nodes fetch finds, as a table unless opts.output
+// says otherwise
+func printInstances(opts instancesOptions, fetch func() ([]*types.InstanceInfo, error)) error {
+	// Scripts read only the nodes from stdout; progress goes to stderr
+	out := os.Stdout
+	if opts.output.scripted() {
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = out }()
+	}
+
+	all, err := fetch()
+	if err != nil {
+		return err
+	}
+	if len(all) == 0 && !opts.output.scripted() {
+		fmt.Println(ui.Subtle("No exit nodes found in any region."))
+		return nil
+	}
+
+	output := opts.output
+	if output == "" {
+		output = outputTable
+	}
+	return printNodes(out, output, all)
+}
+
+// fetchNodes lists the exit nodes in the named regions, showing each region's
+// count as soon as it responds, sorted by region and then launch time. Regions
+// that fail are reported and left out.
+func fetchNodes(ctx context.Context, lambdaURL, title string, names []string, allDeployments bool) ([]*types.InstanceInfo, error) {
+	var mu sync.Mutex
+	var all []*types.InstanceInfo
+
+	results := ui.FanOut(title, names, func(region string) (string, error) {
+		instancesResp, err := listDeploymentInstances(ctx, lambdaURL, region, allDeployments)
 		if err != nil {
-			return err // Already enhanced with context
+			return "", err
 		}
-		defer resp.Body.Close()
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to read response: %w", err)
+		mu.Lock()
+		for _, instance := range instancesResp.Instances {
+			if instance.FriendlyRegion == "" {
+				instance.FriendlyRegion = region
+			}
+			all = append(all, instance)
+		}
+		mu.Unlock()
+
+		if instancesResp.Count == 0 {
+			return "none", nil
 		}
+		return fmt.Sprintf("%d instance(s)", instancesResp.Count), nil
+	})
+
+	fmt.Println()
+	printFanOutFailures(results)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return sortNodes(ctx, all), nil
+}
 
-		// Handle 409 Conflict gracefully (instance already running)
-		if resp.StatusCode == http.StatusConflict {
-			var errorResp types.ErrorResponse
-			if json.Unmarshal(body, &errorResp) == nil {
-				alreadyRunning = true
-				startResp.Message = errorResp.Error
+// fetchAllNodes lists the exit nodes in every region. This deployment's take
+// one request, which the Lambda answers by asking EC2 only in the regions its
+// node registry has nodes in. Every deployment's, or a Lambda from before
+// GET /instances, take a request per region.
+func fetchAllNodes(ctx context.Context, lambdaURL string, allDeployments bool) ([]*types.InstanceInfo, error) {
+	title := "Exit nodes in all regions"
+	if !allDeployments {
+		c, err := lambdaClient(lambdaURL)
+		if err != nil {
+			return nil, err
+		}
+		var listed *types.InstancesResponse
+		err = ui.WithSpinner(title, func() error {
+			var err error
+			listed, err = c.AllInstances(ctx)
+			var statusErr *client.StatusError
+			if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
 				return nil
 			}
+			return err
+		})
+		if err != nil {
+			return nil, explainLambdaError(err)
+		}
+		if listed != nil {
+			for _, region := range listed.FailedRegions {
+				fmt.Fprintf(os.Stderr, "%s %s: couldn't list exit nodes\n", ui.Warning("Warning:"), region)
+			}
+			return sortNodes(ctx, listed.Instances), nil
+		}
+	}
+	return fetchNodes(ctx, lambdaURL, title, regions.GetAllFriendlyNames(), allDeployments)
+}
+
+// sortNodes fills in the nodes' tailnet addresses and sorts them by region and
+// then launch time
+func sortNodes(ctx context.Context, all []*types.InstanceInfo) []*types.InstanceInfo {
+	if len(all) == 0 {
+		return nil
+	}
+
+	fillTailnetIPs(ctx, all)
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].FriendlyRegion != all[j].FriendlyRegion {
+			return all[i].FriendlyRegion < all[j].FriendlyRegion
 		}
+		return all[i].LaunchTime.Before(all[j].LaunchTime)
+	})
+	return all
+}
+
+// readiness describes whether a node has reported itself usable
+func readiness(instance *types.InstanceInfo) string {
+	switch {
+	case instance.Ready:
+		return ui.Success("yes")
+	case instance.State == "pending" || instance.State == "running":
+		return ui.Subtle("starting")
+	case instance.State == "stopping" || instance.State == "stopped":
+		return ui.Subtle("paused")
+	default:
+		return ui.Subtle("-")
+	}
+}
+
+// instanceType describes an instance's type and, when the Lambda reports it, its
+// architecture (x86_64 means t4g capacity ran out and the node fell back to t3)
+func instanceType(instance *types.InstanceInfo) string {
+	if instance.Architecture == "" {
+		return instance.InstanceType
+	}
+	return fmt.Sprintf("%s (%s)", instance.InstanceType, instance.Architecture)
+}
 
-		if resp.StatusCode != http.StatusCreated {
-			return enhanceHTTPStatusError(resp.StatusCode, string(body), fmt.Sprintf("start exit node in %s", region))
+// printFanOutFailures prints the full error for every region that failed, since the
+// live per-region view only has room for the first line
+func printFanOutFailures(results []ui.FanOutResult) {
+	failed := false
+	for _, result := range results {
+		if result.Err == nil || isInterrupted(result.Err) {
+			continue
 		}
+		fmt.Fprintf(os.Stderr, "%s %s: %v\n", ui.Warning("Warning:"), result.Name, result.Err)
+		failed = true
+	}
+	if failed {
+		fmt.Fprintln(os.Stderr)
+	}
+}
 
-		if err := json.Unmarshal(body, &startResp); err != nil {
-			return fmt.Errorf("failed to parse response: %w", err)
+// failedNames returns the regions whose fan-out result is an error
+func failedNames(results []ui.FanOutResult) []string {
+	var failed []string
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result.Name)
 		}
+	}
+	return failed
+}
 
-		return nil
+// startOptions are the choices 'tse <region> start' sends with the request
+type startOptions struct {
+	dns    dns.Resolver
+	routes []string // Subnet routes to advertise besides the exit node
+	dryRun bool     // Show the calls a start would make instead of starting
+}
+
+// parseStartFlags reads 'tse <region> start [--dns <resolver>] [--advertise-routes <routes>] [--dry-run]'.
+// Without --dns the config file's default applies; "--dns none" overrides it.
+func parseStartFlags(region string, args []string) (startOptions, error) {
+	fs := flag.NewFlagSet("start", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: tse %s start [--dns <resolver>] [--advertise-routes <routes>] [--dry-run]\n\n", region)
+		fmt.Fprintln(os.Stderr, "  --dns               Resolver for the node's clients:")
+		fmt.Fprintf(os.Stderr, "                      %s\n", dns.Choices)
+		fmt.Fprintf(os.Stderr, "                      %q keeps the VPC's (default: 'tse config dns')\n", dns.None)
+		fmt.Fprintln(os.Stderr, "  --advertise-routes  Also act as a subnet router for these CIDR prefixes,")
+		fmt.Fprintf(os.Stderr, "                      comma-separated; %q is the node's VPC (%s)\n", routes.VPC, routes.VPCCIDR)
+		fmt.Fprintln(os.Stderr, "  --dry-run           List the calls the start would make, with their parameters,")
+		fmt.Fprintln(os.Stderr, "                      and launch nothing")
+	}
+	spec := fs.String("dns", "", "DNS resolver for the exit node")
+	routeSpec := fs.String("advertise-routes", "", "Subnet routes to advertise")
+	dryRun := fs.Bool("dry-run", false, "List the calls the start would make and launch nothing")
+	if err := fs.Parse(args); err != nil {
+		return startOptions{}, err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return startOptions{}, fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+
+	opts, err := nodeOptions(*spec, *routeSpec)
+	opts.dryRun = *dryRun
+	return opts, err
+}
+
+// nodeOptions parses the --dns and --advertise-routes a new node takes,
+// falling back to the config file's resolver without --dns
+func nodeOptions(spec, routeSpec string) (startOptions, error) {
+	if spec == "" {
+		cfg, err := config.Load()
+		if err != nil {
+			return startOptions{}, err
+		}
+		spec = cfg.DNS
+	}
+	resolver, err := dns.Parse(spec)
+	if err != nil {
+		return startOptions{}, fmt.Errorf("--dns: %w", err)
+	}
+	advertised, err := routes.Parse(routeSpec)
+	if err != nil {
+		return startOptions{}, fmt.Errorf("--advertise-routes: %w", err)
+	}
+	return startOptions{dns: resolver, routes: advertised}, nil
+}
+
+func handleStart(ctx context.Context, lambdaURL, region string, opts startOptions) error {
+	if opts.dryRun {
+		return handleStartDryRun(ctx, lambdaURL, region, opts)
+	}
+
+	var startResp *types.StartResponse
+	var alreadyRunning bool
+
+	err := ui.WithSpinner(fmt.Sprintf("Starting exit node in %s", region), func() error {
+		var err error
+		startResp, alreadyRunning, err = startRegion(ctx, lambdaURL, types.StartRequest{
+			Region:          region,
+			DNS:             opts.dns.Name,
+			AdvertiseRoutes: opts.routes,
+		})
+		return err
 	})
 
 	if err != nil {
@@ -421,43 +1288,109 @@ func handleStart(lambdaURL, region string) error {
 		return nil
 	}
 
+	usage.Record(usage.Event{Kind: usage.KindNodeStart, Region: region})
+
 	fmt.Printf("%s %s\n", ui.Checkmark(), startResp.Message)
+	if startResp.Replayed {
+		fmt.Println(ui.Subtle("   (a retried request; this is the node the first attempt launched)"))
+	}
 	if startResp.Instance != nil {
+		ui.Emit(ui.Event{Type: ui.EventInstanceState, Region: region, Instance: startResp.Instance.InstanceID, State: startResp.Instance.State})
 		fmt.Printf("%s %s\n", ui.Label("Instance ID:"), ui.Highlight(startResp.Instance.InstanceID))
-		fmt.Printf("%s %s\n", ui.Label("Instance Type:"), startResp.Instance.InstanceType)
+		fmt.Printf("%s %s\n", ui.Label("Instance Type:"), instanceType(startResp.Instance))
 		fmt.Printf("%s %s\n", ui.Label("Tailscale Hostname:"), ui.Highlight(startResp.Instance.TailscaleHostname))
 		fmt.Printf("%s %s\n", ui.Label("State:"), ui.Success(startResp.Instance.State))
+		if !opts.dns.IsZero() {
+			fmt.Printf("%s %s\n", ui.Label("DNS:"), opts.dns.Name)
+		}
+		if len(opts.routes) > 0 {
+			fmt.Printf("%s %s\n", ui.Label("Subnet Routes:"), strings.Join(opts.routes, ", "))
+		}
 		fmt.Printf("\n%s It may take 1-2 minutes for the exit node to become available in Tailscale.\n", ui.Subtle("Note:"))
+		fmt.Printf("%s Run 'tse %s instances' to see when it reports ready, then 'tse %s verify' to check where websites place you.\n", ui.Subtle("Tip:"), region, region)
+		if len(opts.routes) > 0 {
+			fmt.Printf("%s Routes stay pending in the admin console unless your ACL auto-approves them for tag:exitnode ('tse setup --advertise-routes %s').\n", ui.Subtle("Note:"), strings.Join(opts.routes, ","))
+		}
 	}
 
 	return nil
 }
 
-func handleStop(lambdaURL, region string) error {
-	var stopResp types.StopResponse
+// startRegion asks the Lambda to start an exit node in req.Region. A node that's
+// already running isn't an error: alreadyRunning is set and the response only
+// carries the Lambda's message.
+// handleStartDryRun shows the request a start would send and has the Lambda
+// run its checks and list the EC2 calls it would make, without launching
+func handleStartDryRun(ctx context.Context, lambdaURL, region string, opts startOptions) error {
+	req := types.StartRequest{
+		Region:          region,
+		DNS:             opts.dns.Name,
+		AdvertiseRoutes: opts.routes,
+		ClientToken:     "(generated)", // A new one for every start
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
 
-	err := ui.WithSpinner(fmt.Sprintf("Stopping exit nodes in %s", region), func() error {
-		url := fmt.Sprintf("%s/%s/stop", lambdaURL, region)
-		resp, err := makeAuthenticatedRequest("POST", url, bytes.NewReader([]byte("{}")))
-		if err != nil {
-			return err // Already enhanced with context
-		}
-		defer resp.Body.Close()
+	req.ClientToken = ""
+	req.DryRun = true
+	req.Plan = true
+	var startResp *types.StartResponse
+	var alreadyRunning bool
+	err = ui.WithSpinner(fmt.Sprintf("Planning a start in %s", region), func() error {
+		var err error
+		startResp, alreadyRunning, err = startRegion(ctx, lambdaURL, req)
+		return err
+	})
+	if err != nil {
+		return err
+	}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to read response: %w", err)
-		}
+	fmt.Println()
+	fmt.Printf("%s nothing will be started\n\n", ui.Info("Dry run:"))
+	fmt.Println("The CLI would call:")
+	fmt.Printf("  POST %s/%s/start %s\n", lambdaURL, region, body)
+	fmt.Println()
+	if alreadyRunning {
+		fmt.Printf("%s %s, so the Lambda would launch nothing\n", ui.Info("Info:"), startResp.Message)
+		return nil
+	}
+	if len(startResp.Plan) == 0 {
+		fmt.Println(ui.Subtle("This Lambda doesn't list its calls; run 'tse deploy' to update it."))
+		return nil
+	}
+	fmt.Println("The Lambda would call:")
+	for _, call := range startResp.Plan {
+		fmt.Printf("  %s\n", call)
+	}
+	return nil
+}
 
-		if resp.StatusCode != http.StatusOK {
-			return enhanceHTTPStatusError(resp.StatusCode, string(body), fmt.Sprintf("stop exit node in %s", region))
-		}
+func startRegion(ctx context.Context, lambdaURL string, req types.StartRequest) (startResp *types.StartResponse, alreadyRunning bool, err error) {
+	c, err := lambdaClient(lambdaURL)
+	if err != nil {
+		return nil, false, err
+	}
 
-		if err := json.Unmarshal(body, &stopResp); err != nil {
-			return fmt.Errorf("failed to parse response: %w", err)
-		}
+	startResp, err = c.Start(ctx, req)
+	var statusErr *client.StatusError
+	if errors.Is(err, client.ErrAlreadyRunning) && errors.As(err, &statusErr) {
+		return &types.StartResponse{Message: statusErr.Message()}, true, nil
+	}
+	if err != nil {
+		return nil, false, explainLambdaError(err)
+	}
+	return startResp, false, nil
+}
 
-		return nil
+func handleStop(ctx context.Context, lambdaURL, region string) error {
+	var stopResp *types.StopResponse
+
+	err := ui.WithSpinner(fmt.Sprintf("Stopping exit nodes in %s", region), func() error {
+		var err error
+		stopResp, err = stopRegion(ctx, lambdaURL, region)
+		return err
 	})
 
 	if err != nil {
@@ -467,37 +1400,56 @@ func handleStop(lambdaURL, region string) error {
 	fmt.Println()
 	fmt.Printf("%s %s\n", ui.Checkmark(), stopResp.Message)
 	if stopResp.TerminatedCount > 0 {
+		usage.Record(usage.Event{Kind: usage.KindNodeStop, Region: region})
+		emitTerminated(region, stopResp.TerminatedIDs)
 		fmt.Printf("%s %v\n", ui.Label("Terminated instances:"), stopResp.TerminatedIDs)
+		if stopResp.NetworkOutBytes > 0 {
+			fmt.Printf("You used %s\n", dataTransfer(stopResp.NetworkOutBytes, region))
+		}
 	}
 
 	return nil
 }
 
-func handleCleanup(lambdaURL, region string) error {
-	var cleanupResp types.StopResponse // Reuse stop response structure
-
-	err := ui.WithSpinner(fmt.Sprintf("Cleaning up resources in %s", region), func() error {
-		url := fmt.Sprintf("%s/%s/cleanup", lambdaURL, region)
-		resp, err := makeAuthenticatedRequest("POST", url, bytes.NewReader([]byte("{}")))
-		if err != nil {
-			return err // Already enhanced with context
-		}
-		defer resp.Body.Close()
+// emitTerminated reports terminated instances in --json-lines mode
+func emitTerminated(region string, instanceIDs []string) {
+	for _, id := range instanceIDs {
+		ui.Emit(ui.Event{Type: ui.EventInstanceState, Region: region, Instance: id, State: "terminated"})
+	}
+}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to read response: %w", err)
-		}
+// stopRegion terminates the exit nodes in a single region
+func stopRegion(ctx context.Context, lambdaURL, region string) (*types.StopResponse, error) {
+	c, err := lambdaClient(lambdaURL)
+	if err != nil {
+		return nil, err
+	}
+	stopResp, err := c.Stop(ctx, region)
+	if err != nil {
+		return nil, explainLambdaError(err)
+	}
+	return stopResp, nil
+}
 
-		if resp.StatusCode != http.StatusOK {
-			return enhanceHTTPStatusError(resp.StatusCode, string(body), fmt.Sprintf("cleanup resources in %s", region))
-		}
+func handleCleanup(ctx context.Context, lambdaURL, region string, args []string) error {
+	fs := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: tse %s cleanup [--force] [--all-deployments]\n\n", region)
+		fmt.Fprintln(os.Stderr, "  --force             Also delete VPC stacks and security groups created in the last 10 minutes")
+		fmt.Fprintln(os.Stderr, "  --all-deployments   Also clean up other deployments' resources in this AWS account")
+	}
+	force := fs.Bool("force", false, "Also delete recently created VPC stacks and security groups")
+	allDeployments := fs.Bool("all-deployments", false, "Also clean up other deployments' resources")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
 
-		if err := json.Unmarshal(body, &cleanupResp); err != nil {
-			return fmt.Errorf("failed to parse response: %w", err)
-		}
+	var cleanupResp *types.StopResponse // Reuse stop response structure
 
-		return nil
+	err := ui.WithSpinner(fmt.Sprintf("Cleaning up resources in %s", region), func() error {
+		var err error
+		cleanupResp, err = cleanupRegion(ctx, lambdaURL, region, types.CleanupRequest{Force: *force, AllDeployments: *allDeployments})
+		return err
 	})
 
 	if err != nil {
@@ -511,69 +1463,102 @@ func handleCleanup(lambdaURL, region string) error {
 	} else {
 		fmt.Println(ui.Subtle("No orphaned TSE resources found."))
 	}
+	printSkippedResources(cleanupResp.SkippedIDs, fmt.Sprintf("tse %s cleanup --force", region))
 
 	return nil
 }
 
-func handleShutdown(lambdaURL string) error {
-	fmt.Println(ui.Title("Stopping exit nodes in all regions..."))
-	fmt.Println()
+const shutdownUsage = `Usage: tse shutdown [--every-region]
 
-	allRegions := regions.GetAllFriendlyNames()
-	totalTerminated := 0
-	regionsWithInstances := []string{}
+Stop the exit nodes in every region. The Lambda's node registry says which
+regions have nodes, so only those are asked to stop, along with any it
+couldn't list.
 
-	for _, region := range allRegions {
-		var stopResp types.StopResponse
-		var noInstances bool
-
-		err := ui.WithSpinner(fmt.Sprintf("Checking %s", region), func() error {
-			url := fmt.Sprintf("%s/%s/stop", lambdaURL, region)
-			resp, err := makeAuthenticatedRequest("POST", url, bytes.NewReader([]byte("{}")))
-			if err != nil {
-				return fmt.Errorf("failed to contact Lambda: %w", err)
-			}
+Flags:
+  --every-region        Ask every region to stop, without checking which have nodes
+`
 
-			body, err := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			if err != nil {
-				return fmt.Errorf("failed to read response: %w", err)
-			}
+func handleShutdown(ctx context.Context, lambdaURL string, args []string) error {
+	fs := flag.NewFlagSet("shutdown", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, shutdownUsage)
+	}
+	everyRegion := fs.Bool("every-region", false, "Ask every region to stop")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
 
-			if resp.StatusCode != http.StatusOK {
-				// Check if it's a 404 (no instances found) vs actual error
-				if resp.StatusCode == http.StatusNotFound {
-					// No instances in this region, which is expected
-					noInstances = true
-					return nil
-				}
-				// Actual error
-				return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
-			}
+	names := regions.GetAllFriendlyNames()
+	if !*everyRegion {
+		c, err := lambdaClient(lambdaURL)
+		if err != nil {
+			return err
+		}
+		err = ui.WithSpinner("Finding regions with exit nodes", func() error {
+			names = c.OccupiedRegions(ctx)
+			return ctx.Err()
+		})
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			fmt.Println(ui.Subtle("No running exit nodes found in any region."))
+			return nil
+		}
+	}
+	return stopIn(ctx, lambdaURL, "Stopping exit nodes in all regions...", names)
+}
 
-			if err := json.Unmarshal(body, &stopResp); err != nil {
-				return fmt.Errorf("failed to parse response: %w", err)
-			}
+// stopIn terminates the exit nodes in the named regions
+func stopIn(ctx context.Context, lambdaURL, title string, names []string) error {
+	_, err := stopRegions(ctx, lambdaURL, title, names)
+	return err
+}
 
-			return nil
-		})
+// stopRegions is stopIn, also returning the regions it couldn't reach
+func stopRegions(ctx context.Context, lambdaURL, title string, names []string) ([]string, error) {
+	var mu sync.Mutex
+	totalTerminated := 0
+	regionsWithInstances := 0
+	var totalSent int64
+	var totalCost float64
 
+	results := ui.FanOut(title, names, func(region string) (string, error) {
+		stopResp, err := stopRegion(ctx, lambdaURL, region)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s %s: %v\n", ui.Warning("Warning:"), region, err)
-			continue
+			return "", err
 		}
-
-		if noInstances {
-			continue
+		if stopResp.TerminatedCount == 0 {
+			return "none running", nil
 		}
 
-		if stopResp.TerminatedCount > 0 {
-			totalTerminated += stopResp.TerminatedCount
-			regionsWithInstances = append(regionsWithInstances, region)
+		usage.Record(usage.Event{Kind: usage.KindNodeStop, Region: region})
+		emitTerminated(region, stopResp.TerminatedIDs)
+
+		cost, _ := egressCost(stopResp.NetworkOutBytes, region)
+		mu.Lock()
+		totalTerminated += stopResp.TerminatedCount
+		regionsWithInstances++
+		totalSent += stopResp.NetworkOutBytes
+		totalCost += cost
+		mu.Unlock()
+
+		if stopResp.NetworkOutBytes > 0 {
+			return fmt.Sprintf("terminated %d instance(s), %s sent", stopResp.TerminatedCount, formatBytes(stopResp.NetworkOutBytes)), nil
 		}
-	}
+		return fmt.Sprintf("terminated %d instance(s)", stopResp.TerminatedCount), nil
+	})
 
 	fmt.Println()
+	printFanOutFailures(results)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
 	if totalTerminated == 0 {
 		fmt.Println(ui.Subtle("No running exit nodes found in any region."))
 	} else {
@@ -581,8 +1566,11 @@ func handleShutdown(lambdaURL string) error {
 			ui.Checkmark(),
 			ui.Success("Shutdown complete:"),
 			ui.Bold(fmt.Sprintf("%d", totalTerminated)),
-			ui.Bold(fmt.Sprintf("%d", len(regionsWithInstances))))
+			ui.Bold(fmt.Sprintf("%d", regionsWithInstances)))
+		if totalSent > 0 {
+			fmt.Printf("You used %s, %s\n", formatBytes(totalSent), formatUSD(totalCost))
+		}
 	}
 
-	return nil
+	return failedNames(results), nil
 }
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func TestHandleStart(t *testing.T) {
+	started := types.StartResponse{
+		Success:  true,
+		Message:  "Exit node started in ohio",
+		Instance: &types.InstanceInfo{InstanceID: "i-0abc", State: "pending", TailscaleHostname: "exit-ohio", InstanceType: "t4g.nano"},
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		token   string
+		want    string // In the output, or the error when wantErr is set
+		wantErr bool
+	}{
+		{name: "started", handler: reply(http.StatusCreated, started), want: "i-0abc"},
+		{
+			name:    "already running",
+			handler: reply(http.StatusConflict, types.ErrorResponse{Error: "Exit node already running in ohio region", ErrorCode: types.ErrorCodeAlreadyRunning}),
+			want:    "Exit node already running in ohio region",
+		},
+		{
+			name:    "start in progress",
+			handler: reply(http.StatusConflict, types.ErrorResponse{Error: "A start is in progress in ohio", ErrorCode: types.ErrorCodeStartInProgress}),
+			want:    "START_IN_PROGRESS",
+			wantErr: true,
+		},
+		{name: "bad token", handler: reply(http.StatusCreated, started), token: "wrong", want: "HTTP 401 Unauthorized", wantErr: true},
+		{name: "malformed response", handler: replyRaw(http.StatusCreated, "<html>Bad gateway</html>"), want: "failed to parse response", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.token != "" {
+				t.Setenv("TSE_AUTH_TOKEN", tt.token)
+			}
+			lambda := newFakeLambda(t)
+			lambda.on("POST /ohio/start", tt.handler)
+
+			out, err := captureOutput(t, func() error {
+				return handleStart(context.Background(), lambda.URL, "ohio", startOptions{})
+			})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("handleStart() error = %v, want %q", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handleStart() error = %v", err)
+			}
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("output doesn't mention %q:\n%s", tt.want, out)
+			}
+		})
+	}
+}
+
+func TestHandleStartSendsRequest(t *testing.T) {
+	lambda := newFakeLambda(t)
+	lambda.on("POST /ohio/start", reply(http.StatusCreated, types.StartResponse{Success: true, Message: "started"}))
+
+	if _, err := captureOutput(t, func() error {
+		return handleStart(context.Background(), lambda.URL, "ohio", startOptions{routes: []string{"10.0.0.0/16"}})
+	}); err != nil {
+		t.Fatalf("handleStart() error = %v", err)
+	}
+
+	requests := lambda.received()
+	if len(requests) != 1 {
+		t.Fatalf("requests = %+v, want one start", requests)
+	}
+	var req types.StartRequest
+	if err := json.Unmarshal([]byte(requests[0].Body), &req); err != nil {
+		t.Fatalf("start body %q: %v", requests[0].Body, err)
+	}
+	if req.Region != "ohio" || req.ClientToken == "" || !slices.Equal(req.AdvertiseRoutes, []string{"10.0.0.0/16"}) {
+		t.Errorf("start request = %+v, want ohio with a client token and the routes", req)
+	}
+}
+
+func TestHandleStop(t *testing.T) {
+	t.Run("stopped", func(t *testing.T) {
+		lambda := newFakeLambda(t)
+		lambda.on("POST /ohio/stop", reply(http.StatusOK, types.StopResponse{Success: true, Message: "Stopped 1 instance in ohio", TerminatedIDs: []string{"i-0abc"}, TerminatedCount: 1}))
+
+		out, err := captureOutput(t, func() error { return handleStop(context.Background(), lambda.URL, "ohio") })
+		if err != nil {
+			t.Fatalf("handleStop() error = %v", err)
+		}
+		if !strings.Contains(out, "i-0abc") {
+			t.Errorf("output doesn't list the terminated instance:\n%s", out)
+		}
+	})
+
+	t.Run("bad token", func(t *testing.T) {
+		t.Setenv("TSE_AUTH_TOKEN", "wrong")
+		lambda := newFakeLambda(t)
+		lambda.on("POST /ohio/stop", reply(http.StatusOK, types.StopResponse{Success: true}))
+
+		_, err := captureOutput(t, func() error { return handleStop(context.Background(), lambda.URL, "ohio") })
+		if err == nil || !strings.Contains(err.Error(), "TSE_AUTH_TOKEN") {
+			t.Errorf("handleStop() error = %v, want the token troubleshooting", err)
+		}
+		// A stop might have taken effect, so a 401 isn't retried either
+		if requests := lambda.received(); len(requests) != 1 {
+			t.Errorf("sent %d requests, want 1", len(requests))
+		}
+	})
+
+	t.Run("malformed response", func(t *testing.T) {
+		lambda := newFakeLambda(t)
+		lambda.on("POST /ohio/stop", replyRaw(http.StatusOK, `{"success": tru`))
+
+		_, err := captureOutput(t, func() error { return handleStop(context.Background(), lambda.URL, "ohio") })
+		if err == nil || !strings.Contains(err.Error(), "failed to parse response") {
+			t.Errorf("handleStop() error = %v, want a parse failure", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		lambda := newFakeLambda(t)
+		lambda.on("POST /ohio/stop", hang)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := captureOutput(t, func() error { return handleStop(ctx, lambda.URL, "ohio") })
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("handleStop() error = %v, want the deadline", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("handleStop() took %s to give up", elapsed)
+		}
+	})
+}
+
+func TestHandleRestart(t *testing.T) {
+	t.Run("restarted", func(t *testing.T) {
+		lambda := newFakeLambda(t)
+		lambda.on("POST /ohio/restart", reply(http.StatusCreated, types.RestartResponse{
+			Success: true, Message: "Exit node restarted in ohio region", TerminatedIDs: []string{"i-0old"},
+			Instance: &types.InstanceInfo{InstanceID: "i-0new", State: "pending", InstanceType: "t4g.nano"},
+		}))
+
+		out, err := captureOutput(t, func() error { return handleRestart(context.Background(), lambda.URL, "ohio", startOptions{}) })
+		if err != nil {
+			t.Fatalf("handleRestart() error = %v", err)
+		}
+		if !strings.Contains(out, "i-0old") || !strings.Contains(out, "i-0new") {
+			t.Errorf("output doesn't list the old and new instances:\n%s", out)
+		}
+	})
+
+	t.Run("nothing running", func(t *testing.T) {
+		lambda := newFakeLambda(t)
+		lambda.on("POST /ohio/restart", reply(http.StatusNotFound, types.ErrorResponse{Error: "No exit node to restart in ohio region", ErrorCode: types.ErrorCodeNothingRunning}))
+
+		_, err := captureOutput(t, func() error { return handleRestart(context.Background(), lambda.URL, "ohio", startOptions{}) })
+		if err == nil || !strings.Contains(err.Error(), "tse ohio start") {
+			t.Errorf("handleRestart() error = %v, want a pointer to start", err)
+		}
+	})
+
+	t.Run("old deployment", func(t *testing.T) {
+		lambda := newFakeLambda(t)
+
+		_, err := captureOutput(t, func() error { return handleRestart(context.Background(), lambda.URL, "ohio", startOptions{}) })
+		if err == nil || !strings.Contains(err.Error(), "tse deploy") {
+			t.Errorf("handleRestart() error = %v, want a pointer to deploy", err)
+		}
+	})
+}
+
+func TestRunNetwork(t *testing.T) {
+	lambda := newFakeLambda(t)
+	network := &types.NetworkInfo{VPCID: "vpc-0abc", SubnetID: "subnet-0abc", Region: "us-east-2", FriendlyRegion: "ohio"}
+	lambda.on("GET /ohio/network", reply(http.StatusOK, types.NetworkResponse{Success: true, Network: network}))
+	kept := *network
+	kept.Persistent = true
+	lambda.on("POST /ohio/keep-network", reply(http.StatusOK, types.NetworkResponse{Success: true, Message: "Keeping VPC vpc-0abc in ohio region between sessions", Network: &kept}))
+
+	out, err := captureOutput(t, func() error { return runNetwork(context.Background(), lambda.URL, "ohio", nil) })
+	if err != nil {
+		t.Fatalf("runNetwork(show) error = %v", err)
+	}
+	if !strings.Contains(out, "vpc-0abc") || !strings.Contains(out, "network keep") {
+		t.Errorf("show doesn't list the VPC and how to keep it:\n%s", out)
+	}
+
+	out, err = captureOutput(t, func() error { return runNetwork(context.Background(), lambda.URL, "ohio", []string{"keep"}) })
+	if err != nil || !strings.Contains(out, "Keeping VPC vpc-0abc") {
+		t.Errorf("runNetwork(keep) = %v:\n%s", err, out)
+	}
+
+	// A Lambda from before persistent networking has no release route
+	_, err = captureOutput(t, func() error { return runNetwork(context.Background(), lambda.URL, "ohio", []string{"release"}) })
+	if !errors.Is(err, errNetworkUnsupported) {
+		t.Errorf("runNetwork(release) error = %v, want errNetworkUnsupported", err)
+	}
+}
+
+func TestCreateTokenWithLimits(t *testing.T) {
+	lambda := newFakeLambda(t)
+	token := &types.TokenInfo{ID: "3f9a2c1b7d4e", Name: "partner", Scopes: []string{types.ScopeStart}, TokenLimits: types.TokenLimits{MaxNodes: 1, Regions: []string{"ohio", "frankfurt"}}}
+	lambda.on("POST /tokens", reply(http.StatusCreated, types.CreateTokenResponse{Success: true, Secret: "tse_secret", Token: token}))
+
+	out, err := captureOutput(t, func() error {
+		return createToken(context.Background(), lambda.URL, []string{"partner", "--scopes", "start", "--max-nodes", "1", "--regions", "Ohio, frankfurt"})
+	})
+	if err != nil {
+		t.Fatalf("createToken() error = %v", err)
+	}
+	if !strings.Contains(out, "1 node; ohio, frankfurt") {
+		t.Errorf("created token doesn't show its limits:\n%s", out)
+	}
+
+	var sent types.CreateTokenRequest
+	if err := json.Unmarshal([]byte(lambda.received()[0].Body), &sent); err != nil {
+		t.Fatalf("request body: %v", err)
+	}
+	if sent.MaxNodes != 1 || !slices.Equal(sent.Regions, []string{"ohio", "frankfurt"}) {
+		t.Errorf("sent limits %+v, want 1 node in ohio and frankfurt", sent.TokenLimits)
+	}
+
+	if _, err := captureOutput(t, func() error {
+		return createToken(context.Background(), lambda.URL, []string{"partner", "--scopes", "start", "--regions", "atlantis"})
+	}); err == nil {
+		t.Error("createToken() accepted an unknown region")
+	}
+}
+
+func TestExplainLambdaErrorTimeout(t *testing.T) {
+	lambda := newFakeLambda(t)
+	lambda.on("POST /ohio/stop", hang)
+
+	// The CLI's own client waits over 5 minutes; one that gives up sooner fails the same way
+	req, _ := http.NewRequest(http.MethodPost, lambda.URL+"/v1/ohio/stop", nil)
+	req.Header.Set("Authorization", "Bearer "+fakeToken)
+	_, err := (&http.Client{Timeout: 100 * time.Millisecond}).Do(req)
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		t.Fatalf("Post() error = %v, want a *url.Error", err)
+	}
+	err = explainLambdaError(err)
+	if !strings.Contains(err.Error(), "request timed out after 5m10s") {
+		t.Errorf("explainLambdaError() = %v, want the action timeout explained", err)
+	}
+}
+
+func TestHandleShutdown(t *testing.T) {
+	lambda := newFakeLambda(t)
+	for _, region := range regions.GetAllFriendlyNames() {
+		lambda.on("POST /"+region+"/stop", reply(http.StatusOK, types.StopResponse{Success: true, Message: "No instances"}))
+	}
+	for _, region := range []string{"ohio", "frankfurt"} {
+		lambda.on("POST /"+region+"/stop", reply(http.StatusOK, types.StopResponse{Success: true, TerminatedIDs: []string{"i-" + region}, TerminatedCount: 1}))
+	}
+
+	out, err := captureOutput(t, func() error { return handleShutdown(context.Background(), lambda.URL, []string{"--every-region"}) })
+	if err != nil {
+		t.Fatalf("handleShutdown() error = %v", err)
+	}
+	if !strings.Contains(out, "instance(s) across") || !strings.Contains(out, "2") {
+		t.Errorf("output doesn't total the stopped instances:\n%s", out)
+	}
+	if got, want := len(lambda.received()), len(regions.GetAllFriendlyNames()); got != want {
+		t.Errorf("sent %d stops, want one per region (%d)", got, want)
+	}
+}
+
+func TestHandleShutdownStopsOccupiedRegions(t *testing.T) {
+	lambda := newFakeLambda(t)
+	lambda.on("GET /instances", reply(http.StatusOK, types.InstancesResponse{
+		Success:   true,
+		Instances: []*types.InstanceInfo{{InstanceID: "i-ohio", FriendlyRegion: "ohio"}},
+		Regions:   []string{"ohio"},
+	}))
+	lambda.on("POST /ohio/stop", reply(http.StatusOK, types.StopResponse{Success: true, TerminatedIDs: []string{"i-ohio"}, TerminatedCount: 1}))
+
+	if _, err := captureOutput(t, func() error { return handleShutdown(context.Background(), lambda.URL, nil) }); err != nil {
+		t.Fatalf("handleShutdown() error = %v", err)
+	}
+	var routes []string
+	for _, request := range lambda.received() {
+		routes = append(routes, request.Route)
+	}
+	if want := []string{"GET /instances", "POST /ohio/stop"}; !slices.Equal(routes, want) {
+		t.Errorf("requests = %v, want %v", routes, want)
+	}
+}
+
+func TestFetchAllNodes(t *testing.T) {
+	lambda := newFakeLambda(t)
+	lambda.on("GET /instances", reply(http.StatusOK, types.InstancesResponse{
+		Success: true,
+		Instances: []*types.InstanceInfo{
+			{InstanceID: "i-tokyo", FriendlyRegion: "tokyo"},
+			{InstanceID: "i-ohio", FriendlyRegion: "ohio"},
+		},
+		Regions: []string{"ohio", "tokyo"},
+	}))
+
+	var nodes []*types.InstanceInfo
+	_, err := captureOutput(t, func() error {
+		var err error
+		nodes, err = fetchAllNodes(context.Background(), lambda.URL, false)
+		return err
+	})
+	if err != nil || len(nodes) != 2 || nodes[0].InstanceID != "i-ohio" {
+		t.Errorf("fetchAllNodes() = %v, %v; want both nodes, ohio first", nodes, err)
+	}
+	if got := len(lambda.received()); got != 1 {
+		t.Errorf("sent %d requests, want one", got)
+	}
+
+	// A Lambda without the route is asked region by region
+	old := newFakeLambda(t)
+	old.on("GET /ohio/instances", reply(http.StatusOK, types.InstancesResponse{Success: true, Count: 1, Instances: []*types.InstanceInfo{{InstanceID: "i-ohio"}}}))
+	_, err = captureOutput(t, func() error {
+		var err error
+		nodes, err = fetchAllNodes(context.Background(), old.URL, false)
+		return err
+	})
+	if err != nil || len(nodes) != 1 || nodes[0].FriendlyRegion != "ohio" {
+		t.Errorf("fetchAllNodes() from an older Lambda = %v, %v; want ohio's node", nodes, err)
+	}
+}
+
+func TestStopRegionsReportsFailures(t *testing.T) {
+	t.Setenv("TSE_AUTH_TOKEN", "wrong")
+	lambda := newFakeLambda(t)
+
+	names := []string{"ohio", "tokyo"}
+	var failed []string
+	_, err := captureOutput(t, func() error {
+		var err error
+		failed, err = stopRegions(context.Background(), lambda.URL, "Stopping", names)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("stopRegions() error = %v", err)
+	}
+	if !slices.Equal(failed, names) {
+		t.Errorf("failed regions = %v, want %v", failed, names)
+	}
+}
+
+func TestHandleCleanup(t *testing.T) {
+	lambda := newFakeLambda(t)
+	lambda.on("POST /ohio/cleanup", reply(http.StatusOK, types.StopResponse{
+		Success:         true,
+		Message:         "Cleaned up 2 resources in ohio",
+		TerminatedIDs:   []string{"Instance:i-1", "VPC:vpc-1"},
+		TerminatedCount: 2,
+		SkippedIDs:      []string{"SecurityGroup:sg-1"},
+	}))
+
+	out, err := captureOutput(t, func() error {
+		return handleCleanup(context.Background(), lambda.URL, "ohio", []string{"--force"})
+	})
+	if err != nil {
+		t.Fatalf("handleCleanup() error = %v", err)
+	}
+	if !strings.Contains(out, "vpc-1") || !strings.Contains(out, "1 SecurityGroup") {
+		t.Errorf("output doesn't list cleaned and skipped resources:\n%s", out)
+	}
+
+	var req types.CleanupRequest
+	if err := json.Unmarshal([]byte(lambda.received()[0].Body), &req); err != nil || !req.Force {
+		t.Errorf("cleanup request = %+v (%v), want force", req, err)
+	}
+
+	lambda.on("POST /ohio/cleanup", replyRaw(http.StatusOK, "Internal Server Error"))
+	_, err = captureOutput(t, func() error { return handleCleanup(context.Background(), lambda.URL, "ohio", nil) })
+	if err == nil || !strings.Contains(err.Error(), "failed to parse response") {
+		t.Errorf("handleCleanup() error = %v, want a parse failure", err)
+	}
+}
+
+func TestCleanupRegionPollsJob(t *testing.T) {
+	lambda := newFakeLambda(t)
+	lambda.on("POST /ohio/cleanup", reply(http.StatusAccepted, types.JobResponse{
+		Success: true,
+		Job:     &types.JobInfo{ID: "job-1", Kind: "cleanup", Region: "ohio", Status: types.JobRunning},
+	}))
+	lambda.on("GET /jobs/job-1", reply(http.StatusOK, types.JobResponse{
+		Success: true,
+		Job:     &types.JobInfo{ID: "job-1", Status: types.JobSucceeded, Result: json.RawMessage(`{"message":"Cleaned up","terminated_count":1,"terminated_ids":["VPC:vpc-1"]}`)},
+	}))
+
+	cleanupResp, err := cleanupRegion(context.Background(), lambda.URL, "ohio", types.CleanupRequest{Force: true})
+	if err != nil {
+		t.Fatalf("cleanupRegion() error = %v", err)
+	}
+	if cleanupResp.TerminatedCount != 1 || cleanupResp.TerminatedIDs[0] != "VPC:vpc-1" {
+		t.Errorf("cleanupRegion() = %+v, want the job's result", cleanupResp)
+	}
+	var req types.CleanupRequest
+	if err := json.Unmarshal([]byte(lambda.received()[0].Body), &req); err != nil || !req.Async || !req.Force {
+		t.Errorf("cleanup request = %+v (%v), want an async forced cleanup", req, err)
+	}
+
+	lambda.on("GET /jobs/job-1", reply(http.StatusOK, types.JobResponse{
+		Job: &types.JobInfo{ID: "job-1", Status: types.JobFailed, Error: "DependencyViolation: vpc-1 has dependencies"},
+	}))
+	if _, err := cleanupRegion(context.Background(), lambda.URL, "ohio", types.CleanupRequest{}); err == nil || !strings.Contains(err.Error(), "DependencyViolation") {
+		t.Errorf("cleanupRegion(failed job) error = %v, want the job's error", err)
+	}
+}
+
+func TestCleanupRegionWithoutStateTable(t *testing.T) {
+	lambda := newFakeLambda(t)
+	lambda.on("POST /ohio/cleanup", func(w http.ResponseWriter, r *http.Request) {
+		// The fake has read the body already
+		received := lambda.received()
+		var req types.CleanupRequest
+		json.Unmarshal([]byte(received[len(received)-1].Body), &req)
+		if req.Async {
+			writeJSON(w, http.StatusNotImplemented, types.ErrorResponse{Error: "Async jobs require the state table", ErrorCode: types.ErrorCodeStateTableMissing})
+			return
+		}
+		writeJSON(w, http.StatusOK, types.StopResponse{Message: "Cleaned up", TerminatedCount: 1, TerminatedIDs: []string{"Instance:i-1"}})
+	})
+
+	cleanupResp, err := cleanupRegion(context.Background(), lambda.URL, "ohio", types.CleanupRequest{})
+	if err != nil || cleanupResp.TerminatedCount != 1 {
+		t.Fatalf("cleanupRegion() = %+v, %v; want the synchronous cleanup", cleanupResp, err)
+	}
+	if n := len(lambda.received()); n != 2 {
+		t.Errorf("sent %d requests, want the async one and then a synchronous one", n)
+	}
+}
+
+func TestHandleInstancesWarnsOfAnomalies(t *testing.T) {
+	lambda := newFakeLambda(t)
+	lambda.on("GET /ohio/instances", reply(http.StatusOK, types.InstancesResponse{
+		Success:   true,
+		Instances: []*types.InstanceInfo{{InstanceID: "i-odd", State: "running", InstanceType: "m7g.16xlarge"}},
+		Count:     1,
+		Anomalies: []types.Anomaly{{InstanceID: "i-odd", Resource: "i-odd", Check: "instance-type", Detail: "instance type m7g.16xlarge isn't one tse launches"}},
+	}))
+
+	out, err := captureOutput(t, func() error { return handleInstances(context.Background(), lambda.URL, "ohio", "") })
+	if err != nil {
+		t.Fatalf("handleInstances() error = %v", err)
+	}
+	if !strings.Contains(out, "Unexpected Exit Nodes") || !strings.Contains(out, "m7g.16xlarge isn't one tse launches") {
+		t.Errorf("output doesn't warn about the anomaly:\n%s", out)
+	}
+}
+
+func TestHandleInstancesOutput(t *testing.T) {
+	lambda := newFakeLambda(t)
+	lambda.on("GET /ohio/instances", reply(http.StatusOK, types.InstancesResponse{
+		Success:   true,
+		Instances: []*types.InstanceInfo{{InstanceID: "i-1", State: "stopped", InstanceType: "t4g.nano"}},
+		Count:     1,
+		Anomalies: []types.Anomaly{{InstanceID: "i-1", Resource: "i-1", Check: "instance-type", Detail: "odd"}},
+	}))
+
+	// Only the nodes reach stdout; the spinner and the anomaly warning don't
+	out, err := captureStdout(t, func() error { return handleInstances(context.Background(), lambda.URL, "ohio", outputCompact) })
+	if err != nil {
+		t.Fatalf("handleInstances(compact) error = %v", err)
+	}
+	if out != "ohio: stopped\n" {
+		t.Errorf("compact output = %q, want one line for the node", out)
+	}
+
+	out, err = captureStdout(t, func() error { return handleInstances(context.Background(), lambda.URL, "ohio", outputJSON) })
+	if err != nil {
+		t.Fatalf("handleInstances(json) error = %v", err)
+	}
+	var listed []types.InstanceInfo
+	if err := json.Unmarshal([]byte(out), &listed); err != nil || len(listed) != 1 || listed[0].FriendlyRegion != "ohio" {
+		t.Errorf("json output = %q (%v), want the node with its region", out, err)
+	}
+}
+
+func TestNodeRunning(t *testing.T) {
+	lambda := newFakeLambda(t)
+	list := func(states ...string) http.HandlerFunc {
+		var instances []*types.InstanceInfo
+		for _, state := range states {
+			instances = append(instances, &types.InstanceInfo{InstanceID: "i-" + state, State: state})
+		}
+		return reply(http.StatusOK, types.InstancesResponse{Success: true, Instances: instances, Count: len(instances)})
+	}
+	lambda.on("GET /ohio/instances", list("running"))
+	lambda.on("GET /paris/instances", list("stopped", "pending"))
+	lambda.on("GET /tokyo/instances", list())
+	lambda.on("GET /sydney/instances", reply(http.StatusForbidden, types.ErrorResponse{Error: "Forbidden", Code: http.StatusForbidden}))
+
+	tests := []struct {
+		regions []string
+		want    bool
+		wantErr bool
+	}{
+		{regions: []string{"ohio"}, want: true},
+		{regions: []string{"paris"}, want: false}, // Paused and starting nodes aren't running
+		{regions: []string{"tokyo", "paris"}, want: false},
+		{regions: []string{"sydney", "ohio"}, want: true}, // A failed region doesn't matter once a node is found
+		{regions: []string{"sydney", "tokyo"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := nodeRunning(context.Background(), lambda.URL, tt.regions, false)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("nodeRunning(%v) = %v, %v; want %v, error %v", tt.regions, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
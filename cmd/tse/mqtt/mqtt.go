@@ -0,0 +1,422 @@
+// Package mqtt is a minimal MQTT 3.1.1 client for `tse ha-bridge`: QoS 0
+// publish and subscribe, retained messages, a last will, and keepalives. That's
+// all Home Assistant's MQTT discovery needs, so tse doesn't depend on a full
+// client library.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Packet types (the high nibble of the fixed header)
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetSubscribe  = 8
+	packetSuback     = 9
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+// maxRemainingBytes is the largest packet body the 4-byte length encoding holds
+const maxRemainingBytes = 268435455
+
+// maxReadBytes is the largest packet body the client accepts from the broker.
+// Home Assistant's commands are a few bytes; a length anywhere near
+// maxRemainingBytes means a broken or hostile broker, and isn't allocated.
+const maxReadBytes = 4 << 20
+
+// DefaultKeepAlive is how often the client proves it's alive when Options
+// doesn't say
+const DefaultKeepAlive = 30 * time.Second
+
+// Message is an application message, received or to publish
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Options configure a connection
+type Options struct {
+	// Broker is tcp://host:port (default port 1883) or mqtts://host:port (TLS,
+	// default port 8883)
+	Broker    string
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+	// Will is published by the broker if the connection drops without a
+	// DISCONNECT, e.g. an "offline" availability message
+	Will *Message
+}
+
+// Client is a connection to a broker. Received messages arrive on Messages
+// until the connection ends; Done is closed then, and Err says why.
+type Client struct {
+	conn      net.Conn
+	keepAlive time.Duration
+
+	writeMu  sync.Mutex
+	messages chan Message
+	done     chan struct{}
+	err      error
+	once     sync.Once
+	nextID   uint16
+}
+
+// Dial connects to the broker and waits for it to accept the session
+func Dial(ctx context.Context, opts Options) (*Client, error) {
+	address, useTLS, err := brokerAddress(opts.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if useTLS {
+		host, _, _ := net.SplitHostPort(address)
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+
+	c, err := newClient(conn, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// newClient runs the CONNECT handshake over an established connection
+func newClient(conn net.Conn, opts Options) (*Client, error) {
+	keepAlive := opts.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = DefaultKeepAlive
+	}
+
+	c := &Client{
+		conn:      conn,
+		keepAlive: keepAlive,
+		messages:  make(chan Message, 16),
+		done:      make(chan struct{}),
+	}
+
+	if err := c.write(packetConnect<<4, connectBody(opts, keepAlive)); err != nil {
+		return nil, fmt.Errorf("failed to send MQTT connect: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	header, body, err := readPacket(reader)
+	if err != nil {
+		return nil, fmt.Errorf("no answer from MQTT broker: %w", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+	if header>>4 != packetConnack || len(body) != 2 {
+		return nil, fmt.Errorf("unexpected MQTT packet %d instead of CONNACK", header>>4)
+	}
+	if code := body[1]; code != 0 {
+		return nil, fmt.Errorf("MQTT broker refused the connection: %s", connackReason(code))
+	}
+
+	go c.readLoop(reader)
+	go c.pingLoop()
+	return c, nil
+}
+
+// brokerAddress turns a broker URL into host:port, and reports whether it uses TLS
+func brokerAddress(broker string) (string, bool, error) {
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return "", false, fmt.Errorf("invalid MQTT broker %q (want tcp://host:1883 or mqtts://host:8883)", broker)
+	}
+
+	var useTLS bool
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "mqtts", "ssl", "tls":
+		useTLS, port = true, "8883"
+	default:
+		return "", false, fmt.Errorf("invalid MQTT broker %q: unknown scheme %q", broker, u.Scheme)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port), useTLS, nil
+}
+
+// connectBody encodes a CONNECT packet's variable header and payload
+func connectBody(opts Options, keepAlive time.Duration) []byte {
+	flags := byte(0x02) // Clean session
+	if opts.Will != nil {
+		flags |= 0x04
+		if opts.Will.Retain {
+			flags |= 0x20
+		}
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags) // Protocol level 4 is MQTT 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(min(keepAlive/time.Second, 65535)))
+	body = appendString(body, opts.ClientID)
+	if opts.Will != nil {
+		body = appendString(body, opts.Will.Topic)
+		body = appendString(body, string(opts.Will.Payload))
+	}
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+		if opts.Password != "" {
+			body = appendString(body, opts.Password)
+		}
+	}
+	return body
+}
+
+// connackReason describes a CONNACK return code
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client ID rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad username or password"
+	case 5:
+		return "not authorized"
+	default:
+		return fmt.Sprintf("return code %d", code)
+	}
+}
+
+// Publish sends a QoS 0 message
+func (c *Client) Publish(msg Message) error {
+	header := byte(packetPublish << 4)
+	if msg.Retain {
+		header |= 0x01
+	}
+	return c.write(header, append(appendString(nil, msg.Topic), msg.Payload...))
+}
+
+// Subscribe asks for messages matching a topic filter (wildcards + and #) at
+// QoS 0. The broker's acknowledgement is checked in the background; a refusal
+// ends the connection.
+func (c *Client) Subscribe(filter string) error {
+	c.writeMu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1 // Packet IDs must be non-zero
+	}
+	id := c.nextID
+	c.writeMu.Unlock()
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, filter)
+	body = append(body, 0) // Requested QoS
+	return c.write(packetSubscribe<<4|0x02, body)
+}
+
+// Messages delivers the messages received for the subscriptions
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+// Done is closed when the connection ends
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended, once Done is closed
+func (c *Client) Err() error {
+	<-c.done
+	return c.err
+}
+
+// Close disconnects cleanly, so the broker doesn't publish the will
+func (c *Client) Close() error {
+	err := c.write(packetDisconnect<<4, nil)
+	c.shutdown(errors.New("connection closed"))
+	return err
+}
+
+// shutdown ends the connection once, recording why
+func (c *Client) shutdown(err error) {
+	c.once.Do(func() {
+		c.err = err
+		c.conn.Close()
+		close(c.done)
+	})
+}
+
+// write sends one packet
+func (c *Client) write(header byte, body []byte) error {
+	if len(body) > maxRemainingBytes {
+		return fmt.Errorf("MQTT packet too large (%d bytes)", len(body))
+	}
+	packet := append([]byte{header}, appendLength(nil, len(body))...)
+	packet = append(packet, body...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.keepAlive))
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+// readLoop handles incoming packets until the connection fails. A broker that's
+// silent for 1.5 keepalive periods (it answers every ping) is gone.
+func (c *Client) readLoop(reader *bufio.Reader) {
+	defer close(c.messages)
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		header, body, err := readPacket(reader)
+		if err != nil {
+			c.shutdown(fmt.Errorf("lost MQTT connection: %w", err))
+			return
+		}
+
+		switch header >> 4 {
+		case packetPublish:
+			msg, err := parsePublish(header, body)
+			if err != nil {
+				c.shutdown(err)
+				return
+			}
+			select {
+			case c.messages <- msg:
+			case <-c.done:
+				return
+			}
+		case packetSuback:
+			if len(body) > 2 && body[2] == 0x80 {
+				c.shutdown(errors.New("MQTT broker refused the subscription"))
+				return
+			}
+		case packetPingresp:
+		}
+	}
+}
+
+// pingLoop sends PINGREQ often enough that the broker doesn't drop the client
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.write(packetPingreq<<4, nil); err != nil {
+				c.shutdown(fmt.Errorf("lost MQTT connection: %w", err))
+				return
+			}
+		}
+	}
+}
+
+// parsePublish decodes a PUBLISH packet. Subscriptions are QoS 0, but a broker
+// may still send QoS 1 messages published that way, which carry a packet ID.
+func parsePublish(header byte, body []byte) (Message, error) {
+	topic, rest, err := readString(body)
+	if err != nil {
+		return Message{}, err
+	}
+	if qos := header >> 1 & 0x03; qos > 0 {
+		if len(rest) < 2 {
+			return Message{}, errors.New("truncated MQTT publish")
+		}
+		rest = rest[2:]
+	}
+	return Message{Topic: topic, Payload: rest, Retain: header&0x01 != 0}, nil
+}
+
+// readPacket reads one packet: its first header byte and its body
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("malformed MQTT remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	if length > maxReadBytes {
+		return 0, nil, fmt.Errorf("MQTT packet too large (%d bytes, limit %d)", length, maxReadBytes)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// appendLength appends the variable-length encoding of a remaining length
+func appendLength(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+// appendString appends a length-prefixed UTF-8 string
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// readString reads a length-prefixed string, returning the bytes after it
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("truncated MQTT string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("truncated MQTT string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
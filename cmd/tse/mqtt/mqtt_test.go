@@ -0,0 +1,180 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBroker is the server end of a net.Pipe
+type fakeBroker struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (b *fakeBroker) read() (byte, []byte) {
+	b.t.Helper()
+	b.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	header, body, err := readPacket(b.reader)
+	if err != nil {
+		b.t.Fatalf("broker read: %v", err)
+	}
+	return header, body
+}
+
+func (b *fakeBroker) send(header byte, body []byte) {
+	packet := append([]byte{header}, appendLength(nil, len(body))...)
+	b.conn.Write(append(packet, body...))
+}
+
+// connect starts a client against a fake broker that answers CONNECT with code
+func connect(t *testing.T, opts Options, code byte) (*Client, *fakeBroker, []byte, error) {
+	t.Helper()
+	clientConn, brokerConn := net.Pipe()
+	broker := &fakeBroker{t: t, conn: brokerConn, reader: bufio.NewReader(brokerConn)}
+	t.Cleanup(func() { brokerConn.Close() })
+
+	connectPacket := make(chan []byte, 1)
+	go func() {
+		_, body, err := readPacket(broker.reader)
+		if err != nil {
+			close(connectPacket)
+			return
+		}
+		connectPacket <- body
+		broker.send(packetConnack<<4, []byte{0, code})
+	}()
+
+	c, err := newClient(clientConn, opts)
+	return c, broker, <-connectPacket, err
+}
+
+func TestConnectPublishSubscribe(t *testing.T) {
+	opts := Options{
+		ClientID:  "tse-test",
+		Username:  "ha",
+		Password:  "secret",
+		KeepAlive: time.Minute,
+		Will:      &Message{Topic: "tse/bridge/availability", Payload: []byte("offline"), Retain: true},
+	}
+	c, broker, connectPacket, err := connect(t, opts, 0)
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+	defer c.Close()
+
+	if !bytes.HasPrefix(connectPacket, []byte("\x00\x04MQTT\x04\xe6\x00\x3c")) {
+		t.Errorf("CONNECT header = %q, want MQTT 3.1.1 with user, password, retained will and a 60s keepalive", connectPacket[:10])
+	}
+	for _, field := range []string{"tse-test", "tse/bridge/availability", "offline", "ha", "secret"} {
+		if !bytes.Contains(connectPacket, []byte(field)) {
+			t.Errorf("CONNECT missing %q", field)
+		}
+	}
+
+	go c.Publish(Message{Topic: "tse/ohio/state", Payload: []byte("ON"), Retain: true})
+	header, body := broker.read()
+	if header != packetPublish<<4|0x01 || !bytes.Equal(body, []byte("\x00\x0etse/ohio/stateON")) {
+		t.Errorf("PUBLISH = %#x %q", header, body)
+	}
+
+	go c.Subscribe("tse/+/set")
+	header, body = broker.read()
+	if header != packetSubscribe<<4|0x02 || !bytes.Equal(body, []byte("\x00\x01\x00\x09tse/+/set\x00")) {
+		t.Errorf("SUBSCRIBE = %#x %q", header, body)
+	}
+	broker.send(packetSuback<<4, []byte{0, 1, 0})
+
+	// A QoS 1 message carries a packet ID before the payload
+	broker.send(packetPublish<<4|0x02, []byte("\x00\x0ctse/ohio/set\x00\x07OFF"))
+	select {
+	case msg := <-c.Messages():
+		if msg.Topic != "tse/ohio/set" || string(msg.Payload) != "OFF" {
+			t.Errorf("message = %q %q, want tse/ohio/set OFF", msg.Topic, msg.Payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message delivered")
+	}
+
+	go c.Close()
+	if header, _ := broker.read(); header != packetDisconnect<<4 {
+		t.Errorf("Close sent %#x, want DISCONNECT", header)
+	}
+}
+
+func TestConnectRefused(t *testing.T) {
+	_, _, _, err := connect(t, Options{ClientID: "tse-test"}, 4)
+	if err == nil || !strings.Contains(err.Error(), "bad username or password") {
+		t.Errorf("newClient() error = %v, want the refusal reason", err)
+	}
+}
+
+func TestConnectionLost(t *testing.T) {
+	c, broker, _, err := connect(t, Options{ClientID: "tse-test"}, 0)
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+	broker.conn.Close()
+
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done not closed after the broker went away")
+	}
+	if err := c.Err(); err == nil || !strings.Contains(err.Error(), "lost MQTT connection") {
+		t.Errorf("Err() = %v", err)
+	}
+	if _, open := <-c.Messages(); open {
+		t.Error("Messages still open")
+	}
+}
+
+func TestRemainingLength(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 2097151} {
+		packet := appendLength([]byte{packetPingresp << 4}, n)
+		packet = append(packet, make([]byte, n)...)
+		header, body, err := readPacket(bufio.NewReader(bytes.NewReader(packet)))
+		if err != nil || header != packetPingresp<<4 || len(body) != n {
+			t.Errorf("length %d: got %d bytes, %v", n, len(body), err)
+		}
+	}
+	if got := appendLength(nil, maxRemainingBytes); !bytes.Equal(got, []byte{0xff, 0xff, 0xff, 0x7f}) {
+		t.Errorf("appendLength(max) = %#v", got)
+	}
+}
+
+func TestReadPacketRejectsOversizedLength(t *testing.T) {
+	// A length just past the limit, with no body behind it: refused before the
+	// body is allocated or read
+	for _, n := range []int{maxReadBytes + 1, maxRemainingBytes} {
+		packet := appendLength([]byte{packetPublish << 4}, n)
+		if _, _, err := readPacket(bufio.NewReader(bytes.NewReader(packet))); err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("length %d: err = %v, want too large", n, err)
+		}
+	}
+}
+
+func TestBrokerAddress(t *testing.T) {
+	tests := []struct {
+		broker  string
+		address string
+		tls     bool
+		wantErr bool
+	}{
+		{broker: "tcp://homeassistant.local", address: "homeassistant.local:1883"},
+		{broker: "mqtt://10.0.0.5:1884", address: "10.0.0.5:1884"},
+		{broker: "mqtts://broker.example.com", address: "broker.example.com:8883", tls: true},
+		{broker: "homeassistant.local:1883", wantErr: true},
+		{broker: "http://broker", wantErr: true},
+	}
+	for _, tt := range tests {
+		address, useTLS, err := brokerAddress(tt.broker)
+		if (err != nil) != tt.wantErr || address != tt.address || useTLS != tt.tls {
+			t.Errorf("brokerAddress(%q) = %q, %v, %v", tt.broker, address, useTLS, err)
+		}
+	}
+}
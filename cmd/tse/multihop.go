@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdh"
+	cryptorand "crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/cmd/tse/usage"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const multihopUsage = `Usage: tse multihop <entry-region> <exit-region>
+
+Experimental: starts exit nodes in two regions and chains them. You connect to
+the node in <entry-region> over Tailscale; it sends your traffic on through a
+WireGuard tunnel to the node in <exit-region>, so websites see the exit
+region's IP. If the tunnel goes down, the entry node drops traffic rather than
+sending it out of its own region.
+
+DNS lookups are still answered from the entry region. Stop the pair with
+'tse <entry-region> stop' and 'tse <exit-region> stop'.
+
+Example:
+  tse multihop frankfurt ohio   # Connect in Frankfurt, appear in Ohio
+`
+
+// hopIPTimeout is how long to wait for the exit node's public IP, which the
+// entry node needs as its tunnel endpoint
+const (
+	hopIPTimeout  = 90 * time.Second
+	hopIPInterval = 3 * time.Second
+)
+
+// hopKeys is a WireGuard key pair, base64-encoded as wg expects
+type hopKeys struct {
+	private, public string
+}
+
+// newHopKeys generates a WireGuard (X25519) key pair
+func newHopKeys() (hopKeys, error) {
+	key, err := ecdh.X25519().GenerateKey(cryptorand.Reader)
+	if err != nil {
+		return hopKeys{}, fmt.Errorf("failed to generate tunnel keys: %w", err)
+	}
+	return hopKeys{
+		private: base64.StdEncoding.EncodeToString(key.Bytes()),
+		public:  base64.StdEncoding.EncodeToString(key.PublicKey().Bytes()),
+	}, nil
+}
+
+// runMultihop handles 'tse multihop <entry-region> <exit-region>'
+func runMultihop(ctx context.Context, lambdaURL string, args []string) error {
+	if len(args) != 2 {
+		fmt.Fprint(os.Stderr, multihopUsage)
+		return fmt.Errorf("multihop needs an entry region and an exit region")
+	}
+	entry, err := regions.Resolve(args[0])
+	if err != nil {
+		return err
+	}
+	exit, err := regions.Resolve(args[1])
+	if err != nil {
+		return err
+	}
+	if entry == exit {
+		return fmt.Errorf("the entry and exit regions must differ")
+	}
+
+	// The CLI makes both key pairs, so the private keys only travel to the
+	// Lambda and the node that uses them
+	entryKeys, err := newHopKeys()
+	if err != nil {
+		return err
+	}
+	exitKeys, err := newHopKeys()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s Multihop is experimental.\n\n", ui.Warning("Note:"))
+
+	// The exit node goes first: the entry node can only be told where the
+	// tunnel ends once the exit node has a public IP
+	exitNode, err := startHopNode(ctx, lambdaURL, exit, &types.HopConfig{
+		Role:          types.HopExit,
+		PeerRegion:    entry,
+		PrivateKey:    exitKeys.private,
+		PeerPublicKey: entryKeys.public,
+	})
+	if err != nil {
+		return err
+	}
+
+	var publicIP string
+	var entryNode *types.InstanceInfo
+	err = ui.WithSpinner(fmt.Sprintf("Waiting for a public IP in %s", exit), func() error {
+		publicIP, err = waitForPublicIP(ctx, lambdaURL, exit, exitNode.InstanceID)
+		return err
+	})
+	if err == nil {
+		entryNode, err = startHopNode(ctx, lambdaURL, entry, &types.HopConfig{
+			Role:          types.HopEntry,
+			PeerRegion:    exit,
+			PrivateKey:    entryKeys.private,
+			PeerPublicKey: exitKeys.public,
+			Endpoint:      net.JoinHostPort(publicIP, strconv.Itoa(types.HopPort)),
+		})
+	}
+	if err != nil {
+		// Half a pair is just an exit node nobody asked for
+		fmt.Fprintf(os.Stderr, "%s stopping the node in %s\n", ui.Warning("Multihop failed:"), exit)
+		stopCtx := context.WithoutCancel(ctx)
+		if stopResp, stopErr := stopRegion(stopCtx, lambdaURL, exit); stopErr != nil {
+			fmt.Fprintf(os.Stderr, "%s %v; run 'tse %s stop'\n", ui.Warning("Warning:"), stopErr, exit)
+		} else {
+			emitTerminated(exit, stopResp.TerminatedIDs)
+		}
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("%s Chained %s through %s\n", ui.Checkmark(), ui.Highlight(entry), ui.Highlight(exit))
+	fmt.Printf("%s %s\n", ui.Label("Use exit node:"), ui.Highlight(entryNode.TailscaleHostname))
+	fmt.Printf("%s %s (%s)\n", ui.Label("Websites see:"), publicIP, exit)
+	fmt.Printf("\n%s It may take 2-3 minutes for the tunnel to come up; 'tse %s instances' shows the entry node ready once it has.\n", ui.Subtle("Note:"), entry)
+	fmt.Printf("%s DNS lookups are answered from %s.\n", ui.Subtle("Note:"), entry)
+	fmt.Printf("%s Stop both with 'tse %s stop' and 'tse %s stop'.\n", ui.Subtle("Tip:"), entry, exit)
+	return nil
+}
+
+// startHopNode starts one node of a multihop pair. The region must have no
+// node running, since an existing one wouldn't be part of the tunnel.
+func startHopNode(ctx context.Context, lambdaURL, region string, hop *types.HopConfig) (*types.InstanceInfo, error) {
+	var startResp *types.StartResponse
+	var alreadyRunning bool
+
+	err := ui.WithSpinner(fmt.Sprintf("Starting %s node in %s", hop.Role, region), func() error {
+		var err error
+		startResp, alreadyRunning, err = startRegion(ctx, lambdaURL, types.StartRequest{Region: region, Hop: hop})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if alreadyRunning {
+		return nil, fmt.Errorf("%s; stop it with 'tse %s stop' first", startResp.Message, region)
+	}
+	if startResp.Instance == nil {
+		return nil, fmt.Errorf("start in %s returned no instance", region)
+	}
+
+	usage.Record(usage.Event{Kind: usage.KindNodeStart, Region: region})
+	ui.Emit(ui.Event{Type: ui.EventInstanceState, Region: region, Instance: startResp.Instance.InstanceID, State: startResp.Instance.State})
+	return startResp.Instance, nil
+}
+
+// waitForPublicIP polls a region's instances until instanceID has a public IP
+func waitForPublicIP(ctx context.Context, lambdaURL, region, instanceID string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, hopIPTimeout)
+	defer cancel()
+
+	for {
+		instancesResp, err := listRegionInstances(ctx, lambdaURL, region)
+		if err != nil && ctx.Err() == nil {
+			return "", err
+		}
+		if err == nil {
+			for _, instance := range instancesResp.Instances {
+				if instance.InstanceID == instanceID && instance.PublicIP != "" {
+					return instance.PublicIP, nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return "", fmt.Errorf("%s had no public IP after %s", instanceID, hopIPTimeout)
+			}
+			return "", ctx.Err()
+		case <-time.After(hopIPInterval):
+		}
+	}
+}
+
+// hopDescription describes a node's multihop tag ("entry:frankfurt") for listings
+func hopDescription(tag string) string {
+	role, peer, _ := strings.Cut(tag, ":")
+	switch role {
+	case types.HopEntry:
+		return "entry, exits through " + peer
+	case types.HopExit:
+		return "exit for " + peer
+	default:
+		return tag
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const networkUsage = `Usage: tse <region> network [show|keep|release]
+
+Keep a region's VPC between sessions, or stop keeping it
+
+Normally 'tse <region> stop' removes the region's VPC, subnet, internet gateway
+and security group along with the node, and the next start builds them again.
+For a region you use daily, keeping them makes starts quicker. They cost
+nothing while no node is running.
+
+'tse <region> cleanup' and 'tse cleanup --all-regions' remove kept networking too.
+
+Commands:
+  show      Show the region's VPC and whether it's kept (default)
+  keep      Keep the VPC between sessions, building it now if there isn't one
+  release   Stop keeping it; it's removed now, or with the next stop if a
+            node is still running
+
+Examples:
+  tse ohio network
+  tse ohio network keep
+  tse ohio network release
+`
+
+// errNetworkUnsupported means the deployed Lambda predates persistent
+// networking, so it can't be keeping any VPC
+var errNetworkUnsupported = errors.New("this Lambda doesn't support keeping networking; run 'tse deploy' to update it")
+
+func runNetwork(ctx context.Context, lambdaURL, region string, args []string) error {
+	command := "show"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("network", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, networkUsage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+
+	switch command {
+	case "show":
+		return handleShowNetwork(ctx, lambdaURL, region)
+	case "keep":
+		return handleKeepNetwork(ctx, lambdaURL, region)
+	case "release":
+		return handleReleaseNetwork(ctx, lambdaURL, region)
+	default:
+		fmt.Fprint(os.Stderr, networkUsage)
+		return fmt.Errorf("unknown network command %s", ui.Highlight(command))
+	}
+}
+
+func handleShowNetwork(ctx context.Context, lambdaURL, region string) error {
+	var networkResp *types.NetworkResponse
+	err := ui.WithSpinner(fmt.Sprintf("Checking networking in %s", region), func() error {
+		var err error
+		networkResp, err = networkRequest(ctx, lambdaURL, region, "GET", "network")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	network := networkResp.Network
+	if network == nil {
+		fmt.Println(ui.Subtle(fmt.Sprintf("No VPC in %s; the next start builds one.", region)))
+		fmt.Printf("\n%s Run 'tse %s network keep' to build it now and keep it between sessions\n", ui.Info("→"), region)
+		return nil
+	}
+
+	fmt.Println(ui.InfoBox("Networking", networkDetails(network)...))
+	if !network.Persistent {
+		fmt.Printf("\n%s Run 'tse %s network keep' to keep it between sessions\n", ui.Info("→"), region)
+	}
+	return nil
+}
+
+func handleKeepNetwork(ctx context.Context, lambdaURL, region string) error {
+	var networkResp *types.NetworkResponse
+	err := ui.WithSpinner(fmt.Sprintf("Keeping networking in %s", region), func() error {
+		var err error
+		networkResp, err = networkRequest(ctx, lambdaURL, region, "POST", "keep-network")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("%s %s\n", ui.Checkmark(), networkResp.Message)
+	fmt.Printf("\n%s Stops now leave it in place. Remove it with 'tse %s network release'\n", ui.Subtle("Tip:"), region)
+	return nil
+}
+
+func handleReleaseNetwork(ctx context.Context, lambdaURL, region string) error {
+	var networkResp *types.NetworkResponse
+	err := ui.WithSpinner(fmt.Sprintf("Releasing networking in %s", region), func() error {
+		var err error
+		networkResp, err = networkRequest(ctx, lambdaURL, region, "POST", "release-network")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if networkResp.Network == nil {
+		fmt.Println(ui.Subtle(networkResp.Message))
+		return nil
+	}
+	fmt.Printf("%s %s\n", ui.Checkmark(), networkResp.Message)
+	return nil
+}
+
+// networkRequest calls a region's networking route and decodes the response
+func networkRequest(ctx context.Context, lambdaURL, region, method, route string) (*types.NetworkResponse, error) {
+	url := fmt.Sprintf("%s/%s/%s", lambdaURL, region, route)
+	resp, err := makeAuthenticatedRequest(ctx, method, url, nil)
+	if err != nil {
+		return nil, err // Already enhanced with context
+	}
+	defer resp.Body.Close()
+
+	body, err := types.ReadPayload(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNetworkUnsupported
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, enhanceHTTPStatusError(resp.StatusCode, string(body), fmt.Sprintf("manage networking in %s", region))
+	}
+
+	var networkResp types.NetworkResponse
+	if err := json.Unmarshal(body, &networkResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &networkResp, nil
+}
+
+// networkDetails renders a region's VPC stack for an info box
+func networkDetails(network *types.NetworkInfo) []string {
+	kept := "no (the next stop removes it)"
+	if network.Persistent {
+		kept = "yes, between sessions"
+	}
+	details := []string{fmt.Sprintf("VPC     %s", network.VPCID)}
+	if network.SubnetID != "" {
+		details = append(details, fmt.Sprintf("Subnet  %s", network.SubnetID))
+	}
+	return append(details, fmt.Sprintf("Kept    %s", kept))
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/anoldguy/tse/cmd/tse/aclbackup"
+	"github.com/anoldguy/tse/cmd/tse/config"
+	"github.com/anoldguy/tse/cmd/tse/infrastructure"
+	"github.com/anoldguy/tse/cmd/tse/initstate"
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/tailscale"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const nukeUsage = `Usage: tse nuke [flags]
+
+Remove everything tse has set up, in one go:
+  1. Stop exit nodes in every region
+  2. Force-clean orphaned instances, security groups and VPCs in every region
+  3. Tear down the AWS infrastructure (as 'tse teardown')
+  4. Revert tse's Tailscale ACL changes and revoke the auth keys it created
+  5. Remove the nightly shutdown job ('tse install-reaper')
+  6. Delete the config file and any unfinished 'tse init' progress
+
+Nodes and VPCs are gone before the Lambda that manages them, so a region that
+can't be reached stops the run before teardown. The Tailscale step needs
+TAILSCALE_API_TOKEN and the tailnet; without them it's skipped with a note.
+Local config is only removed when every other step succeeded, so a failed run
+can be repeated. ACL backups are kept.
+
+Optional Flags:
+  --yes                 Skip the NUKE confirmation (for scripts and CI)
+  --tailnet string      Tailnet whose ACL and auth keys to clean up
+                        (defaults to the active profile's tailnet, if set)
+
+Examples:
+  tse nuke                       # Asks you to type NUKE first
+  tse nuke --tailnet example.com # Also clean up the Tailscale side
+`
+
+// runNuke removes everything tse created, AWS first, then Tailscale, then local state
+func runNuke(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("nuke", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, nukeUsage)
+	}
+
+	yes := fs.Bool("yes", false, "Skip the NUKE confirmation")
+	tailnet := fs.String("tailnet", os.Getenv(config.EnvTailnet), "Tailnet whose ACL and auth keys to clean up")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+
+	lambdaURL := strings.TrimSuffix(os.Getenv("TSE_LAMBDA_URL"), "/")
+	apiToken := os.Getenv("TAILSCALE_API_TOKEN")
+
+	region, err := infrastructure.GetDefaultRegion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to determine AWS region: %w", err)
+	}
+
+	items := []string{
+		"ALL exit nodes, security groups and VPCs, in every region",
+		fmt.Sprintf("Lambda, IAM roles, log groups and state table (%s)", region),
+		"Capacity reservations in every region",
+	}
+	if lambdaURL == "" {
+		items[0] = "(TSE_LAMBDA_URL isn't set: exit nodes and VPCs can't be reached)"
+	}
+	if apiToken != "" && *tailnet != "" {
+		items = append(items, fmt.Sprintf("tag:exitnode ACL entries and tse's auth keys in %s", *tailnet))
+	} else {
+		items = append(items, "(Tailscale skipped: needs TAILSCALE_API_TOKEN and --tailnet)")
+	}
+	items = append(items, "The nightly shutdown job", "Local config and 'tse init' progress")
+
+	prompt := "Type 'NUKE' to confirm (anything else cancels):"
+	if *yes {
+		prompt = "Confirmed with --yes"
+	}
+	fmt.Println(ui.DangerBox("DANGER - REMOVE EVERYTHING", items, prompt))
+	fmt.Println()
+
+	if !*yes {
+		fmt.Print("→ ")
+		response, err := readLine(ctx, os.Stdin)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(response) != "NUKE" {
+			fmt.Println()
+			fmt.Println(ui.Success("✓ Nuke cancelled - nothing was changed"))
+			return nil
+		}
+		fmt.Println()
+	}
+
+	// Without the Lambda, nothing can reach the nodes and VPCs it launched, so
+	// they have to be gone before teardown deletes it
+	if lambdaURL != "" {
+		fmt.Println(ui.Bold("Step 1/6: Stopping exit nodes"))
+		failed, err := stopRegions(ctx, lambdaURL, "Stopping exit nodes in all regions...", regions.GetAllFriendlyNames())
+		if err != nil {
+			return err
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("couldn't stop exit nodes in %s; nothing else was removed, run 'tse nuke' again", strings.Join(failed, ", "))
+		}
+		fmt.Println()
+
+		fmt.Println(ui.Bold("Step 2/6: Cleaning up VPCs"))
+		if err := nukeOrphans(ctx, lambdaURL); err != nil {
+			return err
+		}
+		fmt.Println()
+	} else {
+		fmt.Println(ui.Subtle("Steps 1-2 skipped: TSE_LAMBDA_URL isn't set, so exit nodes and VPCs weren't checked"))
+		fmt.Println()
+	}
+
+	fmt.Println(ui.Bold("Step 3/6: Tearing down infrastructure"))
+	if err := cancelReservationsForTeardown(ctx, false); err != nil {
+		return err
+	}
+	if err := infrastructure.Teardown(ctx, region, infrastructure.TeardownOptions{}); err != nil {
+		return err
+	}
+	fmt.Println()
+
+	// From here on a failure doesn't block the rest; it only keeps the config
+	// around so the run can be repeated
+	var problems []string
+
+	fmt.Println(ui.Bold("Step 4/6: Reverting Tailscale changes"))
+	if apiToken == "" || *tailnet == "" {
+		fmt.Println(ui.Subtle("Skipped: set TAILSCALE_API_TOKEN and pass --tailnet to revert the ACL and revoke auth keys"))
+	} else if err := nukeTailscale(ctx, apiToken, *tailnet); err != nil {
+		if isInterrupted(err) {
+			return err
+		}
+		fmt.Println(ui.Warning(fmt.Sprintf("⚠️  %v", err)))
+		problems = append(problems, "Tailscale")
+	}
+	fmt.Println()
+
+	fmt.Println(ui.Bold("Step 5/6: Removing the nightly shutdown job"))
+	if err := uninstallReaper(ctx); err != nil {
+		fmt.Println(ui.Warning(fmt.Sprintf("⚠️  %v", err)))
+		problems = append(problems, "nightly shutdown job")
+	}
+	fmt.Println()
+
+	fmt.Println(ui.Bold("Step 6/6: Removing local config"))
+	if len(problems) > 0 {
+		fmt.Println(ui.Subtle("Skipped, so 'tse nuke' can be run again"))
+		fmt.Println()
+		return fmt.Errorf("AWS resources are gone, but removing the %s failed (see above)", strings.Join(problems, " and "))
+	}
+	if err := removeLocalState(); err != nil {
+		return err
+	}
+	fmt.Println()
+
+	fmt.Println(ui.Success("✓ Everything tse set up has been removed"))
+	if dir, err := aclbackup.Dir(); err == nil {
+		if _, err := os.Stat(dir); err == nil {
+			fmt.Println(ui.Subtle(fmt.Sprintf("  ACL backups are still in %s", dir)))
+		}
+	}
+	fmt.Println(ui.Subtle("  TSE_* and TAILSCALE_* variables in your shell or .env are yours to remove"))
+	return nil
+}
+
+// nukeOrphans force-cleans every region, failing if any couldn't be reached
+func nukeOrphans(ctx context.Context, lambdaURL string) error {
+	req := types.CleanupRequest{Force: true}
+	results := ui.FanOut("Cleaning up TSE resources in all regions...", regions.GetAllFriendlyNames(), func(region string) (string, error) {
+		cleanupResp, err := cleanupRegion(ctx, lambdaURL, region, req)
+		if err != nil {
+			return "", err
+		}
+		if cleanupResp.TerminatedCount == 0 {
+			return "nothing to clean up", nil
+		}
+		return formatResourceSummary(types.SummarizeResources(cleanupResp.TerminatedIDs)), nil
+	})
+
+	fmt.Println()
+	printFanOutFailures(results)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failed := failedNames(results); len(failed) > 0 {
+		return fmt.Errorf("couldn't clean up %s; infrastructure was kept, run 'tse nuke' again", strings.Join(failed, ", "))
+	}
+	fmt.Printf("%s %s\n", ui.Checkmark(), ui.Success("No TSE resources left in any region"))
+	return nil
+}
+
+// nukeTailscale reverts what setup added to the ACL, backing the policy up
+// first, and revokes the auth keys setup created
+func nukeTailscale(ctx context.Context, apiToken, tailnet string) error {
+	client, err := tailscale.NewClient(apiToken)
+	if err != nil {
+		return fmt.Errorf("failed to create Tailscale client: %w", err)
+	}
+	client.SetTailnet(tailnet)
+
+	fmt.Print("✓ Fetching current ACL policy...")
+	aclResp, err := client.GetACL(ctx)
+	if err != nil {
+		fmt.Println(" failed")
+		return fmt.Errorf("failed to fetch ACL: %w", err)
+	}
+	fmt.Println(" done")
+
+	changes, modified := tailscale.RemoveExitNodeConfig(aclResp.ACL)
+	for _, change := range changes {
+		if strings.HasPrefix(change, "✓") {
+			fmt.Printf("  %s\n", change)
+		} else {
+			fmt.Printf("✓ %s\n", change)
+		}
+	}
+
+	if !modified {
+		fmt.Println("  ACL has no tse entries - no changes needed")
+	} else {
+		fmt.Print("✓ Validating updated ACL...")
+		if err := client.ValidateACL(ctx, aclResp.ACL); err != nil {
+			fmt.Println(" failed")
+			return fmt.Errorf("ACL validation failed: %w", err)
+		}
+		fmt.Println(" passed")
+
+		fmt.Print("✓ Backing up current ACL...")
+		backupPath, err := backupACL(ctx, client)
+		if err != nil {
+			fmt.Println(" failed")
+			return fmt.Errorf("%w (the ACL was not changed)", err)
+		}
+		fmt.Println(" done")
+
+		fmt.Print("✓ Applying ACL changes...")
+		if err := client.UpdateACL(ctx, aclResp.ACL, aclResp.ETag); err != nil {
+			fmt.Println(" failed")
+			os.Remove(backupPath)
+			var apiErr *tailscale.APIError
+			if errors.As(err, &apiErr) && apiErr.IsConflict() {
+				return fmt.Errorf("ACL was modified by someone else. Please run 'tse nuke' again to retry")
+			}
+			return err
+		}
+		fmt.Println(" done")
+		fmt.Println(ui.Subtle(fmt.Sprintf("  Previous policy saved to %s; undo with 'tse setup --rollback'", backupPath)))
+	}
+
+	fmt.Print("✓ Looking for tse auth keys...")
+	keys, err := client.ListAuthKeys(ctx)
+	if err != nil {
+		fmt.Println(" failed")
+		return err
+	}
+	var ours []string
+	for _, key := range keys {
+		// The list may only carry IDs; fetch the rest to read the description
+		if key.Description == "" {
+			full, err := client.GetAuthKey(ctx, key.ID)
+			if err != nil {
+				fmt.Println(" failed")
+				return err
+			}
+			key = *full
+		}
+		if key.Description == tailscale.ExitNodeAuthKeyDescription {
+			ours = append(ours, key.ID)
+		}
+	}
+	fmt.Println(" done")
+
+	if len(ours) == 0 {
+		fmt.Println("  No auth keys created by tse")
+		return nil
+	}
+	for _, id := range ours {
+		if err := client.DeleteAuthKey(ctx, id); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Revoked auth key %s\n", id)
+	}
+	return nil
+}
+
+// removeLocalState deletes the config file and init progress
+func removeLocalState() error {
+	configPath, err := config.Path()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(configPath); err == nil {
+		fmt.Printf("%s Removed %s\n", ui.Checkmark(), ui.Highlight(configPath))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove %s: %w", configPath, err)
+	}
+
+	progressPath, err := initstate.Path()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(progressPath); err == nil {
+		if err := initstate.Remove(progressPath); err != nil {
+			return err
+		}
+		fmt.Printf("%s Removed %s\n", ui.Checkmark(), ui.Highlight(progressPath))
+	}
+	return nil
+}
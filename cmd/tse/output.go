@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// outputFormat is how instances and status print exit nodes (--output). The
+// empty format is the command's usual view.
+type outputFormat string
+
+const (
+	outputTable   outputFormat = "table"   // Bordered table, one row per node
+	outputCompact outputFormat = "compact" // One plain line per node, for tmux status bars
+	outputWide    outputFormat = "wide"    // The table plus type, AMI, private and IPv6 addresses, and cost
+	outputJSON    outputFormat = "json"    // The nodes as a JSON array
+)
+
+// parseOutputFormat checks an --output value against the formats a command
+// accepts; an empty value is the command's usual view
+func parseOutputFormat(value string, accepted ...outputFormat) (outputFormat, error) {
+	if value == "" {
+		return "", nil
+	}
+	var names []string
+	for _, format := range accepted {
+		if outputFormat(value) == format {
+			return format, nil
+		}
+		names = append(names, string(format))
+	}
+	return "", fmt.Errorf("--output %s isn't one of %s", ui.Highlight(value), strings.Join(names, ", "))
+}
+
+// scripted reports whether the format is read by programs, so progress and
+// warnings belong on stderr
+func (f outputFormat) scripted() bool {
+	return f == outputCompact || f == outputJSON
+}
+
+// instancesOptions are the flags of tse instances and tse <region> instances
+type instancesOptions struct {
+	allDeployments bool
+	output         outputFormat
+	quiet          bool // Print nothing; the exit code says whether a node is running
+}
+
+// parseInstancesFlags parses the instances flags; command is how the usage
+// names it, and --all-deployments is only offered where allDeployments is set
+func parseInstancesFlags(command string, args []string, allDeployments bool) (instancesOptions, error) {
+	fs := flag.NewFlagSet("instances", flag.ExitOnError)
+	fs.Usage = func() {
+		if allDeployments {
+			fmt.Fprintf(os.Stderr, "Usage: %s [--all-deployments] [--output table|compact|wide|json] [--quiet]\n\n", command)
+			fmt.Fprintln(os.Stderr, "  --all-deployments  Include other deployments' nodes in the AWS account")
+		} else {
+			fmt.Fprintf(os.Stderr, "Usage: %s [--output table|compact|wide|json] [--quiet]\n\n", command)
+		}
+		fmt.Fprintln(os.Stderr, "  --output           table, compact (one line per node, for tmux status")
+		fmt.Fprintln(os.Stderr, "                     bars), wide (adds type, AMI, IPs and cost), or json.")
+		fmt.Fprintln(os.Stderr, "                     A single region shows a card per node unless set.")
+		fmt.Fprintln(os.Stderr, "  --quiet            Print nothing; exit 0 if an exit node is running, 1 if")
+		fmt.Fprintln(os.Stderr, "                     none is, 2 if tse couldn't tell")
+	}
+	all := false
+	if allDeployments {
+		fs.BoolVar(&all, "all-deployments", false, "Include other deployments' nodes")
+	}
+	output := fs.String("output", "", "Output format: table, compact, wide or json")
+	quiet := fs.Bool("quiet", false, "Answer whether a node is running with the exit code alone")
+	if err := fs.Parse(args); err != nil {
+		return instancesOptions{}, err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return instancesOptions{}, fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+
+	format, err := parseOutputFormat(*output, outputTable, outputCompact, outputWide, outputJSON)
+	if err != nil {
+		return instancesOptions{}, err
+	}
+	if *quiet && format != "" {
+		return instancesOptions{}, fmt.Errorf("--quiet prints nothing, so it doesn't take --output")
+	}
+	return instancesOptions{allDeployments: all, output: format, quiet: *quiet}, nil
+}
+
+// printNodes writes exit nodes to out in the given format. Nodes must have
+// FriendlyRegion set.
+func printNodes(out io.Writer, format outputFormat, instances []*types.InstanceInfo) error {
+	switch format {
+	case outputJSON:
+		if instances == nil {
+			instances = []*types.InstanceInfo{}
+		}
+		data, err := json.MarshalIndent(instances, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode instances: %w", err)
+		}
+		fmt.Fprintln(out, string(data))
+	case outputCompact:
+		for _, instance := range instances {
+			fmt.Fprintln(out, compactNodeLine(instance, time.Now()))
+		}
+	default:
+		fmt.Fprintln(out, nodeTable(instances, format == outputWide).Render())
+	}
+	return nil
+}
+
+// compactNodeLine describes a node in one line, e.g. "tokyo: running, ready, up 3h 12m"
+func compactNodeLine(instance *types.InstanceInfo, now time.Time) string {
+	line := instance.FriendlyRegion + ": " + instance.State
+	if instance.State == "running" {
+		if instance.Ready {
+			line += ", ready"
+		}
+		line += ", up " + formatSessionDuration(now.Sub(instance.LaunchTime))
+	}
+	return line
+}
+
+// nodeTable lays exit nodes out one row each; wide adds the instance type, AMI,
+// private and tailnet IPv6 addresses, who started it, and estimated cost so far
+func nodeTable(instances []*types.InstanceInfo, wide bool) *ui.Table {
+	headers := []string{"Region", "Instance", "State", "Ready", "Public IP", "Hostname", "Tailnet IP", "Launched", "Data Out"}
+	if wide {
+		headers = []string{"Region", "Instance", "Type", "AMI", "State", "Ready", "Public IP", "Private IP", "Hostname", "Tailnet IP", "Tailnet IPv6", "Launched", "Started By", "Data Out", "Cost"}
+	}
+	table := ui.NewTable(headers...)
+
+	for _, instance := range instances {
+		sent := ui.Subtle("-")
+		if instance.NetworkOutBytes > 0 {
+			sent = formatBytes(instance.NetworkOutBytes)
+		}
+		launched := instance.LaunchTime.Local().Format("2006-01-02 15:04")
+
+		if !wide {
+			table.AddRow(
+				instance.FriendlyRegion,
+				instance.InstanceID,
+				instance.State,
+				readiness(instance),
+				instance.PublicIP,
+				instance.TailscaleHostname,
+				instance.TailscaleIP,
+				launched,
+				sent,
+			)
+			continue
+		}
+
+		cost := ui.Subtle("-")
+		if usd, ok := nodeCost(instance, time.Now()); ok {
+			cost = formatUSD(usd)
+		}
+		startedBy := ui.Subtle("-")
+		if instance.StartedBy != "" {
+			startedBy = instance.StartedBy
+		}
+		table.AddRow(
+			instance.FriendlyRegion,
+			instance.InstanceID,
+			instanceType(instance),
+			instance.ImageID,
+			instance.State,
+			readiness(instance),
+			instance.PublicIP,
+			instance.PrivateIP,
+			instance.TailscaleHostname,
+			instance.TailscaleIP,
+			instance.TailscaleIPv6,
+			launched,
+			startedBy,
+			sent,
+			cost,
+		)
+	}
+	return table
+}
+
+// nodeCost estimates what a node has cost so far: instance time since it
+// (re)started, priced as a t4g.nano, plus what it sent. Paused nodes only
+// count what they sent. Reports false for regions with no listed prices.
+func nodeCost(instance *types.InstanceInfo, now time.Time) (float64, bool) {
+	info, ok := regions.Lookup(instance.FriendlyRegion)
+	if !ok || info.NanoHourlyUSD == 0 {
+		return 0, false
+	}
+	var usd float64
+	if instance.State == "pending" || instance.State == "running" {
+		usd = now.Sub(instance.LaunchTime).Hours() * info.NanoHourlyUSD
+	}
+	if egress, ok := egressCost(instance.NetworkOutBytes, instance.FriendlyRegion); ok {
+		usd += egress
+	}
+	return usd, true
+}
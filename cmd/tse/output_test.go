@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	if format, err := parseOutputFormat("", outputTable); err != nil || format != "" {
+		t.Errorf(`parseOutputFormat("") = %q, %v; want the usual view`, format, err)
+	}
+	if format, err := parseOutputFormat("wide", outputTable, outputWide); err != nil || format != outputWide {
+		t.Errorf(`parseOutputFormat("wide") = %q, %v`, format, err)
+	}
+	_, err := parseOutputFormat("json", outputTable, outputCompact, outputWide)
+	if err == nil || !strings.Contains(err.Error(), "table, compact, wide") {
+		t.Errorf(`parseOutputFormat("json") error = %v, want the accepted formats listed`, err)
+	}
+}
+
+func TestCompactNodeLine(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		instance types.InstanceInfo
+		want     string
+	}{
+		{types.InstanceInfo{FriendlyRegion: "tokyo", State: "running", Ready: true, LaunchTime: now.Add(-3*time.Hour - 12*time.Minute)}, "tokyo: running, ready, up 3h 12m"},
+		{types.InstanceInfo{FriendlyRegion: "ohio", State: "running", LaunchTime: now.Add(-2 * time.Minute)}, "ohio: running, up 2m"},
+		{types.InstanceInfo{FriendlyRegion: "paris", State: "stopped", LaunchTime: now.Add(-time.Hour)}, "paris: stopped"},
+	}
+	for _, tt := range tests {
+		if got := compactNodeLine(&tt.instance, now); got != tt.want {
+			t.Errorf("compactNodeLine() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestNodeCost(t *testing.T) {
+	info, _ := regions.Lookup("ohio")
+	now := time.Now()
+
+	running := &types.InstanceInfo{FriendlyRegion: "ohio", State: "running", LaunchTime: now.Add(-10 * time.Hour), NetworkOutBytes: 1 << 30}
+	got, ok := nodeCost(running, now)
+	if want := 10*info.NanoHourlyUSD + info.EgressUSDPerGB; !ok || math.Abs(got-want) > 1e-9 {
+		t.Errorf("nodeCost(running) = %v, %v; want %v", got, ok, want)
+	}
+
+	paused := &types.InstanceInfo{FriendlyRegion: "ohio", State: "stopped", LaunchTime: now.Add(-10 * time.Hour)}
+	if got, ok := nodeCost(paused, now); !ok || got != 0 {
+		t.Errorf("nodeCost(paused) = %v, %v; want 0", got, ok)
+	}
+
+	if _, ok := nodeCost(&types.InstanceInfo{FriendlyRegion: "atlantis", State: "running"}, now); ok {
+		t.Error("nodeCost() priced a region with no listed price")
+	}
+}
+
+func TestPrintNodes(t *testing.T) {
+	instances := []*types.InstanceInfo{{
+		InstanceID:     "i-1",
+		FriendlyRegion: "ohio",
+		State:          "running",
+		ImageID:        "ami-0abc",
+		PrivateIP:      "10.0.1.5",
+		LaunchTime:     time.Now(),
+		StartedBy:      "partner-laptop",
+	}}
+
+	var out bytes.Buffer
+	if err := printNodes(&out, outputJSON, nil); err != nil || strings.TrimSpace(out.String()) != "[]" {
+		t.Errorf("printNodes(json, none) = %q, %v; want []", out.String(), err)
+	}
+
+	out.Reset()
+	printNodes(&out, outputJSON, instances)
+	var decoded []types.InstanceInfo
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || len(decoded) != 1 || decoded[0].ImageID != "ami-0abc" {
+		t.Errorf("printNodes(json) = %s (%v)", out.String(), err)
+	}
+
+	out.Reset()
+	printNodes(&out, outputTable, instances)
+	if strings.Contains(out.String(), "ami-0abc") {
+		t.Errorf("table shows the AMI, which only wide does:\n%s", out.String())
+	}
+
+	out.Reset()
+	printNodes(&out, outputWide, instances)
+	for _, want := range []string{"ami-0abc", "10.0.1.5", "partner-laptop", "Cost"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("wide table lacks %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestParseInstancesFlagsQuiet(t *testing.T) {
+	opts, err := parseInstancesFlags("tse ohio instances", []string{"--quiet"}, false)
+	if err != nil || !opts.quiet {
+		t.Errorf("parseInstancesFlags(--quiet) = %+v, %v", opts, err)
+	}
+	if _, err := parseInstancesFlags("tse ohio instances", []string{"--quiet", "--output", "json"}, false); err == nil {
+		t.Error("parseInstancesFlags() accepted --quiet with --output")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/cmd/tse/usage"
+	"github.com/anoldguy/tse/pkg/client"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// handlePause stops a region's exit node without terminating it
+func handlePause(ctx context.Context, lambdaURL, region string) error {
+	var pauseResp *types.PauseResponse
+
+	err := ui.WithSpinner(fmt.Sprintf("Pausing exit node in %s", region), func() error {
+		c, err := lambdaClient(lambdaURL)
+		if err != nil {
+			return err
+		}
+		pauseResp, err = c.Pause(ctx, region)
+		return pauseOrResumeError(err, region)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if len(pauseResp.InstanceIDs) == 0 {
+		fmt.Printf("%s %s\n", ui.Info("Info:"), pauseResp.Message)
+		return nil
+	}
+
+	usage.Record(usage.Event{Kind: usage.KindNodeStop, Region: region})
+	for _, id := range pauseResp.InstanceIDs {
+		ui.Emit(ui.Event{Type: ui.EventInstanceState, Region: region, Instance: id, State: "stopping"})
+	}
+	fmt.Printf("%s %s\n", ui.Checkmark(), pauseResp.Message)
+	fmt.Printf("%s %v\n", ui.Label("Paused instances:"), pauseResp.InstanceIDs)
+	fmt.Printf("\n%s A paused node only bills for its 8 GB disk, under $1/month. Bring it back with 'tse %s resume', or 'tse %s stop' to delete it.\n", ui.Subtle("Note:"), region, region)
+	return nil
+}
+
+// handleResume starts a region's paused exit node again
+func handleResume(ctx context.Context, lambdaURL, region string) error {
+	var resumeResp *types.PauseResponse
+
+	err := ui.WithSpinner(fmt.Sprintf("Resuming exit node in %s", region), func() error {
+		c, err := lambdaClient(lambdaURL)
+		if err != nil {
+			return err
+		}
+		resumeResp, err = c.Resume(ctx, region)
+		return pauseOrResumeError(err, region)
+	})
+	if err != nil {
+		return err
+	}
+
+	usage.Record(usage.Event{Kind: usage.KindNodeStart, Region: region})
+	for _, id := range resumeResp.InstanceIDs {
+		ui.Emit(ui.Event{Type: ui.EventInstanceState, Region: region, Instance: id, State: "pending"})
+	}
+
+	fmt.Println()
+	fmt.Printf("%s %s\n", ui.Checkmark(), resumeResp.Message)
+	fmt.Printf("%s %v\n", ui.Label("Resumed instances:"), resumeResp.InstanceIDs)
+	fmt.Printf("\n%s A resumed node skips the install, so it's usually back in Tailscale within a minute.\n", ui.Subtle("Note:"))
+	fmt.Printf("%s Run 'tse %s instances' to see when it reports ready.\n", ui.Subtle("Tip:"), region)
+	return nil
+}
+
+// pauseOrResumeError explains the Lambda's 404s: nothing to resume, or a
+// deployment from before pause and resume existed
+func pauseOrResumeError(err error, region string) error {
+	var statusErr *client.StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.ErrorCode() {
+		case types.ErrorCodeNothingPaused:
+			return fmt.Errorf("%s; start one with 'tse %s start'", statusErr.Message(), region)
+		case types.ErrorCodeNotFound:
+			return fmt.Errorf("this deployment doesn't support pause and resume yet; run 'tse deploy' to update it")
+		}
+	}
+	if err != nil {
+		return explainLambdaError(err)
+	}
+	return nil
+}
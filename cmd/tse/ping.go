@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
+)
+
+const pingUsage = `Usage: tse ping [flags]
+
+Measure the round trip from this machine to each region's EC2 endpoint, fastest
+first. This is the measurement 'tse <group> start' uses to pick the closest
+region in a group.
+
+Flags:
+  --regions string      Comma-separated regions or groups to probe (default: all)
+
+Examples:
+  tse ping
+  tse ping --regions eu
+  tse ping --regions ohio,tokyo,apac
+`
+
+func runPing(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ping", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, pingUsage)
+	}
+
+	regionList := fs.String("regions", "", "Comma-separated regions or groups to probe")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+
+	names := regions.GetAllFriendlyNames()
+	if *regionList != "" {
+		var err error
+		if names, err = parseRegionList(*regionList); err != nil {
+			return err
+		}
+	}
+
+	var latencies []regionLatency
+	err := ui.WithSpinner(fmt.Sprintf("Probing %d regions", len(names)), func() error {
+		latencies = probeLatencies(ctx, names)
+		return ctx.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	table := ui.NewTable("Region", "AWS Region", "Round Trip")
+	failed := 0
+	for i, latency := range latencies {
+		awsRegion, _ := regions.GetAWSRegion(latency.Region)
+		switch {
+		case latency.Err != nil:
+			failed++
+			table.AddRow(latency.Region, awsRegion, ui.Error(describeProbeError(latency.Err)))
+		case i == 0:
+			table.AddRow(ui.Bold(latency.Region), awsRegion, ui.Success(formatLatency(latency.RTT)))
+		default:
+			table.AddRow(latency.Region, awsRegion, formatLatency(latency.RTT))
+		}
+	}
+	fmt.Println(table.Render())
+
+	if failed == len(latencies) {
+		return fmt.Errorf("couldn't reach any region; check your network connection")
+	}
+	if failed > 0 {
+		fmt.Println(ui.Warning(fmt.Sprintf("⚠️  %d region(s) didn't answer within %s", failed, probeTimeout)))
+	}
+	return nil
+}
+
+// parseRegionList parses the comma-separated --regions list, expanding groups
+// and dropping duplicates
+func parseRegionList(list string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		target, err := resolveRegionTarget(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid region %s\n%v", ui.Highlight(name), err)
+		}
+		for _, region := range target.Regions {
+			if !slices.Contains(names, region) {
+				names = append(names, region)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("--regions needs at least one region")
+	}
+	return names, nil
+}
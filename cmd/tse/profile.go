@@ -0,0 +1,215 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/anoldguy/tse/cmd/tse/config"
+	"github.com/anoldguy/tse/cmd/tse/infrastructure"
+	"github.com/anoldguy/tse/cmd/tse/ui"
+)
+
+const profileUsage = `Usage: tse profile <command> [args]
+
+Manage named profiles for multiple tailnets / AWS accounts
+
+Commands:
+  list                  List profiles (* marks the default)
+  use <name>            Make <name> the default profile
+  set <name> [flags]    Create or update a profile
+  delete <name>         Remove a profile
+
+Flags for set:
+  --lambda-url string   Lambda Function URL (TSE_LAMBDA_URL)
+  --auth-token string   Lambda auth token (TSE_AUTH_TOKEN)
+  --aws-profile string  AWS shared config profile (AWS_PROFILE)
+  --tailnet string      Tailnet name used by setup and adopt-nodes
+  --name-prefix string  Resource name prefix the deployment was made with
+                        (TSE_NAME_PREFIX; only for 'tse deploy --name-prefix')
+
+Select a profile for any command with --profile <name> or TSE_PROFILE.
+An explicitly selected profile overrides environment variables; the default
+profile only fills in variables that aren't already set.
+
+Examples:
+  tse profile set family --lambda-url https://... --auth-token ... --aws-profile family
+  tse profile use personal
+  tse --profile family ohio start
+`
+
+func runProfile(args []string) error {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, profileUsage)
+		return fmt.Errorf("profile command required")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		return listProfiles(cfg)
+
+	case "use":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, profileUsage)
+			return fmt.Errorf("usage: tse profile use <name>")
+		}
+		name := args[1]
+		if _, ok := cfg.Profiles[name]; !ok {
+			return fmt.Errorf("profile %q not found (create it with 'tse profile set %s ...')", name, name)
+		}
+		cfg.DefaultProfile = name
+		if err := cfg.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("%s Default profile is now %s\n", ui.Checkmark(), ui.Highlight(name))
+		return nil
+
+	case "set":
+		return setProfile(cfg, args[1:])
+
+	case "delete":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, profileUsage)
+			return fmt.Errorf("usage: tse profile delete <name>")
+		}
+		name := args[1]
+		if _, ok := cfg.Profiles[name]; !ok {
+			return fmt.Errorf("profile %q not found", name)
+		}
+		delete(cfg.Profiles, name)
+		if cfg.DefaultProfile == name {
+			cfg.DefaultProfile = ""
+		}
+		if err := cfg.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("%s Deleted profile %s\n", ui.Checkmark(), ui.Highlight(name))
+		return nil
+
+	default:
+		fmt.Fprint(os.Stderr, profileUsage)
+		return fmt.Errorf("unknown profile command %s", ui.Highlight(args[0]))
+	}
+}
+
+func listProfiles(cfg *config.Config) error {
+	path, err := config.Path()
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.Profiles) == 0 {
+		fmt.Println(ui.Subtle(fmt.Sprintf("No profiles configured (%s).", path)))
+		fmt.Println(ui.Info("Create one with: tse profile set <name> --lambda-url ... --auth-token ..."))
+		return nil
+	}
+
+	table := ui.NewTable("", "Profile", "Lambda URL", "AWS Profile", "Tailnet", "Auth Token")
+	for _, name := range cfg.Names() {
+		profile := cfg.Profiles[name]
+		marker := ""
+		if name == cfg.DefaultProfile {
+			marker = "*"
+		}
+		table.AddRow(marker, name, profile.LambdaURL, profile.AWSProfile, profile.Tailnet, maskToken(profile.AuthToken))
+	}
+	fmt.Println(table.Render())
+	fmt.Println(ui.Subtle(path))
+
+	return nil
+}
+
+func setProfile(cfg *config.Config, args []string) error {
+	if len(args) < 1 || args[0] == "" || args[0][0] == '-' {
+		fmt.Fprint(os.Stderr, profileUsage)
+		return fmt.Errorf("usage: tse profile set <name> [flags]")
+	}
+	name := args[0]
+
+	fs := flag.NewFlagSet("profile set", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, profileUsage)
+	}
+
+	lambdaURL := fs.String("lambda-url", "", "Lambda Function URL")
+	authToken := fs.String("auth-token", "", "Lambda auth token")
+	awsProfile := fs.String("aws-profile", "", "AWS shared config profile")
+	tailnet := fs.String("tailnet", "", "Tailnet name")
+	namePrefix := fs.String("name-prefix", "", "Resource name prefix")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *namePrefix != "" {
+		if err := infrastructure.ValidateNamePrefix(*namePrefix); err != nil {
+			return err
+		}
+	}
+
+	// Encrypted configs never store the token in plaintext
+	sealedToken, err := cfg.Seal(*authToken)
+	if err != nil {
+		return err
+	}
+
+	profile, exists := cfg.Profiles[name]
+	if !exists {
+		profile = &config.Profile{}
+		cfg.Profiles[name] = profile
+	}
+
+	// Only overwrite fields that were passed, so a profile can be updated piecemeal
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "lambda-url":
+			profile.LambdaURL = *lambdaURL
+		case "auth-token":
+			profile.AuthToken = sealedToken
+		case "aws-profile":
+			profile.AWSProfile = *awsProfile
+		case "tailnet":
+			profile.Tailnet = *tailnet
+		case "name-prefix":
+			profile.NamePrefix = *namePrefix
+		}
+	})
+
+	// First profile becomes the default so it's usable without --profile
+	if len(cfg.Profiles) == 1 {
+		cfg.DefaultProfile = name
+	}
+
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+
+	verb := "Updated"
+	if !exists {
+		verb = "Created"
+	}
+	fmt.Printf("%s %s profile %s\n", ui.Checkmark(), verb, ui.Highlight(name))
+	if cfg.DefaultProfile == name {
+		fmt.Println(ui.Subtle("This is the default profile."))
+	}
+
+	return nil
+}
+
+// maskToken shows just enough of a token to tell profiles apart
+func maskToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	if config.IsEncrypted(token) {
+		return "(encrypted)"
+	}
+	if len(token) <= 8 {
+		return "****"
+	}
+	return token[:4] + "…" + token[len(token)-4:]
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/anoldguy/tse/cmd/tse/usage"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const quickUsage = `Usage: tse quick list [--regions <list>] [--running] [--json]
+       tse quick toggle <region>
+
+Minimal, stable output for launchers (Raycast, Alfred) and scripts: no
+spinners or colors, one tab-separated line per result, and exit codes a script
+can branch on.
+
+  list     One line per region: region, status (off, starting, ready,
+           stopping), hostname, public IP; "-" for an empty field
+  toggle   Stop the region's node if one is starting or running, otherwise
+           start one; prints "started", "stopped" or "running", the region,
+           and the hostname when there is one
+
+Exit codes:
+  0  Success
+  1  The request failed; one line on stderr says why
+  2  Bad arguments
+  3  list: some regions couldn't be listed (the rest are printed)
+`
+
+// Exit codes for tse quick; 0 is success
+const (
+	quickExitFailed  = 1
+	quickExitUsage   = 2
+	quickExitPartial = 3
+)
+
+// Region statuses in tse quick output
+const (
+	quickOff      = "off"
+	quickStarting = "starting"
+	quickReady    = "ready"
+	quickStopping = "stopping"
+)
+
+// quickError carries the exit code for a failed tse quick command
+type quickError struct {
+	code int
+	err  error
+}
+
+func (e *quickError) Error() string { return e.err.Error() }
+func (e *quickError) Unwrap() error { return e.err }
+
+// quickRegion is one region's line in tse quick list
+type quickRegion struct {
+	Region     string `json:"region"`
+	Status     string `json:"status"`
+	Hostname   string `json:"hostname,omitempty"`
+	PublicIP   string `json:"public_ip,omitempty"`
+	InstanceID string `json:"instance_id,omitempty"`
+}
+
+func runQuick(ctx context.Context, lambdaURL string, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, quickUsage)
+		return &quickError{quickExitUsage, errors.New("quick needs list or toggle")}
+	}
+
+	switch args[0] {
+	case "list":
+		return quickList(ctx, lambdaURL, args[1:])
+	case "toggle":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, quickUsage)
+			return &quickError{quickExitUsage, errors.New("toggle needs one region")}
+		}
+		region, err := regions.Resolve(args[1])
+		if err != nil {
+			return &quickError{quickExitUsage, err}
+		}
+		return quickToggle(ctx, lambdaURL, region)
+	default:
+		fmt.Fprint(os.Stderr, quickUsage)
+		return &quickError{quickExitUsage, fmt.Errorf("unknown quick command %q", args[0])}
+	}
+}
+
+func quickList(ctx context.Context, lambdaURL string, args []string) error {
+	fs := flag.NewFlagSet("quick list", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, quickUsage)
+	}
+	regionList := fs.String("regions", "", "Comma-separated regions or groups to list")
+	runningOnly := fs.Bool("running", false, "Leave out regions without a node")
+	asJSON := fs.Bool("json", false, "Print a JSON array")
+	if err := fs.Parse(args); err != nil {
+		return &quickError{quickExitUsage, err}
+	}
+	if fs.NArg() > 0 {
+		return &quickError{quickExitUsage, fmt.Errorf("unexpected argument %s", fs.Arg(0))}
+	}
+
+	names := regions.GetAllFriendlyNames()
+	if *regionList != "" {
+		var err error
+		if names, err = parseRegionList(*regionList); err != nil {
+			return &quickError{quickExitUsage, err}
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var listed []quickRegion
+	var failed []string
+	for _, region := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instancesResp, err := listRegionInstances(ctx, lambdaURL, region)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed = append(failed, region)
+				return
+			}
+			listed = append(listed, quickRegionStatus(region, instancesResp.Instances))
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(listed) == 0 {
+		return &quickError{quickExitFailed, errors.New("couldn't list any region; check 'tse health'")}
+	}
+
+	sort.Slice(listed, func(i, j int) bool { return listed[i].Region < listed[j].Region })
+	if *runningOnly {
+		listed = slices.DeleteFunc(listed, func(r quickRegion) bool { return r.Status == quickOff })
+	}
+
+	if *asJSON {
+		if listed == nil {
+			listed = []quickRegion{}
+		}
+		if err := json.NewEncoder(os.Stdout).Encode(listed); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range listed {
+			fmt.Println(quickLine(r.Region, r.Status, r.Hostname, r.PublicIP))
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return &quickError{quickExitPartial, fmt.Errorf("couldn't list %s", strings.Join(failed, ", "))}
+	}
+	return nil
+}
+
+func quickToggle(ctx context.Context, lambdaURL, region string) error {
+	instancesResp, err := listRegionInstances(ctx, lambdaURL, region)
+	if err != nil {
+		return err
+	}
+
+	status := quickRegionStatus(region, instancesResp.Instances)
+	if status.Status == quickStarting || status.Status == quickReady {
+		stopResp, err := stopRegion(ctx, lambdaURL, region)
+		if err != nil {
+			return err
+		}
+		if stopResp.TerminatedCount > 0 {
+			usage.Record(usage.Event{Kind: usage.KindNodeStop, Region: region})
+		}
+		fmt.Println(quickLine("stopped", region))
+		return nil
+	}
+
+	startResp, alreadyRunning, err := startRegion(ctx, lambdaURL, types.StartRequest{Region: region})
+	if err != nil {
+		return err
+	}
+	if alreadyRunning {
+		fmt.Println(quickLine("running", region))
+		return nil
+	}
+	usage.Record(usage.Event{Kind: usage.KindNodeStart, Region: region})
+
+	hostname := ""
+	if startResp.Instance != nil {
+		hostname = startResp.Instance.TailscaleHostname
+	}
+	fmt.Println(quickLine("started", region, hostname))
+	return nil
+}
+
+// quickRegionStatus summarizes a region by its newest node that isn't gone
+func quickRegionStatus(region string, instances []*types.InstanceInfo) quickRegion {
+	var newest *types.InstanceInfo
+	for _, instance := range instances {
+		if instance.State == "terminated" || instance.State == "stopped" {
+			continue
+		}
+		if newest == nil || instance.LaunchTime.After(newest.LaunchTime) {
+			newest = instance
+		}
+	}
+	if newest == nil {
+		return quickRegion{Region: region, Status: quickOff}
+	}
+
+	status := quickStopping
+	switch {
+	case newest.State == "running" && newest.Ready:
+		status = quickReady
+	case newest.State == "pending" || newest.State == "running":
+		status = quickStarting
+	}
+	return quickRegion{
+		Region:     region,
+		Status:     status,
+		Hostname:   newest.TailscaleHostname,
+		PublicIP:   newest.PublicIP,
+		InstanceID: newest.InstanceID,
+	}
+}
+
+// quickLine joins fields with tabs, writing "-" for empty ones so columns
+// never shift
+func quickLine(fields ...string) string {
+	for i, field := range fields {
+		if field == "" {
+			fields[i] = "-"
+		}
+	}
+	return strings.Join(fields, "\t")
+}
+
+// exitQuick reports a failed tse quick command on one line and exits with its code
+func exitQuick(err error) {
+	if isInterrupted(err) {
+		os.Exit(exitInterrupted)
+	}
+	fmt.Fprintf(os.Stderr, "error: %s\n", firstLine(err.Error()))
+
+	var qe *quickError
+	if errors.As(err, &qe) {
+		os.Exit(qe.code)
+	}
+	os.Exit(quickExitFailed)
+}
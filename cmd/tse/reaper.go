@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/config"
+	"github.com/anoldguy/tse/cmd/tse/ui"
+)
+
+const installReaperUsage = `Usage: tse install-reaper [--at HH:MM] [--dry-run]
+       tse install-reaper --uninstall
+
+Schedule 'tse shutdown' to run every day on this machine, so a node you forgot
+about is stopped overnight. Installs a systemd user timer on Linux or a launchd
+agent on macOS; both run a missed shutdown when the machine wakes up. Nothing
+is added to AWS (for a server-side check, see 'tse deploy --alarm-hours').
+
+The job runs this tse binary with your current profile, so the Lambda URL and
+auth token must be saved in a profile ('tse profile set'), not only exported in
+your shell.
+
+Flags:
+  --at string    Local time to run, 24-hour HH:MM (default "02:00")
+  --dry-run      Print the files instead of installing them
+  --uninstall    Remove the schedule
+
+Examples:
+  tse install-reaper
+  tse install-reaper --at 23:30
+  tse --profile family install-reaper
+  tse install-reaper --uninstall
+`
+
+const (
+	reaperUnit  = "tse-reaper"              // systemd unit name (.service and .timer)
+	reaperLabel = "com.anoldguy.tse.reaper" // launchd job label
+)
+
+// reaperFile is a file install-reaper writes
+type reaperFile struct {
+	path    string
+	content string
+}
+
+func runInstallReaper(ctx context.Context, profileName string, args []string) error {
+	fs := flag.NewFlagSet("install-reaper", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, installReaperUsage)
+	}
+	at := fs.String("at", "02:00", "Local time to run, 24-hour HH:MM")
+	dryRun := fs.Bool("dry-run", false, "Print the files instead of installing them")
+	uninstall := fs.Bool("uninstall", false, "Remove the schedule")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+
+	clock, err := time.Parse("15:04", *at)
+	if err != nil {
+		return fmt.Errorf("invalid --at %s: want a 24-hour time like 02:00", ui.Highlight(*at))
+	}
+
+	if profileName == "" {
+		profileName = os.Getenv(config.EnvProfile)
+	}
+	command, env, err := reaperCommand(profileName)
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		return fmt.Errorf("install-reaper knows systemd (Linux) and launchd (macOS); on %s, schedule this yourself:\n  %s", runtime.GOOS, strings.Join(command, " "))
+	}
+
+	if *uninstall {
+		return uninstallReaper(ctx)
+	}
+
+	files, err := reaperFiles(clock.Hour(), clock.Minute(), command, env)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		for _, file := range files {
+			fmt.Printf("# %s\n%s\n", file.path, file.content)
+		}
+		return nil
+	}
+
+	if warning := reaperProfileWarning(profileName); warning != "" {
+		fmt.Fprintf(os.Stderr, "%s %s\n", ui.Warning("Warning:"), warning)
+	}
+
+	for _, file := range files {
+		if err := os.MkdirAll(filepath.Dir(file.path), 0o755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", filepath.Dir(file.path), err)
+		}
+		if err := os.WriteFile(file.path, []byte(file.content), 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.path, err)
+		}
+		fmt.Printf("%s Wrote %s\n", ui.Checkmark(), ui.Highlight(file.path))
+	}
+
+	if err := activateReaper(ctx, files); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s tse shutdown will run every day at %s\n", ui.Checkmark(), ui.Highlight(clock.Format("15:04")))
+	if runtime.GOOS == "linux" {
+		fmt.Printf("  Logs:   journalctl --user -u %s\n", reaperUnit)
+		fmt.Printf("  Timers: systemctl --user list-timers %s.timer\n", reaperUnit)
+		fmt.Println(ui.Subtle("  User timers only run while you're logged in, unless you run 'loginctl enable-linger'."))
+	} else {
+		fmt.Printf("  Logs: %s\n", reaperLogPath())
+	}
+	return nil
+}
+
+// reaperCommand is what the job runs: this binary, without spinners, with the
+// profile in use now. TSE_CONFIG pins the config file, since the job's
+// environment may not have the XDG variables the shell has.
+func reaperCommand(profileName string) ([]string, map[string]string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find the tse binary: %w", err)
+	}
+	configPath, err := config.Path()
+	if err != nil {
+		return nil, nil, err
+	}
+	if configPath, err = filepath.Abs(configPath); err != nil {
+		return nil, nil, err
+	}
+
+	command := []string{exe, "--no-ui"}
+	if profileName != "" {
+		command = append(command, "--profile", profileName)
+	}
+	command = append(command, "shutdown")
+	return command, map[string]string{config.EnvConfigPath: configPath}, nil
+}
+
+// reaperProfileWarning explains why the job won't be able to reach the Lambda,
+// or returns "" when the profile has what it needs
+func reaperProfileWarning(profileName string) string {
+	cfg, err := config.Load()
+	if err != nil {
+		return ""
+	}
+	if profileName == "" {
+		profileName = cfg.DefaultProfile
+	}
+
+	profile := cfg.Profiles[profileName]
+	if profile == nil || profile.LambdaURL == "" || profile.AuthToken == "" {
+		return "no profile saves the Lambda URL and auth token, and the job won't see your shell's environment. Save them with 'tse profile set'."
+	}
+	if cfg.Encryption != nil && cfg.Encryption.KeySource == config.KeySourcePassphrase {
+		return "your config is passphrase-encrypted, and the job has no TSE_CONFIG_PASSPHRASE to read the auth token with."
+	}
+	return ""
+}
+
+// reaperFiles returns the unit files (Linux) or launch agent (macOS) for a daily run
+func reaperFiles(hour, minute int, command []string, env map[string]string) ([]reaperFile, error) {
+	if runtime.GOOS == "darwin" {
+		path, err := launchAgentPath()
+		if err != nil {
+			return nil, err
+		}
+		return []reaperFile{{path, launchdPlist(hour, minute, command, env)}}, nil
+	}
+
+	dir, err := systemdUserDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var service strings.Builder
+	service.WriteString("[Unit]\nDescription=Stop every tse exit node\n\n[Service]\nType=oneshot\n")
+	for key, value := range env {
+		fmt.Fprintf(&service, "Environment=%s\n", systemdQuote(key+"="+value))
+	}
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = systemdQuote(strings.ReplaceAll(arg, "$", "$$"))
+	}
+	fmt.Fprintf(&service, "ExecStart=%s\n", strings.Join(quoted, " "))
+
+	timer := fmt.Sprintf(`[Unit]
+Description=Stop every tse exit node daily at %02d:%02d
+
+[Timer]
+OnCalendar=*-*-* %02d:%02d:00
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`, hour, minute, hour, minute)
+
+	return []reaperFile{
+		{filepath.Join(dir, reaperUnit+".service"), service.String()},
+		{filepath.Join(dir, reaperUnit+".timer"), timer},
+	}, nil
+}
+
+// launchdPlist renders a launch agent that runs command daily at hour:minute.
+// launchd runs a calendar job that was missed while the Mac slept on wake.
+func launchdPlist(hour, minute int, command []string, env map[string]string) string {
+	var b bytes.Buffer
+	str := func(s string) {
+		b.WriteString("<string>")
+		xml.EscapeText(&b, []byte(s))
+		b.WriteString("</string>")
+	}
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	`)
+	str(reaperLabel)
+	b.WriteString("\n\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range command {
+		b.WriteString("\t\t")
+		str(arg)
+		b.WriteString("\n")
+	}
+	b.WriteString("\t</array>\n\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+	for key, value := range env {
+		fmt.Fprintf(&b, "\t\t<key>%s</key>\n\t\t", key)
+		str(value)
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "\t</dict>\n\t<key>StartCalendarInterval</key>\n\t<dict>\n\t\t<key>Hour</key>\n\t\t<integer>%d</integer>\n\t\t<key>Minute</key>\n\t\t<integer>%d</integer>\n\t</dict>\n", hour, minute)
+	for _, key := range []string{"StandardOutPath", "StandardErrorPath"} {
+		fmt.Fprintf(&b, "\t<key>%s</key>\n\t", key)
+		str(reaperLogPath())
+		b.WriteString("\n")
+	}
+	b.WriteString("</dict>\n</plist>\n")
+	return b.String()
+}
+
+// activateReaper loads the freshly written schedule, replacing an older one
+func activateReaper(ctx context.Context, files []reaperFile) error {
+	if runtime.GOOS == "darwin" {
+		domain := fmt.Sprintf("gui/%d", os.Getuid())
+		// bootstrap fails if the job is already loaded; unloading first picks up changes
+		runQuiet(ctx, "launchctl", "bootout", domain+"/"+reaperLabel)
+		return runReaperStep(ctx, "launchctl", "bootstrap", domain, files[0].path)
+	}
+
+	if err := runReaperStep(ctx, "systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+	return runReaperStep(ctx, "systemctl", "--user", "enable", "--now", reaperUnit+".timer")
+}
+
+// uninstallReaper unloads the schedule and deletes its files
+func uninstallReaper(ctx context.Context) error {
+	var paths []string
+	if runtime.GOOS == "darwin" {
+		runQuiet(ctx, "launchctl", "bootout", fmt.Sprintf("gui/%d/%s", os.Getuid(), reaperLabel))
+		path, err := launchAgentPath()
+		if err != nil {
+			return err
+		}
+		paths = []string{path}
+	} else {
+		runQuiet(ctx, "systemctl", "--user", "disable", "--now", reaperUnit+".timer")
+		dir, err := systemdUserDir()
+		if err != nil {
+			return err
+		}
+		paths = []string{filepath.Join(dir, reaperUnit+".timer"), filepath.Join(dir, reaperUnit+".service")}
+	}
+
+	removed := false
+	for _, path := range paths {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		removed = true
+		fmt.Printf("%s Removed %s\n", ui.Checkmark(), ui.Highlight(path))
+	}
+	if !removed {
+		fmt.Println("No nightly shutdown is installed")
+		return nil
+	}
+	if runtime.GOOS == "linux" {
+		runQuiet(ctx, "systemctl", "--user", "daemon-reload")
+	}
+	return nil
+}
+
+// runReaperStep runs a service manager command, including its output in the error
+func runReaperStep(ctx context.Context, name string, args ...string) error {
+	output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		command := strings.Join(append([]string{name}, args...), " ")
+		if detail := strings.TrimSpace(string(output)); detail != "" {
+			return fmt.Errorf("%s failed: %s", command, detail)
+		}
+		return fmt.Errorf("%s failed: %w", command, err)
+	}
+	return nil
+}
+
+// runQuiet runs a command whose failure doesn't matter, such as unloading a job
+// that may not be loaded
+func runQuiet(ctx context.Context, name string, args ...string) {
+	exec.CommandContext(ctx, name, args...).Run()
+}
+
+// systemdUserDir is where systemd looks for a user's own units
+func systemdUserDir() (string, error) {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "systemd", "user"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "systemd", "user"), nil
+}
+
+func launchAgentPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", reaperLabel+".plist"), nil
+}
+
+// reaperLogPath is where the launch agent's output goes
+func reaperLogPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, "Library", "Logs", "tse-reaper.log")
+}
+
+// systemdQuote quotes a word for a unit file, escaping % specifiers. ExecStart
+// also expands $ variables, so its words need $ doubled first.
+func systemdQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%").Replace(s)
+	return `"` + s + `"`
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/anoldguy/tse/cmd/tse/config"
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
+)
+
+// regionTarget is what the region argument of 'tse <region> <action>' names: a
+// single region, or a group of several (built in, like "eu", or a config alias)
+type regionTarget struct {
+	Name    string   // As typed
+	Regions []string // Friendly names, in order of preference
+}
+
+// IsGroup reports whether the target stands for more than one region
+func (t regionTarget) IsGroup() bool {
+	return len(t.Regions) > 1
+}
+
+// resolveRegionTarget resolves a region argument. Region names (including
+// localized ones) win, so an alias can never hide a region; then come aliases
+// from the config file, then built-in groups.
+func resolveRegionTarget(name string) (regionTarget, error) {
+	region, err := regions.Resolve(name)
+	if err == nil {
+		return regionTarget{Name: name, Regions: []string{region}}, nil
+	}
+
+	cfg, loadErr := config.Load()
+	if loadErr != nil {
+		return regionTarget{}, loadErr
+	}
+	if members, ok := cfg.RegionGroup(name); ok {
+		return regionTarget{Name: name, Regions: members}, nil
+	}
+
+	return regionTarget{}, err
+}
+
+// chooseRegion picks the region a group should start in: the one whose
+// endpoint answers fastest, or with the "preference" chooser the first listed.
+// When no region can be probed it falls back to the first.
+func chooseRegion(ctx context.Context, target regionTarget) (string, error) {
+	if !target.IsGroup() {
+		return target.Regions[0], nil
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+	if cfg.Chooser() == config.ChooserPreference {
+		fmt.Printf("%s %s → %s (first preference of %s)\n", ui.Label("Region:"), target.Name, ui.Highlight(target.Regions[0]), strings.Join(target.Regions, ", "))
+		return target.Regions[0], nil
+	}
+
+	var latencies []regionLatency
+	err = ui.WithSpinner(fmt.Sprintf("Finding the closest region in %s", target.Name), func() error {
+		latencies = probeLatencies(ctx, target.Regions)
+		return ctx.Err()
+	})
+	if err != nil {
+		return "", err
+	}
+
+	closest := latencies[0]
+	if closest.Err != nil {
+		fmt.Println(ui.Warning(fmt.Sprintf("⚠️  Couldn't measure latency to any region in %s; using %s", target.Name, target.Regions[0])))
+		return target.Regions[0], nil
+	}
+	fmt.Printf("%s %s → %s (%s)\n", ui.Label("Region:"), target.Name, ui.Highlight(closest.Region), formatLatency(closest.RTT))
+	return closest.Region, nil
+}
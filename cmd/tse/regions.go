@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
+)
+
+const regionsUsage = `Usage: tse regions [flags]
+
+List the regions tse can start exit nodes in: where they are, what a t4g.nano
+typically costs there, and which ones have to be enabled for the account first
+
+Flags:
+  --json                Print the list as JSON
+
+Examples:
+  tse regions
+  tse regions --json | jq -r '.[] | select(.continent == "Europe") | .name'
+`
+
+func runRegions(args []string) error {
+	fs := flag.NewFlagSet("regions", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, regionsUsage)
+	}
+
+	asJSON := fs.Bool("json", false, "Print the list as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+
+	all := regions.All()
+	if *asJSON {
+		data, err := json.MarshalIndent(all, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode regions: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	table := ui.NewTable("", "Region", "AWS Region", "City", "Country", "Continent", "t4g.nano", "24/7")
+	optIn := false
+	for _, info := range all {
+		name := ui.Bold(info.Name)
+		if info.OptIn {
+			name += ui.Subtle("*")
+			optIn = true
+		}
+		hourly, monthly := "-", "-"
+		if info.NanoHourlyUSD > 0 {
+			hourly = fmt.Sprintf("$%.4f/hr", info.NanoHourlyUSD)
+			monthly = fmt.Sprintf("$%.2f/mo", info.NanoHourlyUSD*hoursPerMonth)
+		}
+		table.AddRow(
+			info.Flag,
+			name,
+			info.AWSRegion,
+			info.City,
+			info.Country,
+			info.Continent,
+			hourly,
+			monthly,
+		)
+	}
+	fmt.Println(table.Render())
+
+	if optIn {
+		fmt.Println(ui.Subtle(fmt.Sprintf("* Opt-in region: enable it for your AWS account first at %s", regions.OptInURL)))
+	}
+	fmt.Println(ui.Subtle("Prices are typical on-demand rates; check AWS for current pricing."))
+	fmt.Println(ui.Subtle(fmt.Sprintf("Groups: %s (see 'tse config alias'). Closest to you: 'tse ping'.", strings.Join(regions.GroupNames(), ", "))))
+	return nil
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const reserveUsage = `Usage: tse <region> reserve [show|create|cancel] [flags]
+
+Manage an on-demand capacity reservation for one exit node in a region
+
+A reservation holds capacity for one t4g.nano in the availability zone the
+region's exit nodes launch in, so 'tse <region> start' never fails with an
+insufficient capacity error. It's meant for the one region you use daily.
+
+It's billed at the on-demand rate around the clock, whether or not a node is
+running (a node using it isn't charged again). Cancel it when you no longer
+need it; 'tse teardown' cancels every reservation too.
+
+Commands:
+  show      Show the region's reservation and what it costs (default)
+  create    Reserve capacity for one exit node
+  cancel    Cancel the region's reservation
+
+Flags:
+  --yes     Don't ask for confirmation
+
+Examples:
+  tse ohio reserve
+  tse ohio reserve create
+  tse ohio reserve cancel --yes
+`
+
+// hoursPerMonth is AWS's billing convention for a month
+const hoursPerMonth = 730
+
+// errReservationsUnsupported means the deployed Lambda predates reservations,
+// so it can't have created any
+var errReservationsUnsupported = errors.New("this Lambda doesn't support capacity reservations; run 'tse deploy' to update it")
+
+func runReserve(ctx context.Context, lambdaURL, region string, args []string) error {
+	command := "show"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("reserve", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, reserveUsage)
+	}
+
+	yes := fs.Bool("yes", false, "Don't ask for confirmation")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+
+	switch command {
+	case "show":
+		return handleShowReservation(ctx, lambdaURL, region)
+	case "create":
+		return handleCreateReservation(ctx, lambdaURL, region, *yes)
+	case "cancel":
+		return handleCancelReservation(ctx, lambdaURL, region, *yes)
+	default:
+		fmt.Fprint(os.Stderr, reserveUsage)
+		return fmt.Errorf("unknown reserve command %s", ui.Highlight(command))
+	}
+}
+
+func handleShowReservation(ctx context.Context, lambdaURL, region string) error {
+	var reservationResp *types.ReservationResponse
+	err := ui.WithSpinner(fmt.Sprintf("Checking capacity reservation in %s", region), func() error {
+		var err error
+		reservationResp, err = reservationRequest(ctx, lambdaURL, region, "GET", "reservation", http.StatusOK)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	reservation := reservationResp.Reservation
+	if reservation == nil {
+		fmt.Println(ui.Subtle(fmt.Sprintf("No capacity reservation in %s.", region)))
+		fmt.Printf("\n%s Reserving one exit node costs about %s\n", ui.Info("→"), ui.Bold(reservationCost(region)))
+		fmt.Printf("%s Run 'tse %s reserve create' to reserve capacity\n", ui.Info("→"), region)
+		return nil
+	}
+
+	fmt.Println(ui.InfoBox("Capacity Reservation", reservationDetails(reservation)...))
+	return nil
+}
+
+func handleCreateReservation(ctx context.Context, lambdaURL, region string, yes bool) error {
+	if !yes {
+		fmt.Printf("Reserving capacity for one exit node in %s costs about %s,\n", ui.Highlight(region), ui.Bold(reservationCost(region)))
+		fmt.Println("billed until you cancel it, whether or not a node is running.")
+		fmt.Println()
+		fmt.Printf("%s Reserve capacity in %s? [y/N]: ", ui.Info("→"), ui.Highlight(region))
+		response, err := readLine(ctx, os.Stdin)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(strings.TrimSpace(response)) {
+		case "y", "yes":
+		default:
+			fmt.Println()
+			fmt.Println(ui.Success("✓ Cancelled - nothing was reserved"))
+			return nil
+		}
+		fmt.Println()
+	}
+
+	var reservationResp *types.ReservationResponse
+	err := ui.WithSpinner(fmt.Sprintf("Reserving capacity in %s", region), func() error {
+		var err error
+		reservationResp, err = reservationRequest(ctx, lambdaURL, region, "POST", "reserve", http.StatusCreated)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("%s %s\n", ui.Checkmark(), reservationResp.Message)
+	if reservationResp.Reservation != nil {
+		fmt.Println()
+		fmt.Println(ui.InfoBox("Capacity Reservation", reservationDetails(reservationResp.Reservation)...))
+	}
+	fmt.Printf("\n%s Cancel it with 'tse %s reserve cancel'\n", ui.Subtle("Tip:"), region)
+	return nil
+}
+
+func handleCancelReservation(ctx context.Context, lambdaURL, region string, yes bool) error {
+	if !yes {
+		fmt.Printf("%s Cancel the capacity reservation in %s? [y/N]: ", ui.Info("→"), ui.Highlight(region))
+		response, err := readLine(ctx, os.Stdin)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(strings.TrimSpace(response)) {
+		case "y", "yes":
+		default:
+			fmt.Println()
+			fmt.Println(ui.Success("✓ Kept the reservation"))
+			return nil
+		}
+		fmt.Println()
+	}
+
+	var reservationResp *types.ReservationResponse
+	err := ui.WithSpinner(fmt.Sprintf("Cancelling capacity reservation in %s", region), func() error {
+		var err error
+		reservationResp, err = cancelReservation(ctx, lambdaURL, region, false)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if reservationResp.Reservation == nil {
+		fmt.Println(ui.Subtle(reservationResp.Message))
+		return nil
+	}
+	fmt.Printf("%s %s\n", ui.Checkmark(), reservationResp.Message)
+	return nil
+}
+
+// cancelReservation cancels a region's capacity reservation, if it has one. Only
+// this deployment's is cancelled unless allDeployments is set.
+func cancelReservation(ctx context.Context, lambdaURL, region string, allDeployments bool) (*types.ReservationResponse, error) {
+	return reservationRequest(ctx, lambdaURL, region, "POST", unreserveRoute(allDeployments), http.StatusOK)
+}
+
+// unreserveRoute is the Lambda route that cancels a region's reservation
+func unreserveRoute(allDeployments bool) string {
+	if allDeployments {
+		return "unreserve?" + types.AllDeploymentsParam + "=true"
+	}
+	return "unreserve"
+}
+
+// cancelAllReservations cancels capacity reservations in every region, returning
+// the regions where one was cancelled and the regions that couldn't be checked
+func cancelAllReservations(ctx context.Context, lambdaURL string, allDeployments bool) (cancelled, failed []string) {
+	results := ui.FanOut("Cancelling capacity reservations", regions.GetAllFriendlyNames(), func(region string) (string, error) {
+		reservationResp, err := cancelReservation(ctx, lambdaURL, region, allDeployments)
+		if errors.Is(err, errReservationsUnsupported) {
+			return "none", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if reservationResp.Reservation == nil {
+			return "none", nil
+		}
+		return "cancelled " + reservationResp.Reservation.ReservationID, nil
+	})
+
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed = append(failed, result.Name)
+		case result.Summary != "none":
+			cancelled = append(cancelled, result.Name)
+		}
+	}
+	return cancelled, failed
+}
+
+// reservationRequest calls a region's reservation route and decodes the response
+func reservationRequest(ctx context.Context, lambdaURL, region, method, route string, wantStatus int) (*types.ReservationResponse, error) {
+	url := fmt.Sprintf("%s/%s/%s", lambdaURL, region, route)
+	resp, err := makeAuthenticatedRequest(ctx, method, url, nil)
+	if err != nil {
+		return nil, err // Already enhanced with context
+	}
+	defer resp.Body.Close()
+
+	body, err := types.ReadPayload(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errReservationsUnsupported
+	}
+	if resp.StatusCode != wantStatus {
+		return nil, enhanceHTTPStatusError(resp.StatusCode, string(body), fmt.Sprintf("manage capacity reservation in %s", region))
+	}
+
+	var reservationResp types.ReservationResponse
+	if err := json.Unmarshal(body, &reservationResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &reservationResp, nil
+}
+
+// reservationDetails renders a reservation for an info box
+func reservationDetails(reservation *types.ReservationInfo) []string {
+	inUse := "no (capacity is free for the next start)"
+	if reservation.AvailableInstances < reservation.TotalInstances {
+		inUse = "yes, by a running exit node"
+	}
+	return []string{
+		fmt.Sprintf("Reservation %s", reservation.ReservationID),
+		fmt.Sprintf("Zone        %s", reservation.AvailabilityZone),
+		fmt.Sprintf("Type        %s", reservation.InstanceType),
+		fmt.Sprintf("State       %s", reservation.State),
+		fmt.Sprintf("In use      %s", inUse),
+		fmt.Sprintf("Since       %s", reservation.CreateTime.Local().Format("2006-01-02 15:04 MST")),
+		fmt.Sprintf("Cost        about %s", reservationCost(reservation.FriendlyRegion)),
+	}
+}
+
+// reservationCost describes what a one-node reservation costs per month in a
+// region, at its typical on-demand t4g.nano rate
+func reservationCost(region string) string {
+	info, ok := regions.Lookup(region)
+	if !ok || info.NanoHourlyUSD == 0 {
+		// Custom regions have no listed price; a reservation bills the on-demand rate
+		return "the on-demand price of a t4g.nano there"
+	}
+	return fmt.Sprintf("$%.2f/month", info.NanoHourlyUSD*hoursPerMonth)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/cmd/tse/usage"
+	"github.com/anoldguy/tse/pkg/client"
+	"github.com/anoldguy/tse/shared/dns"
+	"github.com/anoldguy/tse/shared/routes"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// parseRestartFlags reads 'tse <region> restart [--dns <resolver>] [--advertise-routes <routes>]'.
+// The replacement doesn't inherit the old node's options, so like a start it
+// takes them again, with the config file's resolver by default.
+func parseRestartFlags(region string, args []string) (startOptions, error) {
+	fs := flag.NewFlagSet("restart", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: tse %s restart [--dns <resolver>] [--advertise-routes <routes>]\n\n", region)
+		fmt.Fprintln(os.Stderr, "Terminates the region's exit node and launches a new one into the same VPC.")
+		fmt.Fprintln(os.Stderr, "The new node takes these options, as 'tse <region> start' does:")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "  --dns               Resolver for the node's clients:")
+		fmt.Fprintf(os.Stderr, "                      %s\n", dns.Choices)
+		fmt.Fprintf(os.Stderr, "                      %q keeps the VPC's (default: 'tse config dns')\n", dns.None)
+		fmt.Fprintln(os.Stderr, "  --advertise-routes  Also act as a subnet router for these CIDR prefixes,")
+		fmt.Fprintf(os.Stderr, "                      comma-separated; %q is the node's VPC (%s)\n", routes.VPC, routes.VPCCIDR)
+	}
+	spec := fs.String("dns", "", "DNS resolver for the exit node")
+	routeSpec := fs.String("advertise-routes", "", "Subnet routes to advertise")
+	if err := fs.Parse(args); err != nil {
+		return startOptions{}, err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return startOptions{}, fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+	return nodeOptions(*spec, *routeSpec)
+}
+
+// handleRestart replaces a region's exit node in one request: the Lambda
+// terminates the old node and launches another, without the VPC teardown and
+// rebuild a stop and start go through
+func handleRestart(ctx context.Context, lambdaURL, region string, opts startOptions) error {
+	var restartResp *types.RestartResponse
+
+	err := ui.WithSpinner(fmt.Sprintf("Restarting exit node in %s", region), func() error {
+		c, err := lambdaClient(lambdaURL)
+		if err != nil {
+			return err
+		}
+		restartResp, err = c.Restart(ctx, types.StartRequest{
+			Region:          region,
+			DNS:             opts.dns.Name,
+			AdvertiseRoutes: opts.routes,
+		})
+		return restartError(err, region)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("%s %s\n", ui.Checkmark(), restartResp.Message)
+	if len(restartResp.TerminatedIDs) > 0 {
+		usage.Record(usage.Event{Kind: usage.KindNodeStop, Region: region})
+		emitTerminated(region, restartResp.TerminatedIDs)
+		fmt.Printf("%s %v\n", ui.Label("Replaced instances:"), restartResp.TerminatedIDs)
+	}
+	if restartResp.Instance != nil {
+		usage.Record(usage.Event{Kind: usage.KindNodeStart, Region: region})
+		ui.Emit(ui.Event{Type: ui.EventInstanceState, Region: region, Instance: restartResp.Instance.InstanceID, State: restartResp.Instance.State})
+		fmt.Printf("%s %s\n", ui.Label("New Instance ID:"), ui.Highlight(restartResp.Instance.InstanceID))
+		fmt.Printf("%s %s\n", ui.Label("Instance Type:"), instanceType(restartResp.Instance))
+		fmt.Printf("%s %s\n", ui.Label("State:"), ui.Success(restartResp.Instance.State))
+		if !opts.dns.IsZero() {
+			fmt.Printf("%s %s\n", ui.Label("DNS:"), opts.dns.Name)
+		}
+		if len(opts.routes) > 0 {
+			fmt.Printf("%s %s\n", ui.Label("Subnet Routes:"), strings.Join(opts.routes, ", "))
+		}
+	}
+	fmt.Printf("\n%s The new node joins Tailscale in 1-2 minutes. Until the old one drops off the tailnet, the new one may show up as exit-%s-1.\n", ui.Subtle("Note:"), region)
+	fmt.Printf("%s Run 'tse %s instances' to see when it reports ready, and the name it got.\n", ui.Subtle("Tip:"), region)
+	return nil
+}
+
+// restartError explains the Lambda's 404s: nothing to replace, or a
+// deployment from before restart existed
+func restartError(err error, region string) error {
+	var statusErr *client.StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.ErrorCode() {
+		case types.ErrorCodeNothingRunning:
+			return fmt.Errorf("%s; start one with 'tse %s start'", statusErr.Message(), region)
+		case types.ErrorCodeNotFound:
+			return fmt.Errorf("this deployment doesn't support restart yet; run 'tse deploy' to update it")
+		}
+	}
+	if err != nil {
+		return explainLambdaError(err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/anoldguy/tse/cmd/tse/infrastructure"
+	"github.com/anoldguy/tse/cmd/tse/ui"
+)
+
+const serveUsage = `Usage: tse serve [flags]
+
+Run the API on this machine over plain HTTP instead of the Lambda, for trying
+changes or running on a home server. It builds the Lambda from source for this
+machine (needs Go and a tailscale-exits checkout) and runs it with your local
+AWS credentials and the environment deploy gives the Lambda: TSE_AUTH_TOKEN,
+TAILSCALE_AUTH_KEY, and the deployment's state table and launch templates.
+
+Ctrl+C stops taking requests and waits for those in progress and any async
+jobs, up to 5 minutes. A second Ctrl+C exits right away.
+
+Flags:
+  --addr string         Address to listen on (default 127.0.0.1:8080)
+  --mutations int       Changes that may run at once per region; more get a 429
+                        the CLI waits out (default 2)
+  --standalone          Don't use the deployment's state table, launch templates
+                        or instance profile, for accounts without a deployment
+
+Examples:
+  tse serve
+  TSE_LAMBDA_URL=http://127.0.0.1:8080 tse ohio start
+  tse serve --addr 0.0.0.0:8080 --standalone
+`
+
+func runServe(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, serveUsage)
+	}
+
+	addr := fs.String("addr", "127.0.0.1:8080", "Address to listen on")
+	mutations := fs.Int("mutations", 2, "Changes that may run at once per region")
+	standalone := fs.Bool("standalone", false, "Don't use the deployment's resources")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+	if *mutations < 1 {
+		return fmt.Errorf("--mutations must be at least 1")
+	}
+	for _, key := range []string{"TSE_AUTH_TOKEN", "TAILSCALE_AUTH_KEY"} {
+		if os.Getenv(key) == "" {
+			return fmt.Errorf("%s environment variable not set; the API needs it as the Lambda does", key)
+		}
+	}
+
+	env, err := infrastructure.ServeEnvironment(ctx, *addr, *mutations, *standalone)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "tse-serve-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var server string
+	err = ui.WithSpinner("Building the API from source", func() error {
+		server, err = infrastructure.BuildServer(ctx, dir)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s Serving the API on %s\n", ui.Success("✓"), ui.Highlight("http://"+*addr))
+	fmt.Printf("  Point the CLI at it: TSE_LAMBDA_URL=http://%s\n\n", *addr)
+
+	// Not CommandContext: Ctrl+C reaches the server from the terminal, and it
+	// shuts down on its own time. Only a SIGTERM sent to us is passed on.
+	cmd := exec.Command(server)
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	terminate := make(chan os.Signal, 1)
+	signal.Notify(terminate, syscall.SIGTERM)
+	defer signal.Stop(terminate)
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start the API server: %w", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	for {
+		select {
+		case sig := <-terminate:
+			cmd.Process.Signal(sig)
+		case err := <-done:
+			if err != nil {
+				return fmt.Errorf("API server exited: %w", err)
+			}
+			return nil
+		}
+	}
+}
@@ -2,12 +2,18 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/anoldguy/tse/cmd/tse/aclbackup"
+	"github.com/anoldguy/tse/cmd/tse/config"
 	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/routes"
 	"github.com/anoldguy/tse/shared/tailscale"
 )
 
@@ -28,20 +34,35 @@ Prerequisites:
 Required Flags:
   --tailnet string      Your tailnet name (e.g., yourname@github or example.com)
                         Find it by running: tailscale status
+                        (defaults to the active profile's tailnet, if set)
 
 Optional Flags:
   --status              Check configuration status without changes
   --show-acl-changes    Preview ACL changes without applying
   --skip-acl            Skip ACL configuration
   --skip-auth-key       Skip auth key creation
+  --advertise-routes    Also auto-approve these subnet routes for tag:exitnode,
+                        comma-separated ("vpc" is the nodes' VPC, 10.0.0.0/16),
+                        for 'tse <region> start --advertise-routes'
+  --rollback            Restore the ACL policy the last setup run replaced
+                        (setup backs it up before every change)
+  --yes                 Don't ask before --rollback restores a policy
+  --exit-node-users     Also add an ACL rule letting these sources use the exit
+                        nodes, comma-separated (autogroup:member, group:travel,
+                        alice@example.com); only restricts anything once the
+                        allow-all rule is gone
+  --copy                Copy the auth key to the clipboard once it's created
 
 Examples:
   tse setup --tailnet yourname@github              # Full automated setup
   tse setup --tailnet example.com --status         # Check current configuration
   tse setup --tailnet yourname@github --show-acl-changes  # Preview changes
+  tse setup --tailnet yourname@github --advertise-routes vpc --skip-auth-key
+  tse setup --tailnet yourname@github --exit-node-users group:travel --show-acl-changes
+  tse setup --tailnet yourname@github --rollback  # Undo the last ACL change
 `
 
-func runSetup(args []string) error {
+func runSetup(ctx context.Context, args []string) error {
 	// Parse flags
 	fs := flag.NewFlagSet("setup", flag.ExitOnError)
 	fs.Usage = func() {
@@ -52,13 +73,25 @@ func runSetup(args []string) error {
 	showACLChanges := fs.Bool("show-acl-changes", false, "Preview ACL changes without applying")
 	skipACL := fs.Bool("skip-acl", false, "Skip ACL configuration")
 	skipAuthKey := fs.Bool("skip-auth-key", false, "Skip auth key creation")
-	tailnetOverride := fs.String("tailnet", "", "Override tailnet detection")
+	tailnetOverride := fs.String("tailnet", os.Getenv(config.EnvTailnet), "Override tailnet detection")
+	routeSpec := fs.String("advertise-routes", "", "Subnet routes to auto-approve for tag:exitnode")
+	rollback := fs.Bool("rollback", false, "Restore the ACL policy the last setup run replaced")
+	yes := fs.Bool("yes", false, "Don't ask before --rollback restores a policy")
+	userSpec := fs.String("exit-node-users", "", "Sources to allow to use the exit nodes")
+	copyKey := fs.Bool("copy", false, "Copy the auth key to the clipboard")
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
-	ctx := context.Background()
+	advertised, err := routes.Parse(*routeSpec)
+	if err != nil {
+		return fmt.Errorf("--advertise-routes: %w", err)
+	}
+	exitNodeUsers, err := parseExitNodeUsers(*userSpec)
+	if err != nil {
+		return fmt.Errorf("--exit-node-users: %w", err)
+	}
 
 	// Check for API token
 	apiToken := os.Getenv("TAILSCALE_API_TOKEN")
@@ -120,9 +153,13 @@ Example: tse setup --tailnet yourname@github`)
 		return runStatusCheck(ctx, client)
 	}
 
+	if *rollback {
+		return rollbackACL(ctx, client, *yes)
+	}
+
 	// ACL configuration
 	if !*skipACL {
-		if err := configureACL(ctx, client, owner, *showACLChanges); err != nil {
+		if err := configureACL(ctx, client, owner, advertised, exitNodeUsers, *showACLChanges); err != nil {
 			return err
 		}
 	} else {
@@ -150,6 +187,12 @@ Example: tse setup --tailnet yourname@github`)
 		if err := displayAuthKey(authKey); err != nil {
 			return err
 		}
+		if *copyKey {
+			fmt.Println()
+			if err := copyToClipboard(ctx, []copyItem{{Name: "TAILSCALE_AUTH_KEY", Value: authKey, Secret: true}}); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Success summary
@@ -196,6 +239,21 @@ func runStatusCheck(ctx context.Context, client *tailscale.Client) error {
 	owners := tailscale.GetTagOwners(aclResp.ACL, "tag:exitnode")
 	fmt.Printf("  - tag:exitnode owners: %s\n", strings.Join(owners, ", "))
 	fmt.Println("  - Exit node auto-approval: enabled")
+	if approved := tailscale.RoutesApprovedFor(aclResp.ACL, "tag:exitnode"); len(approved) > 0 {
+		fmt.Printf("  - Subnet route auto-approval: %s\n", strings.Join(approved, ", "))
+	}
+	switch users := tailscale.ExitNodeUsers(aclResp.ACL); {
+	case tailscale.HasAllowAll(aclResp.ACL):
+		fmt.Println("  - Exit node users: everyone (allow-all rule)")
+	case len(users) > 0:
+		fmt.Printf("  - Exit node users: %s\n", strings.Join(users, ", "))
+	}
+
+	if dir, err := aclbackup.Dir(); err == nil {
+		if n, _ := aclbackup.Count(dir, client.GetTailnet()); n > 0 {
+			fmt.Printf("  - ACL backups: %d (restore the latest with --rollback)\n", n)
+		}
+	}
 
 	// Check for auth key in environment
 	fmt.Println()
@@ -211,7 +269,7 @@ func runStatusCheck(ctx context.Context, client *tailscale.Client) error {
 	return nil
 }
 
-func configureACL(ctx context.Context, client *tailscale.Client, owner string, previewOnly bool) error {
+func configureACL(ctx context.Context, client *tailscale.Client, owner string, advertised, exitNodeUsers []string, previewOnly bool) error {
 	fmt.Println("Step 1/3: Configuring ACL policy")
 
 	// Fetch current ACL
@@ -228,6 +286,8 @@ func configureACL(ctx context.Context, client *tailscale.Client, owner string, p
 		fmt.Println()
 		fmt.Println("ACL changes that would be applied:")
 		preview := tailscale.PreviewChanges(aclResp.ACL, owner)
+		preview = append(preview, tailscale.PreviewRouteApprovers(aclResp.ACL, advertised)...)
+		preview = append(preview, tailscale.PreviewExitNodeAccess(aclResp.ACL, exitNodeUsers)...)
 		for _, line := range preview {
 			fmt.Printf("  %s\n", line)
 		}
@@ -236,8 +296,18 @@ func configureACL(ctx context.Context, client *tailscale.Client, owner string, p
 		os.Exit(0)
 	}
 
+	// A rule naming a missing group fails validation; say which one up front
+	if undefined := tailscale.UndefinedGroups(aclResp.ACL, exitNodeUsers); len(undefined) > 0 {
+		return fmt.Errorf("--exit-node-users: %s isn't defined under groups in your ACL policy", strings.Join(undefined, ", "))
+	}
+
 	// Apply changes
 	changes, modified := tailscale.ConfigureForExitNodes(aclResp.ACL, owner)
+	routeChanges, routesModified := tailscale.ConfigureRouteApprovers(aclResp.ACL, advertised)
+	accessChanges, accessModified := tailscale.ConfigureExitNodeAccess(aclResp.ACL, exitNodeUsers)
+	changes = append(changes, routeChanges...)
+	changes = append(changes, accessChanges...)
+	modified = modified || routesModified || accessModified
 	for _, change := range changes {
 		if strings.HasPrefix(change, "✓") {
 			fmt.Printf("  %s\n", change)
@@ -245,6 +315,9 @@ func configureACL(ctx context.Context, client *tailscale.Client, owner string, p
 			fmt.Printf("✓ %s\n", change)
 		}
 	}
+	if len(exitNodeUsers) > 0 && tailscale.HasAllowAll(aclResp.ACL) {
+		fmt.Println("⚠️  Your ACL still allows everything (* -> *:*); remove that rule for --exit-node-users to restrict anyone")
+	}
 
 	if !modified {
 		fmt.Println("  ACL already configured - no changes needed")
@@ -259,10 +332,21 @@ func configureACL(ctx context.Context, client *tailscale.Client, owner string, p
 	}
 	fmt.Println(" passed")
 
+	// Back up the policy as it stands, so --rollback can restore it
+	fmt.Print("✓ Backing up current ACL...")
+	backupPath, err := backupACL(ctx, client)
+	if err != nil {
+		fmt.Println(" failed")
+		return fmt.Errorf("%w (nothing was changed)", err)
+	}
+	fmt.Println(" done")
+
 	// Apply ACL
 	fmt.Print("✓ Applying ACL changes...")
 	if err := client.UpdateACL(ctx, aclResp.ACL, aclResp.ETag); err != nil {
 		fmt.Println(" failed")
+		// The backed-up policy is still the live one
+		os.Remove(backupPath)
 
 		// Check for common errors
 		if apiErr, ok := err.(*tailscale.APIError); ok {
@@ -281,10 +365,98 @@ Create a new token at: https://login.tailscale.com/admin/settings/keys`)
 		return err
 	}
 	fmt.Println(" done")
+	fmt.Println(ui.Subtle(fmt.Sprintf("  Previous policy saved to %s; undo with 'tse setup --rollback'", backupPath)))
 
 	return nil
 }
 
+// backupACL saves the tailnet's current ACL policy, as HuJSON so comments
+// survive a rollback, and returns the backup's path
+func backupACL(ctx context.Context, client *tailscale.Client) (string, error) {
+	policy, etag, err := client.GetACLHuJSON(ctx)
+	if err != nil {
+		return "", err
+	}
+	dir, err := aclbackup.Dir()
+	if err != nil {
+		return "", err
+	}
+	return aclbackup.Save(dir, &aclbackup.Backup{
+		Tailnet: client.GetTailnet(),
+		Time:    time.Now(),
+		ETag:    etag,
+		Policy:  string(policy),
+	})
+}
+
+// rollbackACL restores the policy the last setup run replaced, then drops that
+// backup so running it again goes back one more
+func rollbackACL(ctx context.Context, client *tailscale.Client, yes bool) error {
+	dir, err := aclbackup.Dir()
+	if err != nil {
+		return err
+	}
+	backup, path, err := aclbackup.Latest(dir, client.GetTailnet())
+	if err != nil {
+		return err
+	}
+	if backup == nil {
+		return fmt.Errorf("no ACL backups for %s in %s; 'tse setup' saves one each time it changes the ACL", client.GetTailnet(), dir)
+	}
+
+	fmt.Print("✓ Fetching current ACL policy...")
+	current, etag, err := client.GetACLHuJSON(ctx)
+	if err != nil {
+		fmt.Println(" failed")
+		return fmt.Errorf("failed to fetch ACL: %w", err)
+	}
+	fmt.Println(" done")
+
+	fmt.Println()
+	fmt.Printf("Backup from %s: %s\n", backup.Time.Local().Format("2006-01-02 15:04:05"), path)
+	if string(current) == backup.Policy {
+		fmt.Println(ui.Success("✓ The current ACL already matches this backup - nothing to restore"))
+		return os.Remove(path)
+	}
+	fmt.Println(ui.Warning("Restoring replaces the whole policy, including edits made since that setup run."))
+	fmt.Println()
+
+	if !yes {
+		fmt.Printf("%s Restore this ACL policy for %s? [y/N]: ", ui.Info("→"), ui.Highlight(client.GetTailnet()))
+		response, err := readLine(ctx, os.Stdin)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(strings.TrimSpace(response)) {
+		case "y", "yes":
+		default:
+			fmt.Println()
+			fmt.Println(ui.Success("✓ Cancelled - nothing was changed"))
+			return nil
+		}
+		fmt.Println()
+	}
+
+	fmt.Print("✓ Restoring ACL policy...")
+	if err := client.UpdateACLHuJSON(ctx, []byte(backup.Policy), etag); err != nil {
+		fmt.Println(" failed")
+		var apiErr *tailscale.APIError
+		if errors.As(err, &apiErr) && apiErr.IsConflict() {
+			return fmt.Errorf("ACL was modified while restoring. Please run 'tse setup --rollback' again to retry")
+		}
+		return err
+	}
+	fmt.Println(" done")
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("restored, but failed to remove the used backup: %w", err)
+	}
+	if remaining, _ := aclbackup.Count(dir, client.GetTailnet()); remaining > 0 {
+		fmt.Println(ui.Subtle(fmt.Sprintf("  %d older backup(s) left; --rollback again to go further back", remaining)))
+	}
+	return nil
+}
+
 func createAuthKey(ctx context.Context, client *tailscale.Client) (string, error) {
 	fmt.Println("Step 2/3: Creating reusable auth key")
 
@@ -332,3 +504,23 @@ func displayAuthKey(authKey string) error {
 
 	return nil
 }
+
+// parseExitNodeUsers splits a comma-separated list of ACL sources, rejecting
+// anything that isn't a user, group, tag or autogroup
+func parseExitNodeUsers(spec string) ([]string, error) {
+	var users []string
+	for _, user := range strings.Split(spec, ",") {
+		user = strings.TrimSpace(user)
+		switch {
+		case user == "":
+			continue
+		case strings.HasPrefix(user, "autogroup:"), strings.HasPrefix(user, "group:"), strings.HasPrefix(user, "tag:"), strings.Contains(user, "@"):
+			if !slices.Contains(users, user) {
+				users = append(users, user)
+			}
+		default:
+			return nil, fmt.Errorf("%q isn't a user, group:, tag: or autogroup: (e.g. autogroup:member)", user)
+		}
+	}
+	return users, nil
+}
@@ -0,0 +1,231 @@
+// Package snapshot remembers what `tse status` saw last time, so that
+// `tse status --diff` can report what changed since: resources created or
+// deleted, Lambda configuration that drifted, and exit nodes that appeared,
+// changed state, or went away.
+//
+// Snapshots live next to the usage log in the user's state directory, one per
+// deployment (AWS profile and region), so switching profiles doesn't report
+// every resource as changed.
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Node is an exit node as seen by status
+type Node struct {
+	InstanceID string `json:"instance_id"`
+	Region     string `json:"region"`
+	State      string `json:"state"`
+	Hostname   string `json:"hostname,omitempty"`
+}
+
+// Snapshot is one deployment's status at a point in time
+type Snapshot struct {
+	Time      time.Time         `json:"time"`
+	Resources map[string]string `json:"resources"` // Display name → name or ARN; absent if missing
+	Settings  map[string]string `json:"settings"`  // Configuration and drift worth watching
+	// Regions whose nodes were listed successfully; nodes in other regions are unknown
+	NodeRegions []string `json:"node_regions,omitempty"`
+	Nodes       []Node   `json:"nodes,omitempty"`
+}
+
+// file holds the latest snapshot for each deployment
+type file struct {
+	Deployments map[string]*Snapshot `json:"deployments"`
+}
+
+// Key identifies a deployment by the AWS profile and region it was found with
+func Key(awsProfile, awsRegion string) string {
+	if awsProfile == "" {
+		awsProfile = "default"
+	}
+	return awsProfile + "/" + awsRegion
+}
+
+// Path returns the snapshot file location: $XDG_STATE_HOME/tse/status.json,
+// then ~/.local/state/tse/status.json
+func Path() (string, error) {
+	if state := os.Getenv("XDG_STATE_HOME"); state != "" {
+		return filepath.Join(state, "tse", "status.json"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "tse", "status.json"), nil
+}
+
+// Load returns the snapshot stored for key, or nil if there isn't one
+func Load(path, key string) (*Snapshot, error) {
+	f, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	return f.Deployments[key], nil
+}
+
+func load(path string) (*file, error) {
+	f := &file{Deployments: map[string]*Snapshot{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status snapshot: %w", err)
+	}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("failed to parse status snapshot %s: %w", path, err)
+	}
+	if f.Deployments == nil {
+		f.Deployments = map[string]*Snapshot{}
+	}
+	return f, nil
+}
+
+// Save stores s as the latest snapshot for key, keeping other deployments'
+func Save(path, key string, s *Snapshot) error {
+	f, err := load(path)
+	if err != nil {
+		return err
+	}
+	f.Deployments[key] = s
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode status snapshot: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+
+	// Write and rename so an interrupted status can't leave a truncated file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write status snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write status snapshot: %w", err)
+	}
+	return nil
+}
+
+// CarryNodes copies node information from prev for any region s didn't list,
+// so a status run that skips (or fails to reach) the Lambda doesn't forget them
+func (s *Snapshot) CarryNodes(prev *Snapshot) {
+	if prev == nil {
+		return
+	}
+	for _, region := range prev.NodeRegions {
+		if slices.Contains(s.NodeRegions, region) {
+			continue
+		}
+		s.NodeRegions = append(s.NodeRegions, region)
+		for _, node := range prev.Nodes {
+			if node.Region == region {
+				s.Nodes = append(s.Nodes, node)
+			}
+		}
+	}
+	sort.Strings(s.NodeRegions)
+}
+
+// Change kinds
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Change is one difference between two snapshots
+type Change struct {
+	Kind    string // Added, Removed, or Changed
+	Subject string // "Lambda Function", "Lambda memory", "node i-0abc (ohio)"
+	From    string // Empty when added
+	To      string // Empty when removed
+}
+
+// Diff lists what changed from prev to cur: resources, then settings, then
+// nodes. Nodes are only compared in regions both snapshots listed.
+func Diff(prev, cur *Snapshot) []Change {
+	changes := diffMaps(prev.Resources, cur.Resources)
+	changes = append(changes, diffMaps(prev.Settings, cur.Settings)...)
+
+	oldNodes := map[string]Node{}
+	for _, node := range prev.Nodes {
+		if slices.Contains(cur.NodeRegions, node.Region) {
+			oldNodes[node.InstanceID] = node
+		}
+	}
+	newNodes := map[string]Node{}
+	for _, node := range cur.Nodes {
+		if slices.Contains(prev.NodeRegions, node.Region) {
+			newNodes[node.InstanceID] = node
+		}
+	}
+
+	var nodeChanges []Change
+	for id, node := range newNodes {
+		old, ok := oldNodes[id]
+		switch {
+		case !ok:
+			nodeChanges = append(nodeChanges, Change{Kind: Added, Subject: node.subject(), To: node.State})
+		case old.State != node.State:
+			nodeChanges = append(nodeChanges, Change{Kind: Changed, Subject: node.subject(), From: old.State, To: node.State})
+		}
+	}
+	for id, node := range oldNodes {
+		if _, ok := newNodes[id]; !ok {
+			nodeChanges = append(nodeChanges, Change{Kind: Removed, Subject: node.subject(), From: node.State})
+		}
+	}
+	sort.Slice(nodeChanges, func(i, j int) bool { return nodeChanges[i].Subject < nodeChanges[j].Subject })
+
+	return append(changes, nodeChanges...)
+}
+
+func (n Node) subject() string {
+	if n.Hostname != "" {
+		return fmt.Sprintf("node %s %s (%s)", n.InstanceID, n.Hostname, n.Region)
+	}
+	return fmt.Sprintf("node %s (%s)", n.InstanceID, n.Region)
+}
+
+// diffMaps compares two maps key by key, in key order
+func diffMaps(prev, cur map[string]string) []Change {
+	keys := map[string]bool{}
+	for k := range prev {
+		keys[k] = true
+	}
+	for k := range cur {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var changes []Change
+	for _, k := range sorted {
+		old, hadOld := prev[k]
+		val, hasNew := cur[k]
+		switch {
+		case !hadOld:
+			changes = append(changes, Change{Kind: Added, Subject: k, To: val})
+		case !hasNew:
+			changes = append(changes, Change{Kind: Removed, Subject: k, From: old})
+		case old != val:
+			changes = append(changes, Change{Kind: Changed, Subject: k, From: old, To: val})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,89 @@
+package snapshot
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	prev := &Snapshot{
+		Resources:   map[string]string{"Lambda Function": "arn:1", "DynamoDB Table": "tse"},
+		Settings:    map[string]string{"Lambda memory": "256 MB", "Log retention": "14 days"},
+		NodeRegions: []string{"ohio", "tokyo"},
+		Nodes: []Node{
+			{InstanceID: "i-stays", Region: "ohio", State: "pending"},
+			{InstanceID: "i-gone", Region: "ohio", State: "running"},
+			{InstanceID: "i-unknown", Region: "tokyo", State: "running"}, // tokyo not listed this time
+		},
+	}
+	cur := &Snapshot{
+		Resources:   map[string]string{"Lambda Function": "arn:2", "Function URL": "https://x"},
+		Settings:    map[string]string{"Lambda memory": "128 MB", "Log retention": "14 days"},
+		NodeRegions: []string{"ohio", "sydney"},
+		Nodes: []Node{
+			{InstanceID: "i-stays", Region: "ohio", State: "running"},
+			{InstanceID: "i-new", Region: "ohio", State: "pending", Hostname: "exit-ohio"},
+			{InstanceID: "i-sydney", Region: "sydney", State: "running"}, // sydney not listed last time
+		},
+	}
+
+	var got []string
+	for _, c := range Diff(prev, cur) {
+		got = append(got, fmt.Sprintf("%s %s [%s→%s]", c.Kind, c.Subject, c.From, c.To))
+	}
+	want := []string{
+		"removed DynamoDB Table [tse→]",
+		"added Function URL [→https://x]",
+		"changed Lambda Function [arn:1→arn:2]",
+		"changed Lambda memory [256 MB→128 MB]",
+		"removed node i-gone (ohio) [running→]",
+		"added node i-new exit-ohio (ohio) [→pending]",
+		"changed node i-stays (ohio) [pending→running]",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Diff =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestCarryNodes(t *testing.T) {
+	prev := &Snapshot{
+		NodeRegions: []string{"ohio", "tokyo"},
+		Nodes:       []Node{{InstanceID: "i-1", Region: "ohio"}, {InstanceID: "i-2", Region: "tokyo"}},
+	}
+	cur := &Snapshot{NodeRegions: []string{"ohio"}} // Listed ohio: nothing running
+
+	cur.CarryNodes(prev)
+	if fmt.Sprint(cur.NodeRegions) != "[ohio tokyo]" {
+		t.Errorf("NodeRegions = %v", cur.NodeRegions)
+	}
+	if len(cur.Nodes) != 1 || cur.Nodes[0].InstanceID != "i-2" {
+		t.Errorf("Nodes = %+v, want only tokyo's node carried over", cur.Nodes)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tse", "status.json")
+
+	if s, err := Load(path, "k"); err != nil || s != nil {
+		t.Fatalf("Load with no file = %v, %v; want nil, nil", s, err)
+	}
+
+	a := &Snapshot{Time: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), Resources: map[string]string{"IAM Role": "r"}}
+	b := &Snapshot{Resources: map[string]string{"IAM Role": "other"}}
+	if err := Save(path, Key("", "us-east-2"), a); err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(path, Key("family", "us-east-2"), b); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Load(path, Key("", "us-east-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || !got.Time.Equal(a.Time) || got.Resources["IAM Role"] != "r" {
+		t.Errorf("Load = %+v, want the first deployment's snapshot", got)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/cmd/tse/usage"
+)
+
+const statsUsage = `Usage: tse stats [flags]
+
+Summarize your own TSE usage from the local usage log
+
+TSE records which commands you run, whether they succeeded, and when exit
+nodes start and stop. The log never leaves your machine; nothing is sent to
+AWS, Tailscale, or anywhere else. Set TSE_USAGE_LOG=off to stop recording.
+
+Optional Flags:
+  --days int    Only include the last N days (default: all history)
+
+Examples:
+  tse stats             # All-time summary
+  tse stats --days 30   # Last 30 days
+`
+
+// trackCommand runs fn and records the outcome in the local usage log
+func trackCommand(command, region string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+
+	event := usage.Event{
+		Time:       start,
+		Kind:       usage.KindCommand,
+		Command:    command,
+		Region:     region,
+		Success:    err == nil,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	usage.Record(event)
+
+	done := ui.Event{Type: ui.EventCommandDone, Step: command, Region: region, DurationMS: event.DurationMS, Error: event.Error}
+	if err != nil {
+		done.Type = ui.EventCommandFailed
+	}
+	ui.Emit(done)
+
+	if isInterrupted(err) {
+		return &interruptedError{command: command, region: region, err: err}
+	}
+	return err
+}
+
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, statsUsage)
+	}
+
+	days := fs.Int("days", 0, "Only include the last N days")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	path, err := usage.Path()
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		fmt.Println(ui.Subtle(fmt.Sprintf("Usage logging is disabled (%s=off).", usage.EnvUsageLog)))
+		return nil
+	}
+
+	events, err := usage.Load()
+	if err != nil {
+		return err
+	}
+
+	var since time.Time
+	if *days > 0 {
+		since = time.Now().AddDate(0, 0, -*days)
+	}
+	stats := usage.Summarize(events, since)
+
+	if stats.TotalRuns == 0 && len(stats.Sessions) == 0 {
+		fmt.Println(ui.Subtle("No usage recorded yet."))
+		fmt.Println(ui.Subtle(path))
+		return nil
+	}
+
+	period := "all time"
+	if *days > 0 {
+		period = fmt.Sprintf("last %d days", *days)
+	}
+	fmt.Println(ui.Title(fmt.Sprintf("TSE usage (%s)", period)))
+	fmt.Println()
+
+	fmt.Printf("%s %d (%s succeeded)\n",
+		ui.Label("Commands run:"),
+		stats.TotalRuns,
+		ui.Bold(fmt.Sprintf("%.0f%%", stats.SuccessRate()*100)))
+	fmt.Printf("%s %d\n", ui.Label("Exit node sessions:"), len(stats.Sessions))
+	if avg := stats.AverageSession(); avg > 0 {
+		fmt.Printf("%s %s\n", ui.Label("Average session:"), ui.Bold(formatSessionDuration(avg)))
+	}
+	if stats.OpenSessions > 0 {
+		fmt.Printf("%s %d\n", ui.Label("Still running:"), stats.OpenSessions)
+	}
+
+	if len(stats.Regions) > 0 {
+		fmt.Println()
+		fmt.Println(ui.Title("Favorite regions"))
+		table := ui.NewTable("Region", "Starts", "Time Connected")
+		for _, region := range stats.Regions {
+			table.AddRow(region.Region, fmt.Sprintf("%d", region.Starts), formatSessionDuration(region.TotalDuration))
+		}
+		fmt.Println(table.Render())
+	}
+
+	if len(stats.Commands) > 0 {
+		fmt.Println()
+		fmt.Println(ui.Title("Commands"))
+		table := ui.NewTable("Command", "Runs", "Failures", "Success Rate")
+		for _, c := range stats.Commands {
+			rate := float64(c.Runs-c.Failures) / float64(c.Runs) * 100
+			table.AddRow(c.Command, fmt.Sprintf("%d", c.Runs), fmt.Sprintf("%d", c.Failures), fmt.Sprintf("%.0f%%", rate))
+		}
+		fmt.Println(table.Render())
+	}
+
+	fmt.Println()
+	fmt.Println(ui.Subtle(path))
+
+	return nil
+}
+
+// formatSessionDuration renders durations at minute precision (e.g. "1h 25m")
+func formatSessionDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Minute {
+		return "<1m"
+	}
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+	if hours == 0 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh %dm", hours, minutes)
+}
@@ -2,15 +2,75 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/anoldguy/tse/cmd/tse/infrastructure"
+	"github.com/anoldguy/tse/cmd/tse/snapshot"
 	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
 )
 
+const statusUsage = `Usage: tse status [flags]
+
+Show the deployment status of TSE's AWS infrastructure
+
+Every run records what it found, so the next 'tse status --diff' can show
+what changed since: resources created or deleted, Lambda configuration that
+drifted, and exit nodes that were launched, changed state, or went away.
+With --diff, nothing is printed to stdout when nothing changed, so it can
+run from cron and only send mail when something happens.
+
+Flags:
+  --diff      Show only what changed since the last recorded status
+  --output    table (default), compact (one line for the deployment, then one
+              per exit node, for tmux status bars), or wide (the table, then
+              every exit node with its type, AMI, IPs and cost). Exit nodes
+              need TSE_LAMBDA_URL.
+
+Examples:
+  tse status
+  tse status --diff
+  tse status --output compact
+  */30 * * * * tse status --diff   # crontab: mail on changes
+`
+
 // runStatus displays the current state of TSE infrastructure.
-func runStatus(args []string) error {
-	ctx := context.Background()
+func runStatus(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, statusUsage)
+	}
+
+	diff := fs.Bool("diff", false, "Show only what changed since the last recorded status")
+	outputFlag := fs.String("output", "", "Output format: table, compact or wide")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+	output, err := parseOutputFormat(*outputFlag, outputTable, outputCompact, outputWide)
+	if err != nil {
+		return err
+	}
+	if *diff && output != "" {
+		return fmt.Errorf("--diff prints changes only, so it doesn't take --output")
+	}
+
+	// With --diff or compact output only the result goes to stdout; progress goes to stderr
+	out := os.Stdout
+	if *diff || output.scripted() {
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = out }()
+	}
 
 	// Get default AWS region from user's configuration
 	region, err := infrastructure.GetDefaultRegion(ctx)
@@ -27,6 +87,15 @@ func runStatus(args []string) error {
 	if err != nil {
 		return fmt.Errorf("discovery failed: %w", err)
 	}
+
+	current := statusSnapshot(state)
+	if *diff {
+		return runStatusDiff(ctx, out, region, current)
+	}
+	defer saveStatusSnapshot(region, current)
+	if output == outputCompact {
+		return printStatusCompact(ctx, out, region, state)
+	}
 	fmt.Println()
 
 	if !state.Exists() {
@@ -46,6 +115,14 @@ func runStatus(args []string) error {
 		return ""
 	}())
 
+	// DynamoDB Table
+	addResourceRow(table, "DynamoDB Table", state.Table != nil, func() string {
+		if state.Table != nil {
+			return state.Table.Name
+		}
+		return ""
+	}())
+
 	// IAM Role
 	addResourceRow(table, "IAM Role", state.IAMRole != nil, func() string {
 		if state.IAMRole != nil {
@@ -54,6 +131,14 @@ func runStatus(args []string) error {
 		return ""
 	}())
 
+	// Exit node instance profile
+	addResourceRow(table, "Node Instance Profile", state.NodeProfile != nil, func() string {
+		if state.NodeProfile != nil {
+			return state.NodeProfile.Name
+		}
+		return ""
+	}())
+
 	// Managed Policy Attachment
 	addResourceRow(table, "Managed Policy Attachment", state.Policies.Managed, func() string {
 		if state.Policies.Managed {
@@ -76,6 +161,28 @@ func runStatus(args []string) error {
 	// Function URL
 	addResourceRow(table, "Function URL", state.FunctionURL != "", state.FunctionURL)
 
+	// Optional node age alarm, only shown once deployed
+	if state.Alarm != nil {
+		addResourceRow(table, "Node Age Alarm", true, fmt.Sprintf("%s (over %sh)", state.Alarm.Name, state.Alarm.Tags["ThresholdHours"]))
+	}
+	if state.Alarm != nil || state.Schedule != nil {
+		addResourceRow(table, "Metrics Schedule", state.Schedule != nil, func() string {
+			if state.Schedule != nil {
+				return state.Schedule.Name
+			}
+			return ""
+		}())
+	}
+	if state.WarmSchedule != nil {
+		addResourceRow(table, "Warm-keeper Schedule", true, state.WarmSchedule.Name)
+	}
+	if state.Workflow != nil {
+		addResourceRow(table, "Step Functions Workflow", true, state.Workflow.Name)
+	}
+	if state.LaunchTemplate != nil {
+		addResourceRow(table, "Launch Template", true, fmt.Sprintf("%s (%s)", state.LaunchTemplate.Name, state.LaunchTemplate.Tags["Version"]))
+	}
+
 	// Render table
 	fmt.Println(table.Render())
 
@@ -110,9 +217,214 @@ func runStatus(args []string) error {
 		fmt.Printf("\n%s Run 'tse deploy' to create missing resources\n", ui.Info("→"))
 	}
 
+	if unmanaged := state.Unmanaged(); len(unmanaged) > 0 {
+		fmt.Println()
+		fmt.Println(ui.Warning(fmt.Sprintf("⚠️  %d resource(s) are missing the ManagedBy=tse tag", len(unmanaged))))
+		fmt.Println(ui.Subtle("   These look like an older OpenTofu/Terraform deployment."))
+		fmt.Printf("%s Run 'tse adopt' to bring them under management\n", ui.Info("→"))
+	}
+
+	if output == outputWide {
+		fmt.Println()
+		if os.Getenv("TSE_LAMBDA_URL") == "" || state.FunctionURL == "" {
+			fmt.Println(ui.Subtle("Exit nodes aren't listed: set TSE_LAMBDA_URL to the deployment's function URL"))
+			return nil
+		}
+		nodes, err := fetchNodes(ctx, os.Getenv("TSE_LAMBDA_URL"), "Exit nodes in all regions", regions.GetAllFriendlyNames(), false)
+		if err != nil {
+			return err
+		}
+		if len(nodes) == 0 {
+			fmt.Println(ui.Subtle("No exit nodes found in any region."))
+			return nil
+		}
+		return printNodes(os.Stdout, outputWide, nodes)
+	}
+
 	return nil
 }
 
+// printStatusCompact writes the deployment's state to out in one line, e.g.
+// "us-east-2: deployed", then a line per exit node when TSE_LAMBDA_URL is set
+func printStatusCompact(ctx context.Context, out io.Writer, region string, state *infrastructure.InfrastructureState) error {
+	switch {
+	case !state.Exists():
+		fmt.Fprintf(out, "%s: not deployed\n", region)
+		return nil
+	case state.IsComplete():
+		fmt.Fprintf(out, "%s: deployed\n", region)
+	default:
+		fmt.Fprintf(out, "%s: incomplete, %d missing\n", region, len(state.Missing()))
+	}
+
+	lambdaURL := os.Getenv("TSE_LAMBDA_URL")
+	if lambdaURL == "" || state.FunctionURL == "" {
+		return nil
+	}
+	nodes, err := fetchNodes(ctx, lambdaURL, "Exit nodes in all regions", regions.GetAllFriendlyNames(), false)
+	if err != nil {
+		return err
+	}
+	return printNodes(out, outputCompact, nodes)
+}
+
+// runStatusDiff prints what changed since the last recorded status and records
+// the current one. Only the changes are written to out.
+func runStatusDiff(ctx context.Context, out io.Writer, region string, current *snapshot.Snapshot) error {
+	if lambdaURL := os.Getenv("TSE_LAMBDA_URL"); lambdaURL != "" && current.Resources["Function URL"] != "" {
+		collectStatusNodes(ctx, lambdaURL, current)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	path, err := snapshot.Path()
+	if err != nil {
+		return err
+	}
+	key := snapshot.Key(os.Getenv("AWS_PROFILE"), region)
+	previous, err := snapshot.Load(path, key)
+	if err != nil {
+		return err
+	}
+	current.CarryNodes(previous)
+	if err := snapshot.Save(path, key, current); err != nil {
+		return err
+	}
+
+	if previous == nil {
+		fmt.Fprintf(os.Stderr, "%s No earlier status recorded for %s; this run is the baseline\n", ui.Info("→"), ui.Highlight(region))
+		return nil
+	}
+
+	changes := snapshot.Diff(previous, current)
+	if len(changes) == 0 {
+		fmt.Fprintln(os.Stderr, ui.Subtle(fmt.Sprintf("No changes since %s", previous.Time.Local().Format("2006-01-02 15:04"))))
+		return nil
+	}
+
+	fmt.Fprintf(out, "%s in %s since %s:\n", ui.Bold(fmt.Sprintf("%d change(s)", len(changes))),
+		region, previous.Time.Local().Format("2006-01-02 15:04"))
+	for _, change := range changes {
+		switch change.Kind {
+		case snapshot.Added:
+			fmt.Fprintf(out, "  %s %s %s\n", ui.Success("+"), change.Subject, ui.Subtle(change.To))
+		case snapshot.Removed:
+			fmt.Fprintf(out, "  %s %s %s\n", ui.Error("-"), change.Subject, ui.Subtle(change.From))
+		default:
+			fmt.Fprintf(out, "  %s %s %s → %s\n", ui.Warning("~"), change.Subject, change.From, change.To)
+		}
+	}
+	return nil
+}
+
+// collectStatusNodes lists exit nodes in every region into s. Regions that fail
+// are left out, so their nodes are carried over rather than reported as gone.
+func collectStatusNodes(ctx context.Context, lambdaURL string, s *snapshot.Snapshot) {
+	var mu sync.Mutex
+	results := ui.FanOut("Exit nodes in all regions", regions.GetAllFriendlyNames(), func(region string) (string, error) {
+		instancesResp, err := listRegionInstances(ctx, lambdaURL, region)
+		if err != nil {
+			return "", err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		s.NodeRegions = append(s.NodeRegions, region)
+		for _, instance := range instancesResp.Instances {
+			s.Nodes = append(s.Nodes, snapshot.Node{
+				InstanceID: instance.InstanceID,
+				Region:     region,
+				State:      instance.State,
+				Hostname:   instance.TailscaleHostname,
+			})
+		}
+		return fmt.Sprintf("%d instance(s)", instancesResp.Count), nil
+	})
+	printFanOutFailures(results)
+}
+
+// statusSnapshot records the resources and configuration status reports on
+func statusSnapshot(state *infrastructure.InfrastructureState) *snapshot.Snapshot {
+	s := &snapshot.Snapshot{
+		Time:      time.Now().UTC(),
+		Resources: map[string]string{},
+		Settings:  map[string]string{},
+	}
+
+	resources := map[string]*infrastructure.Resource{
+		"CloudWatch Log Group":    state.LogGroup,
+		"DynamoDB Table":          state.Table,
+		"IAM Role":                state.IAMRole,
+		"Node Instance Profile":   state.NodeProfile,
+		"Lambda Function":         state.Lambda,
+		"Node Age Alarm":          state.Alarm,
+		"Metrics Schedule":        state.Schedule,
+		"Warm-keeper Schedule":    state.WarmSchedule,
+		"Step Functions Workflow": state.Workflow,
+		"Workflow Role":           state.WorkflowRole,
+		"Launch Template":         state.LaunchTemplate,
+	}
+	for name, resource := range resources {
+		if resource != nil {
+			s.Resources[name] = resource.Name
+		}
+	}
+	if state.Policies.Managed {
+		s.Resources["Managed Policy Attachment"] = "AWSLambdaBasicExecutionRole"
+	}
+	if state.Policies.InlineName != "" {
+		s.Resources["Inline Policy"] = state.Policies.InlineName
+	}
+	if state.FunctionURL != "" {
+		s.Resources["Function URL"] = state.FunctionURL
+	}
+
+	if state.Lambda != nil {
+		s.Settings["Lambda memory"] = fmt.Sprintf("%d MB", state.Config.LambdaMemoryMB)
+		s.Settings["Lambda timeout"] = fmt.Sprintf("%ds", state.Config.LambdaTimeout)
+		s.Settings["Lambda environment variables"] = strings.Join(state.Config.LambdaEnvKeys, ", ")
+	}
+	if state.LogGroup != nil {
+		if state.Config.LogRetentionDays == 0 {
+			s.Settings["Log retention"] = "never expire"
+		} else {
+			s.Settings["Log retention"] = fmt.Sprintf("%d days", state.Config.LogRetentionDays)
+		}
+	}
+	// Documents that aren't worth storing whole: record whether they match deploy's
+	for _, drift := range infrastructure.DetectDrift(state) {
+		if drift.Field == "document" || drift.Field == "CORS" {
+			s.Settings[drift.Resource+" "+drift.Field] = "drifted"
+		}
+	}
+	if state.Policies.InlineName != "" && s.Settings["Inline Policy document"] == "" {
+		s.Settings["Inline Policy document"] = "as deployed"
+	}
+	if state.FunctionURL != "" && s.Settings["Function URL CORS"] == "" {
+		s.Settings["Function URL CORS"] = "as deployed"
+	}
+	return s
+}
+
+// saveStatusSnapshot records s for the next 'tse status --diff', keeping the
+// nodes the previous snapshot knew about since plain status doesn't list them
+func saveStatusSnapshot(region string, s *snapshot.Snapshot) {
+	path, err := snapshot.Path()
+	if err != nil {
+		return
+	}
+	key := snapshot.Key(os.Getenv("AWS_PROFILE"), region)
+	previous, err := snapshot.Load(path, key)
+	if err == nil {
+		s.CarryNodes(previous)
+		err = snapshot.Save(path, key, s)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s couldn't record status for --diff: %v\n", ui.Warning("Warning:"), err)
+	}
+}
+
 // addResourceRow adds a resource row to the table with proper styling
 func addResourceRow(table *ui.Table, name string, exists bool, details string) {
 	var status string
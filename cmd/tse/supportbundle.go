@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/bundle"
+	"github.com/anoldguy/tse/cmd/tse/config"
+	"github.com/anoldguy/tse/cmd/tse/deprecation"
+	"github.com/anoldguy/tse/cmd/tse/infrastructure"
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const supportBundleUsage = `Usage: tse support-bundle [flags]
+
+Collect a sanitized tar.gz to attach to a bug report
+
+The bundle contains:
+  version.txt        CLI version, Go version and platform
+  environment.txt    Which TSE/AWS/Tailscale variables are set (secrets are not included)
+  config.json        Your profiles, with auth tokens removed
+  doctor.json        The same checks as 'tse doctor', and deprecated settings in use
+  state.json         Discovered AWS infrastructure and any drift (as in 'tse deploy --plan')
+  lambda-logs.jsonl  Recent Lambda log events
+  audit.json         The last few audit entries (needs the admin scope)
+  errors.txt         Anything that couldn't be collected
+
+Known secrets (auth tokens, Tailscale keys, webhook URLs, AWS account IDs, the
+function URL hostname) are redacted and IP addresses are truncated. Nothing is
+written until you've reviewed the contents and confirmed.
+
+Flags:
+  --out <file>         Output file (default: tse-support-<time>.tar.gz)
+  --since <duration>   How much Lambda log history to include (default: 1h)
+  --log-limit <n>      Maximum log events to include (default: 500)
+  --audit-limit <n>    Audit entries to include (default: 20)
+
+Examples:
+  tse support-bundle
+  tse support-bundle --since 24h --out bug-report.tar.gz
+`
+
+// Environment variables worth describing in a bundle. Values are only shown
+// for the ones in bundleEnvValues; the rest just say whether they're set.
+var (
+	bundleEnvNames = []string{
+		"TSE_LAMBDA_URL", "TSE_AUTH_TOKEN", "TSE_PROFILE", "TSE_CONFIG", "TSE_CONFIG_PASSPHRASE", "TSE_TAILNET",
+		"TSE_USAGE_LOG", "TSE_ROLE_ARN", "TSE_ROLE_EXTERNAL_ID", "TSE_NODE_INSTANCE_PROFILE", "TSE_WEBHOOKS",
+		"TSE_SECURITY_BASELINE", "TSE_ALARM_HOURS", "TSE_ALARM_EMAIL", "TSE_BUILD_FROM_SOURCE", "TSE_LAMBDA_SRC",
+		"TSE_CUSTOM_REGIONS", "TSE_ONLY_REGIONS", "TSE_NODE_CAP_GB", "TSE_MONTHLY_CAP_GB", "TSE_KEEP_WARM",
+		"TSE_TELEGRAM_BOT_TOKEN", "TSE_TELEGRAM_CHAT_IDS",
+		"TAILSCALE_AUTH_KEY", "TAILSCALE_API_TOKEN",
+		"AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+	}
+	bundleEnvValues = []string{
+		"TSE_PROFILE", "TSE_SECURITY_BASELINE", "TSE_ALARM_HOURS", "TSE_USAGE_LOG", "TSE_BUILD_FROM_SOURCE", "TSE_CUSTOM_REGIONS", "TSE_ONLY_REGIONS", "TSE_NODE_CAP_GB", "TSE_MONTHLY_CAP_GB", "TSE_KEEP_WARM", "AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION",
+	}
+)
+
+func runSupportBundle(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("support-bundle", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, supportBundleUsage)
+	}
+
+	now := time.Now()
+	out := fs.String("out", fmt.Sprintf("tse-support-%s.tar.gz", now.Format("20060102-150405")), "Output file")
+	since := fs.String("since", "1h", "How much Lambda log history to include")
+	logLimit := fs.Int("log-limit", 500, "Maximum log events to include")
+	auditLimit := fs.Int("audit-limit", 20, "Audit entries to include")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+	logWindow, err := parseSince(*since)
+	if err != nil {
+		return err
+	}
+	if *logLimit <= 0 || *auditLimit <= 0 {
+		return fmt.Errorf("--log-limit and --audit-limit must be positive")
+	}
+
+	var b bundle.Bundle
+	var redactor *bundle.Redactor
+	err = ui.WithSpinner("Collecting support information", func() error {
+		redactor = collectSupportBundle(ctx, &b, now.Add(-logWindow), *logLimit, *auditLimit)
+		return ctx.Err()
+	})
+	if err != nil {
+		return err
+	}
+	b.Redact(redactor)
+
+	// Review: nothing is written until the user has seen what's in the bundle
+	for {
+		fmt.Println()
+		table := ui.NewTable("File", "Size")
+		for _, file := range b.Files {
+			table.AddRow(file.Name, formatBytes(int64(len(file.Data))))
+		}
+		fmt.Println(table.Render())
+		fmt.Println()
+		fmt.Println(ui.Subtle("Secrets were redacted automatically, but please check for anything you'd rather not share."))
+		fmt.Printf("%s Write %s? [v]iew contents, [y]es, [N]o: ", ui.Info("→"), ui.Highlight(*out))
+
+		response, err := readLine(ctx, os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		switch strings.ToLower(strings.TrimSpace(response)) {
+		case "v", "view":
+			for _, file := range b.Files {
+				fmt.Println()
+				fmt.Println(ui.Subheader("── " + file.Name + " ──"))
+				fmt.Print(string(file.Data))
+			}
+		case "y", "yes":
+			return writeSupportBundle(&b, *out, now)
+		default:
+			fmt.Println()
+			fmt.Println(ui.Success("✓ Cancelled - nothing was written"))
+			return nil
+		}
+	}
+}
+
+// collectSupportBundle gathers everything into b. Failures are recorded in
+// errors.txt rather than aborting, since a broken deployment is exactly when a
+// bundle is needed. Returns a Redactor that knows every secret it came across.
+func collectSupportBundle(ctx context.Context, b *bundle.Bundle, logsSince time.Time, logLimit, auditLimit int) *bundle.Redactor {
+	var problems []string
+	problem := func(what string, err error) {
+		problems = append(problems, fmt.Sprintf("%s: %v", what, err))
+	}
+
+	secrets := []string{
+		os.Getenv("TSE_AUTH_TOKEN"),
+		os.Getenv("TAILSCALE_AUTH_KEY"),
+		os.Getenv("TAILSCALE_API_TOKEN"),
+		os.Getenv("TSE_CONFIG_PASSPHRASE"),
+		os.Getenv("TSE_ROLE_EXTERNAL_ID"),
+		os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	secrets = append(secrets, strings.Split(os.Getenv("TSE_WEBHOOKS"), ",")...)
+
+	b.Add("version.txt", []byte(fmt.Sprintf("tse version %s\n%s %s/%s\n", Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)))
+	b.Add("environment.txt", bundleEnvironment())
+
+	// Config file, with tokens removed outright rather than relying on redaction
+	if cfg, err := config.Load(); err != nil {
+		problem("config", err)
+	} else {
+		for _, profile := range cfg.Profiles {
+			if profile.AuthToken != "" {
+				secrets = append(secrets, profile.AuthToken)
+				profile.AuthToken = bundle.Redacted
+			}
+		}
+		if err := b.AddJSON("config.json", cfg); err != nil {
+			problem("config", err)
+		}
+	}
+
+	lambdaURL := strings.TrimSuffix(os.Getenv("TSE_LAMBDA_URL"), "/")
+	doctor := map[string]any{
+		"checks":       setupChecks(ctx, lambdaURL),
+		"deprecations": deprecation.Active(),
+	}
+	if err := b.AddJSON("doctor.json", doctor); err != nil {
+		problem("doctor", err)
+	}
+
+	// AWS state and logs
+	region, err := infrastructure.GetDefaultRegion(ctx)
+	if err != nil {
+		problem("AWS region", err)
+	} else {
+		if state, drifts, err := infrastructure.Plan(ctx, region); err != nil {
+			problem("infrastructure discovery", err)
+		} else if err := b.AddJSON("state.json", map[string]any{"region": region, "state": state, "drift": drifts}); err != nil {
+			problem("infrastructure discovery", err)
+		}
+
+		if clients, err := infrastructure.NewAWSClients(ctx, region); err != nil {
+			problem("Lambda logs", err)
+		} else if records, err := infrastructure.RecentLogs(ctx, clients, logsSince, logLimit); err != nil {
+			problem("Lambda logs", err)
+		} else {
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			for _, record := range records {
+				if err := enc.Encode(record); err != nil {
+					problem("Lambda logs", err)
+					break
+				}
+			}
+			b.Add("lambda-logs.jsonl", buf.Bytes())
+		}
+	}
+
+	// Audit log (admin scope)
+	if lambdaURL != "" {
+		query := url.Values{}
+		query.Set("since", "168h")
+		query.Set("limit", fmt.Sprint(auditLimit))
+		var auditResp types.AuditResponse
+		if err := apiRequest(ctx, "GET", lambdaURL+"/audit?"+query.Encode(), nil, http.StatusOK, "read audit log", &auditResp); err != nil {
+			problem("audit log", errors.New(firstLine(err.Error())))
+		} else if err := b.AddJSON("audit.json", auditResp.Entries); err != nil {
+			problem("audit log", err)
+		}
+	}
+
+	if len(problems) > 0 {
+		b.Add("errors.txt", []byte(strings.Join(problems, "\n")+"\n"))
+	}
+
+	return bundle.NewRedactor(secrets...)
+}
+
+// bundleEnvironment describes the relevant environment variables without their secret values
+func bundleEnvironment() []byte {
+	names := append([]string(nil), bundleEnvNames...)
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		value, ok := os.LookupEnv(name)
+		switch {
+		case !ok || value == "":
+			fmt.Fprintf(&buf, "%s=(not set)\n", name)
+		case slices.Contains(bundleEnvValues, name):
+			fmt.Fprintf(&buf, "%s=%s\n", name, value)
+		default:
+			fmt.Fprintf(&buf, "%s=(set)\n", name)
+		}
+	}
+	return buf.Bytes()
+}
+
+// writeSupportBundle writes the reviewed bundle, refusing to overwrite an existing file
+func writeSupportBundle(b *bundle.Bundle, out string, now time.Time) error {
+	file, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", out, err)
+	}
+
+	if err := b.WriteTarGz(file, now); err != nil {
+		file.Close()
+		os.Remove(out)
+		return fmt.Errorf("failed to write %s: %w", out, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", out, err)
+	}
+
+	fmt.Println()
+	fmt.Printf("%s Wrote %s\n", ui.Checkmark(), ui.Highlight(out))
+	return nil
+}
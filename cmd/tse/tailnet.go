@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/anoldguy/tse/cmd/tse/config"
+	"github.com/anoldguy/tse/shared/tailscale"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// fillTailnetIPs fills in tailnet addresses for instances that haven't reported
+// them (older nodes, or nodes without the instance profile) by matching hostnames
+// against the Tailscale devices API. Best effort: it's skipped without
+// TAILSCALE_API_TOKEN and any API error leaves the listing as it was.
+func fillTailnetIPs(ctx context.Context, instances []*types.InstanceInfo) {
+	var missing []*types.InstanceInfo
+	for _, instance := range instances {
+		if instance.TailscaleHostname != "" && (instance.TailscaleIP == "" || instance.TailscaleIPv6 == "") {
+			missing = append(missing, instance)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	apiToken := os.Getenv("TAILSCALE_API_TOKEN")
+	if apiToken == "" {
+		return
+	}
+
+	client, err := tailscale.NewClient(apiToken)
+	if err != nil {
+		return
+	}
+	tailnet := os.Getenv(config.EnvTailnet)
+	if tailnet == "" {
+		tailnet = "-"
+	}
+	client.SetTailnet(tailnet)
+
+	devices, err := client.ListDevices(ctx)
+	if err != nil {
+		return
+	}
+
+	byName := make(map[string]tailscale.Device)
+	for _, device := range devices {
+		byName[strings.ToLower(device.ShortName())] = device
+	}
+
+	for _, instance := range missing {
+		device, ok := byName[strings.ToLower(instance.TailscaleHostname)]
+		if !ok {
+			continue
+		}
+		ipv4, ipv6 := device.TailnetIPs()
+		if instance.TailscaleIP == "" {
+			instance.TailscaleIP = ipv4
+		}
+		if instance.TailscaleIPv6 == "" {
+			instance.TailscaleIPv6 = ipv6
+		}
+	}
+}
@@ -3,17 +3,79 @@ package main
 import (
 	"bufio"
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/anoldguy/tse/cmd/tse/infrastructure"
 	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
 )
 
+const teardownUsage = `Usage: tse teardown [flags]
+
+Delete all TSE infrastructure: the Lambda, its IAM role, log groups, every exit
+node and VPC, and capacity reservations in every region
+
+Optional Flags:
+  --yes                 Skip the DELETE confirmation (for scripts and CI)
+  --only string         Comma-separated targets to delete, leaving the rest:
+                          lambda  Lambda function, function URL, metrics schedule
+                          logs    CloudWatch log group
+                          iam     Lambda role and policies, exit node instance profile
+                          alerts  CloudWatch alarm and SNS topic
+                          table   DynamoDB state table (tokens, audit log)
+  --keep-iam            Delete everything (or everything in --only) except IAM
+  --all-deployments     Also delete the IAM roles, launch templates and
+                        capacity reservations another deployment in this
+                        account created (kept by default, since it uses them)
+  --dry-run             List the AWS and Lambda calls teardown would make, with
+                        their parameters, and delete nothing
+
+A partial teardown leaves exit nodes and capacity reservations running; run
+'tse deploy' afterwards to recreate what was removed.
+
+Examples:
+  tse teardown                   # Asks you to type DELETE first
+  tse --no-ui teardown --yes     # Unattended, e.g. at the end of a CI job
+  tse teardown --only lambda     # Rebuild the function, keep its role
+  tse teardown --keep-iam        # Keep roles other tooling references
+  tse teardown --dry-run         # See exactly what would be deleted
+  tse teardown --all-deployments # Last one out of a shared account
+`
+
 // runTeardown tears down all TSE infrastructure after confirmation.
-func runTeardown(args []string) error {
-	ctx := context.Background()
+func runTeardown(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("teardown", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, teardownUsage)
+	}
+
+	yes := fs.Bool("yes", false, "Skip the DELETE confirmation")
+	only := fs.String("only", "", "Comma-separated targets to delete")
+	keepIAM := fs.Bool("keep-iam", false, "Keep IAM roles and policies")
+	dryRun := fs.Bool("dry-run", false, "List the calls teardown would make and delete nothing")
+	allDeployments := fs.Bool("all-deployments", false, "Also delete other deployments' shared resources")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+
+	targets, err := infrastructure.ParseTeardownTargets(*only)
+	if err != nil {
+		return err
+	}
+	opts := infrastructure.TeardownOptions{Only: targets, KeepIAM: *keepIAM, DryRun: *dryRun, AllDeployments: *allDeployments}
+	if !slices.ContainsFunc(infrastructure.TeardownTargets, opts.Includes) {
+		return fmt.Errorf("nothing to delete: --keep-iam excludes the only target")
+	}
 
 	// Get default AWS region from user's configuration
 	region, err := infrastructure.GetDefaultRegion(ctx)
@@ -24,44 +86,154 @@ func runTeardown(args []string) error {
 	fmt.Printf("Region: %s\n", region)
 	fmt.Println()
 
+	if *dryRun {
+		fmt.Printf("%s nothing will be deleted\n\n", ui.Info("Dry run:"))
+		if opts.Full() {
+			printReservationCancelCalls(*allDeployments)
+		}
+		return infrastructure.Teardown(ctx, region, opts)
+	}
+
 	// Show DANGER box
 	items := []string{
 		"Lambda function and function URL",
 		"IAM role and policies",
 		"CloudWatch log groups",
 		"ALL exit node instances and VPCs",
+		"Capacity reservations in every region",
+	}
+	if !opts.Full() {
+		items = teardownItems(opts)
 	}
 
-	dangerBox := ui.DangerBox(
-		"DANGER - PERMANENT DELETION",
-		items,
-		"Type 'DELETE' to confirm (anything else cancels):",
-	)
+	prompt := "Type 'DELETE' to confirm (anything else cancels):"
+	if *yes {
+		prompt = "Confirmed with --yes"
+	}
+	dangerBox := ui.DangerBox("DANGER - PERMANENT DELETION", items, prompt)
 
 	fmt.Println(dangerBox)
 	fmt.Println()
-	fmt.Print("→ ")
 
-	reader := bufio.NewReader(os.Stdin)
-	response, err := reader.ReadString('\n')
-	if err != nil {
-		return fmt.Errorf("failed to read confirmation: %w", err)
-	}
+	if !*yes {
+		fmt.Print("→ ")
+
+		response, err := readLine(ctx, os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		response = strings.TrimSpace(response)
+		if response != "DELETE" {
+			fmt.Println()
+			fmt.Println(ui.Success("✓ Teardown cancelled - nothing was deleted"))
+			return nil
+		}
 
-	response = strings.TrimSpace(response)
-	if response != "DELETE" {
 		fmt.Println()
-		fmt.Println(ui.Success("✓ Teardown cancelled - nothing was deleted"))
-		return nil
 	}
 
-	fmt.Println()
+	// A partial teardown is a rebuild, so reservations are kept for the next deploy
+	if opts.Full() {
+		if err := cancelReservationsForTeardown(ctx, *allDeployments); err != nil {
+			return err
+		}
+	}
 
 	// Execute teardown
-	err = infrastructure.Teardown(ctx, region)
+	err = infrastructure.Teardown(ctx, region, opts)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// cancelReservationsForTeardown cancels capacity reservations in every region.
+// Reservations bill until cancelled, and the Lambda is the only thing that can
+// reach them (they may be in a separate account), so this runs before it's deleted.
+// Other deployments' reservations are kept unless allDeployments is set.
+func cancelReservationsForTeardown(ctx context.Context, allDeployments bool) error {
+	lambdaURL := strings.TrimSuffix(os.Getenv("TSE_LAMBDA_URL"), "/")
+	if lambdaURL == "" {
+		fmt.Println(ui.Warning("⚠️  TSE_LAMBDA_URL isn't set, so capacity reservations weren't checked"))
+		fmt.Println(ui.Subtle("   Any you created with 'tse <region> reserve' keep billing until cancelled in the EC2 console."))
+		fmt.Println()
+		return nil
+	}
+
+	cancelled, failed := cancelAllReservations(ctx, lambdaURL, allDeployments)
+	fmt.Println()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(cancelled) > 0 {
+		fmt.Printf("%s Cancelled capacity reservations in %s\n\n", ui.Checkmark(), strings.Join(cancelled, ", "))
+	}
+	if len(failed) > 0 {
+		fmt.Println(ui.Warning(fmt.Sprintf("⚠️  Couldn't check for capacity reservations in %s", strings.Join(failed, ", "))))
+		fmt.Println(ui.Subtle("   Any left there keep billing; cancel them in the EC2 console (Capacity Reservations)."))
+		fmt.Println()
+	}
+	return nil
+}
+
+// printReservationCancelCalls lists the Lambda calls cancelReservationsForTeardown makes
+func printReservationCancelCalls(allDeployments bool) {
+	lambdaURL := strings.TrimSuffix(os.Getenv("TSE_LAMBDA_URL"), "/")
+	if lambdaURL == "" {
+		fmt.Println(ui.Subtle("TSE_LAMBDA_URL isn't set, so capacity reservations wouldn't be checked"))
+		fmt.Println()
+		return
+	}
+	fmt.Println("Before deleting anything, teardown would call the Lambda:")
+	for _, region := range regions.GetAllFriendlyNames() {
+		fmt.Printf("  POST %s/%s/%s\n", lambdaURL, region, unreserveRoute(allDeployments))
+	}
+	fmt.Println()
+}
+
+// teardownItems describes what a partial teardown deletes, for the DANGER box
+func teardownItems(opts infrastructure.TeardownOptions) []string {
+	descriptions := map[string]string{
+		infrastructure.TargetLambda: "Lambda function, function URL, and metrics schedule",
+		infrastructure.TargetLogs:   "CloudWatch log group",
+		infrastructure.TargetIAM:    "IAM roles, policies, and instance profile",
+		infrastructure.TargetAlerts: "CloudWatch alarm and SNS alert topic",
+		infrastructure.TargetTable:  "DynamoDB state table (tokens, audit log)",
+	}
+
+	var items []string
+	for _, target := range infrastructure.TeardownTargets {
+		if opts.Includes(target) {
+			items = append(items, descriptions[target])
+		}
+	}
+	return items
+}
+
+// readLine reads one line from r, giving up if ctx is cancelled (e.g., Ctrl+C at
+// the prompt) instead of blocking until the user presses Enter
+func readLine(ctx context.Context, r io.Reader) (string, error) {
+	type result struct {
+		line string
+		err  error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		line, err := bufio.NewReader(r).ReadString('\n')
+		ch <- result{line, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		fmt.Println()
+		return "", ctx.Err()
+	case res := <-ch:
+		if res.err != nil {
+			return "", fmt.Errorf("failed to read confirmation: %w", res.err)
+		}
+		return res.line, nil
+	}
+}
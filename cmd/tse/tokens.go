@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const tokensUsage = `Usage: tse tokens <command> [args]
+
+Manage scoped API tokens for the Lambda
+
+Scoped tokens let you hand out limited access (e.g. stop-only for a friend) and
+revoke one device without rotating TSE_AUTH_TOKEN. Managing tokens requires the
+admin scope; the deployment's TSE_AUTH_TOKEN has every scope.
+
+Sharing the deployment with a partner or small team? Give each person their
+own token. Nodes record which token started them ('tse <region> instances'
+shows "Started By"), and limits cap what each token's starts can launch.
+
+Commands:
+  create <name> --scopes <list>   Issue a token (the secret is shown once)
+  list                            List issued tokens
+  revoke <id>                     Revoke a token immediately
+
+Create flags:
+  --scopes <list>     Comma-separated scopes (required)
+  --max-nodes <n>     Most exit nodes the token's starts may have at once,
+                      paused ones included (default: no limit)
+  --regions <list>    Regions the token may start nodes in (default: any)
+
+Scopes:
+  read      List instances
+  start     Start exit nodes
+  stop      Stop exit nodes (including 'tse shutdown')
+  cleanup   Force-clean orphaned resources
+  admin     Manage tokens, adopt instances, and reserve capacity
+
+Examples:
+  tse tokens create friend-laptop --scopes stop,read
+  tse tokens create my-phone --scopes read,start,stop
+  tse tokens create partner --scopes read,start,stop --max-nodes 1 --regions ohio,frankfurt
+  tse tokens list
+  tse tokens revoke 3f9a2c1b7d4e
+`
+
+func runTokens(ctx context.Context, lambdaURL string, args []string) error {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, tokensUsage)
+		return fmt.Errorf("tokens command required")
+	}
+
+	switch args[0] {
+	case "create":
+		return createToken(ctx, lambdaURL, args[1:])
+
+	case "list":
+		return listTokens(ctx, lambdaURL)
+
+	case "revoke":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, tokensUsage)
+			return fmt.Errorf("usage: tse tokens revoke <id>")
+		}
+		return revokeToken(ctx, lambdaURL, args[1])
+
+	default:
+		fmt.Fprint(os.Stderr, tokensUsage)
+		return fmt.Errorf("unknown tokens command %s", ui.Highlight(args[0]))
+	}
+}
+
+func createToken(ctx context.Context, lambdaURL string, args []string) error {
+	if len(args) < 1 || args[0] == "" || args[0][0] == '-' {
+		fmt.Fprint(os.Stderr, tokensUsage)
+		return fmt.Errorf("usage: tse tokens create <name> --scopes <list>")
+	}
+	name := args[0]
+
+	fs := flag.NewFlagSet("tokens create", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, tokensUsage)
+	}
+
+	scopeList := fs.String("scopes", "", "Comma-separated scopes")
+	maxNodes := fs.Int("max-nodes", 0, "Most exit nodes the token's starts may have at once")
+	regionList := fs.String("regions", "", "Comma-separated regions the token may start nodes in")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var scopes []string
+	for _, scope := range strings.Split(*scopeList, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+		if !types.IsValidScope(scope) {
+			return fmt.Errorf("unknown scope %s (valid: %s)", ui.Highlight(scope), strings.Join(types.AllScopes, ", "))
+		}
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		return fmt.Errorf("--scopes is required (valid: %s)", strings.Join(types.AllScopes, ", "))
+	}
+	if *maxNodes < 0 {
+		return fmt.Errorf("--max-nodes can't be negative")
+	}
+
+	limits := types.TokenLimits{MaxNodes: *maxNodes}
+	for _, region := range strings.Split(*regionList, ",") {
+		region = strings.ToLower(strings.TrimSpace(region))
+		if region == "" {
+			continue
+		}
+		if _, err := regions.GetAWSRegion(region); err != nil {
+			return fmt.Errorf("unknown region %s (run 'tse regions' to list them)", ui.Highlight(region))
+		}
+		limits.Regions = append(limits.Regions, region)
+	}
+
+	var createResp types.CreateTokenResponse
+	err := ui.WithSpinner(fmt.Sprintf("Creating token %s", name), func() error {
+		return apiRequest(ctx, "POST", lambdaURL+"/tokens", types.CreateTokenRequest{Name: name, Scopes: scopes, TokenLimits: limits}, http.StatusCreated, "create token", &createResp)
+	})
+	if err != nil {
+		return err
+	}
+
+	details := []string{
+		fmt.Sprintf("Token ID:  %s", createResp.Token.ID),
+		fmt.Sprintf("Scopes:    %s", strings.Join(createResp.Token.Scopes, ", ")),
+	}
+	if createResp.Token.Limited() {
+		details = append(details, fmt.Sprintf("Limits:    %s", tokenLimits(createResp.Token.TokenLimits)))
+	}
+	details = append(details, "", fmt.Sprintf("export TSE_AUTH_TOKEN=%s", createResp.Secret))
+
+	fmt.Println()
+	fmt.Println(ui.HighlightBox("⚠️  SAVE THIS - It Won't Be Shown Again", details...))
+	fmt.Println(ui.Subtle(fmt.Sprintf("Revoke it any time with: tse tokens revoke %s", createResp.Token.ID)))
+
+	return nil
+}
+
+func listTokens(ctx context.Context, lambdaURL string) error {
+	var tokensResp types.TokensResponse
+	err := ui.WithSpinner("Fetching tokens", func() error {
+		return apiRequest(ctx, "GET", lambdaURL+"/tokens", nil, http.StatusOK, "list tokens", &tokensResp)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if len(tokensResp.Tokens) == 0 {
+		fmt.Println(ui.Subtle("No scoped tokens issued. Only TSE_AUTH_TOKEN has access."))
+		return nil
+	}
+
+	table := ui.NewTable("ID", "Name", "Scopes", "Limits", "Created", "Status")
+	for _, token := range tokensResp.Tokens {
+		status := ui.Success("active")
+		if token.Revoked() {
+			status = ui.Subtle("revoked " + token.RevokedAt.Local().Format("2006-01-02"))
+		}
+		limits := ui.Subtle("-")
+		if token.Limited() {
+			limits = tokenLimits(token.TokenLimits)
+		}
+		table.AddRow(token.ID, token.Name, strings.Join(token.Scopes, ","), limits, token.CreatedAt.Local().Format("2006-01-02 15:04"), status)
+	}
+	fmt.Println(table.Render())
+
+	return nil
+}
+
+// tokenLimits describes a token's limits, e.g. "1 node; ohio, frankfurt"
+func tokenLimits(limits types.TokenLimits) string {
+	var parts []string
+	switch {
+	case limits.MaxNodes == 1:
+		parts = append(parts, "1 node")
+	case limits.MaxNodes > 1:
+		parts = append(parts, fmt.Sprintf("%d nodes", limits.MaxNodes))
+	}
+	if len(limits.Regions) > 0 {
+		parts = append(parts, strings.Join(limits.Regions, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func revokeToken(ctx context.Context, lambdaURL, id string) error {
+	var tokensResp types.TokensResponse
+	err := ui.WithSpinner(fmt.Sprintf("Revoking token %s", id), func() error {
+		return apiRequest(ctx, "DELETE", lambdaURL+"/tokens/"+id, nil, http.StatusOK, "revoke token", &tokensResp)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("%s %s\n", ui.Checkmark(), tokensResp.Message)
+
+	return nil
+}
+
+// apiRequest sends an authenticated JSON request to the Lambda and decodes the response
+func apiRequest(ctx context.Context, method, url string, payload any, wantStatus int, operation string, out any) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	resp, err := makeAuthenticatedRequest(ctx, method, url, body)
+	if err != nil {
+		return err // Already enhanced with context
+	}
+	defer resp.Body.Close()
+
+	respBody, err := types.ReadPayload(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != wantStatus {
+		return enhanceHTTPStatusError(resp.StatusCode, string(respBody), operation)
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,371 @@
+//go:build tray
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/cmd/tse/usage"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const trayUsage = `Usage: tse tray [flags]
+
+Show exit node status in the macOS menu bar, with a menu to start or stop a
+node in each region. Runs until you choose Quit or interrupt it.
+
+Only in builds made with the tray tag:
+  go build -tags tray -o bin/tse ./cmd/tse    (or: make build-tray)
+
+Flags:
+  --regions string     Comma-separated regions or groups in the menu (default: all)
+  --interval duration  How often to refresh node state (default 30s)
+
+Examples:
+  tse tray
+  tse tray --regions eu,ohio &
+`
+
+// trayItem is one entry in the menu bar menu
+type trayItem struct {
+	Title     string
+	Enabled   bool
+	Checked   bool
+	Separator bool
+	Action    func() // Called off the UI thread
+}
+
+// trayMenu is the platform's menu bar item. SetTitle and SetItems may be called
+// from any goroutine; Run must be called on the main thread.
+type trayMenu interface {
+	SetTitle(title string)
+	SetItems(items []trayItem)
+	Run()  // Shows the item and handles clicks until Quit
+	Quit() // Removes the item and makes Run return
+}
+
+// tray keeps the menu in step with the exit nodes
+type tray struct {
+	lambdaURL string
+	regions   []string
+	menu      trayMenu
+	refresh   chan struct{}
+
+	mu       sync.Mutex
+	status   map[string]quickRegion
+	busy     map[string]string // Regions with a start or stop in flight: "starting" or "stopping"
+	stopping bool              // Stop All in flight
+	problem  string            // Last failure, shown until the next good refresh
+	updated  time.Time
+}
+
+func runTray(ctx context.Context, lambdaURL string, args []string) error {
+	fs := flag.NewFlagSet("tray", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, trayUsage)
+	}
+	regionList := fs.String("regions", "", "Comma-separated regions or groups in the menu")
+	interval := fs.Duration("interval", 30*time.Second, "How often to refresh node state")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+	if *interval < 10*time.Second {
+		return fmt.Errorf("--interval must be at least 10s")
+	}
+
+	names := regions.GetAllFriendlyNames()
+	if *regionList != "" {
+		var err error
+		if names, err = parseRegionList(*regionList); err != nil {
+			return err
+		}
+	}
+
+	menu, err := newTrayMenu()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	t := &tray{
+		lambdaURL: lambdaURL,
+		regions:   names,
+		menu:      menu,
+		refresh:   make(chan struct{}, 1),
+		status:    make(map[string]quickRegion),
+		busy:      make(map[string]string),
+	}
+	t.render(ctx)
+
+	go t.poll(ctx, *interval)
+	go func() {
+		<-ctx.Done()
+		menu.Quit()
+	}()
+
+	menu.Run()
+	return nil
+}
+
+// poll refreshes every region now, every interval, and when asked
+func (t *tray) poll(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		t.refreshAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-t.refresh:
+		}
+	}
+}
+
+// requestRefresh asks poll for a refresh without waiting for it
+func (t *tray) requestRefresh() {
+	select {
+	case t.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// refreshAll lists every region that isn't busy. A region that can't be listed
+// keeps its last status.
+func (t *tray) refreshAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed []string
+	var firstErr error
+	for _, region := range t.regions {
+		t.mu.Lock()
+		busy := t.busy[region] != ""
+		t.mu.Unlock()
+		if busy {
+			continue // The command refreshes its region when it's done
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instancesResp, err := listRegionInstances(ctx, t.lambdaURL, region)
+			if err != nil {
+				mu.Lock()
+				failed = append(failed, region)
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				return
+			}
+			t.mu.Lock()
+			if t.busy[region] == "" {
+				t.status[region] = quickRegionStatus(region, instancesResp.Instances)
+			}
+			t.mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.updated = time.Now()
+	t.problem = ""
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		t.problem = fmt.Sprintf("Couldn't list %s: %s", strings.Join(failed, ", "), firstLine(firstErr.Error()))
+	}
+	t.mu.Unlock()
+	t.render(ctx)
+}
+
+// toggle stops the region's node if one is starting or running, otherwise
+// starts one. It runs off the UI thread and can take a minute.
+func (t *tray) toggle(ctx context.Context, region string) {
+	t.mu.Lock()
+	if t.busy[region] != "" || t.stopping {
+		t.mu.Unlock()
+		return
+	}
+	current := t.status[region].Status
+	start := current == "" || current == quickOff
+	if start {
+		t.busy[region] = quickStarting
+	} else {
+		t.busy[region] = quickStopping
+	}
+	t.mu.Unlock()
+	t.render(ctx)
+
+	var problem string
+	if start {
+		_, alreadyRunning, err := startRegion(ctx, t.lambdaURL, types.StartRequest{Region: region})
+		switch {
+		case err != nil:
+			problem = fmt.Sprintf("Start in %s failed: %s", region, firstLine(err.Error()))
+		case !alreadyRunning:
+			usage.Record(usage.Event{Kind: usage.KindNodeStart, Region: region})
+		}
+	} else {
+		resp, err := stopRegion(ctx, t.lambdaURL, region)
+		switch {
+		case err != nil:
+			problem = fmt.Sprintf("Stop in %s failed: %s", region, firstLine(err.Error()))
+		case resp.TerminatedCount > 0:
+			usage.Record(usage.Event{Kind: usage.KindNodeStop, Region: region})
+		}
+	}
+
+	t.mu.Lock()
+	delete(t.busy, region)
+	if problem != "" {
+		t.problem = problem
+	}
+	t.mu.Unlock()
+	t.refreshRegion(ctx, region)
+}
+
+// stopAll stops exit nodes in every region, like tse shutdown
+func (t *tray) stopAll(ctx context.Context) {
+	t.mu.Lock()
+	if t.stopping {
+		t.mu.Unlock()
+		return
+	}
+	t.stopping = true
+	t.mu.Unlock()
+	t.render(ctx)
+
+	c, err := lambdaClient(t.lambdaURL)
+	if err == nil {
+		var stopped map[string]*types.StopResponse
+		stopped, err = c.Shutdown(ctx)
+		for region, resp := range stopped {
+			if resp.TerminatedCount > 0 {
+				usage.Record(usage.Event{Kind: usage.KindNodeStop, Region: region})
+			}
+		}
+	}
+
+	t.mu.Lock()
+	t.stopping = false
+	t.mu.Unlock()
+	t.refreshAll(ctx)
+
+	if err != nil && ctx.Err() == nil {
+		t.mu.Lock()
+		t.problem = "Stop All: " + firstLine(err.Error())
+		t.mu.Unlock()
+		t.render(ctx)
+	}
+}
+
+// refreshRegion lists one region and redraws the menu
+func (t *tray) refreshRegion(ctx context.Context, region string) {
+	instancesResp, err := listRegionInstances(ctx, t.lambdaURL, region)
+	if err == nil {
+		t.mu.Lock()
+		t.status[region] = quickRegionStatus(region, instancesResp.Instances)
+		t.mu.Unlock()
+	}
+	t.render(ctx)
+}
+
+// render redraws the menu bar title and menu from the current status
+func (t *tray) render(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var active []string
+	var items []trayItem
+	if t.problem != "" {
+		items = append(items, trayItem{Title: "⚠ " + t.problem}, trayItem{Separator: true})
+	}
+
+	for _, region := range t.regions {
+		status := t.status[region].Status
+		if busy := t.busy[region]; busy != "" {
+			status = busy
+		} else if t.stopping && status != "" && status != quickOff {
+			status = quickStopping
+		}
+		if status != "" && status != quickOff {
+			active = append(active, region)
+		}
+
+		items = append(items, trayItem{
+			Title:   trayRegionTitle(region, t.status[region], status),
+			Enabled: t.busy[region] == "" && !t.stopping && status != quickStopping,
+			Checked: status == quickStarting || status == quickReady,
+			Action:  func() { t.toggle(ctx, region) },
+		})
+	}
+
+	items = append(items, trayItem{Separator: true})
+	items = append(items, trayItem{
+		Title:   "Stop All Exit Nodes",
+		Enabled: !t.stopping,
+		Action:  func() { t.stopAll(ctx) },
+	})
+	items = append(items, trayItem{Title: "Refresh Now", Enabled: true, Action: t.requestRefresh})
+	if !t.updated.IsZero() {
+		items = append(items, trayItem{Title: "Updated " + t.updated.Format("15:04:05")})
+	}
+	items = append(items, trayItem{Separator: true})
+	items = append(items, trayItem{Title: "Quit", Enabled: true, Action: t.menu.Quit})
+
+	t.menu.SetTitle(trayTitle(active, t.updated.IsZero()))
+	t.menu.SetItems(items)
+}
+
+// trayTitle is the menu bar text: the active region, how many more there are,
+// or just "tse" when nothing is running
+func trayTitle(active []string, loading bool) string {
+	switch {
+	case loading:
+		return "tse …"
+	case len(active) == 0:
+		return "tse"
+	case len(active) == 1:
+		return "tse · " + active[0]
+	default:
+		return fmt.Sprintf("tse · %s +%d", active[0], len(active)-1)
+	}
+}
+
+// trayRegionTitle is a region's menu entry, e.g. "Frankfurt (frankfurt) — ready, 3.120.45.67"
+func trayRegionTitle(region string, r quickRegion, status string) string {
+	title := region
+	if info, ok := regions.Lookup(region); ok && info.City != "" {
+		title = fmt.Sprintf("%s (%s)", info.City, region)
+	}
+
+	switch status {
+	case "", quickOff:
+		return title
+	case quickReady:
+		if r.PublicIP != "" {
+			return fmt.Sprintf("%s — ready, %s", title, r.PublicIP)
+		}
+		return title + " — ready"
+	default:
+		return fmt.Sprintf("%s — %s…", title, status)
+	}
+}
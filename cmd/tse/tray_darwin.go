@@ -0,0 +1,102 @@
+//go:build tray && darwin && cgo
+
+package main
+
+/*
+#cgo CFLAGS: -x objective-c -fobjc-arc
+#cgo LDFLAGS: -framework Cocoa
+
+#include <stdlib.h>
+#include "tray_darwin.h"
+*/
+import "C"
+
+import (
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// Cocoa only runs on the main thread. Locking it here, before main starts,
+// keeps the main goroutine on it so runTray can call Run directly.
+func init() {
+	runtime.LockOSThread()
+}
+
+// cocoaTray is the NSStatusItem. There's only ever one, and clicks come back
+// through goTrayClicked, which finds it here.
+var cocoaTray = &cocoaMenu{}
+
+type cocoaMenu struct {
+	mu         sync.Mutex
+	generation int
+	actions    []func()
+}
+
+func newTrayMenu() (trayMenu, error) {
+	return cocoaTray, nil
+}
+
+func (m *cocoaMenu) SetTitle(title string) {
+	cTitle := C.CString(title)
+	defer C.free(unsafe.Pointer(cTitle))
+	C.traySetTitle(cTitle)
+}
+
+// SetItems replaces the menu. Each item's tag carries the generation, so a click
+// on an item from a menu that has since been replaced is ignored.
+func (m *cocoaMenu) SetItems(items []trayItem) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.generation = (m.generation + 1) % (1 << 16)
+	m.actions = make([]func(), len(items))
+
+	titles := make([]*C.char, len(items))
+	flags := make([]C.int, len(items))
+	for i, item := range items {
+		titles[i] = C.CString(item.Title)
+		defer C.free(unsafe.Pointer(titles[i]))
+		switch {
+		case item.Separator:
+			flags[i] = C.TRAY_ITEM_SEPARATOR
+			continue
+		case item.Enabled && item.Action != nil:
+			flags[i] |= C.TRAY_ITEM_ENABLED
+			m.actions[i] = item.Action
+		}
+		if item.Checked {
+			flags[i] |= C.TRAY_ITEM_CHECKED
+		}
+	}
+	if len(items) == 0 {
+		return
+	}
+	C.traySetItems(C.long(m.generation), C.int(len(items)), &titles[0], &flags[0])
+}
+
+func (m *cocoaMenu) Run() {
+	C.trayRun()
+}
+
+func (m *cocoaMenu) Quit() {
+	C.trayQuit()
+}
+
+// goTrayClicked runs a menu item's action. It's called on the main thread, so
+// the action runs in its own goroutine to keep the menu bar responsive.
+//
+//export goTrayClicked
+func goTrayClicked(tag C.long) {
+	generation, index := int(tag>>16), int(tag&0xffff)
+
+	cocoaTray.mu.Lock()
+	var action func()
+	if generation == cocoaTray.generation && index < len(cocoaTray.actions) {
+		action = cocoaTray.actions[index]
+	}
+	cocoaTray.mu.Unlock()
+
+	if action != nil {
+		go action()
+	}
+}
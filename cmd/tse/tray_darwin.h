@@ -0,0 +1,13 @@
+//go:build tray && cgo
+
+// The Cocoa side of tse tray, called from tray_darwin.go
+
+// Flags for each item passed to traySetItems
+#define TRAY_ITEM_ENABLED   1
+#define TRAY_ITEM_CHECKED   2
+#define TRAY_ITEM_SEPARATOR 4
+
+void trayRun(void);
+void trayQuit(void);
+void traySetTitle(const char *title);
+void traySetItems(long generation, int count, const char **titles, const int *flags);
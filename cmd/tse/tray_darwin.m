@@ -0,0 +1,87 @@
+//go:build tray && cgo
+
+#import <Cocoa/Cocoa.h>
+#include "tray_darwin.h"
+#include "_cgo_export.h"
+
+@interface TSETrayTarget : NSObject
+- (void)clicked:(NSMenuItem *)item;
+@end
+
+@implementation TSETrayTarget
+- (void)clicked:(NSMenuItem *)item {
+	goTrayClicked((long)item.tag);
+}
+@end
+
+static NSStatusItem *trayStatusItem;
+static TSETrayTarget *trayTarget;
+
+void trayRun(void) {
+	@autoreleasepool {
+		[NSApplication sharedApplication];
+		// An accessory app has a menu bar item but no Dock icon or app menu
+		[NSApp setActivationPolicy:NSApplicationActivationPolicyAccessory];
+
+		trayTarget = [[TSETrayTarget alloc] init];
+		trayStatusItem = [[NSStatusBar systemStatusBar] statusItemWithLength:NSVariableStatusItemLength];
+		trayStatusItem.button.title = @"tse …";
+		NSMenu *menu = [[NSMenu alloc] init];
+		menu.autoenablesItems = NO;
+		trayStatusItem.menu = menu;
+
+		[NSApp run];
+	}
+}
+
+void trayQuit(void) {
+	dispatch_async(dispatch_get_main_queue(), ^{
+		if (trayStatusItem != nil) {
+			[[NSStatusBar systemStatusBar] removeStatusItem:trayStatusItem];
+			trayStatusItem = nil;
+		}
+		[NSApp stop:nil];
+		// stop: takes effect after the next event, so post one
+		NSEvent *wake = [NSEvent otherEventWithType:NSEventTypeApplicationDefined
+			location:NSZeroPoint modifierFlags:0 timestamp:0 windowNumber:0
+			context:nil subtype:0 data1:0 data2:0];
+		[NSApp postEvent:wake atStart:YES];
+	});
+}
+
+void traySetTitle(const char *title) {
+	@autoreleasepool {
+		NSString *text = [NSString stringWithUTF8String:title];
+		dispatch_async(dispatch_get_main_queue(), ^{
+			if (trayStatusItem != nil) {
+				trayStatusItem.button.title = text;
+			}
+		});
+	}
+}
+
+void traySetItems(long generation, int count, const char **titles, const int *flags) {
+	@autoreleasepool {
+		// Copy everything now; the Go strings are freed when this returns
+		NSMutableArray<NSMenuItem *> *items = [NSMutableArray arrayWithCapacity:count];
+		for (int i = 0; i < count; i++) {
+			if (flags[i] & TRAY_ITEM_SEPARATOR) {
+				[items addObject:[NSMenuItem separatorItem]];
+				continue;
+			}
+			NSMenuItem *item = [[NSMenuItem alloc] initWithTitle:[NSString stringWithUTF8String:titles[i]]
+				action:@selector(clicked:) keyEquivalent:@""];
+			item.target = trayTarget;
+			item.tag = generation << 16 | i;
+			item.enabled = (flags[i] & TRAY_ITEM_ENABLED) != 0;
+			item.state = (flags[i] & TRAY_ITEM_CHECKED) ? NSControlStateValueOn : NSControlStateValueOff;
+			[items addObject:item];
+		}
+
+		dispatch_async(dispatch_get_main_queue(), ^{
+			if (trayStatusItem != nil) {
+				trayStatusItem.menu.itemArray = items;
+			}
+		});
+	}
+}
@@ -0,0 +1,9 @@
+//go:build tray && !(darwin && cgo)
+
+package main
+
+import "errors"
+
+func newTrayMenu() (trayMenu, error) {
+	return nil, errors.New("tse tray needs macOS, in a build with cgo enabled")
+}
@@ -0,0 +1,14 @@
+//go:build !tray
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// runTray is only in builds with the tray tag, which links Cocoa; the
+// everyday CLI stays a plain static binary.
+func runTray(ctx context.Context, lambdaURL string, args []string) error {
+	return errors.New("this tse was built without the menu bar; on macOS, build it with 'make build-tray' (go build -tags tray)")
+}
@@ -0,0 +1,86 @@
+package ui
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Event types written in --json-lines mode
+const (
+	EventStepStarted   = "step.started"
+	EventStepCompleted = "step.completed"
+	EventStepFailed    = "step.failed"
+	EventWaitAttempt   = "wait.attempt"   // One failed check while waiting (e.g. for IAM to propagate)
+	EventRegionResult  = "region.result"  // One region's result in a multi-region operation
+	EventInstanceState = "instance.state" // An instance was launched, found, or terminated
+	EventRequestRetry  = "request.retry"  // A Lambda request failed and will be retried after duration_ms
+	EventCommandDone   = "command.completed"
+	EventCommandFailed = "command.failed"
+)
+
+// Event is one line of --json-lines output
+type Event struct {
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	Step       string    `json:"step,omitempty"`
+	Region     string    `json:"region,omitempty"`
+	Instance   string    `json:"instance,omitempty"`
+	State      string    `json:"state,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Attempt    int       `json:"attempt,omitempty"`
+	DurationMS int64     `json:"duration_ms,omitempty"`
+}
+
+var (
+	eventsMu  sync.Mutex
+	eventsOut *json.Encoder
+)
+
+// EnableJSONLines switches spinners and fan-outs from the TUI to NDJSON events
+// written to w, one per line, as each step happens
+func EnableJSONLines(w io.Writer) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	eventsOut = json.NewEncoder(w)
+}
+
+// JSONLines reports whether --json-lines mode is on
+func JSONLines() bool {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	return eventsOut != nil
+}
+
+// Emit writes an event in --json-lines mode and does nothing otherwise
+func Emit(e Event) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if eventsOut == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	eventsOut.Encode(e)
+}
+
+// emitStep runs operation between step.started and step.completed/failed events
+func emitStep(step string, operation func() error) error {
+	start := time.Now()
+	Emit(Event{Type: EventStepStarted, Step: step})
+	err := operation()
+	emitStepResult(step, start, err)
+	return err
+}
+
+func emitStepResult(step string, start time.Time, err error) {
+	e := Event{Type: EventStepCompleted, Step: step, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		e.Type = EventStepFailed
+		e.Error = err.Error()
+	}
+	Emit(e)
+}
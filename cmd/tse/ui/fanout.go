@@ -0,0 +1,221 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// fanOutConcurrency caps how many per-item tasks run at once
+const fanOutConcurrency = 8
+
+// FanOutResult is the outcome of one item's task in a fan-out operation
+type FanOutResult struct {
+	Name    string
+	Summary string // Short text shown next to the name once finished
+	Err     error
+}
+
+// fanOutModel renders one line per item and updates each line as its result arrives
+type fanOutModel struct {
+	spinner  spinner.Model
+	title    string
+	results  []FanOutResult
+	finished []bool
+	pending  int
+	width    int
+	quitting bool
+}
+
+// fanOutDoneMsg is sent when a single item's task completes
+type fanOutDoneMsg struct {
+	index   int
+	summary string
+	err     error
+}
+
+func newFanOutModel(title string, names []string) fanOutModel {
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = InfoStyle
+
+	results := make([]FanOutResult, len(names))
+	width := 0
+	for i, name := range names {
+		results[i].Name = name
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+
+	return fanOutModel{
+		spinner:  s,
+		title:    title,
+		results:  results,
+		finished: make([]bool, len(names)),
+		pending:  len(names),
+		width:    width,
+	}
+}
+
+func (m fanOutModel) Init() tea.Cmd {
+	return m.spinner.Tick
+}
+
+func (m fanOutModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			m.quitting = true
+			interrupt()
+			return m, tea.Quit
+		}
+		return m, nil
+
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case fanOutDoneMsg:
+		m.results[msg.index].Summary = msg.summary
+		m.results[msg.index].Err = msg.err
+		m.finished[msg.index] = true
+		m.pending--
+		if m.pending == 0 {
+			return m, tea.Quit
+		}
+		return m, nil
+
+	default:
+		return m, nil
+	}
+}
+
+func (m fanOutModel) View() string {
+	var b strings.Builder
+
+	if m.title != "" {
+		b.WriteString(Title(m.title))
+		b.WriteString("\n\n")
+	}
+
+	for i, result := range m.results {
+		name := result.Name + strings.Repeat(" ", m.width-len(result.Name))
+
+		switch {
+		case !m.finished[i] && m.quitting:
+			fmt.Fprintf(&b, "%s %s  %s\n", Cross(), name, Subtle("interrupted"))
+		case !m.finished[i]:
+			fmt.Fprintf(&b, "%s %s\n", m.spinner.View(), name)
+		case result.Err != nil:
+			fmt.Fprintf(&b, "%s %s  %s\n", Cross(), name, Error(firstLine(result.Err.Error())))
+		default:
+			fmt.Fprintf(&b, "%s %s  %s\n", Checkmark(), name, Subtle(result.Summary))
+		}
+	}
+
+	return b.String()
+}
+
+// firstLine trims multi-line error text (troubleshooting hints, etc.) to fit on one row
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// FanOut runs task for every name concurrently, rendering one line per name that
+// updates as soon as that task finishes instead of waiting for the slowest one.
+// Results are returned in the same order as names. Items still running when the
+// user presses Ctrl+C are reported with ErrInterrupted.
+func FanOut(title string, names []string, task func(name string) (string, error)) []FanOutResult {
+	if len(names) == 0 {
+		return nil
+	}
+
+	if JSONLines() {
+		return fanOutJSONLines(title, names, task)
+	}
+	if Plain() {
+		return fanOutPlain(title, names, task)
+	}
+
+	m := newFanOutModel(title, names)
+	p := tea.NewProgram(m)
+
+	go runFanOut(names, task, func(i int, summary string, err error) {
+		p.Send(fanOutDoneMsg{index: i, summary: summary, err: err})
+	})
+
+	finalModel, err := p.Run()
+	final, ok := finalModel.(fanOutModel)
+	if err != nil || !ok {
+		// Renderer failed; report everything as unfinished rather than guessing
+		final = m
+	}
+
+	results := final.results
+	for i := range results {
+		if !final.finished[i] {
+			results[i].Err = ErrInterrupted
+		}
+	}
+	return results
+}
+
+// runFanOut runs task for every name, at most fanOutConcurrency at a time,
+// calling done as each finishes. It returns once all tasks have finished.
+func runFanOut(names []string, task func(name string) (string, error), done func(i int, summary string, err error)) {
+	sem := make(chan struct{}, fanOutConcurrency)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			summary, err := task(name)
+			done(i, summary, err)
+		}(i, name)
+	}
+	wg.Wait()
+}
+
+// fanOutJSONLines is FanOut for --json-lines mode: one region.result event per
+// name as its task finishes, between step events for the whole operation
+func fanOutJSONLines(title string, names []string, task func(name string) (string, error)) []FanOutResult {
+	results := make([]FanOutResult, len(names))
+	var failed int
+	var mu sync.Mutex
+
+	start := time.Now()
+	Emit(Event{Type: EventStepStarted, Step: title})
+	runFanOut(names, task, func(i int, summary string, err error) {
+		mu.Lock()
+		results[i] = FanOutResult{Name: names[i], Summary: summary, Err: err}
+		if err != nil {
+			failed++
+		}
+		mu.Unlock()
+
+		e := Event{Type: EventRegionResult, Step: title, Region: names[i], Message: summary}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		Emit(e)
+	})
+
+	var err error
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d failed", failed, len(names))
+	}
+	emitStepResult(title, start, err)
+	return results
+}
@@ -0,0 +1,23 @@
+package ui
+
+import "errors"
+
+// ErrInterrupted is returned when the user presses Ctrl+C while a spinner or fan-out is running
+var ErrInterrupted = errors.New("interrupted")
+
+// interruptHandler is called when Ctrl+C is pressed inside a bubbletea program
+var interruptHandler func()
+
+// OnInterrupt registers fn to run when the user presses Ctrl+C during a spinner or
+// fan-out. Bubbletea puts the terminal in raw mode, so Ctrl+C arrives as a key press
+// instead of SIGINT; this lets the caller cancel its context either way.
+func OnInterrupt(fn func()) {
+	interruptHandler = fn
+}
+
+// interrupt notifies the registered handler, if any
+func interrupt() {
+	if interruptHandler != nil {
+		interruptHandler()
+	}
+}
@@ -0,0 +1,72 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	plainMu sync.Mutex
+	plain   bool
+)
+
+// EnablePlain switches spinners and fan-outs from the TUI to plain lines, one per
+// step or result, for cron jobs, CI and anything else without a terminal
+func EnablePlain() {
+	plainMu.Lock()
+	defer plainMu.Unlock()
+	plain = true
+}
+
+// Plain reports whether plain (--no-ui) mode is on
+func Plain() bool {
+	plainMu.Lock()
+	defer plainMu.Unlock()
+	return plain
+}
+
+// IsTerminal reports whether f is a terminal. Bubbletea needs one for both input
+// and output; under cron or CI it fails or garbles the log.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// plainStep runs operation between a "message..." line and its ✓/✗ result
+func plainStep(message string, operation func() error) error {
+	fmt.Printf("%s...\n", message)
+	start := time.Now()
+	err := operation()
+	printPlainResult(message, start, err)
+	return err
+}
+
+func printPlainResult(message string, start time.Time, err error) {
+	elapsed := time.Since(start).Round(100 * time.Millisecond)
+	if err != nil {
+		fmt.Printf("%s %s (failed after %s)\n", Cross(), message, elapsed)
+		return
+	}
+	fmt.Printf("%s %s (%s)\n", Checkmark(), message, elapsed)
+}
+
+// fanOutPlain is FanOut for plain mode: a line per name as its task finishes
+func fanOutPlain(title string, names []string, task func(name string) (string, error)) []FanOutResult {
+	results := make([]FanOutResult, len(names))
+	var mu sync.Mutex
+
+	fmt.Println(title)
+	runFanOut(names, task, func(i int, summary string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[i] = FanOutResult{Name: names[i], Summary: summary, Err: err}
+		if err != nil {
+			fmt.Printf("  %s %s: %s\n", Cross(), names[i], firstLine(err.Error()))
+			return
+		}
+		fmt.Printf("  %s %s: %s\n", Checkmark(), names[i], summary)
+	})
+	return results
+}
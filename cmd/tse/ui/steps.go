@@ -0,0 +1,375 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/sync/errgroup"
+)
+
+// Step is one step of a multi-step operation run by RunSteps
+type Step struct {
+	Name string
+	// Run does the step's work. status replaces the note shown next to the
+	// running step, e.g. to say it's waiting on IAM; Name is what stays in the
+	// summary.
+	Run func(status func(string)) error
+
+	concurrent bool // Starts with the step before it; set by Concurrently
+}
+
+// Concurrently marks steps to run at the same time as each other. RunSteps
+// starts them together once the steps before them are done, and waits for all
+// of them before moving on.
+func Concurrently(steps ...Step) []Step {
+	for i := range steps {
+		steps[i].concurrent = i > 0
+	}
+	return steps
+}
+
+// stepState is where a step is in its run
+type stepState int
+
+const (
+	stepPending stepState = iota
+	stepRunning
+	stepDone
+	stepFailed
+)
+
+// stepsModel renders every step with its position ("[3/8]"), a running clock
+// for the ones in progress and the time each finished one took
+type stepsModel struct {
+	spinner  spinner.Model
+	names    []string
+	states   []stepState
+	started  []time.Time
+	elapsed  []time.Duration
+	statuses []string
+	begun    time.Time     // When the first step started
+	total    time.Duration // Wall time, once finished
+	err      error
+	done     bool
+	quitting bool
+}
+
+type (
+	stepStartedMsg struct {
+		index int
+		at    time.Time
+	}
+	stepStatusMsg struct {
+		index int
+		text  string
+	}
+	stepDoneMsg struct {
+		index   int
+		elapsed time.Duration
+		err     error
+	}
+	stepsFinishedMsg struct{ err error }
+)
+
+func newStepsModel(steps []Step) stepsModel {
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = InfoStyle
+
+	names := make([]string, len(steps))
+	for i, step := range steps {
+		names[i] = step.Name
+	}
+	return stepsModel{
+		spinner:  s,
+		names:    names,
+		states:   make([]stepState, len(steps)),
+		started:  make([]time.Time, len(steps)),
+		elapsed:  make([]time.Duration, len(steps)),
+		statuses: make([]string, len(steps)),
+		begun:    time.Now(),
+	}
+}
+
+func (m stepsModel) Init() tea.Cmd {
+	return m.spinner.Tick
+}
+
+func (m stepsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			m.quitting = true
+			interrupt()
+			return m, tea.Quit
+		}
+		return m, nil
+
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case stepStartedMsg:
+		if msg.index == 0 {
+			m.begun = msg.at
+		}
+		m.states[msg.index] = stepRunning
+		m.started[msg.index] = msg.at
+		return m, nil
+
+	case stepStatusMsg:
+		m.statuses[msg.index] = msg.text
+		return m, nil
+
+	case stepDoneMsg:
+		m.elapsed[msg.index] = msg.elapsed
+		m.states[msg.index] = stepDone
+		if msg.err != nil {
+			m.states[msg.index] = stepFailed
+		}
+		return m, nil
+
+	case stepsFinishedMsg:
+		m.done = true
+		m.err = msg.err
+		m.total = time.Since(m.begun)
+		return m, tea.Quit
+
+	default:
+		return m, nil
+	}
+}
+
+func (m stepsModel) View() string {
+	var b strings.Builder
+	width := 0
+	for _, name := range m.names {
+		width = max(width, len(name))
+	}
+
+	for i, name := range m.names {
+		label := fmt.Sprintf("%s %s", Subtle(stepPosition(i, len(m.names))), name+strings.Repeat(" ", width-len(name)))
+		switch m.states[i] {
+		case stepDone:
+			fmt.Fprintf(&b, "%s %s  %s\n", Checkmark(), label, Subtle(formatStepTime(m.elapsed[i])))
+		case stepFailed:
+			fmt.Fprintf(&b, "%s %s  %s\n", Cross(), label, Subtle("failed after "+formatStepTime(m.elapsed[i])))
+		case stepRunning:
+			if m.quitting {
+				fmt.Fprintf(&b, "%s %s  %s\n", Cross(), label, Subtle("interrupted"))
+				continue
+			}
+			line := fmt.Sprintf("%s %s  %s", m.spinner.View(), label, Subtle(formatStepTime(time.Since(m.started[i]))))
+			if m.statuses[i] != "" {
+				line += "  " + Info(m.statuses[i])
+			}
+			b.WriteString(line + "\n")
+		default:
+			// Steps that won't run after a failure or Ctrl+C aren't worth listing
+			if !m.done && !m.quitting {
+				fmt.Fprintf(&b, "%s %s\n", Subtle("·"), Subtle(label))
+			}
+		}
+	}
+
+	if m.done && m.err == nil {
+		b.WriteString("\n" + stepsSummary(m.names, m.elapsed, m.total) + "\n")
+	}
+	return b.String()
+}
+
+// stepPosition renders "[3/8]" for the third of eight steps
+func stepPosition(i, total int) string {
+	return fmt.Sprintf("[%d/%d]", i+1, total)
+}
+
+// formatStepTime rounds a step's time to what's worth reading: tenths of a
+// second under a minute, whole seconds after
+func formatStepTime(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// stepsSummary is the closing line: how long everything took, which step took
+// longest, and how long it would have taken without running steps concurrently
+func stepsSummary(names []string, elapsed []time.Duration, total time.Duration) string {
+	var serial time.Duration
+	slowest := 0
+	for i, d := range elapsed {
+		serial += d
+		if d > elapsed[slowest] {
+			slowest = i
+		}
+	}
+	summary := fmt.Sprintf("%d steps in %s", len(names), formatStepTime(total))
+	if len(names) > 1 {
+		summary += fmt.Sprintf("; slowest: %s (%s)", names[slowest], formatStepTime(elapsed[slowest]))
+	}
+	if serial-total >= time.Second {
+		summary += fmt.Sprintf("; %s one at a time", formatStepTime(serial))
+	}
+	return Subtle(summary)
+}
+
+// RunSteps runs steps in order as a single display: each step's position
+// ("[3/8]"), a clock on the ones running, the time each finished one took, and
+// a timing summary once all are done. Steps marked with Concurrently run at
+// the same time. RunSteps stops after the first step that fails, letting the
+// steps running alongside it finish, and returns its error.
+func RunSteps(steps []Step) error {
+	if len(steps) == 0 {
+		return nil
+	}
+	if JSONLines() {
+		return runStepsJSONLines(steps)
+	}
+	if Plain() {
+		return runStepsPlain(steps)
+	}
+
+	m := newStepsModel(steps)
+	p := tea.NewProgram(m)
+
+	// Closed once the TUI exits so no further steps start after Ctrl+C
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond) // Let the display start
+		err := runSteps(steps, stopped,
+			func(i int, at time.Time) { p.Send(stepStartedMsg{index: i, at: at}) },
+			func(i int, text string) { p.Send(stepStatusMsg{index: i, text: text}) },
+			func(i int, elapsed time.Duration, err error) {
+				p.Send(stepDoneMsg{index: i, elapsed: elapsed, err: err})
+			})
+		p.Send(stepsFinishedMsg{err: err})
+	}()
+
+	finalModel, err := p.Run()
+	if err != nil {
+		return fmt.Errorf("progress display error: %w", err)
+	}
+	final, ok := finalModel.(stepsModel)
+	if !ok {
+		return fmt.Errorf("unexpected model type")
+	}
+	if final.quitting {
+		return ErrInterrupted
+	}
+	return final.err
+}
+
+// runSteps runs steps a batch at a time (a step and the concurrent steps
+// after it), calling started, status and done as each step progresses. It
+// returns the first error once its batch is over, or ErrInterrupted if stopped
+// is closed between batches.
+func runSteps(steps []Step, stopped <-chan struct{}, started func(i int, at time.Time), status func(i int, text string), done func(i int, elapsed time.Duration, err error)) error {
+	for first := 0; first < len(steps); {
+		end := first + 1
+		for end < len(steps) && steps[end].concurrent {
+			end++
+		}
+
+		select {
+		case <-stopped:
+			return ErrInterrupted
+		default:
+		}
+
+		var g errgroup.Group
+		for i := first; i < end; i++ {
+			g.Go(func() error {
+				start := time.Now()
+				started(i, start)
+				err := steps[i].Run(func(text string) { status(i, text) })
+				done(i, time.Since(start), err)
+				return err
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+		first = end
+	}
+	return nil
+}
+
+// runStepsPlain is RunSteps for plain mode: a line as each step starts and
+// finishes, one per status change, and the summary
+func runStepsPlain(steps []Step) error {
+	names := make([]string, len(steps))
+	for i, step := range steps {
+		names[i] = step.Name
+	}
+	starts := make([]time.Time, len(steps))
+	elapsed := make([]time.Duration, len(steps))
+	last := make([]string, len(steps))
+	var mu sync.Mutex // Concurrent steps print from their own goroutines
+
+	begun := time.Now()
+	err := runSteps(steps, nil,
+		func(i int, at time.Time) {
+			mu.Lock()
+			defer mu.Unlock()
+			starts[i] = at
+			fmt.Printf("%s %s...\n", stepPosition(i, len(steps)), names[i])
+		},
+		func(i int, text string) {
+			mu.Lock()
+			defer mu.Unlock()
+			if text != last[i] {
+				fmt.Printf("  %s %s\n", stepPosition(i, len(steps)), text)
+				last[i] = text
+			}
+		},
+		func(i int, d time.Duration, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			elapsed[i] = d
+			printPlainResult(stepPosition(i, len(steps))+" "+names[i], starts[i], err)
+		})
+	if err != nil {
+		return err
+	}
+	fmt.Println(stepsSummary(names, elapsed, time.Since(begun)))
+	return nil
+}
+
+// runStepsJSONLines is RunSteps for --json-lines mode: step events for each
+// step, with status changes as wait.attempt events
+func runStepsJSONLines(steps []Step) error {
+	starts := make([]time.Time, len(steps))
+	attempts := make([]int, len(steps))
+	last := make([]string, len(steps))
+	var mu sync.Mutex
+
+	return runSteps(steps, nil,
+		func(i int, at time.Time) {
+			mu.Lock()
+			starts[i] = at
+			mu.Unlock()
+			Emit(Event{Type: EventStepStarted, Step: steps[i].Name})
+		},
+		func(i int, text string) {
+			mu.Lock()
+			defer mu.Unlock()
+			if text != last[i] {
+				attempts[i]++
+				Emit(Event{Type: EventWaitAttempt, Step: steps[i].Name, Message: text, Attempt: attempts[i]})
+				last[i] = text
+			}
+		},
+		func(i int, _ time.Duration, err error) {
+			mu.Lock()
+			start := starts[i]
+			mu.Unlock()
+			emitStepResult(steps[i].Name, start, err)
+		})
+}
@@ -0,0 +1,85 @@
+package usage
+
+import (
+	"sort"
+	"time"
+)
+
+// DayUsage is how long exit nodes ran in each region on one calendar day
+type DayUsage struct {
+	Date    time.Time     // Midnight at the start of the day
+	Regions []RegionStats // Longest first; Starts counts sessions started that day
+	Total   time.Duration
+}
+
+// Daily splits completed sessions into calendar days in loc, newest day first.
+// A session that ran past midnight counts toward each day it covered.
+func Daily(sessions []Session, loc *time.Location) []DayUsage {
+	days := make(map[time.Time]map[string]*RegionStats)
+	add := func(day time.Time, region string) *RegionStats {
+		regions, ok := days[day]
+		if !ok {
+			regions = make(map[string]*RegionStats)
+			days[day] = regions
+		}
+		r, ok := regions[region]
+		if !ok {
+			r = &RegionStats{Region: region}
+			regions[region] = r
+		}
+		return r
+	}
+
+	for _, session := range sessions {
+		if session.End.IsZero() {
+			continue
+		}
+		start, end := session.Start.In(loc), session.End.In(loc)
+		add(midnight(start), session.Region).Starts++
+		for day := midnight(start); day.Before(end); day = day.AddDate(0, 0, 1) {
+			from, to := maxTime(start, day), minTime(end, day.AddDate(0, 0, 1))
+			if to.After(from) {
+				add(day, session.Region).TotalDuration += to.Sub(from)
+			}
+		}
+	}
+
+	var daily []DayUsage
+	for day, regions := range days {
+		usage := DayUsage{Date: day}
+		for _, r := range regions {
+			usage.Regions = append(usage.Regions, *r)
+			usage.Total += r.TotalDuration
+		}
+		sort.Slice(usage.Regions, func(i, j int) bool {
+			if usage.Regions[i].TotalDuration != usage.Regions[j].TotalDuration {
+				return usage.Regions[i].TotalDuration > usage.Regions[j].TotalDuration
+			}
+			return usage.Regions[i].Region < usage.Regions[j].Region
+		})
+		daily = append(daily, usage)
+	}
+	sort.Slice(daily, func(i, j int) bool {
+		return daily[i].Date.After(daily[j].Date)
+	})
+	return daily
+}
+
+// midnight returns the start of t's day in t's location
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
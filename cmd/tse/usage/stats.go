@@ -0,0 +1,154 @@
+package usage
+
+import (
+	"sort"
+	"time"
+)
+
+// CommandStats summarizes runs of a single command
+type CommandStats struct {
+	Command  string
+	Runs     int
+	Failures int
+}
+
+// RegionStats summarizes exit node usage in a single region
+type RegionStats struct {
+	Region        string
+	Starts        int
+	TotalDuration time.Duration // Sum of completed session lengths
+}
+
+// Session is one exit node's lifetime, from start to the stop that terminated it
+type Session struct {
+	Region string
+	Start  time.Time
+	End    time.Time // Zero if no stop has been recorded yet
+}
+
+// Duration returns the session length, or zero for sessions still open
+func (s Session) Duration() time.Duration {
+	if s.End.IsZero() {
+		return 0
+	}
+	return s.End.Sub(s.Start)
+}
+
+// Stats is the summary shown by `tse stats`
+type Stats struct {
+	Since        time.Time
+	Commands     []CommandStats // Sorted by runs, descending
+	TotalRuns    int
+	TotalFailed  int
+	Regions      []RegionStats // Sorted by starts, descending
+	Sessions     []Session
+	OpenSessions int
+}
+
+// SuccessRate returns the fraction of commands that succeeded (1 if none ran)
+func (s Stats) SuccessRate() float64 {
+	if s.TotalRuns == 0 {
+		return 1
+	}
+	return float64(s.TotalRuns-s.TotalFailed) / float64(s.TotalRuns)
+}
+
+// AverageSession returns the mean length of completed sessions
+func (s Stats) AverageSession() time.Duration {
+	var total time.Duration
+	completed := 0
+	for _, session := range s.Sessions {
+		if !session.End.IsZero() {
+			total += session.Duration()
+			completed++
+		}
+	}
+	if completed == 0 {
+		return 0
+	}
+	return total / time.Duration(completed)
+}
+
+// Summarize computes usage statistics from events at or after since
+// (pass the zero time for all history)
+func Summarize(events []Event, since time.Time) Stats {
+	sorted := make([]Event, 0, len(events))
+	for _, event := range events {
+		if !event.Time.Before(since) {
+			sorted = append(sorted, event)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	stats := Stats{Since: since}
+	commands := make(map[string]*CommandStats)
+	regions := make(map[string]*RegionStats)
+	open := make(map[string][]int) // region -> indexes of open sessions
+
+	region := func(name string) *RegionStats {
+		r, ok := regions[name]
+		if !ok {
+			r = &RegionStats{Region: name}
+			regions[name] = r
+		}
+		return r
+	}
+
+	for _, event := range sorted {
+		switch event.Kind {
+		case KindCommand:
+			c, ok := commands[event.Command]
+			if !ok {
+				c = &CommandStats{Command: event.Command}
+				commands[event.Command] = c
+			}
+			c.Runs++
+			stats.TotalRuns++
+			if !event.Success {
+				c.Failures++
+				stats.TotalFailed++
+			}
+
+		case KindNodeStart:
+			region(event.Region).Starts++
+			stats.Sessions = append(stats.Sessions, Session{Region: event.Region, Start: event.Time})
+			open[event.Region] = append(open[event.Region], len(stats.Sessions)-1)
+
+		case KindNodeStop:
+			// A stop terminates every node in the region
+			for _, i := range open[event.Region] {
+				stats.Sessions[i].End = event.Time
+				region(event.Region).TotalDuration += stats.Sessions[i].Duration()
+			}
+			delete(open, event.Region)
+		}
+	}
+
+	for _, indexes := range open {
+		stats.OpenSessions += len(indexes)
+	}
+
+	for _, c := range commands {
+		stats.Commands = append(stats.Commands, *c)
+	}
+	sort.Slice(stats.Commands, func(i, j int) bool {
+		if stats.Commands[i].Runs != stats.Commands[j].Runs {
+			return stats.Commands[i].Runs > stats.Commands[j].Runs
+		}
+		return stats.Commands[i].Command < stats.Commands[j].Command
+	})
+
+	for _, r := range regions {
+		stats.Regions = append(stats.Regions, *r)
+	}
+	sort.Slice(stats.Regions, func(i, j int) bool {
+		if stats.Regions[i].Starts != stats.Regions[j].Starts {
+			return stats.Regions[i].Starts > stats.Regions[j].Starts
+		}
+		return stats.Regions[i].Region < stats.Regions[j].Region
+	})
+
+	return stats
+}
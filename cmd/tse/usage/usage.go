@@ -0,0 +1,129 @@
+// Package usage keeps a private, local log of CLI usage and exit node sessions.
+//
+// Nothing here ever leaves the machine: events are appended to a JSON Lines
+// file under the user's state directory and only read back by `tse stats`.
+// Set TSE_USAGE_LOG=off to disable recording entirely.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EnvUsageLog overrides the log location, or disables logging when set to "off"
+const EnvUsageLog = "TSE_USAGE_LOG"
+
+// Event kinds
+const (
+	KindCommand   = "command"    // A CLI command finished (successfully or not)
+	KindNodeStart = "node_start" // An exit node was started in a region
+	KindNodeStop  = "node_stop"  // Exit nodes were terminated in a region
+)
+
+// Event is a single line in the usage log
+type Event struct {
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind"`
+	Command    string    `json:"command,omitempty"`
+	Region     string    `json:"region,omitempty"`
+	Success    bool      `json:"success,omitempty"`
+	DurationMS int64     `json:"duration_ms,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Path returns the usage log location: $TSE_USAGE_LOG, then
+// $XDG_STATE_HOME/tse/usage.jsonl, then ~/.local/state/tse/usage.jsonl.
+// Returns an empty path when logging is disabled.
+func Path() (string, error) {
+	if path := os.Getenv(EnvUsageLog); path != "" {
+		if path == "off" {
+			return "", nil
+		}
+		return path, nil
+	}
+
+	if state := os.Getenv("XDG_STATE_HOME"); state != "" {
+		return filepath.Join(state, "tse", "usage.jsonl"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "tse", "usage.jsonl"), nil
+}
+
+// Record appends an event to the usage log. It is best-effort: analytics must
+// never make a command fail, so errors are silently dropped.
+func Record(event Event) {
+	path, err := Path()
+	if err != nil || path == "" {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Time = event.Time.UTC()
+
+	// Only keep the first line of errors (no multi-line troubleshooting text)
+	if i := strings.IndexByte(event.Error, '\n'); i >= 0 {
+		event.Error = event.Error[:i]
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	f.Write(append(line, '\n'))
+}
+
+// Load reads every event from the usage log. A missing log yields no events;
+// malformed lines are skipped.
+func Load() ([]Event, error) {
+	path, err := Path()
+	if err != nil || path == "" {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage log: %w", err)
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage log: %w", err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,120 @@
+package usage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordAndLoad(t *testing.T) {
+	t.Setenv(EnvUsageLog, filepath.Join(t.TempDir(), "state", "usage.jsonl"))
+
+	Record(Event{Kind: KindCommand, Command: "start", Region: "ohio", Success: true})
+	Record(Event{Kind: KindCommand, Command: "stop", Region: "ohio", Error: "stop failed\n\nTroubleshooting: ..."})
+
+	events, err := Load()
+	if err != nil {
+		t.Fatalf("Load(): %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if events[0].Command != "start" || !events[0].Success {
+		t.Errorf("first event = %+v, want successful start", events[0])
+	}
+	if events[1].Error != "stop failed" {
+		t.Errorf("error = %q, want only the first line", events[1].Error)
+	}
+	if events[0].Time.IsZero() {
+		t.Errorf("event time was not filled in")
+	}
+}
+
+func TestRecordDisabled(t *testing.T) {
+	t.Setenv(EnvUsageLog, "off")
+
+	Record(Event{Kind: KindCommand, Command: "start"})
+
+	events, err := Load()
+	if err != nil {
+		t.Fatalf("Load(): %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("got %d events with logging off, want 0", len(events))
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+
+	events := []Event{
+		{Time: at(0), Kind: KindCommand, Command: "start", Region: "ohio", Success: true},
+		{Time: at(0), Kind: KindNodeStart, Region: "ohio"},
+		{Time: at(30), Kind: KindCommand, Command: "stop", Region: "ohio", Success: true},
+		{Time: at(30), Kind: KindNodeStop, Region: "ohio"},
+		{Time: at(40), Kind: KindCommand, Command: "start", Region: "tokyo", Success: false},
+		{Time: at(50), Kind: KindCommand, Command: "start", Region: "ohio", Success: true},
+		{Time: at(50), Kind: KindNodeStart, Region: "ohio"},
+		{Time: at(140), Kind: KindNodeStop, Region: "ohio"},
+		{Time: at(200), Kind: KindNodeStart, Region: "tokyo"},
+	}
+
+	stats := Summarize(events, time.Time{})
+
+	if stats.TotalRuns != 4 || stats.TotalFailed != 1 {
+		t.Errorf("runs/failed = %d/%d, want 4/1", stats.TotalRuns, stats.TotalFailed)
+	}
+	if got := stats.SuccessRate(); got != 0.75 {
+		t.Errorf("SuccessRate() = %v, want 0.75", got)
+	}
+	if stats.Commands[0].Command != "start" || stats.Commands[0].Runs != 3 || stats.Commands[0].Failures != 1 {
+		t.Errorf("top command = %+v, want start with 3 runs and 1 failure", stats.Commands[0])
+	}
+	if stats.Regions[0].Region != "ohio" || stats.Regions[0].Starts != 2 {
+		t.Errorf("top region = %+v, want ohio with 2 starts", stats.Regions[0])
+	}
+	if got := stats.AverageSession(); got != 60*time.Minute {
+		t.Errorf("AverageSession() = %v, want 1h (30m and 90m sessions)", got)
+	}
+	if stats.OpenSessions != 1 {
+		t.Errorf("OpenSessions = %d, want 1", stats.OpenSessions)
+	}
+
+	// Filtering by time drops the earlier events
+	recent := Summarize(events, at(45))
+	if recent.TotalRuns != 1 {
+		t.Errorf("runs since filter = %d, want 1", recent.TotalRuns)
+	}
+}
+
+func TestDaily(t *testing.T) {
+	day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours float64) time.Time { return day.Add(time.Duration(hours * float64(time.Hour))) }
+
+	sessions := []Session{
+		{Region: "ohio", Start: at(9), End: at(10)},
+		{Region: "frankfurt", Start: at(12), End: at(15)},
+		{Region: "ohio", Start: at(22), End: at(26)}, // Past midnight
+		{Region: "tokyo", Start: at(30)},             // Still open
+	}
+
+	daily := Daily(sessions, time.UTC)
+	if len(daily) != 2 {
+		t.Fatalf("Daily() returned %d days, want 2: %+v", len(daily), daily)
+	}
+
+	second, first := daily[0], daily[1]
+	if !first.Date.Equal(day) || !second.Date.Equal(day.AddDate(0, 0, 1)) {
+		t.Errorf("days = %v, %v; want newest first", second.Date, first.Date)
+	}
+	if first.Total != 6*time.Hour || first.Regions[0].Region != "frankfurt" {
+		t.Errorf("first day = %+v, want 6h with frankfurt first", first)
+	}
+	if ohio := first.Regions[1]; ohio.Region != "ohio" || ohio.Starts != 2 || ohio.TotalDuration != 3*time.Hour {
+		t.Errorf("first day ohio = %+v, want 2 starts and 3h", ohio)
+	}
+	if len(second.Regions) != 1 || second.Regions[0].TotalDuration != 2*time.Hour || second.Regions[0].Starts != 0 {
+		t.Errorf("second day = %+v, want ohio's last 2h and no starts", second)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// geoIPURL looks up where an IP address geolocates; %s is the address.
+// ipinfo.io answers without an API key for light use.
+const geoIPURL = "https://ipinfo.io/%s/json"
+
+var geoIPClient = &http.Client{Timeout: 10 * time.Second}
+
+// geoIPResult is what the GeoIP service says about an address
+type geoIPResult struct {
+	IP      string `json:"ip"`
+	City    string `json:"city"`
+	Region  string `json:"region"`
+	Country string `json:"country"` // ISO 3166-1 alpha-2
+	Org     string `json:"org"`
+}
+
+// Place describes the location for display, e.g. "Columbus, Ohio, US"
+func (g geoIPResult) Place() string {
+	place := ""
+	for _, part := range []string{g.City, g.Region, g.Country} {
+		if part == "" {
+			continue
+		}
+		if place != "" {
+			place += ", "
+		}
+		place += part
+	}
+	return place
+}
+
+// lookupGeoIP asks the GeoIP service where ip geolocates
+func lookupGeoIP(ctx context.Context, ip string) (geoIPResult, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf(geoIPURL, ip), nil)
+	if err != nil {
+		return geoIPResult{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := geoIPClient.Do(req)
+	if err != nil {
+		return geoIPResult{}, fmt.Errorf("GeoIP lookup failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := types.ReadPayload(resp.Body)
+	if err != nil {
+		return geoIPResult{}, fmt.Errorf("failed to read GeoIP response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return geoIPResult{}, fmt.Errorf("GeoIP lookup failed (HTTP %d): %s", resp.StatusCode, firstLine(string(body)))
+	}
+
+	var result geoIPResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return geoIPResult{}, fmt.Errorf("failed to parse GeoIP response: %w", err)
+	}
+	if result.Country == "" {
+		return geoIPResult{}, fmt.Errorf("GeoIP service has no country for %s", ip)
+	}
+	return result, nil
+}
+
+// handleVerify checks that each ready exit node in a region geolocates to the
+// region's country, which is what websites see. AWS registers most ranges where
+// they're used, but a freshly moved range can still show up in its old country.
+func handleVerify(ctx context.Context, lambdaURL, region string) error {
+	info, _ := regions.Lookup(region)
+
+	var instancesResp *types.InstancesResponse
+	err := ui.WithSpinner(fmt.Sprintf("Finding exit nodes in %s", region), func() error {
+		var err error
+		instancesResp, err = listRegionInstances(ctx, lambdaURL, region)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var ready []*types.InstanceInfo
+	starting := 0
+	for _, instance := range instancesResp.Instances {
+		switch {
+		case instance.State != "running" && instance.State != "pending":
+		case instance.Ready && instance.PublicIP != "":
+			ready = append(ready, instance)
+		default:
+			starting++
+		}
+	}
+	if len(ready) == 0 {
+		if starting > 0 {
+			return fmt.Errorf("the exit node in %s isn't routing yet; run 'tse %s verify' again once 'tse %s instances' shows it ready", region, region, region)
+		}
+		return fmt.Errorf("no exit node running in %s; start one with 'tse %s start'", region, region)
+	}
+
+	results := make([]geoIPResult, len(ready))
+	err = ui.WithSpinner("Looking up where the exit node geolocates", func() error {
+		for i, instance := range ready {
+			var err error
+			if results[i], err = lookupGeoIP(ctx, instance.PublicIP); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	mismatched := 0
+	for i, instance := range ready {
+		geo := results[i]
+		switch {
+		case info.CountryCode == "":
+			// Custom regions carry no country to check against
+			fmt.Printf("%s %s geolocates to %s\n", ui.Info("→"), ui.Highlight(instance.PublicIP), ui.Bold(geo.Place()))
+		case geo.Country == info.CountryCode:
+			fmt.Printf("%s %s geolocates to %s, as expected for %s\n", ui.Checkmark(), ui.Highlight(instance.PublicIP), ui.Bold(geo.Place()), region)
+		default:
+			mismatched++
+			fmt.Println(ui.Warning(fmt.Sprintf("⚠️  %s geolocates to %s, not %s (%s)", instance.PublicIP, geo.Place(), info.Country, info.CountryCode)))
+		}
+		if geo.Org != "" {
+			fmt.Printf("   %s %s\n", ui.Label("Network:"), geo.Org)
+		}
+	}
+
+	if mismatched > 0 {
+		fmt.Println()
+		fmt.Println(ui.Subtle("   Sites that go by GeoIP will place you there rather than in " + info.City + "."))
+		fmt.Println(ui.Subtle(fmt.Sprintf("   A new node usually gets a different address: 'tse %s stop', then 'tse %s start'.", region, region)))
+	}
+	if info.CountryCode == "" {
+		fmt.Println(ui.Subtle(fmt.Sprintf("   %s is a custom region, so there's no expected country to compare with.", region)))
+	}
+	return nil
+}
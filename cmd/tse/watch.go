@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anoldguy/tse/cmd/tse/localstatus"
+	"github.com/anoldguy/tse/cmd/tse/ui"
+	"github.com/anoldguy/tse/cmd/tse/usage"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const watchUsage = `Usage: tse watch [flags]
+
+Start exit nodes on demand. tse watch checks this device's Tailscale status,
+and when you select a tse exit node (exit-<region>) that's offline, it starts a
+node in that region, waits for it to join your tailnet, and switches this
+device to it. Runs until interrupted.
+
+Only selecting a node wakes it: a node that stops while selected (say, by
+'tse shutdown' or install-reaper) stays stopped until you select it again.
+
+Flags:
+  --interval duration  How often to check the selected exit node (default 5s)
+  --no-switch          Start the node, but leave this device's exit node alone
+  --tailscale string   Path to the tailscale CLI (default: from PATH, or the
+                       macOS app)
+
+Switching runs 'tailscale set --exit-node', which on Linux needs root or
+'sudo tailscale set --operator=$USER' once.
+
+Examples:
+  tse watch
+  tse watch --tailscale /Applications/Tailscale.app/Contents/MacOS/Tailscale
+`
+
+const (
+	// watchJoinTimeout is how long to wait for a started node to come online in
+	// the tailnet; starts take 1-2 minutes
+	watchJoinTimeout = 5 * time.Minute
+	watchJoinPoll    = 3 * time.Second
+)
+
+// exitNodeHostnamePrefix is how exit nodes name themselves: exit-<region>
+const exitNodeHostnamePrefix = "exit-"
+
+func runWatch(ctx context.Context, lambdaURL string, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, watchUsage)
+	}
+	interval := fs.Duration("interval", 5*time.Second, "How often to check the selected exit node")
+	noSwitch := fs.Bool("no-switch", false, "Start the node, but leave this device's exit node alone")
+	tailscalePath := fs.String("tailscale", "", "Path to the tailscale CLI")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %s", ui.Highlight(fs.Arg(0)))
+	}
+	if *interval < time.Second {
+		return fmt.Errorf("--interval must be at least 1s")
+	}
+
+	cli, err := localstatus.FindCLI(*tailscalePath)
+	if err != nil {
+		return err
+	}
+	// Fail now, not on the first tick, if the CLI can't talk to tailscaled
+	if _, err := cli.Status(ctx); err != nil {
+		return err
+	}
+	logEvent("%s Watching for offline tse exit nodes being selected (Ctrl+C to stop)", ui.Checkmark())
+
+	var lastSelected string
+	var lastErr string
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		status, err := cli.Status(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			// tailscaled restarting or the like; say so once, not every tick
+			if err.Error() != lastErr {
+				logEvent("%s %v", ui.Warning("Warning:"), err)
+				lastErr = err.Error()
+			}
+		default:
+			lastErr = ""
+			selected := status.ExitNode()
+			if selected != nil && selected.ID != lastSelected {
+				if region, ok := wakeRegion(status, selected); ok {
+					if err := wakeExitNode(ctx, lambdaURL, cli, region, selected.ID, !*noSwitch); err != nil && ctx.Err() == nil {
+						logEvent("%s %s", ui.Error("Error:"), firstLine(err.Error()))
+					}
+				}
+			}
+			lastSelected = ""
+			if selected != nil {
+				lastSelected = selected.ID
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// wakeRegion returns the region to start a node in when the selected exit node
+// is an offline tse node, and false for anything else
+func wakeRegion(status *localstatus.Status, selected *localstatus.Peer) (string, bool) {
+	// Disconnected, every peer looks offline
+	if status.BackendState != localstatus.BackendRunning || selected.Online {
+		return "", false
+	}
+	return exitNodeRegion(selected.HostName)
+}
+
+// exitNodeRegion returns the region in a tse exit node's hostname (exit-ohio → ohio)
+func exitNodeRegion(hostname string) (string, bool) {
+	name, ok := strings.CutPrefix(strings.ToLower(hostname), exitNodeHostnamePrefix)
+	if !ok || !regions.IsValidFriendlyName(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// wakeExitNode starts a node in region, waits for it to join the tailnet, and,
+// if switch is set and the device still has the offline node selected, makes
+// the new node this device's exit node. A new node is a new tailnet device,
+// even with the same hostname, so the old selection won't pick it up.
+func wakeExitNode(ctx context.Context, lambdaURL string, cli *localstatus.CLI, region, offlineID string, switchTo bool) error {
+	hostname := exitNodeHostnamePrefix + region
+	logEvent("%s is selected but offline; starting a node in %s", ui.Highlight(hostname), region)
+
+	startResp, alreadyRunning, err := startRegion(ctx, lambdaURL, types.StartRequest{Region: region})
+	if err != nil {
+		return fmt.Errorf("start in %s failed: %w", region, err)
+	}
+	if !alreadyRunning {
+		usage.Record(usage.Event{Kind: usage.KindNodeStart, Region: region})
+	}
+	logEvent("%s", startResp.Message)
+
+	node, err := waitForExitNode(ctx, cli, hostname, offlineID)
+	if err != nil {
+		return err
+	}
+	if node.ID == offlineID {
+		logEvent("%s %s is back online", ui.Checkmark(), ui.Highlight(hostname))
+		return nil
+	}
+	if !switchTo {
+		logEvent("%s %s is up as %s; select it to use it", ui.Checkmark(), ui.Highlight(hostname), node.IPv4())
+		return nil
+	}
+
+	// Don't override a choice made while the node was starting
+	status, err := cli.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if current := status.ExitNode(); current == nil || current.ID != offlineID {
+		logEvent("%s %s is up, but the exit node was changed meanwhile; leaving it", ui.Checkmark(), ui.Highlight(hostname))
+		return nil
+	}
+	if err := cli.SetExitNode(ctx, node.IPv4()); err != nil {
+		return fmt.Errorf("%s is up, but switching to it failed: %w", hostname, err)
+	}
+	logEvent("%s %s is up; this device now uses it (%s)", ui.Checkmark(), ui.Highlight(hostname), node.IPv4())
+	return nil
+}
+
+// waitForExitNode polls the local status until a node named hostname is online
+// and offering to be an exit node: a new one, or the offline one coming back
+func waitForExitNode(ctx context.Context, cli *localstatus.CLI, hostname, offlineID string) (*localstatus.Peer, error) {
+	ctx, cancel := context.WithTimeout(ctx, watchJoinTimeout)
+	defer cancel()
+
+	for {
+		status, err := cli.Status(ctx)
+		if err == nil {
+			for _, peer := range status.PeersNamed(hostname) {
+				if peer.Online && (peer.ID == offlineID || peer.ExitNodeOption && peer.IPv4() != "") {
+					return peer, nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("%s didn't join the tailnet within %s; check 'tse %s instances'", hostname, watchJoinTimeout, strings.TrimPrefix(hostname, exitNodeHostnamePrefix))
+			}
+			return nil, ctx.Err()
+		case <-time.After(watchJoinPoll):
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// auditStore is the subset of the state store used for the audit log
+type auditStore interface {
+	RecordAudit(ctx context.Context, entry *types.AuditEntry) error
+	ListAudit(ctx context.Context, since time.Time, limit int) ([]*types.AuditEntry, error)
+}
+
+// auditLog persists audit entries; nil when no state table is configured,
+// in which case entries only go to CloudWatch Logs
+var auditLog auditStore
+
+const (
+	defaultAuditWindow = 24 * time.Hour
+	defaultAuditLimit  = 50
+	maxAuditLimit      = 500
+)
+
+// auditAction names the control action a request performs, or "" for read-only
+// requests that aren't worth auditing when they succeed
+func auditAction(method string, parts []string) string {
+	if method == "GET" {
+		return ""
+	}
+
+	switch {
+	case method == "POST" && len(parts) == 1 && parts[0] == "tokens":
+		return "token.create"
+	case method == "DELETE" && len(parts) == 2 && parts[0] == "tokens":
+		return "token.revoke"
+	case method == "POST" && len(parts) == 1 && parts[0] == "links":
+		return "link.create"
+	case method == "POST" && len(parts) == 2:
+		return parts[1]
+	}
+	return method + " /" + strings.Join(parts, "/")
+}
+
+// auditRegion returns the region a request targets
+func auditRegion(parts []string) string {
+	if len(parts) == 2 && parts[0] != "tokens" {
+		return parts[0]
+	}
+	return ""
+}
+
+// recordAudit writes an audit entry for a request to CloudWatch Logs and, when
+// configured, the state table. Failures are logged but never fail the request.
+func recordAudit(ctx context.Context, request events.LambdaFunctionURLRequest, caller *types.TokenInfo, action string, parts []string, response events.LambdaFunctionURLResponse) {
+	entry := &types.AuditEntry{
+		Time:     time.Now().UTC(),
+		Action:   action,
+		Region:   auditRegion(parts),
+		SourceIP: request.RequestContext.HTTP.SourceIP,
+		Status:   response.StatusCode,
+		Result:   auditResult(response),
+	}
+	if caller != nil {
+		entry.TokenID = caller.ID
+		entry.TokenName = caller.Name
+	}
+
+	if data, err := json.Marshal(entry); err == nil {
+		log.Printf("AUDIT: %s", data)
+	}
+
+	if auditLog == nil {
+		return
+	}
+	if err := auditLog.RecordAudit(ctx, entry); err != nil {
+		log.Printf("Failed to record audit entry: %v", err)
+	}
+}
+
+// auditResult summarizes a response as "ok" or the error message it carried
+func auditResult(response events.LambdaFunctionURLResponse) string {
+	if response.StatusCode < 400 {
+		return "ok"
+	}
+
+	var errResp types.ErrorResponse
+	if err := json.Unmarshal([]byte(response.Body), &errResp); err == nil && errResp.Error != "" {
+		return errResp.Error
+	}
+	return http.StatusText(response.StatusCode)
+}
+
+// handleListAudit returns recent audit entries, newest first.
+// Query parameters: since (Go duration, default 24h) and limit (default 50).
+func handleListAudit(ctx context.Context, params map[string]string) (events.LambdaFunctionURLResponse, error) {
+	if auditLog == nil {
+		return errorResponse(http.StatusNotImplemented, "The audit log requires the state table (redeploy with 'tse deploy')"), nil
+	}
+
+	window := defaultAuditWindow
+	if v := params["since"]; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return errorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid since %q (use a duration like 24h)", v)), nil
+		}
+		window = d
+	}
+
+	limit := defaultAuditLimit
+	if v := params["limit"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxAuditLimit {
+			return errorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid limit %q (must be 1-%d)", v, maxAuditLimit)), nil
+		}
+		limit = n
+	}
+
+	entries, err := auditLog.ListAudit(ctx, time.Now().Add(-window), limit)
+	if err != nil {
+		return awsErrorResponse("Failed to read audit log", err), nil
+	}
+
+	response := types.AuditResponse{
+		Success: true,
+		Message: fmt.Sprintf("Found %d audit entries in the last %s", len(entries), window),
+		Entries: entries,
+	}
+
+	return jsonResponse(http.StatusOK, response), nil
+}
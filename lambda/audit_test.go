@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// fakeAudit is an in-memory auditStore
+type fakeAudit struct {
+	entries []*types.AuditEntry
+}
+
+func (f *fakeAudit) RecordAudit(ctx context.Context, entry *types.AuditEntry) error {
+	f.entries = append(f.entries, entry)
+	return nil
+}
+
+func (f *fakeAudit) ListAudit(ctx context.Context, since time.Time, limit int) ([]*types.AuditEntry, error) {
+	var list []*types.AuditEntry
+	for i := len(f.entries) - 1; i >= 0 && len(list) < limit; i-- {
+		if !f.entries[i].Time.Before(since) {
+			list = append(list, f.entries[i])
+		}
+	}
+	return list, nil
+}
+
+func TestAuditAction(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"GET", "", ""},
+		{"GET", "ohio/instances", ""},
+		{"GET", "audit", ""},
+		{"POST", "ohio/start", "start"},
+		{"POST", "ohio/stop", "stop"},
+		{"POST", "ohio/cleanup", "cleanup"},
+		{"POST", "ohio/adopt", "adopt"},
+		{"POST", "ohio/reserve", "reserve"},
+		{"POST", "ohio/unreserve", "unreserve"},
+		{"POST", "tokens", "token.create"},
+		{"DELETE", "tokens/abc123", "token.revoke"},
+		{"PUT", "ohio", "PUT /ohio"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" /"+tt.path, func(t *testing.T) {
+			got := auditAction(tt.method, strings.Split(tt.path, "/"))
+			if got != tt.want {
+				t.Errorf("auditAction() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerRecordsAudit(t *testing.T) {
+	os.Setenv("TSE_AUTH_TOKEN", "root-token")
+	defer os.Unsetenv("TSE_AUTH_TOKEN")
+
+	tokens = fakeTokens{
+		"tse_read-only": {ID: "read-only", Name: "dashboard", Scopes: []string{types.ScopeRead}},
+	}
+	fake := &fakeAudit{}
+	auditLog = fake
+	defer func() {
+		tokens = nil
+		auditLog = nil
+	}()
+
+	request := func(method, path, token, sourceIP string) events.LambdaFunctionURLResponse {
+		req := events.LambdaFunctionURLRequest{
+			RawPath: path,
+			Headers: map[string]string{"Authorization": "Bearer " + token},
+		}
+		req.RequestContext.HTTP.Method = method
+		req.RequestContext.HTTP.SourceIP = sourceIP
+		resp, _ := handler(context.Background(), req)
+		return resp
+	}
+
+	// Successful reads are not audited
+	request("GET", "/", "root-token", "203.0.113.60")
+	if len(fake.entries) != 0 {
+		t.Fatalf("health check was audited: %+v", fake.entries)
+	}
+
+	// A forbidden control action is audited with the caller's token
+	request("POST", "/ohio/stop", "tse_read-only", "203.0.113.60")
+	// A bad token is audited even on a read-only route
+	request("GET", "/ohio/instances", "leaked-guess", "203.0.113.61")
+	// A control action that fails validation is still audited
+	request("POST", "/atlantis/start", "root-token", "203.0.113.60")
+
+	if len(fake.entries) != 3 {
+		t.Fatalf("got %d audit entries, want 3: %+v", len(fake.entries), fake.entries)
+	}
+
+	forbidden := fake.entries[0]
+	if forbidden.Action != "stop" || forbidden.Region != "ohio" || forbidden.TokenID != "read-only" || forbidden.Status != http.StatusForbidden {
+		t.Errorf("forbidden entry = %+v", forbidden)
+	}
+
+	unauthorized := fake.entries[1]
+	if unauthorized.Action != "auth" || unauthorized.TokenID != "" || unauthorized.SourceIP != "203.0.113.61" || unauthorized.Status != http.StatusUnauthorized {
+		t.Errorf("unauthorized entry = %+v", unauthorized)
+	}
+
+	invalid := fake.entries[2]
+	if invalid.Action != "start" || invalid.TokenID != "root" || invalid.Status != http.StatusBadRequest || invalid.Result == "ok" {
+		t.Errorf("invalid region entry = %+v", invalid)
+	}
+
+	// Admins can read the log back, newest first
+	resp := request("GET", "/audit", "root-token", "203.0.113.60")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /audit: status = %d, want 200 (%s)", resp.StatusCode, resp.Body)
+	}
+	if !strings.Contains(resp.Body, "atlantis") {
+		t.Errorf("GET /audit body missing newest entry: %s", resp.Body)
+	}
+}
+
+func TestHandleListAuditRejectsBadParams(t *testing.T) {
+	auditLog = &fakeAudit{}
+	defer func() { auditLog = nil }()
+
+	for _, params := range []map[string]string{
+		{"since": "yesterday"},
+		{"since": "-1h"},
+		{"limit": "0"},
+		{"limit": "100000"},
+	} {
+		resp, _ := handleListAudit(context.Background(), params)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("handleListAudit(%v): status = %d, want 400", params, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	sharedtypes "github.com/anoldguy/tse/shared/types"
+)
+
+const (
+	// TagAdopted marks instances that were launched outside tse and later adopted
+	TagAdopted = "Adopted"
+
+	// TagTailscaleHostname records the node's actual tailnet hostname for adopted instances,
+	// which may not follow the exit-<region> convention
+	TagTailscaleHostname = "TailscaleHostname"
+)
+
+// AdoptInstances finds untagged instances whose public IP matches one of the candidate
+// Tailscale nodes and tags them so stop/cleanup treat them like any other exit node.
+// It returns the adopted instances and the hostnames of candidates with no matching instance.
+func (s *Service) AdoptInstances(ctx context.Context, friendlyRegion string, candidates []sharedtypes.AdoptCandidate, dryRun bool) ([]*sharedtypes.InstanceInfo, []string, error) {
+	hostnameByIP := make(map[string]string)
+	var ips []string
+	for _, candidate := range candidates {
+		for _, ip := range candidate.PublicIPs {
+			if _, ok := hostnameByIP[ip]; !ok {
+				hostnameByIP[ip] = candidate.Hostname
+				ips = append(ips, ip)
+			}
+		}
+	}
+
+	matched := make(map[string]bool)
+	var adopted []*sharedtypes.InstanceInfo
+
+	if len(ips) > 0 {
+		result, err := s.ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+			Filters: []types.Filter{
+				{
+					Name:   aws.String("ip-address"),
+					Values: ips,
+				},
+				{
+					Name:   aws.String("instance-state-name"),
+					Values: []string{"pending", "running", "stopped"},
+				},
+			},
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to describe instances: %w", err)
+		}
+
+		for _, reservation := range result.Reservations {
+			for _, instance := range reservation.Instances {
+				if instance.PublicIpAddress == nil {
+					continue
+				}
+				hostname := hostnameByIP[*instance.PublicIpAddress]
+				matched[hostname] = true
+
+				// Already managed by tse; nothing to adopt
+				if hasTag(instance.Tags, "Project", TagProject) {
+					continue
+				}
+
+				if !dryRun {
+					_, err := s.ec2Client.CreateTags(ctx, &ec2.CreateTagsInput{
+						Resources: []string{*instance.InstanceId},
+						Tags: append([]types.Tag{
+							{Key: aws.String("Project"), Value: aws.String(TagProject)},
+							{Key: aws.String("Type"), Value: aws.String(TagType)},
+							{Key: aws.String("Region"), Value: aws.String(friendlyRegion)},
+							{Key: aws.String(TagAdopted), Value: aws.String("true")},
+							{Key: aws.String(TagTailscaleHostname), Value: aws.String(hostname)},
+						}, s.deploymentTags()...),
+					})
+					if err != nil {
+						return adopted, nil, fmt.Errorf("failed to tag instance %s: %w", *instance.InstanceId, err)
+					}
+				}
+
+				info := &sharedtypes.InstanceInfo{
+					InstanceID:        *instance.InstanceId,
+					State:             string(instance.State.Name),
+					LaunchTime:        instance.LaunchTime.UTC(),
+					InstanceType:      string(instance.InstanceType),
+					FriendlyRegion:    friendlyRegion,
+					PublicIP:          *instance.PublicIpAddress,
+					TailscaleHostname: hostname,
+				}
+				if instance.PrivateIpAddress != nil {
+					info.PrivateIP = *instance.PrivateIpAddress
+				}
+				adopted = append(adopted, info)
+			}
+		}
+	}
+
+	var unmatched []string
+	for _, candidate := range candidates {
+		if !matched[candidate.Hostname] {
+			unmatched = append(unmatched, candidate.Hostname)
+		}
+	}
+
+	return adopted, unmatched, nil
+}
+
+// hasTag reports whether the tag set contains the given key/value pair
+func hasTag(tags []types.Tag, key, value string) bool {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == key && aws.ToString(tag.Value) == value {
+			return true
+		}
+	}
+	return false
+}
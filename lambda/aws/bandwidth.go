@@ -0,0 +1,94 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+
+	sharedtypes "github.com/anoldguy/tse/shared/types"
+)
+
+const (
+	// maxDatapoints is the most GetMetricStatistics returns for one request
+	maxDatapoints = 1440
+
+	// Basic monitoring publishes EC2 metrics every 5 minutes; after 63 days
+	// CloudWatch only keeps hourly aggregates
+	basicPeriod  = 5 * time.Minute
+	hourlyPeriod = time.Hour
+	hourlyAfter  = 63 * 24 * time.Hour
+)
+
+// cloudWatchAPI is the part of the CloudWatch client the service calls: it
+// only reads EC2 metrics. Tests swap in a fake.
+type cloudWatchAPI interface {
+	GetMetricStatistics(ctx context.Context, params *cloudwatch.GetMetricStatisticsInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricStatisticsOutput, error)
+}
+
+var _ cloudWatchAPI = (*cloudwatch.Client)(nil)
+
+// AddNetworkOut sets NetworkOutBytes on each instance to what it has sent since
+// launch. CloudWatch lags a few minutes behind, so the last stretch is missing.
+// It fills in what it can and returns the first error.
+func (s *Service) AddNetworkOut(ctx context.Context, instances []*sharedtypes.InstanceInfo) error {
+	var firstErr error
+	for _, instance := range instances {
+		if instance.State == "pending" {
+			// Nothing published yet
+			continue
+		}
+		sent, err := s.NetworkOut(ctx, instance.InstanceID, instance.LaunchTime)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		instance.NetworkOutBytes = sent
+	}
+	return firstErr
+}
+
+// NetworkOut returns how many bytes an instance has sent since the given time
+func (s *Service) NetworkOut(ctx context.Context, instanceID string, since time.Time) (int64, error) {
+	return networkOut(ctx, s.cloudWatch, instanceID, since, time.Now())
+}
+
+// networkOut sums the NetworkOut metric of an instance between start and end
+func networkOut(ctx context.Context, client cloudWatchAPI, instanceID string, start, end time.Time) (int64, error) {
+	out, err := client.GetMetricStatistics(ctx, &cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/EC2"),
+		MetricName: aws.String("NetworkOut"),
+		Dimensions: []cwtypes.Dimension{{Name: aws.String("InstanceId"), Value: aws.String(instanceID)}},
+		StartTime:  aws.Time(start),
+		EndTime:    aws.Time(end),
+		Period:     aws.Int32(networkOutPeriod(end.Sub(start))),
+		Statistics: []cwtypes.Statistic{cwtypes.StatisticSum},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get NetworkOut for %s: %w", instanceID, err)
+	}
+
+	var total float64
+	for _, datapoint := range out.Datapoints {
+		total += aws.ToFloat64(datapoint.Sum)
+	}
+	return int64(total), nil
+}
+
+// networkOutPeriod picks a period covering the window up to now in at most
+// maxDatapoints datapoints, in multiples of the resolution CloudWatch still
+// keeps for its start: five minutes, or an hour once that's gone
+func networkOutPeriod(window time.Duration) int32 {
+	step := basicPeriod
+	if window > hourlyAfter {
+		step = hourlyPeriod
+	}
+	steps := math.Ceil(window.Seconds() / maxDatapoints / step.Seconds())
+	return int32(max(1, steps)) * int32(step.Seconds())
+}
@@ -0,0 +1,79 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestNetworkOutPeriod(t *testing.T) {
+	tests := []struct {
+		window time.Duration
+		want   int32
+	}{
+		{0, 300},
+		{time.Hour, 300},
+		{5 * 24 * time.Hour, 300},       // 1440 five-minute datapoints
+		{6 * 24 * time.Hour, 600},       // Too many for 300
+		{30 * 24 * time.Hour, 1800},     // 1440 datapoints
+		{90 * 24 * time.Hour, 2 * 3600}, // Only hourly data left
+	}
+	for _, tt := range tests {
+		if got := networkOutPeriod(tt.window); got != tt.want {
+			t.Errorf("networkOutPeriod(%s) = %d, want %d", tt.window, got, tt.want)
+		}
+	}
+}
+
+// fakeCloudWatch answers GetMetricStatistics with a func
+type fakeCloudWatch func(*cloudwatch.GetMetricStatisticsInput) (*cloudwatch.GetMetricStatisticsOutput, error)
+
+func (f fakeCloudWatch) GetMetricStatistics(ctx context.Context, params *cloudwatch.GetMetricStatisticsInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricStatisticsOutput, error) {
+	return f(params)
+}
+
+func TestNetworkOut(t *testing.T) {
+	var asked *cloudwatch.GetMetricStatisticsInput
+	client := fakeCloudWatch(func(params *cloudwatch.GetMetricStatisticsInput) (*cloudwatch.GetMetricStatisticsOutput, error) {
+		asked = params
+		if aws.ToString(params.Dimensions[0].Value) == "i-denied" {
+			return nil, &smithy.GenericAPIError{Code: "AccessDenied", Message: "not allowed"}
+		}
+		if aws.ToString(params.Dimensions[0].Value) == "i-quiet" {
+			return &cloudwatch.GetMetricStatisticsOutput{}, nil
+		}
+		return &cloudwatch.GetMetricStatisticsOutput{Datapoints: []cwtypes.Datapoint{
+			{Sum: aws.Float64(1_000_000)},
+			{Sum: aws.Float64(2.5e9)},
+		}}, nil
+	})
+
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	got, err := networkOut(context.Background(), client, "i-0123456789abcdef0", start, start.Add(2*time.Hour))
+	if err != nil || got != 2_501_000_000 {
+		t.Fatalf("networkOut = %d, %v, want 2501000000", got, err)
+	}
+	if aws.ToString(asked.Namespace) != "AWS/EC2" || aws.ToString(asked.MetricName) != "NetworkOut" ||
+		aws.ToString(asked.Dimensions[0].Name) != "InstanceId" || aws.ToString(asked.Dimensions[0].Value) != "i-0123456789abcdef0" ||
+		!asked.StartTime.Equal(start) || !asked.EndTime.Equal(start.Add(2*time.Hour)) ||
+		aws.ToInt32(asked.Period) != 300 || len(asked.Statistics) != 1 || asked.Statistics[0] != cwtypes.StatisticSum {
+		t.Errorf("GetMetricStatistics input = %+v", asked)
+	}
+
+	if got, err := networkOut(context.Background(), client, "i-quiet", start, start.Add(time.Hour)); err != nil || got != 0 {
+		t.Errorf("networkOut(no datapoints) = %d, %v, want 0", got, err)
+	}
+
+	// The SDK's error survives, so throttling and access errors are recognized
+	_, err = networkOut(context.Background(), client, "i-denied", start, start.Add(time.Hour))
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "AccessDenied" {
+		t.Errorf("networkOut(denied) error = %v, want the AccessDenied API error", err)
+	}
+}
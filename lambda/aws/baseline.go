@@ -0,0 +1,388 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	sharedtypes "github.com/anoldguy/tse/shared/types"
+)
+
+const (
+	// EnvSecurityBaseline selects the security baseline exit nodes are launched with
+	EnvSecurityBaseline = "TSE_SECURITY_BASELINE"
+
+	// TagBaseline records which baseline a node or security group was created for.
+	// Security groups from before baselines existed carry no tag and count as standard.
+	TagBaseline = "tse:baseline"
+
+	// KeyPairName is the EC2 key pair attached to nodes that allow SSH
+	KeyPairName = "tailscale"
+)
+
+// Baseline is a named set of hardening options applied to exit nodes at launch
+// and checked by the compliance audit.
+type Baseline struct {
+	Name          string
+	AllowSSH      bool // tcp/22 ingress from anywhere
+	KeyPair       bool // attach KeyPairName to nodes
+	RequireIMDSv2 bool // instance metadata only via session tokens
+	EncryptEBS    bool // encrypted root volume (account default KMS key)
+	LockEgress    bool // outbound limited to egressRules instead of allow-all
+}
+
+var (
+	// BaselineStandard keeps the historical behavior: SSH open for debugging, default egress
+	BaselineStandard = Baseline{
+		Name:     sharedtypes.BaselineStandard,
+		AllowSSH: true,
+		KeyPair:  true,
+	}
+
+	// BaselineStrict is the hardened profile for nodes that should never be logged into
+	BaselineStrict = Baseline{
+		Name:          sharedtypes.BaselineStrict,
+		RequireIMDSv2: true,
+		EncryptEBS:    true,
+		LockEgress:    true,
+	}
+
+	baselines = map[string]Baseline{
+		BaselineStandard.Name: BaselineStandard,
+		BaselineStrict.Name:   BaselineStrict,
+	}
+)
+
+// egressRule is a single outbound port (or port range) allowed by a locked-down security group
+type egressRule struct {
+	protocol string
+	from, to int32
+}
+
+// egressRules is what a locked-down exit node may send: Tailscale itself (WireGuard,
+// STUN, DERP over HTTPS), DNS (plain, and over TLS for 'start --dns' presets), the
+// multihop tunnel, and web traffic for the nodes' clients. Anything else a client
+// sends through the node is dropped, and peer-to-peer connections that need other
+// UDP ports fall back to DERP relays.
+var egressRules = []egressRule{
+	{"tcp", 80, 80},
+	{"tcp", 443, 443},
+	{"udp", 443, 443},
+	{"tcp", 53, 53},
+	{"udp", 53, 53},
+	{"tcp", 853, 853},
+	{"udp", 3478, 3478},
+	{"udp", 41641, 41641},
+	{"udp", sharedtypes.HopPort, sharedtypes.HopPort},
+}
+
+// LookupBaseline returns the named baseline. An empty name means standard.
+func LookupBaseline(name string) (Baseline, error) {
+	if name == "" {
+		return BaselineStandard, nil
+	}
+	b, ok := baselines[strings.ToLower(name)]
+	if !ok {
+		return Baseline{}, fmt.Errorf("unknown security baseline %q (valid: %s)", name, strings.Join(sharedtypes.Baselines, ", "))
+	}
+	return b, nil
+}
+
+// BaselineFromEnv returns the baseline selected by TSE_SECURITY_BASELINE
+func BaselineFromEnv() (Baseline, error) {
+	return LookupBaseline(os.Getenv(EnvSecurityBaseline))
+}
+
+// baselineOf returns the baseline a resource was tagged with, standard if untagged
+func baselineOf(tags []types.Tag) string {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == TagBaseline {
+			return aws.ToString(tag.Value)
+		}
+	}
+	return BaselineStandard.Name
+}
+
+// applyBaseline adjusts a launch request to match the baseline. rootDevice is the
+// image's root device name, needed to override its volume settings.
+func applyBaseline(b Baseline, input *ec2.RunInstancesInput, rootDevice string) {
+	if b.KeyPair {
+		input.KeyName = aws.String(KeyPairName)
+	}
+	if b.RequireIMDSv2 {
+		input.MetadataOptions = &types.InstanceMetadataOptionsRequest{
+			HttpEndpoint:            types.InstanceMetadataEndpointStateEnabled,
+			HttpTokens:              types.HttpTokensStateRequired,
+			HttpPutResponseHopLimit: aws.Int32(1),
+		}
+	}
+	if b.EncryptEBS && rootDevice != "" {
+		input.BlockDeviceMappings = []types.BlockDeviceMapping{
+			{
+				DeviceName: aws.String(rootDevice),
+				Ebs: &types.EbsBlockDevice{
+					Encrypted:           aws.Bool(true),
+					DeleteOnTermination: aws.Bool(true),
+				},
+			},
+		}
+	}
+	for i := range input.TagSpecifications {
+		input.TagSpecifications[i].Tags = append(input.TagSpecifications[i].Tags,
+			types.Tag{Key: aws.String(TagBaseline), Value: aws.String(b.Name)})
+	}
+}
+
+// lockEgress replaces a new security group's default allow-all outbound rule with egressRules
+func (s *Service) lockEgress(ctx context.Context, sgID string) error {
+	permissions := make([]types.IpPermission, 0, len(egressRules))
+	for _, rule := range egressRules {
+		permissions = append(permissions, types.IpPermission{
+			IpProtocol: aws.String(rule.protocol),
+			FromPort:   aws.Int32(rule.from),
+			ToPort:     aws.Int32(rule.to),
+			IpRanges:   []types.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+		})
+	}
+
+	_, err := s.ec2Client.AuthorizeSecurityGroupEgress(ctx, &ec2.AuthorizeSecurityGroupEgressInput{
+		GroupId:       aws.String(sgID),
+		IpPermissions: permissions,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add security group egress rules: %w", err)
+	}
+
+	_, err = s.ec2Client.RevokeSecurityGroupEgress(ctx, &ec2.RevokeSecurityGroupEgressInput{
+		GroupId: aws.String(sgID),
+		IpPermissions: []types.IpPermission{
+			{
+				IpProtocol: aws.String("-1"),
+				IpRanges:   []types.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove default security group egress rule: %w", err)
+	}
+
+	return nil
+}
+
+// CheckCompliance audits this region's exit nodes and their security groups against
+// the baseline, returning every violation found
+func (s *Service) CheckCompliance(ctx context.Context, friendlyRegion string, b Baseline) (*sharedtypes.ComplianceResponse, error) {
+	instResult, err := s.ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{Name: aws.String("tag:Project"), Values: []string{TagProject}},
+			{Name: aws.String("tag:Type"), Values: []string{TagType}},
+			{Name: aws.String("instance-state-name"), Values: []string{"pending", "running", "stopping", "stopped"}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe instances: %w", err)
+	}
+
+	var instances []types.Instance
+	var volumeIDs []string
+	groupIDs := map[string]bool{}
+	for _, reservation := range instResult.Reservations {
+		for _, instance := range reservation.Instances {
+			if !s.owns(instance.Tags) {
+				continue
+			}
+			instances = append(instances, instance)
+			if id := rootVolumeID(instance); id != "" {
+				volumeIDs = append(volumeIDs, id)
+			}
+			for _, group := range instance.SecurityGroups {
+				groupIDs[aws.ToString(group.GroupId)] = true
+			}
+		}
+	}
+
+	volumes := map[string]types.Volume{}
+	if b.EncryptEBS && len(volumeIDs) > 0 {
+		volResult, err := s.ec2Client.DescribeVolumes(ctx, &ec2.DescribeVolumesInput{VolumeIds: volumeIDs})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe volumes: %w", err)
+		}
+		for _, volume := range volResult.Volumes {
+			volumes[aws.ToString(volume.VolumeId)] = volume
+		}
+	}
+
+	// The groups nodes actually use, plus the group new nodes on this baseline would get
+	sgResult, err := s.ec2Client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
+		Filters: []types.Filter{
+			{Name: aws.String("tag:Project"), Values: []string{TagProject}},
+			{Name: aws.String("tag:Type"), Values: []string{TagType}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe security groups: %w", err)
+	}
+	groups := map[string]types.SecurityGroup{}
+	for _, sg := range sgResult.SecurityGroups {
+		id := aws.ToString(sg.GroupId)
+		if groupIDs[id] || baselineOf(sg.Tags) == b.Name && s.owns(sg.Tags) {
+			groups[id] = sg
+		}
+	}
+	var untagged []string
+	for id := range groupIDs {
+		if _, ok := groups[id]; !ok {
+			untagged = append(untagged, id)
+		}
+	}
+	if len(untagged) > 0 {
+		extra, err := s.ec2Client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{GroupIds: untagged})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe security groups: %w", err)
+		}
+		for _, sg := range extra.SecurityGroups {
+			groups[aws.ToString(sg.GroupId)] = sg
+		}
+	}
+
+	response := &sharedtypes.ComplianceResponse{
+		Region:        friendlyRegion,
+		Baseline:      b.Name,
+		Violations:    []sharedtypes.ComplianceViolation{},
+		NodesChecked:  len(instances),
+		GroupsChecked: len(groups),
+	}
+	for _, instance := range instances {
+		response.Violations = append(response.Violations, checkInstance(b, instance, volumes)...)
+	}
+	groupOrder := make([]string, 0, len(groups))
+	for id := range groups {
+		groupOrder = append(groupOrder, id)
+	}
+	sort.Strings(groupOrder)
+	for _, id := range groupOrder {
+		response.Violations = append(response.Violations, checkSecurityGroup(b, groups[id])...)
+	}
+	response.Compliant = len(response.Violations) == 0
+
+	return response, nil
+}
+
+// rootVolumeID returns the EBS volume mounted as the instance's root device
+func rootVolumeID(instance types.Instance) string {
+	for _, mapping := range instance.BlockDeviceMappings {
+		if aws.ToString(mapping.DeviceName) == aws.ToString(instance.RootDeviceName) && mapping.Ebs != nil {
+			return aws.ToString(mapping.Ebs.VolumeId)
+		}
+	}
+	return ""
+}
+
+// checkInstance returns the ways a node falls short of the baseline.
+// volumes holds the described root volumes by ID; a missing entry is not a violation.
+func checkInstance(b Baseline, instance types.Instance, volumes map[string]types.Volume) []sharedtypes.ComplianceViolation {
+	id := aws.ToString(instance.InstanceId)
+	var violations []sharedtypes.ComplianceViolation
+
+	if !b.KeyPair && aws.ToString(instance.KeyName) != "" {
+		violations = append(violations, sharedtypes.ComplianceViolation{
+			Resource: id,
+			Check:    "key-pair",
+			Detail:   fmt.Sprintf("launched with key pair %q", aws.ToString(instance.KeyName)),
+		})
+	}
+
+	if b.RequireIMDSv2 && (instance.MetadataOptions == nil || instance.MetadataOptions.HttpTokens != types.HttpTokensStateRequired) {
+		violations = append(violations, sharedtypes.ComplianceViolation{
+			Resource: id,
+			Check:    "imdsv2",
+			Detail:   "instance metadata reachable without a session token (IMDSv1)",
+		})
+	}
+
+	if b.EncryptEBS {
+		if volume, ok := volumes[rootVolumeID(instance)]; ok && !aws.ToBool(volume.Encrypted) {
+			violations = append(violations, sharedtypes.ComplianceViolation{
+				Resource: id,
+				Check:    "ebs-encryption",
+				Detail:   fmt.Sprintf("root volume %s is not encrypted", aws.ToString(volume.VolumeId)),
+			})
+		}
+	}
+
+	return violations
+}
+
+// checkSecurityGroup returns the ways a security group falls short of the baseline
+func checkSecurityGroup(b Baseline, sg types.SecurityGroup) []sharedtypes.ComplianceViolation {
+	id := aws.ToString(sg.GroupId)
+	var violations []sharedtypes.ComplianceViolation
+
+	if !b.AllowSSH {
+		for _, perm := range sg.IpPermissions {
+			if coversPort(perm, "tcp", 22) {
+				violations = append(violations, sharedtypes.ComplianceViolation{
+					Resource: id,
+					Check:    "ssh-ingress",
+					Detail:   fmt.Sprintf("allows inbound %s", describePermission(perm)),
+				})
+			}
+		}
+	}
+
+	if b.LockEgress {
+		for _, perm := range sg.IpPermissionsEgress {
+			if !allowedEgress(perm) {
+				violations = append(violations, sharedtypes.ComplianceViolation{
+					Resource: id,
+					Check:    "egress",
+					Detail:   fmt.Sprintf("allows outbound %s", describePermission(perm)),
+				})
+			}
+		}
+	}
+
+	return violations
+}
+
+// coversPort reports whether a permission lets traffic through on the given protocol and port
+func coversPort(perm types.IpPermission, protocol string, port int32) bool {
+	proto := aws.ToString(perm.IpProtocol)
+	if proto == "-1" {
+		return true
+	}
+	if proto != protocol {
+		return false
+	}
+	return aws.ToInt32(perm.FromPort) <= port && port <= aws.ToInt32(perm.ToPort)
+}
+
+// allowedEgress reports whether an outbound permission is one of egressRules
+func allowedEgress(perm types.IpPermission) bool {
+	for _, rule := range egressRules {
+		if aws.ToString(perm.IpProtocol) == rule.protocol &&
+			aws.ToInt32(perm.FromPort) == rule.from && aws.ToInt32(perm.ToPort) == rule.to {
+			return true
+		}
+	}
+	return false
+}
+
+// describePermission renders a permission as e.g. "tcp/22" or "all traffic"
+func describePermission(perm types.IpPermission) string {
+	proto := aws.ToString(perm.IpProtocol)
+	if proto == "-1" {
+		return "all traffic"
+	}
+	from, to := aws.ToInt32(perm.FromPort), aws.ToInt32(perm.ToPort)
+	if from == to {
+		return fmt.Sprintf("%s/%d", proto, from)
+	}
+	return fmt.Sprintf("%s/%d-%d", proto, from, to)
+}
@@ -0,0 +1,172 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestLookupBaseline(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "", want: "standard"},
+		{name: "standard", want: "standard"},
+		{name: "STRICT", want: "strict"},
+		{name: "paranoid", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := LookupBaseline(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LookupBaseline(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if b.Name != tt.want {
+				t.Errorf("LookupBaseline(%q) = %q, want %q", tt.name, b.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyBaseline(t *testing.T) {
+	newInput := func() *ec2.RunInstancesInput {
+		return &ec2.RunInstancesInput{
+			TagSpecifications: []types.TagSpecification{{ResourceType: types.ResourceTypeInstance}},
+		}
+	}
+
+	standard := newInput()
+	applyBaseline(BaselineStandard, standard, "/dev/xvda")
+	if aws.ToString(standard.KeyName) != KeyPairName {
+		t.Errorf("standard baseline should attach the %s key pair", KeyPairName)
+	}
+	if standard.MetadataOptions != nil || standard.BlockDeviceMappings != nil {
+		t.Errorf("standard baseline should leave metadata and volumes at their defaults")
+	}
+
+	strict := newInput()
+	applyBaseline(BaselineStrict, strict, "/dev/xvda")
+	if strict.KeyName != nil {
+		t.Errorf("strict baseline should not attach a key pair, got %s", aws.ToString(strict.KeyName))
+	}
+	if strict.MetadataOptions == nil || strict.MetadataOptions.HttpTokens != types.HttpTokensStateRequired {
+		t.Errorf("strict baseline should require IMDSv2")
+	}
+	if len(strict.BlockDeviceMappings) != 1 ||
+		aws.ToString(strict.BlockDeviceMappings[0].DeviceName) != "/dev/xvda" ||
+		!aws.ToBool(strict.BlockDeviceMappings[0].Ebs.Encrypted) {
+		t.Errorf("strict baseline should encrypt the root volume, got %+v", strict.BlockDeviceMappings)
+	}
+	if !hasTag(strict.TagSpecifications[0].Tags, TagBaseline, "strict") {
+		t.Errorf("instance should be tagged %s=strict", TagBaseline)
+	}
+}
+
+func TestCheckInstance(t *testing.T) {
+	root := []types.InstanceBlockDeviceMapping{
+		{DeviceName: aws.String("/dev/xvda"), Ebs: &types.EbsInstanceBlockDevice{VolumeId: aws.String("vol-1")}},
+	}
+	hardened := types.Instance{
+		InstanceId:          aws.String("i-hardened"),
+		RootDeviceName:      aws.String("/dev/xvda"),
+		BlockDeviceMappings: root,
+		MetadataOptions:     &types.InstanceMetadataOptionsResponse{HttpTokens: types.HttpTokensStateRequired},
+	}
+	legacy := types.Instance{
+		InstanceId:          aws.String("i-legacy"),
+		KeyName:             aws.String("tailscale"),
+		RootDeviceName:      aws.String("/dev/xvda"),
+		BlockDeviceMappings: root,
+		MetadataOptions:     &types.InstanceMetadataOptionsResponse{HttpTokens: types.HttpTokensStateOptional},
+	}
+
+	encrypted := map[string]types.Volume{"vol-1": {VolumeId: aws.String("vol-1"), Encrypted: aws.Bool(true)}}
+	plain := map[string]types.Volume{"vol-1": {VolumeId: aws.String("vol-1"), Encrypted: aws.Bool(false)}}
+
+	if v := checkInstance(BaselineStrict, hardened, encrypted); len(v) != 0 {
+		t.Errorf("hardened instance should pass strict, got %+v", v)
+	}
+	if v := checkInstance(BaselineStandard, legacy, plain); len(v) != 0 {
+		t.Errorf("legacy instance should pass standard, got %+v", v)
+	}
+
+	got := map[string]bool{}
+	for _, v := range checkInstance(BaselineStrict, legacy, plain) {
+		if v.Resource != "i-legacy" {
+			t.Errorf("violation for %s, want i-legacy", v.Resource)
+		}
+		got[v.Check] = true
+	}
+	for _, check := range []string{"key-pair", "imdsv2", "ebs-encryption"} {
+		if !got[check] {
+			t.Errorf("missing %s violation, got %v", check, got)
+		}
+	}
+}
+
+func TestCheckSecurityGroup(t *testing.T) {
+	wireguard := types.IpPermission{IpProtocol: aws.String("udp"), FromPort: aws.Int32(41641), ToPort: aws.Int32(41641)}
+	ssh := types.IpPermission{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(22), ToPort: aws.Int32(22)}
+	allTraffic := types.IpPermission{IpProtocol: aws.String("-1")}
+	https := types.IpPermission{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(443), ToPort: aws.Int32(443)}
+
+	tests := []struct {
+		name  string
+		sg    types.SecurityGroup
+		want  []string
+		check Baseline
+	}{
+		{
+			name:  "locked down",
+			sg:    types.SecurityGroup{IpPermissions: []types.IpPermission{wireguard}, IpPermissionsEgress: []types.IpPermission{https}},
+			check: BaselineStrict,
+		},
+		{
+			name:  "original group",
+			sg:    types.SecurityGroup{IpPermissions: []types.IpPermission{wireguard, ssh}, IpPermissionsEgress: []types.IpPermission{allTraffic}},
+			check: BaselineStrict,
+			want:  []string{"ssh-ingress", "egress"},
+		},
+		{
+			name:  "all inbound traffic",
+			sg:    types.SecurityGroup{IpPermissions: []types.IpPermission{allTraffic}},
+			check: BaselineStrict,
+			want:  []string{"ssh-ingress"},
+		},
+		{
+			name:  "original group under standard",
+			sg:    types.SecurityGroup{IpPermissions: []types.IpPermission{wireguard, ssh}, IpPermissionsEgress: []types.IpPermission{allTraffic}},
+			check: BaselineStandard,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.sg.GroupId = aws.String("sg-1")
+			violations := checkSecurityGroup(tt.check, tt.sg)
+			if len(violations) != len(tt.want) {
+				t.Fatalf("got %+v, want checks %v", violations, tt.want)
+			}
+			for i, v := range violations {
+				if v.Check != tt.want[i] {
+					t.Errorf("violation %d check = %s, want %s", i, v.Check, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBaselineOf(t *testing.T) {
+	if got := baselineOf(nil); got != "standard" {
+		t.Errorf("untagged resources should count as standard, got %s", got)
+	}
+	tags := []types.Tag{{Key: aws.String(TagBaseline), Value: aws.String("strict")}}
+	if got := baselineOf(tags); got != "strict" {
+		t.Errorf("baselineOf = %s, want strict", got)
+	}
+}
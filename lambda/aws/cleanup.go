@@ -0,0 +1,78 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// TagCreated records when tse created a VPC, subnet or security group (RFC 3339).
+	// EC2 doesn't report creation times for them.
+	TagCreated = "tse:created"
+
+	// CleanupGracePeriod protects freshly created VPC stacks and security groups
+	// from cleanup, since a start may be about to launch into them
+	CleanupGracePeriod = 10 * time.Minute
+
+	// launchAttempts bounds how often StartInstance rebuilds launch resources
+	// that vanished under it
+	launchAttempts = 2
+)
+
+// How long cleanups wait for terminated instances to let go of their VPC
+// stack and security group. Variables so tests don't wait.
+var (
+	stopCleanupDelay  = 30 * time.Second
+	forceCleanupDelay = 5 * time.Second
+)
+
+// createdTag stamps a resource with its creation time
+func createdTag() types.Tag {
+	return types.Tag{Key: aws.String(TagCreated), Value: aws.String(time.Now().UTC().Format(time.RFC3339))}
+}
+
+// recentlyCreated reports whether tags carry a creation time within the cleanup
+// grace period. Resources created before the tag existed count as old.
+func recentlyCreated(tags []types.Tag, now time.Time) bool {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) != TagCreated {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, aws.ToString(tag.Value))
+		if err != nil {
+			return false
+		}
+		return now.Sub(created) < CleanupGracePeriod
+	}
+	return false
+}
+
+// verifyLaunchResources checks the subnet and security group still exist right
+// before launching; a cleanup may have deleted them since they were looked up
+func (s *Service) verifyLaunchResources(ctx context.Context, subnetID, sgID string) error {
+	if _, err := s.ec2Client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{SubnetIds: []string{subnetID}}); err != nil {
+		return err
+	}
+	_, err := s.ec2Client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{GroupIds: []string{sgID}})
+	return err
+}
+
+// isMissingResourceError reports whether an EC2 call failed because the VPC,
+// subnet or security group it referenced no longer exists
+func isMissingResourceError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "InvalidSubnetID.NotFound", "InvalidSubnet.NotFound", "InvalidGroup.NotFound", "InvalidVpcID.NotFound":
+		return true
+	}
+	return false
+}
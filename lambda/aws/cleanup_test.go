@@ -0,0 +1,64 @@
+package aws
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestRecentlyCreated(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	created := func(ago time.Duration) []types.Tag {
+		return []types.Tag{
+			{Key: aws.String("Project"), Value: aws.String(TagProject)},
+			{Key: aws.String(TagCreated), Value: aws.String(now.Add(-ago).Format(time.RFC3339))},
+		}
+	}
+
+	tests := []struct {
+		name string
+		tags []types.Tag
+		want bool
+	}{
+		{"just created", created(time.Minute), true},
+		{"past the grace period", created(CleanupGracePeriod + time.Minute), false},
+		{"created before the tag existed", []types.Tag{{Key: aws.String("Project"), Value: aws.String(TagProject)}}, false},
+		{"unparseable", []types.Tag{{Key: aws.String(TagCreated), Value: aws.String("yesterday")}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recentlyCreated(tt.tags, now); got != tt.want {
+				t.Errorf("recentlyCreated = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreatedTagRoundTrip(t *testing.T) {
+	if !recentlyCreated([]types.Tag{createdTag()}, time.Now()) {
+		t.Error("a resource tagged just now should be recently created")
+	}
+}
+
+func TestIsMissingResourceError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("failed to launch instance: %w", &smithy.GenericAPIError{Code: "InvalidSubnetID.NotFound"}), true},
+		{&smithy.GenericAPIError{Code: "InvalidGroup.NotFound"}, true},
+		{&smithy.GenericAPIError{Code: "InsufficientInstanceCapacity"}, false},
+		{fmt.Errorf("no TSE subnets found in VPC vpc-0abc"), false},
+	}
+
+	for _, tt := range tests {
+		if got := isMissingResourceError(tt.err); got != tt.want {
+			t.Errorf("isMissingResourceError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
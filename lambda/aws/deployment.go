@@ -0,0 +1,45 @@
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const (
+	// TagDeployment records which deployment (one tse deploy) created a resource,
+	// so two deployments sharing an account leave each other's resources alone
+	TagDeployment = "tse:deployment"
+
+	// EnvDeploymentID is the deployment ID tse deploy gives the Lambda
+	EnvDeploymentID = "TSE_DEPLOYMENT_ID"
+)
+
+// AllDeployments makes the service list and clean up every deployment's
+// resources instead of only its own. New resources are still tagged as its own.
+func (s *Service) AllDeployments() {
+	s.allDeployments = true
+}
+
+// owns reports whether a resource with these tags belongs to this service's
+// deployment. Resources without a deployment tag (created before deployment IDs)
+// belong to every deployment, as does everything when the Lambda has no ID.
+func (s *Service) owns(tags []types.Tag) bool {
+	if s.deployment == "" || s.allDeployments {
+		return true
+	}
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == TagDeployment {
+			return aws.ToString(tag.Value) == s.deployment
+		}
+	}
+	return true
+}
+
+// deploymentTags returns the tag marking a new resource as this deployment's,
+// if the Lambda has a deployment ID
+func (s *Service) deploymentTags() []types.Tag {
+	if s.deployment == "" {
+		return nil
+	}
+	return []types.Tag{{Key: aws.String(TagDeployment), Value: aws.String(s.deployment)}}
+}
@@ -0,0 +1,55 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestOwns(t *testing.T) {
+	tagged := func(id string) []types.Tag {
+		return []types.Tag{
+			{Key: aws.String("Project"), Value: aws.String("tse")},
+			{Key: aws.String(TagDeployment), Value: aws.String(id)},
+		}
+	}
+	untagged := []types.Tag{{Key: aws.String("Project"), Value: aws.String("tse")}}
+
+	tests := []struct {
+		name       string
+		deployment string
+		all        bool
+		tags       []types.Tag
+		want       bool
+	}{
+		{name: "own", deployment: "a1", tags: tagged("a1"), want: true},
+		{name: "other", deployment: "a1", tags: tagged("b2"), want: false},
+		{name: "other with all deployments", deployment: "a1", all: true, tags: tagged("b2"), want: true},
+		{name: "predates deployment IDs", deployment: "a1", tags: untagged, want: true},
+		{name: "lambda without ID", tags: tagged("b2"), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{deployment: tt.deployment}
+			if tt.all {
+				s.AllDeployments()
+			}
+			if got := s.owns(tt.tags); got != tt.want {
+				t.Errorf("owns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeploymentTags(t *testing.T) {
+	if tags := (&Service{}).deploymentTags(); tags != nil {
+		t.Errorf("deploymentTags() = %v, want none without an ID", tags)
+	}
+
+	tags := (&Service{deployment: "a1"}).deploymentTags()
+	if len(tags) != 1 || aws.ToString(tags[0].Key) != TagDeployment || aws.ToString(tags[0].Value) != "a1" {
+		t.Errorf("deploymentTags() = %v, want %s=a1", tags, TagDeployment)
+	}
+}
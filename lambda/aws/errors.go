@@ -0,0 +1,24 @@
+package aws
+
+import (
+	"errors"
+
+	"github.com/aws/smithy-go"
+)
+
+// IsThrottlingError reports whether an AWS call failed because AWS rate-limited
+// it, even after the SDK's own retries
+func IsThrottlingError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "Throttling", "ThrottlingException", "ThrottledException", "RequestLimitExceeded",
+		"RequestThrottled", "RequestThrottledException", "TooManyRequestsException", "SlowDown",
+		"EC2ThrottledException", "BandwidthLimitExceeded", "PriorRequestNotComplete",
+		"ProvisionedThroughputExceededException":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/smithy-go"
+)
+
+func TestIsThrottlingError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("failed to list instances: %w", &smithy.GenericAPIError{Code: "RequestLimitExceeded"}), true},
+		{&smithy.GenericAPIError{Code: "ThrottlingException"}, true},
+		{&smithy.GenericAPIError{Code: "EC2ThrottledException"}, true},
+		{&smithy.GenericAPIError{Code: "LimitExceededException"}, false}, // A quota; waiting won't help
+		{&smithy.GenericAPIError{Code: "InsufficientInstanceCapacity"}, false},
+		{errors.New("Throttling"), false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsThrottlingError(tt.err); got != tt.want {
+			t.Errorf("IsThrottlingError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigRetries(t *testing.T) {
+	cfg, err := loadConfig(context.Background(), config.WithRegion("us-east-2"))
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if cfg.RetryMode != aws.RetryModeAdaptive || cfg.RetryMaxAttempts != retryMaxAttempts {
+		t.Errorf("retries = %s mode, %d attempts; want adaptive, %d", cfg.RetryMode, cfg.RetryMaxAttempts, retryMaxAttempts)
+	}
+}
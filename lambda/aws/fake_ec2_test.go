@@ -0,0 +1,219 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// fakeEC2 stands in for the EC2 client. Each call is recorded with its input;
+// an action answers with its handler (a func(*ec2.XInput) (*ec2.XOutput, error)
+// set with on) or an empty output if it has none.
+type fakeEC2 struct {
+	mu       sync.Mutex
+	calls    []fakeCall
+	handlers map[string]any
+}
+
+// fakeCall is one recorded EC2 call
+type fakeCall struct {
+	Action string
+	Input  any
+}
+
+func newFakeEC2() *fakeEC2 {
+	return &fakeEC2{handlers: map[string]any{}}
+}
+
+// on sets how an action answers
+func (f *fakeEC2) on(action string, handler any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[action] = handler
+}
+
+// actions lists the actions called, in order
+func (f *fakeEC2) actions() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var actions []string
+	for _, call := range f.calls {
+		actions = append(actions, call.Action)
+	}
+	return actions
+}
+
+// inputs returns the inputs of every call to an action, in order
+func inputs[I any](f *fakeEC2, action string) []*I {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var found []*I
+	for _, call := range f.calls {
+		if call.Action == action {
+			found = append(found, call.Input.(*I))
+		}
+	}
+	return found
+}
+
+// respond records a call and answers it from the action's handler
+func respond[I, O any](f *fakeEC2, action string, input *I) (*O, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, fakeCall{Action: action, Input: input})
+	handler, ok := f.handlers[action]
+	f.mu.Unlock()
+	if !ok {
+		return new(O), nil
+	}
+	fn, ok := handler.(func(*I) (*O, error))
+	if !ok {
+		panic(fmt.Sprintf("fakeEC2: %s handler is %T", action, handler))
+	}
+	return fn(input)
+}
+
+func (f *fakeEC2) DescribeInstanceTypeOfferings(_ context.Context, params *ec2.DescribeInstanceTypeOfferingsInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstanceTypeOfferingsOutput, error) {
+	return respond[ec2.DescribeInstanceTypeOfferingsInput, ec2.DescribeInstanceTypeOfferingsOutput](f, "DescribeInstanceTypeOfferings", params)
+}
+
+func (f *fakeEC2) AttachInternetGateway(_ context.Context, params *ec2.AttachInternetGatewayInput, _ ...func(*ec2.Options)) (*ec2.AttachInternetGatewayOutput, error) {
+	return respond[ec2.AttachInternetGatewayInput, ec2.AttachInternetGatewayOutput](f, "AttachInternetGateway", params)
+}
+
+func (f *fakeEC2) AuthorizeSecurityGroupEgress(_ context.Context, params *ec2.AuthorizeSecurityGroupEgressInput, _ ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupEgressOutput, error) {
+	return respond[ec2.AuthorizeSecurityGroupEgressInput, ec2.AuthorizeSecurityGroupEgressOutput](f, "AuthorizeSecurityGroupEgress", params)
+}
+
+func (f *fakeEC2) AuthorizeSecurityGroupIngress(_ context.Context, params *ec2.AuthorizeSecurityGroupIngressInput, _ ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	return respond[ec2.AuthorizeSecurityGroupIngressInput, ec2.AuthorizeSecurityGroupIngressOutput](f, "AuthorizeSecurityGroupIngress", params)
+}
+
+func (f *fakeEC2) CancelCapacityReservation(_ context.Context, params *ec2.CancelCapacityReservationInput, _ ...func(*ec2.Options)) (*ec2.CancelCapacityReservationOutput, error) {
+	return respond[ec2.CancelCapacityReservationInput, ec2.CancelCapacityReservationOutput](f, "CancelCapacityReservation", params)
+}
+
+func (f *fakeEC2) CreateCapacityReservation(_ context.Context, params *ec2.CreateCapacityReservationInput, _ ...func(*ec2.Options)) (*ec2.CreateCapacityReservationOutput, error) {
+	return respond[ec2.CreateCapacityReservationInput, ec2.CreateCapacityReservationOutput](f, "CreateCapacityReservation", params)
+}
+
+func (f *fakeEC2) CreateInternetGateway(_ context.Context, params *ec2.CreateInternetGatewayInput, _ ...func(*ec2.Options)) (*ec2.CreateInternetGatewayOutput, error) {
+	return respond[ec2.CreateInternetGatewayInput, ec2.CreateInternetGatewayOutput](f, "CreateInternetGateway", params)
+}
+
+func (f *fakeEC2) CreateRoute(_ context.Context, params *ec2.CreateRouteInput, _ ...func(*ec2.Options)) (*ec2.CreateRouteOutput, error) {
+	return respond[ec2.CreateRouteInput, ec2.CreateRouteOutput](f, "CreateRoute", params)
+}
+
+func (f *fakeEC2) CreateSecurityGroup(_ context.Context, params *ec2.CreateSecurityGroupInput, _ ...func(*ec2.Options)) (*ec2.CreateSecurityGroupOutput, error) {
+	return respond[ec2.CreateSecurityGroupInput, ec2.CreateSecurityGroupOutput](f, "CreateSecurityGroup", params)
+}
+
+func (f *fakeEC2) CreateSubnet(_ context.Context, params *ec2.CreateSubnetInput, _ ...func(*ec2.Options)) (*ec2.CreateSubnetOutput, error) {
+	return respond[ec2.CreateSubnetInput, ec2.CreateSubnetOutput](f, "CreateSubnet", params)
+}
+
+func (f *fakeEC2) CreateTags(_ context.Context, params *ec2.CreateTagsInput, _ ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+	return respond[ec2.CreateTagsInput, ec2.CreateTagsOutput](f, "CreateTags", params)
+}
+
+func (f *fakeEC2) CreateVpc(_ context.Context, params *ec2.CreateVpcInput, _ ...func(*ec2.Options)) (*ec2.CreateVpcOutput, error) {
+	return respond[ec2.CreateVpcInput, ec2.CreateVpcOutput](f, "CreateVpc", params)
+}
+
+func (f *fakeEC2) DeleteInternetGateway(_ context.Context, params *ec2.DeleteInternetGatewayInput, _ ...func(*ec2.Options)) (*ec2.DeleteInternetGatewayOutput, error) {
+	return respond[ec2.DeleteInternetGatewayInput, ec2.DeleteInternetGatewayOutput](f, "DeleteInternetGateway", params)
+}
+
+func (f *fakeEC2) DeleteSecurityGroup(_ context.Context, params *ec2.DeleteSecurityGroupInput, _ ...func(*ec2.Options)) (*ec2.DeleteSecurityGroupOutput, error) {
+	return respond[ec2.DeleteSecurityGroupInput, ec2.DeleteSecurityGroupOutput](f, "DeleteSecurityGroup", params)
+}
+
+func (f *fakeEC2) DeleteSubnet(_ context.Context, params *ec2.DeleteSubnetInput, _ ...func(*ec2.Options)) (*ec2.DeleteSubnetOutput, error) {
+	return respond[ec2.DeleteSubnetInput, ec2.DeleteSubnetOutput](f, "DeleteSubnet", params)
+}
+
+func (f *fakeEC2) DeleteTags(_ context.Context, params *ec2.DeleteTagsInput, _ ...func(*ec2.Options)) (*ec2.DeleteTagsOutput, error) {
+	return respond[ec2.DeleteTagsInput, ec2.DeleteTagsOutput](f, "DeleteTags", params)
+}
+
+func (f *fakeEC2) DeleteVpc(_ context.Context, params *ec2.DeleteVpcInput, _ ...func(*ec2.Options)) (*ec2.DeleteVpcOutput, error) {
+	return respond[ec2.DeleteVpcInput, ec2.DeleteVpcOutput](f, "DeleteVpc", params)
+}
+
+func (f *fakeEC2) DescribeAvailabilityZones(_ context.Context, params *ec2.DescribeAvailabilityZonesInput, _ ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error) {
+	return respond[ec2.DescribeAvailabilityZonesInput, ec2.DescribeAvailabilityZonesOutput](f, "DescribeAvailabilityZones", params)
+}
+
+func (f *fakeEC2) DescribeCapacityReservations(_ context.Context, params *ec2.DescribeCapacityReservationsInput, _ ...func(*ec2.Options)) (*ec2.DescribeCapacityReservationsOutput, error) {
+	return respond[ec2.DescribeCapacityReservationsInput, ec2.DescribeCapacityReservationsOutput](f, "DescribeCapacityReservations", params)
+}
+
+func (f *fakeEC2) DescribeImages(_ context.Context, params *ec2.DescribeImagesInput, _ ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	return respond[ec2.DescribeImagesInput, ec2.DescribeImagesOutput](f, "DescribeImages", params)
+}
+
+func (f *fakeEC2) DescribeInstances(_ context.Context, params *ec2.DescribeInstancesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return respond[ec2.DescribeInstancesInput, ec2.DescribeInstancesOutput](f, "DescribeInstances", params)
+}
+
+func (f *fakeEC2) DescribeInternetGateways(_ context.Context, params *ec2.DescribeInternetGatewaysInput, _ ...func(*ec2.Options)) (*ec2.DescribeInternetGatewaysOutput, error) {
+	return respond[ec2.DescribeInternetGatewaysInput, ec2.DescribeInternetGatewaysOutput](f, "DescribeInternetGateways", params)
+}
+
+func (f *fakeEC2) DescribeLaunchTemplates(_ context.Context, params *ec2.DescribeLaunchTemplatesInput, _ ...func(*ec2.Options)) (*ec2.DescribeLaunchTemplatesOutput, error) {
+	return respond[ec2.DescribeLaunchTemplatesInput, ec2.DescribeLaunchTemplatesOutput](f, "DescribeLaunchTemplates", params)
+}
+
+func (f *fakeEC2) DescribeRegions(_ context.Context, params *ec2.DescribeRegionsInput, _ ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error) {
+	return respond[ec2.DescribeRegionsInput, ec2.DescribeRegionsOutput](f, "DescribeRegions", params)
+}
+
+func (f *fakeEC2) DescribeRouteTables(_ context.Context, params *ec2.DescribeRouteTablesInput, _ ...func(*ec2.Options)) (*ec2.DescribeRouteTablesOutput, error) {
+	return respond[ec2.DescribeRouteTablesInput, ec2.DescribeRouteTablesOutput](f, "DescribeRouteTables", params)
+}
+
+func (f *fakeEC2) DescribeSecurityGroups(_ context.Context, params *ec2.DescribeSecurityGroupsInput, _ ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error) {
+	return respond[ec2.DescribeSecurityGroupsInput, ec2.DescribeSecurityGroupsOutput](f, "DescribeSecurityGroups", params)
+}
+
+func (f *fakeEC2) DescribeSubnets(_ context.Context, params *ec2.DescribeSubnetsInput, _ ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error) {
+	return respond[ec2.DescribeSubnetsInput, ec2.DescribeSubnetsOutput](f, "DescribeSubnets", params)
+}
+
+func (f *fakeEC2) DescribeVolumes(_ context.Context, params *ec2.DescribeVolumesInput, _ ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error) {
+	return respond[ec2.DescribeVolumesInput, ec2.DescribeVolumesOutput](f, "DescribeVolumes", params)
+}
+
+func (f *fakeEC2) DescribeVpcs(_ context.Context, params *ec2.DescribeVpcsInput, _ ...func(*ec2.Options)) (*ec2.DescribeVpcsOutput, error) {
+	return respond[ec2.DescribeVpcsInput, ec2.DescribeVpcsOutput](f, "DescribeVpcs", params)
+}
+
+func (f *fakeEC2) DetachInternetGateway(_ context.Context, params *ec2.DetachInternetGatewayInput, _ ...func(*ec2.Options)) (*ec2.DetachInternetGatewayOutput, error) {
+	return respond[ec2.DetachInternetGatewayInput, ec2.DetachInternetGatewayOutput](f, "DetachInternetGateway", params)
+}
+
+func (f *fakeEC2) ModifySubnetAttribute(_ context.Context, params *ec2.ModifySubnetAttributeInput, _ ...func(*ec2.Options)) (*ec2.ModifySubnetAttributeOutput, error) {
+	return respond[ec2.ModifySubnetAttributeInput, ec2.ModifySubnetAttributeOutput](f, "ModifySubnetAttribute", params)
+}
+
+func (f *fakeEC2) RevokeSecurityGroupEgress(_ context.Context, params *ec2.RevokeSecurityGroupEgressInput, _ ...func(*ec2.Options)) (*ec2.RevokeSecurityGroupEgressOutput, error) {
+	return respond[ec2.RevokeSecurityGroupEgressInput, ec2.RevokeSecurityGroupEgressOutput](f, "RevokeSecurityGroupEgress", params)
+}
+
+func (f *fakeEC2) RunInstances(_ context.Context, params *ec2.RunInstancesInput, _ ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+	return respond[ec2.RunInstancesInput, ec2.RunInstancesOutput](f, "RunInstances", params)
+}
+
+func (f *fakeEC2) StartInstances(_ context.Context, params *ec2.StartInstancesInput, _ ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error) {
+	return respond[ec2.StartInstancesInput, ec2.StartInstancesOutput](f, "StartInstances", params)
+}
+
+func (f *fakeEC2) StopInstances(_ context.Context, params *ec2.StopInstancesInput, _ ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+	return respond[ec2.StopInstancesInput, ec2.StopInstancesOutput](f, "StopInstances", params)
+}
+
+func (f *fakeEC2) TerminateInstances(_ context.Context, params *ec2.TerminateInstancesInput, _ ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+	return respond[ec2.TerminateInstancesInput, ec2.TerminateInstancesOutput](f, "TerminateInstances", params)
+}
@@ -0,0 +1,97 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+
+	sharedtypes "github.com/anoldguy/tse/shared/types"
+)
+
+// TagHop records a multihop node's role and the other node's region, e.g. "entry:frankfurt"
+const TagHop = "tse:hop"
+
+// The multihop tunnel's addresses (outside the VPC and tailnet ranges), and the
+// routing table the entry node sends its clients' traffic through
+const (
+	hopNetwork      = "10.255.255.0/30"
+	hopEntryAddress = "10.255.255.1"
+	hopExitAddress  = "10.255.255.2"
+	hopTable        = "51820"
+)
+
+// hopTagValue is the TagHop value for a node
+func hopTagValue(hop *sharedtypes.HopConfig) string {
+	return hop.Role + ":" + hop.PeerRegion
+}
+
+// hopTemplateData fills in the user data template's multihop section; empty
+// values (no HopRole) leave it out
+func hopTemplateData(hop *sharedtypes.HopConfig) map[string]string {
+	if hop == nil {
+		return map[string]string{"HopRole": ""}
+	}
+
+	data := map[string]string{
+		"HopRole":       hop.Role,
+		"HopPeerRegion": hop.PeerRegion,
+		"HopPrivateKey": hop.PrivateKey,
+		"HopNetwork":    hopNetwork,
+		"HopTable":      hopTable,
+		"HopPort":       strconv.Itoa(sharedtypes.HopPort),
+	}
+	if hop.Role == sharedtypes.HopEntry {
+		data["HopAddress"] = hopEntryAddress + "/30"
+		data["HopPeerAddress"] = hopExitAddress
+		// Everything may come back through the tunnel; keepalives hold the
+		// exit node's firewall state open
+		data["HopWGArgs"] = fmt.Sprintf("peer %s allowed-ips 0.0.0.0/0 endpoint %s persistent-keepalive 25", hop.PeerPublicKey, hop.Endpoint)
+	} else {
+		data["HopAddress"] = hopExitAddress + "/30"
+		data["HopPeerAddress"] = hopEntryAddress
+		data["HopWGArgs"] = fmt.Sprintf("listen-port %d peer %s allowed-ips %s/32", sharedtypes.HopPort, hop.PeerPublicKey, hopEntryAddress)
+	}
+	return data
+}
+
+// allowHop opens the security group for a multihop node: the exit node accepts
+// the tunnel, and under a locked-down baseline the entry node may send it.
+// Groups are shared by a region's nodes, so rules already there are fine.
+func (s *Service) allowHop(ctx context.Context, sgID string, hop *sharedtypes.HopConfig, b Baseline) error {
+	permissions := []types.IpPermission{{
+		IpProtocol: aws.String("udp"),
+		FromPort:   aws.Int32(sharedtypes.HopPort),
+		ToPort:     aws.Int32(sharedtypes.HopPort),
+		IpRanges:   []types.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+	}}
+
+	var err error
+	switch {
+	case hop.Role == sharedtypes.HopExit:
+		_, err = s.ec2Client.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId:       aws.String(sgID),
+			IpPermissions: permissions,
+		})
+	case b.LockEgress:
+		_, err = s.ec2Client.AuthorizeSecurityGroupEgress(ctx, &ec2.AuthorizeSecurityGroupEgressInput{
+			GroupId:       aws.String(sgID),
+			IpPermissions: permissions,
+		})
+	}
+	if err != nil && !isDuplicateRuleError(err) {
+		return fmt.Errorf("failed to allow the multihop tunnel: %w", err)
+	}
+	return nil
+}
+
+// isDuplicateRuleError reports whether a security group rule already existed
+func isDuplicateRuleError(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidPermission.Duplicate"
+}
@@ -0,0 +1,37 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// InvokeSelf queues an asynchronous invocation of the running Lambda with
+// payload and returns once Lambda has accepted it. It uses the Lambda's own
+// credentials, even with ROLE_ARN set.
+func InvokeSelf(ctx context.Context, payload []byte) error {
+	name := os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	if name == "" {
+		return errors.New("not running in Lambda (AWS_LAMBDA_FUNCTION_NAME unset)")
+	}
+
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	_, err = lambda.NewFromConfig(cfg).Invoke(ctx, &lambda.InvokeInput{
+		FunctionName:   aws.String(name),
+		InvocationType: lambdatypes.InvocationTypeEvent,
+		Payload:        payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to invoke %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	sharedtypes "github.com/anoldguy/tse/shared/types"
+)
+
+// TagKeyExpiryDisabled marks nodes whose Tailscale key expiry has been turned
+// off, so it's only done once per node
+const TagKeyExpiryDisabled = "tse:key-expiry-disabled"
+
+// KeyExpiryPending returns running exit nodes that have reported ready but
+// still have Tailscale key expiry on
+func (s *Service) KeyExpiryPending(ctx context.Context) ([]*sharedtypes.InstanceInfo, error) {
+	result, err := s.ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{Name: aws.String("tag:Project"), Values: []string{TagProject}},
+			{Name: aws.String("tag:Type"), Values: []string{TagType}},
+			{Name: aws.String("tag:" + TagReady), Values: []string{"true"}},
+			{Name: aws.String("instance-state-name"), Values: []string{"running"}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe instances: %w", err)
+	}
+
+	var pending []*sharedtypes.InstanceInfo
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			if !s.owns(instance.Tags) || hasTag(instance.Tags, TagKeyExpiryDisabled, "true") {
+				continue
+			}
+			pending = append(pending, instanceInfo(instance))
+		}
+	}
+	return pending, nil
+}
+
+// MarkKeyExpiryDisabled records that a node's Tailscale key expiry is off
+func (s *Service) MarkKeyExpiryDisabled(ctx context.Context, instanceID string) error {
+	_, err := s.ec2Client.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []string{instanceID},
+		Tags:      []types.Tag{{Key: aws.String(TagKeyExpiryDisabled), Value: aws.String("true")}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to tag instance %s: %w", instanceID, err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package aws
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestKeyExpiryPending(t *testing.T) {
+	done := node("i-done", "a1", types.InstanceStateNameRunning)
+	done.Tags = append(done.Tags, types.Tag{Key: aws.String(TagKeyExpiryDisabled), Value: aws.String("true")})
+
+	fake := newFakeEC2()
+	fake.on("DescribeInstances", describing(
+		node("i-new", "a1", types.InstanceStateNameRunning),
+		node("i-other", "b2", types.InstanceStateNameRunning),
+		done,
+	))
+	s := &Service{ec2Client: fake, deployment: "a1"}
+
+	pending, err := s.KeyExpiryPending(context.Background())
+	if err != nil {
+		t.Fatalf("KeyExpiryPending() error = %v", err)
+	}
+	if len(pending) != 1 || pending[0].InstanceID != "i-new" {
+		t.Errorf("KeyExpiryPending() = %v, want only this deployment's unmarked node", pending)
+	}
+	filters := filterValues(inputs[ec2.DescribeInstancesInput](fake, "DescribeInstances")[0].Filters)
+	if !slices.Equal(filters["tag:"+TagReady], []string{"true"}) || !slices.Equal(filters["instance-state-name"], []string{"running"}) {
+		t.Errorf("filters = %v, want running nodes that reported ready", filters)
+	}
+
+	if err := s.MarkKeyExpiryDisabled(context.Background(), "i-new"); err != nil {
+		t.Fatalf("MarkKeyExpiryDisabled() error = %v", err)
+	}
+	tagged := inputs[ec2.CreateTagsInput](fake, "CreateTags")
+	if len(tagged) != 1 || !slices.Equal(tagged[0].Resources, []string{"i-new"}) || !hasTag(tagged[0].Tags, TagKeyExpiryDisabled, "true") {
+		t.Errorf("CreateTags calls = %+v", tagged)
+	}
+}
@@ -0,0 +1,331 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+
+	sharedtypes "github.com/anoldguy/tse/shared/types"
+)
+
+// FallbackInstanceType is the x86_64 instance type used when t4g capacity
+// isn't available anywhere in the region
+const FallbackInstanceType = "t3.nano"
+
+// launchArchitecture is an instance type and the AMI architecture it runs
+type launchArchitecture struct {
+	Name         string // EC2 architecture, as in AMI names and InstanceInfo.Architecture
+	InstanceType string
+}
+
+// launchArchitectures are tried in order: Graviton first for cost, then x86_64
+// for regions or zones that are out of t4g capacity
+var launchArchitectures = []launchArchitecture{
+	{Name: "arm64", InstanceType: InstanceType},
+	{Name: "x86_64", InstanceType: FallbackInstanceType},
+}
+
+// IsCapacityError reports whether RunInstances failed for lack of capacity (or
+// support) for the instance type in the subnet's zone, so another zone or
+// instance type might succeed
+func IsCapacityError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "InsufficientInstanceCapacity", "InsufficientCapacity", "Unsupported", "InsufficientCapacityOnHost":
+		return true
+	}
+	return false
+}
+
+// launchZones orders the zones to try: the reservation's (when usable), then
+// the existing subnet's, then the rest of the region's available zones
+func launchZones(available []string, primary string, reservation string) []string {
+	var zones []string
+	for _, az := range []string{reservation, primary} {
+		if az != "" && !slices.Contains(zones, az) {
+			zones = append(zones, az)
+		}
+	}
+	for _, az := range available {
+		if !slices.Contains(zones, az) {
+			zones = append(zones, az)
+		}
+	}
+	return zones
+}
+
+// offeredZones filters zones down to those in offered, keeping their order.
+// A nil offered means the offerings couldn't be looked up, so every zone is kept.
+func offeredZones(zones []string, offered []string) []string {
+	if offered == nil {
+		return zones
+	}
+	var kept []string
+	for _, az := range zones {
+		if slices.Contains(offered, az) {
+			kept = append(kept, az)
+		}
+	}
+	return kept
+}
+
+// instanceTypeZones lists the zones that offer an instance type. Not every
+// zone has every type (t4g is missing from some older ones), and launching
+// there fails with Unsupported instead of just being slow to find capacity.
+func (s *Service) instanceTypeZones(ctx context.Context, instanceType string) ([]string, error) {
+	zones := []string{}
+	paginator := ec2.NewDescribeInstanceTypeOfferingsPaginator(s.ec2Client, &ec2.DescribeInstanceTypeOfferingsInput{
+		LocationType: types.LocationTypeAvailabilityZone,
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("instance-type"),
+				Values: []string{instanceType},
+			},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe %s offerings: %w", instanceType, err)
+		}
+		for _, offering := range page.InstanceTypeOfferings {
+			zones = append(zones, aws.ToString(offering.Location))
+		}
+	}
+	return zones, nil
+}
+
+// launchableZones narrows zones to those offering instanceType. If the
+// offerings can't be read (an older deployment without the permission), every
+// zone is tried and RunInstances sorts it out.
+func (s *Service) launchableZones(ctx context.Context, zones []string, instanceType string) []string {
+	offered, err := s.instanceTypeZones(ctx, instanceType)
+	if err != nil {
+		log.Printf("Trying every zone for %s: %v", instanceType, err)
+	}
+	return offeredZones(zones, offered)
+}
+
+// availabilityZones lists the region's available zones
+func (s *Service) availabilityZones(ctx context.Context) ([]string, error) {
+	azResult, err := s.ec2Client.DescribeAvailabilityZones(ctx, &ec2.DescribeAvailabilityZonesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("state"),
+				Values: []string{"available"},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get availability zones: %w", err)
+	}
+
+	var zones []string
+	for _, az := range azResult.AvailabilityZones {
+		zones = append(zones, aws.ToString(az.ZoneName))
+	}
+	return zones, nil
+}
+
+// subnetAvailabilityZone returns the zone a subnet is in
+func (s *Service) subnetAvailabilityZone(ctx context.Context, subnetID string) (string, error) {
+	subnetResult, err := s.ec2Client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{SubnetIds: []string{subnetID}})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe subnet %s: %w", subnetID, err)
+	}
+	if len(subnetResult.Subnets) == 0 {
+		return "", fmt.Errorf("subnet %s not found", subnetID)
+	}
+	return aws.ToString(subnetResult.Subnets[0].AvailabilityZone), nil
+}
+
+// subnetInZone returns the VPC's TSE subnet in az, creating one (with the next
+// free 10.0.N.0/24 block) if the VPC doesn't have one there yet
+func (s *Service) subnetInZone(ctx context.Context, vpcID, friendlyRegion, az string) (string, error) {
+	subnetResult, err := s.ec2Client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{
+		Filters: []types.Filter{{Name: aws.String("vpc-id"), Values: []string{vpcID}}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to find subnets in VPC %s: %w", vpcID, err)
+	}
+
+	var used []string
+	for _, sn := range subnetResult.Subnets {
+		if aws.ToString(sn.AvailabilityZone) == az && hasTag(sn.Tags, "Project", TagProject) && hasTag(sn.Tags, "Type", TagType) {
+			return aws.ToString(sn.SubnetId), nil
+		}
+		used = append(used, aws.ToString(sn.CidrBlock))
+	}
+
+	cidr := nextSubnetCIDR(used)
+	if cidr == "" {
+		return "", fmt.Errorf("no free subnet block left in VPC %s", vpcID)
+	}
+	return s.createSubnet(ctx, vpcID, friendlyRegion, az, cidr)
+}
+
+// nextSubnetCIDR returns the first 10.0.N.0/24 block (N from 1) not in used
+func nextSubnetCIDR(used []string) string {
+	for n := 1; n < 256; n++ {
+		cidr := fmt.Sprintf("10.0.%d.0/24", n)
+		if !slices.Contains(used, cidr) {
+			return cidr
+		}
+	}
+	return ""
+}
+
+// createSubnet creates a public TSE subnet. It uses the VPC's main route table,
+// which routes to the internet gateway.
+func (s *Service) createSubnet(ctx context.Context, vpcID, friendlyRegion, az, cidr string) (string, error) {
+	subnetResult, err := s.ec2Client.CreateSubnet(ctx, &ec2.CreateSubnetInput{
+		VpcId:            aws.String(vpcID),
+		CidrBlock:        aws.String(cidr),
+		AvailabilityZone: aws.String(az),
+		TagSpecifications: []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeSubnet,
+				Tags: append([]types.Tag{
+					{Key: aws.String("Name"), Value: aws.String(fmt.Sprintf("tse-subnet-%s-%s", friendlyRegion, az))},
+					{Key: aws.String("Project"), Value: aws.String(TagProject)},
+					{Key: aws.String("Type"), Value: aws.String(TagType)},
+					{Key: aws.String("Region"), Value: aws.String(friendlyRegion)},
+					createdTag(),
+				}, s.deploymentTags()...),
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create subnet in %s: %w", az, err)
+	}
+
+	subnetID := *subnetResult.Subnet.SubnetId
+
+	// Enable auto-assign public IP for the subnet
+	_, err = s.ec2Client.ModifySubnetAttribute(ctx, &ec2.ModifySubnetAttributeInput{
+		SubnetId: aws.String(subnetID),
+		MapPublicIpOnLaunch: &types.AttributeBooleanValue{
+			Value: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to enable auto-assign public IP for subnet: %w", err)
+	}
+
+	return subnetID, nil
+}
+
+// launchToken identifies one start request's launch for RunInstances idempotency
+type launchToken struct {
+	Client  string // From the StartRequest; empty when the client sent none
+	Attempt int    // StartInstance's attempt, as resources may be rebuilt between them
+}
+
+// For returns the RunInstances ClientToken for launching arch in az. Each
+// combination needs its own token: EC2 rejects a reused token whose parameters
+// differ, and a retried start tries them in the same order.
+func (t launchToken) For(arch, az string) *string {
+	if t.Client == "" {
+		return nil
+	}
+	token := fmt.Sprintf("%s-%d-%s-%s", t.Client, t.Attempt, arch, az)
+	return aws.String(token[:min(len(token), maxClientTokenLength)])
+}
+
+// maxClientTokenLength is the longest ClientToken RunInstances accepts
+const maxClientTokenLength = 64
+
+// runInstance launches input, trying each architecture in every zone that offers
+// its instance type until one has capacity. The subnet's zone goes first, after the reservation's; subnets
+// in other zones are created as needed. The reservation, if any, is only
+// targeted for its own instance type and zone. With a launch template, the
+// first architecture's image and instance type come from it.
+func (s *Service) runInstance(ctx context.Context, input *ec2.RunInstancesInput, token launchToken, baseline Baseline, vpcID, subnetID, friendlyRegion string, reservation *sharedtypes.ReservationInfo) (*ec2.RunInstancesOutput, error) {
+	subnetZone, err := s.subnetAvailabilityZone(ctx, subnetID)
+	if err != nil {
+		return nil, err
+	}
+	available, err := s.availabilityZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reservationZone := ""
+	if reservation != nil {
+		reservationZone = reservation.AvailabilityZone
+	}
+	zones := launchZones(available, subnetZone, reservationZone)
+
+	var lastErr error
+	for i, arch := range launchArchitectures {
+		rootDevice := launchTemplateRootDevice
+		if i > 0 || input.LaunchTemplate == nil {
+			// The launch template only covers the first architecture; the rest override its image
+			ami, err := s.getLatestAmazonLinux2023AMI(ctx, arch.Name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find Amazon Linux 2023 %s AMI: %w", arch.Name, err)
+			}
+			input.ImageId = ami.ImageId
+			input.InstanceType = types.InstanceType(arch.InstanceType)
+			rootDevice = aws.ToString(ami.RootDeviceName)
+		}
+		if i == 0 {
+			// Key pair, metadata options and root volume encryption come from the baseline
+			applyBaseline(baseline, input, rootDevice)
+		} else if len(input.BlockDeviceMappings) > 0 {
+			input.BlockDeviceMappings[0].DeviceName = aws.String(rootDevice)
+		}
+
+		for _, az := range s.launchableZones(ctx, zones, arch.InstanceType) {
+			zoneSubnetID := subnetID
+			if az != subnetZone {
+				if zoneSubnetID, err = s.subnetInZone(ctx, vpcID, friendlyRegion, az); err != nil {
+					return nil, err
+				}
+			}
+			input.SubnetId = aws.String(zoneSubnetID)
+			input.ClientToken = token.For(arch.Name, az)
+
+			input.CapacityReservationSpecification = nil
+			if reservation != nil && az == reservation.AvailabilityZone && arch.InstanceType == reservation.InstanceType {
+				input.CapacityReservationSpecification = &types.CapacityReservationSpecification{
+					CapacityReservationTarget: &types.CapacityReservationTarget{
+						CapacityReservationId: aws.String(reservation.ReservationID),
+					},
+				}
+			}
+
+			runResult, err := s.launch(ctx, input)
+			if err == nil {
+				return runResult, nil
+			}
+			if !IsCapacityError(err) {
+				return nil, err
+			}
+			log.Printf("No %s capacity in %s: %v", arch.InstanceType, az, err)
+			lastErr = err
+		}
+	}
+
+	return nil, fmt.Errorf("no capacity for %s or %s in any availability zone: %w", InstanceType, FallbackInstanceType, lastErr)
+}
+
+// launch calls RunInstances, retrying without the instance profile if it's rejected
+func (s *Service) launch(ctx context.Context, input *ec2.RunInstancesInput) (*ec2.RunInstancesOutput, error) {
+	runResult, err := s.ec2Client.RunInstances(ctx, input)
+	if err != nil && input.IamInstanceProfile != nil && isInstanceProfileError(err) {
+		log.Printf("Launching without instance profile %s: %v", *input.IamInstanceProfile.Name, err)
+		input.IamInstanceProfile = nil
+		runResult, err = s.ec2Client.RunInstances(ctx, input)
+	}
+	return runResult, err
+}
@@ -0,0 +1,112 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestIsCapacityError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("operation error EC2: RunInstances: %w", &smithy.GenericAPIError{Code: "InsufficientInstanceCapacity"}), true},
+		{&smithy.GenericAPIError{Code: "Unsupported"}, true},
+		{&smithy.GenericAPIError{Code: "InvalidParameterValue"}, false},
+		{errors.New("InsufficientInstanceCapacity"), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsCapacityError(tt.err); got != tt.want {
+			t.Errorf("IsCapacityError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestLaunchZones(t *testing.T) {
+	available := []string{"us-east-2a", "us-east-2b", "us-east-2c"}
+
+	tests := []struct {
+		name        string
+		primary     string
+		reservation string
+		want        []string
+	}{
+		{"subnet zone first", "us-east-2b", "", []string{"us-east-2b", "us-east-2a", "us-east-2c"}},
+		{"reservation before subnet", "us-east-2a", "us-east-2c", []string{"us-east-2c", "us-east-2a", "us-east-2b"}},
+		{"reservation in subnet zone", "us-east-2a", "us-east-2a", []string{"us-east-2a", "us-east-2b", "us-east-2c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := launchZones(available, tt.primary, tt.reservation); !slices.Equal(got, tt.want) {
+				t.Errorf("launchZones = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOfferedZones(t *testing.T) {
+	zones := []string{"us-east-1a", "us-east-1b", "us-east-1e", "us-east-1f"}
+
+	if got := offeredZones(zones, []string{"us-east-1f", "us-east-1a"}); !slices.Equal(got, []string{"us-east-1a", "us-east-1f"}) {
+		t.Errorf("offeredZones = %v, want [us-east-1a us-east-1f] in launch order", got)
+	}
+	if got := offeredZones(zones, []string{}); len(got) != 0 {
+		t.Errorf("offeredZones with no offerings = %v, want none", got)
+	}
+	if got := offeredZones(zones, nil); !slices.Equal(got, zones) {
+		t.Errorf("offeredZones without offerings data = %v, want every zone", got)
+	}
+}
+
+func TestNextSubnetCIDR(t *testing.T) {
+	if got := nextSubnetCIDR(nil); got != "10.0.1.0/24" {
+		t.Errorf("nextSubnetCIDR(nil) = %q, want 10.0.1.0/24", got)
+	}
+	if got := nextSubnetCIDR([]string{"10.0.1.0/24", "10.0.3.0/24"}); got != "10.0.2.0/24" {
+		t.Errorf("nextSubnetCIDR skipped a gap: got %q, want 10.0.2.0/24", got)
+	}
+}
+
+func TestInstanceInfoArchitecture(t *testing.T) {
+	instance := types.Instance{
+		InstanceId:   aws.String("i-0123456789abcdef0"),
+		State:        &types.InstanceState{Name: types.InstanceStateNameRunning},
+		LaunchTime:   aws.Time(time.Now()),
+		InstanceType: types.InstanceType(FallbackInstanceType),
+		Architecture: types.ArchitectureValuesX8664,
+	}
+
+	info := instanceInfo(instance)
+	if info.Architecture != "x86_64" || info.InstanceType != "t3.nano" {
+		t.Errorf("instanceInfo = %s (%s), want t3.nano (x86_64)", info.InstanceType, info.Architecture)
+	}
+}
+
+func TestLaunchTokenFor(t *testing.T) {
+	if got := (launchToken{}).For("arm64", "us-east-2a"); got != nil {
+		t.Errorf("For without a client token = %q, want nil", *got)
+	}
+
+	token := launchToken{Client: "abc123", Attempt: 2}
+	if got := aws.ToString(token.For("arm64", "us-east-2a")); got != "abc123-2-arm64-us-east-2a" {
+		t.Errorf("For = %q, want abc123-2-arm64-us-east-2a", got)
+	}
+	if token.For("arm64", "us-east-2a") == token.For("x86_64", "us-east-2a") {
+		t.Error("For gave two architectures the same token")
+	}
+
+	long := launchToken{Client: strings.Repeat("f", 36), Attempt: 10}
+	if got := aws.ToString(long.For("x86_64", "ap-southeast-2a")); len(got) > maxClientTokenLength {
+		t.Errorf("For = %q (%d chars), want at most %d", got, len(got), maxClientTokenLength)
+	}
+}
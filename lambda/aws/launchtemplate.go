@@ -0,0 +1,42 @@
+package aws
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const (
+	// EnvLaunchTemplate names the launch template tse deploy keeps in every
+	// region. Starts launch from its default version when it's there.
+	EnvLaunchTemplate = "TSE_LAUNCH_TEMPLATE"
+
+	// launchTemplateRootDevice is the root device of the Amazon Linux 2023 image
+	// the template resolves, which root volume encryption has to name
+	launchTemplateRootDevice = "/dev/xvda"
+)
+
+// launchTemplate returns the deployed launch template to start from, or nil to
+// compose every RunInstances parameter instead: when none is configured, or
+// the region doesn't have it (a region enabled after the last deploy).
+func (s *Service) launchTemplate(ctx context.Context) *types.LaunchTemplateSpecification {
+	name := os.Getenv(EnvLaunchTemplate)
+	if name == "" {
+		return nil
+	}
+	result, err := s.ec2Client.DescribeLaunchTemplates(ctx, &ec2.DescribeLaunchTemplatesInput{
+		LaunchTemplateNames: []string{name},
+	})
+	if err != nil || len(result.LaunchTemplates) == 0 {
+		log.Printf("Launching without launch template %s: %v", name, err)
+		return nil
+	}
+	return &types.LaunchTemplateSpecification{
+		LaunchTemplateName: aws.String(name),
+		Version:            aws.String("$Default"),
+	}
+}
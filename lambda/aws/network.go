@@ -0,0 +1,140 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/anoldguy/tse/shared/regions"
+	sharedtypes "github.com/anoldguy/tse/shared/types"
+)
+
+// TagPersistent marks a region's VPC as kept between sessions: stops leave it
+// (and its security group) in place, and only ReleaseNetwork or an explicit
+// cleanup removes it
+const TagPersistent = "tse:persistent"
+
+// persistent reports whether a VPC's tags mark it as kept between sessions
+func persistent(tags []types.Tag) bool {
+	return hasTag(tags, TagPersistent, "true")
+}
+
+// FindNetwork returns the region's VPC stack, or nil if there isn't one
+func (s *Service) FindNetwork(ctx context.Context, friendlyRegion string) (*sharedtypes.NetworkInfo, error) {
+	vpc, err := s.regionVPC(ctx, friendlyRegion)
+	if err != nil || vpc == nil {
+		return nil, err
+	}
+	info := networkInfo(*vpc, friendlyRegion)
+	// A VPC whose subnet is missing still shows; the next start rebuilds around it
+	if subnetID, err := s.findSubnetInVPC(ctx, info.VPCID); err == nil {
+		info.SubnetID = subnetID
+	}
+	return info, nil
+}
+
+// KeepNetwork makes the region's VPC stack persistent, building it and the
+// security group for the current baseline first if need be, so the next start
+// only has to launch the instance
+func (s *Service) KeepNetwork(ctx context.Context, friendlyRegion string) (*sharedtypes.NetworkInfo, error) {
+	baseline, err := BaselineFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	subnetID, vpcID, err := s.findOrCreateVPCStack(ctx, friendlyRegion)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.findOrCreateSecurityGroup(ctx, vpcID, friendlyRegion, baseline); err != nil {
+		return nil, err
+	}
+
+	_, err = s.ec2Client.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []string{vpcID},
+		Tags:      []types.Tag{{Key: aws.String(TagPersistent), Value: aws.String("true")}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark VPC %s persistent: %w", vpcID, err)
+	}
+
+	info := networkInfo(types.Vpc{VpcId: aws.String(vpcID)}, friendlyRegion)
+	info.SubnetID = subnetID
+	info.Persistent = true
+	return info, nil
+}
+
+// ReleaseNetwork stops keeping the region's VPC stack and returns it, or nil
+// if there wasn't one. With no nodes left it deletes the stack and its security
+// groups and reports removed; otherwise the stack goes with the next stop.
+func (s *Service) ReleaseNetwork(ctx context.Context, friendlyRegion string) (network *sharedtypes.NetworkInfo, removed bool, err error) {
+	network, err = s.FindNetwork(ctx, friendlyRegion)
+	if err != nil || network == nil {
+		return nil, false, err
+	}
+
+	_, err = s.ec2Client.DeleteTags(ctx, &ec2.DeleteTagsInput{
+		Resources: []string{network.VPCID},
+		Tags:      []types.Tag{{Key: aws.String(TagPersistent)}},
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to unmark VPC %s: %w", network.VPCID, err)
+	}
+	network.Persistent = false
+
+	// Running, booting or paused instances still use the VPC
+	instances, err := s.ListInstances(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(instances) > 0 {
+		return network, false, nil
+	}
+
+	if err := s.deleteSecurityGroups(ctx, network.VPCID); err != nil {
+		return nil, false, err
+	}
+	if err := s.deleteVPCStack(ctx, network.VPCID); err != nil {
+		return nil, false, err
+	}
+	return network, true, nil
+}
+
+// deleteSecurityGroups deletes the tse security groups in a VPC, which would
+// otherwise keep it from being deleted
+func (s *Service) deleteSecurityGroups(ctx context.Context, vpcID string) error {
+	result, err := s.ec2Client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
+		Filters: []types.Filter{
+			{Name: aws.String("vpc-id"), Values: []string{vpcID}},
+			{Name: aws.String("tag:Project"), Values: []string{TagProject}},
+			{Name: aws.String("tag:Type"), Values: []string{TagType}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe security groups: %w", err)
+	}
+	for _, sg := range result.SecurityGroups {
+		_, err := s.ec2Client.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{
+			GroupId: sg.GroupId,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete security group %s: %w", aws.ToString(sg.GroupId), err)
+		}
+	}
+	return nil
+}
+
+// networkInfo converts a VPC to the API's description of it
+func networkInfo(vpc types.Vpc, friendlyRegion string) *sharedtypes.NetworkInfo {
+	info := &sharedtypes.NetworkInfo{
+		VPCID:          aws.ToString(vpc.VpcId),
+		FriendlyRegion: friendlyRegion,
+		Persistent:     persistent(vpc.Tags),
+	}
+	if awsRegion, err := regions.GetAWSRegion(friendlyRegion); err == nil {
+		info.Region = awsRegion
+	}
+	return info
+}
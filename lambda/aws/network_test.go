@@ -0,0 +1,107 @@
+package aws
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// networkFake answers for a region with one VPC stack, vpc-1, with these tags
+// and a security group in it
+func networkFake(tags ...types.Tag) *fakeEC2 {
+	fake := newFakeEC2()
+	fake.on("DescribeVpcs", func(*ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
+		return &ec2.DescribeVpcsOutput{Vpcs: []types.Vpc{{VpcId: aws.String("vpc-1"), Tags: tags}}}, nil
+	})
+	fake.on("DescribeSubnets", func(*ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+		return &ec2.DescribeSubnetsOutput{Subnets: []types.Subnet{{SubnetId: aws.String("subnet-1")}}}, nil
+	})
+	fake.on("DescribeSecurityGroups", func(*ec2.DescribeSecurityGroupsInput) (*ec2.DescribeSecurityGroupsOutput, error) {
+		return &ec2.DescribeSecurityGroupsOutput{SecurityGroups: []types.SecurityGroup{{GroupId: aws.String("sg-1")}}}, nil
+	})
+	return fake
+}
+
+func TestCleanupKeepsPersistentVPC(t *testing.T) {
+	old := types.Tag{Key: aws.String(TagCreated), Value: aws.String(time.Now().Add(-time.Hour).UTC().Format(time.RFC3339))}
+	kept := types.Tag{Key: aws.String(TagPersistent), Value: aws.String("true")}
+
+	// A stop leaves it without counting it as skipped
+	fake := networkFake(old, kept)
+	deleted, skipped, failed, err := (&Service{ec2Client: fake}).cleanupVPCInfrastructure(context.Background(), false, true)
+	if err != nil || deleted != nil || skipped != nil || failed != nil {
+		t.Errorf("cleanupVPCInfrastructure() = %v, %v, %v, %v, want nothing touched", deleted, skipped, failed, err)
+	}
+	if slices.Contains(fake.actions(), "DeleteVpc") {
+		t.Error("a stop deleted a persistent VPC")
+	}
+
+	// An explicit cleanup removes it like any other
+	fake = networkFake(old, kept)
+	deleted, _, _, err = (&Service{ec2Client: fake}).cleanupVPCInfrastructure(context.Background(), false, false)
+	if err != nil || !slices.Equal(deleted, []string{"vpc-1"}) {
+		t.Errorf("cleanupVPCInfrastructure() deleted %v, %v, want vpc-1", deleted, err)
+	}
+}
+
+func TestKeepNetwork(t *testing.T) {
+	clearStartEnv(t)
+	fake := networkFake()
+
+	network, err := (&Service{ec2Client: fake}).KeepNetwork(context.Background(), "ohio")
+	if err != nil {
+		t.Fatalf("KeepNetwork() error = %v", err)
+	}
+	if network.VPCID != "vpc-1" || network.SubnetID != "subnet-1" || !network.Persistent || network.Region != "us-east-2" {
+		t.Errorf("KeepNetwork() = %+v", network)
+	}
+	if slices.Contains(fake.actions(), "CreateVpc") || slices.Contains(fake.actions(), "CreateSecurityGroup") {
+		t.Errorf("KeepNetwork() rebuilt an existing stack: %v", fake.actions())
+	}
+	tagged := inputs[ec2.CreateTagsInput](fake, "CreateTags")
+	if len(tagged) != 1 || !slices.Equal(tagged[0].Resources, []string{"vpc-1"}) || !persistent(tagged[0].Tags) {
+		t.Errorf("CreateTags calls = %+v, want vpc-1 marked persistent", tagged)
+	}
+}
+
+func TestReleaseNetwork(t *testing.T) {
+	kept := types.Tag{Key: aws.String(TagPersistent), Value: aws.String("true")}
+
+	t.Run("no nodes", func(t *testing.T) {
+		fake := networkFake(kept)
+		network, removed, err := (&Service{ec2Client: fake}).ReleaseNetwork(context.Background(), "ohio")
+		if err != nil || !removed || network.VPCID != "vpc-1" || network.Persistent {
+			t.Fatalf("ReleaseNetwork() = %+v, %v, %v, want vpc-1 removed", network, removed, err)
+		}
+		for _, action := range []string{"DeleteTags", "DeleteSecurityGroup", "DeleteVpc"} {
+			if !slices.Contains(fake.actions(), action) {
+				t.Errorf("release missing %s: %v", action, fake.actions())
+			}
+		}
+	})
+
+	t.Run("node still running", func(t *testing.T) {
+		fake := networkFake(kept)
+		fake.on("DescribeInstances", describing(node("i-1", "", types.InstanceStateNameRunning)))
+		network, removed, err := (&Service{ec2Client: fake}).ReleaseNetwork(context.Background(), "ohio")
+		if err != nil || removed || network == nil {
+			t.Fatalf("ReleaseNetwork() = %+v, %v, %v, want it left for the next stop", network, removed, err)
+		}
+		if !slices.Contains(fake.actions(), "DeleteTags") || slices.Contains(fake.actions(), "DeleteVpc") {
+			t.Errorf("ReleaseNetwork() = %v, want the VPC unmarked and left", fake.actions())
+		}
+	})
+
+	t.Run("no network", func(t *testing.T) {
+		fake := newFakeEC2()
+		network, removed, err := (&Service{ec2Client: fake}).ReleaseNetwork(context.Background(), "ohio")
+		if err != nil || removed || network != nil {
+			t.Errorf("ReleaseNetwork() = %+v, %v, %v, want nothing", network, removed, err)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// RegionEnabled reports whether the account can use awsRegion. Ask a service in
+// a region that's always enabled, such as the Lambda's own: EC2 in a disabled
+// region rejects every call.
+func (s *Service) RegionEnabled(ctx context.Context, awsRegion string) (bool, error) {
+	result, err := s.ec2Client.DescribeRegions(ctx, &ec2.DescribeRegionsInput{
+		AllRegions:  aws.Bool(true),
+		RegionNames: []string{awsRegion},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to describe region %s: %w", awsRegion, err)
+	}
+
+	for _, region := range result.Regions {
+		if aws.ToString(region.RegionName) == awsRegion {
+			return regionUsable(region), nil
+		}
+	}
+	return false, fmt.Errorf("region %s not found", awsRegion)
+}
+
+// regionUsable reports whether a region's opt-in status allows using it
+func regionUsable(region types.Region) bool {
+	switch aws.ToString(region.OptInStatus) {
+	case "opt-in-not-required", "opted-in":
+		return true
+	}
+	return false
+}
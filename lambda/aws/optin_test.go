@@ -0,0 +1,23 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestRegionUsable(t *testing.T) {
+	tests := map[string]bool{
+		"opt-in-not-required": true,
+		"opted-in":            true,
+		"not-opted-in":        false,
+		"":                    false,
+	}
+	for status, want := range tests {
+		region := types.Region{RegionName: aws.String("eu-central-2"), OptInStatus: aws.String(status)}
+		if got := regionUsable(region); got != want {
+			t.Errorf("regionUsable(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
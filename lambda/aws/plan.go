@@ -0,0 +1,164 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/anoldguy/tse/shared/routes"
+	sharedtypes "github.com/anoldguy/tse/shared/types"
+)
+
+// startPlan is what a start would launch with, as PlanStart found it. Empty IDs
+// are resources the start would create.
+type startPlan struct {
+	Region          string // Friendly name
+	VPCID           string
+	SubnetID        string
+	Zone            string // Where a new VPC's first subnet would go
+	SecurityGroupID string
+	ImageID         string // Latest Amazon Linux 2023 arm64 AMI; unused with a launch template
+	LaunchTemplate  string // Deploy's launch template, when the region has it
+	InstanceProfile string
+	Baseline        Baseline
+	Reservation     *sharedtypes.ReservationInfo
+	Opts            NodeOptions
+}
+
+// PlanStart describes the EC2 calls StartInstance would make in a region, one
+// per line with its parameters, for dry-run starts. It looks up the VPC,
+// security group, AMI and reservation a start would use, but creates nothing.
+func (s *Service) PlanStart(ctx context.Context, friendlyRegion string, opts NodeOptions) ([]string, error) {
+	baseline, err := BaselineFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	plan := startPlan{
+		Region:          friendlyRegion,
+		Baseline:        baseline,
+		InstanceProfile: os.Getenv("TSE_INSTANCE_PROFILE"),
+		Reservation:     s.usableReservation(ctx, friendlyRegion),
+		Opts:            opts,
+	}
+
+	if plan.VPCID, err = s.findVPC(ctx, friendlyRegion); err != nil {
+		return nil, err
+	}
+	if plan.VPCID != "" {
+		if plan.SubnetID, err = s.findSubnetInVPC(ctx, plan.VPCID); err != nil {
+			return nil, err
+		}
+		if plan.SecurityGroupID, err = s.findSecurityGroup(ctx, plan.VPCID, friendlyRegion, baseline); err != nil {
+			return nil, err
+		}
+	} else {
+		if plan.Zone, err = s.defaultAvailabilityZone(ctx); err != nil {
+			return nil, err
+		}
+		if plan.Reservation != nil {
+			plan.Zone = plan.Reservation.AvailabilityZone
+		}
+	}
+
+	if template := s.launchTemplate(ctx); template != nil {
+		plan.LaunchTemplate = *template.LaunchTemplateName
+		return startCalls(plan), nil
+	}
+	ami, err := s.getLatestAmazonLinux2023AMI(ctx, launchArchitectures[0].Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find Amazon Linux 2023 %s AMI: %w", launchArchitectures[0].Name, err)
+	}
+	plan.ImageID = *ami.ImageId
+
+	return startCalls(plan), nil
+}
+
+// startCalls lists the calls a start makes given what already exists
+func startCalls(p startPlan) []string {
+	var calls []string
+	add := func(action string, params ...string) {
+		calls = append(calls, strings.TrimSpace("ec2:"+action+" "+strings.Join(params, " ")))
+	}
+
+	vpc, subnet := p.VPCID, p.SubnetID
+	if vpc == "" {
+		vpc, subnet = "(new VPC)", "(new subnet)"
+		add("CreateVpc", "CidrBlock="+routes.VPCCIDR, "Name=tse-vpc-"+p.Region)
+		add("CreateSubnet", "CidrBlock=10.0.1.0/24", "AvailabilityZone="+p.Zone, fmt.Sprintf("Name=tse-subnet-%s-%s", p.Region, p.Zone))
+		add("ModifySubnetAttribute", "MapPublicIpOnLaunch=true")
+		add("CreateInternetGateway", "Name=tse-igw-"+p.Region)
+		add("AttachInternetGateway", "VpcId="+vpc)
+		add("CreateRoute", "DestinationCidrBlock=0.0.0.0/0", "GatewayId=(new internet gateway)")
+	}
+
+	sg := p.SecurityGroupID
+	if sg == "" {
+		sg = "(new security group)"
+		ingress := "IpPermissions=udp/41641"
+		if p.Baseline.AllowSSH {
+			ingress += ",tcp/22"
+		}
+		add("CreateSecurityGroup", "GroupName="+securityGroupName(p.Region, p.Baseline), "VpcId="+vpc, "Baseline="+p.Baseline.Name)
+		add("AuthorizeSecurityGroupIngress", "GroupId="+sg, ingress, "CidrIp=0.0.0.0/0")
+		if p.Baseline.LockEgress {
+			var egress []string
+			for _, rule := range egressRules {
+				egress = append(egress, fmt.Sprintf("%s/%d-%d", rule.protocol, rule.from, rule.to))
+			}
+			add("AuthorizeSecurityGroupEgress", "GroupId="+sg, "IpPermissions="+strings.Join(egress, ","))
+			add("RevokeSecurityGroupEgress", "GroupId="+sg, "IpPermissions=all")
+		}
+	}
+
+	if hop := p.Opts.Hop; hop != nil {
+		switch {
+		case hop.Role == sharedtypes.HopExit:
+			add("AuthorizeSecurityGroupIngress", "GroupId="+sg, fmt.Sprintf("IpPermissions=udp/%d", sharedtypes.HopPort), "(multihop tunnel)")
+		case p.Baseline.LockEgress:
+			add("AuthorizeSecurityGroupEgress", "GroupId="+sg, fmt.Sprintf("IpPermissions=udp/%d", sharedtypes.HopPort), "(multihop tunnel)")
+		}
+	}
+
+	// The launch template has the image, instance type and shutdown behavior
+	run := []string{"ImageId=" + p.ImageID, "InstanceType=" + InstanceType, "InstanceInitiatedShutdownBehavior=terminate"}
+	if p.LaunchTemplate != "" {
+		run = []string{"LaunchTemplate=" + p.LaunchTemplate + ",$Default"}
+	}
+	run = append(run,
+		"SubnetId="+subnet,
+		"SecurityGroupIds="+sg,
+		"Name=tse-exit-"+p.Region,
+		"Baseline="+p.Baseline.Name,
+	)
+	if p.InstanceProfile != "" {
+		run = append(run, "IamInstanceProfile="+p.InstanceProfile)
+	}
+	if p.Baseline.KeyPair {
+		run = append(run, "KeyName="+KeyPairName)
+	}
+	if p.Baseline.RequireIMDSv2 {
+		run = append(run, "HttpTokens=required")
+	}
+	if p.Baseline.EncryptEBS {
+		run = append(run, "Encrypted=true")
+	}
+	if r := p.Reservation; r != nil && r.InstanceType == InstanceType {
+		run = append(run, "CapacityReservationId="+r.ReservationID)
+	}
+	userData := "UserData=tailscale up --advertise-exit-node --hostname=exit-" + p.Region
+	if len(p.Opts.Routes) > 0 {
+		userData += " --advertise-routes=" + strings.Join(p.Opts.Routes, ",")
+	}
+	if !p.Opts.DNS.IsZero() {
+		userData += " --accept-dns=false, resolver " + p.Opts.DNS.Name
+	}
+	if hop := p.Opts.Hop; hop != nil {
+		userData += fmt.Sprintf(", multihop %s for %s", hop.Role, hop.PeerRegion)
+	}
+	run = append(run, userData)
+	add("RunInstances", run...)
+	calls = append(calls, fmt.Sprintf("(if %s has no capacity: other zones, then %s with the x86_64 AMI)", InstanceType, FallbackInstanceType))
+
+	return calls
+}
@@ -0,0 +1,89 @@
+package aws
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anoldguy/tse/shared/dns"
+	sharedtypes "github.com/anoldguy/tse/shared/types"
+)
+
+func TestStartCallsExistingStack(t *testing.T) {
+	calls := startCalls(startPlan{
+		Region:          "ohio",
+		VPCID:           "vpc-1",
+		SubnetID:        "subnet-1",
+		SecurityGroupID: "sg-1",
+		ImageID:         "ami-1",
+		InstanceProfile: "tse-exit-node",
+		Baseline:        BaselineStandard,
+		Reservation:     &sharedtypes.ReservationInfo{ReservationID: "cr-1", InstanceType: InstanceType, AvailabilityZone: "us-east-2a"},
+		Opts:            NodeOptions{Routes: []string{"10.0.0.0/16"}},
+	})
+
+	// Only the launch itself, and its fallback
+	if len(calls) != 2 || !strings.HasPrefix(calls[0], "ec2:RunInstances ") {
+		t.Fatalf("startCalls() = %q, want only RunInstances", calls)
+	}
+	for _, want := range []string{"ImageId=ami-1", "SubnetId=subnet-1", "SecurityGroupIds=sg-1", "IamInstanceProfile=tse-exit-node", "KeyName=tailscale", "CapacityReservationId=cr-1", "--advertise-routes=10.0.0.0/16"} {
+		if !strings.Contains(calls[0], want) {
+			t.Errorf("RunInstances call %q missing %s", calls[0], want)
+		}
+	}
+}
+
+func TestStartCallsNewStack(t *testing.T) {
+	resolver, _ := dns.Parse("mullvad")
+	calls := startCalls(startPlan{
+		Region:   "frankfurt",
+		Zone:     "eu-central-1a",
+		ImageID:  "ami-2",
+		Baseline: BaselineStrict,
+		Opts:     NodeOptions{DNS: resolver, Hop: &sharedtypes.HopConfig{Role: sharedtypes.HopEntry, PeerRegion: "tokyo"}},
+	})
+
+	var actions []string
+	for _, call := range calls {
+		actions = append(actions, strings.Fields(call)[0])
+	}
+	want := []string{
+		"ec2:CreateVpc", "ec2:CreateSubnet", "ec2:ModifySubnetAttribute", "ec2:CreateInternetGateway", "ec2:AttachInternetGateway", "ec2:CreateRoute",
+		"ec2:CreateSecurityGroup", "ec2:AuthorizeSecurityGroupIngress", "ec2:AuthorizeSecurityGroupEgress", "ec2:RevokeSecurityGroupEgress",
+		"ec2:AuthorizeSecurityGroupEgress", // The entry node's tunnel, as egress is locked
+		"ec2:RunInstances", "(if",
+	}
+	if strings.Join(actions, " ") != strings.Join(want, " ") {
+		t.Errorf("startCalls() actions = %v, want %v", actions, want)
+	}
+
+	run := calls[len(calls)-2]
+	for _, want := range []string{"SubnetId=(new subnet)", "HttpTokens=required", "Encrypted=true", "--accept-dns=false, resolver mullvad", "multihop entry for tokyo"} {
+		if !strings.Contains(run, want) {
+			t.Errorf("RunInstances call %q missing %s", run, want)
+		}
+	}
+	if strings.Contains(run, "KeyName") || strings.Contains(calls[7], "tcp/22") {
+		t.Error("strict baseline plan includes SSH access")
+	}
+}
+
+func TestStartCallsLaunchTemplate(t *testing.T) {
+	calls := startCalls(startPlan{
+		Region:          "ohio",
+		VPCID:           "vpc-1",
+		SubnetID:        "subnet-1",
+		SecurityGroupID: "sg-1",
+		LaunchTemplate:  "tailscale-exits-node",
+		Baseline:        BaselineStandard,
+	})
+
+	run := calls[0]
+	if !strings.Contains(run, "LaunchTemplate=tailscale-exits-node,$Default") || !strings.Contains(run, "SecurityGroupIds=sg-1") {
+		t.Errorf("RunInstances call %q doesn't launch from the template", run)
+	}
+	for _, param := range []string{"ImageId=", "InstanceType=", "InstanceInitiatedShutdownBehavior="} {
+		if strings.Contains(run, param) {
+			t.Errorf("RunInstances call %q overrides the template's %s", run, param)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/anoldguy/tse/shared/regions"
+	sharedtypes "github.com/anoldguy/tse/shared/types"
+)
+
+// TagTypeReservation is the Type tag value for capacity reservations. They're
+// kept apart from TagType so cleanup never cancels one the user asked for.
+const TagTypeReservation = "reservation"
+
+// reservationFilters matches the region's tse capacity reservations that still hold capacity
+func reservationFilters(friendlyRegion string) []types.Filter {
+	return []types.Filter{
+		{Name: aws.String("tag:Project"), Values: []string{TagProject}},
+		{Name: aws.String("tag:Type"), Values: []string{TagTypeReservation}},
+		{Name: aws.String("tag:Region"), Values: []string{friendlyRegion}},
+		{Name: aws.String("state"), Values: []string{"active", "pending"}},
+	}
+}
+
+// FindReservation returns the region's capacity reservation, or nil if there isn't one
+func (s *Service) FindReservation(ctx context.Context, friendlyRegion string) (*sharedtypes.ReservationInfo, error) {
+	result, err := s.ec2Client.DescribeCapacityReservations(ctx, &ec2.DescribeCapacityReservationsInput{
+		Filters: reservationFilters(friendlyRegion),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe capacity reservations: %w", err)
+	}
+	for _, reservation := range result.CapacityReservations {
+		if s.owns(reservation.Tags) {
+			return reservationInfo(reservation, friendlyRegion), nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateReservation reserves capacity for one exit node, with no end date, in
+// the availability zone the region's nodes launch in. The reservation is billed
+// at the on-demand rate whether or not a node is using it.
+func (s *Service) CreateReservation(ctx context.Context, friendlyRegion string) (*sharedtypes.ReservationInfo, error) {
+	az, err := s.nodeAvailabilityZone(ctx, friendlyRegion)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.ec2Client.CreateCapacityReservation(ctx, &ec2.CreateCapacityReservationInput{
+		InstanceType:     aws.String(InstanceType),
+		InstancePlatform: types.CapacityReservationInstancePlatformLinuxUnix,
+		AvailabilityZone: aws.String(az),
+		InstanceCount:    aws.Int32(1),
+		// Targeted, so only exit nodes launched into it use the capacity
+		InstanceMatchCriteria: types.InstanceMatchCriteriaTargeted,
+		EndDateType:           types.EndDateTypeUnlimited,
+		TagSpecifications: []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeCapacityReservation,
+				Tags: append([]types.Tag{
+					{Key: aws.String("Name"), Value: aws.String(fmt.Sprintf("tse-reservation-%s", friendlyRegion))},
+					{Key: aws.String("Project"), Value: aws.String(TagProject)},
+					{Key: aws.String("Type"), Value: aws.String(TagTypeReservation)},
+					{Key: aws.String("Region"), Value: aws.String(friendlyRegion)},
+				}, s.deploymentTags()...),
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capacity reservation: %w", err)
+	}
+
+	return reservationInfo(*result.CapacityReservation, friendlyRegion), nil
+}
+
+// CancelReservation cancels the region's capacity reservation and returns it,
+// or nil if there wasn't one
+func (s *Service) CancelReservation(ctx context.Context, friendlyRegion string) (*sharedtypes.ReservationInfo, error) {
+	reservation, err := s.FindReservation(ctx, friendlyRegion)
+	if err != nil || reservation == nil {
+		return nil, err
+	}
+
+	_, err = s.ec2Client.CancelCapacityReservation(ctx, &ec2.CancelCapacityReservationInput{
+		CapacityReservationId: aws.String(reservation.ReservationID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel capacity reservation %s: %w", reservation.ReservationID, err)
+	}
+
+	reservation.State = string(types.CapacityReservationStateCancelled)
+	return reservation, nil
+}
+
+// nodeAvailabilityZone returns the zone the region's exit nodes launch in: the
+// existing subnet's, or the zone createVPCStack will pick
+func (s *Service) nodeAvailabilityZone(ctx context.Context, friendlyRegion string) (string, error) {
+	subnets, err := s.ec2Client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{
+		Filters: []types.Filter{
+			{Name: aws.String("tag:Project"), Values: []string{TagProject}},
+			{Name: aws.String("tag:Type"), Values: []string{TagType}},
+			{Name: aws.String("tag:Region"), Values: []string{friendlyRegion}},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe subnets: %w", err)
+	}
+	for _, subnet := range subnets.Subnets {
+		if s.owns(subnet.Tags) {
+			return aws.ToString(subnet.AvailabilityZone), nil
+		}
+	}
+	return s.defaultAvailabilityZone(ctx)
+}
+
+// defaultAvailabilityZone returns the zone a new VPC stack's subnet goes in: the
+// region's first available zone that offers InstanceType
+func (s *Service) defaultAvailabilityZone(ctx context.Context) (string, error) {
+	zones, err := s.availabilityZones(ctx)
+	if err != nil {
+		return "", err
+	}
+	if offered := s.launchableZones(ctx, zones, InstanceType); len(offered) > 0 {
+		return offered[0], nil
+	}
+	if len(zones) == 0 {
+		return "", fmt.Errorf("no available availability zones found")
+	}
+	// Nothing offers t4g; launches fall back to x86_64, which any zone will do for
+	return zones[0], nil
+}
+
+// usableReservation returns the region's capacity reservation if it's active and
+// has room, or nil. Launching without one is always the fallback.
+func (s *Service) usableReservation(ctx context.Context, friendlyRegion string) *sharedtypes.ReservationInfo {
+	reservation, err := s.FindReservation(ctx, friendlyRegion)
+	if err != nil {
+		log.Printf("Launching without a capacity reservation: %v", err)
+		return nil
+	}
+	if reservation == nil || reservation.State != string(types.CapacityReservationStateActive) || reservation.AvailableInstances == 0 {
+		return nil
+	}
+	return reservation
+}
+
+// reservationInfo converts an EC2 capacity reservation into a ReservationInfo
+func reservationInfo(cr types.CapacityReservation, friendlyRegion string) *sharedtypes.ReservationInfo {
+	info := &sharedtypes.ReservationInfo{
+		ReservationID:      aws.ToString(cr.CapacityReservationId),
+		FriendlyRegion:     friendlyRegion,
+		AvailabilityZone:   aws.ToString(cr.AvailabilityZone),
+		InstanceType:       aws.ToString(cr.InstanceType),
+		State:              string(cr.State),
+		TotalInstances:     int(aws.ToInt32(cr.TotalInstanceCount)),
+		AvailableInstances: int(aws.ToInt32(cr.AvailableInstanceCount)),
+		CreateTime:         aws.ToTime(cr.CreateDate).UTC(),
+	}
+	if awsRegion, err := regions.GetAWSRegion(friendlyRegion); err == nil {
+		info.Region = awsRegion
+	}
+	return info
+}
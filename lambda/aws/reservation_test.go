@@ -0,0 +1,50 @@
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestReservationInfo(t *testing.T) {
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	cr := types.CapacityReservation{
+		CapacityReservationId:  aws.String("cr-0123456789abcdef0"),
+		AvailabilityZone:       aws.String("us-east-2a"),
+		InstanceType:           aws.String(InstanceType),
+		State:                  types.CapacityReservationStateActive,
+		TotalInstanceCount:     aws.Int32(1),
+		AvailableInstanceCount: aws.Int32(0),
+		CreateDate:             aws.Time(created),
+	}
+
+	info := reservationInfo(cr, "ohio")
+	if info.ReservationID != "cr-0123456789abcdef0" || info.AvailabilityZone != "us-east-2a" {
+		t.Errorf("reservationInfo = %+v", info)
+	}
+	if info.Region != "us-east-2" || info.FriendlyRegion != "ohio" {
+		t.Errorf("Region = %q (%q), want us-east-2 (ohio)", info.Region, info.FriendlyRegion)
+	}
+	if info.State != "active" || info.TotalInstances != 1 || info.AvailableInstances != 0 {
+		t.Errorf("State = %s, %d/%d available; want active, 0/1", info.State, info.AvailableInstances, info.TotalInstances)
+	}
+	if !info.CreateTime.Equal(created) {
+		t.Errorf("CreateTime = %v, want %v", info.CreateTime, created)
+	}
+}
+
+func TestInstanceInfoCapacityReservation(t *testing.T) {
+	instance := types.Instance{
+		InstanceId:            aws.String("i-0123456789abcdef0"),
+		State:                 &types.InstanceState{Name: types.InstanceStateNameRunning},
+		LaunchTime:            aws.Time(time.Now()),
+		InstanceType:          types.InstanceType(InstanceType),
+		CapacityReservationId: aws.String("cr-0123456789abcdef0"),
+	}
+
+	if got := instanceInfo(instance).CapacityReservationID; got != "cr-0123456789abcdef0" {
+		t.Errorf("CapacityReservationID = %q", got)
+	}
+}
@@ -0,0 +1,24 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// retryMaxAttempts is how often the SDK tries a call in total before giving
+// up, up from its default of 3: a fan-out across every region can trip EC2's
+// request rate limits, which clear within seconds
+const retryMaxAttempts = 5
+
+// loadConfig loads the Lambda's AWS config with adaptive retries, which back
+// off like the standard ones and also slow the client down once AWS starts
+// throttling it, rather than spending every attempt at full speed
+func loadConfig(ctx context.Context, optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
+	optFns = append([]func(*config.LoadOptions) error{
+		config.WithRetryMode(aws.RetryModeAdaptive),
+		config.WithRetryMaxAttempts(retryMaxAttempts),
+	}, optFns...)
+	return config.LoadDefaultConfig(ctx, optFns...)
+}
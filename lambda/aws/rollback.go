@@ -0,0 +1,94 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// rollbackTimeout bounds undoing a failed stack, which has to finish even when
+// the request that started it was cancelled
+const rollbackTimeout = 30 * time.Second
+
+// rollback undoes the steps of a multi-step creation that failed partway,
+// newest first, so nothing it created is left behind untracked
+type rollback struct {
+	steps []rollbackStep
+}
+
+type rollbackStep struct {
+	resource string // What the step created, e.g. "subnet subnet-0abc"
+	undo     func(context.Context) error
+}
+
+// add records a created resource and how to remove it
+func (r *rollback) add(resource string, undo func(context.Context) error) {
+	r.steps = append(r.steps, rollbackStep{resource: resource, undo: undo})
+}
+
+// run removes everything added so far, newest first, returning what it removed
+// and what it couldn't
+func (r *rollback) run(ctx context.Context) (removed, remaining []string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	for _, step := range slices.Backward(r.steps) {
+		if err := step.undo(ctx); err != nil {
+			log.Printf("Rollback failed to delete %s: %v", step.resource, err)
+			remaining = append(remaining, step.resource)
+			continue
+		}
+		removed = append(removed, step.resource)
+	}
+	r.steps = nil
+	return removed, remaining
+}
+
+// fail rolls back and returns err with what the rollback did
+func (r *rollback) fail(ctx context.Context, err error) error {
+	removed, remaining := r.run(ctx)
+	return &RollbackError{Err: err, RolledBack: removed, Remaining: remaining}
+}
+
+// RollbackError is a creation that failed partway and was rolled back
+type RollbackError struct {
+	Err        error
+	RolledBack []string // Resources deleted again, newest first
+	Remaining  []string // Resources the rollback couldn't delete
+}
+
+func (e *RollbackError) Error() string {
+	msg := e.Err.Error()
+	if len(e.RolledBack) > 0 {
+		msg += fmt.Sprintf("; rolled back %s", strings.Join(e.RolledBack, ", "))
+	}
+	if len(e.Remaining) > 0 {
+		msg += fmt.Sprintf("; couldn't delete %s (run 'tse <region> cleanup')", strings.Join(e.Remaining, ", "))
+	}
+	return msg
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// deleteInternetGateway detaches an internet gateway from vpcID, if attached,
+// and deletes it
+func (s *Service) deleteInternetGateway(ctx context.Context, igwID, vpcID string) error {
+	// Not attached yet when the attach is what failed
+	s.ec2Client.DetachInternetGateway(ctx, &ec2.DetachInternetGatewayInput{
+		InternetGatewayId: aws.String(igwID),
+		VpcId:             aws.String(vpcID),
+	})
+
+	_, err := s.ec2Client.DeleteInternetGateway(ctx, &ec2.DeleteInternetGatewayInput{
+		InternetGatewayId: aws.String(igwID),
+	})
+	return err
+}
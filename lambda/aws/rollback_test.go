@@ -0,0 +1,60 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestRollbackRunsNewestFirst(t *testing.T) {
+	var order []string
+	var undo rollback
+	for _, resource := range []string{"VPC vpc-1", "subnet subnet-1", "internet gateway igw-1"} {
+		undo.add(resource, func(ctx context.Context) error {
+			if ctx.Err() != nil {
+				t.Errorf("undo of %s ran with a done context", resource)
+			}
+			order = append(order, resource)
+			if resource == "subnet subnet-1" {
+				return errors.New("DependencyViolation")
+			}
+			return nil
+		})
+	}
+
+	// A cancelled request still gets rolled back
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cause := fmt.Errorf("failed to create route to internet gateway: %w", &smithy.GenericAPIError{Code: "RouteAlreadyExists"})
+	err := undo.fail(ctx, cause)
+
+	if want := []string{"internet gateway igw-1", "subnet subnet-1", "VPC vpc-1"}; !slices.Equal(order, want) {
+		t.Errorf("undo order = %v, want %v", order, want)
+	}
+
+	var rollbackErr *RollbackError
+	if !errors.As(err, &rollbackErr) {
+		t.Fatalf("fail() = %v, want a *RollbackError", err)
+	}
+	if !slices.Equal(rollbackErr.RolledBack, []string{"internet gateway igw-1", "VPC vpc-1"}) || !slices.Equal(rollbackErr.Remaining, []string{"subnet subnet-1"}) {
+		t.Errorf("RollbackError = %+v", rollbackErr)
+	}
+	want := "failed to create route to internet gateway: api error RouteAlreadyExists: ; rolled back internet gateway igw-1, VPC vpc-1; couldn't delete subnet subnet-1 (run 'tse <region> cleanup')"
+	if err.Error() != want {
+		t.Errorf("Error() = %q\nwant %q", err.Error(), want)
+	}
+
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "RouteAlreadyExists" {
+		t.Errorf("cause isn't unwrappable from %v", err)
+	}
+
+	if removed, remaining := undo.run(context.Background()); removed != nil || remaining != nil {
+		t.Errorf("second run() = %v, %v; want nothing left to undo", removed, remaining)
+	}
+}
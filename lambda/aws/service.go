@@ -5,15 +5,24 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"log"
+	"maps"
+	"os"
+	"strings"
 	"text/template"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 
+	"github.com/anoldguy/tse/shared/dns"
 	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/routes"
 	sharedtypes "github.com/anoldguy/tse/shared/types"
 )
 
@@ -29,53 +38,400 @@ const (
 
 	// TagType is the tag value for our ephemeral resources
 	TagType = "ephemeral"
+
+	// TagReady is set to "true" by the node itself once Tailscale is up and forwarding works
+	TagReady = "tse:ready"
+
+	// TagTailscaleIP records the node's tailnet IPv4 address, set alongside TagReady
+	TagTailscaleIP = "tse:tailscale-ip"
+
+	// TagTailscaleIPv6 records the node's tailnet IPv6 address, set alongside TagReady
+	TagTailscaleIPv6 = "tse:tailscale-ipv6"
+
+	// TagTailscaleName records the hostname the tailnet gave the node, set
+	// alongside TagReady. Nodes ask for exit-<region>, but while an earlier
+	// ephemeral node of that name is still registered Tailscale adds a suffix
+	// (exit-frankfurt-1).
+	TagTailscaleName = "tse:tailscale-hostname"
+
+	// TagFailureNotified marks nodes already reported as failing to become ready,
+	// so the failure notification goes out once
+	TagFailureNotified = "tse:failure-notified"
+
+	// TagClientToken records the idempotency token of the start request that
+	// launched the node, so a retried start returns it instead of launching another
+	TagClientToken = "tse:client-token"
+
+	// TagStartedBy and TagStartedByID record the name and ID of the token that
+	// started the node, so listings can say whose it is and per-token node
+	// limits can count it
+	TagStartedBy   = "tse:started-by"
+	TagStartedByID = "tse:started-by-id"
+
+	// RoleSessionName identifies our sessions in the target account's CloudTrail when using ROLE_ARN
+	RoleSessionName = "tse-lambda"
 )
 
 // Service provides AWS operations for the exit node service
 type Service struct {
-	ec2Client *ec2.Client
+	ec2Client  ec2API
+	cloudWatch cloudWatchAPI
+
+	deployment     string // TSE_DEPLOYMENT_ID; empty for deployments from before IDs
+	allDeployments bool   // Set by AllDeployments
 }
 
-// New creates a new AWS service instance
+// New creates a new AWS service instance.
+// If ROLE_ARN is set, EC2 and CloudWatch calls are made with credentials from assuming that role,
+// so one control-plane Lambda can manage exit nodes in a separate (sandbox) account.
 func New(ctx context.Context, region string) (*Service, error) {
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	cfg, err := loadConfig(ctx, config.WithRegion(region))
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
+	if roleARN := os.Getenv("ROLE_ARN"); roleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = RoleSessionName
+			if externalID := os.Getenv("ROLE_EXTERNAL_ID"); externalID != "" {
+				o.ExternalID = aws.String(externalID)
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
 	return &Service{
-		ec2Client: ec2.NewFromConfig(cfg),
+		ec2Client:  ec2.NewFromConfig(cfg),
+		cloudWatch: cloudwatch.NewFromConfig(cfg),
+		deployment: os.Getenv(EnvDeploymentID),
 	}, nil
 }
 
-// userDataTemplate defines the bash script for Tailscale installation
+// userDataTemplate defines the bash script for Tailscale installation.
+// It detects the distro from /etc/os-release so firewall (ufw, firewalld, nftables)
+// and SELinux handling match the image, and only reports success once forwarding
+// is verified active and Tailscale is running. The last step tags the instance
+// tse:ready=true so callers can tell a usable node from one still booting.
+// Apart from multihop nodes, it also installs a unit that brings a paused node
+// back up when it's resumed.
+// With a DNS choice, the node's system resolver (which answers for clients
+// using the exit node) is pointed at it once Tailscale is up, falling back to
+// the VPC resolver if lookups through it fail. Subnet routes are advertised
+// alongside the exit node. A multihop node sets up its WireGuard tunnel before
+// Tailscale comes up, so an entry node never forwards clients' traffic out of
+// its own region.
 const userDataTemplate = `#!/bin/bash
 set -e
 
+log() {
+  echo "$*" | logger -t tse-setup
+  echo "tse-setup: $*"
+}
+
+fail() {
+  log "ERROR: $*"
+  exit 1
+}
+
+# Detect the distro
+if [ -r /etc/os-release ]; then
+  . /etc/os-release
+fi
+log "Provisioning exit node on ${PRETTY_NAME:-${ID:-unknown distro}}"
+
+# Enable IP forwarding. A sysctl.d drop-in is read by systemd-sysctl on every
+# distro, unlike /etc/sysctl.conf which some images no longer ship.
+cat > /etc/sysctl.d/99-tailscale-exit-node.conf <<'SYSCTL'
+net.ipv4.ip_forward = 1
+net.ipv6.conf.all.forwarding = 1
+SYSCTL
+sysctl -p /etc/sysctl.d/99-tailscale-exit-node.conf
+
 # Install Tailscale
 curl -fsSL https://tailscale.com/install.sh | sh
 
-# Start Tailscale with exit node advertisement
-tailscale up --authkey={{.AuthKey}} --advertise-exit-node --hostname=exit-{{.Region}}
+# nftables-only images have no iptables binary; tell tailscaled to use nftables
+if ! command -v iptables >/dev/null 2>&1 && command -v nft >/dev/null 2>&1; then
+  log "No iptables found, switching tailscaled to nftables mode"
+  echo 'TS_DEBUG_FIREWALL_MODE=nftables' >> /etc/default/tailscaled
+  systemctl restart tailscaled
+fi
+
+# SELinux: make sure tailscaled's state directory carries the right labels
+if command -v getenforce >/dev/null 2>&1 && [ "$(getenforce)" = "Enforcing" ]; then
+  log "SELinux enforcing, restoring file contexts for tailscaled"
+  restorecon -R /var/lib/tailscale /etc/default/tailscaled 2>/dev/null || true
+fi
+
+{{- if .HopRole}}
+
+# Multihop ({{.HopRole}} node): a WireGuard tunnel to the node in {{.HopPeerRegion}}
+log "Setting up the multihop tunnel to {{.HopPeerRegion}}"
+if ! command -v wg >/dev/null 2>&1; then
+  if command -v dnf >/dev/null 2>&1; then
+    dnf install -y wireguard-tools
+  elif command -v apt-get >/dev/null 2>&1; then
+    apt-get install -y wireguard-tools
+  fi
+fi
+command -v wg >/dev/null 2>&1 || fail "wireguard-tools could not be installed"
+
+(umask 077 && echo '{{.HopPrivateKey}}' > /etc/tse-hop.key)
+ip link add dev tse-hop type wireguard
+wg set tse-hop private-key /etc/tse-hop.key {{.HopWGArgs}}
+ip address add {{.HopAddress}} dev tse-hop
+ip link set tse-hop up
+{{- if eq .HopRole "entry"}}
+
+# Clients' traffic arrives on tailscale0: send it through the tunnel. If the
+# tunnel goes away the blackhole remains, so traffic is dropped rather than
+# leaving from this region.
+ip route add default dev tse-hop table {{.HopTable}}
+ip route add blackhole default metric 4096 table {{.HopTable}}
+ip rule add iif tailscale0 lookup {{.HopTable}} priority 100
+{{- else}}
+
+# Traffic from the entry node leaves with this node's public IP
+wan=$(ip route show default | awk '{print $5; exit}')
+if command -v iptables >/dev/null 2>&1; then
+  iptables -t nat -A POSTROUTING -s {{.HopNetwork}} -o "$wan" -j MASQUERADE
+else
+  nft add table ip tse-hop
+  nft add chain ip tse-hop postrouting '{ type nat hook postrouting priority 100 ; }'
+  nft add rule ip tse-hop postrouting ip saddr {{.HopNetwork}} oifname "$wan" masquerade
+fi
+{{- end}}
+{{- end}}
+
+# Let forwarded traffic through whichever host firewall is active
+if command -v ufw >/dev/null 2>&1 && ufw status | grep -q "Status: active"; then
+  log "Configuring ufw for forwarding"
+  sed -i 's/^DEFAULT_FORWARD_POLICY=.*/DEFAULT_FORWARD_POLICY="ACCEPT"/' /etc/default/ufw
+  ufw allow in on tailscale0
+{{- if eq .HopRole "exit"}}
+  ufw allow {{.HopPort}}/udp
+{{- end}}
+  ufw reload
+elif command -v firewall-cmd >/dev/null 2>&1 && firewall-cmd --state >/dev/null 2>&1; then
+  log "Configuring firewalld for forwarding"
+  firewall-cmd --permanent --zone=trusted --add-interface=tailscale0
+{{- if .HopRole}}
+  firewall-cmd --permanent --zone=trusted --add-interface=tse-hop
+{{- end}}
+{{- if eq .HopRole "exit"}}
+  firewall-cmd --permanent --add-port={{.HopPort}}/udp
+{{- end}}
+  firewall-cmd --permanent --add-masquerade
+  firewall-cmd --reload
+elif command -v nft >/dev/null 2>&1 && nft list chain inet filter forward >/dev/null 2>&1; then
+  log "Configuring nftables forward chain"
+  nft insert rule inet filter forward iifname "tailscale0" accept
+  nft insert rule inet filter forward oifname "tailscale0" ct state related,established accept
+{{- if .HopRole}}
+  nft insert rule inet filter forward iifname "tse-hop" accept
+  nft insert rule inet filter forward oifname "tse-hop" ct state related,established accept
+{{- end}}
+fi
+
+# Start Tailscale with exit node advertisement. With a DNS choice, keep the
+# tailnet's DNS settings from taking over the system resolver.
+{{template "up" .}}
+
+# Verify forwarding is actually active before declaring the node ready
+for key in net.ipv4.ip_forward net.ipv6.conf.all.forwarding; do
+  if [ "$(sysctl -n "$key")" != "1" ]; then
+    fail "$key is not enabled, exit node traffic would be dropped"
+  fi
+done
+
+for attempt in $(seq 1 30); do
+  if tailscale status >/dev/null 2>&1; then
+    break
+  fi
+  if [ "$attempt" -eq 30 ]; then
+    fail "Tailscale did not come up"
+  fi
+  sleep 2
+done
+{{- if eq .HopRole "entry"}}
+
+# Only report ready once the exit node answers through the tunnel. It boots
+# alongside this one, so give it a few minutes.
+for attempt in $(seq 1 60); do
+  if ping -c 1 -W 2 {{.HopPeerAddress}} >/dev/null 2>&1; then
+    break
+  fi
+  if [ "$attempt" -eq 60 ]; then
+    fail "Multihop tunnel to {{.HopPeerRegion}} did not come up; clients' traffic is dropped"
+  fi
+  sleep 5
+done
+log "Multihop tunnel up, traffic leaves from {{.HopPeerRegion}}"
+{{- end}}
+{{- if .DNSServers}}
+
+# Resolve through {{.DNSName}} instead of the VPC resolver. Clients using this
+# exit node have their DNS answered here, so they get its filtering too.
+configure_dns() {
+  if systemctl is-active --quiet systemd-resolved; then
+    mkdir -p /etc/systemd/resolved.conf.d
+    cat > /etc/systemd/resolved.conf.d/tse-dns.conf <<'RESOLVED'
+[Resolve]
+DNS={{.DNSServers}}
+Domains=~.
+DNSOverTLS={{.DNSOverTLS}}
+RESOLVED
+    systemctl restart systemd-resolved
+  elif [ "{{.DNSOverTLS}}" = "no" ]; then
+    cp -P /etc/resolv.conf /etc/resolv.conf.tse-backup
+    rm -f /etc/resolv.conf
+    for server in {{.DNSServers}}; do
+      echo "nameserver $server"
+    done > /etc/resolv.conf
+  else
+    log "DNS over TLS needs systemd-resolved, which isn't running"
+    return 1
+  fi
+}
+
+revert_dns() {
+  if [ -f /etc/systemd/resolved.conf.d/tse-dns.conf ]; then
+    rm -f /etc/systemd/resolved.conf.d/tse-dns.conf
+    systemctl restart systemd-resolved
+  fi
+  if [ -e /etc/resolv.conf.tse-backup ] || [ -L /etc/resolv.conf.tse-backup ]; then
+    mv -f /etc/resolv.conf.tse-backup /etc/resolv.conf
+  fi
+}
 
-# Enable IP forwarding
-echo 'net.ipv4.ip_forward = 1' >> /etc/sysctl.conf
-echo 'net.ipv6.conf.all.forwarding = 1' >> /etc/sysctl.conf
-sysctl -p
+dns_works() {
+  for attempt in $(seq 1 10); do
+    if getent hosts tailscale.com >/dev/null 2>&1; then
+      return 0
+    fi
+    sleep 2
+  done
+  return 1
+}
+
+# A resolver that doesn't answer would break every client, so fall back to
+# the VPC's rather than fail the node
+if configure_dns && dns_works; then
+  log "Resolving through {{.DNSName}}"
+else
+  log "Could not resolve through {{.DNSName}}, keeping the VPC resolver"
+  revert_dns
+fi
+{{- end}}
+
+# Mark the node ready (and record its tailnet IP) via the instance profile.
+# Failing to tag isn't fatal: the exit node works, it just won't report readiness.
+{{template "mark_ready" .}}
+
+if ! command -v aws >/dev/null 2>&1; then
+  log "AWS CLI not found, node will not report readiness"
+elif ! mark_ready; then
+  log "Could not tag node ready (is the instance profile attached?)"
+fi
+{{- if not .HopRole}}
+
+# A paused node (tse <region> pause) keeps its disk, so resuming it skips all
+# of the above. tailscaled comes back with its saved identity; this unit brings
+# the node up with the same settings and reports it ready again. If the tailnet
+# removed the node while it was stopped, the auth key registers it anew under
+# the same hostname. nft rules don't survive a reboot, so they're put back.
+cat > /usr/local/sbin/tse-resume <<'RESUME'
+#!/bin/bash
+set -e
+if command -v nft >/dev/null 2>&1 && nft list chain inet filter forward >/dev/null 2>&1 &&
+  ! nft list chain inet filter forward | grep -q 'iifname "tailscale0" accept'; then
+  nft insert rule inet filter forward iifname "tailscale0" accept
+  nft insert rule inet filter forward oifname "tailscale0" ct state related,established accept
+fi
+{{template "up" .}}
+for attempt in $(seq 1 30); do
+  tailscale status >/dev/null 2>&1 && break
+  sleep 2
+done
+{{template "mark_ready" .}}
+if command -v aws >/dev/null 2>&1; then
+  mark_ready
+fi
+RESUME
+chmod 700 /usr/local/sbin/tse-resume
+
+# Enabled, not started: it only matters on later boots, i.e. after a resume
+cat > /etc/systemd/system/tse-resume.service <<'UNIT'
+[Unit]
+Description=Bring a resumed tse exit node back up
+Wants=network-online.target
+After=network-online.target tailscaled.service
+
+[Service]
+Type=oneshot
+ExecStart=/usr/local/sbin/tse-resume
+
+[Install]
+WantedBy=multi-user.target
+UNIT
+systemctl enable tse-resume.service
+{{- end}}
 
 # Log completion
-echo "Tailscale exit node setup complete for region: {{.Region}}" | logger -t tse-setup
+log "Tailscale exit node setup complete for region: {{.Region}}"
+{{- define "mark_ready"}}mark_ready() {
+  local imds="http://169.254.169.254/latest" token instance_id region ts_ip ts_ipv6
+  token=$(curl -sf -X PUT "$imds/api/token" -H "X-aws-ec2-metadata-token-ttl-seconds: 300") || return 1
+  instance_id=$(curl -sf -H "X-aws-ec2-metadata-token: $token" "$imds/meta-data/instance-id") || return 1
+  region=$(curl -sf -H "X-aws-ec2-metadata-token: $token" "$imds/meta-data/placement/region") || return 1
+  ts_ip=$(tailscale ip -4 | head -n 1)
+  ts_ipv6=$(tailscale ip -6 | head -n 1)
+  # The name actually assigned, which has a suffix if exit-<region> was taken:
+  # the first label of Self's DNSName, the only one listed without peers
+  ts_name=$(tailscale status --json --peers=false | sed -n 's/.*"DNSName": *"\([^".]*\).*/\1/p' | head -n 1)
+  if [ -z "$ts_name" ]; then
+    echo "Could not read the name the tailnet assigned; not tagging {{.NameTag}}" | logger -t tse-setup
+  fi
+  aws ec2 create-tags --region "$region" --resources "$instance_id" \
+    --tags "Key={{.ReadyTag}},Value=true" "Key={{.IPTag}},Value=$ts_ip" "Key={{.IPv6Tag}},Value=$ts_ipv6" ${ts_name:+"Key={{.NameTag}},Value=$ts_name"}
+}{{end}}
+{{- define "up"}}tailscale up --authkey={{.AuthKey}} --advertise-exit-node --hostname=exit-{{.Region}}{{if .Routes}} --advertise-routes={{.Routes}}{{end}}{{if .DNSServers}} --accept-dns=false{{end}}{{end}}
 `
 
 var userDataTmpl = template.Must(template.New("userdata").Parse(userDataTemplate))
 
+// NodeOptions are the choices made per start that shape a node's setup script
+type NodeOptions struct {
+	DNS    dns.Resolver           // Zero keeps the VPC's resolver
+	Routes []string               // Subnet routes to advertise besides the exit node, as from routes.Parse
+	Hop    *sharedtypes.HopConfig // Set for one end of a multihop pair, already validated
+	// The token starting the node, recorded in TagStartedBy; nil leaves it unattributed
+	StartedBy *sharedtypes.TokenInfo
+}
+
 // generateUserData creates the user data script for Tailscale installation
-func generateUserData(authKey, friendlyRegion string) string {
+func generateUserData(authKey, friendlyRegion string, opts NodeOptions) string {
+	overTLS := "no"
+	if opts.DNS.OverTLS {
+		overTLS = "yes"
+	}
+
+	data := map[string]string{
+		"AuthKey":    authKey,
+		"Region":     friendlyRegion,
+		"ReadyTag":   TagReady,
+		"IPTag":      TagTailscaleIP,
+		"IPv6Tag":    TagTailscaleIPv6,
+		"NameTag":    TagTailscaleName,
+		"DNSName":    opts.DNS.Name,
+		"DNSServers": strings.Join(opts.DNS.Servers, " "),
+		"DNSOverTLS": overTLS,
+		"Routes":     strings.Join(opts.Routes, ","),
+	}
+	maps.Copy(data, hopTemplateData(opts.Hop))
+
 	var buf bytes.Buffer
-	err := userDataTmpl.Execute(&buf, map[string]string{
-		"AuthKey": authKey,
-		"Region":  friendlyRegion,
-	})
+	err := userDataTmpl.Execute(&buf, data)
 	if err != nil {
 		// Template execution should never fail with a constant template
 		panic(fmt.Sprintf("failed to execute user data template: %v", err))
@@ -83,51 +439,31 @@ func generateUserData(authKey, friendlyRegion string) string {
 	return base64.StdEncoding.EncodeToString(buf.Bytes())
 }
 
-// findOrCreateSecurityGroup ensures our security group exists with proper rules in the specified VPC
-func (s *Service) findOrCreateSecurityGroup(ctx context.Context, vpcID, friendlyRegion string) (string, error) {
+// findOrCreateSecurityGroup ensures the baseline's security group exists with proper rules in the specified VPC
+func (s *Service) findOrCreateSecurityGroup(ctx context.Context, vpcID, friendlyRegion string, b Baseline) (string, error) {
 	// Try to find existing security group in the VPC
-	result, err := s.ec2Client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String("vpc-id"),
-				Values: []string{vpcID},
-			},
-			{
-				Name:   aws.String("tag:Project"),
-				Values: []string{TagProject},
-			},
-			{
-				Name:   aws.String("tag:Type"),
-				Values: []string{TagType},
-			},
-			{
-				Name:   aws.String("tag:Region"),
-				Values: []string{friendlyRegion},
-			},
-		},
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to describe security groups: %w", err)
+	if sgID, err := s.findSecurityGroup(ctx, vpcID, friendlyRegion, b); err != nil || sgID != "" {
+		return sgID, err
 	}
 
-	if len(result.SecurityGroups) > 0 {
-		return *result.SecurityGroups[0].GroupId, nil
-	}
+	groupName := securityGroupName(friendlyRegion, b)
 
 	// Create new security group in the VPC
 	createResult, err := s.ec2Client.CreateSecurityGroup(ctx, &ec2.CreateSecurityGroupInput{
-		GroupName:   aws.String(fmt.Sprintf("tse-sg-%s", friendlyRegion)),
+		GroupName:   aws.String(groupName),
 		Description: aws.String("Tailscale ephemeral exit node security group"),
 		VpcId:       aws.String(vpcID),
 		TagSpecifications: []types.TagSpecification{
 			{
 				ResourceType: types.ResourceTypeSecurityGroup,
-				Tags: []types.Tag{
-					{Key: aws.String("Name"), Value: aws.String(fmt.Sprintf("tse-sg-%s", friendlyRegion))},
+				Tags: append([]types.Tag{
+					{Key: aws.String("Name"), Value: aws.String(groupName)},
 					{Key: aws.String("Project"), Value: aws.String(TagProject)},
 					{Key: aws.String("Type"), Value: aws.String(TagType)},
 					{Key: aws.String("Region"), Value: aws.String(friendlyRegion)},
-				},
+					{Key: aws.String(TagBaseline), Value: aws.String(b.Name)},
+					createdTag(),
+				}, s.deploymentTags()...),
 			},
 		},
 	})
@@ -137,43 +473,97 @@ func (s *Service) findOrCreateSecurityGroup(ctx context.Context, vpcID, friendly
 
 	sgID := *createResult.GroupId
 
-	// Add inbound rules for WireGuard and SSH (temporary for debugging)
+	// Add inbound rules for WireGuard, and SSH (for debugging) unless the baseline forbids it
+	permissions := []types.IpPermission{
+		{
+			IpProtocol: aws.String("udp"),
+			FromPort:   aws.Int32(41641),
+			ToPort:     aws.Int32(41641),
+			IpRanges: []types.IpRange{
+				{CidrIp: aws.String("0.0.0.0/0")},
+			},
+		},
+	}
+	if b.AllowSSH {
+		permissions = append(permissions, types.IpPermission{
+			IpProtocol: aws.String("tcp"),
+			FromPort:   aws.Int32(22),
+			ToPort:     aws.Int32(22),
+			IpRanges: []types.IpRange{
+				{CidrIp: aws.String("0.0.0.0/0")},
+			},
+		})
+	}
 	_, err = s.ec2Client.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
-		GroupId: aws.String(sgID),
-		IpPermissions: []types.IpPermission{
+		GroupId:       aws.String(sgID),
+		IpPermissions: permissions,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to add security group rules: %w", err)
+	}
+
+	if b.LockEgress {
+		if err := s.lockEgress(ctx, sgID); err != nil {
+			return "", err
+		}
+	}
+
+	return sgID, nil
+}
+
+// findSecurityGroup returns the ID of the baseline's security group in the
+// VPC, or "" if there isn't one yet
+func (s *Service) findSecurityGroup(ctx context.Context, vpcID, friendlyRegion string, b Baseline) (string, error) {
+	result, err := s.ec2Client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
+		Filters: []types.Filter{
 			{
-				IpProtocol: aws.String("udp"),
-				FromPort:   aws.Int32(41641),
-				ToPort:     aws.Int32(41641),
-				IpRanges: []types.IpRange{
-					{CidrIp: aws.String("0.0.0.0/0")},
-				},
+				Name:   aws.String("vpc-id"),
+				Values: []string{vpcID},
 			},
 			{
-				IpProtocol: aws.String("tcp"),
-				FromPort:   aws.Int32(22),
-				ToPort:     aws.Int32(22),
-				IpRanges: []types.IpRange{
-					{CidrIp: aws.String("0.0.0.0/0")},
-				},
+				Name:   aws.String("tag:Project"),
+				Values: []string{TagProject},
+			},
+			{
+				Name:   aws.String("tag:Type"),
+				Values: []string{TagType},
+			},
+			{
+				Name:   aws.String("tag:Region"),
+				Values: []string{friendlyRegion},
 			},
 		},
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to add security group rules: %w", err)
+		return "", fmt.Errorf("failed to describe security groups: %w", err)
 	}
 
-	return sgID, nil
+	for _, sg := range result.SecurityGroups {
+		if baselineOf(sg.Tags) == b.Name {
+			return *sg.GroupId, nil
+		}
+	}
+	return "", nil
+}
+
+// securityGroupName names the baseline's security group. The original group
+// keeps its name so existing deployments find it.
+func securityGroupName(friendlyRegion string, b Baseline) string {
+	if b.Name != BaselineStandard.Name {
+		return fmt.Sprintf("tse-sg-%s-%s", friendlyRegion, b.Name)
+	}
+	return fmt.Sprintf("tse-sg-%s", friendlyRegion)
 }
 
-// getLatestAmazonLinux2023ARM64AMI finds the latest Amazon Linux 2023 ARM64 AMI
-func (s *Service) getLatestAmazonLinux2023ARM64AMI(ctx context.Context) (string, error) {
+// getLatestAmazonLinux2023AMI finds the latest Amazon Linux 2023 AMI for an
+// architecture (arm64 or x86_64)
+func (s *Service) getLatestAmazonLinux2023AMI(ctx context.Context, arch string) (types.Image, error) {
 	result, err := s.ec2Client.DescribeImages(ctx, &ec2.DescribeImagesInput{
 		Owners: []string{"amazon"},
 		Filters: []types.Filter{
 			{
 				Name:   aws.String("name"),
-				Values: []string{"al2023-ami-*-arm64"},
+				Values: []string{"al2023-ami-*-" + arch},
 			},
 			{
 				Name:   aws.String("state"),
@@ -181,16 +571,16 @@ func (s *Service) getLatestAmazonLinux2023ARM64AMI(ctx context.Context) (string,
 			},
 			{
 				Name:   aws.String("architecture"),
-				Values: []string{"arm64"},
+				Values: []string{arch},
 			},
 		},
 	})
 	if err != nil {
-		return "", err
+		return types.Image{}, err
 	}
 
 	if len(result.Images) == 0 {
-		return "", fmt.Errorf("no Amazon Linux 2023 ARM64 AMI found")
+		return types.Image{}, fmt.Errorf("no Amazon Linux 2023 %s AMI found", arch)
 	}
 
 	// Find the most recent AMI
@@ -211,16 +601,42 @@ func (s *Service) getLatestAmazonLinux2023ARM64AMI(ctx context.Context) (string,
 	}
 
 	if latestAMI.ImageId == nil {
-		return "", fmt.Errorf("could not determine latest Amazon Linux 2023 ARM64 AMI")
+		return types.Image{}, fmt.Errorf("could not determine latest Amazon Linux 2023 %s AMI", arch)
 	}
 
-	return *latestAMI.ImageId, nil
+	return latestAMI, nil
 }
 
 // findOrCreateVPCStack finds existing TSE VPC infrastructure or creates it
 // Returns (subnetID, vpcID, error)
 func (s *Service) findOrCreateVPCStack(ctx context.Context, friendlyRegion string) (string, string, error) {
 	// First, try to find existing TSE VPC
+	vpcID, err := s.findVPC(ctx, friendlyRegion)
+	if err != nil {
+		return "", "", err
+	}
+
+	if vpcID != "" {
+		// Found existing VPC, find its subnet
+		subnetID, err := s.findSubnetInVPC(ctx, vpcID)
+		return subnetID, vpcID, err
+	}
+
+	// No existing VPC, create the full stack
+	return s.createVPCStack(ctx, friendlyRegion)
+}
+
+// findVPC returns the ID of the region's TSE VPC, or "" if there isn't one
+func (s *Service) findVPC(ctx context.Context, friendlyRegion string) (string, error) {
+	vpc, err := s.regionVPC(ctx, friendlyRegion)
+	if err != nil || vpc == nil {
+		return "", err
+	}
+	return *vpc.VpcId, nil
+}
+
+// regionVPC returns the region's TSE VPC with its tags, or nil if there isn't one
+func (s *Service) regionVPC(ctx context.Context, friendlyRegion string) (*types.Vpc, error) {
 	vpcResult, err := s.ec2Client.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{
 		Filters: []types.Filter{
 			{
@@ -238,18 +654,16 @@ func (s *Service) findOrCreateVPCStack(ctx context.Context, friendlyRegion strin
 		},
 	})
 	if err != nil {
-		return "", "", fmt.Errorf("failed to search for existing VPC: %w", err)
+		return nil, fmt.Errorf("failed to search for existing VPC: %w", err)
 	}
 
-	if len(vpcResult.Vpcs) > 0 {
-		// Found existing VPC, find its subnet
-		vpcID := *vpcResult.Vpcs[0].VpcId
-		subnetID, err := s.findSubnetInVPC(ctx, vpcID)
-		return subnetID, vpcID, err
+	// Another deployment in the account may have its own VPC here
+	for _, vpc := range vpcResult.Vpcs {
+		if s.owns(vpc.Tags) {
+			return &vpc, nil
+		}
 	}
-
-	// No existing VPC, create the full stack
-	return s.createVPCStack(ctx, friendlyRegion)
+	return nil, nil
 }
 
 // findSubnetInVPC finds a subnet in the specified VPC
@@ -281,21 +695,25 @@ func (s *Service) findSubnetInVPC(ctx context.Context, vpcID string) (string, er
 	return *subnetResult.Subnets[0].SubnetId, nil
 }
 
-// createVPCStack creates a complete VPC infrastructure stack
+// createVPCStack creates a complete VPC infrastructure stack. If a step fails,
+// what was already created is deleted again and the *RollbackError says what.
 // Returns (subnetID, vpcID, error)
 func (s *Service) createVPCStack(ctx context.Context, friendlyRegion string) (string, string, error) {
+	var undo rollback
+
 	// Create VPC
 	vpcResult, err := s.ec2Client.CreateVpc(ctx, &ec2.CreateVpcInput{
-		CidrBlock: aws.String("10.0.0.0/16"),
+		CidrBlock: aws.String(routes.VPCCIDR),
 		TagSpecifications: []types.TagSpecification{
 			{
 				ResourceType: types.ResourceTypeVpc,
-				Tags: []types.Tag{
+				Tags: append([]types.Tag{
 					{Key: aws.String("Name"), Value: aws.String(fmt.Sprintf("tse-vpc-%s", friendlyRegion))},
 					{Key: aws.String("Project"), Value: aws.String(TagProject)},
 					{Key: aws.String("Type"), Value: aws.String(TagType)},
 					{Key: aws.String("Region"), Value: aws.String(friendlyRegion)},
-				},
+					createdTag(),
+				}, s.deploymentTags()...),
 			},
 		},
 	})
@@ -304,68 +722,50 @@ func (s *Service) createVPCStack(ctx context.Context, friendlyRegion string) (st
 	}
 
 	vpcID := *vpcResult.Vpc.VpcId
+	// deleteVPCStack also catches a subnet whose setup failed after it was created
+	undo.add("VPC "+vpcID, func(ctx context.Context) error { return s.deleteVPCStack(ctx, vpcID) })
 
-	// Get first available AZ
-	azResult, err := s.ec2Client.DescribeAvailabilityZones(ctx, &ec2.DescribeAvailabilityZonesInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String("state"),
-				Values: []string{"available"},
-			},
-		},
-	})
+	// Use the capacity reservation's AZ if there is one, so it can be used
+	// after the stack is cleaned up and recreated; otherwise the first that offers
+	// t4g. It's only where launches start: runInstance moves on to other zones.
+	azName, err := s.defaultAvailabilityZone(ctx)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get availability zones: %w", err)
+		return "", "", undo.fail(ctx, err)
 	}
-
-	if len(azResult.AvailabilityZones) == 0 {
-		return "", "", fmt.Errorf("no available availability zones found")
+	if reservation, err := s.FindReservation(ctx, friendlyRegion); err == nil && reservation != nil {
+		azName = reservation.AvailabilityZone
 	}
 
-	azName := *azResult.AvailabilityZones[0].ZoneName
-
-	// Create subnet
-	subnetResult, err := s.ec2Client.CreateSubnet(ctx, &ec2.CreateSubnetInput{
-		VpcId:            aws.String(vpcID),
-		CidrBlock:        aws.String("10.0.1.0/24"),
-		AvailabilityZone: aws.String(azName),
-		TagSpecifications: []types.TagSpecification{
-			{
-				ResourceType: types.ResourceTypeSubnet,
-				Tags: []types.Tag{
-					{Key: aws.String("Name"), Value: aws.String(fmt.Sprintf("tse-subnet-%s", friendlyRegion))},
-					{Key: aws.String("Project"), Value: aws.String(TagProject)},
-					{Key: aws.String("Type"), Value: aws.String(TagType)},
-					{Key: aws.String("Region"), Value: aws.String(friendlyRegion)},
-				},
-			},
-		},
-	})
+	// Create subnet; launches in other zones add their own (see runInstance)
+	subnetID, err := s.createSubnet(ctx, vpcID, friendlyRegion, azName, "10.0.1.0/24")
 	if err != nil {
-		return "", "", fmt.Errorf("failed to create subnet: %w", err)
+		return "", "", undo.fail(ctx, err)
 	}
-
-	subnetID := *subnetResult.Subnet.SubnetId
+	undo.add("subnet "+subnetID, func(ctx context.Context) error {
+		_, err := s.ec2Client.DeleteSubnet(ctx, &ec2.DeleteSubnetInput{SubnetId: aws.String(subnetID)})
+		return err
+	})
 
 	// Create Internet Gateway
 	igwResult, err := s.ec2Client.CreateInternetGateway(ctx, &ec2.CreateInternetGatewayInput{
 		TagSpecifications: []types.TagSpecification{
 			{
 				ResourceType: types.ResourceTypeInternetGateway,
-				Tags: []types.Tag{
+				Tags: append([]types.Tag{
 					{Key: aws.String("Name"), Value: aws.String(fmt.Sprintf("tse-igw-%s", friendlyRegion))},
 					{Key: aws.String("Project"), Value: aws.String(TagProject)},
 					{Key: aws.String("Type"), Value: aws.String(TagType)},
 					{Key: aws.String("Region"), Value: aws.String(friendlyRegion)},
-				},
+				}, s.deploymentTags()...),
 			},
 		},
 	})
 	if err != nil {
-		return "", "", fmt.Errorf("failed to create internet gateway: %w", err)
+		return "", "", undo.fail(ctx, fmt.Errorf("failed to create internet gateway: %w", err))
 	}
 
 	igwID := *igwResult.InternetGateway.InternetGatewayId
+	undo.add("internet gateway "+igwID, func(ctx context.Context) error { return s.deleteInternetGateway(ctx, igwID, vpcID) })
 
 	// Attach Internet Gateway to VPC
 	_, err = s.ec2Client.AttachInternetGateway(ctx, &ec2.AttachInternetGatewayInput{
@@ -373,7 +773,7 @@ func (s *Service) createVPCStack(ctx context.Context, friendlyRegion string) (st
 		VpcId:             aws.String(vpcID),
 	})
 	if err != nil {
-		return "", "", fmt.Errorf("failed to attach internet gateway: %w", err)
+		return "", "", undo.fail(ctx, fmt.Errorf("failed to attach internet gateway: %w", err))
 	}
 
 	// Get the route table for the VPC
@@ -386,11 +786,11 @@ func (s *Service) createVPCStack(ctx context.Context, friendlyRegion string) (st
 		},
 	})
 	if err != nil {
-		return "", "", fmt.Errorf("failed to find route table: %w", err)
+		return "", "", undo.fail(ctx, fmt.Errorf("failed to find route table: %w", err))
 	}
 
 	if len(rtResult.RouteTables) == 0 {
-		return "", "", fmt.Errorf("no route table found for VPC")
+		return "", "", undo.fail(ctx, fmt.Errorf("no route table found for VPC"))
 	}
 
 	routeTableID := *rtResult.RouteTables[0].RouteTableId
@@ -402,36 +802,64 @@ func (s *Service) createVPCStack(ctx context.Context, friendlyRegion string) (st
 		GatewayId:            aws.String(igwID),
 	})
 	if err != nil {
-		return "", "", fmt.Errorf("failed to create route to internet gateway: %w", err)
-	}
-
-	// Enable auto-assign public IP for the subnet
-	_, err = s.ec2Client.ModifySubnetAttribute(ctx, &ec2.ModifySubnetAttributeInput{
-		SubnetId: aws.String(subnetID),
-		MapPublicIpOnLaunch: &types.AttributeBooleanValue{
-			Value: aws.Bool(true),
-		},
-	})
-	if err != nil {
-		return "", "", fmt.Errorf("failed to enable auto-assign public IP for subnet: %w", err)
+		return "", "", undo.fail(ctx, fmt.Errorf("failed to create route to internet gateway: %w", err))
 	}
 
 	return subnetID, vpcID, nil
 }
 
 // StartInstance creates a new exit node instance
-func (s *Service) StartInstance(ctx context.Context, friendlyRegion, authKey string) (*sharedtypes.InstanceInfo, error) {
+func (s *Service) StartInstance(ctx context.Context, friendlyRegion, authKey, clientToken string, opts NodeOptions) (*sharedtypes.InstanceInfo, error) {
 	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get latest Amazon Linux 2023 ARM64 AMI
-	amiID, err := s.getLatestAmazonLinux2023ARM64AMI(ctx)
+	baseline, err := BaselineFromEnv()
 	if err != nil {
-		return nil, fmt.Errorf("failed to find Amazon Linux 2023 ARM64 AMI: %w", err)
+		return nil, err
 	}
 
+	// Launch into the region's capacity reservation, if it has one (tse <region> reserve)
+	reservation := s.usableReservation(ctx, friendlyRegion)
+
+	var runResult *ec2.RunInstancesOutput
+	for attempt := 1; ; attempt++ {
+		runResult, err = s.launchExitNode(ctx, friendlyRegion, authKey, opts, launchToken{clientToken, attempt}, baseline, reservation)
+		if err == nil {
+			break
+		}
+		if attempt == launchAttempts || !isMissingResourceError(err) {
+			return nil, err
+		}
+		// A cleanup deleted the VPC stack or security group mid-start; build them again
+		log.Printf("Launch resources in %s vanished, recreating them: %v", friendlyRegion, err)
+	}
+
+	instance := runResult.Instances[0]
+
+	info := &sharedtypes.InstanceInfo{
+		InstanceID:            *instance.InstanceId,
+		Region:                awsRegion,
+		FriendlyRegion:        friendlyRegion,
+		State:                 string(instance.State.Name),
+		LaunchTime:            instance.LaunchTime.UTC(),
+		InstanceType:          string(instance.InstanceType),
+		Architecture:          string(instance.Architecture),
+		TailscaleHostname:     fmt.Sprintf("exit-%s", friendlyRegion),
+		CapacityReservationID: aws.ToString(instance.CapacityReservationId),
+		ClientToken:           clientToken,
+	}
+	if opts.StartedBy != nil {
+		info.StartedBy = opts.StartedBy.Name
+		info.StartedByID = opts.StartedBy.ID
+	}
+	return info, nil
+}
+
+// launchExitNode finds or creates the region's VPC stack and security group and
+// launches one exit node into them
+func (s *Service) launchExitNode(ctx context.Context, friendlyRegion, authKey string, opts NodeOptions, token launchToken, baseline Baseline, reservation *sharedtypes.ReservationInfo) (*ec2.RunInstancesOutput, error) {
 	// Find or create VPC infrastructure
 	subnetID, vpcID, err := s.findOrCreateVPCStack(ctx, friendlyRegion)
 	if err != nil {
@@ -439,54 +867,84 @@ func (s *Service) StartInstance(ctx context.Context, friendlyRegion, authKey str
 	}
 
 	// Ensure security group exists in the VPC
-	sgID, err := s.findOrCreateSecurityGroup(ctx, vpcID, friendlyRegion)
+	sgID, err := s.findOrCreateSecurityGroup(ctx, vpcID, friendlyRegion, baseline)
 	if err != nil {
 		return nil, err
 	}
 
+	// Re-check both right before launching, in case a cleanup removed them meanwhile
+	if err := s.verifyLaunchResources(ctx, subnetID, sgID); err != nil {
+		return nil, fmt.Errorf("launch resources disappeared: %w", err)
+	}
+
+	if opts.Hop != nil {
+		if err := s.allowHop(ctx, sgID, opts.Hop, baseline); err != nil {
+			return nil, err
+		}
+	}
+
 	// Generate user data script
-	userData := generateUserData(authKey, friendlyRegion)
+	userData := generateUserData(authKey, friendlyRegion, opts)
 
-	// Launch instance
-	runResult, err := s.ec2Client.RunInstances(ctx, &ec2.RunInstancesInput{
-		ImageId:          aws.String(amiID),
-		InstanceType:     types.InstanceType(InstanceType),
+	// Launch instance; runInstance fills in the image, instance type and subnet
+	input := &ec2.RunInstancesInput{
 		MinCount:         aws.Int32(1),
 		MaxCount:         aws.Int32(1),
-		SubnetId:         aws.String(subnetID),
 		SecurityGroupIds: []string{sgID},
-		KeyName:          aws.String("tailscale"), // Temporary for debugging
 		UserData:         aws.String(userData),
+		// A shutdown from inside the node (TTL script, fail-safe, manual `shutdown -h now`)
+		// should end billing, not leave a stopped instance around forever
+		InstanceInitiatedShutdownBehavior: types.ShutdownBehaviorTerminate,
 		TagSpecifications: []types.TagSpecification{
 			{
 				ResourceType: types.ResourceTypeInstance,
-				Tags: []types.Tag{
+				Tags: append([]types.Tag{
 					{Key: aws.String("Name"), Value: aws.String(fmt.Sprintf("tse-exit-%s", friendlyRegion))},
 					{Key: aws.String("Project"), Value: aws.String(TagProject)},
 					{Key: aws.String("Type"), Value: aws.String(TagType)},
 					{Key: aws.String("Region"), Value: aws.String(friendlyRegion)},
-				},
+				}, s.deploymentTags()...),
 			},
 		},
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to launch instance: %w", err)
+	}
+	if token.Client != "" {
+		tags := &input.TagSpecifications[0].Tags
+		*tags = append(*tags, types.Tag{Key: aws.String(TagClientToken), Value: aws.String(token.Client)})
+	}
+	if opts.Hop != nil {
+		tags := &input.TagSpecifications[0].Tags
+		*tags = append(*tags, types.Tag{Key: aws.String(TagHop), Value: aws.String(hopTagValue(opts.Hop))})
+	}
+	if opts.StartedBy != nil {
+		tags := &input.TagSpecifications[0].Tags
+		*tags = append(*tags,
+			types.Tag{Key: aws.String(TagStartedBy), Value: aws.String(opts.StartedBy.Name)},
+			types.Tag{Key: aws.String(TagStartedByID), Value: aws.String(opts.StartedBy.ID)},
+		)
 	}
 
-	instance := runResult.Instances[0]
+	// The instance profile lets the node tag itself ready; without one it still works,
+	// it just never reports readiness
+	if profile := os.Getenv("TSE_INSTANCE_PROFILE"); profile != "" {
+		input.IamInstanceProfile = &types.IamInstanceProfileSpecification{Name: aws.String(profile)}
+	}
 
-	return &sharedtypes.InstanceInfo{
-		InstanceID:        *instance.InstanceId,
-		Region:            awsRegion,
-		FriendlyRegion:    friendlyRegion,
-		State:             string(instance.State.Name),
-		LaunchTime:        *instance.LaunchTime,
-		InstanceType:      string(instance.InstanceType),
-		TailscaleHostname: fmt.Sprintf("exit-%s", friendlyRegion),
-	}, nil
+	// Deploy's launch template carries the image, instance type and shutdown
+	// behavior; the rest of the input overrides it for this node
+	if input.LaunchTemplate = s.launchTemplate(ctx); input.LaunchTemplate != nil {
+		input.InstanceInitiatedShutdownBehavior = ""
+	}
+
+	// Fall back to other zones and to x86_64 when t4g capacity runs out
+	runResult, err := s.runInstance(ctx, input, token, baseline, vpcID, subnetID, friendlyRegion, reservation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to launch instance: %w", err)
+	}
+	return runResult, nil
 }
 
-// ListInstances returns all ephemeral exit node instances in the region
+// ListInstances returns the region's ephemeral exit node instances that belong
+// to this deployment (see AllDeployments)
 func (s *Service) ListInstances(ctx context.Context) ([]*sharedtypes.InstanceInfo, error) {
 	result, err := s.ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
 		Filters: []types.Filter{
@@ -516,41 +974,144 @@ func (s *Service) ListInstances(ctx context.Context) ([]*sharedtypes.InstanceInf
 	var instances []*sharedtypes.InstanceInfo
 	for _, reservation := range result.Reservations {
 		for _, instance := range reservation.Instances {
-			friendlyRegion := ""
-			for _, tag := range instance.Tags {
-				if *tag.Key == "Region" {
-					friendlyRegion = *tag.Value
-					break
-				}
+			if s.owns(instance.Tags) {
+				instances = append(instances, instanceInfo(instance))
 			}
+		}
+	}
 
-			info := &sharedtypes.InstanceInfo{
-				InstanceID:     *instance.InstanceId,
-				State:          string(instance.State.Name),
-				LaunchTime:     *instance.LaunchTime,
-				InstanceType:   string(instance.InstanceType),
-				FriendlyRegion: friendlyRegion,
-			}
+	return instances, nil
+}
 
-			if instance.PublicIpAddress != nil {
-				info.PublicIP = *instance.PublicIpAddress
-			}
-			if instance.PrivateIpAddress != nil {
-				info.PrivateIP = *instance.PrivateIpAddress
+// instanceInfo converts an EC2 instance into an InstanceInfo, reading our tags
+func instanceInfo(instance types.Instance) *sharedtypes.InstanceInfo {
+	friendlyRegion := ""
+	tailscaleHostname := ""
+	assignedName := ""
+	info := &sharedtypes.InstanceInfo{
+		InstanceID:   *instance.InstanceId,
+		State:        string(instance.State.Name),
+		LaunchTime:   instance.LaunchTime.UTC(),
+		InstanceType: string(instance.InstanceType),
+		Architecture: string(instance.Architecture),
+		ImageID:      aws.ToString(instance.ImageId),
+	}
+
+	for _, tag := range instance.Tags {
+		switch *tag.Key {
+		case "Region":
+			friendlyRegion = *tag.Value
+		case TagTailscaleHostname:
+			tailscaleHostname = *tag.Value
+		case TagTailscaleName:
+			assignedName = *tag.Value
+		case TagReady:
+			info.Ready = *tag.Value == "true"
+		case TagTailscaleIP:
+			info.TailscaleIP = *tag.Value
+		case TagTailscaleIPv6:
+			info.TailscaleIPv6 = *tag.Value
+		case TagClientToken:
+			info.ClientToken = *tag.Value
+		case TagHop:
+			info.Hop = *tag.Value
+		case TagStartedBy:
+			info.StartedBy = *tag.Value
+		case TagStartedByID:
+			info.StartedByID = *tag.Value
+		}
+	}
+	info.FriendlyRegion = friendlyRegion
+
+	if instance.PublicIpAddress != nil {
+		info.PublicIP = *instance.PublicIpAddress
+	}
+	if instance.PrivateIpAddress != nil {
+		info.PrivateIP = *instance.PrivateIpAddress
+	}
+	if instance.CapacityReservationId != nil {
+		info.CapacityReservationID = *instance.CapacityReservationId
+	}
+	switch {
+	case assignedName != "":
+		// What the node reported, suffix and all
+		info.TailscaleHostname = assignedName
+	case tailscaleHostname != "":
+		// Adopted instances keep whatever hostname they were launched with
+		info.TailscaleHostname = tailscaleHostname
+	case friendlyRegion != "":
+		info.TailscaleHostname = fmt.Sprintf("exit-%s", friendlyRegion)
+	}
+
+	return info
+}
+
+// isInstanceProfileError reports whether RunInstances rejected the instance profile
+// (missing, not yet propagated, or not passable by our role)
+func isInstanceProfileError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "iaminstanceprofile") ||
+		strings.Contains(msg, "instance profile") ||
+		strings.Contains(msg, "iam:passrole")
+}
+
+// ClaimStalledInstances returns running exit nodes launched more than timeout ago that
+// never tagged themselves ready, marking each so it is only returned once
+func (s *Service) ClaimStalledInstances(ctx context.Context, timeout time.Duration) ([]*sharedtypes.InstanceInfo, error) {
+	result, err := s.ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{Name: aws.String("tag:Project"), Values: []string{TagProject}},
+			{Name: aws.String("tag:Type"), Values: []string{TagType}},
+			{Name: aws.String("instance-state-name"), Values: []string{"running"}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe instances: %w", err)
+	}
+
+	var stalled []*sharedtypes.InstanceInfo
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			if !s.owns(instance.Tags) || time.Since(*instance.LaunchTime) < timeout || hasTag(instance.Tags, TagReady, "true") || hasTag(instance.Tags, TagFailureNotified, "true") {
+				continue
 			}
-			if friendlyRegion != "" {
-				info.TailscaleHostname = fmt.Sprintf("exit-%s", friendlyRegion)
+
+			_, err := s.ec2Client.CreateTags(ctx, &ec2.CreateTagsInput{
+				Resources: []string{*instance.InstanceId},
+				Tags:      []types.Tag{{Key: aws.String(TagFailureNotified), Value: aws.String("true")}},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to tag instance %s: %w", *instance.InstanceId, err)
 			}
 
-			instances = append(instances, info)
+			stalled = append(stalled, instanceInfo(instance))
 		}
 	}
 
-	return instances, nil
+	return stalled, nil
 }
 
-// StopInstances terminates all ephemeral exit node instances in the region
+// StopInstances terminates all ephemeral exit node instances in the region,
+// then removes their VPC infrastructure unless it's persistent
 func (s *Service) StopInstances(ctx context.Context) ([]string, error) {
+	instanceIDs, err := s.TerminateInstances(ctx)
+	if err != nil || len(instanceIDs) == 0 {
+		return instanceIDs, err
+	}
+
+	// Wait for instances to be terminated, then clean up VPC infrastructure
+	go func() {
+		// Give instances time to terminate
+		time.Sleep(stopCleanupDelay)
+		s.cleanupVPCInfrastructure(ctx, false, true)
+	}()
+
+	return instanceIDs, nil
+}
+
+// TerminateInstances terminates all ephemeral exit node instances in the region,
+// leaving their VPC infrastructure for RemoveVPCInfrastructure once they're gone
+func (s *Service) TerminateInstances(ctx context.Context) ([]string, error) {
 	instances, err := s.ListInstances(ctx)
 	if err != nil {
 		return nil, err
@@ -562,7 +1123,7 @@ func (s *Service) StopInstances(ctx context.Context) ([]string, error) {
 
 	var instanceIDs []string
 	for _, instance := range instances {
-		if instance.State == "running" || instance.State == "pending" || instance.State == "stopped" {
+		if instance.State == "running" || instance.State == "pending" || instance.State == "stopping" || instance.State == "stopped" {
 			instanceIDs = append(instanceIDs, instance.InstanceID)
 		}
 	}
@@ -578,29 +1139,84 @@ func (s *Service) StopInstances(ctx context.Context) ([]string, error) {
 		return nil, fmt.Errorf("failed to terminate instances: %w", err)
 	}
 
-	// Wait for instances to be terminated, then clean up VPC infrastructure
-	go func() {
-		// Give instances time to terminate
-		time.Sleep(30 * time.Second)
-		s.cleanupVPCInfrastructure(ctx)
-	}()
-
 	return instanceIDs, nil
 }
 
-// cleanupVPCInfrastructure removes VPC infrastructure when no instances are running
-func (s *Service) cleanupVPCInfrastructure(ctx context.Context) error {
+// TerminateInstance terminates a single exit node, leaving its VPC infrastructure
+// for the next stop or cleanup
+func (s *Service) TerminateInstance(ctx context.Context, instanceID string) error {
+	_, err := s.ec2Client.TerminateInstances(ctx, &ec2.TerminateInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to terminate instance %s: %w", instanceID, err)
+	}
+	return nil
+}
+
+// PauseInstances stops (not terminates) exit nodes, keeping their disks and so
+// their Tailscale identity. Their readiness tags are removed first, so a
+// resumed node counts as booting until it reports ready again.
+func (s *Service) PauseInstances(ctx context.Context, instanceIDs []string) error {
+	_, err := s.ec2Client.DeleteTags(ctx, &ec2.DeleteTagsInput{
+		Resources: instanceIDs,
+		Tags:      []types.Tag{{Key: aws.String(TagReady)}, {Key: aws.String(TagFailureNotified)}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clear readiness tags: %w", err)
+	}
+
+	_, err = s.ec2Client.StopInstances(ctx, &ec2.StopInstancesInput{
+		InstanceIds: instanceIDs,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to stop instances: %w", err)
+	}
+	return nil
+}
+
+// ResumeInstances starts paused exit nodes again. Their user data doesn't run
+// a second time; the tse-resume unit it installed brings Tailscale back up.
+func (s *Service) ResumeInstances(ctx context.Context, instanceIDs []string) error {
+	_, err := s.ec2Client.StartInstances(ctx, &ec2.StartInstancesInput{
+		InstanceIds: instanceIDs,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start instances: %w", err)
+	}
+	return nil
+}
+
+// RemoveVPCInfrastructure removes the VPC infrastructure a stop left behind once
+// its instances are gone, returning the VPCs it deleted. Persistent VPCs stay.
+// Unlike the cleanup after StopInstances, it fails when a VPC couldn't be
+// deleted (typically because a terminating instance still holds it), so the
+// caller can retry.
+func (s *Service) RemoveVPCInfrastructure(ctx context.Context) ([]string, error) {
+	deleted, _, failed, err := s.cleanupVPCInfrastructure(ctx, false, true)
+	if err != nil {
+		return deleted, err
+	}
+	if len(failed) > 0 {
+		return deleted, fmt.Errorf("failed to delete %s", strings.Join(failed, ", "))
+	}
+	return deleted, nil
+}
+
+// cleanupVPCInfrastructure removes VPC infrastructure when no instances are left,
+// returning the VPCs it deleted, those it left alone for being created within
+// CleanupGracePeriod (unless force is set), and those it failed to delete.
+// With keepPersistent, VPCs marked persistent are left alone without a mention.
+func (s *Service) cleanupVPCInfrastructure(ctx context.Context, force, keepPersistent bool) (deleted, skipped, failed []string, err error) {
 	// Check if any TSE instances are still running
 	instances, err := s.ListInstances(ctx)
 	if err != nil {
-		return err
+		return nil, nil, nil, err
 	}
 
-	// If there are still running instances, don't clean up
-	for _, instance := range instances {
-		if instance.State == "running" || instance.State == "pending" {
-			return nil
-		}
+	// Running, booting or paused instances still use the VPC, so don't clean up
+	if len(instances) > 0 {
+		return nil, nil, nil, nil
 	}
 
 	// Find TSE VPCs
@@ -617,18 +1233,30 @@ func (s *Service) cleanupVPCInfrastructure(ctx context.Context) error {
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("failed to find TSE VPCs: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to find TSE VPCs: %w", err)
 	}
 
+	now := time.Now()
 	for _, vpc := range vpcResult.Vpcs {
 		vpcID := *vpc.VpcId
+		if !s.owns(vpc.Tags) || (keepPersistent && persistent(vpc.Tags)) {
+			continue
+		}
+		// A start may have just created it and not launched into it yet
+		if !force && recentlyCreated(vpc.Tags, now) {
+			skipped = append(skipped, vpcID)
+			continue
+		}
 		if err := s.deleteVPCStack(ctx, vpcID); err != nil {
 			// Log error but continue with other VPCs
 			fmt.Printf("Failed to delete VPC %s: %v\n", vpcID, err)
+			failed = append(failed, vpcID)
+			continue
 		}
+		deleted = append(deleted, vpcID)
 	}
 
-	return nil
+	return deleted, skipped, failed, nil
 }
 
 // deleteVPCStack removes a VPC and all its associated infrastructure
@@ -687,10 +1315,11 @@ func (s *Service) deleteVPCStack(ctx context.Context, vpcID string) error {
 	return nil
 }
 
-// ForceCleanupAllResources aggressively cleans up all TSE resources in a region
-func (s *Service) ForceCleanupAllResources(ctx context.Context, friendlyRegion string) ([]string, error) {
-	var cleanedResources []string
-
+// ForceCleanupAllResources aggressively cleans up all TSE resources in a region,
+// persistent VPCs included. Security groups and VPCs created within CleanupGracePeriod are skipped and
+// returned separately unless force is set, so a cleanup can't pull them out from
+// under a start that's in progress.
+func (s *Service) ForceCleanupAllResources(ctx context.Context, friendlyRegion string, force bool) (cleanedResources, skippedResources []string, err error) {
 	// 1. Terminate all TSE instances
 	instances, err := s.ListInstances(ctx)
 	if err == nil {
@@ -707,7 +1336,7 @@ func (s *Service) ForceCleanupAllResources(ctx context.Context, friendlyRegion s
 	}
 
 	// Wait a bit for instances to start terminating
-	time.Sleep(5 * time.Second)
+	time.Sleep(forceCleanupDelay)
 
 	// 2. Delete security groups
 	sgResult, err := s.ec2Client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
@@ -727,8 +1356,16 @@ func (s *Service) ForceCleanupAllResources(ctx context.Context, friendlyRegion s
 		},
 	})
 	if err == nil {
+		now := time.Now()
 		for _, sg := range sgResult.SecurityGroups {
 			sgID := *sg.GroupId
+			if !s.owns(sg.Tags) {
+				continue
+			}
+			if !force && recentlyCreated(sg.Tags, now) {
+				skippedResources = append(skippedResources, fmt.Sprintf("SecurityGroup:%s", sgID))
+				continue
+			}
 			_, err := s.ec2Client.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{
 				GroupId: aws.String(sgID),
 			})
@@ -739,30 +1376,83 @@ func (s *Service) ForceCleanupAllResources(ctx context.Context, friendlyRegion s
 	}
 
 	// 3. Clean up VPC infrastructure
-	if err := s.cleanupVPCInfrastructure(ctx); err == nil {
-		// Find and report VPCs that were cleaned up
-		vpcResult, err := s.ec2Client.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{
-			Filters: []types.Filter{
-				{
-					Name:   aws.String("tag:Project"),
-					Values: []string{TagProject},
-				},
-				{
-					Name:   aws.String("tag:Type"),
-					Values: []string{TagType},
-				},
-				{
-					Name:   aws.String("tag:Region"),
-					Values: []string{friendlyRegion},
-				},
-			},
-		})
-		if err == nil {
-			for _, vpc := range vpcResult.Vpcs {
-				cleanedResources = append(cleanedResources, fmt.Sprintf("VPC:%s", *vpc.VpcId))
-			}
+	deleted, skipped, _, err := s.cleanupVPCInfrastructure(ctx, force, false)
+	if err == nil {
+		for _, vpcID := range deleted {
+			cleanedResources = append(cleanedResources, fmt.Sprintf("VPC:%s", vpcID))
+		}
+		for _, vpcID := range skipped {
+			skippedResources = append(skippedResources, fmt.Sprintf("VPC:%s", vpcID))
+		}
+	}
+
+	return cleanedResources, skippedResources, nil
+}
+
+// PreviewCleanup lists the TSE resources ForceCleanupAllResources would remove,
+// and those it would skip, without deleting anything
+func (s *Service) PreviewCleanup(ctx context.Context, friendlyRegion string, force bool) (resources, skipped []string, err error) {
+	instances, err := s.ListInstances(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, instance := range instances {
+		if instance.State == "running" || instance.State == "pending" || instance.State == "stopped" {
+			resources = append(resources, fmt.Sprintf("Instance:%s", instance.InstanceID))
+		}
+	}
+
+	regionFilters := []types.Filter{
+		{
+			Name:   aws.String("tag:Project"),
+			Values: []string{TagProject},
+		},
+		{
+			Name:   aws.String("tag:Type"),
+			Values: []string{TagType},
+		},
+		{
+			Name:   aws.String("tag:Region"),
+			Values: []string{friendlyRegion},
+		},
+	}
+
+	sgResult, err := s.ec2Client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
+		Filters: regionFilters,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to describe security groups: %w", err)
+	}
+	now := time.Now()
+	for _, sg := range sgResult.SecurityGroups {
+		if !s.owns(sg.Tags) {
+			continue
+		}
+		resource := fmt.Sprintf("SecurityGroup:%s", *sg.GroupId)
+		if !force && recentlyCreated(sg.Tags, now) {
+			skipped = append(skipped, resource)
+			continue
+		}
+		resources = append(resources, resource)
+	}
+
+	vpcResult, err := s.ec2Client.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{
+		Filters: regionFilters,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to describe VPCs: %w", err)
+	}
+	for _, vpc := range vpcResult.Vpcs {
+		if !s.owns(vpc.Tags) {
+			continue
+		}
+		resource := fmt.Sprintf("VPC:%s", *vpc.VpcId)
+		if !force && recentlyCreated(vpc.Tags, now) {
+			skipped = append(skipped, resource)
+			continue
 		}
+		resources = append(resources, resource)
 	}
 
-	return cleanedResources, nil
+	return resources, skipped, nil
 }
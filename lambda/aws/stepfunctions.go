@@ -0,0 +1,57 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+)
+
+// WorkflowSuffix ends the name of the state machine 'tse deploy --orchestration
+// stepfunctions' creates next to the Lambda, which it names after the function
+const WorkflowSuffix = "-workflows"
+
+// WorkflowARN derives the deployment's state machine ARN from the Lambda's own,
+// which shares its partition, region, account and name
+func WorkflowARN(functionARN string) (string, error) {
+	// arn:partition:lambda:region:account:function:name[:qualifier]
+	parts := strings.Split(functionARN, ":")
+	if len(parts) < 7 || parts[0] != "arn" || parts[2] != "lambda" || parts[5] != "function" {
+		return "", fmt.Errorf("not a Lambda function ARN: %q", functionARN)
+	}
+	return fmt.Sprintf("arn:%s:states:%s:%s:stateMachine:%s%s", parts[1], parts[3], parts[4], parts[6], WorkflowSuffix), nil
+}
+
+// stepFunctionsAPI is the part of the Step Functions client the Lambda calls:
+// it only starts executions. Tests swap in a fake.
+type stepFunctionsAPI interface {
+	StartExecution(ctx context.Context, params *sfn.StartExecutionInput, optFns ...func(*sfn.Options)) (*sfn.StartExecutionOutput, error)
+}
+
+var _ stepFunctionsAPI = (*sfn.Client)(nil)
+
+// StartWorkflow starts an execution of the state machine with input. The
+// execution is named name, which Step Functions keeps unique, so dispatching
+// the same job twice can't run it twice. It uses the Lambda's own credentials,
+// even with ROLE_ARN set.
+func StartWorkflow(ctx context.Context, stateMachineARN, name string, input []byte) error {
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return startExecution(ctx, sfn.NewFromConfig(cfg), stateMachineARN, name, input)
+}
+
+func startExecution(ctx context.Context, client stepFunctionsAPI, stateMachineARN, name string, input []byte) error {
+	_, err := client.StartExecution(ctx, &sfn.StartExecutionInput{
+		StateMachineArn: aws.String(stateMachineARN),
+		Name:            aws.String(name),
+		Input:           aws.String(string(input)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start workflow %s: %w", name, err)
+	}
+	return nil
+}
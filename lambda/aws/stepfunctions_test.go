@@ -0,0 +1,63 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	sfntypes "github.com/aws/aws-sdk-go-v2/service/sfn/types"
+)
+
+func TestWorkflowARN(t *testing.T) {
+	tests := []struct {
+		function string
+		want     string
+	}{
+		{"arn:aws:lambda:us-east-2:123456789012:function:tailscale-exits", "arn:aws:states:us-east-2:123456789012:stateMachine:tailscale-exits-workflows"},
+		{"arn:aws:lambda:eu-west-1:123456789012:function:acme-tse:$LATEST", "arn:aws:states:eu-west-1:123456789012:stateMachine:acme-tse-workflows"},
+		{"arn:aws-cn:lambda:cn-north-1:123456789012:function:tse", "arn:aws-cn:states:cn-north-1:123456789012:stateMachine:tse-workflows"},
+	}
+	for _, tt := range tests {
+		if got, err := WorkflowARN(tt.function); err != nil || got != tt.want {
+			t.Errorf("WorkflowARN(%s) = %s, %v, want %s", tt.function, got, err, tt.want)
+		}
+	}
+
+	if _, err := WorkflowARN("tailscale-exits"); err == nil {
+		t.Error("WorkflowARN(function name) succeeded, want an error")
+	}
+}
+
+// fakeStepFunctions answers StartExecution with a func
+type fakeStepFunctions func(*sfn.StartExecutionInput) (*sfn.StartExecutionOutput, error)
+
+func (f fakeStepFunctions) StartExecution(ctx context.Context, params *sfn.StartExecutionInput, optFns ...func(*sfn.Options)) (*sfn.StartExecutionOutput, error) {
+	return f(params)
+}
+
+func TestStartExecution(t *testing.T) {
+	var asked *sfn.StartExecutionInput
+	client := fakeStepFunctions(func(params *sfn.StartExecutionInput) (*sfn.StartExecutionOutput, error) {
+		asked = params
+		if aws.ToString(params.Name) == "job-again" {
+			return nil, &sfntypes.ExecutionAlreadyExists{Message: aws.String("Execution Already Exists")}
+		}
+		return &sfn.StartExecutionOutput{ExecutionArn: aws.String("arn:aws:states:us-east-2:123456789012:execution:tse-workflows:job-1")}, nil
+	})
+
+	machine := "arn:aws:states:us-east-2:123456789012:stateMachine:tse-workflows"
+	if err := startExecution(context.Background(), client, machine, "job-1", []byte(`{"tse_job":{"id":"job-1"}}`)); err != nil {
+		t.Fatalf("startExecution() = %v", err)
+	}
+	if aws.ToString(asked.StateMachineArn) != machine || aws.ToString(asked.Name) != "job-1" || aws.ToString(asked.Input) != `{"tse_job":{"id":"job-1"}}` {
+		t.Errorf("StartExecution input = %+v", asked)
+	}
+
+	err := startExecution(context.Background(), client, machine, "job-again", []byte(`{}`))
+	var exists *sfntypes.ExecutionAlreadyExists
+	if !errors.As(err, &exists) {
+		t.Errorf("startExecution(duplicate) error = %v, want ExecutionAlreadyExists", err)
+	}
+}
@@ -0,0 +1,206 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	sharedtypes "github.com/anoldguy/tse/shared/types"
+)
+
+const (
+	// TagAnomalyNotified marks nodes already reported as anomalous, so the
+	// notification goes out once
+	TagAnomalyNotified = "tse:anomaly-notified"
+
+	// amazonImageOwner is the owner alias of the Amazon Linux images nodes launch from
+	amazonImageOwner = "amazon"
+)
+
+// approvedInstanceTypes are the only types tse launches
+var approvedInstanceTypes = []string{InstanceType, FallbackInstanceType}
+
+// CheckTripwires looks for exit nodes tse would never have launched: an
+// unapproved instance type, an image not owned by Amazon, or a security group
+// open on ports tse doesn't open. Any of these means someone tampered with the
+// account or a bug created a surprise resource. Adopted instances were launched
+// outside tse on purpose, so they're exempt.
+func (s *Service) CheckTripwires(ctx context.Context) ([]sharedtypes.Anomaly, error) {
+	instResult, err := s.ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{Name: aws.String("tag:Project"), Values: []string{TagProject}},
+			{Name: aws.String("tag:Type"), Values: []string{TagType}},
+			{Name: aws.String("instance-state-name"), Values: []string{"pending", "running", "stopping", "stopped"}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe instances: %w", err)
+	}
+
+	var instances []types.Instance
+	var imageIDs, groupIDs []string
+	for _, reservation := range instResult.Reservations {
+		for _, instance := range reservation.Instances {
+			if !s.owns(instance.Tags) || hasTag(instance.Tags, TagAdopted, "true") {
+				continue
+			}
+			instances = append(instances, instance)
+			if id := aws.ToString(instance.ImageId); id != "" && !slices.Contains(imageIDs, id) {
+				imageIDs = append(imageIDs, id)
+			}
+			for _, group := range instance.SecurityGroups {
+				if id := aws.ToString(group.GroupId); !slices.Contains(groupIDs, id) {
+					groupIDs = append(groupIDs, id)
+				}
+			}
+		}
+	}
+	if len(instances) == 0 {
+		return nil, nil
+	}
+
+	// Images that no longer exist can't be checked, and aren't flagged
+	images := map[string]types.Image{}
+	if len(imageIDs) > 0 {
+		imgResult, err := s.ec2Client.DescribeImages(ctx, &ec2.DescribeImagesInput{ImageIds: imageIDs})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe images: %w", err)
+		}
+		for _, image := range imgResult.Images {
+			images[aws.ToString(image.ImageId)] = image
+		}
+	}
+
+	groups := map[string]types.SecurityGroup{}
+	if len(groupIDs) > 0 {
+		sgResult, err := s.ec2Client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{GroupIds: groupIDs})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe security groups: %w", err)
+		}
+		for _, sg := range sgResult.SecurityGroups {
+			groups[aws.ToString(sg.GroupId)] = sg
+		}
+	}
+
+	var anomalies []sharedtypes.Anomaly
+	for _, instance := range instances {
+		anomalies = append(anomalies, checkTripwires(instance, images, groups)...)
+	}
+	return anomalies, nil
+}
+
+// checkTripwires returns the ways a node differs from what tse launches.
+// images and groups hold the described images and security groups by ID.
+func checkTripwires(instance types.Instance, images map[string]types.Image, groups map[string]types.SecurityGroup) []sharedtypes.Anomaly {
+	id := aws.ToString(instance.InstanceId)
+	var anomalies []sharedtypes.Anomaly
+
+	if instanceType := string(instance.InstanceType); !slices.Contains(approvedInstanceTypes, instanceType) {
+		anomalies = append(anomalies, sharedtypes.Anomaly{
+			InstanceID: id,
+			Resource:   id,
+			Check:      "instance-type",
+			Detail:     fmt.Sprintf("instance type %s isn't one tse launches (%s or %s)", instanceType, InstanceType, FallbackInstanceType),
+		})
+	}
+
+	if image, ok := images[aws.ToString(instance.ImageId)]; ok && aws.ToString(image.ImageOwnerAlias) != amazonImageOwner {
+		owner := aws.ToString(image.ImageOwnerAlias)
+		if owner == "" {
+			owner = "account " + aws.ToString(image.OwnerId)
+		}
+		anomalies = append(anomalies, sharedtypes.Anomaly{
+			InstanceID: id,
+			Resource:   aws.ToString(image.ImageId),
+			Check:      "ami-owner",
+			Detail:     fmt.Sprintf("image is owned by %s, not Amazon", owner),
+		})
+	}
+
+	var groupIDs []string
+	for _, group := range instance.SecurityGroups {
+		groupIDs = append(groupIDs, aws.ToString(group.GroupId))
+	}
+	sort.Strings(groupIDs)
+	for _, groupID := range groupIDs {
+		sg, ok := groups[groupID]
+		if !ok {
+			continue
+		}
+		for _, perm := range unexpectedIngress(sg) {
+			anomalies = append(anomalies, sharedtypes.Anomaly{
+				InstanceID: id,
+				Resource:   groupID,
+				Check:      "ingress",
+				Detail:     fmt.Sprintf("security group allows inbound %s", describePermission(perm)),
+			})
+		}
+	}
+
+	return anomalies
+}
+
+// unexpectedIngress returns a security group's inbound permissions beyond the
+// ones tse adds: WireGuard, the multihop tunnel, and SSH if the group's
+// baseline allows it
+func unexpectedIngress(sg types.SecurityGroup) []types.IpPermission {
+	// egressRule's shape serves for inbound rules too
+	expected := []egressRule{
+		{"udp", 41641, 41641},
+		{"udp", sharedtypes.HopPort, sharedtypes.HopPort},
+	}
+	if b, err := LookupBaseline(baselineOf(sg.Tags)); err != nil || b.AllowSSH {
+		expected = append(expected, egressRule{"tcp", 22, 22})
+	}
+
+	var unexpected []types.IpPermission
+	for _, perm := range sg.IpPermissions {
+		allowed := slices.ContainsFunc(expected, func(rule egressRule) bool {
+			return aws.ToString(perm.IpProtocol) == rule.protocol &&
+				aws.ToInt32(perm.FromPort) == rule.from && aws.ToInt32(perm.ToPort) == rule.to
+		})
+		if !allowed {
+			unexpected = append(unexpected, perm)
+		}
+	}
+	return unexpected
+}
+
+// ClaimAnomalousInstances tags the given nodes as reported, returning the ones
+// that weren't already, so each anomaly is notified once
+func (s *Service) ClaimAnomalousInstances(ctx context.Context, instanceIDs []string) ([]string, error) {
+	if len(instanceIDs) == 0 {
+		return nil, nil
+	}
+	result, err := s.ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: instanceIDs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe instances: %w", err)
+	}
+
+	var claimed []string
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			if hasTag(instance.Tags, TagAnomalyNotified, "true") {
+				continue
+			}
+			claimed = append(claimed, aws.ToString(instance.InstanceId))
+		}
+	}
+	if len(claimed) == 0 {
+		return nil, nil
+	}
+
+	_, err = s.ec2Client.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: claimed,
+		Tags:      []types.Tag{{Key: aws.String(TagAnomalyNotified), Value: aws.String("true")}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to tag instances: %w", err)
+	}
+	return claimed, nil
+}
@@ -0,0 +1,71 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestCheckTripwires(t *testing.T) {
+	wireguard := types.IpPermission{IpProtocol: aws.String("udp"), FromPort: aws.Int32(41641), ToPort: aws.Int32(41641)}
+	ssh := types.IpPermission{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(22), ToPort: aws.Int32(22)}
+	rdp := types.IpPermission{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(3389), ToPort: aws.Int32(3389)}
+	strictTags := []types.Tag{{Key: aws.String(TagBaseline), Value: aws.String(BaselineStrict.Name)}}
+
+	images := map[string]types.Image{
+		"ami-amazon": {ImageId: aws.String("ami-amazon"), ImageOwnerAlias: aws.String("amazon"), OwnerId: aws.String("137112412989")},
+		"ami-other":  {ImageId: aws.String("ami-other"), OwnerId: aws.String("123456789012")},
+	}
+	groups := map[string]types.SecurityGroup{
+		"sg-standard": {GroupId: aws.String("sg-standard"), IpPermissions: []types.IpPermission{wireguard, ssh}},
+		"sg-strict":   {GroupId: aws.String("sg-strict"), Tags: strictTags, IpPermissions: []types.IpPermission{wireguard, ssh}},
+		"sg-open":     {GroupId: aws.String("sg-open"), IpPermissions: []types.IpPermission{wireguard, rdp}},
+	}
+	node := func(instanceType, image, group string) types.Instance {
+		return types.Instance{
+			InstanceId:     aws.String("i-1"),
+			InstanceType:   types.InstanceType(instanceType),
+			ImageId:        aws.String(image),
+			SecurityGroups: []types.GroupIdentifier{{GroupId: aws.String(group)}},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		instance types.Instance
+		want     []string
+	}{
+		{name: "as launched", instance: node(InstanceType, "ami-amazon", "sg-standard")},
+		{name: "fallback type", instance: node(FallbackInstanceType, "ami-amazon", "sg-standard")},
+		{name: "deregistered image", instance: node(InstanceType, "ami-gone", "sg-standard")},
+		{name: "instance type", instance: node("m7g.16xlarge", "ami-amazon", "sg-standard"), want: []string{"instance-type"}},
+		{name: "image owner", instance: node(InstanceType, "ami-other", "sg-standard"), want: []string{"ami-owner"}},
+		{name: "ssh under strict", instance: node(InstanceType, "ami-amazon", "sg-strict"), want: []string{"ingress"}},
+		{name: "extra port", instance: node(InstanceType, "ami-amazon", "sg-open"), want: []string{"ingress"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anomalies := checkTripwires(tt.instance, images, groups)
+			if len(anomalies) != len(tt.want) {
+				t.Fatalf("got %+v, want checks %v", anomalies, tt.want)
+			}
+			for i, a := range anomalies {
+				if a.Check != tt.want[i] || a.InstanceID != "i-1" {
+					t.Errorf("anomaly %d = %+v, want check %s on i-1", i, a, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUnexpectedIngressDescribesPort(t *testing.T) {
+	sg := types.SecurityGroup{IpPermissions: []types.IpPermission{
+		{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(1), ToPort: aws.Int32(65535)},
+	}}
+	got := unexpectedIngress(sg)
+	if len(got) != 1 || describePermission(got[0]) != "tcp/1-65535" {
+		t.Errorf("unexpectedIngress() = %+v, want tcp/1-65535", got)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// handlerReserve is how much of the Lambda's timeout handlers leave unused. A
+// start that runs out of time fails with its context's deadline instead of
+// the Lambda being killed mid-create, with time left to roll back what it
+// created (a few seconds for a VPC stack), record the audit entry and answer.
+const handlerReserve = 15 * time.Second
+
+// withHandlerDeadline bounds ctx to the invocation's deadline less
+// handlerReserve. Outside Lambda, where there's no deadline, ctx is unbounded.
+func withHandlerDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline.Add(-handlerReserve))
+}
+
+// ranOutOfTime reports whether a handler's context hit its deadline
+func ranOutOfTime(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// outOfTimeResponse recodes a server error from a handler that ran out of time
+// as a 504 OUT_OF_TIME, keeping its message, so the caller learns it was the
+// Lambda's timeout rather than AWS that failed. Other responses pass through.
+func outOfTimeResponse(ctx context.Context, response events.LambdaFunctionURLResponse) events.LambdaFunctionURLResponse {
+	if response.StatusCode < 500 || !ranOutOfTime(ctx) {
+		return response
+	}
+	message := "Ran out of time"
+	var errorResp types.ErrorResponse
+	if json.Unmarshal([]byte(response.Body), &errorResp) == nil && errorResp.Error != "" {
+		message = errorResp.Error
+	}
+	return codedErrorResponse(http.StatusGatewayTimeout, types.ErrorCodeOutOfTime, message+" (the Lambda ran short of its timeout)")
+}
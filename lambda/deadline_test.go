@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func TestWithHandlerDeadline(t *testing.T) {
+	lambdaDeadline := time.Now().Add(time.Minute)
+	parent, cancel := context.WithDeadline(context.Background(), lambdaDeadline)
+	defer cancel()
+
+	ctx, cancel := withHandlerDeadline(parent)
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || !deadline.Equal(lambdaDeadline.Add(-handlerReserve)) {
+		t.Errorf("deadline = %v, %v; want the Lambda's less %s", deadline, ok, handlerReserve)
+	}
+
+	ctx, cancel = withHandlerDeadline(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("withHandlerDeadline() set a deadline outside Lambda")
+	}
+}
+
+func TestOutOfTimeResponse(t *testing.T) {
+	failed := awsErrorResponse("Failed to start instance", context.DeadlineExceeded)
+
+	live := context.Background()
+	if got := outOfTimeResponse(live, failed); got.StatusCode != http.StatusInternalServerError {
+		t.Errorf("outOfTimeResponse() with time left = %d, want the error as it was", got.StatusCode)
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	ok := jsonResponse(http.StatusOK, types.StopResponse{Success: true})
+	if got := outOfTimeResponse(expired, ok); got.StatusCode != http.StatusOK {
+		t.Errorf("outOfTimeResponse(200) = %d, want it untouched", got.StatusCode)
+	}
+
+	got := outOfTimeResponse(expired, failed)
+	var errorResp types.ErrorResponse
+	json.Unmarshal([]byte(got.Body), &errorResp)
+	if got.StatusCode != http.StatusGatewayTimeout || errorResp.ErrorCode != types.ErrorCodeOutOfTime || !strings.Contains(errorResp.Error, "Failed to start instance") {
+		t.Errorf("outOfTimeResponse() = %d %+v, want 504 OUT_OF_TIME keeping the message", got.StatusCode, errorResp)
+	}
+}
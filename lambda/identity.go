@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/anoldguy/tse/lambda/aws"
+)
+
+// deploymentIdentity is which deployment this Lambda is, reported by the health
+// check so the CLI can tell when it's talking to someone else's
+type deploymentIdentity struct {
+	AccountID    string
+	Deployment   string
+	DeploymentID string
+	Region       string
+}
+
+// identity is looked up once per cold start
+var identity deploymentIdentity
+
+// identityTimeout bounds the STS call so a slow lookup can't stall a cold start
+const identityTimeout = 5 * time.Second
+
+// loadIdentity reads the function name and region from the Lambda environment
+// and the account ID from STS. A failed lookup leaves the account empty.
+func loadIdentity(ctx context.Context) deploymentIdentity {
+	id := deploymentIdentity{
+		Deployment:   os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+		DeploymentID: os.Getenv(aws.EnvDeploymentID),
+		Region:       os.Getenv("AWS_REGION"),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, identityTimeout)
+	defer cancel()
+
+	accountID, err := aws.AccountID(ctx)
+	if err != nil {
+		log.Printf("Health checks won't report the account: %v", err)
+		return id
+	}
+	id.AccountID = accountID
+	return id
+}
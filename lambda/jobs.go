@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/lambda/aws"
+	"github.com/anoldguy/tse/lambda/notify"
+	"github.com/anoldguy/tse/lambda/store"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// jobStore is the subset of the state store used for async jobs
+type jobStore interface {
+	CreateJob(ctx context.Context, kind, region string) (*types.JobInfo, error)
+	FinishJob(ctx context.Context, job *types.JobInfo, result any, jobErr error) error
+	GetJob(ctx context.Context, id string) (*types.JobInfo, error)
+}
+
+// jobs records async jobs; nil when no state table is configured, in which
+// case requests for one are refused and callers fall back to waiting
+var jobs jobStore
+
+// Kinds of job
+const (
+	jobKindCleanup = "cleanup"
+	jobKindStart   = "start"
+	jobKindStop    = "stop"
+)
+
+// jobStaleAfter is how long a job may report running. The invocation carrying
+// it out is killed at the Lambda's timeout (at most 5 minutes), so one still
+// running after this never finished.
+const jobStaleAfter = 10 * time.Minute
+
+// jobRun is the payload of the asynchronous invocation that carries out a
+// job: the job and the request it answers. Under Step Functions orchestration
+// it's also the workflow's state, passed from step to step with the progress
+// so far.
+type jobRun struct {
+	Job     *types.JobInfo        `json:"tse_job"`
+	Cleanup *types.CleanupRequest `json:"cleanup,omitempty"`
+	Start   *types.StartRequest   `json:"start,omitempty"`
+	Stop    *types.StopRequest    `json:"stop,omitempty"`
+	Caller  *types.TokenInfo      `json:"caller,omitempty"` // Who asked for a start, to attribute the node to
+
+	Started *types.StartResponse `json:"started,omitempty"` // The node a start launched
+	Stopped *types.StopResponse  `json:"stopped,omitempty"` // What a stop or cleanup removed
+	Phase   string               `json:"phase,omitempty"`   // A started node's readiness: waiting or ready
+	Checks  int                  `json:"checks,omitempty"`  // Readiness checks so far
+	Error   *workflowError       `json:"error,omitempty"`   // Why a workflow step failed, from its Catch
+}
+
+// result is what the job reports once it succeeds
+func (r jobRun) result() any {
+	if r.Started != nil {
+		return r.Started
+	}
+	if r.Stopped != nil {
+		return r.Stopped
+	}
+	return nil
+}
+
+// dispatchJob hands a job's payload to a new invocation, or to the state
+// machine under Step Functions orchestration; tests replace it
+var dispatchJob = func(ctx context.Context, id string, payload []byte) error {
+	if stepFunctionsOrchestration() {
+		return startWorkflow(ctx, id, payload)
+	}
+	return aws.InvokeSelf(ctx, payload)
+}
+
+// parseJobRun reports whether payload is a job's invocation
+func parseJobRun(payload json.RawMessage) (jobRun, bool) {
+	var run jobRun
+	if err := json.Unmarshal(payload, &run); err != nil || run.Job == nil {
+		return jobRun{}, false
+	}
+	return run, true
+}
+
+// startJob records a job and has a new invocation of the Lambda (or the
+// workflow) carry it out, answering 202 with the job for the caller to poll at GET /jobs/{id}
+func startJob(ctx context.Context, kind, friendlyRegion string, run jobRun) events.LambdaFunctionURLResponse {
+	if jobs == nil {
+		return errorResponse(http.StatusNotImplemented, "Async jobs require the state table (redeploy with 'tse deploy')")
+	}
+
+	job, err := jobs.CreateJob(ctx, kind, friendlyRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to start job", err)
+	}
+	run.Job = job
+
+	payload, err := json.Marshal(run)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to encode job: %v", err))
+	}
+	if err := dispatchJob(ctx, job.ID, payload); err != nil {
+		log.Printf("Failed to dispatch job %s: %v", job.ID, err)
+		if err := jobs.FinishJob(context.WithoutCancel(ctx), job, nil, err); err != nil {
+			log.Printf("Failed to record job %s as failed: %v", job.ID, err)
+		}
+		return awsErrorResponse("Failed to start job", err)
+	}
+
+	log.Printf("Started %s job %s in %s", kind, job.ID, friendlyRegion)
+	return jsonResponse(http.StatusAccepted, types.JobResponse{
+		Success: true,
+		Message: fmt.Sprintf("Started %s in %s", kind, friendlyRegion),
+		Job:     job,
+	})
+}
+
+// runJob carries out a job in its own invocation, running the same steps the
+// workflow would, and records the outcome. Failures are recorded rather than
+// returned, so Lambda doesn't retry a cleanup that already got partway.
+func runJob(ctx context.Context, run jobRun) {
+	if jobs == nil {
+		log.Printf("Dropping job %s: no state table to record it in", run.Job.ID)
+		return
+	}
+
+	work, cancel := withHandlerDeadline(ctx)
+	defer cancel()
+
+	var err error
+	switch {
+	case run.Job.Kind == jobKindCleanup && run.Cleanup != nil:
+		run, err = runStep(work, stepCleanup, run)
+	case run.Job.Kind == jobKindStart && run.Start != nil:
+		run, err = runStartSteps(work, run)
+	case run.Job.Kind == jobKindStop && run.Stop != nil:
+		run, err = runStopSteps(work, run)
+	default:
+		err = fmt.Errorf("unknown job kind %q", run.Job.Kind)
+	}
+	if err != nil {
+		log.Printf("Job %s failed: %v", run.Job.ID, err)
+		if ranOutOfTime(work) {
+			err = fmt.Errorf("%w (the Lambda ran short of its timeout)", err)
+		}
+	}
+
+	finishJob(ctx, run, err)
+}
+
+// finishJob records a job's outcome, and tells the webhooks about a started
+// node that never became ready
+func finishJob(ctx context.Context, run jobRun, jobErr error) {
+	if jobErr != nil && run.Started != nil && run.Started.Instance != nil {
+		notifier.Notify(ctx, notify.Event{
+			Type:        notify.EventNodeFailed,
+			Region:      run.Job.Region,
+			InstanceIDs: []string{run.Started.Instance.InstanceID},
+			Message:     fmt.Sprintf("Exit node in %s failed to become ready: %v", run.Job.Region, jobErr),
+		})
+	}
+
+	var result any
+	if jobErr == nil {
+		result = run.result()
+	}
+	if err := jobs.FinishJob(ctx, run.Job, result, jobErr); err != nil {
+		log.Printf("Failed to record the outcome of job %s: %v", run.Job.ID, err)
+	}
+}
+
+// handleGetJob reports a job's progress, and its result once it's done
+func handleGetJob(ctx context.Context, id string) (events.LambdaFunctionURLResponse, error) {
+	if jobs == nil {
+		return errorResponse(http.StatusNotImplemented, "Async jobs require the state table (redeploy with 'tse deploy')"), nil
+	}
+
+	job, err := jobs.GetJob(ctx, id)
+	if errors.Is(err, store.ErrJobNotFound) {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("No job %s (finished jobs are kept for %s)", id, store.JobRetention)), nil
+	}
+	if err != nil {
+		return awsErrorResponse("Failed to look up job", err), nil
+	}
+
+	if !job.Done() && time.Since(job.CreatedAt) > jobStaleAfter {
+		job.Status = types.JobFailed
+		job.Error = "the Lambda stopped before finishing the job; check its logs"
+	}
+
+	return jsonResponse(http.StatusOK, types.JobResponse{
+		Success: true,
+		Message: fmt.Sprintf("Job %s is %s", job.ID, job.Status),
+		Job:     job,
+	}), nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anoldguy/tse/lambda/store"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// fakeJobs is an in-memory jobStore keyed by job ID
+type fakeJobs map[string]*types.JobInfo
+
+func (f fakeJobs) CreateJob(ctx context.Context, kind, region string) (*types.JobInfo, error) {
+	job := &types.JobInfo{ID: fmt.Sprintf("job-%d", len(f)+1), Kind: kind, Region: region, Status: types.JobRunning, CreatedAt: time.Now()}
+	f[job.ID] = job
+	return job, nil
+}
+
+func (f fakeJobs) FinishJob(ctx context.Context, job *types.JobInfo, result any, jobErr error) error {
+	job.Status = types.JobSucceeded
+	if jobErr != nil {
+		job.Status, job.Error = types.JobFailed, jobErr.Error()
+	}
+	f[job.ID] = job
+	return nil
+}
+
+func (f fakeJobs) GetJob(ctx context.Context, id string) (*types.JobInfo, error) {
+	job, ok := f[id]
+	if !ok {
+		return nil, store.ErrJobNotFound
+	}
+	copied := *job
+	return &copied, nil
+}
+
+func TestStartJob(t *testing.T) {
+	ctx := context.Background()
+	req := types.CleanupRequest{Force: true, Async: true}
+
+	if resp := startJob(ctx, jobKindCleanup, "ohio", jobRun{Cleanup: &req}); resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("startJob() without a store: status = %d, want 501", resp.StatusCode)
+	}
+
+	fake := fakeJobs{}
+	jobs = fake
+	defer func() { jobs = nil }()
+
+	var dispatched []byte
+	var dispatchedID string
+	defer func(saved func(context.Context, string, []byte) error) { dispatchJob = saved }(dispatchJob)
+	dispatchJob = func(ctx context.Context, id string, payload []byte) error {
+		dispatchedID, dispatched = id, payload
+		return nil
+	}
+
+	resp := startJob(ctx, jobKindCleanup, "ohio", jobRun{Cleanup: &req})
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("startJob() status = %d, want 202: %s", resp.StatusCode, resp.Body)
+	}
+	var started types.JobResponse
+	if err := json.Unmarshal([]byte(resp.Body), &started); err != nil || started.Job == nil || started.Job.Status != types.JobRunning {
+		t.Fatalf("startJob() = %s (%v), want a running job", resp.Body, err)
+	}
+
+	// The new invocation gets the job and the request it's for
+	run, ok := parseJobRun(dispatched)
+	if !ok || run.Job.ID != started.Job.ID || run.Cleanup == nil || !run.Cleanup.Force {
+		t.Errorf("dispatched %s, want job %s with the forced cleanup", dispatched, started.Job.ID)
+	}
+	if dispatchedID != started.Job.ID {
+		t.Errorf("dispatched as %q, want the job ID %s", dispatchedID, started.Job.ID)
+	}
+
+	dispatchJob = func(ctx context.Context, id string, payload []byte) error { return errors.New("AccessDeniedException") }
+	if resp := startJob(ctx, jobKindCleanup, "tokyo", jobRun{Cleanup: &req}); resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("startJob() with a failed dispatch: status = %d, want 500", resp.StatusCode)
+	}
+	if job := fake["job-2"]; job == nil || job.Status != types.JobFailed {
+		t.Errorf("undispatched job = %+v, want it recorded as failed", job)
+	}
+}
+
+func TestParseJobRun(t *testing.T) {
+	if _, ok := parseJobRun(json.RawMessage(`{"rawPath":"/ohio/cleanup","body":"{}"}`)); ok {
+		t.Error("parseJobRun() took a Function URL request for a job")
+	}
+	if _, ok := parseJobRun(json.RawMessage(`{"tse_warm":true}`)); ok {
+		t.Error("parseJobRun() took a warm ping for a job")
+	}
+	run, ok := parseJobRun(json.RawMessage(`{"tse_job":{"id":"job-1","kind":"cleanup","region":"ohio"},"cleanup":{"dry_run":true}}`))
+	if !ok || run.Job.ID != "job-1" || !run.Cleanup.DryRun {
+		t.Errorf("parseJobRun() = %+v, %v", run, ok)
+	}
+}
+
+func TestRunJobRecordsFailure(t *testing.T) {
+	fake := fakeJobs{}
+	jobs = fake
+	defer func() { jobs = nil }()
+
+	job, _ := fake.CreateJob(context.Background(), "bake", "ohio")
+	runJob(context.Background(), jobRun{Job: job})
+	if got := fake[job.ID]; got.Status != types.JobFailed || !strings.Contains(got.Error, "unknown job kind") {
+		t.Errorf("job = %+v, want it failed as an unknown kind", got)
+	}
+}
+
+func TestHandleGetJob(t *testing.T) {
+	ctx := context.Background()
+	fake := fakeJobs{
+		"job-fresh": {ID: "job-fresh", Status: types.JobRunning, CreatedAt: time.Now()},
+		"job-stale": {ID: "job-stale", Status: types.JobRunning, CreatedAt: time.Now().Add(-time.Hour)},
+	}
+	jobs = fake
+	defer func() { jobs = nil }()
+
+	status := func(id string) (int, *types.JobInfo) {
+		resp, _ := handleGetJob(ctx, id)
+		var decoded types.JobResponse
+		json.Unmarshal([]byte(resp.Body), &decoded)
+		return resp.StatusCode, decoded.Job
+	}
+
+	if code, job := status("job-fresh"); code != http.StatusOK || job.Status != types.JobRunning {
+		t.Errorf("GET fresh job = %d %+v, want running", code, job)
+	}
+	// A job whose invocation was killed never finishes; say so instead of running forever
+	if code, job := status("job-stale"); code != http.StatusOK || job.Status != types.JobFailed {
+		t.Errorf("GET stale job = %d %+v, want failed", code, job)
+	}
+	if code, _ := status("job-missing"); code != http.StatusNotFound {
+		t.Errorf("GET missing job = %d, want 404", code)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/anoldguy/tse/lambda/aws"
+	"github.com/anoldguy/tse/shared/tailscale"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// envTailscaleAPIToken is an optional Tailscale API token (devices write scope)
+// the Lambda uses to turn off key expiry on new exit nodes
+const envTailscaleAPIToken = "TSE_TAILSCALE_API_TOKEN"
+
+// disableKeyExpiry turns off Tailscale key expiry for nodes that have reported
+// ready, so long-lived nodes don't drop off the tailnet when their key expires.
+// Each node is tagged once it's done; a node whose device can't be found or
+// updated is logged and tried again on the next sweep. Does nothing without a
+// Tailscale API token.
+func disableKeyExpiry(ctx context.Context, service *aws.Service, friendlyRegion string) {
+	token := os.Getenv(envTailscaleAPIToken)
+	if token == "" {
+		return
+	}
+
+	pending, err := service.KeyExpiryPending(ctx)
+	if err != nil {
+		log.Printf("Failed to check %s for nodes with key expiry on: %v", friendlyRegion, err)
+		return
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	client, err := tailscale.NewClient(token)
+	if err != nil {
+		log.Printf("Failed to create Tailscale API client: %v", err)
+		return
+	}
+	client.SetTailnet("-") // The token's own tailnet
+	devices, err := client.ListDevices(ctx)
+	if err != nil {
+		log.Printf("Failed to list tailnet devices to disable key expiry in %s: %v", friendlyRegion, err)
+		return
+	}
+
+	for _, instance := range pending {
+		device, ok := nodeDevice(devices, instance)
+		if !ok {
+			log.Printf("No tailnet device found for %s (%s); key expiry left on", instance.InstanceID, instance.TailscaleHostname)
+			continue
+		}
+		if err := client.DisableKeyExpiry(ctx, device.ID); err != nil {
+			log.Printf("Failed to disable key expiry for %s: %v", instance.InstanceID, err)
+			continue
+		}
+		if err := service.MarkKeyExpiryDisabled(ctx, instance.InstanceID); err != nil {
+			log.Printf("Disabled key expiry for %s but couldn't record it: %v", instance.InstanceID, err)
+			continue
+		}
+		log.Printf("Disabled key expiry for %s (%s)", instance.InstanceID, device.ShortName())
+	}
+}
+
+// nodeDevice finds an exit node's tailnet device by the IPv4 address the node
+// reported, falling back to its hostname for nodes that reported none
+func nodeDevice(devices []tailscale.Device, instance *types.InstanceInfo) (tailscale.Device, bool) {
+	for _, device := range devices {
+		ipv4, _ := device.TailnetIPs()
+		if instance.TailscaleIP != "" && ipv4 == instance.TailscaleIP {
+			return device, true
+		}
+		if instance.TailscaleIP == "" && device.ShortName() == instance.TailscaleHostname {
+			return device, true
+		}
+	}
+	return tailscale.Device{}, false
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/anoldguy/tse/shared/tailscale"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func TestNodeDevice(t *testing.T) {
+	devices := []tailscale.Device{
+		{ID: "stale", Name: "exit-ohio.tail1234.ts.net", Addresses: []string{"100.64.0.1"}},
+		{ID: "new", Name: "exit-ohio-1.tail1234.ts.net", Addresses: []string{"100.64.0.2", "fd7a:115c:a1e0::2"}},
+	}
+
+	tests := []struct {
+		name     string
+		instance types.InstanceInfo
+		want     string
+	}{
+		{"by tailnet IP", types.InstanceInfo{TailscaleIP: "100.64.0.2", TailscaleHostname: "exit-ohio"}, "new"},
+		{"by hostname without an IP", types.InstanceInfo{TailscaleHostname: "exit-ohio-1"}, "new"},
+		{"IP not on the tailnet", types.InstanceInfo{TailscaleIP: "100.64.0.9", TailscaleHostname: "exit-ohio"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device, ok := nodeDevice(devices, &tt.instance)
+			if ok != (tt.want != "") || device.ID != tt.want {
+				t.Errorf("nodeDevice() = %q, %v; want %q", device.ID, ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anoldguy/tse/lambda/aws"
+	"github.com/anoldguy/tse/lambda/notify"
+	"github.com/anoldguy/tse/shared/regions"
+)
+
+// notifier posts lifecycle events to TSE_WEBHOOKS; nil (a no-op) when none are configured
+var notifier *notify.Notifier
+
+// registrationTimeout is how long a running node may go without tagging itself
+// ready before it's reported as failed
+const registrationTimeout = 10 * time.Minute
+
+// tendNodes runs the sweep's upkeep in each region with exit nodes: reporting
+// nodes that never became ready or that tse would never have launched, and
+// turning off key expiry on the rest. A region that fails is logged and skipped.
+func tendNodes(ctx context.Context, friendlyRegions []string) {
+	for _, friendlyRegion := range friendlyRegions {
+		awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+		if err != nil {
+			continue
+		}
+		service, err := aws.New(ctx, awsRegion)
+		if err != nil {
+			log.Printf("Failed to tend exit nodes in %s: %v", friendlyRegion, err)
+			continue
+		}
+		notifyStalledNodes(ctx, service, friendlyRegion)
+		notifyAnomalousNodes(ctx, service, friendlyRegion)
+		disableKeyExpiry(ctx, service, friendlyRegion)
+	}
+}
+
+// notifyStalledNodes reports nodes that never became ready. Only meaningful when
+// nodes launch with an instance profile; without one they can never report ready.
+func notifyStalledNodes(ctx context.Context, service *aws.Service, friendlyRegion string) {
+	if notifier == nil || os.Getenv("TSE_INSTANCE_PROFILE") == "" {
+		return
+	}
+
+	stalled, err := service.ClaimStalledInstances(ctx, registrationTimeout)
+	if err != nil {
+		log.Printf("Failed to check for stalled nodes in %s: %v", friendlyRegion, err)
+		return
+	}
+
+	for _, instance := range stalled {
+		notifier.Notify(ctx, notify.Event{
+			Type:        notify.EventNodeFailed,
+			Region:      friendlyRegion,
+			InstanceIDs: []string{instance.InstanceID},
+			Message:     fmt.Sprintf("Exit node in %s has not reported ready after %s (check Tailscale and the instance console log)", friendlyRegion, registrationTimeout),
+		})
+	}
+}
+
+// notifyAnomalousNodes reports nodes tse would never have launched (see
+// aws.Service.CheckTripwires), logging every anomaly and notifying once per
+// node. Listings show anomalies too, but only the sweep tags and notifies, so
+// reading never writes.
+func notifyAnomalousNodes(ctx context.Context, service *aws.Service, friendlyRegion string) {
+	anomalies, err := service.CheckTripwires(ctx)
+	if err != nil {
+		log.Printf("Failed to check %s for unexpected instances: %v", friendlyRegion, err)
+		return
+	}
+
+	details := map[string][]string{}
+	var instanceIDs []string
+	for _, anomaly := range anomalies {
+		log.Printf("SECURITY: unexpected exit node %s in %s: %s (%s)", anomaly.InstanceID, friendlyRegion, anomaly.Detail, anomaly.Resource)
+		if _, seen := details[anomaly.InstanceID]; !seen {
+			instanceIDs = append(instanceIDs, anomaly.InstanceID)
+		}
+		details[anomaly.InstanceID] = append(details[anomaly.InstanceID], anomaly.Detail)
+	}
+	if notifier == nil || len(instanceIDs) == 0 {
+		return
+	}
+
+	claimed, err := service.ClaimAnomalousInstances(ctx, instanceIDs)
+	if err != nil {
+		log.Printf("Failed to claim unexpected nodes in %s: %v", friendlyRegion, err)
+		return
+	}
+	for _, instanceID := range claimed {
+		notifier.Notify(ctx, notify.Event{
+			Type:        notify.EventNodeAnomaly,
+			Region:      friendlyRegion,
+			InstanceIDs: []string{instanceID},
+			Message:     fmt.Sprintf("SECURITY: exit node in %s isn't one tse would launch: %s. Check for tampering, then stop it.", friendlyRegion, strings.Join(details[instanceID], "; ")),
+		})
+	}
+}
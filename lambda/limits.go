@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/lambda/store"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// envMaxNodes caps how many exit nodes the deployment may have at once across
+// every region, set by 'tse deploy --max-nodes'. Unset or 0 means no cap.
+const envMaxNodes = "TSE_MAX_NODES"
+
+// maxNodesFromEnv reads the deployment's node cap, treating an invalid one as
+// no cap (deploy refuses those, so one only comes from editing the Lambda by hand)
+func maxNodesFromEnv() int {
+	raw := os.Getenv(envMaxNodes)
+	if raw == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("Ignoring %s: want a whole number of nodes, got %q", envMaxNodes, raw)
+		return 0
+	}
+	return n
+}
+
+// startLimitResponse enforces the deployment's node cap and the caller's token
+// limits on a start or restart in friendlyRegion, returning the refusal to send
+// and false if they don't allow it. Nodes in friendlyRegion itself don't count:
+// a start there finds one already running, and a restart replaces it. Paused
+// nodes count, since resuming them needs no start.
+func startLimitResponse(ctx context.Context, caller *types.TokenInfo, friendlyRegion string) (events.LambdaFunctionURLResponse, bool) {
+	var limits types.TokenLimits
+	if caller != nil {
+		limits = caller.TokenLimits
+	}
+
+	if !limits.AllowsRegion(friendlyRegion) {
+		message := fmt.Sprintf("Token %s can only start exit nodes in %s", caller.Name, strings.Join(limits.Regions, ", "))
+		return codedErrorResponse(http.StatusForbidden, types.ErrorCodeRegionNotAllowed, message), false
+	}
+	maxNodes := maxNodesFromEnv()
+	if maxNodes == 0 && limits.MaxNodes == 0 {
+		return events.LambdaFunctionURLResponse{}, true
+	}
+
+	// The deployment's cap counts every region; a token's own limit only the
+	// regions it may use
+	scan := regions.GetAllFriendlyNames()
+	if maxNodes == 0 && len(limits.Regions) > 0 {
+		scan = limits.Regions
+	}
+	nodes, err := listNodes(ctx, scan)
+	if err != nil {
+		return awsErrorResponse("Failed to count exit nodes", err), false
+	}
+	nodes = slices.DeleteFunc(nodes, func(node *types.InstanceInfo) bool { return node.FriendlyRegion == friendlyRegion })
+	if maxNodes > 0 && len(nodes) >= maxNodes {
+		log.Printf("Refusing start in %s: %d exit nodes, at the deployment's cap", friendlyRegion, len(nodes))
+		message := fmt.Sprintf("The deployment already has %d exit nodes, its cap (%s); stop one first", len(nodes), envMaxNodes)
+		return codedErrorResponse(http.StatusConflict, types.ErrorCodeNodeCap, message), false
+	}
+	if count := startedBy(nodes, caller); limits.MaxNodes > 0 && count >= limits.MaxNodes {
+		message := fmt.Sprintf("Token %s already has %d exit nodes, its limit; stop one first", caller.Name, count)
+		return codedErrorResponse(http.StatusForbidden, types.ErrorCodeNodeLimit, message), false
+	}
+	return events.LambdaFunctionURLResponse{}, true
+}
+
+// nodeCapLock is the lock starts hold while a node cap or token limit applies.
+// Region start locks don't stop two starts in different regions both counting
+// one node under the cap, so they also take this one.
+const nodeCapLock = "start#node-cap"
+
+// nodeCapWait is how long a start waits for another region's start to release
+// nodeCapLock before giving up with a 409. Launches usually finish well inside
+// it, so starts in different regions at the same moment take turns rather than
+// fail. Tests shorten it.
+var nodeCapWait = 30 * time.Second
+
+// lockNodeCap takes nodeCapLock and checks startLimitResponse again under it,
+// for a start about to launch. While another start holds the lock it retries
+// with backoff for up to nodeCapWait. The returned func releases the lock once
+// the launch is done and the node registered, so the next start counts it.
+// With no cap or limit to enforce it takes nothing.
+func lockNodeCap(ctx context.Context, caller *types.TokenInfo, friendlyRegion string) (func(), events.LambdaFunctionURLResponse, bool) {
+	if maxNodesFromEnv() == 0 && (caller == nil || caller.MaxNodes == 0) {
+		return func() {}, events.LambdaFunctionURLResponse{}, true
+	}
+
+	release, err := acquireNodeCapLock(ctx)
+	if errors.Is(err, store.ErrLockHeld) {
+		return nil, codedErrorResponse(http.StatusConflict, types.ErrorCodeStartInProgress, "Another start is counting exit nodes against the cap; try again in a moment"), false
+	}
+	if err != nil {
+		return nil, awsErrorResponse("Failed to lock the node cap", err), false
+	}
+	if response, ok := startLimitResponse(ctx, caller, friendlyRegion); !ok {
+		release()
+		return nil, response, false
+	}
+	return release, events.LambdaFunctionURLResponse{}, true
+}
+
+// acquireNodeCapLock takes nodeCapLock, retrying while it's held: every 250ms
+// at first, backing off to every 2s, until nodeCapWait runs out or ctx ends.
+// It returns store.ErrLockHeld if the lock never came free.
+func acquireNodeCapLock(ctx context.Context) (func(), error) {
+	giveUp := time.Now().Add(nodeCapWait)
+	backoff := 250 * time.Millisecond
+	for {
+		release, err := acquireLock(ctx, nodeCapLock)
+		if !errors.Is(err, store.ErrLockHeld) {
+			return release, err
+		}
+		if time.Now().Add(backoff).After(giveUp) {
+			return nil, err
+		}
+		log.Printf("Waiting %s for another start to release %s", backoff, nodeCapLock)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 2*time.Second)
+	}
+}
+
+// listNodes lists the deployment's exit nodes in the given regions: from the
+// node registry while it's fresh, otherwise by asking every AWS region at once
+// (each once, however many names map to it) and reconciling the registry with
+// the answer. Any region that fails fails the list, so a limit is never
+// checked against part of the picture. Tests replace it.
+var listNodes = func(ctx context.Context, friendlyRegions []string) ([]*types.InstanceInfo, error) {
+	if nodes, ok := registeredNodes(ctx, friendlyRegions); ok {
+		return nodes, nil
+	}
+
+	listedAt := time.Now()
+	awsRegions := awsRegionsOf(friendlyRegions)
+	found := make([][]*types.InstanceInfo, len(awsRegions))
+	errs := make([]error, len(awsRegions))
+	var wg sync.WaitGroup
+	for i, awsRegion := range awsRegions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if found[i], errs[i] = awsRegionNodes(ctx, awsRegion); errs[i] != nil {
+				errs[i] = fmt.Errorf("%s: %w", awsRegion, errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	var nodes []*types.InstanceInfo
+	for i := range awsRegions {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		nodes = append(nodes, found[i]...)
+	}
+	reconcileRegistry(ctx, listedAt, awsRegions, nodes)
+	return nodes, nil
+}
+
+// startedBy counts the instances the token started
+func startedBy(instances []*types.InstanceInfo, caller *types.TokenInfo) int {
+	if caller == nil {
+		return 0
+	}
+	count := 0
+	for _, instance := range instances {
+		if instance.StartedByID == caller.ID {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func TestStartLimitResponse(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv(envMaxNodes, "")
+	partner := &types.TokenInfo{ID: "3f9a2c1b7d4e", Name: "partner", TokenLimits: types.TokenLimits{MaxNodes: 1, Regions: []string{"ohio", "frankfurt"}}}
+
+	var asked []string
+	var nodes []*types.InstanceInfo
+	var listErr error
+	defer func(saved func(context.Context, []string) ([]*types.InstanceInfo, error)) { listNodes = saved }(listNodes)
+	listNodes = func(ctx context.Context, friendlyRegions []string) ([]*types.InstanceInfo, error) {
+		asked = friendlyRegions
+		return nodes, listErr
+	}
+	partnerNode := &types.InstanceInfo{InstanceID: "i-1", FriendlyRegion: "frankfurt", StartedByID: partner.ID}
+
+	for _, caller := range []*types.TokenInfo{nil, rootToken} {
+		if _, ok := startLimitResponse(ctx, caller, "tokyo"); !ok {
+			t.Errorf("startLimitResponse(%v) refused a token without limits", caller)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		region string
+		nodes  []*types.InstanceInfo
+		err    error
+		status int
+		code   types.ErrorCode
+	}{
+		{"allowed", "ohio", nil, nil, 0, ""},
+		{"other region", "tokyo", nil, nil, http.StatusForbidden, types.ErrorCodeRegionNotAllowed},
+		{"at its limit", "ohio", []*types.InstanceInfo{partnerNode}, nil, http.StatusForbidden, types.ErrorCodeNodeLimit},
+		{"its node is in the region", "frankfurt", []*types.InstanceInfo{partnerNode}, nil, 0, ""},
+		{"count failed", "ohio", nil, errors.New("throttled"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, listErr = tt.nodes, tt.err
+			checkLimitResponse(t, partner, tt.region, tt.status, tt.code)
+		})
+	}
+
+	// Only the token's regions are listed for its own limit
+	nodes, listErr = nil, nil
+	startLimitResponse(ctx, partner, "ohio")
+	if !slices.Equal(asked, partner.Regions) {
+		t.Errorf("listed nodes in %v, want %v", asked, partner.Regions)
+	}
+}
+
+func TestStartLimitResponseNodeCap(t *testing.T) {
+	t.Setenv(envMaxNodes, "2")
+
+	var asked []string
+	var nodes []*types.InstanceInfo
+	defer func(saved func(context.Context, []string) ([]*types.InstanceInfo, error)) { listNodes = saved }(listNodes)
+	listNodes = func(ctx context.Context, friendlyRegions []string) ([]*types.InstanceInfo, error) {
+		asked = friendlyRegions
+		return nodes, nil
+	}
+
+	nodes = []*types.InstanceInfo{{InstanceID: "i-1", FriendlyRegion: "tokyo"}}
+	checkLimitResponse(t, rootToken, "ohio", 0, "")
+	if !slices.Contains(asked, "sydney") {
+		t.Errorf("listed nodes in %v, want every region", asked)
+	}
+
+	// A paused node counts; the region's own node doesn't
+	nodes = append(nodes, &types.InstanceInfo{InstanceID: "i-2", FriendlyRegion: "sydney", State: "stopped"})
+	checkLimitResponse(t, rootToken, "ohio", http.StatusConflict, types.ErrorCodeNodeCap)
+	checkLimitResponse(t, rootToken, "tokyo", 0, "")
+
+	t.Setenv(envMaxNodes, "0")
+	checkLimitResponse(t, rootToken, "ohio", 0, "")
+	t.Setenv(envMaxNodes, "lots")
+	checkLimitResponse(t, rootToken, "ohio", 0, "")
+}
+
+// checkLimitResponse checks startLimitResponse allows a start, for status 0, or
+// refuses it with status and code
+func TestLockNodeCap(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv(envMaxNodes, "2")
+	defer func(saved func(context.Context, []string) ([]*types.InstanceInfo, error)) { listNodes = saved }(listNodes)
+	var nodes []*types.InstanceInfo
+	listNodes = func(ctx context.Context, friendlyRegions []string) ([]*types.InstanceInfo, error) {
+		return nodes, nil
+	}
+	locks := fakeLocks{}
+	startLocks = locks
+	defer func(saved time.Duration) { startLocks, nodeCapWait = nil, saved }(nodeCapWait)
+	nodeCapWait = 0
+
+	release, _, ok := lockNodeCap(ctx, rootToken, "ohio")
+	if !ok {
+		t.Fatal("lockNodeCap() refused a start under the cap")
+	}
+	// A start in another region waits for this one to register its node, and
+	// gives up with a 409 if it doesn't in time
+	if _, resp, ok := lockNodeCap(ctx, rootToken, "tokyo"); ok || resp.StatusCode != http.StatusConflict {
+		t.Errorf("concurrent start in tokyo: ok = %v, status %d; want a 409", ok, resp.StatusCode)
+	}
+	release()
+
+	// ...and then counts it
+	nodes = []*types.InstanceInfo{{InstanceID: "i-1", FriendlyRegion: "ohio"}, {InstanceID: "i-2", FriendlyRegion: "frankfurt"}}
+	if _, resp, ok := lockNodeCap(ctx, rootToken, "tokyo"); ok || resp.StatusCode != http.StatusConflict {
+		t.Errorf("start at the cap: ok = %v, status %d; want a 409", ok, resp.StatusCode)
+	}
+	if len(locks) != 0 {
+		t.Errorf("locks after a refusal = %v, want none", locks)
+	}
+
+	// Without a cap or limit there's nothing to serialize
+	t.Setenv(envMaxNodes, "")
+	release, _, ok = lockNodeCap(ctx, rootToken, "tokyo")
+	if !ok || len(locks) != 0 {
+		t.Errorf("lockNodeCap() without a cap: ok = %v, locks = %v; want ok and no lock", ok, locks)
+	}
+	release()
+}
+
+func TestLockNodeCapWaitsForTheOtherStart(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv(envMaxNodes, "2")
+	defer func(saved func(context.Context, []string) ([]*types.InstanceInfo, error)) { listNodes = saved }(listNodes)
+	listNodes = func(ctx context.Context, friendlyRegions []string) ([]*types.InstanceInfo, error) {
+		return nil, nil
+	}
+	startLocks = newMemoryLocks()
+	defer func() { startLocks = nil }()
+
+	release, _, ok := lockNodeCap(ctx, rootToken, "ohio")
+	if !ok {
+		t.Fatal("lockNodeCap() refused a start under the cap")
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		release()
+	}()
+
+	// The start in tokyo takes its turn once ohio's launch is done
+	releaseTokyo, resp, ok := lockNodeCap(ctx, rootToken, "tokyo")
+	if !ok {
+		t.Fatalf("start in tokyo after ohio released the cap = %d, want it to go ahead", resp.StatusCode)
+	}
+	releaseTokyo()
+}
+
+func checkLimitResponse(t *testing.T, caller *types.TokenInfo, region string, status int, code types.ErrorCode) {
+	t.Helper()
+	resp, ok := startLimitResponse(context.Background(), caller, region)
+	if ok != (status == 0) {
+		t.Fatalf("startLimitResponse(%s) ok = %v, want %v: %s", region, ok, status == 0, resp.Body)
+	}
+	if ok {
+		return
+	}
+	var errorResp types.ErrorResponse
+	if err := json.Unmarshal([]byte(resp.Body), &errorResp); err != nil {
+		t.Fatalf("invalid error response: %v", err)
+	}
+	if resp.StatusCode != status || (code != "" && errorResp.ErrorCode != code) {
+		t.Errorf("startLimitResponse(%s) = %d %s, want %d %s", region, resp.StatusCode, errorResp.ErrorCode, status, code)
+	}
+}
+
+func TestStartedBy(t *testing.T) {
+	caller := &types.TokenInfo{ID: "3f9a2c1b7d4e"}
+	instances := []*types.InstanceInfo{
+		{InstanceID: "i-1", StartedByID: "3f9a2c1b7d4e"},
+		{InstanceID: "i-2", StartedByID: "root"},
+		{InstanceID: "i-3"},
+	}
+	if got := startedBy(instances, caller); got != 1 {
+		t.Errorf("startedBy() = %d, want 1", got)
+	}
+}
+
+func TestCreateTokenValidatesLimits(t *testing.T) {
+	defer func(saved tokenStore) { tokens = saved }(tokens)
+	tokens = fakeTokens{}
+
+	for _, body := range []string{
+		`{"name":"partner","scopes":["start"],"max_nodes":-1}`,
+		`{"name":"partner","scopes":["start"],"regions":["atlantis"]}`,
+	} {
+		if resp, _ := handleCreateToken(context.Background(), body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("create token with %s: status = %d, want 400", body, resp.StatusCode)
+		}
+	}
+
+	resp, _ := handleCreateToken(context.Background(), `{"name":"partner","scopes":["start"],"max_nodes":2,"regions":["Ohio","東京"]}`)
+	var created types.CreateTokenResponse
+	if err := json.Unmarshal([]byte(resp.Body), &created); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create token: %d %s", resp.StatusCode, resp.Body)
+	}
+	if created.Token.MaxNodes != 2 || !slices.Equal(created.Token.Regions, []string{"ohio", "tokyo"}) {
+		t.Errorf("created token limits = %+v", created.Token.TokenLimits)
+	}
+}
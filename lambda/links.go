@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const (
+	defaultLinkTTL = 24 * time.Hour
+	// maxLinkTTL is long enough for a phone shortcut set up once a quarter
+	maxLinkTTL = 90 * 24 * time.Hour
+
+	// linkPath is the route signed links point at; they authenticate with their
+	// query parameters instead of a bearer token
+	linkPath = "act"
+)
+
+// Signed links carry these query parameters
+const (
+	linkParamAction    = "a"
+	linkParamRegion    = "r"
+	linkParamExpires   = "e"
+	linkParamBy        = "by"
+	linkParamSignature = "s"
+)
+
+// signedLink is what a link's URL encodes
+type signedLink struct {
+	Action  string
+	Region  string
+	Expires time.Time
+	By      string // ID of the token that created it
+}
+
+// linkScope is the scope a token needs to create a link for an action
+func linkScope(action string) string {
+	if action == types.LinkActionStart {
+		return types.ScopeStart
+	}
+	return types.ScopeStop
+}
+
+// sign returns the link's signature, keyed by TSE_AUTH_TOKEN so rotating the
+// token invalidates every link
+func (l signedLink) sign(key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(mac, "tse-link\n%s\n%s\n%d\n%s", l.Action, l.Region, l.Expires.Unix(), l.By)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// query encodes the link and its signature as query parameters
+func (l signedLink) query(key string) url.Values {
+	q := url.Values{}
+	q.Set(linkParamAction, l.Action)
+	q.Set(linkParamRegion, l.Region)
+	q.Set(linkParamExpires, strconv.FormatInt(l.Expires.Unix(), 10))
+	q.Set(linkParamBy, l.By)
+	q.Set(linkParamSignature, l.sign(key))
+	return q
+}
+
+// parseSignedLink checks a link's query parameters against its signature and
+// expiry, returning the link they describe
+func parseSignedLink(params map[string]string, key string, now time.Time) (signedLink, error) {
+	if key == "" {
+		return signedLink{}, fmt.Errorf("TSE_AUTH_TOKEN not configured")
+	}
+	expires, err := strconv.ParseInt(params[linkParamExpires], 10, 64)
+	if err != nil {
+		return signedLink{}, fmt.Errorf("invalid link")
+	}
+	link := signedLink{
+		Action:  params[linkParamAction],
+		Region:  params[linkParamRegion],
+		Expires: time.Unix(expires, 0),
+		By:      params[linkParamBy],
+	}
+	if !hmac.Equal([]byte(params[linkParamSignature]), []byte(link.sign(key))) {
+		return signedLink{}, fmt.Errorf("invalid link signature")
+	}
+	if !now.Before(link.Expires) {
+		return signedLink{}, fmt.Errorf("link expired at %s", link.Expires.UTC().Format(time.RFC3339))
+	}
+	return link, nil
+}
+
+// validateLink checks that a link names an action and region it can perform
+func validateLink(action, region string) error {
+	switch action {
+	case types.LinkActionStart, types.LinkActionStop:
+	default:
+		return fmt.Errorf("action must be %q or %q", types.LinkActionStart, types.LinkActionStop)
+	}
+	if region == types.LinkAllRegions {
+		if action != types.LinkActionStop {
+			return fmt.Errorf("only stop links can cover %q regions", types.LinkAllRegions)
+		}
+		return nil
+	}
+	_, err := regions.GetAWSRegion(region)
+	return err
+}
+
+// handleCreateLink signs a link for an action the caller's token could perform
+// itself. Body: types.CreateLinkRequest.
+func handleCreateLink(request events.LambdaFunctionURLRequest, caller *types.TokenInfo) (events.LambdaFunctionURLResponse, error) {
+	var req types.CreateLinkRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err)), nil
+	}
+	req.Region = canonicalRegion(req.Region)
+	if err := validateLink(req.Action, req.Region); err != nil {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+	}
+	if scope := linkScope(req.Action); !caller.HasScope(scope) {
+		return errorResponse(http.StatusForbidden, fmt.Sprintf("Forbidden: token lacks %q scope", scope)), nil
+	}
+
+	ttl := defaultLinkTTL
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 || d > maxLinkTTL {
+			return errorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid ttl %q: use a duration up to %s", req.TTL, maxLinkTTL)), nil
+		}
+		ttl = d
+	}
+
+	link := signedLink{
+		Action:  req.Action,
+		Region:  req.Region,
+		Expires: time.Now().Add(ttl).Truncate(time.Second),
+		By:      caller.ID,
+	}
+	u := url.URL{
+		Scheme:   "https",
+		Host:     request.RequestContext.DomainName,
+		Path:     "/" + types.APIVersion + "/" + linkPath,
+		RawQuery: link.query(os.Getenv("TSE_AUTH_TOKEN")).Encode(),
+	}
+
+	log.Printf("Token %s created a %s link for %s, expiring %s", caller.ID, link.Action, link.Region, link.Expires.UTC().Format(time.RFC3339))
+	response := types.CreateLinkResponse{
+		Success:   true,
+		Message:   fmt.Sprintf("Link to %s %s, valid for %s", link.Action, link.Region, ttl),
+		URL:       u.String(),
+		ExpiresAt: link.Expires.UTC(),
+	}
+	return jsonResponse(http.StatusCreated, response), nil
+}
+
+// linkCreator looks up the token that created a link, refusing links from
+// tokens that have since been revoked
+func linkCreator(ctx context.Context, id string) (*types.TokenInfo, error) {
+	if id == rootToken.ID {
+		return rootToken, nil
+	}
+	if tokens == nil {
+		return nil, fmt.Errorf("link creator %s not found", id)
+	}
+	all, err := tokens.ListTokens(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errTokenLookup, err)
+	}
+	i := slices.IndexFunc(all, func(t *types.TokenInfo) bool { return t.ID == id })
+	switch {
+	case i < 0:
+		return nil, fmt.Errorf("link creator %s not found", id)
+	case all[i].Revoked():
+		return nil, fmt.Errorf("token %s has been revoked", id)
+	}
+	return all[i], nil
+}
+
+// handleLink serves a signed link. A GET (tapping it in a browser, or a link
+// preview fetching it) only shows a confirmation page; the action runs on POST,
+// from that page's button or a shortcut.
+func handleLink(ctx context.Context, request events.LambdaFunctionURLRequest, method string) events.LambdaFunctionURLResponse {
+	sourceIP := request.RequestContext.HTTP.SourceIP
+	fromBrowser := method == "GET" || strings.HasPrefix(requestHeader(request, "content-type"), "application/x-www-form-urlencoded")
+
+	link, err := parseSignedLink(request.QueryStringParameters, os.Getenv("TSE_AUTH_TOKEN"), time.Now())
+	var caller *types.TokenInfo
+	if err == nil {
+		caller, err = linkCreator(ctx, link.By)
+	}
+	if errors.Is(err, errTokenLookup) {
+		log.Printf("Token lookup failed for link from %s: %v", sourceIP, err)
+		return linkResponse(fromBrowser, errorResponse(http.StatusInternalServerError, "Failed to verify link"))
+	}
+	if err != nil {
+		log.Printf("Rejected link from %s: %v", sourceIP, err)
+		limiter.RecordFailure(sourceIP)
+		response := errorResponse(http.StatusUnauthorized, fmt.Sprintf("Unauthorized: %v", err))
+		recordAudit(ctx, request, nil, "link", []string{link.Region, link.Action}, response)
+		return linkResponse(fromBrowser, response)
+	}
+	limiter.RecordSuccess(sourceIP)
+
+	if method == "GET" {
+		return confirmLinkPage(link)
+	}
+	if method != "POST" {
+		return errorResponse(http.StatusMethodNotAllowed, "Signed links take GET or POST")
+	}
+
+	// Links signed before names were canonicalized may carry another spelling
+	link.Region = canonicalRegion(link.Region)
+
+	var response events.LambdaFunctionURLResponse
+	switch {
+	case link.Action == types.LinkActionStart:
+		response, _ = withRegionMutation(ctx, link.Region, "start", func() (events.LambdaFunctionURLResponse, error) {
+			return handleStartInstance(ctx, caller, link.Region, "")
+		})
+	case link.Region == types.LinkAllRegions:
+		response = stopAllRegions(ctx)
+	default:
+		response, _ = withRegionMutation(ctx, link.Region, "stop", func() (events.LambdaFunctionURLResponse, error) {
+			return handleStopInstances(ctx, link.Region, "")
+		})
+	}
+	recordAudit(ctx, request, &types.TokenInfo{ID: caller.ID, Name: caller.Name + " (link)"}, link.Action, []string{link.Region, link.Action}, response)
+	return linkResponse(fromBrowser, response)
+}
+
+// inAllRegions calls a region handler for every region concurrently, returning
+// the responses in the order of friendlyRegions
+func inAllRegions(ctx context.Context, friendlyRegions []string, handle func(ctx context.Context, friendlyRegion string) (events.LambdaFunctionURLResponse, error)) []events.LambdaFunctionURLResponse {
+	results := make([]events.LambdaFunctionURLResponse, len(friendlyRegions))
+	var wg sync.WaitGroup
+	for i, friendlyRegion := range friendlyRegions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = handle(ctx, friendlyRegion)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// stopAllRegions stops exit nodes in every region concurrently, like tse
+// shutdown: each region the node registry has nodes in, or every region when
+// there's no registry to trust
+func stopAllRegions(ctx context.Context) events.LambdaFunctionURLResponse {
+	friendlyRegions := occupiedRegions(ctx, regions.GetAllFriendlyNames())
+	results := inAllRegions(ctx, friendlyRegions, func(ctx context.Context, friendlyRegion string) (events.LambdaFunctionURLResponse, error) {
+		return withRegionMutation(ctx, friendlyRegion, "stop", func() (events.LambdaFunctionURLResponse, error) {
+			return handleStopInstances(ctx, friendlyRegion, "")
+		})
+	})
+
+	total := types.StopResponse{Success: true}
+	var failed []string
+	for i, result := range results {
+		var stopped types.StopResponse
+		if result.StatusCode != http.StatusOK || json.Unmarshal([]byte(result.Body), &stopped) != nil {
+			failed = append(failed, friendlyRegions[i])
+			continue
+		}
+		total.TerminatedCount += stopped.TerminatedCount
+		total.TerminatedIDs = append(total.TerminatedIDs, stopped.TerminatedIDs...)
+		total.NetworkOutBytes += stopped.NetworkOutBytes
+	}
+	total.Message = fmt.Sprintf("Terminated %d instances across %d regions", total.TerminatedCount, len(friendlyRegions))
+	if len(failed) > 0 {
+		total.Success = false
+		total.Message += fmt.Sprintf(" (failed in %s)", strings.Join(failed, ", "))
+	}
+	return jsonResponse(http.StatusOK, total)
+}
+
+// linkPageSecurityPolicy lets the link pages style themselves and post their
+// form back to the Lambda, and nothing else
+const linkPageSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'; base-uri 'none'"
+
+var linkPage = template.Must(template.New("link").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="referrer" content="no-referrer">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; margin: 2rem auto; max-width: 28rem; padding: 0 1rem; text-align: center; }
+button { font: inherit; font-size: 1.3rem; padding: 0.8rem 2rem; width: 100%; }
+p { color: #888; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Confirm}}<form method="post"><button type="submit">{{.Confirm}}</button></form>{{end}}
+<p>{{.Detail}}</p>
+</body>
+</html>
+`))
+
+// renderLinkPage renders a link page with the given status
+func renderLinkPage(status int, title, confirm, detail string) events.LambdaFunctionURLResponse {
+	var body strings.Builder
+	if err := linkPage.Execute(&body, map[string]string{"Title": title, "Confirm": confirm, "Detail": detail}); err != nil {
+		log.Printf("Error rendering link page: %v", err)
+		return errorResponse(http.StatusInternalServerError, "Internal server error")
+	}
+	return events.LambdaFunctionURLResponse{
+		StatusCode: status,
+		Headers: map[string]string{
+			"Content-Type":            "text/html; charset=utf-8",
+			"Content-Security-Policy": linkPageSecurityPolicy,
+			"Cache-Control":           "no-store",
+			"Referrer-Policy":         "no-referrer",
+		},
+		Body: body.String(),
+	}
+}
+
+// confirmLinkPage asks before running a link's action
+func confirmLinkPage(link signedLink) events.LambdaFunctionURLResponse {
+	title := fmt.Sprintf("%s the exit node in %s?", strings.ToUpper(link.Action[:1])+link.Action[1:], link.Region)
+	confirm := strings.ToUpper(link.Action[:1]) + link.Action[1:]
+	if link.Region == types.LinkAllRegions {
+		title, confirm = "Stop exit nodes in every region?", "Stop everything"
+	}
+	return renderLinkPage(http.StatusOK, title, confirm, "This link works until "+link.Expires.UTC().Format("2 Jan 2006 15:04 MST")+".")
+}
+
+// linkResponse returns an API response as is, or as a page for a browser
+func linkResponse(fromBrowser bool, response events.LambdaFunctionURLResponse) events.LambdaFunctionURLResponse {
+	if !fromBrowser {
+		return response
+	}
+	if response.StatusCode >= 400 {
+		return renderLinkPage(response.StatusCode, "That didn't work", "", responseMessage(response))
+	}
+	return renderLinkPage(response.StatusCode, "Done", "", responseMessage(response))
+}
+
+// responseMessage returns the message of a JSON response, or its error if it failed
+func responseMessage(response events.LambdaFunctionURLResponse) string {
+	var result struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(response.Body), &result); err != nil {
+		return http.StatusText(response.StatusCode)
+	}
+	if result.Error != "" {
+		return result.Error
+	}
+	return result.Message
+}
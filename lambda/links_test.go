@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func TestParseSignedLink(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	link := signedLink{Action: types.LinkActionStop, Region: types.LinkAllRegions, Expires: now.Add(time.Hour), By: "root"}
+	params := func(mutate func(url.Values)) map[string]string {
+		q := link.query("key")
+		if mutate != nil {
+			mutate(q)
+		}
+		flat := map[string]string{}
+		for k := range q {
+			flat[k] = q.Get(k)
+		}
+		return flat
+	}
+
+	tests := []struct {
+		name    string
+		params  map[string]string
+		key     string
+		now     time.Time
+		wantErr string
+	}{
+		{name: "valid", params: params(nil), key: "key", now: now},
+		{name: "other region", params: params(func(q url.Values) { q.Set(linkParamRegion, "ohio") }), key: "key", now: now, wantErr: "signature"},
+		{name: "later expiry", params: params(func(q url.Values) { q.Set(linkParamExpires, "1900000000") }), key: "key", now: now, wantErr: "signature"},
+		{name: "rotated auth token", params: params(nil), key: "new-key", now: now, wantErr: "signature"},
+		{name: "expired", params: params(nil), key: "key", now: now.Add(2 * time.Hour), wantErr: "expired"},
+		{name: "no key", params: params(nil), now: now, wantErr: "not configured"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSignedLink(tt.params, tt.key, tt.now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseSignedLink() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSignedLink() error = %v", err)
+			}
+			if got != link {
+				t.Errorf("parseSignedLink() = %+v, want %+v", got, link)
+			}
+		})
+	}
+}
+
+func TestHandleCreateLink(t *testing.T) {
+	t.Setenv("TSE_AUTH_TOKEN", "root-token")
+	stopOnly := &types.TokenInfo{ID: "phone", Scopes: []string{types.ScopeStop}}
+
+	create := func(caller *types.TokenInfo, req types.CreateLinkRequest) events.LambdaFunctionURLResponse {
+		body, _ := json.Marshal(req)
+		request := events.LambdaFunctionURLRequest{Body: string(body)}
+		request.RequestContext.DomainName = "abc.lambda-url.us-east-2.on.aws"
+		resp, _ := handleCreateLink(request, caller)
+		return resp
+	}
+
+	tests := []struct {
+		name   string
+		caller *types.TokenInfo
+		req    types.CreateLinkRequest
+		want   int
+	}{
+		{name: "stop everywhere", caller: stopOnly, req: types.CreateLinkRequest{Action: "stop", Region: "all", TTL: "720h"}, want: http.StatusCreated},
+		{name: "start without scope", caller: stopOnly, req: types.CreateLinkRequest{Action: "start", Region: "ohio"}, want: http.StatusForbidden},
+		{name: "start everywhere", caller: rootToken, req: types.CreateLinkRequest{Action: "start", Region: "all"}, want: http.StatusBadRequest},
+		{name: "unknown region", caller: rootToken, req: types.CreateLinkRequest{Action: "stop", Region: "atlantis"}, want: http.StatusBadRequest},
+		{name: "unknown action", caller: rootToken, req: types.CreateLinkRequest{Action: "cleanup", Region: "ohio"}, want: http.StatusBadRequest},
+		{name: "ttl too long", caller: rootToken, req: types.CreateLinkRequest{Action: "stop", Region: "ohio", TTL: "9000h"}, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := create(tt.caller, tt.req); resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d (%s)", resp.StatusCode, tt.want, resp.Body)
+			}
+		})
+	}
+
+	resp := create(stopOnly, types.CreateLinkRequest{Action: "stop", Region: "ohio"})
+	var created types.CreateLinkResponse
+	if err := json.Unmarshal([]byte(resp.Body), &created); err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(created.URL)
+	if err != nil || u.Host != "abc.lambda-url.us-east-2.on.aws" || u.Path != "/v1/act" {
+		t.Fatalf("link URL = %s, want https://abc.lambda-url.us-east-2.on.aws/v1/act?...", created.URL)
+	}
+	params := map[string]string{}
+	for k := range u.Query() {
+		params[k] = u.Query().Get(k)
+	}
+	link, err := parseSignedLink(params, "root-token", time.Now())
+	if err != nil || link.By != "phone" || !link.Expires.Equal(created.ExpiresAt) {
+		t.Errorf("parseSignedLink(created link) = %+v, %v", link, err)
+	}
+}
+
+func TestHandlerSignedLinks(t *testing.T) {
+	t.Setenv("TSE_AUTH_TOKEN", "root-token")
+	tokens = fakeTokens{
+		"tse_phone": {ID: "phone", Name: "phone", Scopes: []string{types.ScopeStop}, RevokedAt: time.Now()},
+	}
+	defer func() { tokens = nil }()
+
+	request := func(method string, link signedLink) events.LambdaFunctionURLResponse {
+		req := events.LambdaFunctionURLRequest{RawPath: "/v1/act", QueryStringParameters: map[string]string{}}
+		for k, v := range link.query("root-token") {
+			req.QueryStringParameters[k] = v[0]
+		}
+		req.RequestContext.HTTP.Method = method
+		req.RequestContext.HTTP.SourceIP = "198.51.100.40"
+		resp, _ := handler(context.Background(), req)
+		return resp
+	}
+
+	stop := signedLink{Action: types.LinkActionStop, Region: "ohio", Expires: time.Now().Add(time.Hour), By: "root"}
+	resp := request("GET", stop)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Body, `<form method="post">`) {
+		t.Errorf("GET = %d %q, want a confirmation page", resp.StatusCode, resp.Body)
+	}
+
+	// Revoking the token that made a link disables the link
+	revoked := stop
+	revoked.By = "phone"
+	if resp := request("POST", revoked); resp.StatusCode != http.StatusUnauthorized || !strings.Contains(resp.Body, "revoked") {
+		t.Errorf("POST with revoked creator = %d %q, want 401", resp.StatusCode, resp.Body)
+	}
+
+	if resp := request("GET", signedLink{Action: "stop", Region: "ohio", Expires: time.Now().Add(-time.Minute), By: "root"}); resp.StatusCode != http.StatusUnauthorized || !strings.Contains(resp.Headers["Content-Type"], "text/html") {
+		t.Errorf("GET expired link = %d %s, want a 401 page", resp.StatusCode, resp.Headers["Content-Type"])
+	}
+}
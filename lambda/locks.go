@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+// lockStore is the subset of the state store used to serialize starts
+type lockStore interface {
+	AcquireLock(ctx context.Context, name, owner string, ttl time.Duration) error
+	ReleaseLock(ctx context.Context, name, owner string) error
+}
+
+// startLocks serializes starts per region; nil when no state table is configured,
+// in which case two simultaneous starts can still both launch
+var startLocks lockStore
+
+// startLockMargin is how long a start lock outlives the deadline of the
+// request that took it. It covers handlerReserve, for handlers holding a
+// context trimmed by withHandlerDeadline, with room for clock skew.
+const startLockMargin = 30 * time.Second
+
+// noDeadlineLockTTL applies outside Lambda, where requests have no deadline: the
+// longest timeout deploy allows, plus the margin
+const noDeadlineLockTTL = 5*time.Minute + startLockMargin
+
+// startLockTTL is how long a start lock lasts if it's never released: until
+// the invocation's deadline plus startLockMargin, so a start killed mid-launch
+// blocks the region only briefly whatever the Lambda's configured timeout
+func startLockTTL(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return noDeadlineLockTTL
+	}
+	return time.Until(deadline) + startLockMargin
+}
+
+// acquireStartLock takes the region's start lock so only one request at a time
+// can check for a running node and launch one. It returns store.ErrLockHeld when
+// another start holds it; the returned func releases it.
+func acquireStartLock(ctx context.Context, friendlyRegion string) (func(), error) {
+	return acquireLock(ctx, "start#"+friendlyRegion)
+}
+
+// acquireLock takes the named lock for the rest of the invocation, returning
+// store.ErrLockHeld when another request holds it
+func acquireLock(ctx context.Context, name string) (func(), error) {
+	if startLocks == nil {
+		return func() {}, nil
+	}
+
+	owner := lockOwner(ctx)
+	ttl := startLockTTL(ctx)
+	if err := startLocks.AcquireLock(ctx, name, owner, ttl); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		// Release even if the request's context is done; otherwise the lock
+		// stays held until the TTL
+		if err := startLocks.ReleaseLock(context.WithoutCancel(ctx), name, owner); err != nil {
+			log.Printf("Failed to release %s: %v (expires within %s)", name, err, ttl)
+		}
+	}, nil
+}
+
+// lockOwner identifies this invocation as a lock holder: its request ID, so
+// logs line up, or a random ID outside Lambda
+func lockOwner(ctx context.Context) string {
+	if lc, ok := lambdacontext.FromContext(ctx); ok && lc.AwsRequestID != "" {
+		return lc.AwsRequestID
+	}
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/anoldguy/tse/lambda/store"
+)
+
+// fakeLocks is an in-memory lockStore mapping lock names to owners
+type fakeLocks map[string]string
+
+func (f fakeLocks) AcquireLock(ctx context.Context, name, owner string, ttl time.Duration) error {
+	if _, held := f[name]; held {
+		return store.ErrLockHeld
+	}
+	f[name] = owner
+	return nil
+}
+
+func (f fakeLocks) ReleaseLock(ctx context.Context, name, owner string) error {
+	if f[name] == owner {
+		delete(f, name)
+	}
+	return nil
+}
+
+func TestAcquireStartLock(t *testing.T) {
+	release, err := acquireStartLock(context.Background(), "ohio")
+	if err != nil {
+		t.Fatalf("acquireStartLock without a store: %v", err)
+	}
+	release()
+
+	locks := fakeLocks{}
+	startLocks = locks
+	defer func() { startLocks = nil }()
+
+	release, err = acquireStartLock(context.Background(), "ohio")
+	if err != nil {
+		t.Fatalf("acquireStartLock(): %v", err)
+	}
+	if _, err := acquireStartLock(context.Background(), "ohio"); !errors.Is(err, store.ErrLockHeld) {
+		t.Errorf("second start in ohio error = %v, want ErrLockHeld", err)
+	}
+	releaseTokyo, err := acquireStartLock(context.Background(), "tokyo")
+	if err != nil {
+		t.Errorf("start in tokyo blocked by ohio: %v", err)
+	} else {
+		releaseTokyo()
+	}
+
+	release()
+	if len(locks) != 0 {
+		t.Errorf("locks after release = %v, want none", locks)
+	}
+}
+
+func TestStartLockTTL(t *testing.T) {
+	if got := startLockTTL(context.Background()); got != noDeadlineLockTTL {
+		t.Errorf("startLockTTL() without a deadline = %v, want %v", got, noDeadlineLockTTL)
+	}
+
+	// A 300s Lambda timeout must not leave the lock expiring mid-start
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
+	defer cancel()
+	got := startLockTTL(ctx)
+	if got <= 300*time.Second || got > 300*time.Second+startLockMargin {
+		t.Errorf("startLockTTL() with 300s left = %v, want just over 300s", got)
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,12 +19,22 @@ import (
 	"github.com/aws/aws-lambda-go/lambda"
 
 	"github.com/anoldguy/tse/lambda/aws"
+	"github.com/anoldguy/tse/lambda/metrics"
+	"github.com/anoldguy/tse/lambda/notify"
+	"github.com/anoldguy/tse/lambda/ratelimit"
+	"github.com/anoldguy/tse/lambda/store"
+	"github.com/anoldguy/tse/shared/dns"
 	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/routes"
 	"github.com/anoldguy/tse/shared/types"
 )
 
 const Version = "1.0.0"
 
+// limiter throttles requests and locks out brute-force attempts per source IP.
+// It lives for the lifetime of the warm container.
+var limiter = ratelimit.New(ratelimit.DefaultConfig)
+
 // validateAuth checks the Authorization header against the expected token
 func validateAuth(request events.LambdaFunctionURLRequest) error {
 	expectedToken := os.Getenv("TSE_AUTH_TOKEN")
@@ -28,64 +42,232 @@ func validateAuth(request events.LambdaFunctionURLRequest) error {
 		return fmt.Errorf("TSE_AUTH_TOKEN not configured")
 	}
 
-	// Get Authorization header (case-insensitive lookup)
-	authHeader := ""
-	for key, value := range request.Headers {
-		if strings.ToLower(key) == "authorization" {
-			authHeader = value
-			break
-		}
-	}
-
+	authHeader := authorizationHeader(request)
 	if authHeader == "" {
 		return fmt.Errorf("missing Authorization header")
 	}
 
-	// Support "Bearer <token>" or just "<token>"
-	token := strings.TrimPrefix(authHeader, "Bearer ")
-	token = strings.TrimPrefix(token, "bearer ")
-	token = strings.TrimSpace(token)
-
 	// Use constant-time comparison to prevent timing attacks
-	if subtle.ConstantTimeCompare([]byte(token), []byte(expectedToken)) != 1 {
+	if subtle.ConstantTimeCompare([]byte(bearerToken(authHeader)), []byte(expectedToken)) != 1 {
 		return fmt.Errorf("invalid token")
 	}
 
 	return nil
 }
 
+// authorizationHeader returns the Authorization header (case-insensitive lookup)
+func authorizationHeader(request events.LambdaFunctionURLRequest) string {
+	return requestHeader(request, "authorization")
+}
+
+// requestHeader returns a request header (case-insensitive lookup)
+func requestHeader(request events.LambdaFunctionURLRequest, name string) string {
+	for key, value := range request.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// bearerToken extracts the token from "Bearer <token>" or just "<token>"
+func bearerToken(authHeader string) string {
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+	token = strings.TrimPrefix(token, "bearer ")
+	return strings.TrimSpace(token)
+}
+
+// canonicalRegion returns the friendly name for any name regions.Resolve
+// accepts ("Tokyo", "東京", percent-encoded in a path), so tags, hostnames,
+// locks and audit entries only ever see one spelling. Names it doesn't know,
+// including types.LinkAllRegions, come back unchanged for the handler to reject.
+func canonicalRegion(name string) string {
+	if name == types.LinkAllRegions {
+		return name
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	if resolved, err := regions.Resolve(name); err == nil {
+		return resolved
+	}
+	return name
+}
+
 // handler processes Lambda Function URL requests
 func handler(ctx context.Context, request events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
 	log.Printf("Request: %s %s", request.RequestContext.HTTP.Method, request.RawPath)
 
-	// Validate authentication
-	if err := validateAuth(request); err != nil {
-		log.Printf("Authentication failed: %v", err)
-		return errorResponse(http.StatusUnauthorized, fmt.Sprintf("Unauthorized: %v", err)), nil
+	// Throttle per source IP before doing any auth work
+	sourceIP := request.RequestContext.HTTP.SourceIP
+	if ok, retryAfter := limiter.Allow(sourceIP); !ok {
+		log.Printf("Rate limited %s (retry after %s)", sourceIP, retryAfter.Round(time.Second))
+		return tooManyRequestsResponse(retryAfter), nil
 	}
 
-	// Parse the path
-	path := strings.TrimPrefix(request.RawPath, "/")
+	// Parse the path, with or without its API version
+	path, ok := apiPath(request.RawPath)
+	if !ok {
+		return codedErrorResponse(http.StatusNotFound, types.ErrorCodeVersionUnsupported, fmt.Sprintf("This Lambda serves API %s; run 'tse deploy' to update it", types.APIVersion)), nil
+	}
 	parts := strings.Split(path, "/")
+	if len(parts) == 2 && parts[0] != "tokens" && parts[0] != "jobs" {
+		parts[0] = canonicalRegion(parts[0])
+	}
 
 	method := request.RequestContext.HTTP.Method
+	if method == "GET" && isUIPath(path) {
+		return handleUI(path), nil
+	}
+
+	// Handlers get a deadline short of the Lambda's own (see handlerReserve);
+	// audit entries are written with ctx, so they're recorded after it too
+	work, cancel := withHandlerDeadline(ctx)
+	defer cancel()
+
+	// Signed links and Telegram webhooks carry their own authorization
+	if path == linkPath {
+		return handleLink(work, request, method), nil
+	}
+	if path == telegramPath {
+		return handleTelegram(work, request, method), nil
+	}
 
-	// Route the request
+	// Validate authentication
+	caller, err := authenticate(ctx, request)
+	if errors.Is(err, errTokenLookup) {
+		// Store outage, not a bad token: don't count it toward lockout
+		log.Printf("Token lookup failed for %s: %v", sourceIP, err)
+		metrics.Put(metrics.Errors, 1, metrics.Count, nil)
+		return errorResponse(http.StatusInternalServerError, "Failed to verify token"), nil
+	}
+	if err != nil {
+		log.Printf("Authentication failed from %s: %v", sourceIP, err)
+		if lockout := limiter.RecordFailure(sourceIP); lockout > 0 {
+			log.Printf("SECURITY: repeated auth failures from %s, locked out for %s", sourceIP, lockout)
+		}
+		response := errorResponse(http.StatusUnauthorized, fmt.Sprintf("Unauthorized: %v", err))
+		// Rejected attempts are always audited, even for read-only routes
+		action := auditAction(method, parts)
+		if action == "" {
+			action = "auth"
+		}
+		recordAudit(ctx, request, nil, action, parts, response)
+		return response, nil
+	}
+	limiter.RecordSuccess(sourceIP)
+
+	action := auditAction(method, parts)
+
+	// Enforce token scopes. The read-only token can't change anything, even on
+	// routes any token may call.
+	var forbidden string
+	if scope := missingScope(caller, method, parts); scope != "" {
+		log.Printf("Token %s (%s) lacks %q scope for %s %s", caller.ID, caller.Name, scope, method, request.RawPath)
+		forbidden = fmt.Sprintf("Forbidden: token lacks %q scope", scope)
+	} else if caller == readToken && method != "GET" {
+		log.Printf("Read-only token used for %s %s", method, request.RawPath)
+		forbidden = fmt.Sprintf("Forbidden: %s can only read", envReadToken)
+	}
+	if forbidden != "" {
+		response := errorResponse(http.StatusForbidden, forbidden)
+		if action == "" {
+			action = "auth"
+		}
+		recordAudit(ctx, request, caller, action, parts, response)
+		return response, nil
+	}
+
+	// In serve mode, changes to a region are capped (see lockRegionMutation)
+	var response events.LambdaFunctionURLResponse
+	if friendlyRegion, ok := mutatedRegion(method, parts); ok {
+		response, err = withRegionMutation(work, friendlyRegion, parts[1], func() (events.LambdaFunctionURLResponse, error) {
+			return route(work, request, caller, method, path, parts)
+		})
+	} else {
+		response, err = route(work, request, caller, method, path, parts)
+	}
+	response = outOfTimeResponse(work, response)
+	if err != nil || response.StatusCode >= 500 {
+		metrics.Put(metrics.Errors, 1, metrics.Count, nil)
+	}
+	if action != "" {
+		recordAudit(ctx, request, caller, action, parts, response)
+	}
+	return response, err
+}
+
+// route dispatches an authenticated, authorized request to its handler
+func route(ctx context.Context, request events.LambdaFunctionURLRequest, caller *types.TokenInfo, method, path string, parts []string) (events.LambdaFunctionURLResponse, error) {
 	switch {
 	case method == "GET" && path == "":
 		return handleHealth(ctx)
 
+	case method == "GET" && path == "instances":
+		return handleListAllInstances(ctx)
+
 	case method == "GET" && len(parts) == 2 && parts[1] == "instances":
-		return handleListInstances(ctx, parts[0])
+		return handleListInstances(ctx, parts[0], allDeployments(request))
+
+	case method == "GET" && len(parts) == 2 && parts[1] == "compliance":
+		return handleCompliance(ctx, parts[0], request.QueryStringParameters)
 
 	case method == "POST" && len(parts) == 2 && parts[1] == "start":
-		return handleStartInstance(ctx, parts[0])
+		return handleStartInstance(ctx, caller, parts[0], request.Body)
 
 	case method == "POST" && len(parts) == 2 && parts[1] == "stop":
-		return handleStopInstances(ctx, parts[0])
+		return handleStopInstances(ctx, parts[0], request.Body)
+
+	case method == "POST" && len(parts) == 2 && parts[1] == "restart":
+		return handleRestartInstance(ctx, caller, parts[0], request.Body)
+
+	case method == "POST" && len(parts) == 2 && parts[1] == "pause":
+		return handlePauseInstances(ctx, parts[0])
+
+	case method == "POST" && len(parts) == 2 && parts[1] == "resume":
+		return handleResumeInstances(ctx, caller, parts[0])
 
 	case method == "POST" && len(parts) == 2 && parts[1] == "cleanup":
-		return handleCleanupResources(ctx, parts[0])
+		return handleCleanupResources(ctx, parts[0], request.Body)
+
+	case method == "POST" && len(parts) == 2 && parts[1] == "adopt":
+		return handleAdoptInstances(ctx, parts[0], request.Body)
+
+	case method == "GET" && len(parts) == 2 && parts[1] == "reservation":
+		return handleGetReservation(ctx, parts[0])
+
+	case method == "POST" && len(parts) == 2 && parts[1] == "reserve":
+		return handleCreateReservation(ctx, parts[0])
+
+	case method == "POST" && len(parts) == 2 && parts[1] == "unreserve":
+		return handleCancelReservation(ctx, parts[0], allDeployments(request))
+
+	case method == "GET" && len(parts) == 2 && parts[1] == "network":
+		return handleGetNetwork(ctx, parts[0])
+
+	case method == "POST" && len(parts) == 2 && parts[1] == "keep-network":
+		return handleKeepNetwork(ctx, parts[0])
+
+	case method == "POST" && len(parts) == 2 && parts[1] == "release-network":
+		return handleReleaseNetwork(ctx, parts[0])
+
+	case method == "GET" && path == "tokens":
+		return handleListTokens(ctx)
+
+	case method == "POST" && path == "tokens":
+		return handleCreateToken(ctx, request.Body)
+
+	case method == "DELETE" && len(parts) == 2 && parts[0] == "tokens":
+		return handleRevokeToken(ctx, parts[1])
+
+	case method == "POST" && path == "links":
+		return handleCreateLink(request, caller)
+
+	case method == "GET" && path == "audit":
+		return handleListAudit(ctx, request.QueryStringParameters)
+
+	case method == "GET" && len(parts) == 2 && parts[0] == "jobs":
+		return handleGetJob(ctx, parts[1])
 
 	default:
 		return errorResponse(http.StatusNotFound, "Not found"), nil
@@ -95,115 +277,389 @@ func handler(ctx context.Context, request events.LambdaFunctionURLRequest) (even
 // handleHealth returns a simple health check response
 func handleHealth(ctx context.Context) (events.LambdaFunctionURLResponse, error) {
 	response := types.HealthResponse{
-		Status:    "healthy",
-		Version:   Version,
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Status:       "healthy",
+		Version:      Version,
+		APIVersion:   types.APIVersion,
+		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+		AccountID:    identity.AccountID,
+		Deployment:   identity.Deployment,
+		DeploymentID: identity.DeploymentID,
+		Region:       identity.Region,
+		Regions:      regions.GetAllFriendlyNames(),
+		Container:    containerStats(),
 	}
 
 	return jsonResponse(http.StatusOK, response), nil
 }
 
-// handleListInstances lists all exit node instances in a region
-func handleListInstances(ctx context.Context, friendlyRegion string) (events.LambdaFunctionURLResponse, error) {
+// allDeployments reports whether a request asks to cover every deployment's
+// resources instead of only this Lambda's
+func allDeployments(request events.LambdaFunctionURLRequest) bool {
+	return request.QueryStringParameters[types.AllDeploymentsParam] == "true"
+}
+
+// handleListInstances lists this deployment's exit node instances in a region,
+// or every deployment's with all set
+func handleListInstances(ctx context.Context, friendlyRegion string, all bool) (events.LambdaFunctionURLResponse, error) {
 	// Validate region
 	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
 	if err != nil {
-		return errorResponse(http.StatusBadRequest, err.Error()), nil
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+	}
+
+	// Nothing runs in a region the account hasn't enabled, so listing every
+	// region doesn't fail on the opt-in ones
+	if !regionEnabled(ctx, awsRegion) {
+		response := types.InstancesResponse{Success: true, Message: regionNotEnabledMessage(friendlyRegion, awsRegion)}
+		return jsonResponse(http.StatusOK, response), nil
 	}
 
 	// Create AWS service for the region
 	service, err := aws.New(ctx, awsRegion)
 	if err != nil {
-		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to initialize AWS service: %v", err)), nil
+		return awsErrorResponse("Failed to initialize AWS service", err), nil
+	}
+	if all {
+		service.AllDeployments()
 	}
 
 	// List instances
 	instances, err := service.ListInstances(ctx)
 	if err != nil {
-		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to list instances: %v", err)), nil
+		return awsErrorResponse("Failed to list instances", err), nil
+	}
+
+	// Read only: the scheduled sweep is what logs and notifies (notifyAnomalousNodes)
+	var anomalies []types.Anomaly
+	if len(instances) > 0 {
+		if anomalies, err = service.CheckTripwires(ctx); err != nil {
+			log.Printf("Failed to check %s for unexpected instances: %v", friendlyRegion, err)
+		}
 	}
 
+	if err := service.AddNetworkOut(ctx, instances); err != nil {
+		log.Printf("Listing %s without full data transfer figures: %v", friendlyRegion, err)
+	}
+
+	running := 0
+	for _, instance := range instances {
+		if instance.State == "running" {
+			running++
+		}
+	}
+	metrics.Put(metrics.RunningNodes, float64(running), metrics.Count, map[string]string{"Region": friendlyRegion})
+
 	response := types.InstancesResponse{
 		Success:   true,
 		Message:   fmt.Sprintf("Found %d instances in %s", len(instances), friendlyRegion),
 		Instances: instances,
 		Count:     len(instances),
+		Anomalies: anomalies,
+	}
+	if len(anomalies) > 0 {
+		response.Message += fmt.Sprintf(" (WARNING: %d anomalies found)", len(anomalies))
 	}
 
 	return jsonResponse(http.StatusOK, response), nil
 }
 
+// handleListAllInstances lists this deployment's exit nodes in every region.
+// Only regions the node registry has nodes in are asked, so the answer is
+// fresh from EC2 without a DescribeInstances per region. Without a registry it
+// can trust every region is asked, and the registry is reconciled with the
+// answer. Regions that fail are named in the response rather than failing it.
+func handleListAllInstances(ctx context.Context) (events.LambdaFunctionURLResponse, error) {
+	allRegions := regions.GetAllFriendlyNames()
+	friendlyRegions := occupiedRegions(ctx, allRegions)
+	listedAt := time.Now()
+	results := inAllRegions(ctx, friendlyRegions, func(ctx context.Context, friendlyRegion string) (events.LambdaFunctionURLResponse, error) {
+		return handleListInstances(ctx, friendlyRegion, false)
+	})
+
+	total := types.InstancesResponse{Success: true, Instances: []*types.InstanceInfo{}, Regions: friendlyRegions}
+	for i, result := range results {
+		var listed types.InstancesResponse
+		if result.StatusCode != http.StatusOK || json.Unmarshal([]byte(result.Body), &listed) != nil {
+			total.FailedRegions = append(total.FailedRegions, friendlyRegions[i])
+			continue
+		}
+		for _, instance := range listed.Instances {
+			if instance.FriendlyRegion == "" {
+				instance.FriendlyRegion = friendlyRegions[i]
+			}
+		}
+		total.Instances = append(total.Instances, listed.Instances...)
+		total.Anomalies = append(total.Anomalies, listed.Anomalies...)
+	}
+	total.Count = len(total.Instances)
+	total.Message = fmt.Sprintf("Found %d instances in %d of %d regions", total.Count, len(friendlyRegions), len(allRegions))
+	if len(total.FailedRegions) > 0 {
+		total.Success = false
+		total.Message += fmt.Sprintf(" (failed in %s)", strings.Join(total.FailedRegions, ", "))
+	} else if len(friendlyRegions) == len(allRegions) {
+		reconcileRegistry(ctx, listedAt, awsRegionsOf(friendlyRegions), total.Instances)
+	}
+	return jsonResponse(http.StatusOK, total), nil
+}
+
+// handleCompliance audits a region's exit nodes and security groups against a security
+// baseline, the deployment's own unless ?baseline= names another
+func handleCompliance(ctx context.Context, friendlyRegion string, params map[string]string) (events.LambdaFunctionURLResponse, error) {
+	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+	if err != nil {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+	}
+
+	baseline, err := aws.BaselineFromEnv()
+	if name := params["baseline"]; name != "" {
+		baseline, err = aws.LookupBaseline(name)
+	}
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	if !regionEnabled(ctx, awsRegion) {
+		response := types.ComplianceResponse{
+			Success:   true,
+			Message:   regionNotEnabledMessage(friendlyRegion, awsRegion),
+			Region:    friendlyRegion,
+			Baseline:  baseline.Name,
+			Compliant: true,
+		}
+		return jsonResponse(http.StatusOK, response), nil
+	}
+
+	service, err := aws.New(ctx, awsRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to initialize AWS service", err), nil
+	}
+
+	response, err := service.CheckCompliance(ctx, friendlyRegion, baseline)
+	if err != nil {
+		return awsErrorResponse("Failed to check compliance", err), nil
+	}
+
+	response.Success = true
+	response.Message = fmt.Sprintf("Found %d violations of the %s baseline in %s", len(response.Violations), baseline.Name, friendlyRegion)
+
+	return jsonResponse(http.StatusOK, *response), nil
+}
+
 // handleStartInstance creates a new exit node instance
-func handleStartInstance(ctx context.Context, friendlyRegion string) (events.LambdaFunctionURLResponse, error) {
+func handleStartInstance(ctx context.Context, caller *types.TokenInfo, friendlyRegion, body string) (events.LambdaFunctionURLResponse, error) {
+	req, err := parseStartRequest(body)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
 	// Validate region
 	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
 	if err != nil {
-		return errorResponse(http.StatusBadRequest, err.Error()), nil
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+	}
+	if !regionEnabled(ctx, awsRegion) {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionDisabled, regionNotEnabledMessage(friendlyRegion, awsRegion)), nil
+	}
+	if response, ok := startLimitResponse(ctx, caller, friendlyRegion); !ok {
+		return response, nil
 	}
 
 	// Get Tailscale auth key from environment
 	authKey := os.Getenv("TAILSCALE_AUTH_KEY")
 	if authKey == "" {
-		return errorResponse(http.StatusInternalServerError, "TAILSCALE_AUTH_KEY environment variable not set"), nil
+		return codedErrorResponse(http.StatusInternalServerError, types.ErrorCodeMisconfigured, "TAILSCALE_AUTH_KEY environment variable not set"), nil
+	}
+
+	// An async start's job takes the lock and runs the checks below when it
+	// launches, failing the job if the node can't start
+	if req.Async && !req.DryRun {
+		return startJob(ctx, jobKindStart, friendlyRegion, jobRun{Start: &req, Caller: caller}), nil
 	}
 
 	// Create AWS service for the region
 	service, err := aws.New(ctx, awsRegion)
 	if err != nil {
-		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to initialize AWS service: %v", err)), nil
+		return awsErrorResponse("Failed to initialize AWS service", err), nil
+	}
+
+	// Hold the region's start lock from the check to the launch, so two starts
+	// can't both see no node and launch one each. Dry runs launch nothing.
+	if !req.DryRun {
+		release, err := acquireStartLock(ctx, friendlyRegion)
+		if errors.Is(err, store.ErrLockHeld) {
+			return codedErrorResponse(http.StatusConflict, types.ErrorCodeStartInProgress, fmt.Sprintf("Another start is already in progress in %s region", friendlyRegion)), nil
+		}
+		if err != nil {
+			return awsErrorResponse("Failed to lock region for start", err), nil
+		}
+		defer release()
+
+		// The check above ran unlocked, for a quick answer; this one holds
+		// until the node is registered
+		releaseCap, response, ok := lockNodeCap(ctx, caller, friendlyRegion)
+		if !ok {
+			return response, nil
+		}
+		defer releaseCap()
 	}
 
 	// Check if instance already exists
 	existingInstances, err := service.ListInstances(ctx)
 	if err != nil {
-		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to check existing instances: %v", err)), nil
+		return awsErrorResponse("Failed to check existing instances", err), nil
 	}
 
 	// Count running/pending instances
-	runningCount := 0
+	runningCount, pausedCount := 0, 0
 	for _, instance := range existingInstances {
 		if instance.State == "running" || instance.State == "pending" {
 			runningCount++
 		}
+		if instance.State == "stopping" || instance.State == "stopped" {
+			pausedCount++
+		}
+		// A retry of a start that already launched: answer as the first one did
+		if req.ClientToken != "" && instance.ClientToken == req.ClientToken {
+			response := types.StartResponse{
+				Success:     true,
+				Message:     fmt.Sprintf("Exit node started in %s region", friendlyRegion),
+				Instance:    instance,
+				ClientToken: req.ClientToken,
+				Replayed:    true,
+			}
+			return jsonResponse(http.StatusCreated, response), nil
+		}
 	}
 
 	if runningCount > 0 {
-		return errorResponse(http.StatusConflict, fmt.Sprintf("Exit node already running in %s region", friendlyRegion)), nil
+		return codedErrorResponse(http.StatusConflict, types.ErrorCodeAlreadyRunning, fmt.Sprintf("Exit node already running in %s region", friendlyRegion)), nil
+	}
+	if pausedCount > 0 {
+		return codedErrorResponse(http.StatusConflict, types.ErrorCodeNodePaused, fmt.Sprintf("Exit node paused in %s region; resume it, or stop it to start a new one", friendlyRegion)), nil
+	}
+
+	resolver, _ := dns.Parse(req.DNS) // Validated by parseStartRequest
+	opts := aws.NodeOptions{DNS: resolver, Routes: req.AdvertiseRoutes, Hop: req.Hop, StartedBy: caller}
+
+	// Dry runs (tse loadtest, tse <region> start --dry-run) stop short of
+	// launching, so they cost nothing; a plan only takes EC2 reads
+	if req.DryRun {
+		response := types.StartResponse{
+			Success:     true,
+			Message:     fmt.Sprintf("Dry run: would start an exit node in %s region", friendlyRegion),
+			ClientToken: req.ClientToken,
+		}
+		if req.Plan {
+			plan, err := service.PlanStart(ctx, friendlyRegion, opts)
+			if err != nil {
+				return awsErrorResponse("Failed to plan start", err), nil
+			}
+			response.Plan = plan
+		}
+		return jsonResponse(http.StatusOK, response), nil
 	}
 
 	// Start new instance
-	instance, err := service.StartInstance(ctx, friendlyRegion, authKey)
+	instance, err := startNode(ctx, service, friendlyRegion, authKey, req.ClientToken, opts)
 	if err != nil {
-		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to start instance: %v", err)), nil
+		return awsErrorResponse("Failed to start instance", err), nil
 	}
 
 	response := types.StartResponse{
-		Success:  true,
-		Message:  fmt.Sprintf("Exit node started in %s region", friendlyRegion),
-		Instance: instance,
+		Success:     true,
+		Message:     fmt.Sprintf("Exit node started in %s region", friendlyRegion),
+		Instance:    instance,
+		ClientToken: req.ClientToken,
 	}
 
 	return jsonResponse(http.StatusCreated, response), nil
 }
 
+// startNode launches an exit node, recording how long it took and telling the
+// webhooks whether it started
+func startNode(ctx context.Context, service *aws.Service, friendlyRegion, authKey, clientToken string, opts aws.NodeOptions) (*types.InstanceInfo, error) {
+	started := time.Now()
+	instance, err := service.StartInstance(ctx, friendlyRegion, authKey, clientToken, opts)
+	if err != nil {
+		if ranOutOfTime(ctx) {
+			// Still worth telling the webhooks, in the time the handler keeps in reserve
+			ctx = context.WithoutCancel(ctx)
+		}
+		notifier.Notify(ctx, notify.Event{
+			Type:    notify.EventNodeFailed,
+			Region:  friendlyRegion,
+			Message: fmt.Sprintf("Failed to start exit node in %s: %v", friendlyRegion, err),
+		})
+		return nil, err
+	}
+	metrics.Put(metrics.StartLatency, float64(time.Since(started).Milliseconds()), metrics.Milliseconds, map[string]string{"Region": friendlyRegion})
+	registerNode(ctx, instance)
+
+	notifier.Notify(ctx, notify.Event{
+		Type:        notify.EventNodeStarted,
+		Region:      friendlyRegion,
+		InstanceIDs: []string{instance.InstanceID},
+		Message:     fmt.Sprintf("Exit node started in %s", friendlyRegion),
+	})
+	return instance, nil
+}
+
 // handleStopInstances terminates all exit node instances in a region
-func handleStopInstances(ctx context.Context, friendlyRegion string) (events.LambdaFunctionURLResponse, error) {
+func handleStopInstances(ctx context.Context, friendlyRegion, body string) (events.LambdaFunctionURLResponse, error) {
+	req, err := parseStopRequest(body)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
 	// Validate region
 	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
 	if err != nil {
-		return errorResponse(http.StatusBadRequest, err.Error()), nil
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+	}
+
+	if !regionEnabled(ctx, awsRegion) {
+		response := types.StopResponse{Success: true, Message: regionNotEnabledMessage(friendlyRegion, awsRegion)}
+		return jsonResponse(http.StatusOK, response), nil
+	}
+
+	if req.Async {
+		return startJob(ctx, jobKindStop, friendlyRegion, jobRun{Stop: &req}), nil
 	}
 
 	// Create AWS service for the region
 	service, err := aws.New(ctx, awsRegion)
 	if err != nil {
-		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to initialize AWS service: %v", err)), nil
+		return awsErrorResponse("Failed to initialize AWS service", err), nil
+	}
+
+	// Read what the nodes sent before terminating them; CloudWatch keeps the
+	// metrics, but the instances drop out of ListInstances once they're gone
+	sentBytes := map[string]int64{}
+	if instances, err := service.ListInstances(ctx); err != nil {
+		log.Printf("Not reporting data transfer for %s: %v", friendlyRegion, err)
+	} else {
+		if err := service.AddNetworkOut(ctx, instances); err != nil {
+			log.Printf("Data transfer for %s is incomplete: %v", friendlyRegion, err)
+		}
+		for _, instance := range instances {
+			sentBytes[instance.InstanceID] = instance.NetworkOutBytes
+		}
 	}
 
 	// Stop instances
 	terminatedIDs, err := service.StopInstances(ctx)
 	if err != nil {
-		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to stop instances: %v", err)), nil
+		return awsErrorResponse("Failed to stop instances", err), nil
+	}
+
+	var networkOut int64
+	for _, id := range terminatedIDs {
+		networkOut += sentBytes[id]
+	}
+
+	if len(terminatedIDs) > 0 {
+		unregisterNodes(ctx, terminatedIDs)
+		notifyStopped(ctx, friendlyRegion, terminatedIDs)
 	}
 
 	response := types.StopResponse{
@@ -211,11 +667,22 @@ func handleStopInstances(ctx context.Context, friendlyRegion string) (events.Lam
 		Message:         fmt.Sprintf("Terminated %d instances in %s region", len(terminatedIDs), friendlyRegion),
 		TerminatedCount: len(terminatedIDs),
 		TerminatedIDs:   terminatedIDs,
+		NetworkOutBytes: networkOut,
 	}
 
 	return jsonResponse(http.StatusOK, response), nil
 }
 
+// notifyStopped tells the webhooks a region's nodes were terminated
+func notifyStopped(ctx context.Context, friendlyRegion string, instanceIDs []string) {
+	notifier.Notify(ctx, notify.Event{
+		Type:        notify.EventNodeStopped,
+		Region:      friendlyRegion,
+		InstanceIDs: instanceIDs,
+		Message:     fmt.Sprintf("Exit node stopped in %s", friendlyRegion),
+	})
+}
+
 // jsonResponse creates a JSON response
 func jsonResponse(statusCode int, data interface{}) events.LambdaFunctionURLResponse {
 	body, err := json.Marshal(data)
@@ -223,65 +690,341 @@ func jsonResponse(statusCode int, data interface{}) events.LambdaFunctionURLResp
 		log.Printf("Error marshaling response: %v", err)
 		return errorResponse(http.StatusInternalServerError, "Internal server error")
 	}
+	if len(body) > types.MaxPayloadBytes {
+		// The function URL would reject it with an opaque error; say what happened instead
+		log.Printf("Response of %d bytes exceeds the %d byte payload limit", len(body), types.MaxPayloadBytes)
+		return errorResponse(http.StatusInternalServerError, "Response too large; narrow the request (e.g. a shorter --since or lower --limit)")
+	}
 
 	return events.LambdaFunctionURLResponse{
 		StatusCode: statusCode,
 		Headers: map[string]string{
-			"Content-Type": "application/json",
+			"Content-Type":         "application/json",
+			types.APIVersionHeader: types.APIVersion,
 		},
 		Body: string(body),
 	}
 }
 
-// errorResponse creates an error JSON response
+// tooManyRequestsResponse creates a 429 response with a Retry-After header
+func tooManyRequestsResponse(retryAfter time.Duration) events.LambdaFunctionURLResponse {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	response := errorResponse(http.StatusTooManyRequests, fmt.Sprintf("Too many requests, retry after %ds", seconds))
+	response.Headers["Retry-After"] = strconv.Itoa(seconds)
+	return response
+}
+
+// errorResponse creates an error JSON response, coded by its status alone
 func errorResponse(statusCode int, message string) events.LambdaFunctionURLResponse {
+	return codedErrorResponse(statusCode, types.DefaultErrorCode(statusCode), message)
+}
+
+// awsThrottledRetryAfter is how long a caller is told to wait when AWS throttled
+// the Lambda's calls even after the SDK's retries; short enough for the CLI to
+// wait it out and retry on its own
+const awsThrottledRetryAfter = 5 * time.Second
+
+// awsErrorResponse creates a 500 for a failed AWS call, coded NO_CAPACITY when
+// that's what went wrong so the CLI can say what to do. Throttling gets a 429
+// coded AWS_THROTTLED with a Retry-After instead, since trying again shortly is
+// the fix.
+func awsErrorResponse(message string, err error) events.LambdaFunctionURLResponse {
+	message = fmt.Sprintf("%s: %v", message, err)
+	switch {
+	case aws.IsCapacityError(err):
+		return codedErrorResponse(http.StatusInternalServerError, types.ErrorCodeNoCapacity, message)
+	case aws.IsThrottlingError(err):
+		log.Printf("AWS throttled: %s", message)
+		response := codedErrorResponse(http.StatusTooManyRequests, types.ErrorCodeAWSThrottled, message)
+		response.Headers["Retry-After"] = strconv.Itoa(int(awsThrottledRetryAfter.Seconds()))
+		return response
+	}
+	return codedErrorResponse(http.StatusInternalServerError, types.ErrorCodeInternal, message)
+}
+
+// codedErrorResponse creates an error JSON response with a specific error code
+func codedErrorResponse(statusCode int, code types.ErrorCode, message string) events.LambdaFunctionURLResponse {
 	response := types.ErrorResponse{
-		Success: false,
-		Error:   message,
-		Code:    statusCode,
+		Success:   false,
+		Error:     message,
+		Code:      statusCode,
+		ErrorCode: code,
 	}
 
 	body, _ := json.Marshal(response)
 	return events.LambdaFunctionURLResponse{
 		StatusCode: statusCode,
 		Headers: map[string]string{
-			"Content-Type": "application/json",
+			"Content-Type":         "application/json",
+			types.APIVersionHeader: types.APIVersion,
 		},
 		Body: string(body),
 	}
 }
 
 // handleCleanupResources force cleans up all TSE resources in a region
-func handleCleanupResources(ctx context.Context, friendlyRegion string) (events.LambdaFunctionURLResponse, error) {
-	log.Printf("Starting cleanup of all TSE resources in region %s", friendlyRegion)
+func handleCleanupResources(ctx context.Context, friendlyRegion, body string) (events.LambdaFunctionURLResponse, error) {
+	req, err := parseCleanupRequest(body)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error()), nil
+	}
 
+	log.Printf("Starting cleanup of all TSE resources in region %s (dry run: %v, force: %v, all deployments: %v)", friendlyRegion, req.DryRun, req.Force, req.AllDeployments)
+
+	if _, err := regions.GetAWSRegion(friendlyRegion); err != nil {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, fmt.Sprintf("Invalid region: %s", friendlyRegion)), nil
+	}
+
+	if req.Async {
+		return startJob(ctx, jobKindCleanup, friendlyRegion, jobRun{Cleanup: &req}), nil
+	}
+
+	response, err := runCleanup(ctx, friendlyRegion, req)
+	if err != nil {
+		log.Printf("Cleanup failed: %v", err)
+		return awsErrorResponse("Cleanup failed", err), nil
+	}
+	return jsonResponse(http.StatusOK, response), nil
+}
+
+// runCleanup cleans up a region and describes the outcome, for a request or
+// an async job
+func runCleanup(ctx context.Context, friendlyRegion string, req types.CleanupRequest) (*types.StopResponse, error) {
+	cleanedResources, skippedResources, err := cleanupRegion(ctx, friendlyRegion, req)
+	if err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("Cleaned up all TSE resources in %s", friendlyRegion)
+	if req.DryRun {
+		message = fmt.Sprintf("Found %d TSE resources to clean up in %s", len(cleanedResources), friendlyRegion)
+	}
+
+	log.Printf("Cleanup completed in region %s: %v (skipped as too new: %v)", friendlyRegion, cleanedResources, skippedResources)
+	return &types.StopResponse{
+		Message:         message,
+		TerminatedIDs:   cleanedResources,
+		TerminatedCount: len(cleanedResources),
+		SkippedIDs:      skippedResources,
+	}, nil
+}
+
+// cleanupRegion force-cleans (or, in dry-run mode, lists) the TSE resources in one
+// region, returning those cleaned and those skipped for being too new
+func cleanupRegion(ctx context.Context, friendlyRegion string, req types.CleanupRequest) ([]string, []string, error) {
 	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
 	if err != nil {
-		return errorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid region: %s", friendlyRegion)), nil
+		return nil, nil, err
+	}
+	if !regionEnabled(ctx, awsRegion) {
+		return nil, nil, nil // tse can't have created anything there
 	}
 
 	service, err := aws.New(ctx, awsRegion)
 	if err != nil {
-		return errorResponse(http.StatusInternalServerError, "Failed to initialize AWS service"), nil
+		return nil, nil, fmt.Errorf("failed to initialize AWS service: %w", err)
+	}
+	if req.AllDeployments {
+		service.AllDeployments()
 	}
 
-	// Force cleanup all TSE resources
-	cleanedResources, err := service.ForceCleanupAllResources(ctx, friendlyRegion)
+	if req.DryRun {
+		return service.PreviewCleanup(ctx, friendlyRegion, req.Force)
+	}
+	cleaned, skipped, err := service.ForceCleanupAllResources(ctx, friendlyRegion, req.Force)
+	unregisterNodes(ctx, cleanedInstances(cleaned))
+	return cleaned, skipped, err
+}
+
+// cleanedInstances picks the instance IDs out of cleaned resources ("Instance:i-...")
+func cleanedInstances(resources []string) []string {
+	var instanceIDs []string
+	for _, resource := range resources {
+		if instanceID, ok := strings.CutPrefix(resource, "Instance:"); ok {
+			instanceIDs = append(instanceIDs, instanceID)
+		}
+	}
+	return instanceIDs
+}
+
+// parseCleanupRequest decodes an optional cleanup request body; an empty body means defaults
+func parseCleanupRequest(body string) (types.CleanupRequest, error) {
+	var req types.CleanupRequest
+	if strings.TrimSpace(body) == "" {
+		return req, nil
+	}
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		return req, fmt.Errorf("invalid request body: %v", err)
+	}
+	return req, nil
+}
+
+// parseStopRequest parses an optional stop request body
+func parseStopRequest(body string) (types.StopRequest, error) {
+	var req types.StopRequest
+	if strings.TrimSpace(body) == "" {
+		return req, nil
+	}
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		return req, fmt.Errorf("invalid request body: %v", err)
+	}
+	return req, nil
+}
+
+// maxClientTokenLength leaves room in RunInstances' 64-character ClientToken for
+// the attempt, architecture and zone appended to it
+const maxClientTokenLength = 36
+
+// parseStartRequest parses an optional start request body; an empty body is a real start
+func parseStartRequest(body string) (types.StartRequest, error) {
+	var req types.StartRequest
+	if strings.TrimSpace(body) == "" {
+		return req, nil
+	}
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		return req, fmt.Errorf("invalid request body: %v", err)
+	}
+	if !validClientToken(req.ClientToken) {
+		return req, fmt.Errorf("invalid client_token: use up to %d letters, digits, '-' or '_'", maxClientTokenLength)
+	}
+	if _, err := dns.Parse(req.DNS); err != nil {
+		return req, fmt.Errorf("invalid dns: %v", err)
+	}
+	advertised, err := routes.Parse(strings.Join(req.AdvertiseRoutes, ","))
 	if err != nil {
-		log.Printf("Cleanup failed: %v", err)
-		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Cleanup failed: %v", err)), nil
+		return req, fmt.Errorf("invalid advertise_routes: %v", err)
 	}
+	req.AdvertiseRoutes = advertised
+	if req.Hop != nil {
+		if err := req.Hop.Validate(); err != nil {
+			return req, fmt.Errorf("invalid hop: %v", err)
+		}
+		if _, err := regions.GetAWSRegion(req.Hop.PeerRegion); err != nil {
+			return req, fmt.Errorf("invalid hop: %v", err)
+		}
+		// The entry node sends everything its clients forward through the tunnel
+		if req.Hop.Role == types.HopEntry && len(req.AdvertiseRoutes) > 0 {
+			return req, fmt.Errorf("a multihop entry node can't advertise routes")
+		}
+	}
+	return req, nil
+}
 
-	response := types.StopResponse{
-		Message:         fmt.Sprintf("Cleaned up all TSE resources in %s", friendlyRegion),
-		TerminatedIDs:   cleanedResources,
-		TerminatedCount: len(cleanedResources),
+// validClientToken reports whether token is empty or safe to use as an EC2 tag
+// value and ClientToken prefix
+func validClientToken(token string) bool {
+	if len(token) > maxClientTokenLength {
+		return false
+	}
+	for _, r := range token {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// handleAdoptInstances tags manually-launched exit node instances so tse manages them
+func handleAdoptInstances(ctx context.Context, friendlyRegion, body string) (events.LambdaFunctionURLResponse, error) {
+	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+	if err != nil {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+	}
+
+	var req types.AdoptRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err)), nil
+	}
+	if len(req.Candidates) == 0 {
+		return errorResponse(http.StatusBadRequest, "No candidates provided"), nil
+	}
+	if !regionEnabled(ctx, awsRegion) {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionDisabled, regionNotEnabledMessage(friendlyRegion, awsRegion)), nil
 	}
 
-	log.Printf("Cleanup completed in region %s: %v", friendlyRegion, cleanedResources)
+	service, err := aws.New(ctx, awsRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to initialize AWS service", err), nil
+	}
+
+	adopted, unmatched, err := service.AdoptInstances(ctx, friendlyRegion, req.Candidates, req.DryRun)
+	if err != nil {
+		return awsErrorResponse("Failed to adopt instances", err), nil
+	}
+
+	verb := "Adopted"
+	if req.DryRun {
+		verb = "Would adopt"
+	} else {
+		for _, instance := range adopted {
+			registerNode(ctx, instance)
+		}
+	}
+
+	response := types.AdoptResponse{
+		Success:   true,
+		Message:   fmt.Sprintf("%s %d instances in %s region", verb, len(adopted), friendlyRegion),
+		Adopted:   adopted,
+		Unmatched: unmatched,
+		DryRun:    req.DryRun,
+	}
+
+	log.Printf("Adopt in region %s (dry run: %v): %d adopted, %d unmatched", friendlyRegion, req.DryRun, len(adopted), len(unmatched))
 	return jsonResponse(http.StatusOK, response), nil
 }
 
 func main() {
-	lambda.Start(handler)
+	// A bad webhook shouldn't take the whole API down; run without notifications
+	n, err := notify.FromEnv()
+	if err != nil {
+		log.Printf("Ignoring %s: %v", notify.EnvWebhooks, err)
+	}
+	notifier = n
+
+	// Same custom regions as the CLI that deployed us; on a bad value keep the built-in ones
+	if err := regions.FromEnv(); err != nil {
+		log.Printf("Ignoring custom regions: %v", err)
+	}
+
+	s, err := store.FromEnv(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to initialize state store: %v", err)
+	}
+	if s != nil {
+		tokens = s
+		auditLog = s
+		startLocks = s
+		jobs = s
+		transferLog = s
+		registry = s
+	}
+
+	// Like a bad webhook, a bad cap shouldn't take the API down; run without caps
+	if c, err := transferCapsFromEnv(); err != nil {
+		log.Printf("Ignoring data transfer caps: %v", err)
+	} else {
+		caps = c
+	}
+
+	identity = loadIdentity(context.Background())
+
+	// Opt-in status is per account, so ask from a region that's always enabled
+	if service, err := aws.New(context.Background(), identity.Region); err != nil {
+		log.Printf("Not checking opt-in regions: %v", err)
+	} else {
+		optInStatus = service
+	}
+
+	if addr := os.Getenv(envServeAddr); addr != "" {
+		if err := serve(addr); err != nil {
+			log.Fatalf("Serve failed: %v", err)
+		}
+		return
+	}
+
+	lambda.Start(invoke)
 }
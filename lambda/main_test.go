@@ -1,10 +1,20 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/smithy-go"
+
+	"github.com/anoldguy/tse/lambda/ratelimit"
+	"github.com/anoldguy/tse/shared/types"
 )
 
 func TestValidateAuth(t *testing.T) {
@@ -186,3 +196,213 @@ func TestValidateAuth_TimingAttackResistance(t *testing.T) {
 		})
 	}
 }
+
+func TestParseCleanupRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantDryRun  bool
+		wantForce   bool
+		expectError bool
+	}{
+		{name: "empty body", body: "", wantDryRun: false},
+		{name: "empty object", body: "{}", wantDryRun: false},
+		{name: "dry run", body: `{"dry_run":true}`, wantDryRun: true},
+		{name: "force", body: `{"force":true}`, wantForce: true},
+		{name: "invalid JSON", body: "{not json", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := parseCleanupRequest(tt.body)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if req.DryRun != tt.wantDryRun {
+				t.Errorf("DryRun = %v, want %v", req.DryRun, tt.wantDryRun)
+			}
+			if req.Force != tt.wantForce {
+				t.Errorf("Force = %v, want %v", req.Force, tt.wantForce)
+			}
+		})
+	}
+}
+
+func TestParseStartRequest(t *testing.T) {
+	if req, err := parseStartRequest(""); err != nil || req.DryRun {
+		t.Errorf("empty body = %+v, %v; want a real start", req, err)
+	}
+	if req, err := parseStartRequest(`{"dry_run":true}`); err != nil || !req.DryRun {
+		t.Errorf("dry run body = %+v, %v; want DryRun", req, err)
+	}
+	if _, err := parseStartRequest("{not json"); err == nil {
+		t.Error("invalid JSON accepted")
+	}
+
+	if req, err := parseStartRequest(`{"client_token":"0f3a-retry_1"}`); err != nil || req.ClientToken != "0f3a-retry_1" {
+		t.Errorf("client token body = %+v, %v; want ClientToken", req, err)
+	}
+	for _, token := range []string{"has space", "tag=value", strings.Repeat("a", maxClientTokenLength+1)} {
+		if _, err := parseStartRequest(fmt.Sprintf(`{"client_token":%q}`, token)); err == nil {
+			t.Errorf("client token %q accepted", token)
+		}
+	}
+
+	if req, err := parseStartRequest(`{"dns":"nextdns:abc123"}`); err != nil || req.DNS != "nextdns:abc123" {
+		t.Errorf("dns body = %+v, %v; want DNS", req, err)
+	}
+	if _, err := parseStartRequest(`{"dns":"pihole.local"}`); err == nil {
+		t.Error("unknown dns choice accepted")
+	}
+
+	if req, err := parseStartRequest(`{"advertise_routes":["vpc","192.168.10.0/24"]}`); err != nil || !slices.Equal(req.AdvertiseRoutes, []string{"10.0.0.0/16", "192.168.10.0/24"}) {
+		t.Errorf("routes body = %+v, %v; want the VPC and 192.168.10.0/24", req, err)
+	}
+	if _, err := parseStartRequest(`{"advertise_routes":["0.0.0.0/0"]}`); err == nil {
+		t.Error("default route accepted")
+	}
+
+	const key = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="
+	hop := fmt.Sprintf(`{"hop":{"role":"entry","peer_region":"frankfurt","private_key":%q,"peer_public_key":%q,"endpoint":"3.120.0.1:51820"}}`, key, key)
+	if req, err := parseStartRequest(hop); err != nil || req.Hop == nil || req.Hop.Role != types.HopEntry {
+		t.Errorf("hop body = %+v, %v; want an entry node", req, err)
+	}
+	for name, body := range map[string]string{
+		"unknown peer region": strings.Replace(hop, "frankfurt", "atlantis", 1),
+		"bad key":             strings.Replace(hop, key, "AAEC", 1),
+		"entry with routes":   strings.Replace(hop, `{"hop"`, `{"advertise_routes":["vpc"],"hop"`, 1),
+	} {
+		if _, err := parseStartRequest(body); err == nil {
+			t.Errorf("hop body with %s accepted", name)
+		}
+	}
+}
+
+func TestHandlerLocksOutRepeatedAuthFailures(t *testing.T) {
+	os.Setenv("TSE_AUTH_TOKEN", "test-token-12345")
+	defer os.Unsetenv("TSE_AUTH_TOKEN")
+
+	request := events.LambdaFunctionURLRequest{
+		RawPath: "/",
+		Headers: map[string]string{"Authorization": "Bearer wrong-token"},
+	}
+	request.RequestContext.HTTP.Method = "GET"
+	request.RequestContext.HTTP.SourceIP = "198.51.100.7"
+
+	for i := 0; i < ratelimit.DefaultConfig.MaxFailures; i++ {
+		resp, _ := handler(context.Background(), request)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want %d", i+1, resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+
+	// Locked out now, even with the right token
+	request.Headers["Authorization"] = "Bearer test-token-12345"
+	resp, _ := handler(context.Background(), request)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status after lockout = %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+	}
+	if resp.Headers["Retry-After"] == "" {
+		t.Errorf("429 response is missing Retry-After header")
+	}
+}
+
+func TestHandleHealthReportsIdentity(t *testing.T) {
+	identity = deploymentIdentity{AccountID: "123456789012", Deployment: "tailscale-exits", Region: "us-east-2"}
+	defer func() { identity = deploymentIdentity{} }()
+
+	resp, err := handleHealth(context.Background())
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("handleHealth = %d, %v", resp.StatusCode, err)
+	}
+
+	var health types.HealthResponse
+	if err := json.Unmarshal([]byte(resp.Body), &health); err != nil {
+		t.Fatalf("invalid health response: %v", err)
+	}
+	if health.AccountID != "123456789012" || health.Deployment != "tailscale-exits" || health.Region != "us-east-2" {
+		t.Errorf("health identity = %s/%s/%s, want 123456789012/tailscale-exits/us-east-2", health.AccountID, health.Deployment, health.Region)
+	}
+}
+
+func TestJSONResponseRefusesOversizedBody(t *testing.T) {
+	entries := []*types.AuditEntry{{Action: "start", Result: strings.Repeat("x", types.MaxPayloadBytes)}}
+
+	resp := jsonResponse(http.StatusOK, types.AuditResponse{Success: true, Entries: entries})
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("StatusCode = %d, want 500", resp.StatusCode)
+	}
+	if len(resp.Body) > types.MaxPayloadBytes {
+		t.Errorf("oversized body was returned (%d bytes)", len(resp.Body))
+	}
+}
+
+func TestErrorResponseCodes(t *testing.T) {
+	throttled := fmt.Errorf("operation error EC2: DescribeInstances: %w", &smithy.GenericAPIError{Code: "RequestLimitExceeded"})
+	noCapacity := fmt.Errorf("failed to launch instance: %w", &smithy.GenericAPIError{Code: "InsufficientInstanceCapacity"})
+
+	tests := []struct {
+		name     string
+		response events.LambdaFunctionURLResponse
+		status   int
+		code     types.ErrorCode
+	}{
+		{"default for status", errorResponse(http.StatusUnauthorized, "Unauthorized"), http.StatusUnauthorized, types.ErrorCodeAuthFailed},
+		{"explicit code", codedErrorResponse(http.StatusConflict, types.ErrorCodeNodePaused, "paused"), http.StatusConflict, types.ErrorCodeNodePaused},
+		{"aws throttling", awsErrorResponse("Failed to list instances", throttled), http.StatusTooManyRequests, types.ErrorCodeAWSThrottled},
+		{"aws capacity", awsErrorResponse("Failed to start instance", noCapacity), http.StatusInternalServerError, types.ErrorCodeNoCapacity},
+		{"aws other", awsErrorResponse("Failed to stop instances", fmt.Errorf("boom")), http.StatusInternalServerError, types.ErrorCodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errorResp types.ErrorResponse
+			if err := json.Unmarshal([]byte(tt.response.Body), &errorResp); err != nil {
+				t.Fatalf("invalid error response: %v", err)
+			}
+			if tt.response.StatusCode != tt.status || errorResp.Code != tt.status || errorResp.ErrorCode != tt.code {
+				t.Errorf("response = %d %+v, want %d %s", tt.response.StatusCode, errorResp, tt.status, tt.code)
+			}
+			if retryAfter := tt.response.Headers["Retry-After"]; (retryAfter != "") != (tt.status == http.StatusTooManyRequests) {
+				t.Errorf("Retry-After = %q for a %d", retryAfter, tt.status)
+			}
+		})
+	}
+}
+
+func TestStartInvalidRegionErrorCode(t *testing.T) {
+	resp, err := handleStartInstance(context.Background(), rootToken, "atlantis", "")
+	if err != nil {
+		t.Fatalf("handleStartInstance error = %v", err)
+	}
+
+	var errorResp types.ErrorResponse
+	if err := json.Unmarshal([]byte(resp.Body), &errorResp); err != nil {
+		t.Fatalf("invalid error response: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || errorResp.ErrorCode != types.ErrorCodeRegionInvalid {
+		t.Errorf("response = %d %s, want 400 %s", resp.StatusCode, errorResp.ErrorCode, types.ErrorCodeRegionInvalid)
+	}
+}
+
+func TestCanonicalRegion(t *testing.T) {
+	tests := map[string]string{
+		"tokyo":              "tokyo",
+		"Tokyo":              "tokyo",
+		"東京":                 "tokyo",
+		"%E6%9D%B1%E4%BA%AC": "tokyo",
+		"all":                "all",
+		"atlantis":           "atlantis",
+	}
+	for name, want := range tests {
+		if got := canonicalRegion(name); got != want {
+			t.Errorf("canonicalRegion(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package metrics publishes CloudWatch custom metrics from the Lambda using the
+// Embedded Metric Format: each value is a structured JSON log line that
+// CloudWatch Logs turns into a metric, so no PutMetricData calls or extra IAM
+// permissions are needed.
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Namespace is the CloudWatch namespace all TSE metrics are published under
+const Namespace = "TSE"
+
+// Metric names
+const (
+	RunningNodes  = "RunningNodes"  // Running exit nodes, per region and in total
+	StartLatency  = "StartLatency"  // Time for a start request to launch a node
+	Errors        = "Errors"        // Requests that failed with a 5xx
+	OldestNodeAge = "OldestNodeAge" // Age of the longest-running exit node, across all regions
+)
+
+// Unit is a CloudWatch metric unit
+type Unit string
+
+const (
+	Count        Unit = "Count"
+	Milliseconds Unit = "Milliseconds"
+	Seconds      Unit = "Seconds"
+)
+
+// Output is where metric lines are written. Lambda sends stdout to CloudWatch Logs.
+var Output io.Writer = os.Stdout
+
+var mu sync.Mutex
+
+// Put publishes one value of the named metric. Each key in dims becomes a
+// CloudWatch dimension; with no dims the metric is aggregated across everything.
+func Put(name string, value float64, unit Unit, dims map[string]string) {
+	line, err := encode(time.Now(), name, value, unit, dims)
+	if err != nil {
+		log.Printf("Failed to encode metric %s: %v", name, err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	Output.Write(append(line, '\n'))
+}
+
+// encode builds the EMF document for a single metric value
+func encode(now time.Time, name string, value float64, unit Unit, dims map[string]string) ([]byte, error) {
+	keys := make([]string, 0, len(dims))
+	for key := range dims {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	doc := map[string]any{
+		"_aws": map[string]any{
+			"Timestamp": now.UnixMilli(),
+			"CloudWatchMetrics": []map[string]any{
+				{
+					"Namespace":  Namespace,
+					"Dimensions": [][]string{keys},
+					"Metrics":    []map[string]string{{"Name": name, "Unit": string(unit)}},
+				},
+			},
+		},
+		name: value,
+	}
+	for key, v := range dims {
+		doc[key] = v
+	}
+
+	return json.Marshal(doc)
+}
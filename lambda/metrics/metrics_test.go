@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	line, err := encode(now, RunningNodes, 2, Count, map[string]string{"Region": "ohio"})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	var doc struct {
+		AWS struct {
+			Timestamp         int64
+			CloudWatchMetrics []struct {
+				Namespace  string
+				Dimensions [][]string
+				Metrics    []struct{ Name, Unit string }
+			}
+		} `json:"_aws"`
+		Region       string
+		RunningNodes float64
+	}
+	if err := json.Unmarshal(line, &doc); err != nil {
+		t.Fatalf("not valid JSON: %v\n%s", err, line)
+	}
+
+	if doc.AWS.Timestamp != now.UnixMilli() {
+		t.Errorf("Timestamp = %d, want %d", doc.AWS.Timestamp, now.UnixMilli())
+	}
+	if len(doc.AWS.CloudWatchMetrics) != 1 {
+		t.Fatalf("want one metric directive, got %d", len(doc.AWS.CloudWatchMetrics))
+	}
+	directive := doc.AWS.CloudWatchMetrics[0]
+	if directive.Namespace != Namespace {
+		t.Errorf("Namespace = %q, want %q", directive.Namespace, Namespace)
+	}
+	if len(directive.Dimensions) != 1 || len(directive.Dimensions[0]) != 1 || directive.Dimensions[0][0] != "Region" {
+		t.Errorf("Dimensions = %v, want [[Region]]", directive.Dimensions)
+	}
+	if len(directive.Metrics) != 1 || directive.Metrics[0].Name != RunningNodes || directive.Metrics[0].Unit != "Count" {
+		t.Errorf("Metrics = %+v", directive.Metrics)
+	}
+	if doc.Region != "ohio" || doc.RunningNodes != 2 {
+		t.Errorf("values = %q %v, want ohio 2", doc.Region, doc.RunningNodes)
+	}
+}
+
+func TestPutWithoutDimensions(t *testing.T) {
+	var buf bytes.Buffer
+	orig := Output
+	Output = &buf
+	t.Cleanup(func() { Output = orig })
+
+	Put(Errors, 1, Count, nil)
+
+	line := buf.String()
+	if !strings.HasSuffix(line, "\n") || strings.Count(line, "\n") != 1 {
+		t.Errorf("want exactly one line, got %q", line)
+	}
+	if !strings.Contains(line, `"Dimensions":[[]]`) {
+		t.Errorf("metric without dimensions should declare an empty dimension set: %s", line)
+	}
+}
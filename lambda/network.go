@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/lambda/aws"
+	"github.com/anoldguy/tse/lambda/store"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// handleGetNetwork shows a region's VPC stack and whether it's kept between sessions
+func handleGetNetwork(ctx context.Context, friendlyRegion string) (events.LambdaFunctionURLResponse, error) {
+	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+	if err != nil {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+	}
+	if !regionEnabled(ctx, awsRegion) {
+		return jsonResponse(http.StatusOK, types.NetworkResponse{Success: true, Message: regionNotEnabledMessage(friendlyRegion, awsRegion)}), nil
+	}
+
+	service, err := aws.New(ctx, awsRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to initialize AWS service", err), nil
+	}
+
+	network, err := service.FindNetwork(ctx, friendlyRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to find VPC", err), nil
+	}
+
+	message := fmt.Sprintf("No VPC in %s region", friendlyRegion)
+	switch {
+	case network != nil && network.Persistent:
+		message = fmt.Sprintf("VPC %s in %s region is kept between sessions", network.VPCID, friendlyRegion)
+	case network != nil:
+		message = fmt.Sprintf("VPC %s in %s region goes with the next stop", network.VPCID, friendlyRegion)
+	}
+
+	response := types.NetworkResponse{
+		Success: true,
+		Message: message,
+		Network: network,
+	}
+
+	return jsonResponse(http.StatusOK, response), nil
+}
+
+// handleKeepNetwork makes a region's VPC stack persistent, building it first if
+// the region has none. It holds the start lock, so it can't build a second
+// stack next to the one a start is building.
+func handleKeepNetwork(ctx context.Context, friendlyRegion string) (events.LambdaFunctionURLResponse, error) {
+	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+	if err != nil {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+	}
+	if !regionEnabled(ctx, awsRegion) {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionDisabled, regionNotEnabledMessage(friendlyRegion, awsRegion)), nil
+	}
+
+	service, err := aws.New(ctx, awsRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to initialize AWS service", err), nil
+	}
+
+	release, err := acquireStartLock(ctx, friendlyRegion)
+	if errors.Is(err, store.ErrLockHeld) {
+		return codedErrorResponse(http.StatusConflict, types.ErrorCodeStartInProgress, fmt.Sprintf("A start is in progress in %s region", friendlyRegion)), nil
+	}
+	if err != nil {
+		return awsErrorResponse("Failed to lock region", err), nil
+	}
+	defer release()
+
+	network, err := service.KeepNetwork(ctx, friendlyRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to keep VPC", err), nil
+	}
+
+	log.Printf("Keeping VPC %s in %s between sessions", network.VPCID, friendlyRegion)
+
+	response := types.NetworkResponse{
+		Success: true,
+		Message: fmt.Sprintf("Keeping VPC %s in %s region between sessions", network.VPCID, friendlyRegion),
+		Network: network,
+	}
+
+	return jsonResponse(http.StatusOK, response), nil
+}
+
+// handleReleaseNetwork stops keeping a region's VPC stack, deleting it if no
+// node uses it. Releasing when there's no VPC succeeds, as unreserve does.
+func handleReleaseNetwork(ctx context.Context, friendlyRegion string) (events.LambdaFunctionURLResponse, error) {
+	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+	if err != nil {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+	}
+	if !regionEnabled(ctx, awsRegion) {
+		return jsonResponse(http.StatusOK, types.NetworkResponse{Success: true, Message: regionNotEnabledMessage(friendlyRegion, awsRegion)}), nil
+	}
+
+	service, err := aws.New(ctx, awsRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to initialize AWS service", err), nil
+	}
+
+	// A start launching into the VPC would hold it, and its node lose its network
+	release, err := acquireStartLock(ctx, friendlyRegion)
+	if errors.Is(err, store.ErrLockHeld) {
+		return codedErrorResponse(http.StatusConflict, types.ErrorCodeStartInProgress, fmt.Sprintf("A start is in progress in %s region", friendlyRegion)), nil
+	}
+	if err != nil {
+		return awsErrorResponse("Failed to lock region", err), nil
+	}
+	defer release()
+
+	network, removed, err := service.ReleaseNetwork(ctx, friendlyRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to release VPC", err), nil
+	}
+
+	message := fmt.Sprintf("No VPC in %s region", friendlyRegion)
+	switch {
+	case removed:
+		message = fmt.Sprintf("Removed VPC %s in %s region", network.VPCID, friendlyRegion)
+		log.Printf("Released and removed VPC %s in %s", network.VPCID, friendlyRegion)
+	case network != nil:
+		message = fmt.Sprintf("Released VPC %s in %s region; it goes with the next stop", network.VPCID, friendlyRegion)
+		log.Printf("Released VPC %s in %s", network.VPCID, friendlyRegion)
+	}
+
+	response := types.NetworkResponse{
+		Success: true,
+		Message: message,
+		Network: network,
+		Removed: removed,
+	}
+
+	return jsonResponse(http.StatusOK, response), nil
+}
@@ -0,0 +1,239 @@
+// Package notify posts exit node lifecycle events to webhooks (Slack, Discord,
+// ntfy, or any endpoint that accepts a JSON POST).
+//
+// Webhooks are configured with TSE_WEBHOOKS, a comma-separated list of URLs.
+// The format is picked from the host (hooks.slack.com, discord.com, ntfy.sh) or
+// from an explicit scheme prefix such as "ntfy+https://ntfy.example.com/topic"
+// for self-hosted servers. Anything else receives the Event as JSON.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnvWebhooks names the environment variable holding webhook URLs
+const EnvWebhooks = "TSE_WEBHOOKS"
+
+// Event types
+const (
+	EventNodeStarted = "node.started" // Exit node launched
+	EventNodeStopped = "node.stopped" // Exit nodes terminated on request
+	EventNodeFailed  = "node.failed"  // Launch failed, or the node never reported ready
+	EventNodeReaped  = "node.reaped"  // Exit node terminated automatically
+	EventNodeAnomaly = "node.anomaly" // Exit node tse would never have launched
+)
+
+// Webhook formats
+const (
+	FormatJSON    = "json"
+	FormatSlack   = "slack"
+	FormatDiscord = "discord"
+	FormatNtfy    = "ntfy"
+)
+
+// sendTimeout bounds each webhook call so a slow endpoint can't stall the request
+const sendTimeout = 5 * time.Second
+
+// Event describes one lifecycle event
+type Event struct {
+	Type        string    `json:"type"`
+	Region      string    `json:"region"`
+	InstanceIDs []string  `json:"instance_ids,omitempty"`
+	Message     string    `json:"message"`
+	Time        time.Time `json:"time"`
+}
+
+// Summary renders the event as a one-line human-readable message
+func (e Event) Summary() string {
+	icon := "ℹ️"
+	switch e.Type {
+	case EventNodeStarted:
+		icon = "🟢"
+	case EventNodeStopped:
+		icon = "⚪"
+	case EventNodeFailed:
+		icon = "🔴"
+	case EventNodeReaped:
+		icon = "🧹"
+	case EventNodeAnomaly:
+		icon = "🚨"
+	}
+
+	summary := fmt.Sprintf("%s [tse] %s", icon, e.Message)
+	if len(e.InstanceIDs) > 0 {
+		summary += fmt.Sprintf(" (%s)", strings.Join(e.InstanceIDs, ", "))
+	}
+	return summary
+}
+
+// Webhook is a single notification target
+type Webhook struct {
+	URL    string
+	Format string
+}
+
+// Notifier delivers events to every configured webhook.
+// A nil Notifier is valid and drops all events.
+type Notifier struct {
+	webhooks []Webhook
+	client   *http.Client
+}
+
+// New creates a notifier for the given webhook URLs
+func New(urls []string) (*Notifier, error) {
+	var webhooks []Webhook
+	for _, raw := range urls {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		webhook, err := ParseWebhook(raw)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if len(webhooks) == 0 {
+		return nil, nil
+	}
+
+	return &Notifier{
+		webhooks: webhooks,
+		client:   &http.Client{Timeout: sendTimeout},
+	}, nil
+}
+
+// FromEnv creates a notifier from TSE_WEBHOOKS. Returns nil when none are configured.
+func FromEnv() (*Notifier, error) {
+	value := os.Getenv(EnvWebhooks)
+	if value == "" {
+		return nil, nil
+	}
+	return New(strings.Split(value, ","))
+}
+
+// ParseWebhook determines a webhook's format from an optional "<format>+" scheme
+// prefix, falling back to well-known hosts and then generic JSON
+func ParseWebhook(raw string) (Webhook, error) {
+	format := ""
+	if prefix, rest, ok := strings.Cut(raw, "+"); ok && !strings.Contains(prefix, "/") {
+		format = prefix
+		raw = rest
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return Webhook{}, fmt.Errorf("invalid webhook URL %q", redact(raw))
+	}
+
+	if format == "" {
+		switch host := strings.ToLower(u.Hostname()); {
+		case host == "hooks.slack.com":
+			format = FormatSlack
+		case host == "discord.com" || host == "discordapp.com":
+			format = FormatDiscord
+		case host == "ntfy.sh":
+			format = FormatNtfy
+		default:
+			format = FormatJSON
+		}
+	}
+
+	switch format {
+	case FormatJSON, FormatSlack, FormatDiscord, FormatNtfy:
+	default:
+		return Webhook{}, fmt.Errorf("unknown webhook format %q (use json, slack, discord, or ntfy)", format)
+	}
+
+	return Webhook{URL: raw, Format: format}, nil
+}
+
+// Notify sends the event to every webhook concurrently and waits for them, since
+// the Lambda may be frozen as soon as the request returns. Failures are logged.
+func (n *Notifier) Notify(ctx context.Context, event Event) {
+	if n == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	var wg sync.WaitGroup
+	for _, webhook := range n.webhooks {
+		wg.Add(1)
+		go func(webhook Webhook) {
+			defer wg.Done()
+			if err := n.send(ctx, webhook, event); err != nil {
+				log.Printf("Webhook %s (%s) failed for %s: %v", redact(webhook.URL), webhook.Format, event.Type, err)
+			}
+		}(webhook)
+	}
+	wg.Wait()
+}
+
+// send delivers one event to one webhook in its native format
+func (n *Notifier) send(ctx context.Context, webhook Webhook, event Event) error {
+	var body []byte
+	var err error
+	contentType := "application/json"
+
+	switch webhook.Format {
+	case FormatSlack:
+		body, err = json.Marshal(map[string]string{"text": event.Summary()})
+	case FormatDiscord:
+		body, err = json.Marshal(map[string]string{"content": event.Summary()})
+	case FormatNtfy:
+		body = []byte(event.Summary())
+		contentType = "text/plain; charset=utf-8"
+	default:
+		body, err = json.Marshal(event)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if webhook.Format == FormatNtfy {
+		req.Header.Set("Title", "tse: "+event.Type)
+		req.Header.Set("Tags", event.Type)
+		if event.Type == EventNodeFailed {
+			req.Header.Set("Priority", "high")
+		}
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// redact strips the path and query from a webhook URL for logging, since Slack
+// and Discord embed their secret in the path
+func redact(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "<invalid>"
+	}
+	return u.Scheme + "://" + u.Host + "/…"
+}
@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseWebhook(t *testing.T) {
+	tests := []struct {
+		raw        string
+		wantURL    string
+		wantFormat string
+		wantErr    bool
+	}{
+		{raw: "https://hooks.slack.com/services/T000/B000/XXXX", wantURL: "https://hooks.slack.com/services/T000/B000/XXXX", wantFormat: FormatSlack},
+		{raw: "https://discord.com/api/webhooks/123/abc", wantURL: "https://discord.com/api/webhooks/123/abc", wantFormat: FormatDiscord},
+		{raw: "https://ntfy.sh/my-exit-nodes", wantURL: "https://ntfy.sh/my-exit-nodes", wantFormat: FormatNtfy},
+		{raw: "ntfy+https://ntfy.example.com/tse", wantURL: "https://ntfy.example.com/tse", wantFormat: FormatNtfy},
+		{raw: "https://example.com/hook?token=a+b", wantURL: "https://example.com/hook?token=a+b", wantFormat: FormatJSON},
+		{raw: "carrier-pigeon+https://example.com/hook", wantErr: true},
+		{raw: "ftp://example.com/hook", wantErr: true},
+		{raw: "not a url", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			webhook, err := ParseWebhook(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %+v", webhook)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if webhook.URL != tt.wantURL || webhook.Format != tt.wantFormat {
+				t.Errorf("ParseWebhook() = %+v, want %s %s", webhook, tt.wantFormat, tt.wantURL)
+			}
+		})
+	}
+}
+
+func TestNewWithNoWebhooks(t *testing.T) {
+	n, err := New([]string{"", "  "})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != nil {
+		t.Errorf("expected nil notifier when no webhooks are configured")
+	}
+
+	// A nil notifier drops events without panicking
+	n.Notify(context.Background(), Event{Type: EventNodeStarted})
+}
+
+type received struct {
+	contentType string
+	title       string
+	body        string
+}
+
+func TestNotifyFormats(t *testing.T) {
+	var mu sync.Mutex
+	got := map[string]received{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got[r.URL.Path] = received{r.Header.Get("Content-Type"), r.Header.Get("Title"), string(body)}
+		mu.Unlock()
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	n, err := New([]string{
+		"slack+" + server.URL + "/slack",
+		"discord+" + server.URL + "/discord",
+		"ntfy+" + server.URL + "/ntfy",
+		server.URL + "/json",
+		server.URL + "/broken",
+	})
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+
+	n.Notify(context.Background(), Event{
+		Type:        EventNodeStarted,
+		Region:      "ohio",
+		InstanceIDs: []string{"i-0123456789abcdef0"},
+		Message:     "Exit node started in ohio",
+	})
+
+	if len(got) != 5 {
+		t.Fatalf("got %d deliveries, want 5: %v", len(got), got)
+	}
+
+	var slack map[string]string
+	if err := json.Unmarshal([]byte(got["/slack"].body), &slack); err != nil || !strings.Contains(slack["text"], "Exit node started in ohio") {
+		t.Errorf("slack payload = %s", got["/slack"].body)
+	}
+
+	var discord map[string]string
+	if err := json.Unmarshal([]byte(got["/discord"].body), &discord); err != nil || !strings.Contains(discord["content"], "i-0123456789abcdef0") {
+		t.Errorf("discord payload = %s", got["/discord"].body)
+	}
+
+	ntfy := got["/ntfy"]
+	if !strings.HasPrefix(ntfy.contentType, "text/plain") || ntfy.title != "tse: node.started" || !strings.Contains(ntfy.body, "ohio") {
+		t.Errorf("ntfy delivery = %+v", ntfy)
+	}
+
+	var event Event
+	if err := json.Unmarshal([]byte(got["/json"].body), &event); err != nil {
+		t.Fatalf("json payload is not an Event: %v", err)
+	}
+	if event.Type != EventNodeStarted || event.Region != "ohio" || event.Time.IsZero() {
+		t.Errorf("json event = %+v", event)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	got := redact("https://hooks.slack.com/services/T000/B000/SECRET")
+	if strings.Contains(got, "SECRET") {
+		t.Errorf("redact() leaked the webhook secret: %s", got)
+	}
+}
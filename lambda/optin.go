@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/anoldguy/tse/shared/regions"
+)
+
+// regionChecker looks up whether the account has enabled a region
+type regionChecker interface {
+	RegionEnabled(ctx context.Context, awsRegion string) (bool, error)
+}
+
+// optInStatus answers for opt-in regions: an EC2 service in the Lambda's own
+// region. When nil every region is assumed enabled.
+var optInStatus regionChecker
+
+// enabledRegions caches the opt-in regions found enabled for the life of the
+// container. Disabled ones are asked about again, since enabling one doesn't
+// need a redeploy.
+var enabledRegions sync.Map
+
+// regionEnabled reports whether the account can use awsRegion. Only opt-in
+// regions are looked up. If the lookup fails the region is assumed enabled, so
+// the request goes ahead and fails with AWS's own error if it isn't.
+func regionEnabled(ctx context.Context, awsRegion string) bool {
+	if optInStatus == nil || !regions.IsOptIn(awsRegion) {
+		return true
+	}
+	if _, ok := enabledRegions.Load(awsRegion); ok {
+		return true
+	}
+
+	enabled, err := optInStatus.RegionEnabled(ctx, awsRegion)
+	if err != nil {
+		log.Printf("Assuming %s is enabled: %v", awsRegion, err)
+		return true
+	}
+	if enabled {
+		enabledRegions.Store(awsRegion, true)
+	}
+	return enabled
+}
+
+// regionNotEnabledMessage explains how to enable an opt-in region
+func regionNotEnabledMessage(friendlyRegion, awsRegion string) string {
+	return fmt.Sprintf("The %s region (%s) isn't enabled for this AWS account. Enable it at %s, wait a few minutes for it to finish, then try again", friendlyRegion, awsRegion, regions.OptInURL)
+}
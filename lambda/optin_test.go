@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// fakeOptIn answers RegionEnabled from a map, counting lookups
+type fakeOptIn struct {
+	enabled map[string]bool
+	err     error
+	calls   int
+}
+
+func (f *fakeOptIn) RegionEnabled(ctx context.Context, awsRegion string) (bool, error) {
+	f.calls++
+	return f.enabled[awsRegion], f.err
+}
+
+func TestRegionEnabled(t *testing.T) {
+	ctx := context.Background()
+	if !regionEnabled(ctx, "eu-central-2") {
+		t.Error("regionEnabled without a checker = false, want true")
+	}
+
+	status := &fakeOptIn{enabled: map[string]bool{"eu-south-1": true}}
+	optInStatus = status
+	defer func() { optInStatus = nil; enabledRegions.Clear() }()
+
+	if !regionEnabled(ctx, "us-east-2") || status.calls != 0 {
+		t.Errorf("us-east-2 was looked up (%d calls); it's always enabled", status.calls)
+	}
+
+	// Enabled regions are remembered, disabled ones asked about each time
+	for range 2 {
+		if !regionEnabled(ctx, "eu-south-1") {
+			t.Error("regionEnabled(eu-south-1) = false, want true")
+		}
+		if regionEnabled(ctx, "eu-central-2") {
+			t.Error("regionEnabled(eu-central-2) = true, want false")
+		}
+	}
+	if status.calls != 3 {
+		t.Errorf("RegionEnabled called %d times, want 3", status.calls)
+	}
+
+	// A failed lookup lets the request through
+	status.err = errors.New("access denied")
+	if !regionEnabled(ctx, "af-south-1") {
+		t.Error("regionEnabled after a failed lookup = false, want true")
+	}
+}
+
+func TestHandlersOnDisabledRegion(t *testing.T) {
+	optInStatus = &fakeOptIn{}
+	defer func() { optInStatus = nil }()
+	ctx := context.Background()
+
+	// Starting there explains how to enable it
+	resp, err := handleStartInstance(ctx, rootToken, "zurich", "")
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("start in zurich = %d, %v; want 400", resp.StatusCode, err)
+	}
+	if !strings.Contains(resp.Body, "eu-central-2") || !strings.Contains(resp.Body, regions.OptInURL) {
+		t.Errorf("start error doesn't say how to enable the region: %s", resp.Body)
+	}
+
+	// Listing it finds nothing, so sweeping every region doesn't fail
+	resp, err = handleListInstances(ctx, "zurich", false)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("instances in zurich = %d, %v; want 200", resp.StatusCode, err)
+	}
+	var list types.InstancesResponse
+	if err := json.Unmarshal([]byte(resp.Body), &list); err != nil || !list.Success || list.Count != 0 {
+		t.Errorf("instances in zurich = %s", resp.Body)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/lambda/aws"
+	"github.com/anoldguy/tse/lambda/notify"
+	"github.com/anoldguy/tse/lambda/store"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// pausableInstances returns the IDs of the running exit nodes among instances;
+// EC2 can't stop one that's still pending. A multihop node's tunnel doesn't survive a reboot, so one among them is an
+// error rather than a node that would resume broken.
+func pausableInstances(instances []*types.InstanceInfo) ([]string, error) {
+	var ids []string
+	for _, instance := range instances {
+		if instance.State != "running" {
+			continue
+		}
+		if instance.Hop != "" {
+			return nil, fmt.Errorf("multihop node %s can't be paused; stop it instead", instance.InstanceID)
+		}
+		ids = append(ids, instance.InstanceID)
+	}
+	return ids, nil
+}
+
+// pausedInstances returns the IDs of the stopped exit nodes among instances
+func pausedInstances(instances []*types.InstanceInfo) []string {
+	var ids []string
+	for _, instance := range instances {
+		if instance.State == "stopped" {
+			ids = append(ids, instance.InstanceID)
+		}
+	}
+	return ids
+}
+
+// handlePauseInstances stops a region's exit nodes without terminating them
+func handlePauseInstances(ctx context.Context, friendlyRegion string) (events.LambdaFunctionURLResponse, error) {
+	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+	if err != nil {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+	}
+	if !regionEnabled(ctx, awsRegion) {
+		return jsonResponse(http.StatusOK, types.PauseResponse{Success: true, Message: regionNotEnabledMessage(friendlyRegion, awsRegion)}), nil
+	}
+
+	service, err := aws.New(ctx, awsRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to initialize AWS service", err), nil
+	}
+
+	instances, err := service.ListInstances(ctx)
+	if err != nil {
+		return awsErrorResponse("Failed to list instances", err), nil
+	}
+	ids, err := pausableInstances(instances)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error()), nil
+	}
+	if len(ids) == 0 {
+		return jsonResponse(http.StatusOK, types.PauseResponse{Success: true, Message: fmt.Sprintf("No running exit node to pause in %s region", friendlyRegion)}), nil
+	}
+
+	if err := service.PauseInstances(ctx, ids); err != nil {
+		return awsErrorResponse("Failed to pause instances", err), nil
+	}
+	recordNodeStates(ctx, instances, ids, "stopped")
+
+	notifier.Notify(ctx, notify.Event{
+		Type:        notify.EventNodeStopped,
+		Region:      friendlyRegion,
+		InstanceIDs: ids,
+		Message:     fmt.Sprintf("Exit node paused in %s", friendlyRegion),
+	})
+
+	response := types.PauseResponse{
+		Success:     true,
+		Message:     fmt.Sprintf("Paused %d instances in %s region", len(ids), friendlyRegion),
+		InstanceIDs: ids,
+	}
+	return jsonResponse(http.StatusOK, response), nil
+}
+
+// handleResumeInstances starts a region's paused exit nodes again. It holds
+// the start lock, so a resume and a start can't race each other, and answers
+// to the same caps and token limits as a start.
+func handleResumeInstances(ctx context.Context, caller *types.TokenInfo, friendlyRegion string) (events.LambdaFunctionURLResponse, error) {
+	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+	if err != nil {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+	}
+	if !regionEnabled(ctx, awsRegion) {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionDisabled, regionNotEnabledMessage(friendlyRegion, awsRegion)), nil
+	}
+	if response, ok := startLimitResponse(ctx, caller, friendlyRegion); !ok {
+		return response, nil
+	}
+
+	service, err := aws.New(ctx, awsRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to initialize AWS service", err), nil
+	}
+
+	release, err := acquireStartLock(ctx, friendlyRegion)
+	if errors.Is(err, store.ErrLockHeld) {
+		return codedErrorResponse(http.StatusConflict, types.ErrorCodeStartInProgress, fmt.Sprintf("Another start is already in progress in %s region", friendlyRegion)), nil
+	}
+	if err != nil {
+		return awsErrorResponse("Failed to lock region for resume", err), nil
+	}
+	defer release()
+
+	// Paused nodes count against the cap, but one may have been lowered, or
+	// other nodes started, since this one was paused
+	releaseCap, refusal, ok := lockNodeCap(ctx, caller, friendlyRegion)
+	if !ok {
+		return refusal, nil
+	}
+	defer releaseCap()
+
+	instances, err := service.ListInstances(ctx)
+	if err != nil {
+		return awsErrorResponse("Failed to list instances", err), nil
+	}
+	ids := pausedInstances(instances)
+	if len(ids) == 0 {
+		return codedErrorResponse(http.StatusNotFound, types.ErrorCodeNothingPaused, fmt.Sprintf("No paused exit node in %s region", friendlyRegion)), nil
+	}
+
+	if err := service.ResumeInstances(ctx, ids); err != nil {
+		notifier.Notify(ctx, notify.Event{
+			Type:    notify.EventNodeFailed,
+			Region:  friendlyRegion,
+			Message: fmt.Sprintf("Failed to resume exit node in %s: %v", friendlyRegion, err),
+		})
+		return awsErrorResponse("Failed to resume instances", err), nil
+	}
+	recordNodeStates(ctx, instances, ids, "pending")
+
+	notifier.Notify(ctx, notify.Event{
+		Type:        notify.EventNodeStarted,
+		Region:      friendlyRegion,
+		InstanceIDs: ids,
+		Message:     fmt.Sprintf("Exit node resumed in %s", friendlyRegion),
+	})
+
+	response := types.PauseResponse{
+		Success:     true,
+		Message:     fmt.Sprintf("Resumed %d instances in %s region", len(ids), friendlyRegion),
+		InstanceIDs: ids,
+	}
+	return jsonResponse(http.StatusOK, response), nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func TestPausableInstances(t *testing.T) {
+	instances := []*types.InstanceInfo{
+		{InstanceID: "i-running", State: "running"},
+		{InstanceID: "i-booting", State: "pending"},
+		{InstanceID: "i-paused", State: "stopped"},
+	}
+
+	ids, err := pausableInstances(instances)
+	if err != nil || !slices.Equal(ids, []string{"i-running"}) {
+		t.Errorf("pausableInstances() = %v, %v; want only the running node", ids, err)
+	}
+	if got := pausedInstances(instances); !slices.Equal(got, []string{"i-paused"}) {
+		t.Errorf("pausedInstances() = %v", got)
+	}
+
+	instances = append(instances, &types.InstanceInfo{InstanceID: "i-hop", State: "running", Hop: "entry:frankfurt"})
+	if _, err := pausableInstances(instances); err == nil {
+		t.Error("pausableInstances() accepted a multihop node")
+	}
+}
+
+func TestResumeAnswersToStartLimits(t *testing.T) {
+	ctx := context.Background()
+	defer func(saved func(context.Context, []string) ([]*types.InstanceInfo, error)) { listNodes = saved }(listNodes)
+	listNodes = func(ctx context.Context, friendlyRegions []string) ([]*types.InstanceInfo, error) {
+		return []*types.InstanceInfo{{InstanceID: "i-1", FriendlyRegion: "frankfurt"}}, nil
+	}
+	partner := &types.TokenInfo{ID: "3f9a2c1b7d4e", Name: "partner", TokenLimits: types.TokenLimits{Regions: []string{"ohio"}}}
+
+	tests := []struct {
+		name     string
+		maxNodes string
+		caller   *types.TokenInfo
+		region   string
+		status   int
+		code     types.ErrorCode
+	}{
+		{"region not allowed", "", partner, "tokyo", http.StatusForbidden, types.ErrorCodeRegionNotAllowed},
+		{"at the cap", "1", rootToken, "ohio", http.StatusConflict, types.ErrorCodeNodeCap},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(envMaxNodes, tt.maxNodes)
+			resp, _ := handleResumeInstances(ctx, tt.caller, tt.region)
+			var errorResp types.ErrorResponse
+			json.Unmarshal([]byte(resp.Body), &errorResp)
+			if resp.StatusCode != tt.status || errorResp.ErrorCode != tt.code {
+				t.Errorf("resume in %s = %d %s, want %d %s", tt.region, resp.StatusCode, errorResp.ErrorCode, tt.status, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+// Package ratelimit provides per-client token-bucket rate limiting with
+// exponential lockouts after repeated authentication failures.
+//
+// State lives in memory, so limits apply per warm Lambda container. That's
+// enough to make brute-forcing the bearer token impractical: every guess costs
+// a token, and repeated failures lock the source IP out for exponentially
+// longer periods.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/anoldguy/tse/shared/regions"
+)
+
+// Config controls the limiter's behavior
+type Config struct {
+	Rate        float64       // Tokens refilled per second
+	Burst       int           // Bucket capacity
+	MaxFailures int           // Consecutive auth failures before a lockout
+	BaseLockout time.Duration // First lockout duration; doubles with each subsequent lockout
+	MaxLockout  time.Duration // Upper bound on lockout duration
+}
+
+// burstHeadroom is room in the bucket beyond one request per region, for the
+// calls around a fan-out such as the status check before a shutdown
+const burstHeadroom = 10
+
+// DefaultConfig allows bursts big enough for `tse shutdown` fanning out to every
+// region, while locking out clients that keep presenting bad tokens
+var DefaultConfig = Config{
+	Rate:        2,
+	Burst:       len(regions.All()) + burstHeadroom,
+	MaxFailures: 5,
+	BaseLockout: time.Minute,
+	MaxLockout:  time.Hour,
+}
+
+// idleTTL is how long an untouched client entry is kept before being pruned
+const idleTTL = time.Hour
+
+// pruneThreshold is the number of tracked clients above which idle entries are pruned
+const pruneThreshold = 10000
+
+type client struct {
+	tokens      float64
+	last        time.Time
+	failures    int
+	lockouts    int
+	lockedUntil time.Time
+}
+
+// Limiter tracks request budgets and auth failures per client key (typically source IP)
+type Limiter struct {
+	mu      sync.Mutex
+	cfg     Config
+	clients map[string]*client
+	now     func() time.Time
+}
+
+// New creates a limiter with the given configuration
+func New(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:     cfg,
+		clients: make(map[string]*client),
+		now:     time.Now,
+	}
+}
+
+// Allow reports whether a request from key may proceed. When it may not, the
+// returned duration is how long the client should wait before retrying.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	c := l.get(key, now)
+
+	if now.Before(c.lockedUntil) {
+		return false, c.lockedUntil.Sub(now)
+	}
+
+	// Refill the bucket for the time elapsed since the last request
+	c.tokens += now.Sub(c.last).Seconds() * l.cfg.Rate
+	if c.tokens > float64(l.cfg.Burst) {
+		c.tokens = float64(l.cfg.Burst)
+	}
+	c.last = now
+
+	if c.tokens < 1 {
+		wait := time.Duration((1 - c.tokens) / l.cfg.Rate * float64(time.Second))
+		return false, wait
+	}
+
+	c.tokens--
+	return true, 0
+}
+
+// RecordFailure notes a failed authentication from key. If this pushes the client
+// over MaxFailures, it is locked out and the lockout duration is returned (zero otherwise).
+func (l *Limiter) RecordFailure(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	c := l.get(key, now)
+
+	c.failures++
+	if c.failures < l.cfg.MaxFailures {
+		return 0
+	}
+
+	lockout := l.cfg.BaseLockout << c.lockouts
+	if lockout <= 0 || lockout > l.cfg.MaxLockout {
+		lockout = l.cfg.MaxLockout
+	}
+
+	c.lockouts++
+	c.failures = 0
+	c.lockedUntil = now.Add(lockout)
+
+	return lockout
+}
+
+// RecordSuccess clears the failure history for key after a successful authentication
+func (l *Limiter) RecordSuccess(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if c, ok := l.clients[key]; ok {
+		c.failures = 0
+		c.lockouts = 0
+	}
+}
+
+// get returns the client entry for key, creating it with a full bucket if needed
+func (l *Limiter) get(key string, now time.Time) *client {
+	c, ok := l.clients[key]
+	if ok {
+		return c
+	}
+
+	if len(l.clients) >= pruneThreshold {
+		l.prune(now)
+	}
+
+	c = &client{tokens: float64(l.cfg.Burst), last: now}
+	l.clients[key] = c
+	return c
+}
+
+// prune drops entries that are idle and not locked out
+func (l *Limiter) prune(now time.Time) {
+	for key, c := range l.clients {
+		if now.Sub(c.last) > idleTTL && now.After(c.lockedUntil) {
+			delete(l.clients, key)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anoldguy/tse/shared/regions"
+)
+
+// fakeClock lets tests advance time deterministically
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(cfg Config) (*Limiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := New(cfg)
+	l.now = clock.now
+	return l, clock
+}
+
+func TestDefaultConfigCoversShutdownFanOut(t *testing.T) {
+	l, _ := newTestLimiter(DefaultConfig)
+
+	// A status check, then one stop per region
+	for i := 0; i <= len(regions.All()); i++ {
+		if ok, _ := l.Allow("1.2.3.4"); !ok {
+			t.Fatalf("request %d of a shutdown across %d regions was rejected", i+1, len(regions.All()))
+		}
+	}
+}
+
+func TestAllowTokenBucket(t *testing.T) {
+	l, clock := newTestLimiter(Config{Rate: 1, Burst: 3, MaxFailures: 5, BaseLockout: time.Minute, MaxLockout: time.Hour})
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("1.2.3.4"); !ok {
+			t.Fatalf("request %d within burst was rejected", i+1)
+		}
+	}
+
+	ok, wait := l.Allow("1.2.3.4")
+	if ok {
+		t.Fatalf("request beyond burst was allowed")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("retry wait = %v, want within (0, 1s]", wait)
+	}
+
+	// Other clients have their own bucket
+	if ok, _ := l.Allow("5.6.7.8"); !ok {
+		t.Errorf("different client was rejected")
+	}
+
+	// Refill after a second
+	clock.advance(time.Second)
+	if ok, _ := l.Allow("1.2.3.4"); !ok {
+		t.Errorf("request after refill was rejected")
+	}
+}
+
+func TestLockoutBackoff(t *testing.T) {
+	l, clock := newTestLimiter(Config{Rate: 100, Burst: 100, MaxFailures: 3, BaseLockout: time.Minute, MaxLockout: 3 * time.Minute})
+
+	tests := []struct {
+		name        string
+		wantLockout time.Duration
+	}{
+		{"first lockout", time.Minute},
+		{"second lockout doubles", 2 * time.Minute},
+		{"third lockout capped", 3 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lockout time.Duration
+			for i := 0; i < 3; i++ {
+				lockout = l.RecordFailure("1.2.3.4")
+				if i < 2 && lockout != 0 {
+					t.Fatalf("locked out after only %d failures", i+1)
+				}
+			}
+			if lockout != tt.wantLockout {
+				t.Fatalf("lockout = %v, want %v", lockout, tt.wantLockout)
+			}
+
+			if ok, wait := l.Allow("1.2.3.4"); ok || wait != tt.wantLockout {
+				t.Errorf("Allow() during lockout = (%v, %v), want (false, %v)", ok, wait, tt.wantLockout)
+			}
+
+			clock.advance(tt.wantLockout)
+			if ok, _ := l.Allow("1.2.3.4"); !ok {
+				t.Errorf("still locked out after lockout expired")
+			}
+		})
+	}
+}
+
+func TestRecordSuccessResetsBackoff(t *testing.T) {
+	l, clock := newTestLimiter(Config{Rate: 100, Burst: 100, MaxFailures: 2, BaseLockout: time.Minute, MaxLockout: time.Hour})
+
+	l.RecordFailure("1.2.3.4")
+	l.RecordFailure("1.2.3.4") // first lockout: 1m
+	clock.advance(time.Minute)
+	l.RecordSuccess("1.2.3.4")
+
+	l.RecordFailure("1.2.3.4")
+	if lockout := l.RecordFailure("1.2.3.4"); lockout != time.Minute {
+		t.Errorf("lockout after success = %v, want backoff reset to %v", lockout, time.Minute)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/anoldguy/tse/lambda/aws"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// nodeRegistry is the subset of the state store that registers exit nodes
+type nodeRegistry interface {
+	RecordNode(ctx context.Context, node *types.InstanceInfo, at time.Time) error
+	ForgetNodes(ctx context.Context, instanceIDs []string, at time.Time) error
+	Nodes(ctx context.Context) ([]*types.InstanceInfo, time.Time, error)
+	ReconcileNodes(ctx context.Context, listedAt time.Time, awsRegions []string, listed []*types.InstanceInfo, complete bool) error
+}
+
+// registry records the exit nodes the Lambda starts and stops, so a question
+// about every region (the node cap, say) takes one read instead of a
+// DescribeInstances per region. Nil when no state table is configured.
+var registry nodeRegistry
+
+// registryMaxAge is how long after the registry last matched EC2 in every
+// region it's trusted on its own. Nodes changed outside tse (terminated from
+// the console, say) are only noticed when it's next reconciled: by the
+// scheduled sweep every 15 minutes, or by a listing of every region once it's
+// older than this.
+const registryMaxAge = 30 * time.Minute
+
+// registerNode records a node the Lambda started. A failure is only logged;
+// the next reconciliation finds the node anyway.
+func registerNode(ctx context.Context, node *types.InstanceInfo) {
+	if registry == nil {
+		return
+	}
+	if err := registry.RecordNode(context.WithoutCancel(ctx), node, time.Now()); err != nil {
+		log.Printf("Node registry: %v", err)
+	}
+}
+
+// unregisterNodes records nodes the Lambda terminated, like registerNode
+func unregisterNodes(ctx context.Context, instanceIDs []string) {
+	if registry == nil || len(instanceIDs) == 0 {
+		return
+	}
+	if err := registry.ForgetNodes(context.WithoutCancel(ctx), instanceIDs, time.Now()); err != nil {
+		log.Printf("Node registry: %v", err)
+	}
+}
+
+// recordNodeStates records the state a pause or resume left nodes in: the
+// instances among ids, now in state. Like registerNode, failures are only logged.
+func recordNodeStates(ctx context.Context, instances []*types.InstanceInfo, ids []string, state string) {
+	for _, instance := range instances {
+		if slices.Contains(ids, instance.InstanceID) {
+			node := *instance
+			node.State = state
+			registerNode(ctx, &node)
+		}
+	}
+}
+
+// occupiedRegions returns the regions among friendlyRegions that may have exit
+// nodes: those the registry has nodes in while it can be trusted, otherwise all
+// of them. Listing or stopping every region asks EC2 only in these.
+func occupiedRegions(ctx context.Context, friendlyRegions []string) []string {
+	nodes, ok := registeredNodes(ctx, friendlyRegions)
+	if !ok {
+		return friendlyRegions
+	}
+	return slices.DeleteFunc(slices.Clone(friendlyRegions), func(friendlyRegion string) bool {
+		awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+		return err != nil || !slices.ContainsFunc(nodes, func(node *types.InstanceInfo) bool {
+			return node.Region == awsRegion
+		})
+	})
+}
+
+// registeredNodes returns the registered nodes in the given regions, and false
+// if the registry can't answer: there's none, it can't be read, or it hasn't
+// matched EC2 recently enough to trust
+func registeredNodes(ctx context.Context, friendlyRegions []string) ([]*types.InstanceInfo, bool) {
+	if registry == nil {
+		return nil, false
+	}
+	nodes, reconciled, err := registry.Nodes(ctx)
+	if err != nil {
+		log.Printf("Node registry: %v; asking EC2", err)
+		return nil, false
+	}
+	if time.Since(reconciled) > registryMaxAge {
+		return nil, false
+	}
+
+	awsRegions := awsRegionsOf(friendlyRegions)
+	return slices.DeleteFunc(nodes, func(node *types.InstanceInfo) bool {
+		return !slices.Contains(awsRegions, node.Region)
+	}), true
+}
+
+// reconcileRegistry makes the registry match what EC2 listed at listedAt in
+// awsRegions, marking it reconciled if they're every region
+func reconcileRegistry(ctx context.Context, listedAt time.Time, awsRegions []string, listed []*types.InstanceInfo) {
+	if registry == nil {
+		return
+	}
+	complete := len(awsRegions) == len(awsRegionsOf(regions.GetAllFriendlyNames()))
+	if err := registry.ReconcileNodes(ctx, listedAt, awsRegions, listed, complete); err != nil {
+		log.Printf("Node registry: %v", err)
+	}
+}
+
+// awsRegionsOf returns the AWS regions the friendly names map to, each once,
+// skipping names that don't map to one
+func awsRegionsOf(friendlyRegions []string) []string {
+	var awsRegions []string
+	for _, friendlyRegion := range friendlyRegions {
+		awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+		if err == nil && !slices.Contains(awsRegions, awsRegion) {
+			awsRegions = append(awsRegions, awsRegion)
+		}
+	}
+	return awsRegions
+}
+
+// awsRegionNodes lists the exit nodes in an AWS region; none if the account
+// hasn't enabled it
+func awsRegionNodes(ctx context.Context, awsRegion string) ([]*types.InstanceInfo, error) {
+	if !regionEnabled(ctx, awsRegion) {
+		return nil, nil
+	}
+	service, err := aws.New(ctx, awsRegion)
+	if err != nil {
+		return nil, err
+	}
+	return service.ListInstances(ctx)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// fakeRegistry keeps registered nodes in memory, reconciled at reconciled
+type fakeRegistry struct {
+	nodes      map[string]*types.InstanceInfo
+	reconciled time.Time
+	complete   []bool // Each reconciliation's complete flag
+	err        error
+}
+
+func (f *fakeRegistry) RecordNode(ctx context.Context, node *types.InstanceInfo, at time.Time) error {
+	f.nodes[node.InstanceID] = node
+	return nil
+}
+
+func (f *fakeRegistry) ForgetNodes(ctx context.Context, instanceIDs []string, at time.Time) error {
+	for _, instanceID := range instanceIDs {
+		delete(f.nodes, instanceID)
+	}
+	return nil
+}
+
+func (f *fakeRegistry) Nodes(ctx context.Context) ([]*types.InstanceInfo, time.Time, error) {
+	var nodes []*types.InstanceInfo
+	for _, node := range f.nodes {
+		nodes = append(nodes, node)
+	}
+	return nodes, f.reconciled, f.err
+}
+
+func (f *fakeRegistry) ReconcileNodes(ctx context.Context, listedAt time.Time, awsRegions []string, listed []*types.InstanceInfo, complete bool) error {
+	f.complete = append(f.complete, complete)
+	return nil
+}
+
+func TestRegisteredNodes(t *testing.T) {
+	ctx := context.Background()
+	defer func(saved nodeRegistry) { registry = saved }(registry)
+
+	registry = nil
+	if _, ok := registeredNodes(ctx, []string{"ohio"}); ok {
+		t.Error("registeredNodes() answered without a registry")
+	}
+
+	fake := &fakeRegistry{nodes: map[string]*types.InstanceInfo{}, reconciled: time.Now().Add(-time.Minute)}
+	registry = fake
+	registerNode(ctx, &types.InstanceInfo{InstanceID: "i-1", Region: "us-east-2", FriendlyRegion: "ohio"})
+	registerNode(ctx, &types.InstanceInfo{InstanceID: "i-2", Region: "ap-northeast-1", FriendlyRegion: "tokyo"})
+	registerNode(ctx, &types.InstanceInfo{InstanceID: "i-3", Region: "eu-central-1", FriendlyRegion: "frankfurt"})
+	unregisterNodes(ctx, []string{"i-3"})
+
+	nodes, ok := registeredNodes(ctx, []string{"ohio", "frankfurt"})
+	if !ok || len(nodes) != 1 || nodes[0].InstanceID != "i-1" {
+		t.Errorf("registeredNodes(ohio, frankfurt) = %v, %v; want i-1", nodes, ok)
+	}
+
+	// listNodes answers from a fresh registry without asking EC2
+	if nodes, err := listNodes(ctx, []string{"tokyo"}); err != nil || len(nodes) != 1 || nodes[0].InstanceID != "i-2" {
+		t.Errorf("listNodes(tokyo) = %v, %v; want i-2 from the registry", nodes, err)
+	}
+
+	fake.reconciled = time.Now().Add(-registryMaxAge - time.Minute)
+	if _, ok := registeredNodes(ctx, []string{"ohio"}); ok {
+		t.Error("registeredNodes() trusted a stale registry")
+	}
+	fake.reconciled, fake.err = time.Now(), errors.New("throttled")
+	if _, ok := registeredNodes(ctx, []string{"ohio"}); ok {
+		t.Error("registeredNodes() answered despite a read error")
+	}
+}
+
+func TestReconcileRegistryComplete(t *testing.T) {
+	defer func(saved nodeRegistry) { registry = saved }(registry)
+	fake := &fakeRegistry{nodes: map[string]*types.InstanceInfo{}}
+	registry = fake
+
+	reconcileRegistry(context.Background(), time.Now(), []string{"us-east-2"}, nil)
+	reconcileRegistry(context.Background(), time.Now(), awsRegionsOf(regions.GetAllFriendlyNames()), nil)
+	if !slices.Equal(fake.complete, []bool{false, true}) {
+		t.Errorf("reconciliations complete = %v, want [false true]", fake.complete)
+	}
+}
+
+func TestOccupiedRegions(t *testing.T) {
+	ctx := context.Background()
+	defer func(saved nodeRegistry) { registry = saved }(registry)
+	all := []string{"frankfurt", "ohio", "tokyo"}
+
+	registry = nil
+	if got := occupiedRegions(ctx, all); !slices.Equal(got, all) {
+		t.Errorf("occupiedRegions() without a registry = %v, want every region", got)
+	}
+
+	fake := &fakeRegistry{nodes: map[string]*types.InstanceInfo{}, reconciled: time.Now()}
+	registry = fake
+	registerNode(ctx, &types.InstanceInfo{InstanceID: "i-1", Region: "ap-northeast-1", State: "running"})
+	if got := occupiedRegions(ctx, all); !slices.Equal(got, []string{"tokyo"}) {
+		t.Errorf("occupiedRegions() = %v, want [tokyo]", got)
+	}
+
+	// A paused node still costs storage and must be found
+	instances := []*types.InstanceInfo{{InstanceID: "i-1", Region: "ap-northeast-1", State: "running"}}
+	recordNodeStates(ctx, instances, []string{"i-1"}, "stopped")
+	if fake.nodes["i-1"].State != "stopped" || instances[0].State != "running" {
+		t.Errorf("recorded state %q (listing changed to %q), want stopped", fake.nodes["i-1"].State, instances[0].State)
+	}
+	if got := occupiedRegions(ctx, all); !slices.Equal(got, []string{"tokyo"}) {
+		t.Errorf("occupiedRegions() with a paused node = %v, want [tokyo]", got)
+	}
+
+	fake.reconciled = time.Now().Add(-registryMaxAge - time.Minute)
+	if got := occupiedRegions(ctx, all); !slices.Equal(got, all) {
+		t.Errorf("occupiedRegions() with a stale registry = %v, want every region", got)
+	}
+}
+
+func TestCleanedInstances(t *testing.T) {
+	resources := []string{"Instance:i-1", "SecurityGroup:sg-1", "Instance:i-2", "VPC:vpc-1"}
+	if got := cleanedInstances(resources); !slices.Equal(got, []string{"i-1", "i-2"}) {
+		t.Errorf("cleanedInstances() = %v, want [i-1 i-2]", got)
+	}
+}
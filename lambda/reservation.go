@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/lambda/aws"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// handleGetReservation shows a region's capacity reservation, if it has one
+func handleGetReservation(ctx context.Context, friendlyRegion string) (events.LambdaFunctionURLResponse, error) {
+	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+	if err != nil {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+	}
+	if !regionEnabled(ctx, awsRegion) {
+		return jsonResponse(http.StatusOK, types.ReservationResponse{Success: true, Message: regionNotEnabledMessage(friendlyRegion, awsRegion)}), nil
+	}
+
+	service, err := aws.New(ctx, awsRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to initialize AWS service", err), nil
+	}
+
+	reservation, err := service.FindReservation(ctx, friendlyRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to find capacity reservation", err), nil
+	}
+
+	message := fmt.Sprintf("No capacity reservation in %s region", friendlyRegion)
+	if reservation != nil {
+		message = fmt.Sprintf("Capacity reservation %s in %s", reservation.ReservationID, reservation.AvailabilityZone)
+	}
+
+	response := types.ReservationResponse{
+		Success:     true,
+		Message:     message,
+		Reservation: reservation,
+	}
+
+	return jsonResponse(http.StatusOK, response), nil
+}
+
+// handleCreateReservation reserves capacity for one exit node in a region
+func handleCreateReservation(ctx context.Context, friendlyRegion string) (events.LambdaFunctionURLResponse, error) {
+	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+	if err != nil {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+	}
+	if !regionEnabled(ctx, awsRegion) {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionDisabled, regionNotEnabledMessage(friendlyRegion, awsRegion)), nil
+	}
+
+	service, err := aws.New(ctx, awsRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to initialize AWS service", err), nil
+	}
+
+	existing, err := service.FindReservation(ctx, friendlyRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to check existing capacity reservations", err), nil
+	}
+	if existing != nil {
+		return codedErrorResponse(http.StatusConflict, types.ErrorCodeReservationExists, fmt.Sprintf("Capacity reservation %s already exists in %s region", existing.ReservationID, friendlyRegion)), nil
+	}
+
+	reservation, err := service.CreateReservation(ctx, friendlyRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to reserve capacity", err), nil
+	}
+
+	log.Printf("Created capacity reservation %s in %s (%s)", reservation.ReservationID, friendlyRegion, reservation.AvailabilityZone)
+
+	response := types.ReservationResponse{
+		Success:     true,
+		Message:     fmt.Sprintf("Reserved capacity for one exit node in %s region", friendlyRegion),
+		Reservation: reservation,
+	}
+
+	return jsonResponse(http.StatusCreated, response), nil
+}
+
+// handleCancelReservation cancels a region's capacity reservation. Cancelling
+// when there isn't one succeeds, so teardown can sweep every region.
+func handleCancelReservation(ctx context.Context, friendlyRegion string, all bool) (events.LambdaFunctionURLResponse, error) {
+	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+	if err != nil {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+	}
+	if !regionEnabled(ctx, awsRegion) {
+		return jsonResponse(http.StatusOK, types.ReservationResponse{Success: true, Message: regionNotEnabledMessage(friendlyRegion, awsRegion)}), nil
+	}
+
+	service, err := aws.New(ctx, awsRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to initialize AWS service", err), nil
+	}
+
+	if all {
+		service.AllDeployments()
+	}
+
+	reservation, err := service.CancelReservation(ctx, friendlyRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to cancel capacity reservation", err), nil
+	}
+
+	message := fmt.Sprintf("No capacity reservation in %s region", friendlyRegion)
+	if reservation != nil {
+		message = fmt.Sprintf("Cancelled capacity reservation %s in %s region", reservation.ReservationID, friendlyRegion)
+		log.Printf("Cancelled capacity reservation %s in %s", reservation.ReservationID, friendlyRegion)
+	}
+
+	response := types.ReservationResponse{
+		Success:     true,
+		Message:     message,
+		Reservation: reservation,
+	}
+
+	return jsonResponse(http.StatusOK, response), nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/lambda/aws"
+	"github.com/anoldguy/tse/lambda/store"
+	"github.com/anoldguy/tse/shared/dns"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// replaceableInstances returns the IDs of the exit nodes a restart replaces:
+// every one in the region, paused or not. A multihop node's peer holds its
+// WireGuard key, so one among them is an error rather than a replacement that
+// comes up without its tunnel.
+func replaceableInstances(instances []*types.InstanceInfo) ([]string, error) {
+	var ids []string
+	for _, instance := range instances {
+		if instance.Hop != "" {
+			return nil, fmt.Errorf("multihop node %s can't be restarted; stop it and run 'tse multihop' again", instance.InstanceID)
+		}
+		ids = append(ids, instance.InstanceID)
+	}
+	return ids, nil
+}
+
+// handleRestartInstance replaces a region's exit node: it terminates the old
+// one and launches another into the same VPC and security group, so the
+// replacement skips the VPC setup and doesn't wait on a stop's cleanup. The
+// body is a start request for the replacement. It holds the start lock
+// throughout, so a start can't launch a node next to the replacement.
+func handleRestartInstance(ctx context.Context, caller *types.TokenInfo, friendlyRegion, body string) (events.LambdaFunctionURLResponse, error) {
+	req, err := parseStartRequest(body)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error()), nil
+	}
+	if req.DryRun || req.Async || req.Hop != nil {
+		return errorResponse(http.StatusBadRequest, "A restart can't be a dry run, async or multihop"), nil
+	}
+
+	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+	if err != nil {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+	}
+	if !regionEnabled(ctx, awsRegion) {
+		return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionDisabled, regionNotEnabledMessage(friendlyRegion, awsRegion)), nil
+	}
+	if response, ok := startLimitResponse(ctx, caller, friendlyRegion); !ok {
+		return response, nil
+	}
+
+	authKey := os.Getenv("TAILSCALE_AUTH_KEY")
+	if authKey == "" {
+		return codedErrorResponse(http.StatusInternalServerError, types.ErrorCodeMisconfigured, "TAILSCALE_AUTH_KEY environment variable not set"), nil
+	}
+
+	service, err := aws.New(ctx, awsRegion)
+	if err != nil {
+		return awsErrorResponse("Failed to initialize AWS service", err), nil
+	}
+
+	release, err := acquireStartLock(ctx, friendlyRegion)
+	if errors.Is(err, store.ErrLockHeld) {
+		return codedErrorResponse(http.StatusConflict, types.ErrorCodeStartInProgress, fmt.Sprintf("Another start is already in progress in %s region", friendlyRegion)), nil
+	}
+	if err != nil {
+		return awsErrorResponse("Failed to lock region for restart", err), nil
+	}
+	defer release()
+	releaseCap, refusal, ok := lockNodeCap(ctx, caller, friendlyRegion)
+	if !ok {
+		return refusal, nil
+	}
+	defer releaseCap()
+
+	instances, err := service.ListInstances(ctx)
+	if err != nil {
+		return awsErrorResponse("Failed to list instances", err), nil
+	}
+
+	// A retry of a restart that already launched the replacement: answer as the
+	// first one did, rather than replace the replacement
+	for _, instance := range instances {
+		if req.ClientToken != "" && instance.ClientToken == req.ClientToken {
+			response := types.RestartResponse{
+				Success:     true,
+				Message:     fmt.Sprintf("Exit node restarted in %s region", friendlyRegion),
+				Instance:    instance,
+				ClientToken: req.ClientToken,
+				Replayed:    true,
+			}
+			return jsonResponse(http.StatusCreated, response), nil
+		}
+	}
+
+	ids, err := replaceableInstances(instances)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error()), nil
+	}
+	if len(ids) == 0 {
+		return codedErrorResponse(http.StatusNotFound, types.ErrorCodeNothingRunning, fmt.Sprintf("No exit node to restart in %s region", friendlyRegion)), nil
+	}
+
+	// Terminating leaves the VPC for the replacement; the old instances let go
+	// of it while the new one boots
+	terminatedIDs, err := service.TerminateInstances(ctx)
+	if err != nil {
+		return awsErrorResponse("Failed to terminate instances", err), nil
+	}
+	if len(terminatedIDs) > 0 {
+		unregisterNodes(ctx, terminatedIDs)
+		notifyStopped(ctx, friendlyRegion, terminatedIDs)
+	}
+
+	resolver, _ := dns.Parse(req.DNS) // Validated by parseStartRequest
+	opts := aws.NodeOptions{DNS: resolver, Routes: req.AdvertiseRoutes, StartedBy: caller}
+	instance, err := startNode(ctx, service, friendlyRegion, authKey, req.ClientToken, opts)
+	if err != nil {
+		return awsErrorResponse(fmt.Sprintf("Terminated %v but failed to start a replacement", terminatedIDs), err), nil
+	}
+
+	response := types.RestartResponse{
+		Success:       true,
+		Message:       fmt.Sprintf("Exit node restarted in %s region", friendlyRegion),
+		TerminatedIDs: terminatedIDs,
+		Instance:      instance,
+		ClientToken:   req.ClientToken,
+	}
+	return jsonResponse(http.StatusCreated, response), nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func TestReplaceableInstances(t *testing.T) {
+	instances := []*types.InstanceInfo{
+		{InstanceID: "i-running", State: "running"},
+		{InstanceID: "i-paused", State: "stopped"},
+	}
+
+	ids, err := replaceableInstances(instances)
+	if err != nil || !slices.Equal(ids, []string{"i-running", "i-paused"}) {
+		t.Errorf("replaceableInstances() = %v, %v; want both nodes", ids, err)
+	}
+	if ids, err := replaceableInstances(nil); err != nil || len(ids) != 0 {
+		t.Errorf("replaceableInstances(nil) = %v, %v", ids, err)
+	}
+
+	instances = append(instances, &types.InstanceInfo{InstanceID: "i-hop", State: "running", Hop: "exit:frankfurt"})
+	if _, err := replaceableInstances(instances); err == nil {
+		t.Error("replaceableInstances() accepted a multihop node")
+	}
+}
+
+func TestRestartRejectsBadRequests(t *testing.T) {
+	for _, body := range []string{
+		`{"dry_run":true}`,
+		`{"async":true}`,
+		`{"dns":"nowhere.invalid!"}`,
+	} {
+		resp, _ := handleRestartInstance(context.Background(), rootToken, "ohio", body)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("restart with %s: status = %d, want 400", body, resp.StatusCode)
+		}
+	}
+
+	if resp, _ := handleRestartInstance(context.Background(), rootToken, "atlantis", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("restart in an unknown region: status = %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/lambda/metrics"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// invoke dispatches a raw invocation. EventBridge schedules (created by
+// `tse deploy --alarm-hours`, a data transfer cap or webhooks) run the sweep:
+// enforce the caps, publish node metrics, then tend the regions that have
+// nodes. The warm-keeper schedule's pings only keep
+// the container warm, and the Lambda's invocations of itself (or the workflow
+// state machine's) carry out async jobs. Everything else is a Function URL
+// request.
+func invoke(ctx context.Context, payload json.RawMessage) (any, error) {
+	cold := countInvocation()
+	if isWarmPing(payload) {
+		handleWarmPing(cold)
+		return nil, nil
+	}
+	if step, ok := parseWorkflowStep(payload); ok {
+		return handleWorkflowStep(ctx, step)
+	}
+	if run, ok := parseJobRun(payload); ok {
+		runJob(ctx, run)
+		return nil, nil
+	}
+	if isScheduledEvent(payload) {
+		if caps.enabled() {
+			if err := enforceTransferCaps(ctx, caps); err != nil {
+				metrics.Put(metrics.Errors, 1, metrics.Count, nil)
+			}
+		}
+		occupied, err := reportNodeMetrics(ctx)
+		tendNodes(ctx, occupied)
+		return nil, err
+	}
+
+	var request events.LambdaFunctionURLRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return nil, fmt.Errorf("failed to decode request: %w", err)
+	}
+	return handler(ctx, request)
+}
+
+// isScheduledEvent reports whether payload is an EventBridge scheduled event
+func isScheduledEvent(payload json.RawMessage) bool {
+	var event struct {
+		Source     string `json:"source"`
+		DetailType string `json:"detail-type"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return false
+	}
+	return event.Source == "aws.events" && event.DetailType == "Scheduled Event"
+}
+
+// reportNodeMetrics counts running exit nodes in every region and publishes
+// RunningNodes (per region and in total) and OldestNodeAge, which the node age
+// alarm watches. Regions that fail are skipped so one bad region can't hide
+// a forgotten node in another. What it found reconciles the node registry, and
+// it returns the regions with nodes, one name per AWS region.
+func reportNodeMetrics(ctx context.Context) ([]string, error) {
+	listedAt := time.Now()
+	friendlyRegions := regions.GetAllFriendlyNames()
+	found := make([][]*types.InstanceInfo, len(friendlyRegions))
+	errs := make([]error, len(friendlyRegions))
+
+	var wg sync.WaitGroup
+	for i, friendlyRegion := range friendlyRegions {
+		wg.Add(1)
+		go func(i int, friendlyRegion string) {
+			defer wg.Done()
+			found[i], errs[i] = regionNodes(ctx, friendlyRegion)
+		}(i, friendlyRegion)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	total := 0
+	var oldestAge time.Duration
+	failed := 0
+	var listedRegions []string
+	var listed []*types.InstanceInfo
+	var occupied []string
+	for i, friendlyRegion := range friendlyRegions {
+		if errs[i] != nil {
+			log.Printf("Failed to count exit nodes in %s: %v", friendlyRegion, errs[i])
+			failed++
+			continue
+		}
+		count, oldest := runningNodes(found[i])
+		metrics.Put(metrics.RunningNodes, float64(count), metrics.Count, map[string]string{"Region": friendlyRegion})
+		total += count
+		if !oldest.IsZero() && now.Sub(oldest) > oldestAge {
+			oldestAge = now.Sub(oldest)
+		}
+
+		// Aliases name the same AWS region twice; the registry wants it once
+		if awsRegion, _ := regions.GetAWSRegion(friendlyRegion); !slices.Contains(listedRegions, awsRegion) {
+			listedRegions = append(listedRegions, awsRegion)
+			listed = append(listed, found[i]...)
+			if len(found[i]) > 0 {
+				occupied = append(occupied, friendlyRegion)
+			}
+		}
+	}
+
+	metrics.Put(metrics.RunningNodes, float64(total), metrics.Count, nil)
+	metrics.Put(metrics.OldestNodeAge, oldestAge.Seconds(), metrics.Seconds, nil)
+	log.Printf("Metrics sweep: %d running exit nodes, oldest %s", total, oldestAge.Round(time.Minute))
+	reconcileRegistry(ctx, listedAt, listedRegions, listed)
+
+	if failed > 0 {
+		metrics.Put(metrics.Errors, float64(failed), metrics.Count, nil)
+		return occupied, fmt.Errorf("failed to count exit nodes in %d of %d regions", failed, len(friendlyRegions))
+	}
+	return occupied, nil
+}
+
+// regionNodes lists the exit nodes in a region
+func regionNodes(ctx context.Context, friendlyRegion string) ([]*types.InstanceInfo, error) {
+	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+	if err != nil {
+		return nil, err
+	}
+	return awsRegionNodes(ctx, awsRegion)
+}
+
+// runningNodes returns how many of the nodes are running and when the oldest launched
+func runningNodes(instances []*types.InstanceInfo) (int, time.Time) {
+	count := 0
+	var oldest time.Time
+	for _, instance := range instances {
+		if instance.State != "running" {
+			continue
+		}
+		count++
+		if oldest.IsZero() || instance.LaunchTime.Before(oldest) {
+			oldest = instance.LaunchTime
+		}
+	}
+	return count, oldest
+}
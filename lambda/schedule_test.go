@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestIsScheduledEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    bool
+	}{
+		{
+			name:    "eventbridge schedule",
+			payload: `{"version":"0","id":"abc","detail-type":"Scheduled Event","source":"aws.events","detail":{}}`,
+			want:    true,
+		},
+		{
+			name:    "function url request",
+			payload: `{"rawPath":"/ohio/instances","requestContext":{"http":{"method":"GET"}}}`,
+			want:    false,
+		},
+		{
+			name:    "other eventbridge event",
+			payload: `{"detail-type":"EC2 Instance State-change Notification","source":"aws.ec2"}`,
+			want:    false,
+		},
+		{
+			name:    "not json",
+			payload: `"hello"`,
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isScheduledEvent(json.RawMessage(tt.payload)); got != tt.want {
+				t.Errorf("isScheduledEvent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/lambda/store"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// envServeAddr runs the API as a plain HTTP server on the address (e.g.
+// 127.0.0.1:8080) instead of under Lambda
+const envServeAddr = "TSE_SERVE_ADDR"
+
+// envServeMutations caps concurrent mutating requests per region in serve mode
+const envServeMutations = "TSE_SERVE_REGION_MUTATIONS"
+
+const (
+	// serveTimeout stands in for the Lambda's timeout: each request and async
+	// job gets this long, the longest deploy allows
+	serveTimeout = 5 * time.Minute
+
+	// defaultServeMutations lets a stop or cleanup through while a start runs
+	defaultServeMutations = 2
+
+	// serveBusyRetryAfter is how long a caller refused a mutation slot is told
+	// to wait; pkg/client waits it out and retries on its own
+	serveBusyRetryAfter = 5 * time.Second
+)
+
+// regionMutations caps concurrent mutating requests per region; 0, as under
+// Lambda, leaves them to the start locks alone
+var regionMutations int
+
+// serveMutationsFromEnv reads the per-region mutation cap, falling back to the
+// default on a bad value
+func serveMutationsFromEnv() int {
+	raw := os.Getenv(envServeMutations)
+	if raw == "" {
+		return defaultServeMutations
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		log.Printf("Ignoring %s: want a whole number of requests, got %q", envServeMutations, raw)
+		return defaultServeMutations
+	}
+	return n
+}
+
+// mutatedRegion returns the region a request changes, if it's one of the
+// per-region POST routes
+func mutatedRegion(method string, parts []string) (string, bool) {
+	if method != "POST" || len(parts) != 2 || parts[0] == "tokens" || parts[0] == "jobs" {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// lockRegionMutation takes one of the region's regionMutations slots for a
+// change: locks named mutate#region#N, through the same lockStore as start
+// locks. When every slot is held it returns a 429 with Retry-After and false.
+// With regionMutations at 0 everything passes straight through.
+func lockRegionMutation(ctx context.Context, friendlyRegion, action string) (func(), events.LambdaFunctionURLResponse, bool) {
+	if regionMutations == 0 {
+		return func() {}, events.LambdaFunctionURLResponse{}, true
+	}
+
+	for slot := range regionMutations {
+		release, err := acquireLock(ctx, fmt.Sprintf("mutate#%s#%d", friendlyRegion, slot))
+		if err == nil {
+			return release, events.LambdaFunctionURLResponse{}, true
+		}
+		if !errors.Is(err, store.ErrLockHeld) {
+			return nil, awsErrorResponse("Failed to lock region for changes", err), false
+		}
+	}
+
+	log.Printf("Refusing %s in %s: %d changes already in progress", action, friendlyRegion, regionMutations)
+	seconds := int(serveBusyRetryAfter.Seconds())
+	response := codedErrorResponse(http.StatusTooManyRequests, types.ErrorCodeRateLimited,
+		fmt.Sprintf("%d changes already in progress in %s region, retry after %ds", regionMutations, friendlyRegion, seconds))
+	response.Headers["Retry-After"] = strconv.Itoa(seconds)
+	return nil, response, false
+}
+
+// withRegionMutation runs change while holding one of the region's mutation
+// slots, or returns the 429 when they're all taken. Every path that starts or
+// stops nodes goes through it: API routes, signed links and Telegram.
+func withRegionMutation(ctx context.Context, friendlyRegion, action string, change func() (events.LambdaFunctionURLResponse, error)) (events.LambdaFunctionURLResponse, error) {
+	release, response, ok := lockRegionMutation(ctx, friendlyRegion, action)
+	if !ok {
+		return response, nil
+	}
+	defer release()
+	return change()
+}
+
+// memoryLocks is the lockStore in serve mode without a state table. There's
+// one process, so a map does what the table's conditional writes do.
+type memoryLocks struct {
+	mu    sync.Mutex
+	locks map[string]memoryLock
+}
+
+type memoryLock struct {
+	owner   string
+	expires time.Time
+}
+
+func newMemoryLocks() *memoryLocks {
+	return &memoryLocks{locks: map[string]memoryLock{}}
+}
+
+func (m *memoryLocks) AcquireLock(ctx context.Context, name, owner string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if held, ok := m.locks[name]; ok && time.Now().Before(held.expires) {
+		return store.ErrLockHeld
+	}
+	m.locks[name] = memoryLock{owner: owner, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (m *memoryLocks) ReleaseLock(ctx context.Context, name, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locks[name].owner == owner {
+		delete(m.locks, name)
+	}
+	return nil
+}
+
+// server runs the handler behind net/http, with the guarantees Lambda gives
+// it: a deadline per request, a capped body, and async jobs that finish
+type server struct {
+	running sync.WaitGroup // Async jobs carried out in-process
+}
+
+// ServeHTTP turns the request into the Function URL event the handler takes,
+// and its response back. The request's context is detached from the client,
+// as a Lambda invocation is, so a caller hanging up doesn't cancel a start
+// halfway; serveTimeout bounds it instead.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, types.MaxPayloadBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeResponse(w, codedErrorResponse(http.StatusRequestEntityTooLarge, types.ErrorCodeBadRequest,
+			fmt.Sprintf("Request body exceeds %d MB limit", types.MaxPayloadBytes/(1024*1024))))
+		return
+	}
+	if err != nil {
+		writeResponse(w, errorResponse(http.StatusBadRequest, fmt.Sprintf("Failed to read request body: %v", err)))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), serveTimeout)
+	defer cancel()
+
+	response, err := handler(ctx, functionURLRequest(r, body))
+	if err != nil {
+		log.Printf("Handler failed: %v", err)
+		response = errorResponse(http.StatusInternalServerError, "Internal server error")
+	}
+	writeResponse(w, response)
+}
+
+// functionURLRequest builds the event a Function URL would send for r
+func functionURLRequest(r *http.Request, body []byte) events.LambdaFunctionURLRequest {
+	request := events.LambdaFunctionURLRequest{
+		RawPath:               r.URL.EscapedPath(),
+		RawQueryString:        r.URL.RawQuery,
+		Headers:               map[string]string{},
+		QueryStringParameters: map[string]string{},
+	}
+	for name, values := range r.Header {
+		request.Headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	for name, values := range r.URL.Query() {
+		request.QueryStringParameters[name] = strings.Join(values, ",")
+	}
+	if utf8.Valid(body) {
+		request.Body = string(body)
+	} else {
+		request.Body = base64.StdEncoding.EncodeToString(body)
+		request.IsBase64Encoded = true
+	}
+
+	sourceIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		sourceIP = r.RemoteAddr
+	}
+	request.RequestContext.DomainName = r.Host
+	request.RequestContext.HTTP.Method = r.Method
+	request.RequestContext.HTTP.Path = r.URL.Path
+	request.RequestContext.HTTP.SourceIP = sourceIP
+	request.RequestContext.HTTP.UserAgent = r.UserAgent()
+	return request
+}
+
+// writeResponse sends a handler's response
+func writeResponse(w http.ResponseWriter, response events.LambdaFunctionURLResponse) {
+	for name, value := range response.Headers {
+		w.Header().Set(name, value)
+	}
+	for _, cookie := range response.Cookies {
+		w.Header().Add("Set-Cookie", cookie)
+	}
+
+	body := []byte(response.Body)
+	if response.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(response.Body)
+		if err != nil {
+			log.Printf("Failed to decode response body: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body = decoded
+	}
+	w.WriteHeader(response.StatusCode)
+	w.Write(body)
+}
+
+// dispatchJob carries out an async job in a goroutine, where Lambda would
+// invoke itself, with serveTimeout as its invocation's deadline. Under Step
+// Functions orchestration the workflow runs it as usual.
+func (s *server) dispatchJob(ctx context.Context, id string, payload []byte) error {
+	if stepFunctionsOrchestration() {
+		return startWorkflow(ctx, id, payload)
+	}
+	run, ok := parseJobRun(payload)
+	if !ok {
+		return fmt.Errorf("job %s has no payload to run", id)
+	}
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), serveTimeout)
+		defer cancel()
+		runJob(ctx, run)
+	}()
+	return nil
+}
+
+// drain waits for the async jobs in progress to finish, or ctx to end
+func (s *server) drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// serve runs the API on addr until SIGINT or SIGTERM, then stops taking
+// requests and waits for those in flight and any async jobs to finish: up to
+// serveTimeout, which bounds them all. A second signal exits right away.
+func serve(addr string) error {
+	s := &server{}
+	dispatchJob = s.dispatchJob
+	regionMutations = serveMutationsFromEnv()
+	if startLocks == nil {
+		startLocks = newMemoryLocks()
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	failed := make(chan error, 1)
+	go func() {
+		log.Printf("Serving the API on %s (%d concurrent changes per region)", addr, regionMutations)
+		failed <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-failed:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	log.Printf("Shutting down: waiting up to %s for requests and jobs in progress", serveTimeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), serveTimeout+startLockMargin)
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		return fmt.Errorf("requests still in progress at shutdown: %w", err)
+	}
+	if err := s.drain(drainCtx); err != nil {
+		return fmt.Errorf("async jobs still running at shutdown: %w", err)
+	}
+	log.Printf("Shut down cleanly")
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/lambda/store"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func TestMemoryLocks(t *testing.T) {
+	locks := newMemoryLocks()
+	ctx := context.Background()
+
+	if err := locks.AcquireLock(ctx, "start#ohio", "a", time.Minute); err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+	if err := locks.AcquireLock(ctx, "start#ohio", "b", time.Minute); err != store.ErrLockHeld {
+		t.Errorf("second AcquireLock = %v, want ErrLockHeld", err)
+	}
+
+	// Only the owner releases it
+	locks.ReleaseLock(ctx, "start#ohio", "b")
+	if err := locks.AcquireLock(ctx, "start#ohio", "b", time.Minute); err != store.ErrLockHeld {
+		t.Errorf("AcquireLock after another owner's release = %v, want ErrLockHeld", err)
+	}
+	locks.ReleaseLock(ctx, "start#ohio", "a")
+	if err := locks.AcquireLock(ctx, "start#ohio", "b", 0); err != nil {
+		t.Errorf("AcquireLock after release: %v", err)
+	}
+
+	// An expired lock is taken over
+	if err := locks.AcquireLock(ctx, "start#ohio", "c", time.Minute); err != nil {
+		t.Errorf("AcquireLock after expiry: %v", err)
+	}
+}
+
+func TestLockRegionMutation(t *testing.T) {
+	startLocks = newMemoryLocks()
+	regionMutations = 2
+	defer func() { startLocks, regionMutations = nil, 0 }()
+	ctx := context.Background()
+
+	first, _, ok := lockRegionMutation(ctx, "ohio", "start")
+	if !ok {
+		t.Fatal("first mutation refused")
+	}
+	if _, _, ok := lockRegionMutation(ctx, "ohio", "stop"); !ok {
+		t.Fatal("second mutation refused")
+	}
+
+	_, response, ok := lockRegionMutation(ctx, "ohio", "cleanup")
+	if ok || response.StatusCode != http.StatusTooManyRequests || response.Headers["Retry-After"] == "" {
+		t.Errorf("third mutation = %d (ok %v, Retry-After %q), want 429 with Retry-After", response.StatusCode, ok, response.Headers["Retry-After"])
+	}
+	if _, _, ok := lockRegionMutation(ctx, "tokyo", "start"); !ok {
+		t.Error("mutation in another region refused")
+	}
+
+	first()
+	if _, _, ok := lockRegionMutation(ctx, "ohio", "cleanup"); !ok {
+		t.Error("mutation refused after a slot was released")
+	}
+}
+
+func TestMutatedRegion(t *testing.T) {
+	tests := []struct {
+		method string
+		parts  []string
+		want   string
+	}{
+		{"POST", []string{"ohio", "start"}, "ohio"},
+		{"POST", []string{"ohio", "cleanup"}, "ohio"},
+		{"GET", []string{"ohio", "instances"}, ""},
+		{"POST", []string{"tokens", "rotate"}, ""},
+		{"POST", []string{"jobs", "job_123"}, ""},
+		{"DELETE", []string{"tokens", "tok_123"}, ""},
+	}
+	for _, tt := range tests {
+		got, _ := mutatedRegion(tt.method, tt.parts)
+		if got != tt.want {
+			t.Errorf("mutatedRegion(%s /%s) = %q, want %q", tt.method, strings.Join(tt.parts, "/"), got, tt.want)
+		}
+	}
+}
+
+func TestWithRegionMutationCoversEveryPath(t *testing.T) {
+	startLocks = newMemoryLocks()
+	regionMutations = 1
+	defer func() { startLocks, regionMutations = nil, 0 }()
+	ctx := context.Background()
+
+	release, _, ok := lockRegionMutation(ctx, "ohio", "start")
+	if !ok {
+		t.Fatal("mutation refused")
+	}
+	defer release()
+
+	// A signed stop link for the busy region waits its turn like the API route
+	ran := false
+	response, err := withRegionMutation(ctx, "ohio", "stop", func() (events.LambdaFunctionURLResponse, error) {
+		ran = true
+		return jsonResponse(http.StatusOK, nil), nil
+	})
+	if err != nil || ran || response.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("withRegionMutation = %d, %v (ran %v), want 429 without running", response.StatusCode, err, ran)
+	}
+
+	if _, err := withRegionMutation(ctx, "tokyo", "stop", func() (events.LambdaFunctionURLResponse, error) {
+		ran = true
+		return jsonResponse(http.StatusOK, nil), nil
+	}); err != nil || !ran {
+		t.Errorf("withRegionMutation in an idle region = %v (ran %v)", err, ran)
+	}
+}
+
+func TestServeRefusesOversizedBody(t *testing.T) {
+	server := httptest.NewServer(&server{})
+	defer server.Close()
+
+	body := strings.NewReader(strings.Repeat("x", types.MaxPayloadBytes+1))
+	resp, err := http.Post(server.URL+"/ohio/start", "application/json", body)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var errorResp types.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
+		t.Fatalf("invalid error response: %v", err)
+	}
+	if resp.StatusCode != http.StatusRequestEntityTooLarge || errorResp.ErrorCode != types.ErrorCodeBadRequest {
+		t.Errorf("response = %d %s, want 413 %s", resp.StatusCode, errorResp.ErrorCode, types.ErrorCodeBadRequest)
+	}
+}
+
+func TestFunctionURLRequest(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/ohio/start?all=true", strings.NewReader(`{"dry_run":true}`))
+	r.RemoteAddr = "198.51.100.7:51234"
+	r.Header.Set("Authorization", "Bearer token")
+
+	request := functionURLRequest(r, []byte(`{"dry_run":true}`))
+	if request.RawPath != "/v1/ohio/start" || request.QueryStringParameters["all"] != "true" {
+		t.Errorf("path %q, query %v", request.RawPath, request.QueryStringParameters)
+	}
+	if request.RequestContext.HTTP.Method != "POST" || request.RequestContext.HTTP.SourceIP != "198.51.100.7" {
+		t.Errorf("method %q, source IP %q", request.RequestContext.HTTP.Method, request.RequestContext.HTTP.SourceIP)
+	}
+	if authorizationHeader(request) != "Bearer token" || request.Body != `{"dry_run":true}` || request.IsBase64Encoded {
+		t.Errorf("authorization %q, body %q (base64 %v)", authorizationHeader(request), request.Body, request.IsBase64Encoded)
+	}
+}
+
+func TestServeDrainWaitsForJobs(t *testing.T) {
+	s := &server{}
+	s.running.Add(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.drain(ctx); err == nil {
+		t.Fatal("drain returned with a job still running")
+	}
+
+	s.running.Done()
+	if err := s.drain(context.Background()); err != nil {
+		t.Errorf("drain after the job finished: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// auditPK is the partition holding audit entries; the sort key is "<UTC time>#<random>"
+// so entries sort chronologically
+const auditPK = "AUDIT"
+
+// auditTimeFormat is fixed-width (unlike RFC3339Nano) so sort keys order correctly
+const auditTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// AuditRetention is how long audit entries are kept before DynamoDB TTL removes them
+const AuditRetention = 90 * 24 * time.Hour
+
+// RecordAudit stores an audit entry
+func (s *Store) RecordAudit(ctx context.Context, entry *types.AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed to generate audit key: %w", err)
+	}
+	sk := entry.Time.UTC().Format(auditTimeFormat) + "#" + hex.EncodeToString(suffix)
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]ddbtypes.AttributeValue{
+			attrPK:       &ddbtypes.AttributeValueMemberS{Value: auditPK},
+			attrSK:       &ddbtypes.AttributeValueMemberS{Value: sk},
+			"entry":      &ddbtypes.AttributeValueMemberS{Value: string(data)},
+			"expires_at": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(entry.Time.Add(AuditRetention).Unix(), 10)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// ListAudit returns up to limit audit entries recorded at or after since, newest first
+func (s *Store) ListAudit(ctx context.Context, since time.Time, limit int) ([]*types.AuditEntry, error) {
+	var entries []*types.AuditEntry
+	var startKey map[string]ddbtypes.AttributeValue
+
+	for len(entries) < limit {
+		out, err := s.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.table),
+			KeyConditionExpression: aws.String("pk = :pk AND sk >= :since"),
+			ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+				":pk":    &ddbtypes.AttributeValueMemberS{Value: auditPK},
+				":since": &ddbtypes.AttributeValueMemberS{Value: since.UTC().Format(auditTimeFormat)},
+			},
+			ScanIndexForward:  aws.Bool(false),
+			Limit:             aws.Int32(int32(limit - len(entries))),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query audit log: %w", err)
+		}
+
+		for _, item := range out.Items {
+			var entry types.AuditEntry
+			if err := json.Unmarshal([]byte(stringAttr(item, "entry")), &entry); err != nil {
+				continue
+			}
+			entries = append(entries, &entry)
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = out.LastEvaluatedKey
+	}
+
+	return entries, nil
+}
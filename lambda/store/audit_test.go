@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newFakeStore()
+
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	actions := []string{"start", "stop", "cleanup", "start"}
+	for i, action := range actions {
+		entry := &types.AuditEntry{
+			Time:     base.Add(time.Duration(i) * time.Minute),
+			Action:   action,
+			Region:   "ohio",
+			TokenID:  "root",
+			SourceIP: "198.51.100.7",
+			Status:   200,
+			Result:   "ok",
+		}
+		if err := s.RecordAudit(ctx, entry); err != nil {
+			t.Fatalf("RecordAudit(): %v", err)
+		}
+	}
+
+	entries, err := s.ListAudit(ctx, time.Time{}, 10)
+	if err != nil {
+		t.Fatalf("ListAudit(): %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("got %d entries, want 4", len(entries))
+	}
+	if !entries[0].Time.Equal(base.Add(3 * time.Minute)) {
+		t.Errorf("first entry at %v, want newest first", entries[0].Time)
+	}
+
+	// Limit and since both narrow the result
+	entries, err = s.ListAudit(ctx, base.Add(90*time.Second), 10)
+	if err != nil {
+		t.Fatalf("ListAudit(since): %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("got %d entries since 12:01:30, want 2", len(entries))
+	}
+
+	entries, err = s.ListAudit(ctx, time.Time{}, 1)
+	if err != nil {
+		t.Fatalf("ListAudit(limit): %v", err)
+	}
+	if len(entries) != 1 || entries[0].Action != "start" {
+		t.Errorf("ListAudit(limit 1) = %+v, want only the newest start", entries)
+	}
+}
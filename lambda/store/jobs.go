@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// jobPK is the partition holding async jobs; the sort key is the job ID
+const jobPK = "JOB"
+
+// JobRetention is how long finished jobs can be polled before DynamoDB TTL removes them
+const JobRetention = 24 * time.Hour
+
+// ErrJobNotFound is returned when no job has the ID, or it expired
+var ErrJobNotFound = errors.New("job not found")
+
+// CreateJob records a new running job of the given kind and returns it with
+// its ID set
+func (s *Store) CreateJob(ctx context.Context, kind, region string) (*types.JobInfo, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate job ID: %w", err)
+	}
+
+	now := time.Now().UTC()
+	job := &types.JobInfo{
+		ID:        "job-" + hex.EncodeToString(raw),
+		Kind:      kind,
+		Region:    region,
+		Status:    types.JobRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.putJob(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to store job: %w", err)
+	}
+	return job, nil
+}
+
+// FinishJob records a job's outcome: its result when err is nil, otherwise
+// the error
+func (s *Store) FinishJob(ctx context.Context, job *types.JobInfo, result any, jobErr error) error {
+	job.Status = types.JobSucceeded
+	if jobErr != nil {
+		job.Status = types.JobFailed
+		job.Error = jobErr.Error()
+	} else {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("failed to encode job result: %w", err)
+		}
+		job.Result = data
+	}
+	job.UpdatedAt = time.Now().UTC()
+
+	if err := s.putJob(ctx, job); err != nil {
+		return fmt.Errorf("failed to store job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// GetJob returns the job with the given ID
+func (s *Store) GetJob(ctx context.Context, id string) (*types.JobInfo, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            key(jobPK, id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up job: %w", err)
+	}
+	if len(out.Item) == 0 {
+		return nil, ErrJobNotFound
+	}
+
+	var job types.JobInfo
+	if err := json.Unmarshal([]byte(stringAttr(out.Item, "job")), &job); err != nil {
+		return nil, fmt.Errorf("failed to decode job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// putJob writes a job, replacing any earlier version of it
+func (s *Store) putJob(ctx context.Context, job *types.JobInfo) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]ddbtypes.AttributeValue{
+			attrPK:       &ddbtypes.AttributeValueMemberS{Value: jobPK},
+			attrSK:       &ddbtypes.AttributeValueMemberS{Value: job.ID},
+			"job":        &ddbtypes.AttributeValueMemberS{Value: string(data)},
+			"expires_at": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(job.CreatedAt.Add(JobRetention).Unix(), 10)},
+		},
+	})
+	return err
+}
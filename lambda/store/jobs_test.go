@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func TestJobLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newFakeStore()
+
+	job, err := s.CreateJob(ctx, "cleanup", "ohio")
+	if err != nil {
+		t.Fatalf("CreateJob(): %v", err)
+	}
+	if job.ID == "" || job.Status != types.JobRunning {
+		t.Fatalf("CreateJob() = %+v, want a running job with an ID", job)
+	}
+
+	got, err := s.GetJob(ctx, job.ID)
+	if err != nil || got.Done() || got.Region != "ohio" {
+		t.Errorf("GetJob(running) = %+v, %v", got, err)
+	}
+
+	result := types.StopResponse{Success: true, TerminatedIDs: []string{"VPC:vpc-1"}, TerminatedCount: 1}
+	if err := s.FinishJob(ctx, job, result, nil); err != nil {
+		t.Fatalf("FinishJob(): %v", err)
+	}
+	got, err = s.GetJob(ctx, job.ID)
+	if err != nil || got.Status != types.JobSucceeded {
+		t.Fatalf("GetJob(finished) = %+v, %v", got, err)
+	}
+	var decoded types.StopResponse
+	if err := json.Unmarshal(got.Result, &decoded); err != nil || decoded.TerminatedCount != 1 {
+		t.Errorf("job result = %s (%v), want the cleanup response", got.Result, err)
+	}
+
+	failed, _ := s.CreateJob(ctx, "cleanup", "tokyo")
+	if err := s.FinishJob(ctx, failed, nil, errors.New("DependencyViolation")); err != nil {
+		t.Fatalf("FinishJob(failed): %v", err)
+	}
+	if got, _ := s.GetJob(ctx, failed.ID); got.Status != types.JobFailed || got.Error != "DependencyViolation" || got.Result != nil {
+		t.Errorf("GetJob(failed) = %+v", got)
+	}
+
+	if _, err := s.GetJob(ctx, "job-missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("GetJob(missing) error = %v, want ErrJobNotFound", err)
+	}
+}
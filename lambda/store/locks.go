@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// lockPK is the partition holding short-lived locks; the sort key names the lock
+const lockPK = "LOCK"
+
+// ErrLockHeld is returned when another owner holds an unexpired lock
+var ErrLockHeld = errors.New("lock held")
+
+// AcquireLock takes the named lock for owner until ttl passes or it's released.
+// The conditional write makes it atomic across concurrent Lambda instances.
+func (s *Store) AcquireLock(ctx context.Context, name, owner string, ttl time.Duration) error {
+	now := time.Now()
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]ddbtypes.AttributeValue{
+			attrPK:       &ddbtypes.AttributeValueMemberS{Value: lockPK},
+			attrSK:       &ddbtypes.AttributeValueMemberS{Value: name},
+			"lock_owner": &ddbtypes.AttributeValueMemberS{Value: owner},
+			"expires_at": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(ttl).Unix(), 10)},
+		},
+		// TTL deletion can lag by days, so an expired lock is taken over here
+		ConditionExpression: aws.String("attribute_not_exists(pk) OR expires_at < :now"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":now": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+	})
+
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrLockHeld
+	}
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock %s: %w", name, err)
+	}
+	return nil
+}
+
+// ReleaseLock releases the named lock if owner still holds it. A lock that
+// expired and was taken over by someone else is left alone.
+func (s *Store) ReleaseLock(ctx context.Context, name, owner string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(s.table),
+		Key:                 key(lockPK, name),
+		ConditionExpression: aws.String("lock_owner = :owner"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":owner": &ddbtypes.AttributeValueMemberS{Value: owner},
+		},
+	})
+
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &conditionFailed) {
+		return fmt.Errorf("failed to release lock %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestLockLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s, fake := newFakeStore()
+
+	if err := s.AcquireLock(ctx, "start#ohio", "req-1", time.Minute); err != nil {
+		t.Fatalf("AcquireLock(): %v", err)
+	}
+	if err := s.AcquireLock(ctx, "start#ohio", "req-2", time.Minute); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("AcquireLock(held) error = %v, want ErrLockHeld", err)
+	}
+	if err := s.AcquireLock(ctx, "start#tokyo", "req-2", time.Minute); err != nil {
+		t.Errorf("AcquireLock(other region): %v", err)
+	}
+
+	// Only the owner's release counts
+	if err := s.ReleaseLock(ctx, "start#ohio", "req-2"); err != nil {
+		t.Errorf("ReleaseLock(not owner): %v", err)
+	}
+	if err := s.AcquireLock(ctx, "start#ohio", "req-2", time.Minute); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("AcquireLock after a stranger's release = %v, want ErrLockHeld", err)
+	}
+
+	if err := s.ReleaseLock(ctx, "start#ohio", "req-1"); err != nil {
+		t.Fatalf("ReleaseLock(): %v", err)
+	}
+	if err := s.AcquireLock(ctx, "start#ohio", "req-2", time.Minute); err != nil {
+		t.Errorf("AcquireLock after release: %v", err)
+	}
+
+	// A lock whose owner died is taken over once it expires, before TTL removes it
+	fake.items["LOCK|start#ohio"]["expires_at"] = &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)}
+	if err := s.AcquireLock(ctx, "start#ohio", "req-3", time.Minute); err != nil {
+		t.Errorf("AcquireLock(expired): %v", err)
+	}
+	if err := s.ReleaseLock(ctx, "start#ohio", "req-2"); err != nil {
+		t.Errorf("ReleaseLock(taken over): %v", err)
+	}
+	if got := stringAttr(fake.items["LOCK|start#ohio"], "lock_owner"); got != "req-3" {
+		t.Errorf("lock owner = %q, want req-3", got)
+	}
+}
@@ -0,0 +1,188 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// nodePK is the partition registering the deployment's exit nodes; the sort
+// key is the instance ID, or reconciledSK for when EC2 was last compared
+const nodePK = "NODE"
+
+// reconciledSK holds the time the registry last matched EC2 in every region
+const reconciledSK = "#reconciled"
+
+// nodeTombstoneRetention is how long a terminated node's entry is kept, so a
+// reconciliation that listed EC2 before the termination can't bring it back
+const nodeTombstoneRetention = 24 * time.Hour
+
+// RecordNode registers a node the Lambda started (or found), as of at
+func (s *Store) RecordNode(ctx context.Context, node *types.InstanceInfo, at time.Time) error {
+	if err := s.putNode(ctx, node, at, nil); err != nil {
+		return fmt.Errorf("failed to register %s: %w", node.InstanceID, err)
+	}
+	return nil
+}
+
+// ForgetNodes marks nodes the Lambda terminated, as of at
+func (s *Store) ForgetNodes(ctx context.Context, instanceIDs []string, at time.Time) error {
+	for _, instanceID := range instanceIDs {
+		if err := s.putTombstone(ctx, instanceID, at, nil); err != nil {
+			return fmt.Errorf("failed to unregister %s: %w", instanceID, err)
+		}
+	}
+	return nil
+}
+
+// Nodes returns the registered nodes and when the registry last matched EC2 in
+// every region (zero if it never has)
+func (s *Store) Nodes(ctx context.Context) ([]*types.InstanceInfo, time.Time, error) {
+	items, err := s.queryPartition(ctx, nodePK)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read node registry: %w", err)
+	}
+
+	var nodes []*types.InstanceInfo
+	var reconciled time.Time
+	for _, item := range items {
+		if stringAttr(item, attrSK) == reconciledSK {
+			reconciled = unixMilliAttr(item, "reconciled_at")
+			continue
+		}
+		if node := nodeFromItem(item); node != nil {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, reconciled, nil
+}
+
+// ReconcileNodes makes the registry match what EC2 listed at listedAt in
+// awsRegions: listed nodes are registered, and registered nodes in those
+// regions that weren't listed are forgotten. Entries written after listedAt
+// are left alone, since they know better than the listing. With complete set,
+// the listing covered every region and the registry is marked reconciled.
+func (s *Store) ReconcileNodes(ctx context.Context, listedAt time.Time, awsRegions []string, listed []*types.InstanceInfo, complete bool) error {
+	registered, _, err := s.Nodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	olderThan := &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(listedAt.UnixMilli(), 10)}
+	var errs []error
+	for _, node := range listed {
+		err := s.putNode(ctx, node, listedAt, olderThan)
+		if err != nil && !isConditionFailed(err) {
+			errs = append(errs, fmt.Errorf("failed to register %s: %w", node.InstanceID, err))
+		}
+	}
+	for _, node := range registered {
+		if !slices.Contains(awsRegions, node.Region) || slices.ContainsFunc(listed, func(l *types.InstanceInfo) bool { return l.InstanceID == node.InstanceID }) {
+			continue
+		}
+		err := s.putTombstone(ctx, node.InstanceID, listedAt, olderThan)
+		if err != nil && !isConditionFailed(err) {
+			errs = append(errs, fmt.Errorf("failed to unregister %s: %w", node.InstanceID, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if !complete {
+		return nil
+	}
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]ddbtypes.AttributeValue{
+			attrPK:          &ddbtypes.AttributeValueMemberS{Value: nodePK},
+			attrSK:          &ddbtypes.AttributeValueMemberS{Value: reconciledSK},
+			"reconciled_at": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(listedAt.UnixMilli(), 10)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark node registry reconciled: %w", err)
+	}
+	return nil
+}
+
+// putNode writes a node's entry, only over one older than olderThan if set
+func (s *Store) putNode(ctx context.Context, node *types.InstanceInfo, at time.Time, olderThan ddbtypes.AttributeValue) error {
+	data, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]ddbtypes.AttributeValue{
+			attrPK:       &ddbtypes.AttributeValueMemberS{Value: nodePK},
+			attrSK:       &ddbtypes.AttributeValueMemberS{Value: node.InstanceID},
+			"node":       &ddbtypes.AttributeValueMemberS{Value: string(data)},
+			"updated_at": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(at.UnixMilli(), 10)},
+		},
+	}
+	if olderThan != nil {
+		input.ConditionExpression = aws.String("attribute_not_exists(pk) OR updated_at < :before")
+		input.ExpressionAttributeValues = map[string]ddbtypes.AttributeValue{":before": olderThan}
+	}
+	_, err = s.client.PutItem(ctx, input)
+	return err
+}
+
+// putTombstone replaces a node's entry with a marker that it's gone, only over
+// one older than olderThan if set. DynamoDB TTL removes the marker later.
+func (s *Store) putTombstone(ctx context.Context, instanceID string, at time.Time, olderThan ddbtypes.AttributeValue) error {
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]ddbtypes.AttributeValue{
+			attrPK:       &ddbtypes.AttributeValueMemberS{Value: nodePK},
+			attrSK:       &ddbtypes.AttributeValueMemberS{Value: instanceID},
+			"updated_at": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(at.UnixMilli(), 10)},
+			"expires_at": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(at.Add(nodeTombstoneRetention).Unix(), 10)},
+		},
+	}
+	if olderThan != nil {
+		input.ConditionExpression = aws.String("updated_at < :before")
+		input.ExpressionAttributeValues = map[string]ddbtypes.AttributeValue{":before": olderThan}
+	}
+	_, err := s.client.PutItem(ctx, input)
+	return err
+}
+
+// nodeFromItem decodes a registered node, returning nil for a terminated one
+func nodeFromItem(item map[string]ddbtypes.AttributeValue) *types.InstanceInfo {
+	data := stringAttr(item, "node")
+	if data == "" {
+		return nil
+	}
+	var node types.InstanceInfo
+	if err := json.Unmarshal([]byte(data), &node); err != nil {
+		return nil
+	}
+	return &node
+}
+
+// unixMilliAttr reads a number attribute of Unix milliseconds, zero if missing
+func unixMilliAttr(item map[string]ddbtypes.AttributeValue, name string) time.Time {
+	ms, err := strconv.ParseInt(numberAttr(item, name), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// isConditionFailed reports whether a write was skipped by its condition
+func isConditionFailed(err error) bool {
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+	return errors.As(err, &conditionFailed)
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func nodeIDs(nodes []*types.InstanceInfo) []string {
+	var ids []string
+	for _, node := range nodes {
+		ids = append(ids, node.InstanceID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestNodeRegistry(t *testing.T) {
+	ctx := context.Background()
+	s, fake := newFakeStore()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	ohio := &types.InstanceInfo{InstanceID: "i-1", Region: "us-east-2", FriendlyRegion: "ohio", StartedBy: "partner"}
+	tokyo := &types.InstanceInfo{InstanceID: "i-2", Region: "ap-northeast-1", FriendlyRegion: "tokyo"}
+	for _, node := range []*types.InstanceInfo{ohio, tokyo} {
+		if err := s.RecordNode(ctx, node, now); err != nil {
+			t.Fatalf("RecordNode(%s): %v", node.InstanceID, err)
+		}
+	}
+	if err := s.ForgetNodes(ctx, []string{"i-2"}, now.Add(time.Minute)); err != nil {
+		t.Fatalf("ForgetNodes: %v", err)
+	}
+
+	nodes, reconciled, err := s.Nodes(ctx)
+	if err != nil || !slices.Equal(nodeIDs(nodes), []string{"i-1"}) || !reconciled.IsZero() {
+		t.Fatalf("Nodes() = %v, %v, %v; want i-1, never reconciled", nodeIDs(nodes), reconciled, err)
+	}
+	if nodes[0].StartedBy != "partner" || nodes[0].FriendlyRegion != "ohio" {
+		t.Errorf("registered node = %+v", nodes[0])
+	}
+	if expires := numberAttr(fake.items["NODE|i-2"], "expires_at"); expires == "" {
+		t.Error("a forgotten node's entry never expires")
+	}
+}
+
+func TestReconcileNodes(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newFakeStore()
+	listedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Registered before the listing: i-1 was terminated from the console, i-3
+	// is in a region that wasn't listed
+	for _, node := range []*types.InstanceInfo{
+		{InstanceID: "i-1", Region: "us-east-2"},
+		{InstanceID: "i-3", Region: "eu-central-1"},
+	} {
+		s.RecordNode(ctx, node, listedAt.Add(-time.Hour))
+	}
+	// Started, and terminated, while the listing ran
+	s.RecordNode(ctx, &types.InstanceInfo{InstanceID: "i-4", Region: "us-east-2"}, listedAt.Add(time.Second))
+	s.ForgetNodes(ctx, []string{"i-5"}, listedAt.Add(time.Second))
+
+	listed := []*types.InstanceInfo{
+		{InstanceID: "i-2", Region: "us-east-2"},
+		{InstanceID: "i-5", Region: "us-east-2"},
+	}
+	if err := s.ReconcileNodes(ctx, listedAt, []string{"us-east-2"}, listed, false); err != nil {
+		t.Fatalf("ReconcileNodes() error = %v", err)
+	}
+
+	nodes, reconciled, err := s.Nodes(ctx)
+	if err != nil {
+		t.Fatalf("Nodes() error = %v", err)
+	}
+	if want := []string{"i-2", "i-3", "i-4"}; !slices.Equal(nodeIDs(nodes), want) {
+		t.Errorf("Nodes() = %v, want %v", nodeIDs(nodes), want)
+	}
+	if !reconciled.IsZero() {
+		t.Errorf("a partial listing marked the registry reconciled at %v", reconciled)
+	}
+
+	if err := s.ReconcileNodes(ctx, listedAt, []string{"us-east-2", "eu-central-1"}, listed, true); err != nil {
+		t.Fatalf("ReconcileNodes(complete) error = %v", err)
+	}
+	if _, reconciled, _ := s.Nodes(ctx); !reconciled.Equal(listedAt) {
+		t.Errorf("reconciled at %v, want %v", reconciled, listedAt)
+	}
+}
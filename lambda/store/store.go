@@ -0,0 +1,60 @@
+// Package store persists TSE control-plane state (issued tokens, audit entries,
+// locks, jobs, monthly data transfer, the node registry) in the DynamoDB table
+// created by 'tse deploy'.
+//
+// Everything lives in a single table keyed by a partition key (pk) naming the
+// record type and a sort key (sk) identifying the record, so new kinds of state
+// don't need new infrastructure.
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// EnvTableName names the state table. The Lambda runs without a store when unset.
+const EnvTableName = "TSE_TABLE_NAME"
+
+// Table key attribute names
+const (
+	attrPK = "pk"
+	attrSK = "sk"
+)
+
+// dynamoAPI is the subset of the DynamoDB client the store uses
+type dynamoAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// Store reads and writes TSE state in DynamoDB
+type Store struct {
+	client dynamoAPI
+	table  string
+}
+
+// FromEnv creates a Store for the table named by TSE_TABLE_NAME.
+// Returns nil (and no error) when no table is configured.
+//
+// The store always uses the Lambda's own credentials, even in cross-account
+// mode: the table lives next to the Lambda, not in the exit node account.
+func FromEnv(ctx context.Context) (*Store, error) {
+	table := os.Getenv(EnvTableName)
+	if table == "" {
+		return nil, nil
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return &Store{client: dynamodb.NewFromConfig(cfg), table: table}, nil
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeDynamo is an in-memory table supporting the operations the store uses.
+// Only the expression forms the store actually issues are understood.
+type fakeDynamo struct {
+	mu    sync.Mutex
+	items map[string]map[string]ddbtypes.AttributeValue // "pk|sk" -> item
+}
+
+func newFakeStore() (*Store, *fakeDynamo) {
+	fake := &fakeDynamo{items: make(map[string]map[string]ddbtypes.AttributeValue)}
+	return &Store{client: fake, table: "test-table"}, fake
+}
+
+func itemKey(item map[string]ddbtypes.AttributeValue) string {
+	return stringAttr(item, attrPK) + "|" + stringAttr(item, attrSK)
+}
+
+func (f *fakeDynamo) GetItem(ctx context.Context, in *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &dynamodb.GetItemOutput{Item: f.items[itemKey(in.Key)]}, nil
+}
+
+func (f *fakeDynamo) PutItem(ctx context.Context, in *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	k := itemKey(in.Item)
+	if !conditionHolds(f.items[k], in.ConditionExpression, in.ExpressionAttributeValues) {
+		return nil, &ddbtypes.ConditionalCheckFailedException{}
+	}
+	f.items[k] = in.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamo) DeleteItem(ctx context.Context, in *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	k := itemKey(in.Key)
+	if !conditionHolds(f.items[k], in.ConditionExpression, in.ExpressionAttributeValues) {
+		return nil, &ddbtypes.ConditionalCheckFailedException{}
+	}
+	delete(f.items, k)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+// conditionHolds evaluates a condition against the existing item (nil if none).
+// Supports "attribute_not_exists(pk)", optionally "OR a < :x", and "a = :x".
+func conditionHolds(item map[string]ddbtypes.AttributeValue, condition *string, values map[string]ddbtypes.AttributeValue) bool {
+	if condition == nil {
+		return true
+	}
+	for _, clause := range strings.Split(*condition, " OR ") {
+		switch {
+		case strings.HasPrefix(clause, "attribute_not_exists"):
+			if item == nil {
+				return true
+			}
+		case strings.Contains(clause, " < "):
+			name, placeholder, _ := strings.Cut(clause, " < ")
+			have, _ := strconv.ParseInt(numberAttr(item, name), 10, 64)
+			want, _ := strconv.ParseInt(values[placeholder].(*ddbtypes.AttributeValueMemberN).Value, 10, 64)
+			if item != nil && have < want {
+				return true
+			}
+		case strings.Contains(clause, " = "):
+			name, placeholder, _ := strings.Cut(clause, " = ")
+			if item != nil && stringAttr(item, name) == values[placeholder].(*ddbtypes.AttributeValueMemberS).Value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f *fakeDynamo) UpdateItem(ctx context.Context, in *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	item, ok := f.items[itemKey(in.Key)]
+	if !ok {
+		return nil, errors.New("item not found")
+	}
+	// Supports "SET a = :x, b = :y"
+	for _, assignment := range strings.Split(strings.TrimPrefix(*in.UpdateExpression, "SET "), ",") {
+		name, placeholder, _ := strings.Cut(assignment, "=")
+		item[strings.TrimSpace(name)] = in.ExpressionAttributeValues[strings.TrimSpace(placeholder)]
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (f *fakeDynamo) Query(ctx context.Context, in *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pk := in.ExpressionAttributeValues[":pk"].(*ddbtypes.AttributeValueMemberS).Value
+	since := ""
+	if v, ok := in.ExpressionAttributeValues[":since"]; ok {
+		since = v.(*ddbtypes.AttributeValueMemberS).Value
+	}
+
+	var keys []string
+	for k, item := range f.items {
+		if stringAttr(item, attrPK) == pk && stringAttr(item, attrSK) >= since {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if in.ScanIndexForward != nil && !*in.ScanIndexForward {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	}
+	if in.Limit != nil && len(keys) > int(*in.Limit) {
+		keys = keys[:*in.Limit]
+	}
+
+	out := &dynamodb.QueryOutput{}
+	for _, k := range keys {
+		out.Items = append(out.Items, f.items[k])
+	}
+	return out, nil
+}
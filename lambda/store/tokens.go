@@ -0,0 +1,244 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// tokenPK is the partition holding issued tokens; the sort key is the token's SHA-256 hash
+const tokenPK = "TOKEN"
+
+// tokenSecretPrefix makes issued tokens recognizable (e.g. in secret scanners)
+const tokenSecretPrefix = "tse_"
+
+var (
+	// ErrTokenNotFound is returned when no issued token matches
+	ErrTokenNotFound = errors.New("token not found")
+
+	// ErrTokenRevoked is returned when looking up a revoked token
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
+// HashToken returns the hex SHA-256 of a token secret. Only hashes are stored.
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenID derives the short public identifier used to list and revoke a token
+func tokenID(hash string) string {
+	return hash[:12]
+}
+
+// CreateToken issues a new token with the given scopes and limits. The
+// returned secret is not recoverable later.
+func (s *Store) CreateToken(ctx context.Context, name string, scopes []string, limits types.TokenLimits) (string, *types.TokenInfo, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	secret := tokenSecretPrefix + hex.EncodeToString(raw)
+	hash := HashToken(secret)
+
+	info := &types.TokenInfo{
+		ID:          tokenID(hash),
+		Name:        name,
+		Scopes:      scopes,
+		CreatedAt:   time.Now().UTC().Truncate(time.Second),
+		TokenLimits: limits,
+	}
+
+	item := tokenItem(hash, info)
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(pk)"),
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to store token: %w", err)
+	}
+
+	return secret, info, nil
+}
+
+// LookupToken finds the issued token matching secret
+func (s *Store) LookupToken(ctx context.Context, secret string) (*types.TokenInfo, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            key(tokenPK, HashToken(secret)),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up token: %w", err)
+	}
+	if len(out.Item) == 0 {
+		return nil, ErrTokenNotFound
+	}
+
+	info := tokenFromItem(out.Item)
+	if info.Revoked() {
+		return info, ErrTokenRevoked
+	}
+	return info, nil
+}
+
+// ListTokens returns every issued token, including revoked ones
+func (s *Store) ListTokens(ctx context.Context) ([]*types.TokenInfo, error) {
+	items, err := s.queryPartition(ctx, tokenPK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens: %w", err)
+	}
+
+	tokens := make([]*types.TokenInfo, 0, len(items))
+	for _, item := range items {
+		tokens = append(tokens, tokenFromItem(item))
+	}
+	return tokens, nil
+}
+
+// RevokeToken marks the token with the given ID as revoked
+func (s *Store) RevokeToken(ctx context.Context, id string) (*types.TokenInfo, error) {
+	items, err := s.queryPartition(ctx, tokenPK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up token: %w", err)
+	}
+
+	for _, item := range items {
+		info := tokenFromItem(item)
+		if info.ID != id {
+			continue
+		}
+		if info.Revoked() {
+			return info, nil
+		}
+
+		info.RevokedAt = time.Now().UTC().Truncate(time.Second)
+		_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:        aws.String(s.table),
+			Key:              key(tokenPK, stringAttr(item, attrSK)),
+			UpdateExpression: aws.String("SET revoked_at = :revoked"),
+			ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+				":revoked": &ddbtypes.AttributeValueMemberS{Value: info.RevokedAt.Format(time.RFC3339)},
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to revoke token: %w", err)
+		}
+		return info, nil
+	}
+
+	return nil, ErrTokenNotFound
+}
+
+// queryPartition returns every item in a partition, following pagination
+func (s *Store) queryPartition(ctx context.Context, pk string) ([]map[string]ddbtypes.AttributeValue, error) {
+	var items []map[string]ddbtypes.AttributeValue
+	var startKey map[string]ddbtypes.AttributeValue
+
+	for {
+		out, err := s.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.table),
+			KeyConditionExpression: aws.String("pk = :pk"),
+			ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+				":pk": &ddbtypes.AttributeValueMemberS{Value: pk},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, out.Items...)
+		if len(out.LastEvaluatedKey) == 0 {
+			return items, nil
+		}
+		startKey = out.LastEvaluatedKey
+	}
+}
+
+// tokenItem converts token metadata to a DynamoDB item
+func tokenItem(hash string, info *types.TokenInfo) map[string]ddbtypes.AttributeValue {
+	scopes := make([]ddbtypes.AttributeValue, len(info.Scopes))
+	for i, scope := range info.Scopes {
+		scopes[i] = &ddbtypes.AttributeValueMemberS{Value: scope}
+	}
+
+	item := map[string]ddbtypes.AttributeValue{
+		attrPK:       &ddbtypes.AttributeValueMemberS{Value: tokenPK},
+		attrSK:       &ddbtypes.AttributeValueMemberS{Value: hash},
+		"id":         &ddbtypes.AttributeValueMemberS{Value: info.ID},
+		"name":       &ddbtypes.AttributeValueMemberS{Value: info.Name},
+		"scopes":     &ddbtypes.AttributeValueMemberL{Value: scopes},
+		"created_at": &ddbtypes.AttributeValueMemberS{Value: info.CreatedAt.Format(time.RFC3339)},
+	}
+	if info.MaxNodes > 0 {
+		item["max_nodes"] = &ddbtypes.AttributeValueMemberN{Value: strconv.Itoa(info.MaxNodes)}
+	}
+	if len(info.Regions) > 0 {
+		item["regions"] = &ddbtypes.AttributeValueMemberSS{Value: info.Regions}
+	}
+	return item
+}
+
+// tokenFromItem converts a DynamoDB item back to token metadata
+func tokenFromItem(item map[string]ddbtypes.AttributeValue) *types.TokenInfo {
+	info := &types.TokenInfo{
+		ID:   stringAttr(item, "id"),
+		Name: stringAttr(item, "name"),
+	}
+
+	if list, ok := item["scopes"].(*ddbtypes.AttributeValueMemberL); ok {
+		for _, v := range list.Value {
+			if s, ok := v.(*ddbtypes.AttributeValueMemberS); ok {
+				info.Scopes = append(info.Scopes, s.Value)
+			}
+		}
+	}
+
+	if regions, ok := item["regions"].(*ddbtypes.AttributeValueMemberSS); ok {
+		info.Regions = regions.Value
+	}
+	info.MaxNodes, _ = strconv.Atoi(numberAttr(item, "max_nodes"))
+
+	info.CreatedAt, _ = time.Parse(time.RFC3339, stringAttr(item, "created_at"))
+	if revoked := stringAttr(item, "revoked_at"); revoked != "" {
+		info.RevokedAt, _ = time.Parse(time.RFC3339, revoked)
+	}
+
+	return info
+}
+
+// key builds a primary key
+func key(pk, sk string) map[string]ddbtypes.AttributeValue {
+	return map[string]ddbtypes.AttributeValue{
+		attrPK: &ddbtypes.AttributeValueMemberS{Value: pk},
+		attrSK: &ddbtypes.AttributeValueMemberS{Value: sk},
+	}
+}
+
+// stringAttr reads a string attribute, returning "" if missing or not a string
+func stringAttr(item map[string]ddbtypes.AttributeValue, name string) string {
+	if v, ok := item[name].(*ddbtypes.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+// numberAttr reads a number attribute as its string form, returning "" if missing or not a number
+func numberAttr(item map[string]ddbtypes.AttributeValue, name string) string {
+	if v, ok := item[name].(*ddbtypes.AttributeValueMemberN); ok {
+		return v.Value
+	}
+	return ""
+}
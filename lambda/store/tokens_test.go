@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func TestTokenLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s, fake := newFakeStore()
+
+	secret, info, err := s.CreateToken(ctx, "friend-laptop", []string{types.ScopeStop, types.ScopeRead}, types.TokenLimits{})
+	if err != nil {
+		t.Fatalf("CreateToken(): %v", err)
+	}
+	if !strings.HasPrefix(secret, tokenSecretPrefix) {
+		t.Errorf("secret = %q, want %q prefix", secret, tokenSecretPrefix)
+	}
+
+	// Only the hash is persisted
+	for _, item := range fake.items {
+		for name := range item {
+			if stringAttr(item, name) == secret {
+				t.Errorf("attribute %s holds the plaintext secret", name)
+			}
+		}
+		if stringAttr(item, attrSK) != HashToken(secret) {
+			t.Errorf("sort key = %q, want token hash", stringAttr(item, attrSK))
+		}
+	}
+
+	found, err := s.LookupToken(ctx, secret)
+	if err != nil {
+		t.Fatalf("LookupToken(): %v", err)
+	}
+	if found.ID != info.ID || found.Name != "friend-laptop" {
+		t.Errorf("LookupToken() = %+v, want %+v", found, info)
+	}
+	if !found.HasScope(types.ScopeStop) || found.HasScope(types.ScopeStart) {
+		t.Errorf("scopes = %v, want stop and read only", found.Scopes)
+	}
+
+	if _, err := s.LookupToken(ctx, "tse_not-a-real-token"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("LookupToken(unknown) error = %v, want ErrTokenNotFound", err)
+	}
+
+	revoked, err := s.RevokeToken(ctx, info.ID)
+	if err != nil {
+		t.Fatalf("RevokeToken(): %v", err)
+	}
+	if !revoked.Revoked() {
+		t.Errorf("RevokeToken() returned unrevoked token")
+	}
+
+	if _, err := s.LookupToken(ctx, secret); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("LookupToken(revoked) error = %v, want ErrTokenRevoked", err)
+	}
+
+	tokens, err := s.ListTokens(ctx)
+	if err != nil {
+		t.Fatalf("ListTokens(): %v", err)
+	}
+	if len(tokens) != 1 || !tokens[0].Revoked() {
+		t.Errorf("ListTokens() = %+v, want one revoked token", tokens)
+	}
+
+	if _, err := s.RevokeToken(ctx, "missing"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("RevokeToken(missing) error = %v, want ErrTokenNotFound", err)
+	}
+}
+
+func TestTokenLimits(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newFakeStore()
+
+	limits := types.TokenLimits{MaxNodes: 2, Regions: []string{"ohio", "frankfurt"}}
+	secret, _, err := s.CreateToken(ctx, "partner", []string{types.ScopeStart}, limits)
+	if err != nil {
+		t.Fatalf("CreateToken(): %v", err)
+	}
+	found, err := s.LookupToken(ctx, secret)
+	if err != nil {
+		t.Fatalf("LookupToken(): %v", err)
+	}
+	if found.MaxNodes != 2 || !slices.Equal(found.Regions, limits.Regions) {
+		t.Errorf("LookupToken() limits = %+v, want %+v", found.TokenLimits, limits)
+	}
+
+	// Tokens without limits store no limit attributes
+	if item := tokenItem("hash", &types.TokenInfo{ID: "id"}); item["max_nodes"] != nil || item["regions"] != nil {
+		t.Errorf("tokenItem() = %v, want no limit attributes", item)
+	}
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// transferPKPrefix starts the partitions holding what each node sent in a month;
+// the partition is "TRANSFER#<YYYY-MM>" and the sort key the instance ID
+const transferPKPrefix = "TRANSFER#"
+
+// transferRetention is how long a month's figures are kept after it ends
+const transferRetention = 90 * 24 * time.Hour
+
+// TransferMonth returns the UTC calendar month containing t, as "YYYY-MM"
+func TransferMonth(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// RecordTransfer stores how many bytes instanceID has sent in month (see
+// TransferMonth), replacing the figure recorded before
+func (s *Store) RecordTransfer(ctx context.Context, month, instanceID string, bytes int64) error {
+	start, err := time.Parse("2006-01", month)
+	if err != nil {
+		return fmt.Errorf("invalid transfer month %q: %w", month, err)
+	}
+	expires := start.AddDate(0, 1, 0).Add(transferRetention)
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]ddbtypes.AttributeValue{
+			attrPK:       &ddbtypes.AttributeValueMemberS{Value: transferPKPrefix + month},
+			attrSK:       &ddbtypes.AttributeValueMemberS{Value: instanceID},
+			"bytes":      &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(bytes, 10)},
+			"expires_at": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(expires.Unix(), 10)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record data transfer for %s: %w", instanceID, err)
+	}
+	return nil
+}
+
+// MonthlyTransfer returns the bytes every node recorded for month sent in total
+func (s *Store) MonthlyTransfer(ctx context.Context, month string) (int64, error) {
+	items, err := s.queryPartition(ctx, transferPKPrefix+month)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read data transfer for %s: %w", month, err)
+	}
+
+	var total int64
+	for _, item := range items {
+		bytes, _ := strconv.ParseInt(numberAttr(item, "bytes"), 10, 64)
+		total += bytes
+	}
+	return total, nil
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTransferMonth(t *testing.T) {
+	// 23:30 on Jan 31 in New York is already February in UTC
+	newYork := time.FixedZone("EST", -5*3600)
+	if got := TransferMonth(time.Date(2025, 1, 31, 23, 30, 0, 0, newYork)); got != "2025-02" {
+		t.Errorf("TransferMonth() = %q, want 2025-02", got)
+	}
+}
+
+func TestMonthlyTransfer(t *testing.T) {
+	ctx := context.Background()
+	s, fake := newFakeStore()
+
+	for _, record := range []struct {
+		month, instance string
+		bytes           int64
+	}{
+		{"2025-03", "i-1", 1 << 30},
+		{"2025-03", "i-2", 512 << 20},
+		{"2025-03", "i-1", 2 << 30}, // Replaces the first figure
+		{"2025-04", "i-1", 5 << 30},
+	} {
+		if err := s.RecordTransfer(ctx, record.month, record.instance, record.bytes); err != nil {
+			t.Fatalf("RecordTransfer(%s, %s): %v", record.month, record.instance, err)
+		}
+	}
+
+	total, err := s.MonthlyTransfer(ctx, "2025-03")
+	if err != nil || total != 2<<30+512<<20 {
+		t.Errorf("MonthlyTransfer(2025-03) = %d, %v, want %d", total, err, int64(2<<30+512<<20))
+	}
+	if total, err := s.MonthlyTransfer(ctx, "2025-05"); err != nil || total != 0 {
+		t.Errorf("MonthlyTransfer(empty month) = %d, %v, want 0", total, err)
+	}
+
+	// Kept for a while after the month ends, then expired
+	item := fake.items["TRANSFER#2025-03|i-1"]
+	expires := numberAttr(item, "expires_at")
+	want := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC).Add(transferRetention).Unix()
+	if expires != strconv.FormatInt(want, 10) {
+		t.Errorf("expires_at = %s, want %d", expires, want)
+	}
+
+	if err := s.RecordTransfer(ctx, "March", "i-1", 1); err == nil {
+		t.Error("RecordTransfer(bad month) succeeded")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/telegram"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// telegramPath is the webhook route tse deploy registers with Telegram. Updates
+// authenticate with telegram.SecretHeader instead of a bearer token.
+const telegramPath = "telegram"
+
+const telegramHelp = `Commands:
+/status - Exit nodes running in every region
+/start <region> - Start an exit node, e.g. /start frankfurt
+/stop <region> - Stop the exit node in a region
+/stop all - Stop exit nodes everywhere`
+
+// telegramUpdate is the part of a Telegram update the bot reads
+type telegramUpdate struct {
+	Message *struct {
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// parseTelegramCommand splits a message like "/start@tse_bot frankfurt" into
+// its command ("start") and argument ("frankfurt"). ok is false for messages
+// that aren't commands.
+func parseTelegramCommand(text string) (command, arg string, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", "", false
+	}
+	command, _, _ = strings.Cut(strings.TrimPrefix(fields[0], "/"), "@")
+	if len(fields) > 1 {
+		arg = strings.ToLower(fields[1])
+	}
+	return strings.ToLower(command), arg, true
+}
+
+// telegramChatAllowed reports whether a chat is in TSE_TELEGRAM_CHAT_IDS
+func telegramChatAllowed(chatID int64) bool {
+	ids, err := telegram.ParseChatIDs(os.Getenv(telegram.EnvChatIDs))
+	return err == nil && slices.Contains(ids, chatID)
+}
+
+// handleTelegram answers a bot update. Replies go back in the webhook response
+// (a sendMessage call), so the Lambda never calls Telegram itself. Telegram
+// retries anything but a 2xx, so updates that are ignored still get a 200.
+func handleTelegram(ctx context.Context, request events.LambdaFunctionURLRequest, method string) events.LambdaFunctionURLResponse {
+	if os.Getenv(telegram.EnvBotToken) == "" {
+		return errorResponse(http.StatusNotFound, "Not found")
+	}
+	if method != "POST" {
+		return errorResponse(http.StatusMethodNotAllowed, "Telegram webhooks are POSTs")
+	}
+
+	sourceIP := request.RequestContext.HTTP.SourceIP
+	authToken := os.Getenv("TSE_AUTH_TOKEN")
+	secret := requestHeader(request, telegram.SecretHeader)
+	if authToken == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(telegram.WebhookSecret(authToken))) != 1 {
+		log.Printf("Rejected Telegram webhook from %s: bad secret", sourceIP)
+		limiter.RecordFailure(sourceIP)
+		response := errorResponse(http.StatusUnauthorized, "Unauthorized: invalid webhook secret")
+		recordAudit(ctx, request, nil, "telegram", nil, response)
+		return response
+	}
+	limiter.RecordSuccess(sourceIP)
+
+	var update telegramUpdate
+	if err := json.Unmarshal([]byte(request.Body), &update); err != nil || update.Message == nil {
+		return jsonResponse(http.StatusOK, map[string]bool{"ok": true})
+	}
+	chatID := update.Message.Chat.ID
+	command, arg, ok := parseTelegramCommand(update.Message.Text)
+	if !ok {
+		return jsonResponse(http.StatusOK, map[string]bool{"ok": true})
+	}
+	if !telegramChatAllowed(chatID) {
+		// The ID is what the owner needs to add the chat, and tells nobody else anything
+		log.Printf("Telegram chat %d isn't in %s", chatID, telegram.EnvChatIDs)
+		return telegramReply(chatID, fmt.Sprintf("This chat can't control exit nodes. To allow it, add %d to %s and run tse deploy.", chatID, telegram.EnvChatIDs))
+	}
+
+	caller := &types.TokenInfo{ID: "telegram:" + strconv.FormatInt(chatID, 10), Name: "Telegram"}
+	arg = canonicalRegion(arg)
+	switch {
+	case command == "status":
+		return telegramReply(chatID, telegramStatus(ctx))
+	case command == "start" && arg != "":
+		response, _ := withRegionMutation(ctx, arg, "start", func() (events.LambdaFunctionURLResponse, error) {
+			return handleStartInstance(ctx, caller, arg, "")
+		})
+		recordAudit(ctx, request, caller, "start", []string{arg, "start"}, response)
+		return telegramReply(chatID, responseMessage(response))
+	case command == "stop" && arg == types.LinkAllRegions:
+		response := stopAllRegions(ctx)
+		recordAudit(ctx, request, caller, "stop", []string{arg, "stop"}, response)
+		return telegramReply(chatID, responseMessage(response))
+	case command == "stop" && arg != "":
+		response, _ := withRegionMutation(ctx, arg, "stop", func() (events.LambdaFunctionURLResponse, error) {
+			return handleStopInstances(ctx, arg, "")
+		})
+		recordAudit(ctx, request, caller, "stop", []string{arg, "stop"}, response)
+		return telegramReply(chatID, responseMessage(response))
+	default:
+		// Including a bare /start, which Telegram sends when a chat opens the bot
+		return telegramReply(chatID, telegramHelp)
+	}
+}
+
+// telegramStatus summarizes the exit nodes in every region, one line per node
+func telegramStatus(ctx context.Context) string {
+	friendlyRegions := regions.GetAllFriendlyNames()
+	all := func(ctx context.Context, friendlyRegion string) (events.LambdaFunctionURLResponse, error) {
+		return handleListInstances(ctx, friendlyRegion, false)
+	}
+
+	var lines, failed []string
+	for i, response := range inAllRegions(ctx, friendlyRegions, all) {
+		var listed types.InstancesResponse
+		if response.StatusCode != http.StatusOK || json.Unmarshal([]byte(response.Body), &listed) != nil {
+			failed = append(failed, friendlyRegions[i])
+			continue
+		}
+		for _, instance := range listed.Instances {
+			lines = append(lines, telegramNodeLine(friendlyRegions[i], instance))
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No exit nodes running.")
+	}
+	if len(failed) > 0 {
+		lines = append(lines, "Couldn't check: "+strings.Join(failed, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// telegramNodeLine describes one node, e.g. "tokyo: running, ready, up 3h12m"
+func telegramNodeLine(friendlyRegion string, instance *types.InstanceInfo) string {
+	line := friendlyRegion + ": " + instance.State
+	if instance.State == "running" {
+		if instance.Ready {
+			line += ", ready"
+		}
+		up := time.Since(instance.LaunchTime)
+		line += fmt.Sprintf(", up %dh%02dm", int(up.Hours()), int(up.Minutes())%60)
+	}
+	return line
+}
+
+// telegramReply answers an update with a message to its chat
+func telegramReply(chatID int64, text string) events.LambdaFunctionURLResponse {
+	return jsonResponse(http.StatusOK, map[string]any{
+		"method":  "sendMessage",
+		"chat_id": chatID,
+		"text":    text,
+	})
+}
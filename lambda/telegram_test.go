@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/shared/telegram"
+)
+
+func TestParseTelegramCommand(t *testing.T) {
+	tests := []struct {
+		text        string
+		wantCommand string
+		wantArg     string
+		wantOK      bool
+	}{
+		{text: "/status", wantCommand: "status", wantOK: true},
+		{text: "/start Frankfurt", wantCommand: "start", wantArg: "frankfurt", wantOK: true},
+		{text: "/stop@tse_bot all", wantCommand: "stop", wantArg: "all", wantOK: true},
+		{text: "  /start  ", wantCommand: "start", wantOK: true},
+		{text: "stop tokyo"},
+		{text: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			command, arg, ok := parseTelegramCommand(tt.text)
+			if command != tt.wantCommand || arg != tt.wantArg || ok != tt.wantOK {
+				t.Errorf("parseTelegramCommand() = %q, %q, %v; want %q, %q, %v", command, arg, ok, tt.wantCommand, tt.wantArg, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestHandlerTelegramWebhook(t *testing.T) {
+	t.Setenv("TSE_AUTH_TOKEN", "root-token")
+	t.Setenv(telegram.EnvBotToken, "123456789:AAEhBP0av28vAbCdEfGhIjKlMnOpQrStUvW")
+	t.Setenv(telegram.EnvChatIDs, "1111,-2222")
+
+	send := func(secret string, chatID int64, text string) (events.LambdaFunctionURLResponse, map[string]any) {
+		body, _ := json.Marshal(map[string]any{"message": map[string]any{"chat": map[string]any{"id": chatID}, "text": text}})
+		req := events.LambdaFunctionURLRequest{
+			RawPath: "/v1/telegram",
+			Headers: map[string]string{strings.ToLower(telegram.SecretHeader): secret},
+			Body:    string(body),
+		}
+		req.RequestContext.HTTP.Method = "POST"
+		req.RequestContext.HTTP.SourceIP = "198.51.100.50"
+		resp, _ := handler(context.Background(), req)
+		var reply map[string]any
+		json.Unmarshal([]byte(resp.Body), &reply)
+		return resp, reply
+	}
+	secret := telegram.WebhookSecret("root-token")
+
+	if resp, _ := send("wrong", 1111, "/stop all"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("bad secret: status = %d, want 401", resp.StatusCode)
+	}
+
+	// Chats outside the allowlist are told their ID and nothing runs
+	resp, reply := send(secret, 3333, "/stop all")
+	if resp.StatusCode != http.StatusOK || reply["method"] != "sendMessage" || !strings.Contains(reply["text"].(string), "3333") {
+		t.Errorf("unknown chat: %d %v, want a reply naming its ID", resp.StatusCode, reply)
+	}
+
+	for _, text := range []string{"/start", "/help"} {
+		resp, reply := send(secret, -2222, text)
+		if resp.StatusCode != http.StatusOK || reply["chat_id"] != float64(-2222) || !strings.Contains(reply["text"].(string), "/status") {
+			t.Errorf("%s: %d %v, want the help text", text, resp.StatusCode, reply)
+		}
+	}
+
+	t.Setenv(telegram.EnvBotToken, "")
+	if resp, _ := send(secret, 1111, "/status"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("without a bot token: status = %d, want 404", resp.StatusCode)
+	}
+}
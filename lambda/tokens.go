@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/lambda/store"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// tokenStore is the subset of the state store used for scoped tokens
+type tokenStore interface {
+	CreateToken(ctx context.Context, name string, scopes []string, limits types.TokenLimits) (string, *types.TokenInfo, error)
+	LookupToken(ctx context.Context, secret string) (*types.TokenInfo, error)
+	ListTokens(ctx context.Context) ([]*types.TokenInfo, error)
+	RevokeToken(ctx context.Context, id string) (*types.TokenInfo, error)
+}
+
+// tokens holds issued scoped tokens; nil when no state table is configured,
+// in which case only TSE_AUTH_TOKEN is accepted
+var tokens tokenStore
+
+// rootToken identifies requests made with the deployment's TSE_AUTH_TOKEN
+var rootToken = &types.TokenInfo{ID: "root", Name: "TSE_AUTH_TOKEN", Scopes: types.AllScopes}
+
+// envReadToken configures a second deployment token for dashboards and the like.
+// It can only read: GET routes that need at most the read scope.
+const envReadToken = "TSE_READ_TOKEN"
+
+// readToken identifies requests made with the deployment's TSE_READ_TOKEN
+var readToken = &types.TokenInfo{ID: "read", Name: envReadToken, Scopes: []string{types.ScopeRead}}
+
+// errTokenLookup marks failures to reach the token store (as opposed to bad tokens)
+var errTokenLookup = errors.New("token lookup failed")
+
+// authenticate identifies the caller: the deployment's TSE_AUTH_TOKEN grants every
+// scope and its TSE_READ_TOKEN only reading, otherwise the bearer token must be
+// an unrevoked token from the store
+func authenticate(ctx context.Context, request events.LambdaFunctionURLRequest) (*types.TokenInfo, error) {
+	rootErr := validateAuth(request)
+	if rootErr == nil {
+		return rootToken, nil
+	}
+
+	secret := bearerToken(authorizationHeader(request))
+	if expected := os.Getenv(envReadToken); expected != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) == 1 {
+		return readToken, nil
+	}
+	if tokens == nil || secret == "" {
+		return nil, rootErr
+	}
+
+	info, err := tokens.LookupToken(ctx, secret)
+	switch {
+	case errors.Is(err, store.ErrTokenNotFound):
+		return nil, fmt.Errorf("invalid token")
+	case errors.Is(err, store.ErrTokenRevoked):
+		return nil, fmt.Errorf("token %s has been revoked", info.ID)
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", errTokenLookup, err)
+	}
+
+	return info, nil
+}
+
+// requiredScope maps a route to the scope a token needs to call it.
+// Returns "" for routes any valid token may call (health check, unknown paths).
+func requiredScope(method string, parts []string) string {
+	if len(parts) == 0 || parts[0] == "" {
+		return ""
+	}
+
+	if parts[0] == "tokens" || parts[0] == "audit" {
+		return types.ScopeAdmin
+	}
+
+	if parts[0] == "jobs" || (len(parts) == 1 && parts[0] == "instances") {
+		return types.ScopeRead
+	}
+
+	if len(parts) != 2 {
+		return ""
+	}
+
+	switch {
+	case method == "GET" && (parts[1] == "instances" || parts[1] == "compliance" || parts[1] == "reservation" || parts[1] == "network"):
+		return types.ScopeRead
+	case method == "POST" && (parts[1] == "start" || parts[1] == "resume" || parts[1] == "restart"):
+		return types.ScopeStart
+	case method == "POST" && (parts[1] == "stop" || parts[1] == "pause"):
+		return types.ScopeStop
+	case method == "POST" && parts[1] == "cleanup":
+		return types.ScopeCleanup
+	case method == "POST" && (parts[1] == "adopt" || parts[1] == "reserve" || parts[1] == "unreserve"):
+		return types.ScopeAdmin
+	case method == "POST" && (parts[1] == "keep-network" || parts[1] == "release-network"):
+		return types.ScopeAdmin
+	}
+	return ""
+}
+
+// missingScope returns a scope the route needs that the caller's token lacks,
+// or "" if it has them all. A restart stops a node as well as starting one, so
+// it needs the stop scope too.
+func missingScope(caller *types.TokenInfo, method string, parts []string) string {
+	scopes := []string{requiredScope(method, parts)}
+	if method == "POST" && len(parts) == 2 && parts[1] == "restart" {
+		scopes = append(scopes, types.ScopeStop)
+	}
+	for _, scope := range scopes {
+		if scope != "" && !caller.HasScope(scope) {
+			return scope
+		}
+	}
+	return ""
+}
+
+// handleListTokens lists issued tokens (never their secrets)
+func handleListTokens(ctx context.Context) (events.LambdaFunctionURLResponse, error) {
+	if tokens == nil {
+		return errorResponse(http.StatusNotImplemented, "Scoped tokens require the state table (redeploy with 'tse deploy')"), nil
+	}
+
+	list, err := tokens.ListTokens(ctx)
+	if err != nil {
+		return awsErrorResponse("Failed to list tokens", err), nil
+	}
+
+	response := types.TokensResponse{
+		Success: true,
+		Message: fmt.Sprintf("Found %d tokens", len(list)),
+		Tokens:  list,
+	}
+
+	return jsonResponse(http.StatusOK, response), nil
+}
+
+// handleCreateToken issues a new scoped token
+func handleCreateToken(ctx context.Context, body string) (events.LambdaFunctionURLResponse, error) {
+	if tokens == nil {
+		return errorResponse(http.StatusNotImplemented, "Scoped tokens require the state table (redeploy with 'tse deploy')"), nil
+	}
+
+	var req types.CreateTokenRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err)), nil
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errorResponse(http.StatusBadRequest, "Token name is required"), nil
+	}
+	if len(req.Scopes) == 0 {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("At least one scope is required (%s)", strings.Join(types.AllScopes, ", "))), nil
+	}
+	for _, scope := range req.Scopes {
+		if !types.IsValidScope(scope) {
+			return errorResponse(http.StatusBadRequest, fmt.Sprintf("Unknown scope %q (valid: %s)", scope, strings.Join(types.AllScopes, ", "))), nil
+		}
+	}
+
+	if req.MaxNodes < 0 {
+		return errorResponse(http.StatusBadRequest, "max_nodes can't be negative"), nil
+	}
+	for i, region := range req.Regions {
+		resolved, err := regions.Resolve(region)
+		if err != nil {
+			return codedErrorResponse(http.StatusBadRequest, types.ErrorCodeRegionInvalid, err.Error()), nil
+		}
+		req.Regions[i] = resolved
+	}
+
+	secret, info, err := tokens.CreateToken(ctx, req.Name, req.Scopes, req.TokenLimits)
+	if err != nil {
+		return awsErrorResponse("Failed to create token", err), nil
+	}
+
+	log.Printf("Issued token %s (%s) with scopes %v and limits %+v", info.ID, info.Name, info.Scopes, info.TokenLimits)
+
+	response := types.CreateTokenResponse{
+		Success: true,
+		Message: fmt.Sprintf("Created token %s", info.ID),
+		Secret:  secret,
+		Token:   info,
+	}
+
+	return jsonResponse(http.StatusCreated, response), nil
+}
+
+// handleRevokeToken revokes a token by ID
+func handleRevokeToken(ctx context.Context, id string) (events.LambdaFunctionURLResponse, error) {
+	if tokens == nil {
+		return errorResponse(http.StatusNotImplemented, "Scoped tokens require the state table (redeploy with 'tse deploy')"), nil
+	}
+
+	info, err := tokens.RevokeToken(ctx, id)
+	if errors.Is(err, store.ErrTokenNotFound) {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("Token %s not found", id)), nil
+	}
+	if err != nil {
+		return awsErrorResponse("Failed to revoke token", err), nil
+	}
+
+	log.Printf("SECURITY: revoked token %s (%s)", info.ID, info.Name)
+
+	response := types.TokensResponse{
+		Success: true,
+		Message: fmt.Sprintf("Revoked token %s (%s)", info.ID, info.Name),
+		Tokens:  []*types.TokenInfo{info},
+	}
+
+	return jsonResponse(http.StatusOK, response), nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/lambda/store"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// fakeTokens is an in-memory tokenStore keyed by secret
+type fakeTokens map[string]*types.TokenInfo
+
+func (f fakeTokens) CreateToken(ctx context.Context, name string, scopes []string, limits types.TokenLimits) (string, *types.TokenInfo, error) {
+	info := &types.TokenInfo{ID: name, Name: name, Scopes: scopes, TokenLimits: limits}
+	f["tse_"+name] = info
+	return "tse_" + name, info, nil
+}
+
+func (f fakeTokens) LookupToken(ctx context.Context, secret string) (*types.TokenInfo, error) {
+	info, ok := f[secret]
+	if !ok {
+		return nil, store.ErrTokenNotFound
+	}
+	if info.Revoked() {
+		return info, store.ErrTokenRevoked
+	}
+	return info, nil
+}
+
+func (f fakeTokens) ListTokens(ctx context.Context) ([]*types.TokenInfo, error) {
+	var list []*types.TokenInfo
+	for _, info := range f {
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+func (f fakeTokens) RevokeToken(ctx context.Context, id string) (*types.TokenInfo, error) {
+	for _, info := range f {
+		if info.ID == id {
+			info.RevokedAt = time.Now()
+			return info, nil
+		}
+	}
+	return nil, store.ErrTokenNotFound
+}
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"GET", "", ""},
+		{"GET", "ohio/instances", types.ScopeRead},
+		{"GET", "ohio/compliance", types.ScopeRead},
+		{"POST", "ohio/start", types.ScopeStart},
+		{"POST", "ohio/stop", types.ScopeStop},
+		{"POST", "ohio/pause", types.ScopeStop},
+		{"POST", "ohio/resume", types.ScopeStart},
+		{"POST", "ohio/restart", types.ScopeStart},
+		{"POST", "ohio/cleanup", types.ScopeCleanup},
+		{"POST", "ohio/adopt", types.ScopeAdmin},
+		{"GET", "ohio/reservation", types.ScopeRead},
+		{"POST", "ohio/reserve", types.ScopeAdmin},
+		{"POST", "ohio/unreserve", types.ScopeAdmin},
+		{"GET", "ohio/network", types.ScopeRead},
+		{"POST", "ohio/keep-network", types.ScopeAdmin},
+		{"POST", "ohio/release-network", types.ScopeAdmin},
+		{"GET", "tokens", types.ScopeAdmin},
+		{"POST", "tokens", types.ScopeAdmin},
+		{"DELETE", "tokens/abc123", types.ScopeAdmin},
+		{"GET", "audit", types.ScopeAdmin},
+		{"GET", "jobs/job-0123", types.ScopeRead},
+		{"GET", "nonsense/path/here", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" /"+tt.path, func(t *testing.T) {
+			got := requiredScope(tt.method, strings.Split(tt.path, "/"))
+			if got != tt.want {
+				t.Errorf("requiredScope() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingScope(t *testing.T) {
+	startOnly := &types.TokenInfo{Scopes: []string{types.ScopeStart}}
+	both := &types.TokenInfo{Scopes: []string{types.ScopeStart, types.ScopeStop}}
+	restart := strings.Split("ohio/restart", "/")
+
+	if got := missingScope(startOnly, "POST", strings.Split("ohio/start", "/")); got != "" {
+		t.Errorf("missingScope(start-only, start) = %q, want none", got)
+	}
+	if got := missingScope(startOnly, "POST", restart); got != types.ScopeStop {
+		t.Errorf("missingScope(start-only, restart) = %q, want %q", got, types.ScopeStop)
+	}
+	if got := missingScope(both, "POST", restart); got != "" {
+		t.Errorf("missingScope(start and stop, restart) = %q, want none", got)
+	}
+}
+
+func TestHandlerEnforcesTokenScopes(t *testing.T) {
+	os.Setenv("TSE_AUTH_TOKEN", "root-token")
+	defer os.Unsetenv("TSE_AUTH_TOKEN")
+
+	fake := fakeTokens{
+		"tse_stop-only": {ID: "stop-only", Name: "friend", Scopes: []string{types.ScopeStop}},
+		"tse_revoked":   {ID: "revoked", Name: "lost-phone", Scopes: types.AllScopes, RevokedAt: time.Now()},
+	}
+	tokens = fake
+	defer func() { tokens = nil }()
+
+	request := func(method, path, token string) events.LambdaFunctionURLResponse {
+		req := events.LambdaFunctionURLRequest{
+			RawPath: path,
+			Headers: map[string]string{"Authorization": "Bearer " + token},
+		}
+		req.RequestContext.HTTP.Method = method
+		req.RequestContext.HTTP.SourceIP = "203.0.113.50"
+		resp, _ := handler(context.Background(), req)
+		return resp
+	}
+
+	// Health check needs no particular scope
+	if resp := request("GET", "/", "tse_stop-only"); resp.StatusCode != http.StatusOK {
+		t.Errorf("health with scoped token: status = %d, want 200", resp.StatusCode)
+	}
+
+	// Missing scope is forbidden before any AWS call is made
+	if resp := request("POST", "/ohio/start", "tse_stop-only"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("start with stop-only token: status = %d, want 403", resp.StatusCode)
+	}
+	if resp := request("GET", "/tokens", "tse_stop-only"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("list tokens with stop-only token: status = %d, want 403", resp.StatusCode)
+	}
+
+	// Revoked tokens are rejected outright
+	if resp := request("GET", "/", "tse_revoked"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("revoked token: status = %d, want 401", resp.StatusCode)
+	}
+
+	// The root token can manage tokens
+	if resp := request("GET", "/tokens", "root-token"); resp.StatusCode != http.StatusOK {
+		t.Errorf("list tokens with root token: status = %d, want 200", resp.StatusCode)
+	}
+	if resp := request("POST", "/tokens", "root-token"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("create token without body: status = %d, want 400", resp.StatusCode)
+	}
+	if resp := request("DELETE", "/tokens/stop-only", "root-token"); resp.StatusCode != http.StatusOK {
+		t.Errorf("revoke token: status = %d, want 200", resp.StatusCode)
+	}
+	if resp := request("GET", "/", "tse_stop-only"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("token after revocation: status = %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestHandlerReadToken(t *testing.T) {
+	t.Setenv("TSE_AUTH_TOKEN", "root-token")
+	t.Setenv(envReadToken, "dashboard-token")
+
+	request := func(method, path, token string) events.LambdaFunctionURLResponse {
+		req := events.LambdaFunctionURLRequest{
+			RawPath: path,
+			Headers: map[string]string{"Authorization": "Bearer " + token},
+		}
+		req.RequestContext.HTTP.Method = method
+		req.RequestContext.HTTP.SourceIP = "203.0.113.51"
+		resp, _ := handler(context.Background(), req)
+		return resp
+	}
+
+	if resp := request("GET", "/", "dashboard-token"); resp.StatusCode != http.StatusOK {
+		t.Errorf("health with read token: status = %d, want 200", resp.StatusCode)
+	}
+
+	// Nothing that changes anything, whether or not the route needs a scope
+	for _, route := range []struct{ method, path string }{
+		{"POST", "/ohio/start"},
+		{"POST", "/ohio/stop"},
+		{"POST", "/cleanup"},
+		{"GET", "/tokens"},
+		{"POST", "/"},
+	} {
+		if resp := request(route.method, route.path, "dashboard-token"); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s %s with read token: status = %d, want 403", route.method, route.path, resp.StatusCode)
+		}
+	}
+
+	// Without TSE_READ_TOKEN configured, nothing matches it
+	t.Setenv(envReadToken, "")
+	if resp := request("GET", "/", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("empty token with no read token configured: status = %d, want 401", resp.StatusCode)
+	}
+}
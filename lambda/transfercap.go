@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anoldguy/tse/lambda/aws"
+	"github.com/anoldguy/tse/lambda/notify"
+	"github.com/anoldguy/tse/lambda/store"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// Data transfer caps, in GB (2^30 bytes), set by 'tse deploy --node-cap/--monthly-cap'.
+// Unset or 0 means no cap.
+const (
+	envNodeCapGB    = "TSE_NODE_CAP_GB"
+	envMonthlyCapGB = "TSE_MONTHLY_CAP_GB"
+)
+
+// transferCaps are the limits the scheduled sweep enforces, in bytes; zero means none
+type transferCaps struct {
+	perNode int64 // What one node may send over its lifetime
+	monthly int64 // What all nodes together may send in a UTC calendar month
+}
+
+// caps holds the deployment's limits; the zero value (no caps) when unset or invalid
+var caps transferCaps
+
+// transferStore is the subset of the state store that totals a month's data transfer
+type transferStore interface {
+	RecordTransfer(ctx context.Context, month, instanceID string, bytes int64) error
+	MonthlyTransfer(ctx context.Context, month string) (int64, error)
+}
+
+// transferLog remembers what each node sent this month, so the monthly cap also
+// counts nodes that have since stopped; nil when no state table is configured,
+// in which case only running nodes count
+var transferLog transferStore
+
+// enabled reports whether any cap is set
+func (c transferCaps) enabled() bool {
+	return c.perNode > 0 || c.monthly > 0
+}
+
+// transferCapsFromEnv reads the caps from TSE_NODE_CAP_GB and TSE_MONTHLY_CAP_GB
+func transferCapsFromEnv() (transferCaps, error) {
+	perNode, err := parseCapGB(envNodeCapGB)
+	if err != nil {
+		return transferCaps{}, err
+	}
+	monthly, err := parseCapGB(envMonthlyCapGB)
+	if err != nil {
+		return transferCaps{}, err
+	}
+	return transferCaps{perNode: perNode, monthly: monthly}, nil
+}
+
+// parseCapGB reads a cap in GB from the environment variable name, returning bytes
+func parseCapGB(name string) (int64, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return 0, nil
+	}
+	gb, err := strconv.ParseFloat(raw, 64)
+	if err != nil || gb < 0 {
+		return 0, fmt.Errorf("%s must be a number of GB, got %q", name, raw)
+	}
+	return int64(gb * (1 << 30)), nil
+}
+
+// overCap explains why a node that sent sent bytes since launch, while all nodes
+// sent monthTotal this month, breaks a cap; "" when it doesn't
+func (c transferCaps) overCap(sent, monthTotal int64) string {
+	switch {
+	case c.perNode > 0 && sent > c.perNode:
+		return fmt.Sprintf("it sent %s, over the %s per-node cap", formatGB(sent), formatGB(c.perNode))
+	case c.monthly > 0 && monthTotal > c.monthly:
+		return fmt.Sprintf("exit nodes have sent %s this month, over the %s monthly cap", formatGB(monthTotal), formatGB(c.monthly))
+	}
+	return ""
+}
+
+// formatGB renders bytes in GB for log lines and notifications
+func formatGB(bytes int64) string {
+	return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+}
+
+// measuredNode is a running exit node and what it has sent
+type measuredNode struct {
+	region    string
+	service   *aws.Service
+	instance  *types.InstanceInfo
+	thisMonth int64 // Bytes sent since the start of the month (or launch, if later)
+}
+
+// enforceTransferCaps terminates running exit nodes that broke a cap, notifying
+// for each. Every node's figure for the month is recorded first, so the monthly
+// total includes nodes stopped earlier in the month.
+func enforceTransferCaps(ctx context.Context, c transferCaps) error {
+	now := time.Now()
+	month := store.TransferMonth(now)
+	monthStart, _ := time.Parse("2006-01", month)
+
+	nodes, err := measureRunningNodes(ctx, monthStart)
+	if err != nil {
+		// Enforce what could be measured; a failing region shouldn't shield the others
+		log.Printf("Data transfer caps: %v", err)
+	}
+
+	var monthTotal int64
+	for _, node := range nodes {
+		monthTotal += node.thisMonth
+		if transferLog != nil {
+			if err := transferLog.RecordTransfer(ctx, month, node.instance.InstanceID, node.thisMonth); err != nil {
+				log.Printf("Data transfer caps: %v", err)
+			}
+		}
+	}
+	if c.monthly > 0 && transferLog != nil {
+		if total, err := transferLog.MonthlyTransfer(ctx, month); err != nil {
+			log.Printf("Data transfer caps: counting running nodes only: %v", err)
+		} else {
+			monthTotal = total
+		}
+	}
+
+	for _, node := range nodes {
+		reason := c.overCap(node.instance.NetworkOutBytes, monthTotal)
+		if reason == "" {
+			continue
+		}
+		if err := node.service.TerminateInstance(ctx, node.instance.InstanceID); err != nil {
+			log.Printf("Data transfer caps: %v", err)
+			continue
+		}
+		log.Printf("Terminated %s in %s: %s", node.instance.InstanceID, node.region, reason)
+		unregisterNodes(ctx, []string{node.instance.InstanceID})
+		notifier.Notify(ctx, notify.Event{
+			Type:        notify.EventNodeReaped,
+			Region:      node.region,
+			InstanceIDs: []string{node.instance.InstanceID},
+			Message:     fmt.Sprintf("Exit node in %s terminated: %s", node.region, reason),
+		})
+	}
+	return err
+}
+
+// measureRunningNodes finds the running exit nodes in every region, with what
+// each sent since launch (NetworkOutBytes) and since monthStart
+func measureRunningNodes(ctx context.Context, monthStart time.Time) ([]measuredNode, error) {
+	friendlyRegions := regions.GetAllFriendlyNames()
+	found := make([][]measuredNode, len(friendlyRegions))
+	errs := make([]error, len(friendlyRegions))
+
+	var wg sync.WaitGroup
+	for i, friendlyRegion := range friendlyRegions {
+		wg.Add(1)
+		go func(i int, friendlyRegion string) {
+			defer wg.Done()
+			found[i], errs[i] = measureRegion(ctx, friendlyRegion, monthStart)
+		}(i, friendlyRegion)
+	}
+	wg.Wait()
+
+	var nodes []measuredNode
+	failed := 0
+	for i, friendlyRegion := range friendlyRegions {
+		if errs[i] != nil {
+			log.Printf("Failed to measure data transfer in %s: %v", friendlyRegion, errs[i])
+			failed++
+		}
+		nodes = append(nodes, found[i]...)
+	}
+	if failed > 0 {
+		return nodes, fmt.Errorf("failed to measure data transfer in %d of %d regions", failed, len(friendlyRegions))
+	}
+	return nodes, nil
+}
+
+// measureRegion measures the running exit nodes in one region. Nodes it
+// couldn't read metrics for are left out, so they're never terminated on a guess.
+func measureRegion(ctx context.Context, friendlyRegion string, monthStart time.Time) ([]measuredNode, error) {
+	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+	if err != nil {
+		return nil, err
+	}
+	if !regionEnabled(ctx, awsRegion) {
+		return nil, nil
+	}
+
+	service, err := aws.New(ctx, awsRegion)
+	if err != nil {
+		return nil, err
+	}
+	instances, err := service.ListInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []measuredNode
+	var firstErr error
+	for _, instance := range instances {
+		if instance.State != "running" {
+			continue
+		}
+		sent, err := service.NetworkOut(ctx, instance.InstanceID, instance.LaunchTime)
+		if err != nil {
+			firstErr = err
+			continue
+		}
+		instance.NetworkOutBytes = sent
+
+		thisMonth := sent
+		if instance.LaunchTime.Before(monthStart) {
+			if thisMonth, err = service.NetworkOut(ctx, instance.InstanceID, monthStart); err != nil {
+				firstErr = err
+				continue
+			}
+		}
+		nodes = append(nodes, measuredNode{region: friendlyRegion, service: service, instance: instance, thisMonth: thisMonth})
+	}
+	return nodes, firstErr
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransferCapsFromEnv(t *testing.T) {
+	t.Setenv(envNodeCapGB, "")
+	t.Setenv(envMonthlyCapGB, "")
+	if c, err := transferCapsFromEnv(); err != nil || c.enabled() {
+		t.Errorf("transferCapsFromEnv(unset) = %+v, %v, want no caps", c, err)
+	}
+
+	t.Setenv(envNodeCapGB, "50")
+	t.Setenv(envMonthlyCapGB, "0.5")
+	c, err := transferCapsFromEnv()
+	if err != nil || c.perNode != 50<<30 || c.monthly != 512<<20 {
+		t.Errorf("transferCapsFromEnv() = %+v, %v, want 50 GB and 0.5 GB", c, err)
+	}
+
+	t.Setenv(envNodeCapGB, "0")
+	t.Setenv(envMonthlyCapGB, "0")
+	if c, err := transferCapsFromEnv(); err != nil || c.enabled() {
+		t.Errorf("transferCapsFromEnv(0) = %+v, %v, want no caps", c, err)
+	}
+
+	for _, bad := range []string{"lots", "-1", "10GB"} {
+		t.Setenv(envMonthlyCapGB, bad)
+		if _, err := transferCapsFromEnv(); err == nil {
+			t.Errorf("transferCapsFromEnv(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestOverCap(t *testing.T) {
+	c := transferCaps{perNode: 10 << 30, monthly: 100 << 30}
+	tests := []struct {
+		name       string
+		caps       transferCaps
+		sent       int64
+		monthTotal int64
+		want       string // Substring of the reason; "" for none
+	}{
+		{"under both", c, 5 << 30, 50 << 30, ""},
+		{"at the node cap", c, 10 << 30, 50 << 30, ""},
+		{"over the node cap", c, 11 << 30, 50 << 30, "11.0 GB, over the 10.0 GB per-node cap"},
+		{"over the monthly cap", c, 1 << 30, 101 << 30, "101.0 GB this month, over the 100.0 GB monthly cap"},
+		{"node cap wins", c, 11 << 30, 101 << 30, "per-node cap"},
+		{"only a monthly cap", transferCaps{monthly: 100 << 30}, 99 << 30, 99 << 30, ""},
+		{"no caps", transferCaps{}, 1 << 40, 1 << 40, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.caps.overCap(tt.sent, tt.monthTotal)
+			if tt.want == "" && got != "" || tt.want != "" && !strings.Contains(got, tt.want) {
+				t.Errorf("overCap() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"embed"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// uiFiles is the web UI: a page listing regions with start/stop buttons, built
+// on the same API as the CLI
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// uiContentTypes maps the UI's file extensions to their Content-Type
+var uiContentTypes = map[string]string{
+	".html": "text/html; charset=utf-8",
+	".css":  "text/css; charset=utf-8",
+	".js":   "text/javascript; charset=utf-8",
+}
+
+// uiSecurityPolicy only lets the page load its own files and call its own
+// Lambda, so nothing else ever sees the token it holds
+const uiSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; connect-src 'self'; form-action 'none'; frame-ancestors 'none'; base-uri 'none'"
+
+// isUIPath reports whether a route path is the web UI's ("ui" or "ui/<file>")
+func isUIPath(routePath string) bool {
+	return routePath == "ui" || strings.HasPrefix(routePath, "ui/")
+}
+
+// handleUI serves one of the UI's files. They hold no data, so they're served
+// without a token; the page asks for one and sends it with every API call.
+func handleUI(routePath string) events.LambdaFunctionURLResponse {
+	name := strings.TrimPrefix(strings.TrimPrefix(routePath, "ui"), "/")
+	if name == "" {
+		name = "index.html"
+	}
+	contentType, ok := uiContentTypes[path.Ext(name)]
+	if !ok || strings.Contains(name, "/") {
+		return errorResponse(http.StatusNotFound, "Not found")
+	}
+	body, err := uiFiles.ReadFile("ui/" + name)
+	if err != nil {
+		return errorResponse(http.StatusNotFound, "Not found")
+	}
+	return events.LambdaFunctionURLResponse{
+		StatusCode: http.StatusOK,
+		Headers: map[string]string{
+			"Content-Type":            contentType,
+			"Content-Security-Policy": uiSecurityPolicy,
+			"Cache-Control":           "no-cache",
+			"X-Content-Type-Options":  "nosniff",
+			"Referrer-Policy":         "no-referrer",
+		},
+		Body: string(body),
+	}
+}
@@ -0,0 +1,171 @@
+// Talks to the same /v1 API as the tse CLI, with the token kept in localStorage.
+"use strict";
+
+const tokenKey = "tse-token";
+
+const $ = (id) => document.getElementById(id);
+
+// api calls the Lambda and returns the parsed JSON body, throwing the API's
+// error message (and keeping its error_code) when the request fails
+async function api(method, path, body) {
+  const response = await fetch("/v1/" + path, {
+    method,
+    headers: {
+      Authorization: "Bearer " + localStorage.getItem(tokenKey),
+      "Content-Type": "application/json",
+    },
+    body: body === undefined ? undefined : JSON.stringify(body),
+    cache: "no-store",
+  });
+  const data = await response.json().catch(() => ({}));
+  if (!response.ok) {
+    const err = new Error(data.error || response.status + " " + response.statusText);
+    err.status = response.status;
+    err.code = data.error_code;
+    throw err;
+  }
+  return data;
+}
+
+function showMessage(text, isError) {
+  $("message").textContent = text;
+  $("message").className = isError ? "error" : "";
+}
+
+function signedOut(text) {
+  localStorage.removeItem(tokenKey);
+  $("actions").hidden = true;
+  $("regions").replaceChildren();
+  $("login").hidden = false;
+  showMessage(text || "", Boolean(text));
+}
+
+function since(iso) {
+  const minutes = Math.max(0, Math.round((Date.now() - Date.parse(iso)) / 60000));
+  return minutes < 60 ? minutes + "m" : Math.floor(minutes / 60) + "h " + (minutes % 60) + "m";
+}
+
+// describe summarizes a region's nodes for its row
+function describe(instances) {
+  const live = instances.filter((i) => i.state !== "terminated" && i.state !== "shutting-down");
+  if (live.length === 0) {
+    return { text: "No node", cls: "", running: false };
+  }
+  const node = live[0];
+  if (node.state === "running" && node.ready) {
+    return { text: (node.tailscale_hostname || node.instance_id) + " · up " + since(node.launch_time), cls: "ready", running: true };
+  }
+  return { text: node.state + (node.state === "running" ? ", connecting" : ""), cls: "pending", running: true };
+}
+
+function button(label, onClick) {
+  const b = document.createElement("button");
+  b.type = "button";
+  b.textContent = label;
+  b.addEventListener("click", onClick);
+  return b;
+}
+
+// renderRegion fills a region's row from its instances, or the error listing them
+function renderRegion(row, region, instances, err) {
+  const name = document.createElement("span");
+  name.className = "region";
+  name.textContent = region;
+  const state = document.createElement("span");
+  state.className = "state";
+  row.className = "";
+  row.replaceChildren(name, state);
+
+  if (err) {
+    if (err.code === "REGION_DISABLED") {
+      row.className = "disabled";
+      state.textContent = "Not enabled in this account";
+    } else {
+      state.classList.add("error");
+      state.textContent = err.message;
+    }
+    return;
+  }
+
+  const status = describe(instances);
+  state.textContent = status.text;
+  if (status.cls) {
+    state.classList.add(status.cls);
+  }
+  const action = status.running
+    ? button("Stop", () => act(row, region, "stop", "Stop the exit node in " + region + "?"))
+    : button("Start", () => act(row, region, "start"));
+  row.append(action);
+}
+
+async function loadRegion(row, region) {
+  try {
+    const data = await api("GET", region + "/instances");
+    renderRegion(row, region, data.instances || []);
+  } catch (err) {
+    if (err.status === 401) {
+      signedOut(err.message);
+      return;
+    }
+    renderRegion(row, region, null, err);
+  }
+}
+
+// act starts or stops a region's node, then refreshes its row
+async function act(row, region, verb, question) {
+  if (question && !confirm(question)) {
+    return;
+  }
+  row.querySelectorAll("button").forEach((b) => (b.disabled = true));
+  showMessage((verb === "start" ? "Starting" : "Stopping") + " " + region + "…");
+  try {
+    const body = verb === "start" ? { client_token: crypto.randomUUID() } : undefined;
+    const data = await api("POST", region + "/" + verb, body);
+    showMessage(data.message || "");
+  } catch (err) {
+    showMessage(region + ": " + err.message, true);
+  }
+  await loadRegion(row, region);
+}
+
+async function refresh() {
+  showMessage("Loading…");
+  let health;
+  try {
+    health = await api("GET", "");
+  } catch (err) {
+    if (err.status === 401) {
+      signedOut(err.message);
+    } else {
+      showMessage(err.message, true);
+    }
+    return;
+  }
+  $("login").hidden = true;
+  $("actions").hidden = false;
+
+  const list = $("regions");
+  list.replaceChildren();
+  await Promise.all((health.regions || []).map((region) => {
+    const row = document.createElement("li");
+    row.textContent = region;
+    list.append(row);
+    return loadRegion(row, region);
+  }));
+  showMessage("Updated " + new Date().toLocaleTimeString());
+}
+
+$("login").addEventListener("submit", (event) => {
+  event.preventDefault();
+  localStorage.setItem(tokenKey, $("token").value.trim());
+  $("token").value = "";
+  refresh();
+});
+$("refresh").addEventListener("click", refresh);
+$("forget").addEventListener("click", () => signedOut());
+
+if (localStorage.getItem(tokenKey)) {
+  refresh();
+} else {
+  signedOut();
+}
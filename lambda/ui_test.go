@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestHandlerServesUI(t *testing.T) {
+	t.Setenv("TSE_AUTH_TOKEN", "test-token-12345")
+
+	tests := []struct {
+		method      string
+		path        string
+		wantStatus  int
+		contentType string
+	}{
+		{method: "GET", path: "/ui", wantStatus: http.StatusOK, contentType: "text/html"},
+		{method: "GET", path: "/v1/ui", wantStatus: http.StatusOK, contentType: "text/html"},
+		{method: "GET", path: "/ui/app.js", wantStatus: http.StatusOK, contentType: "text/javascript"},
+		{method: "GET", path: "/ui/style.css", wantStatus: http.StatusOK, contentType: "text/css"},
+		{method: "GET", path: "/ui/missing.js", wantStatus: http.StatusNotFound},
+		{method: "GET", path: "/ui/../main.go", wantStatus: http.StatusNotFound},
+		// Only reading the page skips the token
+		{method: "POST", path: "/ui", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			request := events.LambdaFunctionURLRequest{RawPath: tt.path}
+			request.RequestContext.HTTP.Method = tt.method
+			request.RequestContext.HTTP.SourceIP = "198.51.100.30"
+
+			resp, err := handler(context.Background(), request)
+			if err != nil {
+				t.Fatalf("handler() error = %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.contentType == "" {
+				return
+			}
+			if !strings.HasPrefix(resp.Headers["Content-Type"], tt.contentType) {
+				t.Errorf("Content-Type = %q, want %s", resp.Headers["Content-Type"], tt.contentType)
+			}
+			if resp.Headers["Content-Security-Policy"] == "" {
+				t.Error("missing Content-Security-Policy")
+			}
+		})
+	}
+}
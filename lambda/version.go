@@ -0,0 +1,24 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// versionSegment matches a path's leading API version, e.g. "v1"
+var versionSegment = regexp.MustCompile(`^v[0-9]+$`)
+
+// apiPath strips the API version from a request path, returning the route
+// path (e.g. "ohio/start") that requiredScope, auditAction and route work on.
+// An unversioned path is served as the current version, so CLIs from before
+// versioning keep working. ok is false for a version this Lambda doesn't serve.
+func apiPath(rawPath string) (path string, ok bool) {
+	path = strings.TrimPrefix(rawPath, "/")
+	version, rest, _ := strings.Cut(path, "/")
+	if !versionSegment.MatchString(version) {
+		return path, true
+	}
+	return rest, version == types.APIVersion
+}
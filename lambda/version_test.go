@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func TestAPIPath(t *testing.T) {
+	tests := []struct {
+		rawPath string
+		want    string
+		ok      bool
+	}{
+		{"/", "", true},
+		{"/v1", "", true},
+		{"/v1/", "", true},
+		{"/ohio/start", "ohio/start", true},
+		{"/v1/ohio/start", "ohio/start", true},
+		{"/v1/tokens/abc", "tokens/abc", true},
+		{"/v2/ohio/start", "ohio/start", false},
+		{"/virginia/instances", "virginia/instances", true},
+	}
+
+	for _, tt := range tests {
+		path, ok := apiPath(tt.rawPath)
+		if path != tt.want || ok != tt.ok {
+			t.Errorf("apiPath(%q) = %q, %v; want %q, %v", tt.rawPath, path, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestHandlerServesVersionedAndLegacyPaths(t *testing.T) {
+	os.Setenv("TSE_AUTH_TOKEN", "test-token-12345")
+	defer os.Unsetenv("TSE_AUTH_TOKEN")
+
+	request := func(path string) events.LambdaFunctionURLRequest {
+		r := events.LambdaFunctionURLRequest{
+			RawPath: path,
+			Headers: map[string]string{"Authorization": "Bearer test-token-12345"},
+		}
+		r.RequestContext.HTTP.Method = "GET"
+		r.RequestContext.HTTP.SourceIP = "198.51.100.20"
+		return r
+	}
+
+	for _, path := range []string{"/", "/v1/"} {
+		resp, _ := handler(context.Background(), request(path))
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s status = %d, want 200", path, resp.StatusCode)
+		}
+		if resp.Headers[types.APIVersionHeader] != types.APIVersion {
+			t.Errorf("GET %s %s header = %q, want %q", path, types.APIVersionHeader, resp.Headers[types.APIVersionHeader], types.APIVersion)
+		}
+		var health types.HealthResponse
+		if err := json.Unmarshal([]byte(resp.Body), &health); err != nil || health.APIVersion != types.APIVersion {
+			t.Errorf("GET %s api_version = %q, %v", path, health.APIVersion, err)
+		}
+	}
+
+	resp, _ := handler(context.Background(), request("/v9/ohio/instances"))
+	var errorResp types.ErrorResponse
+	if err := json.Unmarshal([]byte(resp.Body), &errorResp); err != nil {
+		t.Fatalf("invalid error response: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound || errorResp.ErrorCode != types.ErrorCodeVersionUnsupported {
+		t.Errorf("GET /v9/ohio/instances = %d %s, want 404 %s", resp.StatusCode, errorResp.ErrorCode, types.ErrorCodeVersionUnsupported)
+	}
+	if resp.Headers[types.APIVersionHeader] != types.APIVersion {
+		t.Errorf("error response %s header = %q", types.APIVersionHeader, resp.Headers[types.APIVersionHeader])
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// container counts what this Lambda container has handled, for the health
+// check's cold/warm stats. Lambda sends a container one invocation at a time,
+// but the counters are atomic anyway.
+var container = struct {
+	started      time.Time
+	invocations  atomic.Int64
+	warmPings    atomic.Int64
+	lastWarmPing atomic.Int64 // Unix seconds
+}{started: time.Now()}
+
+// countInvocation records an invocation, reporting whether it's the container's first
+func countInvocation() (cold bool) {
+	return container.invocations.Add(1) == 1
+}
+
+// isWarmPing reports whether payload is the warm-keeper schedule's ping
+func isWarmPing(payload json.RawMessage) bool {
+	var ping types.WarmPing
+	if err := json.Unmarshal(payload, &ping); err != nil {
+		return false
+	}
+	return ping.Warm
+}
+
+// handleWarmPing answers the warm-keeper schedule. The container is warm by now;
+// all that's left is to count it.
+func handleWarmPing(cold bool) {
+	container.warmPings.Add(1)
+	container.lastWarmPing.Store(time.Now().Unix())
+	if cold {
+		log.Printf("Warm ping started a new container")
+	}
+}
+
+// containerStats reports this container's stats for the health check
+func containerStats() *types.ContainerStats {
+	invocations := container.invocations.Load()
+	stats := &types.ContainerStats{
+		ColdStart:   invocations <= 1,
+		Started:     container.started.UTC().Format(time.RFC3339),
+		Invocations: invocations,
+		WarmPings:   container.warmPings.Load(),
+	}
+	if last := container.lastWarmPing.Load(); last > 0 {
+		stats.LastWarmPing = time.Unix(last, 0).UTC().Format(time.RFC3339)
+	}
+	return stats
+}
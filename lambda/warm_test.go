@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestIsWarmPing(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    bool
+	}{
+		{name: "warm ping", payload: `{"tse_warm":true}`, want: true},
+		{name: "eventbridge schedule", payload: `{"detail-type":"Scheduled Event","source":"aws.events","detail":{}}`, want: false},
+		{name: "function url request", payload: `{"rawPath":"/health","requestContext":{"http":{"method":"GET"}}}`, want: false},
+		{name: "not json", payload: `"hello"`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isWarmPing(json.RawMessage(tt.payload)); got != tt.want {
+				t.Errorf("isWarmPing() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerStats(t *testing.T) {
+	container.invocations.Store(0)
+	container.warmPings.Store(0)
+	container.lastWarmPing.Store(0)
+
+	if cold := countInvocation(); !cold {
+		t.Error("first invocation wasn't cold")
+	}
+	if stats := containerStats(); !stats.ColdStart || stats.Invocations != 1 || stats.LastWarmPing != "" {
+		t.Errorf("containerStats() after a cold start = %+v", stats)
+	}
+
+	handleWarmPing(countInvocation())
+	if cold := countInvocation(); cold {
+		t.Error("third invocation was cold")
+	}
+	stats := containerStats()
+	if stats.ColdStart || stats.Invocations != 3 || stats.WarmPings != 1 || stats.LastWarmPing == "" {
+		t.Errorf("containerStats() when warm = %+v", stats)
+	}
+}
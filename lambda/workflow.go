@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+
+	"github.com/anoldguy/tse/lambda/aws"
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// envOrchestration chooses how async jobs run: "stepfunctions" hands them to
+// the state machine 'tse deploy --orchestration stepfunctions' creates, anything
+// else to a new invocation of the Lambda
+const envOrchestration = "TSE_ORCHESTRATION"
+
+// stepFunctionsOrchestration reports whether async jobs run as Step Functions workflows
+func stepFunctionsOrchestration() bool {
+	return os.Getenv(envOrchestration) == "stepfunctions"
+}
+
+// Workflow steps, each one invocation of the Lambda by the state machine (or
+// one call in runJob). A step takes the jobRun so far and returns it updated.
+const (
+	stepCleanup   = "cleanup"    // Clean up the region
+	stepLaunch    = "launch"     // Launch the node
+	stepCheck     = "check"      // See whether the node has reported ready
+	stepTerminate = "terminate"  // Terminate the region's nodes
+	stepRemoveVPC = "remove_vpc" // Remove the VPC they left behind
+	stepFinish    = "finish"     // Record the job as succeeded
+	stepFail      = "fail"       // Record the job as failed, with the error the Catch passed on
+)
+
+// Readiness of a started node, for the workflow's Choice state
+const (
+	phaseWaiting = "waiting"
+	phaseReady   = "ready"
+)
+
+// How often a start checks whether its node is ready, and how long a stop
+// leaves its instances to terminate before removing their VPC (as long as
+// StopInstances waits). Variables so tests don't wait.
+var (
+	readyCheckInterval = 15 * time.Second
+	vpcRemovalDelay    = 30 * time.Second
+)
+
+// vpcRemovalAttempts is how often a stop tries to remove the VPC, each after
+// vpcRemovalDelay. The workflow's RemoveVPC state retries as often.
+const vpcRemovalAttempts = 4
+
+// maxReadyChecks gives a node as long to report ready as notifyStalledNodes does
+var maxReadyChecks = int(registrationTimeout / readyCheckInterval)
+
+// workflowStep is the payload the state machine invokes the Lambda with
+type workflowStep struct {
+	Step string `json:"tse_step"`
+	Run  jobRun `json:"run"`
+}
+
+// workflowError is what a state machine Catch puts in the state: the error's
+// name and, for a failed Lambda step, its errorMessage wrapped in JSON
+type workflowError struct {
+	Error string `json:"Error"`
+	Cause string `json:"Cause"`
+}
+
+// message extracts the failed step's error message
+func (e *workflowError) message() string {
+	var cause struct {
+		ErrorMessage string `json:"errorMessage"`
+	}
+	if err := json.Unmarshal([]byte(e.Cause), &cause); err == nil && cause.ErrorMessage != "" {
+		return cause.ErrorMessage
+	}
+	if e.Cause != "" {
+		return e.Cause
+	}
+	return e.Error
+}
+
+// parseWorkflowStep reports whether payload is a step of a workflow
+func parseWorkflowStep(payload json.RawMessage) (workflowStep, bool) {
+	var step workflowStep
+	if err := json.Unmarshal(payload, &step); err != nil || step.Step == "" || step.Run.Job == nil {
+		return workflowStep{}, false
+	}
+	return step, true
+}
+
+// startWorkflow starts the deployment's state machine on a job's payload,
+// naming the execution after the job
+func startWorkflow(ctx context.Context, id string, payload []byte) error {
+	lc, ok := lambdacontext.FromContext(ctx)
+	if !ok {
+		return errors.New("not running in Lambda (no invocation context)")
+	}
+	stateMachineARN, err := aws.WorkflowARN(lc.InvokedFunctionArn)
+	if err != nil {
+		return err
+	}
+	return aws.StartWorkflow(ctx, stateMachineARN, id, payload)
+}
+
+// handleWorkflowStep runs one step for the state machine. An error fails the
+// step, which the state machine retries or passes to its fail step.
+func handleWorkflowStep(ctx context.Context, step workflowStep) (jobRun, error) {
+	if jobs == nil {
+		return step.Run, errors.New("no state table to record the job in")
+	}
+
+	work, cancel := withHandlerDeadline(ctx)
+	defer cancel()
+
+	log.Printf("Running step %s of job %s", step.Step, step.Run.Job.ID)
+	switch step.Step {
+	case stepFinish:
+		finishJob(ctx, step.Run, nil)
+		return step.Run, nil
+	case stepFail:
+		message := "the workflow failed"
+		if step.Run.Error != nil {
+			message = step.Run.Error.message()
+		}
+		finishJob(ctx, step.Run, errors.New(message))
+		return step.Run, nil
+	}
+	return runStep(work, step.Step, step.Run)
+}
+
+// runStep carries out one step of a job
+func runStep(ctx context.Context, step string, run jobRun) (jobRun, error) {
+	switch {
+	case step == stepCleanup && run.Cleanup != nil:
+		response, err := runCleanup(ctx, run.Job.Region, *run.Cleanup)
+		run.Stopped = response
+		return run, err
+	case step == stepLaunch && run.Start != nil:
+		return launchNode(ctx, run)
+	case step == stepCheck && run.Started != nil && run.Started.Instance != nil:
+		return checkNode(ctx, run)
+	case step == stepTerminate && run.Stop != nil:
+		return terminateNodes(ctx, run)
+	case step == stepRemoveVPC && run.Stopped != nil:
+		return removeVPC(ctx, run)
+	}
+	return run, fmt.Errorf("step %q doesn't apply to a %s job", step, run.Job.Kind)
+}
+
+// runStartSteps runs a start's workflow in one invocation: launch, then check
+// until the node is ready
+func runStartSteps(ctx context.Context, run jobRun) (jobRun, error) {
+	run, err := runStep(ctx, stepLaunch, run)
+	for err == nil && run.Phase != phaseReady {
+		select {
+		case <-ctx.Done():
+			return run, ctx.Err()
+		case <-time.After(readyCheckInterval):
+		}
+		run, err = runStep(ctx, stepCheck, run)
+	}
+	return run, err
+}
+
+// runStopSteps runs a stop's workflow in one invocation: terminate, then
+// remove the VPC once the instances let go of it, trying vpcRemovalAttempts times
+func runStopSteps(ctx context.Context, run jobRun) (jobRun, error) {
+	run, err := runStep(ctx, stepTerminate, run)
+	if err != nil || run.Stopped.TerminatedCount == 0 {
+		return run, err
+	}
+	for attempt := 0; attempt < vpcRemovalAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return run, ctx.Err()
+		case <-time.After(vpcRemovalDelay):
+		}
+		if run, err = runStep(ctx, stepRemoveVPC, run); err == nil {
+			return run, nil
+		}
+	}
+	return run, err
+}
+
+// launchNode starts the job's node as a synchronous start would
+func launchNode(ctx context.Context, run jobRun) (jobRun, error) {
+	req := *run.Start
+	req.Async = false
+	body, err := json.Marshal(req)
+	if err != nil {
+		return run, fmt.Errorf("failed to encode start: %w", err)
+	}
+
+	resp, _ := handleStartInstance(ctx, run.Caller, run.Job.Region, string(body))
+	if resp.StatusCode != http.StatusCreated {
+		return run, responseError(resp)
+	}
+	var started types.StartResponse
+	if err := json.Unmarshal([]byte(resp.Body), &started); err != nil || started.Instance == nil {
+		return run, fmt.Errorf("start sent no instance: %s", resp.Body)
+	}
+
+	run.Started = &started
+	run.Phase = phaseWaiting
+	if started.Instance.Ready {
+		run.Phase = phaseReady
+	}
+	return run, nil
+}
+
+// checkNode looks up the started node, marking the run ready once Tailscale is
+// up on it. It fails once the node is gone or has had maxReadyChecks.
+func checkNode(ctx context.Context, run jobRun) (jobRun, error) {
+	service, err := regionService(ctx, run.Job.Region)
+	if err != nil {
+		return run, err
+	}
+	instances, err := service.ListInstances(ctx)
+	if err != nil {
+		return run, err
+	}
+
+	id := run.Started.Instance.InstanceID
+	var found *types.InstanceInfo
+	for _, instance := range instances {
+		if instance.InstanceID == id {
+			found = instance
+		}
+	}
+	// ListInstances leaves out instances that are shutting down or terminated
+	if found == nil {
+		return run, fmt.Errorf("instance %s went away before it reported ready", id)
+	}
+
+	run.Started.Instance = found
+	if found.Ready {
+		run.Phase = phaseReady
+		run.Started.Message = fmt.Sprintf("Exit node ready in %s region", run.Job.Region)
+		return run, nil
+	}
+
+	run.Checks++
+	if run.Checks >= maxReadyChecks {
+		return run, fmt.Errorf("instance %s has not reported ready after %s (check Tailscale and the instance console log)", id, registrationTimeout)
+	}
+	return run, nil
+}
+
+// terminateNodes terminates the region's nodes, leaving their VPC for removeVPC
+func terminateNodes(ctx context.Context, run jobRun) (jobRun, error) {
+	service, err := regionService(ctx, run.Job.Region)
+	if err != nil {
+		return run, err
+	}
+	terminatedIDs, err := service.TerminateInstances(ctx)
+	if err != nil {
+		return run, err
+	}
+	run.Stopped = &types.StopResponse{
+		Success:         true,
+		Message:         fmt.Sprintf("Terminated %d instances in %s region", len(terminatedIDs), run.Job.Region),
+		TerminatedCount: len(terminatedIDs),
+		TerminatedIDs:   terminatedIDs,
+	}
+	if len(terminatedIDs) > 0 {
+		unregisterNodes(ctx, terminatedIDs)
+		notifyStopped(ctx, run.Job.Region, terminatedIDs)
+	}
+	return run, nil
+}
+
+// removeVPC removes the VPC the terminated nodes left behind. It fails while
+// any of them is still shutting down, so the state machine retries it.
+func removeVPC(ctx context.Context, run jobRun) (jobRun, error) {
+	service, err := regionService(ctx, run.Job.Region)
+	if err != nil {
+		return run, err
+	}
+	instances, err := service.ListInstances(ctx)
+	if err != nil {
+		return run, err
+	}
+	if len(instances) > 0 {
+		return run, fmt.Errorf("%d instances still in %s", len(instances), run.Job.Region)
+	}
+	deleted, err := service.RemoveVPCInfrastructure(ctx)
+	if err != nil {
+		return run, err
+	}
+	for _, vpcID := range deleted {
+		run.Stopped.TerminatedIDs = append(run.Stopped.TerminatedIDs, "VPC:"+vpcID)
+	}
+	return run, nil
+}
+
+// regionService creates the AWS service for a job's region
+func regionService(ctx context.Context, friendlyRegion string) (*aws.Service, error) {
+	awsRegion, err := regions.GetAWSRegion(friendlyRegion)
+	if err != nil {
+		return nil, err
+	}
+	return aws.New(ctx, awsRegion)
+}
+
+// responseError turns a handler's error response into an error with its message
+func responseError(resp events.LambdaFunctionURLResponse) error {
+	var decoded types.ErrorResponse
+	if err := json.Unmarshal([]byte(resp.Body), &decoded); err != nil || decoded.Error == "" {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Body)
+	}
+	return fmt.Errorf("%s (HTTP %d)", decoded.Error, resp.StatusCode)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func TestParseWorkflowStep(t *testing.T) {
+	if _, ok := parseWorkflowStep(json.RawMessage(`{"tse_job":{"id":"job-1","kind":"cleanup"}}`)); ok {
+		t.Error("parseWorkflowStep() took a job's invocation for a step")
+	}
+	if _, ok := parseWorkflowStep(json.RawMessage(`{"rawPath":"/ohio/stop"}`)); ok {
+		t.Error("parseWorkflowStep() took a Function URL request for a step")
+	}
+	step, ok := parseWorkflowStep(json.RawMessage(`{"tse_step":"check","run":{"tse_job":{"id":"job-1","kind":"start","region":"ohio"},"phase":"waiting","checks":3}}`))
+	if !ok || step.Step != stepCheck || step.Run.Job.ID != "job-1" || step.Run.Checks != 3 {
+		t.Errorf("parseWorkflowStep() = %+v, %v", step, ok)
+	}
+}
+
+func TestWorkflowErrorMessage(t *testing.T) {
+	tests := []struct {
+		err  workflowError
+		want string
+	}{
+		// A failed Lambda step: the Catch wraps its error in JSON
+		{workflowError{Error: "errorString", Cause: `{"errorMessage":"instance i-1 went away before it reported ready","errorType":"errorString"}`}, "instance i-1 went away before it reported ready"},
+		{workflowError{Error: "States.Timeout", Cause: "Task timed out"}, "Task timed out"},
+		{workflowError{Error: "States.TaskFailed"}, "States.TaskFailed"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.message(); got != tt.want {
+			t.Errorf("message(%+v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestHandleWorkflowStepRecordsOutcome(t *testing.T) {
+	ctx := context.Background()
+	fake := fakeJobs{}
+	jobs = fake
+	defer func() { jobs = nil }()
+
+	stopped := &types.StopResponse{Success: true, TerminatedCount: 1, TerminatedIDs: []string{"i-1"}}
+	job, _ := fake.CreateJob(ctx, jobKindStop, "ohio")
+	if _, err := handleWorkflowStep(ctx, workflowStep{Step: stepFinish, Run: jobRun{Job: job, Stop: &types.StopRequest{}, Stopped: stopped}}); err != nil {
+		t.Fatalf("finish step: %v", err)
+	}
+	if got := fake[job.ID]; got.Status != types.JobSucceeded {
+		t.Errorf("finished job = %+v, want succeeded", got)
+	}
+
+	failed, _ := fake.CreateJob(ctx, jobKindStart, "tokyo")
+	caught := &workflowError{Error: "errorString", Cause: `{"errorMessage":"Exit node already running in tokyo region (HTTP 409)"}`}
+	if _, err := handleWorkflowStep(ctx, workflowStep{Step: stepFail, Run: jobRun{Job: failed, Start: &types.StartRequest{}, Error: caught}}); err != nil {
+		t.Fatalf("fail step: %v", err)
+	}
+	if got := fake[failed.ID]; got.Status != types.JobFailed || !strings.Contains(got.Error, "already running") {
+		t.Errorf("failed job = %+v, want the step's error", got)
+	}
+}
+
+func TestRunStepRejectsMismatchedStep(t *testing.T) {
+	run := jobRun{Job: &types.JobInfo{ID: "job-1", Kind: jobKindCleanup, Region: "ohio"}, Cleanup: &types.CleanupRequest{}}
+	for _, step := range []string{stepLaunch, stepCheck, stepTerminate, stepRemoveVPC, "bake"} {
+		if _, err := runStep(context.Background(), step, run); err == nil {
+			t.Errorf("runStep(%s) on a cleanup job succeeded, want an error", step)
+		}
+	}
+}
+
+func TestAsyncStop(t *testing.T) {
+	fake := fakeJobs{}
+	jobs = fake
+	defer func() { jobs = nil }()
+
+	var dispatched []byte
+	defer func(saved func(context.Context, string, []byte) error) { dispatchJob = saved }(dispatchJob)
+	dispatchJob = func(ctx context.Context, id string, payload []byte) error {
+		dispatched = payload
+		return nil
+	}
+
+	resp, _ := handleStopInstances(context.Background(), "ohio", `{"async":true}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("async stop status = %d, want 202: %s", resp.StatusCode, resp.Body)
+	}
+	run, ok := parseJobRun(dispatched)
+	if !ok || run.Job.Kind != jobKindStop || run.Stop == nil || run.Job.Region != "ohio" {
+		t.Errorf("dispatched %s, want a stop job in ohio", dispatched)
+	}
+
+	if resp, _ := handleStopInstances(context.Background(), "ohio", `{"async":`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("stop with a bad body: status = %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,333 @@
+// Package client is a Go client for a deployed tse Lambda, for programs that
+// want to start and stop exit nodes without shelling out to the CLI:
+//
+//	c, err := client.New(os.Getenv("TSE_LAMBDA_URL"), os.Getenv("TSE_AUTH_TOKEN"))
+//	if err != nil {
+//		return err
+//	}
+//	resp, err := c.Start(ctx, types.StartRequest{Region: "frankfurt"})
+//	if errors.Is(err, client.ErrAlreadyRunning) {
+//		// Nothing to do
+//	}
+//
+// Requests are retried with jittered backoff the way the CLI retries them.
+// Failed responses come back as *StatusError.
+package client
+
+import (
+	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+const (
+	// ReadTimeout bounds a read (GET) against the Lambda, including the body
+	ReadTimeout = 30 * time.Second
+
+	// ActionTimeout bounds calls that change things (start, stop, cleanup), which
+	// can take as long as the Lambda's own timeout: 2 minutes unless deployed
+	// with --lambda-timeout, which allows up to 5
+	ActionTimeout = 5*time.Minute + 10*time.Second
+
+	// DefaultMaxAttempts is how often a failing request is tried in total
+	DefaultMaxAttempts = 3
+
+	// retryBaseDelay doubles after each attempt, up to retryMaxDelay; each wait is
+	// randomized between half and all of that so parallel region requests don't
+	// retry in step
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 5 * time.Second
+
+	// maxRetryAfter is the longest Retry-After worth waiting for; a lockout
+	// longer than this is reported instead
+	maxRetryAfter = 10 * time.Second
+)
+
+// lambdaTransport is shared by every client so connections and TLS sessions
+// are reused across a multi-region fan-out
+var lambdaTransport = &http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	MaxIdleConnsPerHost: 32,
+	IdleConnTimeout:     90 * time.Second,
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
+var (
+	readClient   = &http.Client{Transport: lambdaTransport, Timeout: ReadTimeout}
+	actionClient = &http.Client{Transport: lambdaTransport, Timeout: ActionTimeout}
+)
+
+// legacyLambdas holds the base URLs of Lambdas that predate API versions, so
+// later requests to them skip the versioned attempt
+var legacyLambdas sync.Map
+
+// ErrAlreadyRunning matches the *StatusError for a start in a region that
+// already has a running exit node
+var ErrAlreadyRunning = errors.New("exit node already running")
+
+// Client provides methods to interact with a tse Lambda
+type Client struct {
+	baseURL     string
+	authToken   string
+	maxAttempts int
+	onRetry     func(Retry)
+}
+
+// Retry describes a failed attempt that's about to be repeated
+type Retry struct {
+	Method  string
+	Path    string
+	Reason  string // The error, or the response status
+	Attempt int    // The attempt that failed, from 1
+	Delay   time.Duration
+}
+
+// New creates a client for the Lambda function URL printed by 'tse deploy'.
+// authToken may be empty for a Lambda deployed without one.
+func New(lambdaURL, authToken string) (*Client, error) {
+	u, err := url.Parse(lambdaURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Lambda URL %q", lambdaURL)
+	}
+
+	return &Client{
+		baseURL:     strings.TrimSuffix(lambdaURL, "/"),
+		authToken:   authToken,
+		maxAttempts: DefaultMaxAttempts,
+	}, nil
+}
+
+// SetMaxAttempts sets how often a failing request is tried in total; 1
+// disables retries
+func (c *Client) SetMaxAttempts(n int) {
+	c.maxAttempts = max(n, 1)
+}
+
+// SetRetryHook sets a function called before each retry, e.g. to log it
+func (c *Client) SetRetryHook(hook func(Retry)) {
+	c.onRetry = hook
+}
+
+// Do sends a request to path (e.g. "/ohio/start") under the Lambda URL's
+// current API version, falling back to the unversioned path for Lambdas that
+// predate API versions. It retries with jittered backoff on connection errors
+// and server errors (see shouldRetry). idempotent marks a request that's safe
+// to repeat after it reached the Lambda, such as a start carrying a client
+// token; GETs always are. It gives up at once when ctx is cancelled, returning
+// ctx.Err().
+//
+// The typed methods (Start, Stop, ...) are built on Do; use it for the
+// endpoints they don't cover.
+func (c *Client) Do(ctx context.Context, method, path string, payload []byte, idempotent bool) (*http.Response, error) {
+	idempotent = idempotent || method == http.MethodGet || method == http.MethodDelete
+
+	if _, legacy := legacyLambdas.Load(c.baseURL); legacy {
+		return c.do(ctx, method, path, payload, idempotent)
+	}
+	resp, err := c.do(ctx, method, "/"+types.APIVersion+path, payload, idempotent)
+	if err == nil && resp.StatusCode == http.StatusNotFound && resp.Header.Get(types.APIVersionHeader) == "" {
+		// A Lambda from before API versions, which only knows unversioned
+		// paths. It acted on nothing, so the request is safe to send again.
+		resp.Body.Close()
+		legacyLambdas.Store(c.baseURL, true)
+		return c.do(ctx, method, path, payload, idempotent)
+	}
+	return resp, err
+}
+
+// do sends a request to an exact path, retrying as described on Do
+func (c *Client) do(ctx context.Context, method, path string, payload []byte, idempotent bool) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, method, path, payload)
+		if ctx.Err() != nil {
+			// Cancellation isn't a network problem; don't bury it in the URL error
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+		if attempt >= c.maxAttempts || !shouldRetry(idempotent, resp, err) {
+			return resp, err
+		}
+
+		delay, ok := retryDelay(attempt, resp)
+		if !ok {
+			return resp, nil
+		}
+
+		reason := ""
+		if err != nil {
+			reason, _, _ = strings.Cut(err.Error(), "\n")
+		} else {
+			reason = resp.Status
+			resp.Body.Close()
+		}
+		if c.onRetry != nil {
+			c.onRetry(Retry{Method: method, Path: path, Reason: reason, Attempt: attempt, Delay: delay})
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// send makes a single attempt, with the token if one is set
+func (c *Client) send(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	if c.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+	}
+
+	client := actionClient
+	if method == http.MethodGet {
+		client = readClient
+	}
+	return client.Do(req)
+}
+
+// call sends a JSON request and decodes the response into out, returning a
+// *StatusError unless the Lambda answers with want. operation names the call in
+// errors, e.g. "stop exit node in ohio".
+func (c *Client) call(ctx context.Context, method, path string, in any, idempotent bool, want int, operation string, out any) error {
+	var payload []byte
+	if in != nil {
+		var err error
+		if payload, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	resp, err := c.Do(ctx, method, path, payload, idempotent)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := types.ReadPayload(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != want {
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(body), Operation: operation}
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// StatusError is a response from the Lambda with an unexpected status code
+type StatusError struct {
+	StatusCode int
+	Body       string
+	Operation  string // What was being done, e.g. "start exit node in ohio"
+}
+
+// Message returns the Lambda's explanation, or the raw body when it sent none
+func (e *StatusError) Message() string {
+	var errorResp types.ErrorResponse
+	if json.Unmarshal([]byte(e.Body), &errorResp) == nil && errorResp.Error != "" {
+		return errorResp.Error
+	}
+	return e.Body
+}
+
+// ErrorCode returns the Lambda's machine-readable reason for the failure. A
+// Lambda from before error codes sends none, so the status stands in for it.
+func (e *StatusError) ErrorCode() types.ErrorCode {
+	var errorResp types.ErrorResponse
+	if json.Unmarshal([]byte(e.Body), &errorResp) == nil && errorResp.ErrorCode != "" {
+		return errorResp.ErrorCode
+	}
+	return types.DefaultErrorCode(e.StatusCode)
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s failed (HTTP %d): %s", e.Operation, e.StatusCode, e.Message())
+}
+
+// Is lets errors.Is(err, ErrAlreadyRunning) match a start refused because the
+// region has a running exit node. Not a start that's still in progress, or a
+// paused node: those are 409s too, with their own error codes.
+func (e *StatusError) Is(target error) bool {
+	return target == ErrAlreadyRunning && e.ErrorCode() == types.ErrorCodeAlreadyRunning
+}
+
+// shouldRetry reports whether a failed attempt is worth repeating. Idempotent
+// requests are retried on any connection error, 429 or 5xx. Anything else (a
+// token creation, a stop) might already have taken effect, so it's only retried
+// when the request never reached the Lambda: the connection failed, or the
+// function URL throttled it (429, 503). The Lambda also answers 429 when AWS
+// throttled its calls; that's safe to repeat too, since starts carry a client
+// token and the rest converge on the same end state.
+func shouldRetry(idempotent bool, resp *http.Response, err error) bool {
+	if err != nil {
+		return idempotent || isDialError(err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		return true
+	case resp.StatusCode >= 500:
+		return idempotent
+	}
+	return false
+}
+
+// isDialError reports whether err happened before the request was sent:
+// DNS lookup or connection setup
+func isDialError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryDelay returns how long to wait before the next attempt: the server's
+// Retry-After when it sent one, otherwise jittered exponential backoff. It
+// reports false when Retry-After asks for longer than maxRetryAfter.
+func retryDelay(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			wait := time.Duration(seconds) * time.Second
+			return wait, wait <= maxRetryAfter
+		}
+	}
+
+	backoff := min(retryBaseDelay<<(attempt-1), retryMaxDelay)
+	return backoff/2 + rand.N(backoff/2+1), true
+}
+
+// newClientToken returns a random idempotency token for a start request
+func newClientToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := cryptorand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate client token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,361 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c, err := New(server.URL+"/", "secret")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return c
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestNew(t *testing.T) {
+	for _, bad := range []string{"", "lambda.example.com", "ftp://example.com", "https://"} {
+		if _, err := New(bad, ""); err == nil {
+			t.Errorf("New(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	var token string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/ohio/start" {
+			t.Errorf("request = %s %s, want POST /v1/ohio/start", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q", got)
+		}
+		var req types.StartRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		token = req.ClientToken
+		writeJSON(w, http.StatusCreated, types.StartResponse{Message: "started", Instance: &types.InstanceInfo{InstanceID: "i-1"}})
+	})
+
+	resp, err := c.Start(context.Background(), types.StartRequest{Region: "ohio"})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if resp.Instance == nil || resp.Instance.InstanceID != "i-1" {
+		t.Errorf("Start() = %+v", resp)
+	}
+	if len(token) != 32 {
+		t.Errorf("client token = %q, want 32 hex digits", token)
+	}
+}
+
+func TestStartAlreadyRunning(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusConflict, types.ErrorResponse{Error: "Exit node already running in ohio region"})
+	})
+
+	_, err := c.Start(context.Background(), types.StartRequest{Region: "ohio"})
+	if !errors.Is(err, ErrAlreadyRunning) {
+		t.Fatalf("Start() error = %v, want ErrAlreadyRunning", err)
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Message() != "Exit node already running in ohio region" {
+		t.Errorf("Start() error = %#v, want the Lambda's message", err)
+	}
+}
+
+func TestStatusErrorCode(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		body           types.ErrorResponse
+		want           types.ErrorCode
+		alreadyRunning bool
+	}{
+		{"coded already running", http.StatusConflict, types.ErrorResponse{Error: "running", ErrorCode: types.ErrorCodeAlreadyRunning}, types.ErrorCodeAlreadyRunning, true},
+		{"start in progress", http.StatusConflict, types.ErrorResponse{Error: "in progress", ErrorCode: types.ErrorCodeStartInProgress}, types.ErrorCodeStartInProgress, false},
+		{"paused", http.StatusConflict, types.ErrorResponse{Error: "paused", ErrorCode: types.ErrorCodeNodePaused}, types.ErrorCodeNodePaused, false},
+		{"no capacity", http.StatusInternalServerError, types.ErrorResponse{Error: "no capacity", ErrorCode: types.ErrorCodeNoCapacity}, types.ErrorCodeNoCapacity, false},
+		{"older Lambda without a code", http.StatusUnauthorized, types.ErrorResponse{Error: "Unauthorized"}, types.ErrorCodeAuthFailed, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, tt.status, tt.body)
+			})
+
+			_, err := c.Start(context.Background(), types.StartRequest{Region: "ohio"})
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) {
+				t.Fatalf("Start() error = %v, want a StatusError", err)
+			}
+			if got := statusErr.ErrorCode(); got != tt.want {
+				t.Errorf("ErrorCode() = %q, want %q", got, tt.want)
+			}
+			if errors.Is(err, ErrAlreadyRunning) != tt.alreadyRunning {
+				t.Errorf("errors.Is(err, ErrAlreadyRunning) = %v, want %v", !tt.alreadyRunning, tt.alreadyRunning)
+			}
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var instanceCalls, stopCalls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/instances"):
+			if instanceCalls.Add(1) < DefaultMaxAttempts {
+				writeJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "boom"})
+				return
+			}
+			writeJSON(w, http.StatusOK, types.InstancesResponse{Count: 0})
+		default:
+			stopCalls.Add(1)
+			writeJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "boom"})
+		}
+	})
+	var retries int
+	c.SetRetryHook(func(Retry) { retries++ })
+
+	// Reads are retried through server errors
+	if _, err := c.Instances(context.Background(), "ohio"); err != nil {
+		t.Errorf("Instances() error = %v, want success on the last attempt", err)
+	}
+	if retries != DefaultMaxAttempts-1 {
+		t.Errorf("retry hook called %d times, want %d", retries, DefaultMaxAttempts-1)
+	}
+
+	// A stop might have taken effect, so a 500 isn't retried
+	_, err := c.Stop(context.Background(), "ohio")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Stop() error = %v, want a 500 StatusError", err)
+	}
+	if stopCalls.Load() != 1 {
+		t.Errorf("stop sent %d times, want 1", stopCalls.Load())
+	}
+}
+
+func TestLegacyLambdaFallback(t *testing.T) {
+	var versioned, legacy atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// A Lambda from before API versions: no header, and /v1 is an unknown route
+		if strings.HasPrefix(r.URL.Path, "/v1/") {
+			versioned.Add(1)
+			writeJSON(w, http.StatusNotFound, types.ErrorResponse{Error: "Not found"})
+			return
+		}
+		legacy.Add(1)
+		writeJSON(w, http.StatusOK, types.InstancesResponse{Success: true})
+	})
+
+	for range 2 {
+		if _, err := c.Instances(context.Background(), "ohio"); err != nil {
+			t.Fatalf("Instances() error = %v", err)
+		}
+	}
+	if versioned.Load() != 1 || legacy.Load() != 2 {
+		t.Errorf("versioned requests = %d, legacy = %d; want 1 and 2", versioned.Load(), legacy.Load())
+	}
+}
+
+func TestVersionedNotFoundIsFinal(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set(types.APIVersionHeader, types.APIVersion)
+		writeJSON(w, http.StatusNotFound, types.ErrorResponse{Error: "No paused exit node in ohio region", ErrorCode: types.ErrorCodeNothingPaused})
+	})
+
+	_, err := c.Resume(context.Background(), "ohio")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.ErrorCode() != types.ErrorCodeNothingPaused {
+		t.Errorf("Resume() error = %v, want NOTHING_PAUSED", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("sent %d requests, want 1", calls.Load())
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/instances" {
+			// A Lambda from before GET /instances: every region is stopped
+			w.Header().Set(types.APIVersionHeader, types.APIVersion)
+			writeJSON(w, http.StatusNotFound, types.ErrorResponse{Error: "Not found", ErrorCode: types.ErrorCodeNotFound})
+			return
+		}
+		region := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), "/stop")
+		if region == "ohio" {
+			writeJSON(w, http.StatusBadRequest, types.ErrorResponse{Error: "region not enabled"})
+			return
+		}
+		writeJSON(w, http.StatusOK, types.StopResponse{Message: "stopped in " + region})
+	})
+
+	stopped, err := c.Shutdown(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "ohio: stop exit node in ohio failed (HTTP 400): region not enabled") {
+		t.Errorf("Shutdown() error = %v, want ohio's failure", err)
+	}
+	if want := len(regions.GetAllFriendlyNames()) - 1; len(stopped) != want {
+		t.Errorf("Shutdown() stopped %d regions, want %d", len(stopped), want)
+	}
+	if _, ok := stopped["ohio"]; ok {
+		t.Error("Shutdown() reported the failed region as stopped")
+	}
+}
+
+func TestShutdownStopsOccupiedRegions(t *testing.T) {
+	var stops atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/instances" {
+			writeJSON(w, http.StatusOK, types.InstancesResponse{
+				Instances:     []*types.InstanceInfo{{InstanceID: "i-1", FriendlyRegion: "tokyo"}},
+				Regions:       []string{"ohio", "tokyo"},
+				FailedRegions: []string{"ohio"},
+			})
+			return
+		}
+		stops.Add(1)
+		writeJSON(w, http.StatusOK, types.StopResponse{Success: true})
+	})
+
+	// Regions with nodes, and those that couldn't be listed
+	stopped, err := c.Shutdown(context.Background())
+	if err != nil || len(stopped) != 2 || stopped["ohio"] == nil || stopped["tokyo"] == nil || stops.Load() != 2 {
+		t.Errorf("Shutdown() = %v, %v after %d stops; want ohio and tokyo only", stopped, err, stops.Load())
+	}
+}
+
+func TestAllDeploymentInstances(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		count := 1
+		if r.URL.Path == "/v1/ohio/instances" && r.URL.Query().Get(types.AllDeploymentsParam) == "true" {
+			count = 3
+		}
+		writeJSON(w, http.StatusOK, types.InstancesResponse{Count: count})
+	})
+
+	own, err := c.Instances(context.Background(), "ohio")
+	if err != nil || own.Count != 1 {
+		t.Errorf("Instances() = %+v, %v, want this deployment's node", own, err)
+	}
+	all, err := c.AllDeploymentInstances(context.Background(), "ohio")
+	if err != nil || all.Count != 3 {
+		t.Errorf("AllDeploymentInstances() = %+v, %v, want every deployment's nodes", all, err)
+	}
+}
+
+func TestStartDryRun(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req types.StartRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.DryRun || !req.Plan {
+			t.Errorf("request = %+v, want a dry run with a plan", req)
+		}
+		writeJSON(w, http.StatusOK, types.StartResponse{Success: true, Message: "Dry run: would start", Plan: []string{"ec2:RunInstances"}})
+	})
+
+	resp, err := c.Start(context.Background(), types.StartRequest{Region: "ohio", DryRun: true, Plan: true})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if len(resp.Plan) != 1 {
+		t.Errorf("Start() = %+v, want the plan", resp)
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ohio/pause":
+			writeJSON(w, http.StatusOK, types.PauseResponse{Success: true, InstanceIDs: []string{"i-1"}})
+		default:
+			writeJSON(w, http.StatusNotFound, types.ErrorResponse{Error: "No paused exit node in ohio region"})
+		}
+	})
+
+	paused, err := c.Pause(context.Background(), "ohio")
+	if err != nil || len(paused.InstanceIDs) != 1 {
+		t.Fatalf("Pause() = %+v, %v", paused, err)
+	}
+
+	var statusErr *StatusError
+	_, err = c.Resume(context.Background(), "ohio")
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Resume() with nothing paused error = %v, want a 404", err)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	var calls atomic.Int32
+	var got types.StartRequest
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		json.NewDecoder(r.Body).Decode(&got)
+		if got.DNS == "mullvad" {
+			writeJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Terminated [i-old] but failed to start a replacement: boom"})
+			return
+		}
+		writeJSON(w, http.StatusCreated, types.RestartResponse{Success: true, TerminatedIDs: []string{"i-old"}, Instance: &types.InstanceInfo{InstanceID: "i-new"}})
+	})
+
+	restarted, err := c.Restart(context.Background(), types.StartRequest{Region: "ohio"})
+	if err != nil || restarted.Instance.InstanceID != "i-new" || len(restarted.TerminatedIDs) != 1 {
+		t.Fatalf("Restart() = %+v, %v", restarted, err)
+	}
+
+	// The old node is gone after a failed restart, so it isn't retried
+	calls.Store(0)
+	if _, err := c.Restart(context.Background(), types.StartRequest{Region: "ohio", DNS: "mullvad"}); err == nil || calls.Load() != 1 {
+		t.Errorf("Restart() error = %v after %d requests, want one failed request", err, calls.Load())
+	}
+}
+
+func TestWaitForJob(t *testing.T) {
+	var polls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/jobs/job-1" {
+			t.Errorf("request = %s %s, want GET /v1/jobs/job-1", r.Method, r.URL.Path)
+		}
+		job := &types.JobInfo{ID: "job-1", Status: types.JobRunning}
+		if polls.Add(1) > 1 {
+			job.Status, job.Result = types.JobSucceeded, json.RawMessage(`{"terminated_count":2}`)
+		}
+		writeJSON(w, http.StatusOK, types.JobResponse{Success: true, Job: job})
+	})
+
+	job, err := c.WaitForJob(context.Background(), "job-1")
+	if err != nil {
+		t.Fatalf("WaitForJob() error = %v", err)
+	}
+	if job.Status != types.JobSucceeded || string(job.Result) != `{"terminated_count":2}` || polls.Load() != 2 {
+		t.Errorf("WaitForJob() = %+v after %d polls, want the finished job after 2", job, polls.Load())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.WaitForJob(ctx, "job-1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("WaitForJob(cancelled) error = %v, want context.Canceled", err)
+	}
+}
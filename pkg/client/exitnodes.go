@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/anoldguy/tse/shared/regions"
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// Health checks the Lambda is up, and which AWS account and region it runs in
+func (c *Client) Health(ctx context.Context) (*types.HealthResponse, error) {
+	var health types.HealthResponse
+	if err := c.call(ctx, http.MethodGet, "/", nil, false, http.StatusOK, "health check", &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// Instances lists the deployment's exit node instances in a region, e.g. "ohio"
+func (c *Client) Instances(ctx context.Context, region string) (*types.InstancesResponse, error) {
+	return c.instances(ctx, region, "/"+region+"/instances")
+}
+
+// AllDeploymentInstances lists the exit node instances every deployment in the
+// Lambda's AWS account runs in a region
+func (c *Client) AllDeploymentInstances(ctx context.Context, region string) (*types.InstancesResponse, error) {
+	return c.instances(ctx, region, "/"+region+"/instances?"+types.AllDeploymentsParam+"=true")
+}
+
+// AllInstances lists the exit nodes the deployment runs in every region, in
+// one call. The Lambda asks EC2 only in the regions its node registry has
+// nodes in; the response's Regions and FailedRegions say which it asked and
+// which of those failed.
+func (c *Client) AllInstances(ctx context.Context) (*types.InstancesResponse, error) {
+	return c.instances(ctx, "all regions", "/instances")
+}
+
+// OccupiedRegions returns the regions that may have exit nodes: those with
+// nodes, and any the Lambda couldn't list. When it can't tell (a Lambda from
+// before GET /instances, or any other failure) that's every region, so a stop
+// never misses one.
+func (c *Client) OccupiedRegions(ctx context.Context) []string {
+	all, err := c.AllInstances(ctx)
+	if err != nil {
+		return regions.GetAllFriendlyNames()
+	}
+	occupied := slices.Clone(all.FailedRegions)
+	for _, instance := range all.Instances {
+		if !slices.Contains(occupied, instance.FriendlyRegion) {
+			occupied = append(occupied, instance.FriendlyRegion)
+		}
+	}
+	slices.Sort(occupied)
+	return occupied
+}
+
+func (c *Client) instances(ctx context.Context, region, path string) (*types.InstancesResponse, error) {
+	var instancesResp types.InstancesResponse
+	if err := c.call(ctx, http.MethodGet, path, nil, false, http.StatusOK, fmt.Sprintf("list instances in %s", region), &instancesResp); err != nil {
+		return nil, err
+	}
+	return &instancesResp, nil
+}
+
+// Start starts an exit node in req.Region. When req has no ClientToken one is
+// generated, so every retry of this call returns the node the first attempt
+// launched instead of a conflict or a second node. A region that already has a
+// running node returns an error matching ErrAlreadyRunning.
+func (c *Client) Start(ctx context.Context, req types.StartRequest) (*types.StartResponse, error) {
+	if req.ClientToken == "" {
+		token, err := newClientToken()
+		if err != nil {
+			return nil, err
+		}
+		req.ClientToken = token
+	}
+
+	// A dry run launches nothing, so the Lambda answers 200 rather than 201
+	want := http.StatusCreated
+	if req.DryRun {
+		want = http.StatusOK
+	}
+
+	var startResp types.StartResponse
+	if err := c.call(ctx, http.MethodPost, "/"+req.Region+"/start", req, true, want, fmt.Sprintf("start exit node in %s", req.Region), &startResp); err != nil {
+		return nil, err
+	}
+	return &startResp, nil
+}
+
+// Stop terminates the exit nodes in a region. A region without any isn't an
+// error; the response's TerminatedCount is 0.
+func (c *Client) Stop(ctx context.Context, region string) (*types.StopResponse, error) {
+	var stopResp types.StopResponse
+	if err := c.call(ctx, http.MethodPost, "/"+region+"/stop", struct{}{}, false, http.StatusOK, fmt.Sprintf("stop exit node in %s", region), &stopResp); err != nil {
+		return nil, err
+	}
+	return &stopResp, nil
+}
+
+// Restart replaces the exit node in req.Region: the Lambda terminates it and
+// launches another into the same VPC, with req's options. It isn't retried once
+// it reaches the Lambda, since a retry would find the old node gone. A region
+// without a node returns a 404 *StatusError.
+func (c *Client) Restart(ctx context.Context, req types.StartRequest) (*types.RestartResponse, error) {
+	var restartResp types.RestartResponse
+	if err := c.call(ctx, http.MethodPost, "/"+req.Region+"/restart", req, false, http.StatusCreated, fmt.Sprintf("restart exit node in %s", req.Region), &restartResp); err != nil {
+		return nil, err
+	}
+	return &restartResp, nil
+}
+
+// Pause stops a region's running exit node without terminating it, so Resume
+// can bring it back without a fresh install. Multihop nodes can't be paused.
+func (c *Client) Pause(ctx context.Context, region string) (*types.PauseResponse, error) {
+	var pauseResp types.PauseResponse
+	if err := c.call(ctx, http.MethodPost, "/"+region+"/pause", struct{}{}, false, http.StatusOK, fmt.Sprintf("pause exit node in %s", region), &pauseResp); err != nil {
+		return nil, err
+	}
+	return &pauseResp, nil
+}
+
+// Resume starts a region's paused exit node again. A region with nothing
+// paused returns a 404 *StatusError.
+func (c *Client) Resume(ctx context.Context, region string) (*types.PauseResponse, error) {
+	var resumeResp types.PauseResponse
+	if err := c.call(ctx, http.MethodPost, "/"+region+"/resume", struct{}{}, false, http.StatusOK, fmt.Sprintf("resume exit node in %s", region), &resumeResp); err != nil {
+		return nil, err
+	}
+	return &resumeResp, nil
+}
+
+// Shutdown stops the exit nodes in every region at once: each region
+// OccupiedRegions names. It returns each region's response that arrived, keyed
+// by region, along with the failures joined into one error.
+func (c *Client) Shutdown(ctx context.Context) (map[string]*types.StopResponse, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	stopped := make(map[string]*types.StopResponse)
+	var errs []error
+
+	for _, region := range c.OccupiedRegions(ctx) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopResp, err := c.Stop(ctx, region)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", region, err))
+				return
+			}
+			stopped[region] = stopResp
+		}()
+	}
+	wg.Wait()
+
+	return stopped, errors.Join(errs...)
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/anoldguy/tse/shared/types"
+)
+
+// JobPollInterval is how often WaitForJob checks on a job
+const JobPollInterval = 2 * time.Second
+
+// Job returns an async job's progress, and its result once it succeeded. Jobs
+// are kept for a day after they start.
+func (c *Client) Job(ctx context.Context, id string) (*types.JobInfo, error) {
+	var jobResp types.JobResponse
+	if err := c.call(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil, false, http.StatusOK, "check on job "+id, &jobResp); err != nil {
+		return nil, err
+	}
+	if jobResp.Job == nil {
+		return nil, fmt.Errorf("check on job %s: the Lambda sent no job", id)
+	}
+	return jobResp.Job, nil
+}
+
+// WaitForJob polls an async job every JobPollInterval until it's done, and
+// returns it. A failed job isn't an error here; check its Status.
+func (c *Client) WaitForJob(ctx context.Context, id string) (*types.JobInfo, error) {
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Done() {
+			return job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(JobPollInterval):
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Package dns describes the DNS services an exit node can resolve through
+// instead of the VPC's resolver, so clients using the node get their filtering
+// (ad blocking, malware lists) too. The CLI validates a choice with Parse before
+// sending it; the Lambda parses it again to build the node's setup script.
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Resolver is a parsed DNS choice
+type Resolver struct {
+	Name string // A preset, or the addresses as given
+	// Servers in systemd-resolved form: "ip", or "ip#name" to check the TLS certificate
+	Servers []string
+	OverTLS bool // Only usable through systemd-resolved's DNS over TLS
+}
+
+// IsZero reports whether r is the zero Resolver: keep the VPC's resolver
+func (r Resolver) IsZero() bool {
+	return len(r.Servers) == 0
+}
+
+// Presets are the public filtering services known by name. Mullvad only serves
+// DNS over TLS or HTTPS, so the presets all use TLS.
+var Presets = map[string]Resolver{
+	"mullvad": {
+		Name:    "mullvad",
+		Servers: []string{"194.242.2.3#adblock.dns.mullvad.net"},
+		OverTLS: true,
+	},
+	"adguard": {
+		Name:    "adguard",
+		Servers: []string{"94.140.14.14#dns.adguard-dns.com", "94.140.15.15#dns.adguard-dns.com"},
+		OverTLS: true,
+	},
+	"quad9": {
+		Name:    "quad9",
+		Servers: []string{"9.9.9.9#dns.quad9.net", "149.112.112.112#dns.quad9.net"},
+		OverTLS: true,
+	},
+}
+
+// None keeps the VPC's resolver, overriding a configured default
+const None = "none"
+
+// nextDNSPrefix selects a NextDNS configuration: "nextdns:<id>"
+const nextDNSPrefix = "nextdns:"
+
+// nextDNSID matches a NextDNS configuration ID, as shown on its Setup page
+var nextDNSID = regexp.MustCompile(`^[0-9a-f]{6}$`)
+
+// Choices describes the accepted values, for usage and error messages
+const Choices = "mullvad, adguard, quad9, nextdns:<config-id>, or IP addresses such as a Pi-hole's tailnet IP"
+
+// Parse reads a DNS choice: a preset, "nextdns:<config-id>", or a
+// comma-separated list of IP addresses (plain DNS, port 53). "" and None are
+// the zero Resolver.
+func Parse(spec string) (Resolver, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "" || spec == None {
+		return Resolver{}, nil
+	}
+
+	if preset, ok := Presets[spec]; ok {
+		preset.Servers = slices.Clone(preset.Servers)
+		return preset, nil
+	}
+
+	if id, ok := strings.CutPrefix(spec, nextDNSPrefix); ok {
+		if !nextDNSID.MatchString(id) {
+			return Resolver{}, fmt.Errorf("invalid NextDNS configuration ID %q (six hex digits, from my.nextdns.io)", id)
+		}
+		return Resolver{
+			Name:    spec,
+			Servers: []string{"45.90.28.0#" + id + ".dns.nextdns.io", "45.90.30.0#" + id + ".dns.nextdns.io"},
+			OverTLS: true,
+		}, nil
+	}
+	if spec == "nextdns" {
+		return Resolver{}, fmt.Errorf("NextDNS needs your configuration ID: nextdns:<id>")
+	}
+
+	var servers []string
+	for _, field := range strings.Split(spec, ",") {
+		addr, err := netip.ParseAddr(strings.TrimSpace(field))
+		if err != nil {
+			return Resolver{}, fmt.Errorf("unknown DNS choice %q (valid: %s)", spec, Choices)
+		}
+		servers = append(servers, addr.String())
+	}
+	return Resolver{Name: strings.Join(servers, ","), Servers: servers}, nil
+}
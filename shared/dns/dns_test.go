@@ -0,0 +1,59 @@
+package dns
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Resolver
+		wantErr bool
+	}{
+		{spec: "", want: Resolver{}},
+		{spec: "None", want: Resolver{}},
+		{spec: " Mullvad ", want: Presets["mullvad"]},
+		{spec: "nextdns:abc123", want: Resolver{
+			Name:    "nextdns:abc123",
+			Servers: []string{"45.90.28.0#abc123.dns.nextdns.io", "45.90.30.0#abc123.dns.nextdns.io"},
+			OverTLS: true,
+		}},
+		{spec: "100.101.102.103", want: Resolver{Name: "100.101.102.103", Servers: []string{"100.101.102.103"}}},
+		{spec: "100.101.102.103, fd7a:115c:a1e0::53", want: Resolver{
+			Name:    "100.101.102.103,fd7a:115c:a1e0::53",
+			Servers: []string{"100.101.102.103", "fd7a:115c:a1e0::53"},
+		}},
+		{spec: "nextdns", wantErr: true},
+		{spec: "nextdns:not-an-id", wantErr: true},
+		{spec: "pihole.local", wantErr: true},
+		{spec: "1.2.3.4,", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := Parse(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPresetsUseTLSNames(t *testing.T) {
+	for name, preset := range Presets {
+		if preset.Name != name || !preset.OverTLS || len(preset.Servers) == 0 {
+			t.Errorf("preset %s = %+v, want its own name, TLS and servers", name, preset)
+		}
+	}
+
+	// Parse hands out copies, so callers can't change a preset
+	r, _ := Parse("quad9")
+	r.Servers[0] = "changed"
+	if Presets["quad9"].Servers[0] == "changed" {
+		t.Error("Parse returned a preset's own Servers slice")
+	}
+}
@@ -0,0 +1,174 @@
+package regions
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// EnvCustomRegions adds regions or remaps built-in ones, e.g.
+	// "riyadh=me-west-1,santiago=sa-west-1"
+	EnvCustomRegions = "TSE_CUSTOM_REGIONS"
+
+	// EnvOnlyRegions limits tse to the listed regions, e.g. "ohio,frankfurt,tokyo"
+	EnvOnlyRegions = "TSE_ONLY_REGIONS"
+)
+
+// builtinRegions is friendlyToAWS as compiled in, before any customization
+var builtinRegions = maps.Clone(friendlyToAWS)
+
+// awsRegionPattern matches AWS region codes such as "eu-central-2" or "us-gov-west-1"
+var awsRegionPattern = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-[0-9]$`)
+
+// FromEnv applies EnvCustomRegions and EnvOnlyRegions. The CLI and the Lambda
+// both call it at startup so they agree on which regions exist.
+func FromEnv() error {
+	custom, err := ParseCustomRegions(os.Getenv(EnvCustomRegions))
+	if err != nil {
+		return err
+	}
+
+	var only []string
+	for _, name := range strings.Split(os.Getenv(EnvOnlyRegions), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			only = append(only, name)
+		}
+	}
+
+	return Customize(custom, only)
+}
+
+// Customize adds the custom regions (friendly name → AWS region code), which may
+// remap built-in names, then restricts the list to only, if given. Each call
+// starts over from the built-in regions; on error nothing changes. It must run
+// before other lookups, at startup: the mappings aren't guarded for concurrent use.
+func Customize(custom map[string]string, only []string) error {
+	regions, err := build(custom, only)
+	if err != nil {
+		return err
+	}
+	setRegions(regions)
+	return nil
+}
+
+// Validate reports whether Customize would accept custom and only, without
+// applying them
+func Validate(custom map[string]string, only []string) error {
+	_, err := build(custom, only)
+	return err
+}
+
+// build returns the region mappings Customize would install
+func build(custom map[string]string, only []string) (map[string]string, error) {
+	regions := maps.Clone(builtinRegions)
+	for name, code := range custom {
+		friendly := normalizeName(name)
+		if friendly == "" {
+			return nil, fmt.Errorf("custom region needs a name (got %q=%q)", name, code)
+		}
+		if !awsRegionPattern.MatchString(code) {
+			return nil, fmt.Errorf("custom region %s: %q isn't an AWS region code (like eu-central-2)", friendly, code)
+		}
+		regions[friendly] = code
+	}
+
+	// Two names for one AWS region would make the reverse mapping ambiguous
+	owners := map[string]string{}
+	for _, friendly := range sortedKeys(regions) {
+		code := regions[friendly]
+		if other, taken := owners[code]; taken {
+			return nil, fmt.Errorf("regions %s and %s both map to %s; remap one of them", other, friendly, code)
+		}
+		owners[code] = friendly
+	}
+
+	if len(only) == 0 {
+		return regions, nil
+	}
+	kept := map[string]string{}
+	for _, name := range only {
+		friendly, err := resolveAgainst(regions, name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", EnvOnlyRegions, err)
+		}
+		kept[friendly] = regions[friendly]
+	}
+	return kept, nil
+}
+
+// resolveAgainst resolves a region or localized name like Resolve, but against
+// the given mappings rather than the ones in use
+func resolveAgainst(regions map[string]string, name string) (string, error) {
+	key := normalizeName(name)
+	if _, ok := regions[key]; ok {
+		return key, nil
+	}
+
+	var matches []string
+	for _, friendly := range aliases[key] {
+		if _, ok := regions[friendly]; ok {
+			matches = append(matches, friendly)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return "", fmt.Errorf("unknown region '%s'", name)
+	default:
+		return "", fmt.Errorf("'%s' matches several regions: %s", name, strings.Join(matches, ", "))
+	}
+}
+
+// setRegions replaces the region mappings
+func setRegions(regions map[string]string) {
+	friendlyToAWS = regions
+	awsToFriendly = map[string]string{}
+	for friendly, code := range regions {
+		awsToFriendly[code] = friendly
+	}
+}
+
+// ParseCustomRegions parses "name=code,name=code"
+func ParseCustomRegions(spec string) (map[string]string, error) {
+	custom := map[string]string{}
+	for _, pair := range strings.Split(spec, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, code, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s: %q should be name=aws-region", EnvCustomRegions, pair)
+		}
+		custom[strings.TrimSpace(name)] = strings.TrimSpace(code)
+	}
+	return custom, nil
+}
+
+// FormatCustomRegions is the inverse of ParseCustomRegions, sorted by name
+func FormatCustomRegions(custom map[string]string) string {
+	pairs := make([]string, 0, len(custom))
+	for _, name := range sortedKeys(custom) {
+		pairs = append(pairs, name+"="+custom[name])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// IsCustom reports whether a region was added or remapped by Customize
+func IsCustom(friendlyName string) bool {
+	code, ok := friendlyToAWS[friendlyName]
+	return ok && builtinRegions[friendlyName] != code
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
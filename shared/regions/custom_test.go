@@ -0,0 +1,106 @@
+package regions
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCustomize(t *testing.T) {
+	defer Customize(nil, nil)
+
+	custom := map[string]string{"Riyadh": "me-west-1", "santiago": "sa-west-1"}
+	if err := Customize(custom, nil); err != nil {
+		t.Fatalf("Customize(): %v", err)
+	}
+	if code, err := GetAWSRegion("riyadh"); err != nil || code != "me-west-1" {
+		t.Errorf("GetAWSRegion(riyadh) = %q, %v; want me-west-1", code, err)
+	}
+	if name, err := GetFriendlyName("sa-west-1"); err != nil || name != "santiago" {
+		t.Errorf("GetFriendlyName(sa-west-1) = %q, %v; want santiago", name, err)
+	}
+	if !IsCustom("riyadh") || IsCustom("ohio") {
+		t.Errorf("IsCustom(riyadh) = %v, IsCustom(ohio) = %v", IsCustom("riyadh"), IsCustom("ohio"))
+	}
+	if info, ok := Lookup("riyadh"); !ok || info.City != "riyadh" || info.NanoHourlyUSD != 0 || info.EgressUSDPerGB != 0 {
+		t.Errorf("Lookup(riyadh) = %+v, %v; want a bare custom entry", info, ok)
+	}
+	if all := All(); all[len(all)-1].Continent != "" {
+		t.Errorf("All() doesn't list custom regions last: %+v", all[len(all)-1])
+	}
+
+	// Restricting, by any name Resolve accepts, including custom ones
+	if err := Customize(custom, []string{"ohio", "Francfort", "riyadh"}); err != nil {
+		t.Fatalf("Customize(only): %v", err)
+	}
+	if got := GetAllFriendlyNames(); !reflect.DeepEqual(got, []string{"frankfurt", "ohio", "riyadh"}) {
+		t.Errorf("GetAllFriendlyNames() = %v, want [frankfurt ohio riyadh]", got)
+	}
+	if _, err := Resolve("tokyo"); err == nil {
+		t.Error("Resolve(tokyo) succeeded outside the only list")
+	}
+	if _, err := Resolve("東京"); err == nil {
+		t.Error("Resolve(東京) succeeded outside the only list")
+	}
+	if members, ok := Group("eu"); !ok || !reflect.DeepEqual(members, []string{"frankfurt"}) {
+		t.Errorf("Group(eu) = %v, %v; want [frankfurt]", members, ok)
+	}
+	if _, ok := Group("apac"); ok {
+		t.Error("Group(apac) found a group with no regions left")
+	}
+
+	// Each call starts over from the built-in regions
+	if err := Customize(nil, nil); err != nil {
+		t.Fatalf("Customize(nil, nil): %v", err)
+	}
+	if _, err := Resolve("riyadh"); err == nil || len(GetAllFriendlyNames()) != len(builtinRegions) {
+		t.Error("Customize(nil, nil) didn't restore the built-in regions")
+	}
+}
+
+func TestCustomizeErrors(t *testing.T) {
+	defer Customize(nil, nil)
+
+	tests := []struct {
+		name    string
+		custom  map[string]string
+		only    []string
+		wantErr string
+	}{
+		{"bad code", map[string]string{"riyadh": "riyadh-1"}, nil, "isn't an AWS region code"},
+		{"duplicate code", map[string]string{"riyadh": "eu-central-1"}, nil, "both map to eu-central-1"},
+		{"empty name", map[string]string{" ": "me-west-1"}, nil, "needs a name"},
+		{"unknown only", nil, []string{"ohio", "atlantis"}, "unknown region"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Customize(tt.custom, tt.only)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Customize() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(GetAllFriendlyNames()) != len(builtinRegions) {
+				t.Errorf("failed Customize() left %d regions, want the %d built-in", len(GetAllFriendlyNames()), len(builtinRegions))
+			}
+		})
+	}
+
+	// Remapping a built-in name frees its old code
+	if err := Customize(map[string]string{"frankfurt": "me-west-1", "berlin": "eu-central-1"}, nil); err != nil {
+		t.Errorf("Customize(remap): %v", err)
+	}
+}
+
+func TestParseCustomRegions(t *testing.T) {
+	got, err := ParseCustomRegions(" riyadh=me-west-1, santiago = sa-west-1 ,")
+	want := map[string]string{"riyadh": "me-west-1", "santiago": "sa-west-1"}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseCustomRegions() = %v, %v; want %v", got, err, want)
+	}
+	if FormatCustomRegions(want) != "riyadh=me-west-1,santiago=sa-west-1" {
+		t.Errorf("FormatCustomRegions() = %q", FormatCustomRegions(want))
+	}
+	if _, err := ParseCustomRegions("riyadh"); err == nil {
+		t.Error("ParseCustomRegions(riyadh) succeeded without a code")
+	}
+}
@@ -0,0 +1,34 @@
+package regions
+
+import "sort"
+
+// groups maps built-in region group names to their regions, in order of
+// preference. A group lets 'tse eu start' pick whichever of them is closest.
+// Opt-in regions are left out: the closest one might not be enabled.
+var groups = map[string][]string{
+	"us":   {"ohio", "virginia", "oregon", "california"},
+	"eu":   {"frankfurt", "paris", "ireland", "london", "stockholm"},
+	"apac": {"tokyo", "singapore", "seoul", "sydney", "mumbai", "osaka"},
+}
+
+// Group returns the regions of a built-in group, in order of preference,
+// leaving out any that TSE_ONLY_REGIONS excludes
+func Group(name string) ([]string, bool) {
+	members := available(groups[normalizeName(name)])
+	if len(members) == 0 {
+		return nil, false
+	}
+	return members, true
+}
+
+// GroupNames returns the built-in group names in sorted order
+func GroupNames() []string {
+	names := make([]string, 0, len(groups))
+	for name, members := range groups {
+		if len(available(members)) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
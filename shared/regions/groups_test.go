@@ -0,0 +1,38 @@
+package regions
+
+import "testing"
+
+func TestGroups(t *testing.T) {
+	for _, name := range GroupNames() {
+		members, ok := Group(name)
+		if !ok || len(members) == 0 {
+			t.Errorf("Group(%q) = %v, %v; want regions", name, members, ok)
+		}
+		for _, member := range members {
+			if _, ok := friendlyToAWS[member]; !ok {
+				t.Errorf("group %s lists unknown region %q", name, member)
+			}
+			if IsOptIn(friendlyToAWS[member]) {
+				t.Errorf("group %s lists opt-in region %s", name, member)
+			}
+		}
+		// A group name that also resolved as a region would never be reached
+		if _, err := Resolve(name); err == nil {
+			t.Errorf("group %s is also a region name", name)
+		}
+	}
+
+	if members, _ := Group(" EU "); len(members) == 0 || members[0] != "frankfurt" {
+		t.Errorf("Group(\" EU \") = %v, want frankfurt first", members)
+	}
+	if _, ok := Group("mars"); ok {
+		t.Error("Group(\"mars\") found a group")
+	}
+
+	// Callers may reorder what they get back
+	members, _ := Group("us")
+	members[0] = "tokyo"
+	if again, _ := Group("us"); again[0] != "ohio" {
+		t.Errorf("modifying Group's result changed the group: %v", again)
+	}
+}
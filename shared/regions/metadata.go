@@ -0,0 +1,167 @@
+package regions
+
+import "sort"
+
+// Continents, as Info reports them
+const (
+	NorthAmerica = "North America"
+	SouthAmerica = "South America"
+	Europe       = "Europe"
+	Africa       = "Africa"
+	Asia         = "Asia"
+	Oceania      = "Oceania"
+)
+
+// Info describes a region for display and for scripts ('tse regions --json')
+type Info struct {
+	Name        string `json:"name"` // Friendly name, as used in commands
+	AWSRegion   string `json:"aws_region"`
+	City        string `json:"city"` // English name of the city or US state
+	Country     string `json:"country"`
+	CountryCode string `json:"country_code"` // ISO 3166-1 alpha-2
+	Continent   string `json:"continent"`
+	Flag        string `json:"flag"`
+	// Typical on-demand Linux price of a t4g.nano in USD; AWS changes prices,
+	// so treat it as a guide rather than a quote. Zero for custom regions.
+	NanoHourlyUSD float64 `json:"t4g_nano_hourly_usd"`
+	// Whether the region has to be enabled for the account first (see OptInURL)
+	OptIn bool `json:"opt_in"`
+	// Typical price in USD per GB sent to the internet, before the free allowance
+	// and volume tiers; a guide like NanoHourlyUSD. Zero for custom regions.
+	EgressUSDPerGB float64 `json:"egress_usd_per_gb"`
+}
+
+// regionMetadata holds what Info needs beyond the region's names
+type regionMetadata struct {
+	countryCode   string
+	continent     string
+	nanoHourlyUSD float64
+}
+
+var metadata = map[string]regionMetadata{
+	"ohio":       {"US", NorthAmerica, 0.0042},
+	"virginia":   {"US", NorthAmerica, 0.0042},
+	"oregon":     {"US", NorthAmerica, 0.0042},
+	"california": {"US", NorthAmerica, 0.0050},
+	"canada":     {"CA", NorthAmerica, 0.0046},
+	"ireland":    {"IE", Europe, 0.0046},
+	"london":     {"GB", Europe, 0.0048},
+	"paris":      {"FR", Europe, 0.0048},
+	"frankfurt":  {"DE", Europe, 0.0048},
+	"stockholm":  {"SE", Europe, 0.0043},
+	"singapore":  {"SG", Asia, 0.0053},
+	"sydney":     {"AU", Oceania, 0.0053},
+	"tokyo":      {"JP", Asia, 0.0054},
+	"seoul":      {"KR", Asia, 0.0052},
+	"mumbai":     {"IN", Asia, 0.0034},
+	"saopaulo":   {"BR", SouthAmerica, 0.0067},
+	"osaka":      {"JP", Asia, 0.0054},
+	"capetown":   {"ZA", Africa, 0.0055},
+	"hongkong":   {"HK", Asia, 0.0059},
+	"taipei":     {"TW", Asia, 0.0054},
+	"hyderabad":  {"IN", Asia, 0.0034},
+	"jakarta":    {"ID", Asia, 0.0053},
+	"melbourne":  {"AU", Oceania, 0.0053},
+	"malaysia":   {"MY", Asia, 0.0048},
+	"newzealand": {"NZ", Oceania, 0.0053},
+	"thailand":   {"TH", Asia, 0.0048},
+	"calgary":    {"CA", NorthAmerica, 0.0046},
+	"zurich":     {"CH", Europe, 0.0053},
+	"milan":      {"IT", Europe, 0.0049},
+	"spain":      {"ES", Europe, 0.0046},
+	"telaviv":    {"IL", Asia, 0.0048},
+	"uae":        {"AE", Asia, 0.0051},
+	"bahrain":    {"BH", Asia, 0.0051},
+	"mexico":     {"MX", NorthAmerica, 0.0047},
+}
+
+// defaultEgressUSDPerGB is what most regions charge per GB out to the internet
+const defaultEgressUSDPerGB = 0.09
+
+// egressUSDPerGB lists the regions that charge more than defaultEgressUSDPerGB
+var egressUSDPerGB = map[string]float64{
+	"saopaulo":   0.15,
+	"tokyo":      0.114,
+	"osaka":      0.114,
+	"seoul":      0.126,
+	"singapore":  0.12,
+	"sydney":     0.114,
+	"melbourne":  0.114,
+	"newzealand": 0.114,
+	"mumbai":     0.1093,
+	"hyderabad":  0.1093,
+	"hongkong":   0.12,
+	"taipei":     0.12,
+	"jakarta":    0.132,
+	"malaysia":   0.12,
+	"thailand":   0.12,
+	"capetown":   0.154,
+	"bahrain":    0.117,
+	"uae":        0.11,
+	"telaviv":    0.11,
+}
+
+// Lookup returns the metadata for a friendly region name
+func Lookup(friendlyName string) (Info, bool) {
+	aws, ok := friendlyToAWS[friendlyName]
+	if !ok {
+		return Info{}, false
+	}
+	meta := metadata[friendlyName]
+	names := localizedNames[friendlyName]["en"]
+	egress := defaultEgressUSDPerGB
+	if price, ok := egressUSDPerGB[friendlyName]; ok {
+		egress = price
+	}
+	if IsCustom(friendlyName) {
+		// A remapped built-in name no longer describes where the region is
+		meta, names, egress = regionMetadata{}, place{City: friendlyName}, 0
+	}
+
+	return Info{
+		Name:           friendlyName,
+		AWSRegion:      aws,
+		City:           names.City,
+		Country:        names.Country,
+		CountryCode:    meta.countryCode,
+		Continent:      meta.continent,
+		Flag:           Flag(meta.countryCode),
+		NanoHourlyUSD:  meta.nanoHourlyUSD,
+		OptIn:          IsOptIn(aws),
+		EgressUSDPerGB: egress,
+	}, true
+}
+
+// All returns every region's metadata, grouped by continent and sorted by name
+// within each; custom regions, with no continent, come last
+func All() []Info {
+	all := make([]Info, 0, len(friendlyToAWS))
+	for friendly := range friendlyToAWS {
+		info, _ := Lookup(friendly)
+		all = append(all, info)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Continent != all[j].Continent {
+			return all[j].Continent == "" || all[i].Continent != "" && all[i].Continent < all[j].Continent
+		}
+		return all[i].Name < all[j].Name
+	})
+	return all
+}
+
+// Flag returns the emoji flag for an ISO 3166-1 alpha-2 country code, or "" if
+// the code isn't two letters
+func Flag(countryCode string) string {
+	if len(countryCode) != 2 {
+		return ""
+	}
+	flag := make([]rune, 0, 2)
+	for _, c := range countryCode {
+		if c < 'A' || c > 'Z' {
+			return ""
+		}
+		// Regional indicator symbols start at U+1F1E6 for 'A'
+		flag = append(flag, 0x1F1E6+c-'A')
+	}
+	return string(flag)
+}
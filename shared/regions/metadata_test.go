@@ -0,0 +1,67 @@
+package regions
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestMetadataComplete(t *testing.T) {
+	for friendly, aws := range friendlyToAWS {
+		info, ok := Lookup(friendly)
+		if !ok {
+			t.Errorf("Lookup(%q) found nothing", friendly)
+			continue
+		}
+		if info.AWSRegion != aws || info.City == "" || info.Country == "" {
+			t.Errorf("Lookup(%q) = %+v, want names and %s", friendly, info, aws)
+		}
+		if info.Flag == "" || info.Continent == "" || info.NanoHourlyUSD <= 0 || info.EgressUSDPerGB <= 0 {
+			t.Errorf("region %s is missing metadata: %+v", friendly, info)
+		}
+	}
+	for friendly := range metadata {
+		if _, ok := friendlyToAWS[friendly]; !ok {
+			t.Errorf("metadata for unknown region %q", friendly)
+		}
+	}
+	for friendly := range egressUSDPerGB {
+		if _, ok := friendlyToAWS[friendly]; !ok {
+			t.Errorf("egress price for unknown region %q", friendly)
+		}
+	}
+
+	if _, ok := Lookup("atlantis"); ok {
+		t.Error("Lookup(atlantis) found a region")
+	}
+}
+
+func TestAll(t *testing.T) {
+	all := All()
+	if len(all) != len(friendlyToAWS) {
+		t.Fatalf("All() returned %d regions, want %d", len(all), len(friendlyToAWS))
+	}
+	sorted := sort.SliceIsSorted(all, func(i, j int) bool {
+		if all[i].Continent != all[j].Continent {
+			return all[i].Continent < all[j].Continent
+		}
+		return all[i].Name < all[j].Name
+	})
+	if !sorted {
+		t.Error("All() isn't sorted by continent, then name")
+	}
+}
+
+func TestFlag(t *testing.T) {
+	tests := map[string]string{
+		"US":  "🇺🇸",
+		"JP":  "🇯🇵",
+		"us":  "",
+		"USA": "",
+		"":    "",
+	}
+	for code, want := range tests {
+		if got := Flag(code); got != want {
+			t.Errorf("Flag(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
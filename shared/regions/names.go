@@ -0,0 +1,303 @@
+package regions
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Languages with localized region names
+var Languages = []string{"en", "de", "es", "fr", "it", "pt", "ja"}
+
+// place is what a region is called in one language
+type place struct {
+	City    string // The city (or US state) the region is known by
+	Country string
+}
+
+// localizedNames maps each friendly name to what the region is called in each
+// of Languages. Every name, city or country, is accepted by Resolve; country
+// names that cover several regions (the US, Japan) are rejected as ambiguous.
+var localizedNames = map[string]map[string]place{
+	"ohio": {
+		"en": {"Ohio", "United States"}, "de": {"Ohio", "Vereinigte Staaten"}, "es": {"Ohio", "Estados Unidos"},
+		"fr": {"Ohio", "États-Unis"}, "it": {"Ohio", "Stati Uniti"}, "pt": {"Ohio", "Estados Unidos"}, "ja": {"オハイオ", "アメリカ"},
+	},
+	"virginia": {
+		"en": {"Virginia", "United States"}, "de": {"Virginia", "Vereinigte Staaten"}, "es": {"Virginia", "Estados Unidos"},
+		"fr": {"Virginie", "États-Unis"}, "it": {"Virginia", "Stati Uniti"}, "pt": {"Virgínia", "Estados Unidos"}, "ja": {"バージニア", "アメリカ"},
+	},
+	"oregon": {
+		"en": {"Oregon", "United States"}, "de": {"Oregon", "Vereinigte Staaten"}, "es": {"Oregón", "Estados Unidos"},
+		"fr": {"Oregon", "États-Unis"}, "it": {"Oregon", "Stati Uniti"}, "pt": {"Oregon", "Estados Unidos"}, "ja": {"オレゴン", "アメリカ"},
+	},
+	"california": {
+		"en": {"California", "United States"}, "de": {"Kalifornien", "Vereinigte Staaten"}, "es": {"California", "Estados Unidos"},
+		"fr": {"Californie", "États-Unis"}, "it": {"California", "Stati Uniti"}, "pt": {"Califórnia", "Estados Unidos"}, "ja": {"カリフォルニア", "アメリカ"},
+	},
+	"canada": {
+		"en": {"Montreal", "Canada"}, "de": {"Montreal", "Kanada"}, "es": {"Montreal", "Canadá"},
+		"fr": {"Montréal", "Canada"}, "it": {"Montréal", "Canada"}, "pt": {"Montreal", "Canadá"}, "ja": {"モントリオール", "カナダ"},
+	},
+	"ireland": {
+		"en": {"Ireland", "Ireland"}, "de": {"Irland", "Irland"}, "es": {"Irlanda", "Irlanda"},
+		"fr": {"Irlande", "Irlande"}, "it": {"Irlanda", "Irlanda"}, "pt": {"Irlanda", "Irlanda"}, "ja": {"アイルランド", "アイルランド"},
+	},
+	"london": {
+		"en": {"London", "United Kingdom"}, "de": {"London", "Vereinigtes Königreich"}, "es": {"Londres", "Reino Unido"},
+		"fr": {"Londres", "Royaume-Uni"}, "it": {"Londra", "Regno Unito"}, "pt": {"Londres", "Reino Unido"}, "ja": {"ロンドン", "イギリス"},
+	},
+	"paris": {
+		"en": {"Paris", "France"}, "de": {"Paris", "Frankreich"}, "es": {"París", "Francia"},
+		"fr": {"Paris", "France"}, "it": {"Parigi", "Francia"}, "pt": {"Paris", "França"}, "ja": {"パリ", "フランス"},
+	},
+	"frankfurt": {
+		"en": {"Frankfurt", "Germany"}, "de": {"Frankfurt", "Deutschland"}, "es": {"Fráncfort", "Alemania"},
+		"fr": {"Francfort", "Allemagne"}, "it": {"Francoforte", "Germania"}, "pt": {"Frankfurt", "Alemanha"}, "ja": {"フランクフルト", "ドイツ"},
+	},
+	"stockholm": {
+		"en": {"Stockholm", "Sweden"}, "de": {"Stockholm", "Schweden"}, "es": {"Estocolmo", "Suecia"},
+		"fr": {"Stockholm", "Suède"}, "it": {"Stoccolma", "Svezia"}, "pt": {"Estocolmo", "Suécia"}, "ja": {"ストックホルム", "スウェーデン"},
+	},
+	"singapore": {
+		"en": {"Singapore", "Singapore"}, "de": {"Singapur", "Singapur"}, "es": {"Singapur", "Singapur"},
+		"fr": {"Singapour", "Singapour"}, "it": {"Singapore", "Singapore"}, "pt": {"Singapura", "Singapura"}, "ja": {"シンガポール", "シンガポール"},
+	},
+	"sydney": {
+		"en": {"Sydney", "Australia"}, "de": {"Sydney", "Australien"}, "es": {"Sídney", "Australia"},
+		"fr": {"Sydney", "Australie"}, "it": {"Sydney", "Australia"}, "pt": {"Sydney", "Austrália"}, "ja": {"シドニー", "オーストラリア"},
+	},
+	"tokyo": {
+		"en": {"Tokyo", "Japan"}, "de": {"Tokio", "Japan"}, "es": {"Tokio", "Japón"},
+		"fr": {"Tokyo", "Japon"}, "it": {"Tokyo", "Giappone"}, "pt": {"Tóquio", "Japão"}, "ja": {"東京", "日本"},
+	},
+	"seoul": {
+		"en": {"Seoul", "South Korea"}, "de": {"Seoul", "Südkorea"}, "es": {"Seúl", "Corea del Sur"},
+		"fr": {"Séoul", "Corée du Sud"}, "it": {"Seul", "Corea del Sud"}, "pt": {"Seul", "Coreia do Sul"}, "ja": {"ソウル", "韓国"},
+	},
+	"mumbai": {
+		"en": {"Mumbai", "India"}, "de": {"Mumbai", "Indien"}, "es": {"Bombay", "India"},
+		"fr": {"Bombay", "Inde"}, "it": {"Mumbai", "India"}, "pt": {"Mumbai", "Índia"}, "ja": {"ムンバイ", "インド"},
+	},
+	"saopaulo": {
+		"en": {"São Paulo", "Brazil"}, "de": {"São Paulo", "Brasilien"}, "es": {"São Paulo", "Brasil"},
+		"fr": {"São Paulo", "Brésil"}, "it": {"San Paolo", "Brasile"}, "pt": {"São Paulo", "Brasil"}, "ja": {"サンパウロ", "ブラジル"},
+	},
+	"osaka": {
+		"en": {"Osaka", "Japan"}, "de": {"Osaka", "Japan"}, "es": {"Osaka", "Japón"},
+		"fr": {"Osaka", "Japon"}, "it": {"Osaka", "Giappone"}, "pt": {"Osaka", "Japão"}, "ja": {"大阪", "日本"},
+	},
+	"capetown": {
+		"en": {"Cape Town", "South Africa"}, "de": {"Kapstadt", "Südafrika"}, "es": {"Ciudad del Cabo", "Sudáfrica"},
+		"fr": {"Le Cap", "Afrique du Sud"}, "it": {"Città del Capo", "Sudafrica"}, "pt": {"Cidade do Cabo", "África do Sul"}, "ja": {"ケープタウン", "南アフリカ"},
+	},
+	"hongkong": {
+		"en": {"Hong Kong", "Hong Kong"}, "de": {"Hongkong", "Hongkong"}, "es": {"Hong Kong", "Hong Kong"},
+		"fr": {"Hong Kong", "Hong Kong"}, "it": {"Hong Kong", "Hong Kong"}, "pt": {"Hong Kong", "Hong Kong"}, "ja": {"香港", "香港"},
+	},
+	"taipei": {
+		"en": {"Taipei", "Taiwan"}, "de": {"Taipeh", "Taiwan"}, "es": {"Taipéi", "Taiwán"},
+		"fr": {"Taipei", "Taïwan"}, "it": {"Taipei", "Taiwan"}, "pt": {"Taipé", "Taiwan"}, "ja": {"台北", "台湾"},
+	},
+	"hyderabad": {
+		"en": {"Hyderabad", "India"}, "de": {"Hyderabad", "Indien"}, "es": {"Hyderabad", "India"},
+		"fr": {"Hyderabad", "Inde"}, "it": {"Hyderabad", "India"}, "pt": {"Hyderabad", "Índia"}, "ja": {"ハイデラバード", "インド"},
+	},
+	"jakarta": {
+		"en": {"Jakarta", "Indonesia"}, "de": {"Jakarta", "Indonesien"}, "es": {"Yakarta", "Indonesia"},
+		"fr": {"Jakarta", "Indonésie"}, "it": {"Giacarta", "Indonesia"}, "pt": {"Jacarta", "Indonésia"}, "ja": {"ジャカルタ", "インドネシア"},
+	},
+	"melbourne": {
+		"en": {"Melbourne", "Australia"}, "de": {"Melbourne", "Australien"}, "es": {"Melbourne", "Australia"},
+		"fr": {"Melbourne", "Australie"}, "it": {"Melbourne", "Australia"}, "pt": {"Melbourne", "Austrália"}, "ja": {"メルボルン", "オーストラリア"},
+	},
+	"malaysia": {
+		"en": {"Kuala Lumpur", "Malaysia"}, "de": {"Kuala Lumpur", "Malaysia"}, "es": {"Kuala Lumpur", "Malasia"},
+		"fr": {"Kuala Lumpur", "Malaisie"}, "it": {"Kuala Lumpur", "Malesia"}, "pt": {"Kuala Lumpur", "Malásia"}, "ja": {"クアラルンプール", "マレーシア"},
+	},
+	"newzealand": {
+		"en": {"Auckland", "New Zealand"}, "de": {"Auckland", "Neuseeland"}, "es": {"Auckland", "Nueva Zelanda"},
+		"fr": {"Auckland", "Nouvelle-Zélande"}, "it": {"Auckland", "Nuova Zelanda"}, "pt": {"Auckland", "Nova Zelândia"}, "ja": {"オークランド", "ニュージーランド"},
+	},
+	"thailand": {
+		"en": {"Bangkok", "Thailand"}, "de": {"Bangkok", "Thailand"}, "es": {"Bangkok", "Tailandia"},
+		"fr": {"Bangkok", "Thaïlande"}, "it": {"Bangkok", "Thailandia"}, "pt": {"Banguecoque", "Tailândia"}, "ja": {"バンコク", "タイ"},
+	},
+	"calgary": {
+		"en": {"Calgary", "Canada"}, "de": {"Calgary", "Kanada"}, "es": {"Calgary", "Canadá"},
+		"fr": {"Calgary", "Canada"}, "it": {"Calgary", "Canada"}, "pt": {"Calgary", "Canadá"}, "ja": {"カルガリー", "カナダ"},
+	},
+	"zurich": {
+		"en": {"Zurich", "Switzerland"}, "de": {"Zürich", "Schweiz"}, "es": {"Zúrich", "Suiza"},
+		"fr": {"Zurich", "Suisse"}, "it": {"Zurigo", "Svizzera"}, "pt": {"Zurique", "Suíça"}, "ja": {"チューリッヒ", "スイス"},
+	},
+	"milan": {
+		"en": {"Milan", "Italy"}, "de": {"Mailand", "Italien"}, "es": {"Milán", "Italia"},
+		"fr": {"Milan", "Italie"}, "it": {"Milano", "Italia"}, "pt": {"Milão", "Itália"}, "ja": {"ミラノ", "イタリア"},
+	},
+	"spain": {
+		"en": {"Aragon", "Spain"}, "de": {"Aragonien", "Spanien"}, "es": {"Aragón", "España"},
+		"fr": {"Aragon", "Espagne"}, "it": {"Aragona", "Spagna"}, "pt": {"Aragão", "Espanha"}, "ja": {"アラゴン", "スペイン"},
+	},
+	"telaviv": {
+		"en": {"Tel Aviv", "Israel"}, "de": {"Tel Aviv", "Israel"}, "es": {"Tel Aviv", "Israel"},
+		"fr": {"Tel Aviv", "Israël"}, "it": {"Tel Aviv", "Israele"}, "pt": {"Telavive", "Israel"}, "ja": {"テルアビブ", "イスラエル"},
+	},
+	"uae": {
+		"en": {"UAE", "United Arab Emirates"}, "de": {"VAE", "Vereinigte Arabische Emirate"}, "es": {"EAU", "Emiratos Árabes Unidos"},
+		"fr": {"EAU", "Émirats arabes unis"}, "it": {"EAU", "Emirati Arabi Uniti"}, "pt": {"EAU", "Emirados Árabes Unidos"}, "ja": {"UAE", "アラブ首長国連邦"},
+	},
+	"bahrain": {
+		"en": {"Bahrain", "Bahrain"}, "de": {"Bahrain", "Bahrain"}, "es": {"Baréin", "Baréin"},
+		"fr": {"Bahreïn", "Bahreïn"}, "it": {"Bahrein", "Bahrein"}, "pt": {"Barém", "Barém"}, "ja": {"バーレーン", "バーレーン"},
+	},
+	"mexico": {
+		"en": {"Querétaro", "Mexico"}, "de": {"Querétaro", "Mexiko"}, "es": {"Querétaro", "México"},
+		"fr": {"Querétaro", "Mexique"}, "it": {"Querétaro", "Messico"}, "pt": {"Querétaro", "México"}, "ja": {"ケレタロ", "メキシコ"},
+	},
+}
+
+// aliases maps every normalized localized name to the friendly names it could mean
+var aliases = map[string][]string{}
+
+func init() {
+	for friendly, names := range localizedNames {
+		for _, name := range names {
+			addAlias(name.City, friendly)
+			addAlias(name.Country, friendly)
+		}
+	}
+	for alias := range aliases {
+		sort.Strings(aliases[alias])
+	}
+}
+
+func addAlias(name, friendly string) {
+	key := normalizeName(name)
+	for _, existing := range aliases[key] {
+		if existing == friendly {
+			return
+		}
+	}
+	aliases[key] = append(aliases[key], friendly)
+}
+
+// available filters friendly names down to the regions in use, which
+// TSE_ONLY_REGIONS may have narrowed
+func available(names []string) []string {
+	var kept []string
+	for _, name := range names {
+		if _, ok := friendlyToAWS[name]; ok {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
+
+// foldAccents strips the diacritics that show up in place names, so "São
+// Paulo" can be typed as "sao paulo"
+var foldAccents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ä", "a", "ã", "a", "å", "a",
+	"ç", "c",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ñ", "n",
+	"ó", "o", "ò", "o", "ô", "o", "ö", "o", "õ", "o", "ø", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ß", "ss",
+	// Separators people type between words
+	" ", "", "-", "", "_", "", ".", "", "'", "",
+)
+
+// normalizeName lowercases name and drops accents and separators
+func normalizeName(name string) string {
+	return foldAccents.Replace(strings.ToLower(strings.TrimSpace(name)))
+}
+
+// Resolve returns the friendly name for a region given its friendly name or any
+// localized city or country name, ignoring case, accents and spacing
+// ("frankfurt", "Francfort", "são paulo", "東京"). Unknown names get an error
+// suggesting the closest match.
+func Resolve(name string) (string, error) {
+	key := normalizeName(name)
+	if _, ok := friendlyToAWS[key]; ok {
+		return key, nil
+	}
+
+	switch matches := available(aliases[key]); len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+	default:
+		return "", fmt.Errorf("'%s' matches several regions: %s", name, strings.Join(matches, ", "))
+	}
+
+	if suggestion := closestName(key); suggestion != "" {
+		return "", fmt.Errorf("unknown region '%s'. Did you mean %s?", name, suggestion)
+	}
+	return "", fmt.Errorf("unknown region '%s'. Available regions: %s", name, GetAvailableRegions())
+}
+
+// DisplayName returns a region's city name in lang, falling back to English.
+// Unknown regions are returned unchanged.
+func DisplayName(friendlyName, lang string) string {
+	names, ok := localizedNames[friendlyName]
+	if !ok {
+		return friendlyName
+	}
+	if name, ok := names[lang]; ok {
+		return name.City
+	}
+	return names["en"].City
+}
+
+// maxSuggestDistance is how many edits a typo can be from a name and still be suggested
+const maxSuggestDistance = 2
+
+// closestName returns the friendly name nearest to key by edit distance, or ""
+// if nothing is close. Only unambiguous names are considered.
+func closestName(key string) string {
+	if utf8.RuneCountInString(key) <= maxSuggestDistance {
+		return ""
+	}
+
+	best, bestDistance := "", maxSuggestDistance+1
+	consider := func(candidate, friendly string) {
+		d := editDistance(key, candidate)
+		if d < bestDistance || (d == bestDistance && friendly < best) {
+			best, bestDistance = friendly, d
+		}
+	}
+	for friendly := range friendlyToAWS {
+		consider(friendly, friendly)
+	}
+	for alias, matches := range aliases {
+		if matches := available(matches); len(matches) == 1 {
+			consider(alias, matches[0])
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b, in runes
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,104 @@
+package regions
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"frankfurt", "frankfurt"},
+		{"francfort", "frankfurt"},
+		{"Francoforte", "frankfurt"},
+		{"Fráncfort", "frankfurt"},
+		{"Deutschland", "frankfurt"},
+		{"São Paulo", "saopaulo"},
+		{"sao-paulo", "saopaulo"},
+		{"san paolo", "saopaulo"},
+		{"東京", "tokyo"},
+		{"Tóquio", "tokyo"},
+		{"Londres", "london"},
+		{"Séoul", "seoul"},
+		{"bombay", "mumbai"},
+		{" SINGAPUR ", "singapore"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := Resolve(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr string
+	}{
+		{"Estados Unidos", "matches several regions: california, ohio, oregon, virginia"},
+		{"frankfrut", "Did you mean frankfurt?"},
+		{"tokio", ""}, // German and Spanish for Tokyo, so not an error at all
+		{"nonexistent", "Available regions:"},
+		{"", "Available regions:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Resolve(tt.input)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLocalizedNamesComplete(t *testing.T) {
+	for friendly := range friendlyToAWS {
+		names, ok := localizedNames[friendly]
+		if !ok {
+			t.Errorf("%s has no localized names", friendly)
+			continue
+		}
+		for _, lang := range Languages {
+			if names[lang].City == "" || names[lang].Country == "" {
+				t.Errorf("%s is missing %s names", friendly, lang)
+			}
+		}
+	}
+
+	// A city name must never point at two regions
+	for friendly, names := range localizedNames {
+		for _, name := range names {
+			if matches := aliases[normalizeName(name.City)]; len(matches) != 1 {
+				t.Errorf("%s city %q matches %v", friendly, name.City, matches)
+			}
+		}
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	if got := DisplayName("frankfurt", "fr"); got != "Francfort" {
+		t.Errorf("DisplayName(frankfurt, fr) = %s", got)
+	}
+	if got := DisplayName("saopaulo", "ko"); got != "São Paulo" {
+		t.Errorf("unknown languages should fall back to English, got %s", got)
+	}
+	if got := DisplayName("atlantis", "en"); got != "atlantis" {
+		t.Errorf("unknown regions should be returned unchanged, got %s", got)
+	}
+}
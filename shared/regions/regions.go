@@ -2,6 +2,7 @@ package regions
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -23,8 +24,41 @@ var friendlyToAWS = map[string]string{
 	"seoul":      "ap-northeast-2",
 	"mumbai":     "ap-south-1",
 	"saopaulo":   "sa-east-1",
+	"osaka":      "ap-northeast-3",
+
+	// Opt-in regions, usable once enabled for the account (see IsOptIn)
+	"capetown":   "af-south-1",
+	"hongkong":   "ap-east-1",
+	"taipei":     "ap-east-2",
+	"hyderabad":  "ap-south-2",
+	"jakarta":    "ap-southeast-3",
+	"melbourne":  "ap-southeast-4",
+	"malaysia":   "ap-southeast-5",
+	"newzealand": "ap-southeast-6",
+	"thailand":   "ap-southeast-7",
+	"calgary":    "ca-west-1",
+	"zurich":     "eu-central-2",
+	"milan":      "eu-south-1",
+	"spain":      "eu-south-2",
+	"telaviv":    "il-central-1",
+	"uae":        "me-central-1",
+	"bahrain":    "me-south-1",
+	"mexico":     "mx-central-1",
+}
+
+// enabledByDefault lists the AWS regions every account can use. Regions launched
+// since March 2019 are opt-in: disabled until someone enables them for the account.
+var enabledByDefault = map[string]bool{
+	"us-east-1": true, "us-east-2": true, "us-west-1": true, "us-west-2": true,
+	"ca-central-1": true, "sa-east-1": true,
+	"eu-west-1": true, "eu-west-2": true, "eu-west-3": true, "eu-central-1": true, "eu-north-1": true,
+	"ap-northeast-1": true, "ap-northeast-2": true, "ap-northeast-3": true,
+	"ap-southeast-1": true, "ap-southeast-2": true, "ap-south-1": true,
 }
 
+// OptInURL is where an account's opt-in regions are enabled
+const OptInURL = "https://console.aws.amazon.com/account/home#/regions"
+
 // awsToFriendly maps AWS region codes to human-friendly names
 var awsToFriendly = map[string]string{}
 
@@ -35,15 +69,14 @@ func init() {
 	}
 }
 
-// GetAWSRegion converts a friendly region name to AWS region code
+// GetAWSRegion converts a friendly region name (or any name Resolve accepts) to AWS region code
 // Returns error if the friendly name is not recognized
 func GetAWSRegion(friendlyName string) (string, error) {
-	normalized := strings.ToLower(strings.TrimSpace(friendlyName))
-	awsRegion, ok := friendlyToAWS[normalized]
-	if !ok {
-		return "", fmt.Errorf("unknown region '%s'. Available regions: %s", friendlyName, GetAvailableRegions())
+	resolved, err := Resolve(friendlyName)
+	if err != nil {
+		return "", err
 	}
-	return awsRegion, nil
+	return friendlyToAWS[resolved], nil
 }
 
 // GetFriendlyName converts an AWS region code to a friendly name
@@ -56,29 +89,32 @@ func GetFriendlyName(awsRegion string) (string, error) {
 	return friendlyName, nil
 }
 
-// GetAvailableRegions returns a comma-separated list of available friendly region names
+// GetAvailableRegions returns a comma-separated, sorted list of available friendly
+// region names. Use All for structured metadata.
 func GetAvailableRegions() string {
-	regions := make([]string, 0, len(friendlyToAWS))
-	for friendly := range friendlyToAWS {
-		regions = append(regions, friendly)
-	}
-	return strings.Join(regions, ", ")
+	return strings.Join(GetAllFriendlyNames(), ", ")
 }
 
-// GetAllFriendlyNames returns a slice of all available friendly region names
+// GetAllFriendlyNames returns all available friendly region names in sorted order
 func GetAllFriendlyNames() []string {
 	regions := make([]string, 0, len(friendlyToAWS))
 	for friendly := range friendlyToAWS {
 		regions = append(regions, friendly)
 	}
+	sort.Strings(regions)
 	return regions
 }
 
-// IsValidFriendlyName checks if a friendly name is supported
+// IsValidFriendlyName checks if a friendly name (or localized name) is supported
 func IsValidFriendlyName(friendlyName string) bool {
-	normalized := strings.ToLower(strings.TrimSpace(friendlyName))
-	_, ok := friendlyToAWS[normalized]
-	return ok
+	_, err := Resolve(friendlyName)
+	return err == nil
+}
+
+// IsOptIn reports whether an AWS region has to be enabled for an account before
+// it can be used. Region codes tse doesn't know (custom ones) count as opt-in.
+func IsOptIn(awsRegion string) bool {
+	return !enabledByDefault[awsRegion]
 }
 
 // IsValidAWSRegion checks if an AWS region code is supported
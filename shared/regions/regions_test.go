@@ -212,3 +212,24 @@ func TestBidirectionalMapping(t *testing.T) {
 		}
 	}
 }
+
+func TestIsOptIn(t *testing.T) {
+	tests := map[string]bool{
+		"us-east-2":      false,
+		"ap-northeast-3": false,
+		"eu-central-2":   true,
+		"af-south-1":     true,
+		"me-west-1":      true, // Unknown codes, as custom regions use, may need enabling
+	}
+	for code, want := range tests {
+		if got := IsOptIn(code); got != want {
+			t.Errorf("IsOptIn(%s) = %v, want %v", code, got, want)
+		}
+	}
+
+	for friendly, code := range friendlyToAWS {
+		if info, _ := Lookup(friendly); info.OptIn != IsOptIn(code) {
+			t.Errorf("Lookup(%s).OptIn = %v, want %v", friendly, info.OptIn, IsOptIn(code))
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Package routes validates the subnet routes an exit node advertises besides
+// being an exit node, turning it into a small subnet router. The CLI checks
+// them before sending a start (and before adding ACL auto-approvers); the
+// Lambda checks them again before they reach the node's setup script.
+package routes
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// VPC stands for the exit node's own VPC
+const VPC = "vpc"
+
+// VPCCIDR is the address range of the VPC tse creates in every region
+const VPCCIDR = "10.0.0.0/16"
+
+// MaxRoutes caps how many routes one node advertises
+const MaxRoutes = 16
+
+// Parse reads a comma-separated list of routes: CIDR prefixes such as
+// 192.168.10.0/24, or VPC. It returns them in canonical form without
+// duplicates; "" is no routes.
+func Parse(spec string) ([]string, error) {
+	var routes []string
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+		if field == VPC {
+			field = VPCCIDR
+		}
+
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %q: use a CIDR prefix such as 192.168.10.0/24, or %s", field, VPC)
+		}
+		if prefix.Bits() == 0 {
+			return nil, fmt.Errorf("route %s is all traffic, which the exit node already carries", prefix)
+		}
+		if masked := prefix.Masked(); masked != prefix {
+			return nil, fmt.Errorf("route %s has host bits set; did you mean %s?", prefix, masked)
+		}
+
+		route := prefix.String()
+		if !seen[route] {
+			seen[route] = true
+			routes = append(routes, route)
+		}
+	}
+	if len(routes) > MaxRoutes {
+		return nil, fmt.Errorf("too many routes (%d); a node advertises at most %d", len(routes), MaxRoutes)
+	}
+	return routes, nil
+}
@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: "VPC", want: []string{VPCCIDR}},
+		{spec: "vpc, 192.168.10.0/24,10.0.0.0/16", want: []string{VPCCIDR, "192.168.10.0/24"}},
+		{spec: "fd00:1::/64", want: []string{"fd00:1::/64"}},
+		{spec: "192.168.10.1/32", want: []string{"192.168.10.1/32"}},
+		{spec: "192.168.10.1/24", wantErr: true},
+		{spec: "0.0.0.0/0", wantErr: true},
+		{spec: "::/0", wantErr: true},
+		{spec: "192.168.10.1", wantErr: true},
+		{spec: "office", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := Parse(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLimitsRoutes(t *testing.T) {
+	var many []string
+	for i := 0; i <= MaxRoutes; i++ {
+		many = append(many, fmt.Sprintf("192.168.%d.0/24", i))
+	}
+	if _, err := Parse(strings.Join(many, ",")); err == nil {
+		t.Errorf("Parse accepted %d routes", len(many))
+	}
+	if _, err := Parse(strings.Join(many[:MaxRoutes], ",")); err != nil {
+		t.Errorf("Parse(%d routes) = %v", MaxRoutes, err)
+	}
+}
@@ -2,6 +2,8 @@ package tailscale
 
 import (
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
 )
 
@@ -58,6 +60,28 @@ func EnsureAutoApprover(policy *ACLPolicy, tag string) bool {
 	return true
 }
 
+// EnsureRouteApprover adds a tag to the autoApprovers of a subnet route if not present
+// Returns true if changes were made
+func EnsureRouteApprover(policy *ACLPolicy, route, tag string) bool {
+	if policy == nil {
+		return false
+	}
+
+	if policy.AutoApprovers == nil {
+		policy.AutoApprovers = &AutoApprovers{}
+	}
+	if policy.AutoApprovers.Routes == nil {
+		policy.AutoApprovers.Routes = make(map[string][]string)
+	}
+
+	if HasRouteApprover(policy, route, tag) {
+		return false // Already configured
+	}
+
+	policy.AutoApprovers.Routes[route] = append(policy.AutoApprovers.Routes[route], tag)
+	return true
+}
+
 // HasTagOwner checks if a tag exists in tagOwners
 func HasTagOwner(policy *ACLPolicy, tag string) bool {
 	if policy == nil || policy.TagOwners == nil {
@@ -89,6 +113,20 @@ func HasAutoApprover(policy *ACLPolicy, tag string) bool {
 	return false
 }
 
+// HasRouteApprover checks if a tag is in the autoApprovers of a subnet route
+func HasRouteApprover(policy *ACLPolicy, route, tag string) bool {
+	if policy == nil || policy.AutoApprovers == nil {
+		return false
+	}
+
+	for _, approver := range policy.AutoApprovers.Routes[route] {
+		if approver == tag {
+			return true
+		}
+	}
+	return false
+}
+
 // ConfigureForExitNodes configures ACL policy for TSE exit nodes
 // Returns a list of changes made and a boolean indicating if changes were applied
 func ConfigureForExitNodes(policy *ACLPolicy, owner string) ([]string, bool) {
@@ -119,6 +157,296 @@ func ConfigureForExitNodes(policy *ACLPolicy, owner string) ([]string, bool) {
 	return changes, modified
 }
 
+// ConfigureRouteApprovers lets TSE exit nodes advertise the given subnet routes
+// without manual approval in the admin console
+// Returns a list of changes made and a boolean indicating if changes were applied
+func ConfigureRouteApprovers(policy *ACLPolicy, routes []string) ([]string, bool) {
+	if policy == nil {
+		return nil, false
+	}
+
+	var changes []string
+	modified := false
+
+	for _, route := range routes {
+		if EnsureRouteApprover(policy, route, "tag:exitnode") {
+			changes = append(changes, fmt.Sprintf("Added tag:exitnode to auto-approvers for route %s", route))
+			modified = true
+		} else {
+			changes = append(changes, fmt.Sprintf("✓ tag:exitnode already in auto-approvers for route %s", route))
+		}
+	}
+
+	return changes, modified
+}
+
+// PreviewRouteApprovers returns a human-readable description of what
+// ConfigureRouteApprovers would change
+func PreviewRouteApprovers(current *ACLPolicy, routes []string) []string {
+	var preview []string
+	for _, route := range routes {
+		if !HasRouteApprover(current, route, "tag:exitnode") {
+			preview = append(preview, fmt.Sprintf("+ Add tag:exitnode to auto-approvers for route %s", route))
+		} else {
+			preview = append(preview, fmt.Sprintf("  tag:exitnode already in auto-approvers for route %s", route))
+		}
+	}
+	return preview
+}
+
+// RoutesApprovedFor returns the subnet routes whose autoApprovers include a tag, sorted
+func RoutesApprovedFor(policy *ACLPolicy, tag string) []string {
+	if policy == nil || policy.AutoApprovers == nil {
+		return nil
+	}
+
+	var routes []string
+	for route := range policy.AutoApprovers.Routes {
+		if HasRouteApprover(policy, route, tag) {
+			routes = append(routes, route)
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// exitNodeAccessDst is what using the exit nodes takes: reaching the nodes
+// themselves, and autogroup:internet, the traffic that leaves through them
+var exitNodeAccessDst = []string{"tag:exitnode:*", "autogroup:internet:*"}
+
+// HasExitNodeAccess checks if an accept rule lets src use the exit nodes
+func HasExitNodeAccess(policy *ACLPolicy, src string) bool {
+	if policy == nil {
+		return false
+	}
+
+	for _, rule := range policy.ACLs {
+		if isExitNodeAccessRule(rule) && slices.Contains(rule.Src, src) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnsureExitNodeAccess adds src to an ACL rule that lets it use the exit nodes,
+// creating the rule if there isn't one
+// Returns true if changes were made
+func EnsureExitNodeAccess(policy *ACLPolicy, src string) bool {
+	if policy == nil || HasExitNodeAccess(policy, src) {
+		return false
+	}
+
+	// Extend the rule an earlier run added rather than adding one per user
+	for i, rule := range policy.ACLs {
+		if rule.Action == "accept" && rule.Proto == "" && len(rule.Dst) == len(exitNodeAccessDst) && isExitNodeAccessRule(rule) {
+			policy.ACLs[i].Src = append(policy.ACLs[i].Src, src)
+			return true
+		}
+	}
+
+	policy.ACLs = append(policy.ACLs, ACLRule{
+		Action: "accept",
+		Src:    []string{src},
+		Dst:    slices.Clone(exitNodeAccessDst),
+	})
+	return true
+}
+
+// isExitNodeAccessRule reports whether a rule grants everything exitNodeAccessDst does
+func isExitNodeAccessRule(rule ACLRule) bool {
+	if rule.Action != "accept" {
+		return false
+	}
+	for _, dst := range exitNodeAccessDst {
+		if !slices.Contains(rule.Dst, dst) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExitNodeUsers returns the sources of the ACL rules that let them use the exit nodes, sorted
+func ExitNodeUsers(policy *ACLPolicy) []string {
+	if policy == nil {
+		return nil
+	}
+
+	var users []string
+	for _, rule := range policy.ACLs {
+		if isExitNodeAccessRule(rule) {
+			users = append(users, rule.Src...)
+		}
+	}
+	sort.Strings(users)
+	return slices.Compact(users)
+}
+
+// HasAllowAll checks for the default rule that lets everyone reach everything,
+// which makes any narrower rule moot
+func HasAllowAll(policy *ACLPolicy) bool {
+	if policy == nil {
+		return false
+	}
+
+	for _, rule := range policy.ACLs {
+		if rule.Action == "accept" && slices.Contains(rule.Src, "*") && slices.Contains(rule.Dst, "*:*") {
+			return true
+		}
+	}
+	return false
+}
+
+// UndefinedGroups returns the group: entries of users that the policy doesn't define
+func UndefinedGroups(policy *ACLPolicy, users []string) []string {
+	var undefined []string
+	for _, user := range users {
+		if !strings.HasPrefix(user, "group:") {
+			continue
+		}
+		if policy == nil || policy.Groups[user] == nil {
+			undefined = append(undefined, user)
+		}
+	}
+	return undefined
+}
+
+// ConfigureExitNodeAccess adds ACL rules letting users (autogroup:member, a
+// group, a user or a tag) use TSE exit nodes
+// Returns a list of changes made and a boolean indicating if changes were applied
+func ConfigureExitNodeAccess(policy *ACLPolicy, users []string) ([]string, bool) {
+	if policy == nil {
+		return nil, false
+	}
+
+	var changes []string
+	modified := false
+
+	for _, user := range users {
+		if EnsureExitNodeAccess(policy, user) {
+			changes = append(changes, fmt.Sprintf("Added ACL rule letting %s use the exit nodes (%s)", user, strings.Join(exitNodeAccessDst, ", ")))
+			modified = true
+		} else {
+			changes = append(changes, fmt.Sprintf("✓ %s can already use the exit nodes", user))
+		}
+	}
+
+	return changes, modified
+}
+
+// PreviewExitNodeAccess returns a human-readable description of what
+// ConfigureExitNodeAccess would change, and what would keep it from restricting anything
+func PreviewExitNodeAccess(current *ACLPolicy, users []string) []string {
+	var preview []string
+	for _, user := range users {
+		if !HasExitNodeAccess(current, user) {
+			preview = append(preview, fmt.Sprintf("+ Add ACL rule: accept %s -> %s", user, strings.Join(exitNodeAccessDst, ", ")))
+		} else {
+			preview = append(preview, fmt.Sprintf("  %s can already use the exit nodes", user))
+		}
+	}
+	for _, group := range UndefinedGroups(current, users) {
+		preview = append(preview, fmt.Sprintf("! %s isn't defined under groups; the ACL won't validate", group))
+	}
+	if len(users) > 0 && HasAllowAll(current) {
+		preview = append(preview, "! The ACL still has an allow-all rule (* -> *:*), so everyone can use the exit nodes until you remove it")
+	}
+	return preview
+}
+
+// RemoveExitNodeConfig undoes what tse adds to a policy: the exit node access
+// rules, tag:exitnode's auto-approvals for exit nodes and subnet routes, and
+// its tagOwners entry. Rules that grant more than exit node access are left
+// alone, and so is tagOwners while anything else still refers to the tag, as
+// the ACL wouldn't validate without it.
+// Returns a list of changes made and a boolean indicating if changes were applied
+func RemoveExitNodeConfig(policy *ACLPolicy) ([]string, bool) {
+	if policy == nil {
+		return nil, false
+	}
+
+	var changes []string
+	modified := false
+
+	acls := policy.ACLs[:0]
+	for _, rule := range policy.ACLs {
+		if rule.Proto == "" && len(rule.Dst) == len(exitNodeAccessDst) && isExitNodeAccessRule(rule) {
+			changes = append(changes, fmt.Sprintf("Removed ACL rule letting %s use the exit nodes", strings.Join(rule.Src, ", ")))
+			modified = true
+			continue
+		}
+		acls = append(acls, rule)
+	}
+	policy.ACLs = acls
+
+	if approvers := policy.AutoApprovers; approvers != nil {
+		if HasAutoApprover(policy, "tag:exitnode") {
+			approvers.ExitNode = slices.DeleteFunc(approvers.ExitNode, func(a string) bool { return a == "tag:exitnode" })
+			changes = append(changes, "Removed tag:exitnode from exit node auto-approvers")
+			modified = true
+		}
+		for _, route := range RoutesApprovedFor(policy, "tag:exitnode") {
+			approvers.Routes[route] = slices.DeleteFunc(approvers.Routes[route], func(a string) bool { return a == "tag:exitnode" })
+			if len(approvers.Routes[route]) == 0 {
+				delete(approvers.Routes, route)
+			}
+			changes = append(changes, fmt.Sprintf("Removed tag:exitnode from auto-approvers for route %s", route))
+			modified = true
+		}
+	}
+
+	if HasTagOwner(policy, "tag:exitnode") {
+		if referencesTag(policy, "tag:exitnode") {
+			changes = append(changes, "✓ Kept tag:exitnode in tagOwners, other rules still use it")
+		} else {
+			delete(policy.TagOwners, "tag:exitnode")
+			changes = append(changes, "Removed tag:exitnode from tagOwners")
+			modified = true
+		}
+	}
+
+	return changes, modified
+}
+
+// referencesTag reports whether any rule, SSH rule, test or auto-approver
+// still mentions tag, bare or with ports
+func referencesTag(policy *ACLPolicy, tag string) bool {
+	mentions := func(entries []string) bool {
+		return slices.ContainsFunc(entries, func(e string) bool { return e == tag || strings.HasPrefix(e, tag+":") })
+	}
+
+	for _, rule := range policy.ACLs {
+		if mentions(rule.Src) || mentions(rule.Dst) {
+			return true
+		}
+	}
+	for _, rule := range policy.SSH {
+		if mentions(rule.Src) || mentions(rule.Dst) {
+			return true
+		}
+	}
+	for _, test := range policy.Tests {
+		if mentions([]string{test.Src}) || mentions(test.Accept) || mentions(test.Deny) {
+			return true
+		}
+	}
+	for _, owners := range policy.TagOwners {
+		if mentions(owners) {
+			return true
+		}
+	}
+	if policy.AutoApprovers != nil {
+		if mentions(policy.AutoApprovers.ExitNode) {
+			return true
+		}
+		for _, approvers := range policy.AutoApprovers.Routes {
+			if mentions(approvers) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // PreviewChanges returns a human-readable description of what would change
 func PreviewChanges(current *ACLPolicy, owner string) []string {
 	if current == nil {
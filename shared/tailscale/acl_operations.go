@@ -81,6 +81,71 @@ func (c *Client) UpdateACL(ctx context.Context, policy *ACLPolicy, etag string)
 	return nil
 }
 
+// GetACLHuJSON fetches the current ACL policy as the HuJSON text the admin
+// console edits, comments and formatting included, with its ETag. Unlike
+// GetACL, nothing is lost in a round trip, which makes it the form to back up.
+func (c *Client) GetACLHuJSON(ctx context.Context) (policy []byte, etag string, err error) {
+	if err := c.ensureTailnet(ctx); err != nil {
+		return nil, "", err
+	}
+
+	path := fmt.Sprintf("/tailnet/%s/acl", normalizeTailnet(c.tailnet))
+
+	headers := map[string]string{
+		"Accept": "application/hujson",
+	}
+
+	resp, err := c.doRequest(ctx, "GET", path, nil, headers)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get ACL: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := handleResponse(resp, http.StatusOK); err != nil {
+		return nil, "", fmt.Errorf("failed to get ACL: %w", err)
+	}
+
+	policy, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read ACL policy: %w", err)
+	}
+	return policy, resp.Header.Get("ETag"), nil
+}
+
+// UpdateACLHuJSON replaces the ACL policy with HuJSON text, as saved by
+// GetACLHuJSON. Like UpdateACL, a non-empty etag makes it fail with 412 if the
+// policy changed since.
+func (c *Client) UpdateACLHuJSON(ctx context.Context, policy []byte, etag string) error {
+	if err := c.ensureTailnet(ctx); err != nil {
+		return err
+	}
+
+	if len(policy) == 0 {
+		return fmt.Errorf("ACL policy cannot be empty")
+	}
+
+	path := fmt.Sprintf("/tailnet/%s/acl", normalizeTailnet(c.tailnet))
+
+	headers := map[string]string{
+		"Content-Type": "application/hujson",
+	}
+	if etag != "" {
+		headers["If-Match"] = etag
+	}
+
+	resp, err := c.doRequest(ctx, "POST", path, policy, headers)
+	if err != nil {
+		return fmt.Errorf("failed to update ACL: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := handleResponse(resp, http.StatusOK); err != nil {
+		return fmt.Errorf("failed to update ACL: %w", err)
+	}
+
+	return nil
+}
+
 // ValidateACL validates an ACL policy without applying it
 // Returns nil if the ACL is valid, error otherwise
 func (c *Client) ValidateACL(ctx context.Context, policy *ACLPolicy) error {
@@ -0,0 +1,66 @@
+package tailscale
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestACLHuJSONRoundTrip(t *testing.T) {
+	const policy = "// Managed by hand\n{\"tagOwners\": {\"tag:exitnode\": [\"autogroup:admin\"]}}\n"
+	stored, etag := policy, `"v1"`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/tailnet/me@github/acl" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if r.Header.Get("Accept") != "application/hujson" {
+				t.Errorf("GET Accept = %q", r.Header.Get("Accept"))
+			}
+			w.Header().Set("ETag", etag)
+			io.WriteString(w, stored)
+		case http.MethodPost:
+			if r.Header.Get("If-Match") != etag {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				io.WriteString(w, `{"message": "precondition failed"}`)
+				return
+			}
+			if r.Header.Get("Content-Type") != "application/hujson" {
+				t.Errorf("POST Content-Type = %q", r.Header.Get("Content-Type"))
+			}
+			body, _ := io.ReadAll(r.Body)
+			stored, etag = string(body), `"v2"`
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewClient("tskey-api-test")
+	client.baseURL = server.URL
+	client.SetTailnet("me@github")
+
+	got, gotETag, err := client.GetACLHuJSON(context.Background())
+	if err != nil || string(got) != policy || gotETag != `"v1"` {
+		t.Fatalf("GetACLHuJSON() = %q, %q, %v", got, gotETag, err)
+	}
+
+	restored := "// Restored\n{}\n"
+	if err := client.UpdateACLHuJSON(context.Background(), []byte(restored), gotETag); err != nil {
+		t.Fatalf("UpdateACLHuJSON() error = %v", err)
+	}
+	if stored != restored {
+		t.Errorf("server has %q, want the HuJSON sent verbatim", stored)
+	}
+
+	// A stale ETag is a conflict
+	err = client.UpdateACLHuJSON(context.Background(), []byte(restored), gotETag)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.IsConflict() {
+		t.Errorf("UpdateACLHuJSON() with a stale ETag error = %v, want a conflict", err)
+	}
+}
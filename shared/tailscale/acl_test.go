@@ -1,6 +1,7 @@
 package tailscale
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -317,3 +318,120 @@ func TestHasAutoApprover(t *testing.T) {
 		t.Error("HasAutoApprover() should return false for policy with nil AutoApprovers")
 	}
 }
+
+func TestConfigureRouteApprovers(t *testing.T) {
+	policy := &ACLPolicy{
+		AutoApprovers: &AutoApprovers{
+			ExitNode: []string{"tag:exitnode"},
+			Routes:   map[string][]string{"192.168.10.0/24": {"group:admins"}},
+		},
+	}
+
+	changes, modified := ConfigureRouteApprovers(policy, []string{"10.0.0.0/16", "192.168.10.0/24"})
+	if !modified || len(changes) != 2 {
+		t.Fatalf("ConfigureRouteApprovers() = %v, %v; want two changes", changes, modified)
+	}
+	if got := policy.AutoApprovers.Routes["192.168.10.0/24"]; len(got) != 2 || got[0] != "group:admins" {
+		t.Errorf("existing approvers = %v, want group:admins kept and tag:exitnode added", got)
+	}
+	if got := RoutesApprovedFor(policy, "tag:exitnode"); len(got) != 2 || got[0] != "10.0.0.0/16" {
+		t.Errorf("RoutesApprovedFor() = %v, want both routes", got)
+	}
+
+	// Running it again changes nothing
+	if _, modified := ConfigureRouteApprovers(policy, []string{"10.0.0.0/16"}); modified {
+		t.Error("ConfigureRouteApprovers() modified an already configured policy")
+	}
+	if preview := PreviewRouteApprovers(policy, []string{"10.0.0.0/16", "172.16.0.0/12"}); len(preview) != 2 || preview[1][0] != '+' {
+		t.Errorf("PreviewRouteApprovers() = %v, want only 172.16.0.0/12 added", preview)
+	}
+
+	if HasRouteApprover(nil, "10.0.0.0/16", "tag:exitnode") {
+		t.Error("HasRouteApprover() should return false for nil policy")
+	}
+}
+
+func TestConfigureExitNodeAccess(t *testing.T) {
+	policy := &ACLPolicy{
+		Groups: map[string][]string{"group:travel": {"alice@example.com"}},
+		ACLs:   []ACLRule{{Action: "accept", Src: []string{"group:admins"}, Dst: []string{"tag:server:22"}}},
+	}
+
+	changes, modified := ConfigureExitNodeAccess(policy, []string{"autogroup:member", "group:travel"})
+	if !modified || len(changes) != 2 {
+		t.Fatalf("ConfigureExitNodeAccess() = %v, %v; want two changes", changes, modified)
+	}
+	if len(policy.ACLs) != 2 {
+		t.Fatalf("ACLs = %+v, want the existing rule plus one for the exit nodes", policy.ACLs)
+	}
+	rule := policy.ACLs[1]
+	if rule.Action != "accept" || len(rule.Src) != 2 || len(rule.Dst) != 2 || rule.Dst[0] != "tag:exitnode:*" || rule.Dst[1] != "autogroup:internet:*" {
+		t.Errorf("added rule = %+v", rule)
+	}
+	if got := ExitNodeUsers(policy); len(got) != 2 || got[0] != "autogroup:member" {
+		t.Errorf("ExitNodeUsers() = %v, want both sources", got)
+	}
+
+	// Running it again changes nothing
+	if _, modified := ConfigureExitNodeAccess(policy, []string{"group:travel"}); modified {
+		t.Error("ConfigureExitNodeAccess() modified an already configured policy")
+	}
+	preview := PreviewExitNodeAccess(policy, []string{"group:travel", "group:missing"})
+	if len(preview) != 3 || preview[0][0] != ' ' || preview[1][0] != '+' || !strings.Contains(preview[2], "group:missing") {
+		t.Errorf("PreviewExitNodeAccess() = %v, want group:missing added and flagged undefined", preview)
+	}
+
+	if HasExitNodeAccess(nil, "autogroup:member") {
+		t.Error("HasExitNodeAccess() should return false for nil policy")
+	}
+}
+
+func TestRemoveExitNodeConfig(t *testing.T) {
+	policy := &ACLPolicy{
+		TagOwners: map[string][]string{"tag:exitnode": {"alice@example.com"}, "tag:server": {"autogroup:admin"}},
+		ACLs:      []ACLRule{{Action: "accept", Src: []string{"group:admins"}, Dst: []string{"tag:server:22"}}},
+	}
+	ConfigureForExitNodes(policy, "alice@example.com")
+	ConfigureRouteApprovers(policy, []string{"10.0.0.0/16"})
+	ConfigureExitNodeAccess(policy, []string{"autogroup:member"})
+
+	changes, modified := RemoveExitNodeConfig(policy)
+	if !modified || len(changes) != 4 {
+		t.Fatalf("RemoveExitNodeConfig() = %v, %v; want four changes", changes, modified)
+	}
+	if HasTagOwner(policy, "tag:exitnode") || HasAutoApprover(policy, "tag:exitnode") || len(RoutesApprovedFor(policy, "tag:exitnode")) != 0 {
+		t.Errorf("policy still configured for exit nodes: %+v", policy)
+	}
+	if len(policy.ACLs) != 1 || policy.ACLs[0].Dst[0] != "tag:server:22" || !HasTagOwner(policy, "tag:server") {
+		t.Errorf("RemoveExitNodeConfig() touched unrelated entries: %+v", policy)
+	}
+	if _, modified := RemoveExitNodeConfig(policy); modified {
+		t.Error("RemoveExitNodeConfig() modified an already clean policy")
+	}
+
+	// A hand-written rule that also reaches other places keeps the tag defined
+	policy = &ACLPolicy{
+		TagOwners: map[string][]string{"tag:exitnode": {"autogroup:admin"}},
+		ACLs:      []ACLRule{{Action: "accept", Src: []string{"group:ops"}, Dst: []string{"tag:exitnode:*", "autogroup:internet:*", "tag:server:*"}}},
+	}
+	if _, modified := RemoveExitNodeConfig(policy); modified || !HasTagOwner(policy, "tag:exitnode") || len(policy.ACLs) != 1 {
+		t.Errorf("RemoveExitNodeConfig() = %+v, want the broader rule and its tag kept", policy)
+	}
+}
+
+func TestHasAllowAll(t *testing.T) {
+	policy := &ACLPolicy{ACLs: []ACLRule{{Action: "accept", Src: []string{"*"}, Dst: []string{"*:*"}}}}
+	if !HasAllowAll(policy) {
+		t.Error("HasAllowAll() = false for the default policy")
+	}
+	if preview := PreviewExitNodeAccess(policy, []string{"autogroup:member"}); len(preview) != 2 || preview[1][0] != '!' {
+		t.Errorf("PreviewExitNodeAccess() = %v, want a warning about the allow-all rule", preview)
+	}
+	// The allow-all rule doesn't count as a tse-managed one
+	if got := ExitNodeUsers(policy); len(got) != 0 {
+		t.Errorf("ExitNodeUsers() = %v, want none", got)
+	}
+	if HasAllowAll(&ACLPolicy{}) {
+		t.Error("HasAllowAll() = true for an empty policy")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 )
 
 // AuthKeyRequest represents a request to create a new auth key
@@ -72,6 +73,10 @@ func (c *Client) CreateAuthKey(ctx context.Context, req *AuthKeyRequest) (*AuthK
 	return &authKey, nil
 }
 
+// ExitNodeAuthKeyDescription marks the auth keys tse creates, so they can be
+// told apart from the tailnet's other keys when it's time to revoke them
+const ExitNodeAuthKeyDescription = "TSE ephemeral exit node auth key"
+
 // NewExitNodeAuthKeyRequest creates an auth key request configured for exit nodes
 func NewExitNodeAuthKeyRequest() *AuthKeyRequest {
 	return &AuthKeyRequest{
@@ -86,6 +91,85 @@ func NewExitNodeAuthKeyRequest() *AuthKeyRequest {
 			},
 		},
 		ExpirySeconds: 0, // Never expire
-		Description:   "TSE ephemeral exit node auth key",
+		Description:   ExitNodeAuthKeyDescription,
+	}
+}
+
+// keysResponse is the body of the list keys endpoint
+type keysResponse struct {
+	Keys []AuthKeyResponse `json:"keys"`
+}
+
+// ListAuthKeys returns the tailnet's active keys. Depending on the token,
+// entries may carry only an ID; GetAuthKey fills in the rest.
+func (c *Client) ListAuthKeys(ctx context.Context) ([]AuthKeyResponse, error) {
+	if err := c.ensureTailnet(ctx); err != nil {
+		return nil, err
 	}
+
+	path := fmt.Sprintf("/tailnet/%s/keys", normalizeTailnet(c.tailnet))
+
+	resp, err := c.doRequest(ctx, "GET", path, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list auth keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := handleResponse(resp, http.StatusOK); err != nil {
+		return nil, fmt.Errorf("failed to list auth keys: %w", err)
+	}
+
+	var keys keysResponse
+	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+		return nil, fmt.Errorf("failed to parse auth keys response: %w", err)
+	}
+
+	return keys.Keys, nil
+}
+
+// GetAuthKey returns one key's details. The secret itself is never included.
+func (c *Client) GetAuthKey(ctx context.Context, id string) (*AuthKeyResponse, error) {
+	if err := c.ensureTailnet(ctx); err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("/tailnet/%s/keys/%s", normalizeTailnet(c.tailnet), url.PathEscape(id))
+
+	resp, err := c.doRequest(ctx, "GET", path, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auth key %s: %w", id, err)
+	}
+	defer resp.Body.Close()
+
+	if err := handleResponse(resp, http.StatusOK); err != nil {
+		return nil, fmt.Errorf("failed to get auth key %s: %w", id, err)
+	}
+
+	var authKey AuthKeyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authKey); err != nil {
+		return nil, fmt.Errorf("failed to parse auth key response: %w", err)
+	}
+
+	return &authKey, nil
+}
+
+// DeleteAuthKey revokes a key. Devices already joined with it stay joined.
+func (c *Client) DeleteAuthKey(ctx context.Context, id string) error {
+	if err := c.ensureTailnet(ctx); err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/tailnet/%s/keys/%s", normalizeTailnet(c.tailnet), url.PathEscape(id))
+
+	resp, err := c.doRequest(ctx, "DELETE", path, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to revoke auth key %s: %w", id, err)
+	}
+	defer resp.Body.Close()
+
+	if err := handleResponse(resp, http.StatusOK); err != nil {
+		return fmt.Errorf("failed to revoke auth key %s: %w", id, err)
+	}
+
+	return nil
 }
@@ -0,0 +1,51 @@
+package tailscale
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthKeyLifecycle(t *testing.T) {
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v2/tailnet/me@github/keys":
+			io.WriteString(w, `{"keys": [{"id": "k1"}, {"id": "k2"}]}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v2/tailnet/me@github/keys/k1":
+			io.WriteString(w, `{"id": "k1", "description": "TSE ephemeral exit node auth key"}`)
+		case r.Method == http.MethodDelete && r.URL.Path == "/api/v2/tailnet/me@github/keys/k1":
+			deleted = append(deleted, "k1")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message": "not found"}`)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewClient("tskey-api-test")
+	client.baseURL = server.URL
+	client.SetTailnet("me@github")
+	ctx := context.Background()
+
+	keys, err := client.ListAuthKeys(ctx)
+	if err != nil || len(keys) != 2 || keys[0].ID != "k1" {
+		t.Fatalf("ListAuthKeys() = %+v, %v", keys, err)
+	}
+	key, err := client.GetAuthKey(ctx, "k1")
+	if err != nil || key.Description != ExitNodeAuthKeyDescription {
+		t.Fatalf("GetAuthKey() = %+v, %v", key, err)
+	}
+	if err := client.DeleteAuthKey(ctx, "k1"); err != nil || len(deleted) != 1 {
+		t.Fatalf("DeleteAuthKey() error = %v, deleted %v", err, deleted)
+	}
+
+	var apiErr *APIError
+	err = client.DeleteAuthKey(ctx, "gone")
+	if !errors.As(err, &apiErr) || !apiErr.IsNotFound() {
+		t.Errorf("DeleteAuthKey() of a missing key error = %v, want not found", err)
+	}
+}
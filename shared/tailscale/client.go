@@ -55,7 +55,12 @@ func (c *Client) GetTailnet() string {
 // doRequest performs an HTTP request with proper authentication
 func (c *Client) doRequest(ctx context.Context, method, path string, body interface{}, headers map[string]string) (*http.Response, error) {
 	var bodyReader io.Reader
-	if body != nil {
+	switch body := body.(type) {
+	case nil:
+	case []byte:
+		// Already encoded, e.g. a HuJSON policy; the caller sets Content-Type
+		bodyReader = bytes.NewReader(body)
+	default:
 		jsonBody, err := json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request body: %w", err)
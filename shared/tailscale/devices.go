@@ -0,0 +1,154 @@
+package tailscale
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Device represents a device (node) in the tailnet
+type Device struct {
+	ID                 string              `json:"id"`
+	NodeID             string              `json:"nodeId"`
+	Name               string              `json:"name"`     // Full MagicDNS name (e.g., exit-ohio.tail1234.ts.net)
+	Hostname           string              `json:"hostname"` // Machine hostname as reported by the OS
+	Addresses          []string            `json:"addresses"`
+	Tags               []string            `json:"tags,omitempty"`
+	LastSeen           string              `json:"lastSeen,omitempty"`
+	ClientConnectivity *ClientConnectivity `json:"clientConnectivity,omitempty"`
+}
+
+// ClientConnectivity describes how a device is reachable (only returned with fields=all)
+type ClientConnectivity struct {
+	Endpoints []string `json:"endpoints"`
+}
+
+// devicesResponse is the envelope returned by the devices list endpoint
+type devicesResponse struct {
+	Devices []Device `json:"devices"`
+}
+
+// ListDevices returns all devices in the tailnet, including connectivity details
+func (c *Client) ListDevices(ctx context.Context) ([]Device, error) {
+	if err := c.ensureTailnet(ctx); err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("/tailnet/%s/devices?fields=all", normalizeTailnet(c.tailnet))
+
+	resp, err := c.doRequest(ctx, "GET", path, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := handleResponse(resp, http.StatusOK); err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	var devices devicesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil {
+		return nil, fmt.Errorf("failed to parse devices response: %w", err)
+	}
+
+	return devices.Devices, nil
+}
+
+// ShortName returns the device's tailnet hostname without the MagicDNS suffix
+func (d Device) ShortName() string {
+	if d.Name == "" {
+		return d.Hostname
+	}
+	return strings.SplitN(d.Name, ".", 2)[0]
+}
+
+// MatchesHostname reports whether the device's tailnet name or OS hostname matches
+// the given glob pattern (e.g., "exit-*")
+func (d Device) MatchesHostname(pattern string) bool {
+	for _, name := range []string{d.ShortName(), d.Hostname} {
+		if name == "" {
+			continue
+		}
+		if ok, _ := path.Match(pattern, strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PublicIPs returns the public IPv4 addresses the device was last seen connecting from.
+// Private, loopback, and Tailscale CGNAT addresses are excluded.
+func (d Device) PublicIPs() []string {
+	if d.ClientConnectivity == nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var ips []string
+	for _, endpoint := range d.ClientConnectivity.Endpoints {
+		host, _, err := net.SplitHostPort(endpoint)
+		if err != nil {
+			host = endpoint
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || ip.To4() == nil {
+			continue
+		}
+		if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || isTailscaleCGNAT(ip) {
+			continue
+		}
+		if !seen[host] {
+			seen[host] = true
+			ips = append(ips, host)
+		}
+	}
+	return ips
+}
+
+// tailscaleCGNAT is the 100.64.0.0/10 range Tailscale assigns tailnet addresses from
+var tailscaleCGNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isTailscaleCGNAT(ip net.IP) bool {
+	return tailscaleCGNAT.Contains(ip)
+}
+
+// TailnetIPs returns the device's Tailscale addresses: the 100.x IPv4 and the
+// fd7a: IPv6 (either may be empty)
+func (d Device) TailnetIPs() (ipv4, ipv6 string) {
+	for _, address := range d.Addresses {
+		ip := net.ParseIP(strings.SplitN(address, "/", 2)[0])
+		if ip == nil {
+			continue
+		}
+		if ip.To4() != nil {
+			if ipv4 == "" {
+				ipv4 = ip.String()
+			}
+		} else if ipv6 == "" {
+			ipv6 = ip.String()
+		}
+	}
+	return ipv4, ipv6
+}
+
+// DisableKeyExpiry turns off key expiry for a device, so it stays on the
+// tailnet past the tailnet's key expiry window. deviceID is the device's ID or
+// node ID.
+func (c *Client) DisableKeyExpiry(ctx context.Context, deviceID string) error {
+	body := map[string]bool{"keyExpiryDisabled": true}
+	resp, err := c.doRequest(ctx, "POST", fmt.Sprintf("/device/%s/key", url.PathEscape(deviceID)), body, nil)
+	if err != nil {
+		return fmt.Errorf("failed to disable key expiry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := handleResponse(resp, http.StatusOK); err != nil {
+		return fmt.Errorf("failed to disable key expiry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package tailscale
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDevicePublicIPs(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints []string
+		want      []string
+	}{
+		{
+			name:      "public and private endpoints",
+			endpoints: []string{"3.15.20.1:41641", "10.0.1.25:41641", "[2600:1f16::1]:41641"},
+			want:      []string{"3.15.20.1"},
+		},
+		{
+			name:      "tailscale CGNAT excluded",
+			endpoints: []string{"100.101.102.103:41641", "18.222.1.2:1234"},
+			want:      []string{"18.222.1.2"},
+		},
+		{
+			name:      "duplicates collapsed",
+			endpoints: []string{"18.222.1.2:41641", "18.222.1.2:1234"},
+			want:      []string{"18.222.1.2"},
+		},
+		{
+			name:      "no endpoints",
+			endpoints: nil,
+			want:      nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Device{ClientConnectivity: &ClientConnectivity{Endpoints: tt.endpoints}}
+			got := d.PublicIPs()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PublicIPs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeviceMatchesHostname(t *testing.T) {
+	tests := []struct {
+		name    string
+		device  Device
+		pattern string
+		want    bool
+	}{
+		{"MagicDNS name matches", Device{Name: "exit-ohio.tail1234.ts.net"}, "exit-*", true},
+		{"OS hostname matches", Device{Name: "laptop.tail1234.ts.net", Hostname: "exit-manual"}, "exit-*", true},
+		{"case insensitive", Device{Name: "Exit-Tokyo.tail1234.ts.net"}, "exit-*", true},
+		{"no match", Device{Name: "laptop.tail1234.ts.net", Hostname: "laptop"}, "exit-*", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.device.MatchesHostname(tt.pattern); got != tt.want {
+				t.Errorf("MatchesHostname(%q) = %v, want %v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeviceTailnetIPs(t *testing.T) {
+	tests := []struct {
+		name      string
+		addresses []string
+		wantIPv4  string
+		wantIPv6  string
+	}{
+		{
+			name:      "both families",
+			addresses: []string{"100.101.102.103", "fd7a:115c:a1e0::1234:5678"},
+			wantIPv4:  "100.101.102.103",
+			wantIPv6:  "fd7a:115c:a1e0::1234:5678",
+		},
+		{
+			name:      "CIDR suffixes stripped",
+			addresses: []string{"fd7a:115c:a1e0::1/128", "100.64.0.1/32"},
+			wantIPv4:  "100.64.0.1",
+			wantIPv6:  "fd7a:115c:a1e0::1",
+		},
+		{
+			name:      "no addresses",
+			addresses: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipv4, ipv6 := Device{Addresses: tt.addresses}.TailnetIPs()
+			if ipv4 != tt.wantIPv4 || ipv6 != tt.wantIPv6 {
+				t.Errorf("TailnetIPs() = %q, %q, want %q, %q", ipv4, ipv6, tt.wantIPv4, tt.wantIPv6)
+			}
+		})
+	}
+}
+
+func TestDisableKeyExpiry(t *testing.T) {
+	var gotPath, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotPath, gotBody = r.Method+" "+r.URL.Path, string(body)
+		if r.URL.Path == "/api/v2/device/gone/key" {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message": "not found"}`)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewClient("tskey-api-test")
+	client.baseURL = server.URL
+
+	if err := client.DisableKeyExpiry(context.Background(), "n123"); err != nil {
+		t.Fatalf("DisableKeyExpiry() error = %v", err)
+	}
+	if gotPath != "POST /api/v2/device/n123/key" || gotBody != `{"keyExpiryDisabled":true}` {
+		t.Errorf("request = %s %s", gotPath, gotBody)
+	}
+
+	err := client.DisableKeyExpiry(context.Background(), "gone")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.IsNotFound() {
+		t.Errorf("DisableKeyExpiry(gone) error = %v, want a not-found APIError", err)
+	}
+}
@@ -0,0 +1,63 @@
+// Package telegram holds what the CLI and the Lambda share about the optional
+// Telegram bot: its configuration and the secret Telegram sends with each
+// webhook call. tse deploy registers the webhook; the Lambda answers commands.
+package telegram
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// EnvBotToken is the token @BotFather gives the bot
+	EnvBotToken = "TSE_TELEGRAM_BOT_TOKEN"
+
+	// EnvChatIDs lists the chats allowed to control exit nodes, comma-separated
+	EnvChatIDs = "TSE_TELEGRAM_CHAT_IDS"
+
+	// SecretHeader carries the webhook secret on every update Telegram posts
+	SecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+)
+
+// botTokenPattern matches @BotFather's tokens, e.g. "123456789:AAE..."
+var botTokenPattern = regexp.MustCompile(`^[0-9]+:[A-Za-z0-9_-]{30,}$`)
+
+// ValidBotToken reports whether token looks like a bot token
+func ValidBotToken(token string) bool {
+	return botTokenPattern.MatchString(token)
+}
+
+// ParseChatIDs parses a comma-separated list of chat IDs. Group chats have
+// negative IDs.
+func ParseChatIDs(list string) ([]int64, error) {
+	var ids []int64
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("%s: %q is not a chat ID", EnvChatIDs, field)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%s lists no chats", EnvChatIDs)
+	}
+	return ids, nil
+}
+
+// WebhookSecret derives the webhook's secret from the deployment's auth token,
+// so deploy and the Lambda agree on it without storing another secret, and
+// knowing the bot token alone isn't enough to post fake commands
+func WebhookSecret(authToken string) string {
+	mac := hmac.New(sha256.New, []byte(authToken))
+	mac.Write([]byte("tse-telegram-webhook"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,54 @@
+package telegram
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseChatIDs(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []int64
+		wantErr bool
+	}{
+		{list: "12345", want: []int64{12345}},
+		{list: "12345, -1001234567890", want: []int64{12345, -1001234567890}},
+		{list: "", wantErr: true},
+		{list: "@me", wantErr: true},
+		{list: "0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			got, err := ParseChatIDs(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseChatIDs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseChatIDs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidBotToken(t *testing.T) {
+	if !ValidBotToken("123456789:AAEhBP0av28vAbCdEfGhIjKlMnOpQrStUvW") {
+		t.Error("ValidBotToken() = false for a @BotFather token")
+	}
+	for _, token := range []string{"", "123456789", "bot:AAEhBP0av28vAbCdEfGhIjKlMnOpQrStUvW", "123:short"} {
+		if ValidBotToken(token) {
+			t.Errorf("ValidBotToken(%q) = true", token)
+		}
+	}
+}
+
+func TestWebhookSecret(t *testing.T) {
+	secret := WebhookSecret("token-a")
+	if secret != WebhookSecret("token-a") || secret == WebhookSecret("token-b") {
+		t.Error("WebhookSecret() should be stable for a token and differ between tokens")
+	}
+	// Telegram accepts 1-256 characters of A-Z, a-z, 0-9, _ and -
+	if len(secret) > 256 {
+		t.Errorf("WebhookSecret() is %d characters", len(secret))
+	}
+}
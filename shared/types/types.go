@@ -1,6 +1,14 @@
 package types
 
-import "time"
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+)
 
 // InstanceInfo represents information about a running exit node instance
 type InstanceInfo struct {
@@ -12,24 +20,109 @@ type InstanceInfo struct {
 	PrivateIP         string    `json:"private_ip,omitempty"`
 	LaunchTime        time.Time `json:"launch_time"`
 	InstanceType      string    `json:"instance_type"`
+	Architecture      string    `json:"architecture,omitempty"` // arm64, or x86_64 when t4g capacity ran out
+	ImageID           string    `json:"image_id,omitempty"`     // AMI the node launched from
 	TailscaleHostname string    `json:"tailscale_hostname,omitempty"`
+	TailscaleIP       string    `json:"tailscale_ip,omitempty"`   // Tailnet IPv4 (100.x), reported by the node once ready
+	TailscaleIPv6     string    `json:"tailscale_ipv6,omitempty"` // Tailnet IPv6 (fd7a:...)
+	Ready             bool      `json:"ready"`                    // Tailscale is up and forwarding works
+	// Capacity reservation the instance was launched into, if any
+	CapacityReservationID string `json:"capacity_reservation_id,omitempty"`
+	// Idempotency token of the start request that launched it, if it sent one
+	ClientToken string `json:"client_token,omitempty"`
+	// Bytes sent since launch (CloudWatch NetworkOut, a few minutes behind)
+	NetworkOutBytes int64 `json:"network_out_bytes,omitempty"`
+	// Multihop role and peer region, e.g. "entry:frankfurt"; see HopConfig
+	Hop string `json:"hop,omitempty"`
+	// Name and ID of the token that started it; empty for nodes started
+	// before tse recorded who started them
+	StartedBy   string `json:"started_by,omitempty"`
+	StartedByID string `json:"started_by_id,omitempty"`
 }
 
 // StartRequest represents a request to start an exit node
 type StartRequest struct {
 	Region string `json:"region"`
+	DryRun bool   `json:"dry_run,omitempty"` // Run the checks (auth, region, existing nodes) without launching
+	// With DryRun, also look up what the start would use and describe the EC2
+	// calls it would make (StartResponse.Plan). Costs a few EC2 reads.
+	Plan bool `json:"plan,omitempty"`
+	// Idempotency token chosen by the client. A start retried with the same token
+	// returns the node the first one launched instead of launching another.
+	ClientToken string `json:"client_token,omitempty"`
+	// Resolver the node uses instead of the VPC's, e.g. "mullvad" or a Pi-hole's
+	// tailnet IP; see shared/dns for the accepted values
+	DNS string `json:"dns,omitempty"`
+	// Subnet routes the node advertises besides being an exit node, e.g.
+	// "10.0.0.0/16" for its VPC; see shared/routes
+	AdvertiseRoutes []string `json:"advertise_routes,omitempty"`
+	// Makes the node one end of a multihop pair (experimental)
+	Hop *HopConfig `json:"hop,omitempty"`
+	// Answer 202 with a job right away, which finishes once the node reports
+	// ready (or fails to); poll it at GET /jobs/{id}
+	Async bool `json:"async,omitempty"`
+}
+
+// Multihop roles
+const (
+	HopEntry = "entry" // Clients connect here; their traffic goes on through the tunnel
+	HopExit  = "exit"  // The tunnel ends here, and traffic leaves with this node's IP
+)
+
+// HopPort is the UDP port the exit node of a multihop pair listens on
+const HopPort = 51820
+
+// HopConfig makes a node one end of a WireGuard tunnel between two exit nodes
+// ('tse multihop'), so clients connect in one region and appear in another
+type HopConfig struct {
+	Role          string `json:"role"`               // HopEntry or HopExit
+	PeerRegion    string `json:"peer_region"`        // Region of the other node
+	PrivateKey    string `json:"private_key"`        // This node's WireGuard key, base64
+	PeerPublicKey string `json:"peer_public_key"`    // The other node's, base64
+	Endpoint      string `json:"endpoint,omitempty"` // Exit node's public ip:port; entry only
+}
+
+// Validate checks the keys and, for an entry node, the endpoint
+func (h *HopConfig) Validate() error {
+	switch h.Role {
+	case HopEntry:
+		if _, err := netip.ParseAddrPort(h.Endpoint); err != nil {
+			return fmt.Errorf("invalid endpoint %q: want the exit node's ip:port", h.Endpoint)
+		}
+	case HopExit:
+		if h.Endpoint != "" {
+			return fmt.Errorf("an exit node takes no endpoint")
+		}
+	default:
+		return fmt.Errorf("invalid role %q (valid: %s, %s)", h.Role, HopEntry, HopExit)
+	}
+	if h.PeerRegion == "" {
+		return fmt.Errorf("peer_region is required")
+	}
+	for name, key := range map[string]string{"private_key": h.PrivateKey, "peer_public_key": h.PeerPublicKey} {
+		if raw, err := base64.StdEncoding.DecodeString(key); err != nil || len(raw) != 32 {
+			return fmt.Errorf("%s must be a base64 WireGuard key", name)
+		}
+	}
+	return nil
 }
 
 // StartResponse represents the response from starting an exit node
 type StartResponse struct {
-	Success  bool          `json:"success"`
-	Message  string        `json:"message"`
-	Instance *InstanceInfo `json:"instance,omitempty"`
+	Success     bool          `json:"success"`
+	Message     string        `json:"message"`
+	Instance    *InstanceInfo `json:"instance,omitempty"`
+	ClientToken string        `json:"client_token,omitempty"` // Echoed from the request
+	Replayed    bool          `json:"replayed,omitempty"`     // An earlier request with this token launched Instance
+	Plan        []string      `json:"plan,omitempty"`         // Dry runs asked for a plan: the EC2 calls, one per line
 }
 
 // StopRequest represents a request to stop exit nodes in a region
 type StopRequest struct {
 	Region string `json:"region"`
+	// Answer 202 with a job right away, which finishes once the nodes are
+	// terminated and their VPC is removed; poll it at GET /jobs/{id}
+	Async bool `json:"async,omitempty"`
 }
 
 // StopResponse represents the response from stopping exit nodes
@@ -38,6 +131,28 @@ type StopResponse struct {
 	Message         string   `json:"message"`
 	TerminatedCount int      `json:"terminated_count"`
 	TerminatedIDs   []string `json:"terminated_ids,omitempty"`
+	SkippedIDs      []string `json:"skipped_ids,omitempty"` // Cleanup only: resources too new to delete without force
+	// Bytes the terminated instances sent over their lifetime, as far as CloudWatch had it
+	NetworkOutBytes int64 `json:"network_out_bytes,omitempty"`
+}
+
+// PauseResponse represents the response from pausing (stopping without
+// terminating) or resuming exit nodes
+type PauseResponse struct {
+	Success     bool     `json:"success"`
+	Message     string   `json:"message"`
+	InstanceIDs []string `json:"instance_ids,omitempty"`
+}
+
+// RestartResponse represents the response from replacing a region's exit
+// node with a new one. The request is a StartRequest for the replacement.
+type RestartResponse struct {
+	Success       bool          `json:"success"`
+	Message       string        `json:"message"`
+	TerminatedIDs []string      `json:"terminated_ids,omitempty"` // The nodes it replaced
+	Instance      *InstanceInfo `json:"instance,omitempty"`       // The replacement
+	ClientToken   string        `json:"client_token,omitempty"`   // Echoed from the request
+	Replayed      bool          `json:"replayed,omitempty"`       // An earlier request with this token launched Instance
 }
 
 // InstancesRequest represents a request to list instances in a region
@@ -51,18 +166,417 @@ type InstancesResponse struct {
 	Message   string          `json:"message"`
 	Instances []*InstanceInfo `json:"instances"`
 	Count     int             `json:"count"`
+	Anomalies []Anomaly       `json:"anomalies,omitempty"` // Nodes tse would never have launched
+
+	// For every region (GET /instances): the regions asked, which the node
+	// registry narrows to those with nodes, and those that failed
+	Regions       []string `json:"regions,omitempty"`
+	FailedRegions []string `json:"failed_regions,omitempty"`
+}
+
+// Anomaly describes a node that differs from anything tse launches, a sign of
+// tampering or a bug creating resources it shouldn't
+type Anomaly struct {
+	InstanceID string `json:"instance_id"`
+	Resource   string `json:"resource"` // The instance, image or security group at fault
+	Check      string `json:"check"`    // "instance-type", "ami-owner" or "ingress"
+	Detail     string `json:"detail"`
+}
+
+// CleanupRequest represents a request to force-clean TSE resources
+type CleanupRequest struct {
+	DryRun         bool `json:"dry_run,omitempty"`
+	Force          bool `json:"force,omitempty"`           // Also delete VPC stacks and security groups created in the last few minutes
+	AllDeployments bool `json:"all_deployments,omitempty"` // Also clean up other deployments' resources in the account
+	// Answer 202 with a job to poll instead of waiting for the cleanup. Lambdas
+	// without the state table answer 501; ones from before jobs clean up as usual.
+	Async bool `json:"async,omitempty"`
+}
+
+// AllDeploymentsParam is the query parameter (set to "true") that has listing
+// instances and cancelling reservations cover every deployment in the account,
+// not just the Lambda's own
+const AllDeploymentsParam = "all_deployments"
+
+// SummarizeResources counts "Type:id" resource entries by type
+func SummarizeResources(resources []string) map[string]int {
+	summary := make(map[string]int)
+	for _, resource := range resources {
+		kind, _, found := strings.Cut(resource, ":")
+		if !found {
+			kind = "Other"
+		}
+		summary[kind]++
+	}
+	return summary
+}
+
+// AdoptCandidate identifies a Tailscale exit node that may be running on an untagged instance
+type AdoptCandidate struct {
+	Hostname  string   `json:"hostname"`
+	PublicIPs []string `json:"public_ips"`
+}
+
+// AdoptRequest represents a request to bring manually-launched exit nodes under management
+type AdoptRequest struct {
+	Candidates []AdoptCandidate `json:"candidates"`
+	DryRun     bool             `json:"dry_run,omitempty"`
+}
+
+// AdoptResponse represents the response from adopting exit node instances
+type AdoptResponse struct {
+	Success   bool            `json:"success"`
+	Message   string          `json:"message"`
+	Adopted   []*InstanceInfo `json:"adopted"`
+	Unmatched []string        `json:"unmatched,omitempty"` // Candidate hostnames with no matching instance
+	DryRun    bool            `json:"dry_run,omitempty"`
+}
+
+// ReservationInfo describes an on-demand capacity reservation held for exit nodes
+type ReservationInfo struct {
+	ReservationID      string    `json:"reservation_id"`
+	Region             string    `json:"region"`
+	FriendlyRegion     string    `json:"friendly_region"`
+	AvailabilityZone   string    `json:"availability_zone"`
+	InstanceType       string    `json:"instance_type"`
+	State              string    `json:"state"`
+	TotalInstances     int       `json:"total_instances"`
+	AvailableInstances int       `json:"available_instances"` // Reserved slots not currently used by a node
+	CreateTime         time.Time `json:"create_time"`
+}
+
+// ReservationResponse represents the response from showing, creating, or
+// cancelling a region's capacity reservation. Reservation is nil when there isn't one.
+type ReservationResponse struct {
+	Success     bool             `json:"success"`
+	Message     string           `json:"message"`
+	Reservation *ReservationInfo `json:"reservation,omitempty"`
+}
+
+// NetworkInfo describes a region's VPC stack. A persistent one stays when the
+// region's nodes stop, so the next start skips building it.
+type NetworkInfo struct {
+	VPCID          string `json:"vpc_id"`
+	SubnetID       string `json:"subnet_id,omitempty"`
+	Region         string `json:"region"`
+	FriendlyRegion string `json:"friendly_region"`
+	Persistent     bool   `json:"persistent"`
+}
+
+// NetworkResponse represents the response from showing, keeping or releasing a
+// region's networking. Network is nil when the region has no VPC stack, and
+// Removed says a release deleted it rather than leaving it for the next stop.
+type NetworkResponse struct {
+	Success bool         `json:"success"`
+	Message string       `json:"message"`
+	Network *NetworkInfo `json:"network,omitempty"`
+	Removed bool         `json:"removed,omitempty"`
+}
+
+// Token scopes grant access to groups of Lambda routes. The deployment's
+// TSE_AUTH_TOKEN implicitly holds every scope.
+const (
+	ScopeRead    = "read"    // List instances
+	ScopeStart   = "start"   // Start exit nodes
+	ScopeStop    = "stop"    // Stop exit nodes
+	ScopeCleanup = "cleanup" // Force-clean orphaned resources
+	ScopeAdmin   = "admin"   // Manage tokens, adopt instances, and reserve capacity
+)
+
+// AllScopes lists every valid token scope
+var AllScopes = []string{ScopeRead, ScopeStart, ScopeStop, ScopeCleanup, ScopeAdmin}
+
+// IsValidScope reports whether scope is a known token scope
+func IsValidScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenInfo describes an issued API token. The secret itself is never stored or returned
+// after creation; only its hash is kept.
+type TokenInfo struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	RevokedAt time.Time `json:"revoked_at,omitzero"`
+	TokenLimits
+}
+
+// TokenLimits cap what a token's starts may launch, for sharing a deployment
+// with a partner or a small team. The zero value limits nothing.
+type TokenLimits struct {
+	MaxNodes int      `json:"max_nodes,omitempty"` // Exit nodes the token's starts may have at once
+	Regions  []string `json:"regions,omitempty"`   // Regions its starts may use; empty allows every region
+}
+
+// AllowsRegion reports whether the limits let a start use friendlyRegion
+func (l TokenLimits) AllowsRegion(friendlyRegion string) bool {
+	return len(l.Regions) == 0 || slices.Contains(l.Regions, friendlyRegion)
+}
+
+// Limited reports whether the limits cap anything
+func (l TokenLimits) Limited() bool {
+	return l.MaxNodes > 0 || len(l.Regions) > 0
+}
+
+// Revoked reports whether the token has been revoked
+func (t *TokenInfo) Revoked() bool {
+	return !t.RevokedAt.IsZero()
+}
+
+// HasScope reports whether the token grants scope
+func (t *TokenInfo) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateTokenRequest represents a request to issue a new scoped token
+type CreateTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	TokenLimits
+}
+
+// CreateTokenResponse returns a newly issued token; Secret is shown exactly once
+type CreateTokenResponse struct {
+	Success bool       `json:"success"`
+	Message string     `json:"message"`
+	Secret  string     `json:"secret"`
+	Token   *TokenInfo `json:"token"`
+}
+
+// TokensResponse represents the response with issued token listings
+type TokensResponse struct {
+	Success bool         `json:"success"`
+	Message string       `json:"message"`
+	Tokens  []*TokenInfo `json:"tokens"`
+}
+
+// Job states
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// JobInfo describes a long-running operation the Lambda carries on with after
+// answering, such as an async cleanup
+type JobInfo struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"` // e.g. "cleanup"
+	Region    string          `json:"region,omitempty"`
+	Status    string          `json:"status"`           // JobRunning, JobSucceeded or JobFailed
+	Result    json.RawMessage `json:"result,omitempty"` // The response the synchronous request would have sent, once succeeded
+	Error     string          `json:"error,omitempty"`  // Why it failed
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Done reports whether the job has finished, successfully or not
+func (j *JobInfo) Done() bool {
+	return j.Status != JobRunning
+}
+
+// JobResponse represents the response with a job: 202 when one is started,
+// and 200 from GET /jobs/{id}
+type JobResponse struct {
+	Success bool     `json:"success"`
+	Message string   `json:"message"`
+	Job     *JobInfo `json:"job"`
+}
+
+// Actions a signed link can perform
+const (
+	LinkActionStart = "start"
+	LinkActionStop  = "stop"
+)
+
+// LinkAllRegions as a link's region stops exit nodes in every region
+const LinkAllRegions = "all"
+
+// CreateLinkRequest asks for a signed, expiring URL that performs one action
+// without a bearer token, e.g. for a phone shortcut
+type CreateLinkRequest struct {
+	Action string `json:"action"`        // LinkActionStart or LinkActionStop
+	Region string `json:"region"`        // Friendly region name, or LinkAllRegions to stop everywhere
+	TTL    string `json:"ttl,omitempty"` // How long the link works, as a Go duration (default 24h)
+}
+
+// CreateLinkResponse returns a signed link. Anyone holding the URL can use it
+// until it expires or TSE_AUTH_TOKEN is rotated.
+type CreateLinkResponse struct {
+	Success   bool      `json:"success"`
+	Message   string    `json:"message"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AuditEntry records one control action (or rejected attempt) against the Lambda
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"` // e.g. "start", "stop", "cleanup", "token.create", "link.create", "auth"
+	Region    string    `json:"region,omitempty"`
+	TokenID   string    `json:"token_id,omitempty"`
+	TokenName string    `json:"token_name,omitempty"`
+	SourceIP  string    `json:"source_ip"`
+	Status    int       `json:"status"` // HTTP status returned to the caller
+	Result    string    `json:"result"` // "ok" or a short error description
+}
+
+// AuditResponse represents the response with recent audit entries, newest first
+type AuditResponse struct {
+	Success bool          `json:"success"`
+	Message string        `json:"message"`
+	Entries []*AuditEntry `json:"entries"`
+	// Set when more entries follow. Lambdas don't page yet; the field is here so
+	// CLIs released before they do can tell the listing is incomplete.
+	NextToken string `json:"next_token,omitempty"`
+}
+
+// Security baselines selectable at deploy time (TSE_SECURITY_BASELINE)
+const (
+	BaselineStandard = "standard" // SSH and key pair for debugging, default egress
+	BaselineStrict   = "strict"   // No SSH or key pair, IMDSv2, encrypted EBS, locked egress
+)
+
+// Baselines lists every valid security baseline
+var Baselines = []string{BaselineStandard, BaselineStrict}
+
+// ComplianceViolation describes one way a node or security group falls short of a security baseline
+type ComplianceViolation struct {
+	Resource string `json:"resource"` // Instance or security group ID
+	Check    string `json:"check"`    // e.g. "key-pair", "imdsv2", "ebs-encryption", "ssh-ingress", "egress"
+	Detail   string `json:"detail"`
+}
+
+// ComplianceResponse represents the result of auditing a region against a security baseline
+type ComplianceResponse struct {
+	Success       bool                  `json:"success"`
+	Message       string                `json:"message"`
+	Region        string                `json:"region"`
+	Baseline      string                `json:"baseline"`
+	Compliant     bool                  `json:"compliant"`
+	NodesChecked  int                   `json:"nodes_checked"`
+	GroupsChecked int                   `json:"groups_checked"`
+	Violations    []ComplianceViolation `json:"violations"`
 }
 
 // HealthResponse represents the health check response
 type HealthResponse struct {
-	Status    string `json:"status"`
-	Version   string `json:"version"`
-	Timestamp string `json:"timestamp"`
+	Status     string `json:"status"`
+	Version    string `json:"version"`
+	APIVersion string `json:"api_version,omitempty"` // Empty from Lambdas that predate API versions
+	Timestamp  string `json:"timestamp"`
+	// Where the Lambda itself runs, so clients can spot a URL pointing at another
+	// deployment. Empty from Lambdas that predate them or couldn't look them up.
+	AccountID    string `json:"account_id,omitempty"`
+	Deployment   string `json:"deployment,omitempty"`    // Lambda function name
+	DeploymentID string `json:"deployment_id,omitempty"` // Tags the resources this deployment creates
+	Region       string `json:"region,omitempty"`        // Control-plane region
+	// Friendly names of the regions the Lambda can start nodes in, after
+	// TSE_CUSTOM_REGIONS and TSE_ONLY_REGIONS. Empty from older Lambdas.
+	Regions []string `json:"regions,omitempty"`
+
+	// The Lambda container that answered, to show whether requests are paying
+	// for cold starts. Empty from Lambdas that predate them.
+	Container *ContainerStats `json:"container,omitempty"`
+}
+
+// ContainerStats describes the Lambda container that answered a health check
+type ContainerStats struct {
+	ColdStart    bool   `json:"cold_start"`               // This request started the container
+	Started      string `json:"started"`                  // RFC 3339
+	Invocations  int64  `json:"invocations"`              // Requests and pings it has handled, this one included
+	WarmPings    int64  `json:"warm_pings"`               // Of those, warm-keeper pings
+	LastWarmPing string `json:"last_warm_ping,omitempty"` // RFC 3339
 }
 
+// WarmPing is the payload the warm-keeper schedule (tse deploy --keep-warm)
+// invokes the Lambda with. It only keeps the container warm: there's no
+// authentication and nothing else runs.
+type WarmPing struct {
+	Warm bool `json:"tse_warm"`
+}
+
+// APIVersion is the Lambda API's current version. Requests name it in the
+// path (/v1/ohio/start); unversioned paths are the original API, which v1
+// serves unchanged so older CLIs keep working. A breaking change gets a new
+// version next to this one rather than replacing it.
+const APIVersion = "v1"
+
+// APIVersionHeader carries the API version on every Lambda response. Lambdas
+// that predate API versions don't send it.
+const APIVersionHeader = "X-Tse-Api-Version"
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error"`
-	Code    int    `json:"code,omitempty"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error"`
+	Code      int       `json:"code,omitempty"`       // HTTP status
+	ErrorCode ErrorCode `json:"error_code,omitempty"` // What went wrong, for clients to branch on
+}
+
+// ErrorCode is a stable, machine-readable reason for an ErrorResponse.
+// Clients branch on it rather than the message, which is for people and may
+// change. Lambdas from before error codes send none; DefaultErrorCode stands
+// in for those.
+type ErrorCode string
+
+const (
+	ErrorCodeBadRequest         ErrorCode = "BAD_REQUEST"             // Malformed body or parameters
+	ErrorCodeRegionInvalid      ErrorCode = "REGION_INVALID"          // Not a region tse knows
+	ErrorCodeRegionDisabled     ErrorCode = "REGION_DISABLED"         // An opt-in region the account hasn't enabled
+	ErrorCodeAuthFailed         ErrorCode = "AUTH_FAILED"             // Missing, wrong, expired or revoked token
+	ErrorCodeScopeMissing       ErrorCode = "SCOPE_MISSING"           // The token lacks the scope the route needs
+	ErrorCodeNotFound           ErrorCode = "NOT_FOUND"               // No such route, token, or paused node
+	ErrorCodeAlreadyRunning     ErrorCode = "ALREADY_RUNNING"         // The region already has a running exit node
+	ErrorCodeStartInProgress    ErrorCode = "START_IN_PROGRESS"       // Another start or resume holds the region's lock
+	ErrorCodeNodePaused         ErrorCode = "NODE_PAUSED"             // The region's exit node is paused
+	ErrorCodeNothingPaused      ErrorCode = "NOTHING_PAUSED"          // Resume found no paused exit node
+	ErrorCodeNothingRunning     ErrorCode = "NOTHING_RUNNING"         // Restart found no exit node to replace
+	ErrorCodeRegionNotAllowed   ErrorCode = "REGION_NOT_ALLOWED"      // The token's limits don't allow starts in the region
+	ErrorCodeNodeLimit          ErrorCode = "NODE_LIMIT"              // The token already has as many exit nodes as its limits allow
+	ErrorCodeNodeCap            ErrorCode = "NODE_CAP"                // The deployment already has as many exit nodes as TSE_MAX_NODES allows
+	ErrorCodeReservationExists  ErrorCode = "RESERVATION_EXISTS"      // The region already has a capacity reservation
+	ErrorCodeNoCapacity         ErrorCode = "NO_CAPACITY"             // EC2 had no capacity for the instance type
+	ErrorCodeAWSThrottled       ErrorCode = "AWS_THROTTLED"           // AWS rate-limited the Lambda's API calls
+	ErrorCodeRateLimited        ErrorCode = "RATE_LIMITED"            // The Lambda rate-limited the caller
+	ErrorCodeStateTableMissing  ErrorCode = "STATE_TABLE_MISSING"     // The feature needs the state table
+	ErrorCodeMisconfigured      ErrorCode = "MISCONFIGURED"           // The Lambda's own setup is incomplete
+	ErrorCodeOutOfTime          ErrorCode = "OUT_OF_TIME"             // The request ran short of the Lambda's timeout and stopped
+	ErrorCodeVersionUnsupported ErrorCode = "API_VERSION_UNSUPPORTED" // The path names an API version the Lambda doesn't serve
+	ErrorCodeInternal           ErrorCode = "INTERNAL"                // Anything else that failed server-side
+)
+
+// DefaultErrorCode returns the code for an HTTP status when nothing more
+// specific applies, or for a response from a Lambda that sent no code
+func DefaultErrorCode(status int) ErrorCode {
+	switch {
+	case status == 400:
+		return ErrorCodeBadRequest
+	case status == 401:
+		return ErrorCodeAuthFailed
+	case status == 403:
+		return ErrorCodeScopeMissing
+	case status == 404:
+		return ErrorCodeNotFound
+	case status == 409:
+		return ErrorCodeAlreadyRunning
+	case status == 429:
+		return ErrorCodeRateLimited
+	case status == 501:
+		return ErrorCodeStateTableMissing
+	case status >= 500:
+		return ErrorCodeInternal
+	}
+	return ""
 }
@@ -2,6 +2,7 @@ package types
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 )
@@ -203,9 +204,10 @@ func TestInstancesResponseJSONSerialization(t *testing.T) {
 
 func TestErrorResponseJSONSerialization(t *testing.T) {
 	response := ErrorResponse{
-		Success: false,
-		Error:   "Instance not found",
-		Code:    404,
+		Success:   false,
+		Error:     "Instance not found",
+		Code:      404,
+		ErrorCode: ErrorCodeNotFound,
 	}
 
 	// Test JSON serialization
@@ -230,13 +232,45 @@ func TestErrorResponseJSONSerialization(t *testing.T) {
 	if unmarshaled.Code != response.Code {
 		t.Errorf("Code mismatch: got %d, want %d", unmarshaled.Code, response.Code)
 	}
+	if unmarshaled.ErrorCode != response.ErrorCode {
+		t.Errorf("ErrorCode mismatch: got %s, want %s", unmarshaled.ErrorCode, response.ErrorCode)
+	}
+	if !strings.Contains(string(jsonData), `"error_code":"NOT_FOUND"`) {
+		t.Errorf("JSON = %s, want an error_code field", jsonData)
+	}
+}
+
+func TestDefaultErrorCode(t *testing.T) {
+	tests := []struct {
+		status int
+		want   ErrorCode
+	}{
+		{400, ErrorCodeBadRequest},
+		{401, ErrorCodeAuthFailed},
+		{403, ErrorCodeScopeMissing},
+		{404, ErrorCodeNotFound},
+		{409, ErrorCodeAlreadyRunning},
+		{429, ErrorCodeRateLimited},
+		{500, ErrorCodeInternal},
+		{501, ErrorCodeStateTableMissing},
+		{503, ErrorCodeInternal},
+		{200, ""},
+	}
+	for _, tt := range tests {
+		if got := DefaultErrorCode(tt.status); got != tt.want {
+			t.Errorf("DefaultErrorCode(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
 }
 
 func TestHealthResponseJSONSerialization(t *testing.T) {
 	response := HealthResponse{
-		Status:    "healthy",
-		Version:   "1.0.0",
-		Timestamp: "2023-12-01T12:00:00Z",
+		Status:     "healthy",
+		Version:    "1.0.0",
+		Timestamp:  "2023-12-01T12:00:00Z",
+		AccountID:  "123456789012",
+		Deployment: "tailscale-exits",
+		Region:     "us-east-2",
 	}
 
 	// Test JSON serialization
@@ -261,4 +295,62 @@ func TestHealthResponseJSONSerialization(t *testing.T) {
 	if unmarshaled.Timestamp != response.Timestamp {
 		t.Errorf("Timestamp mismatch: got %s, want %s", unmarshaled.Timestamp, response.Timestamp)
 	}
+	if unmarshaled.AccountID != response.AccountID || unmarshaled.Deployment != response.Deployment || unmarshaled.Region != response.Region {
+		t.Errorf("identity mismatch: got %s/%s/%s, want %s/%s/%s", unmarshaled.AccountID, unmarshaled.Deployment, unmarshaled.Region,
+			response.AccountID, response.Deployment, response.Region)
+	}
+}
+
+func TestSummarizeResources(t *testing.T) {
+	resources := []string{
+		"Instance:i-1234567890abcdef0",
+		"Instance:i-0987654321fedcba0",
+		"SecurityGroup:sg-0abc",
+		"VPC:vpc-0abc",
+		"malformed",
+	}
+
+	got := SummarizeResources(resources)
+	want := map[string]int{"Instance": 2, "SecurityGroup": 1, "VPC": 1, "Other": 1}
+
+	if len(got) != len(want) {
+		t.Fatalf("SummarizeResources() returned %d types, want %d: %v", len(got), len(want), got)
+	}
+	for kind, count := range want {
+		if got[kind] != count {
+			t.Errorf("SummarizeResources()[%q] = %d, want %d", kind, got[kind], count)
+		}
+	}
+}
+
+func TestHopConfigValidate(t *testing.T) {
+	const key = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="
+	entry := HopConfig{Role: HopEntry, PeerRegion: "frankfurt", PrivateKey: key, PeerPublicKey: key, Endpoint: "3.120.0.1:51820"}
+	exit := HopConfig{Role: HopExit, PeerRegion: "ohio", PrivateKey: key, PeerPublicKey: key}
+
+	for _, h := range []HopConfig{entry, exit} {
+		if err := h.Validate(); err != nil {
+			t.Errorf("Validate(%s) = %v", h.Role, err)
+		}
+	}
+
+	bad := map[string]func(h *HopConfig){
+		"unknown role":      func(h *HopConfig) { h.Role = "middle" },
+		"no endpoint":       func(h *HopConfig) { h.Endpoint = "" },
+		"endpoint hostname": func(h *HopConfig) { h.Endpoint = "example.com:51820" },
+		"short key":         func(h *HopConfig) { h.PrivateKey = "AAEC" },
+		"no peer region":    func(h *HopConfig) { h.PeerRegion = "" },
+	}
+	for name, change := range bad {
+		h := entry
+		change(&h)
+		if err := h.Validate(); err == nil {
+			t.Errorf("Validate(%s) succeeded", name)
+		}
+	}
+
+	exit.Endpoint = "3.120.0.1:51820"
+	if err := exit.Validate(); err == nil {
+		t.Error("Validate(exit with endpoint) succeeded")
+	}
 }
@@ -0,0 +1,32 @@
+package types
+
+import (
+	"fmt"
+	"io"
+)
+
+// Wire format rules, so a CLI and Lambda from different releases keep talking:
+//   - Fields are only added, never renamed, retyped, or removed. Golden files in
+//     testdata pin the encoding of every request and response.
+//   - Optional fields carry omitempty (omitzero for time.Time); fields a client
+//     relies on, such as success and message, are always present.
+//   - time.Time fields encode as RFC 3339 in UTC; string timestamps use time.RFC3339.
+//   - Field order is struct order, so new fields go at the end of a struct.
+
+// MaxPayloadBytes is the largest request or response body either side accepts.
+// It's the synchronous payload limit of a Lambda function URL; a bigger response
+// would fail in AWS with an opaque error, so listings that could outgrow it
+// carry a NextToken for paging.
+const MaxPayloadBytes = 6 * 1024 * 1024
+
+// ReadPayload reads a request or response body, refusing one larger than MaxPayloadBytes
+func ReadPayload(r io.Reader) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, MaxPayloadBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > MaxPayloadBytes {
+		return nil, fmt.Errorf("payload exceeds %d MB limit", MaxPayloadBytes/(1024*1024))
+	}
+	return body, nil
+}
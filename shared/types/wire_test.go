@@ -0,0 +1,147 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata golden files")
+
+// wireFixtures are the payloads pinned in testdata. "full" fixtures set every
+// field; "minimal" ones check which fields omitempty drops.
+func wireFixtures() map[string]any {
+	launched := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	instance := &InstanceInfo{
+		InstanceID:            "i-0123456789abcdef0",
+		Region:                "us-east-2",
+		FriendlyRegion:        "ohio",
+		State:                 "running",
+		PublicIP:              "3.14.15.92",
+		PrivateIP:             "10.0.1.10",
+		LaunchTime:            launched,
+		InstanceType:          "t4g.nano",
+		Architecture:          "arm64",
+		TailscaleHostname:     "exit-ohio",
+		TailscaleIP:           "100.64.0.1",
+		TailscaleIPv6:         "fd7a:115c:a1e0::1",
+		Ready:                 true,
+		CapacityReservationID: "cr-0123456789abcdef0",
+		ClientToken:           "9b2f0c1e4d5a6b7c8d9e0f1a2b3c4d5e",
+		NetworkOutBytes:       3435973837,
+		Hop:                   "entry:frankfurt",
+		StartedBy:             "partner-laptop",
+		StartedByID:           "3f9a2c1b7d4e",
+	}
+	token := &TokenInfo{
+		ID:        "tok_abc123",
+		Name:      "ci",
+		Scopes:    []string{ScopeRead, ScopeStart},
+		CreatedAt: launched,
+		RevokedAt: launched.Add(time.Hour),
+		TokenLimits: TokenLimits{
+			MaxNodes: 2,
+			Regions:  []string{"ohio", "frankfurt"},
+		},
+	}
+
+	return map[string]any{
+		"instance_full":    instance,
+		"instance_minimal": &InstanceInfo{InstanceID: "i-0123456789abcdef0", Region: "us-east-2", FriendlyRegion: "ohio", State: "pending", LaunchTime: launched, InstanceType: "t4g.nano"},
+		"start_request": &StartRequest{Region: "ohio", DryRun: true, Plan: true, ClientToken: "9b2f0c1e4d5a6b7c8d9e0f1a2b3c4d5e", DNS: "mullvad", AdvertiseRoutes: []string{"10.0.0.0/16"},
+			Hop: &HopConfig{Role: HopEntry, PeerRegion: "frankfurt", PrivateKey: "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=", PeerPublicKey: "ICEiIyQlJicoKSorLC0uLzAxMjM0NTY3ODk6Ozw9Pj8=", Endpoint: "3.120.0.1:51820"}},
+		"start_response": &StartResponse{Success: true, Message: "Exit node started in ohio region", Instance: instance, ClientToken: "9b2f0c1e4d5a6b7c8d9e0f1a2b3c4d5e", Replayed: true},
+		"start_dry_run_response": &StartResponse{Success: true, Message: "Dry run: would start an exit node in ohio region", ClientToken: "9b2f0c1e4d5a6b7c8d9e0f1a2b3c4d5e",
+			Plan: []string{"ec2:RunInstances ImageId=ami-0abc InstanceType=t4g.nano"}},
+		"stop_response": &StopResponse{Success: true, Message: "Terminated 1 instance", TerminatedCount: 1, TerminatedIDs: []string{"i-0123456789abcdef0"}, SkippedIDs: []string{"VPC:vpc-0abc"}, NetworkOutBytes: 3435973837},
+		"restart_response": &RestartResponse{Success: true, Message: "Exit node restarted in ohio region", TerminatedIDs: []string{"i-0fedcba9876543210"}, Instance: instance,
+			ClientToken: "9b2f0c1e4d5a6b7c8d9e0f1a2b3c4d5e", Replayed: true},
+		"instances_response": &InstancesResponse{
+			Success: true, Message: "Found 1 instances in ohio", Instances: []*InstanceInfo{instance}, Count: 1,
+		},
+		"cleanup_request": &CleanupRequest{DryRun: true, Force: true},
+		"adopt_request":   &AdoptRequest{Candidates: []AdoptCandidate{{Hostname: "exit-ohio", PublicIPs: []string{"3.14.15.92"}}}, DryRun: true},
+		"adopt_response":  &AdoptResponse{Success: true, Message: "Adopted 1 instance", Adopted: []*InstanceInfo{instance}, Unmatched: []string{"exit-tokyo"}, DryRun: true},
+		"reservation_response": &ReservationResponse{Success: true, Message: "Reservation active", Reservation: &ReservationInfo{
+			ReservationID: "cr-0123456789abcdef0", Region: "us-east-2", FriendlyRegion: "ohio", AvailabilityZone: "us-east-2a",
+			InstanceType: "t4g.nano", State: "active", TotalInstances: 1, AvailableInstances: 0, CreateTime: launched,
+		}},
+		"network_response": &NetworkResponse{Success: true, Message: "Removed VPC vpc-0123456789abcdef0 in ohio region", Removed: true, Network: &NetworkInfo{
+			VPCID: "vpc-0123456789abcdef0", SubnetID: "subnet-0123456789abcdef0", Region: "us-east-2", FriendlyRegion: "ohio",
+		}},
+		"create_token_request":  &CreateTokenRequest{Name: "ci", Scopes: []string{ScopeRead}, TokenLimits: TokenLimits{MaxNodes: 1, Regions: []string{"ohio"}}},
+		"create_token_response": &CreateTokenResponse{Success: true, Message: "Token created", Secret: "tse_secret", Token: token},
+		"tokens_response":       &TokensResponse{Success: true, Message: "1 token", Tokens: []*TokenInfo{token}},
+		"token_minimal":         &TokenInfo{ID: "tok_abc123", Name: "ci", Scopes: []string{ScopeRead}, CreatedAt: launched},
+		"audit_response": &AuditResponse{Success: true, Message: "Found 1 audit entries in the last 24h0m0s", Entries: []*AuditEntry{
+			{Time: launched, Action: "start", Region: "ohio", TokenID: "tok_abc123", TokenName: "ci", SourceIP: "203.0.113.7", Status: 200, Result: "ok"},
+		}, NextToken: "next"},
+		"compliance_response": &ComplianceResponse{
+			Success: true, Message: "1 violation", Region: "ohio", Baseline: BaselineStrict, Compliant: false, NodesChecked: 1, GroupsChecked: 1,
+			Violations: []ComplianceViolation{{Resource: "i-0123456789abcdef0", Check: "imdsv2", Detail: "IMDSv1 enabled"}},
+		},
+		"health_full":    &HealthResponse{Status: "healthy", Version: "v1.2.3", Timestamp: "2025-03-01T12:00:00Z", AccountID: "123456789012", Deployment: "tailscale-exits", Region: "us-east-2"},
+		"health_minimal": &HealthResponse{Status: "healthy", Version: "dev", Timestamp: "2025-03-01T12:00:00Z"},
+		"error_response": &ErrorResponse{Success: false, Error: "Region not supported", Code: 400},
+	}
+}
+
+// TestWireGolden pins the JSON encoding of every payload. A failure means the
+// wire format changed: if that's intended and compatible (a new optional field),
+// rerun with -update; never rename or drop a field.
+func TestWireGolden(t *testing.T) {
+	for name, value := range wireFixtures() {
+		t.Run(name, func(t *testing.T) {
+			got, err := json.MarshalIndent(value, "", "  ")
+			if err != nil {
+				t.Fatalf("Failed to marshal: %v", err)
+			}
+			got = append(got, '\n')
+
+			path := filepath.Join("testdata", name+".json")
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Missing golden file (run go test -update): %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s changed:\ngot:\n%s\nwant:\n%s", path, got, want)
+			}
+
+			// Decoding the golden file must give back the same value, so payloads
+			// from an older release still read the same
+			decoded := reflect.New(reflect.TypeOf(value).Elem()).Interface()
+			if err := json.Unmarshal(want, decoded); err != nil {
+				t.Fatalf("Failed to unmarshal golden file: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, value) {
+				t.Errorf("Decoded %s = %+v, want %+v", path, decoded, value)
+			}
+		})
+	}
+}
+
+func TestReadPayload(t *testing.T) {
+	body, err := ReadPayload(strings.NewReader(`{"success":true}`))
+	if err != nil || string(body) != `{"success":true}` {
+		t.Errorf("ReadPayload = %q, %v", body, err)
+	}
+
+	if _, err := ReadPayload(strings.NewReader(strings.Repeat("x", MaxPayloadBytes))); err != nil {
+		t.Errorf("ReadPayload at the limit failed: %v", err)
+	}
+	if _, err := ReadPayload(strings.NewReader(strings.Repeat("x", MaxPayloadBytes+1))); err == nil {
+		t.Error("ReadPayload over the limit succeeded")
+	}
+}